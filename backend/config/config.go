@@ -1,68 +1,387 @@
 package config
 
 import (
-	"log"
-	"os"
-
-	"github.com/joho/godotenv"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
 )
 
-// Config holds the configuration values
+// Config holds the configuration values.
+//
+// Every field has a yaml key (also used as the command-line flag name, with
+// nested keys joined by dots) and most have an environment variable. The env
+// tag of a struct field is a prefix for the variables of its fields.
+// Fields tagged secret:"true" are redacted when the configuration is printed.
 type Config struct {
-	PortNumber       string
-	CertFile         string
-	KeyFile          string
-	Database         DatabaseConfig
-	MessagesDatabase DatabaseConfig
+	PortNumber       string             `yaml:"port_number" env:"PORT_NUMBER" usage:"HTTPS listen address"`
+	HTTPRedirectPort string             `yaml:"http_redirect_port" env:"HTTP_REDIRECT_PORT" usage:"plain HTTP listen address that redirects to HTTPS, empty to disable"`
+	CertFile         string             `yaml:"cert_file" env:"CERT_FILE" usage:"TLS certificate file"`
+	KeyFile          string             `yaml:"key_file" env:"KEY_FILE" usage:"TLS private key file"`
+	DevMode          bool               `yaml:"dev_mode" env:"DEV_MODE" usage:"generate a self-signed certificate when none is available"`
+	HSTSMaxAge       int                `yaml:"hsts_max_age" env:"HSTS_MAX_AGE" usage:"Strict-Transport-Security max-age in seconds, 0 to disable"`
+	ShutdownTimeout  time.Duration      `yaml:"shutdown_timeout" env:"SHUTDOWN_TIMEOUT" usage:"how long in-flight requests may take to finish on shutdown"`
+	PublicURL        string             `yaml:"public_url" env:"PUBLIC_URL" usage:"URL the forum is reached at, used for the links in feeds"`
+	Database         DatabaseConfig     `yaml:"database" env:"DB_"`
+	MessagesDatabase MessagesConfig     `yaml:"messages_database" env:"MESSAGES_DB_"`
+	Security         SecurityConfig     `yaml:"security"`
+	Session          SessionConfig      `yaml:"session"`
+	Logging          LoggingConfig      `yaml:"logging"`
+	Pagination       PaginationConfig   `yaml:"pagination"`
+	WebSocket        WebSocketConfig    `yaml:"websocket"`
+	Voting           VotingConfig       `yaml:"voting"`
+	Drafts           DraftsConfig       `yaml:"drafts"`
+	Validation       ValidationConfig   `yaml:"validation"`
+	Attachments      AttachmentsConfig  `yaml:"attachments"`
+	LinkPreviews     LinkPreviewsConfig `yaml:"link_previews" env:"LINK_PREVIEWS_"`
+	Webhooks         WebhooksConfig     `yaml:"webhooks" env:"WEBHOOKS_"`
+	Events           EventsConfig       `yaml:"events" env:"EVENTS_"`
 }
 
+// Database drivers
+const (
+	DriverSQLite   = "sqlite3"
+	DriverPostgres = "postgres"
+)
+
 // DatabaseConfig holds the configuration for the database
 type DatabaseConfig struct {
-	Path       string
-	InitScript string
+	Driver     string `yaml:"driver" env:"DRIVER" usage:"database driver: sqlite3 or postgres"`
+	Path       string `yaml:"path" env:"PATH" usage:"SQLite database file"`
+	DSN        string `yaml:"dsn" env:"DSN" secret:"true" usage:"PostgreSQL connection string, used by the postgres driver"`
+	InitScript string `yaml:"init_script" env:"INIT_SCRIPT" usage:"SQL script run on startup, defaults to the schema of the driver"`
+	// The SQLite settings also apply to the messages database
+	BusyTimeout  time.Duration `yaml:"busy_timeout" env:"BUSY_TIMEOUT" usage:"how long SQLite waits for a lock before failing"`
+	ReadPoolSize int           `yaml:"read_pool_size" env:"READ_POOL_SIZE" usage:"number of SQLite read connections next to the single writer"`
 }
 
-// AppConfig holds the global application configuration
-var AppConfig Config
+// MessagesConfig holds the configuration for the SQLite chat message database.
+// The postgres driver keeps messages in the main database instead.
+type MessagesConfig struct {
+	Path string `yaml:"path" env:"PATH" usage:"SQLite database file for chat messages"`
+}
 
-// LoadConfig loads configuration from environment variables or .env file
-func LoadConfig() {
-	err := godotenv.Load()
-	if err != nil {
-		log.Println("Error loading .env file")
-	}
+// initScripts are the default schema scripts per driver
+var initScripts = map[string]string{
+	DriverSQLite:   "pkg/db/data/database.sql",
+	DriverPostgres: "pkg/db/data/postgres.sql",
+}
+
+// SecurityConfig holds the cookie and origin policy for browser requests
+type SecurityConfig struct {
+	AllowedOrigins []string `yaml:"allowed_origins" env:"ALLOWED_ORIGINS" usage:"comma separated origins allowed to send cookie-authenticated requests"`
+	CookieSecure   bool     `yaml:"cookie_secure" env:"COOKIE_SECURE" usage:"send cookies over HTTPS only"`
+	CookieSameSite string   `yaml:"cookie_samesite" env:"COOKIE_SAMESITE" usage:"SameSite cookie policy: lax, strict or none"`
+	AdminNicknames []string `yaml:"admin_nicknames" env:"ADMIN_NICKNAMES" usage:"comma separated nicknames of admins"`
+}
+
+// SessionConfig holds the login session settings
+type SessionConfig struct {
+	Lifetime time.Duration `yaml:"lifetime" env:"SESSION_LIFETIME" usage:"how long a login session stays valid"`
+}
+
+// LoggingConfig holds the log output settings
+type LoggingConfig struct {
+	Format string `yaml:"format" env:"LOG_FORMAT" usage:"log format: json or text"`
+	Level  string `yaml:"level" env:"LOG_LEVEL" usage:"log level: debug, info, warn or error"`
+}
+
+// PaginationConfig holds the page size limits for list endpoints
+type PaginationConfig struct {
+	DefaultPageSize int `yaml:"default_page_size" env:"DEFAULT_PAGE_SIZE" usage:"page size when the pageSize parameter is missing"`
+	MaxPageSize     int `yaml:"max_page_size" env:"MAX_PAGE_SIZE" usage:"largest accepted pageSize parameter"`
+}
+
+// WebSocketConfig holds the chat connection timings
+type WebSocketConfig struct {
+	PingInterval        time.Duration `yaml:"ping_interval" env:"WS_PING_INTERVAL" usage:"how often clients are pinged"`
+	ActiveUsersInterval time.Duration `yaml:"active_users_interval" env:"WS_ACTIVE_USERS_INTERVAL" usage:"how often the active users list is broadcast"`
+	WriteTimeout        time.Duration `yaml:"write_timeout" env:"WS_WRITE_TIMEOUT" usage:"how long a write to a client may take before the connection is given up"`
+}
+
+// VotingConfig holds the settings of the vote totals and rankings maintenance
+type VotingConfig struct {
+	ReconcileInterval time.Duration `yaml:"reconcile_interval" env:"VOTE_RECONCILE_INTERVAL" usage:"how often vote totals are recomputed from the votes, 0 to disable"`
+	RankingInterval   time.Duration `yaml:"ranking_interval" env:"VOTE_RANKING_INTERVAL" usage:"how often the top and rising rankings are refreshed, 0 to refresh on startup only"`
+}
+
+// DraftsConfig holds the settings of scheduled publishing
+type DraftsConfig struct {
+	PublishInterval time.Duration `yaml:"publish_interval" env:"DRAFTS_PUBLISH_INTERVAL" usage:"how often scheduled drafts are checked and published, 0 to disable"`
+}
+
+// ValidationConfig holds the limits enforced on user input
+type ValidationConfig struct {
+	NicknameMinLength       int `yaml:"nickname_min_length" usage:"shortest allowed nickname"`
+	PasswordMinLength       int `yaml:"password_min_length" usage:"shortest allowed password"`
+	TitleMinLength          int `yaml:"title_min_length" usage:"shortest allowed post title"`
+	TitleMaxLength          int `yaml:"title_max_length" usage:"longest allowed post title"`
+	PostMaxLength           int `yaml:"post_max_length" usage:"longest allowed post content"`
+	CommentMaxLength        int `yaml:"comment_max_length" usage:"longest allowed comment"`
+	MaxCategories           int `yaml:"max_categories" usage:"most categories per post"`
+	CategoryMaxLength       int `yaml:"category_max_length" usage:"longest allowed category name"`
+	TokenNameMaxLength      int `yaml:"token_name_max_length" usage:"longest allowed access token name"`
+	TokenMaxLifetimeDays    int `yaml:"token_max_lifetime_days" usage:"longest allowed access token lifetime in days"`
+	CollectionNameMaxLength int `yaml:"collection_name_max_length" usage:"longest allowed bookmark collection name"`
+	MaxAttachments          int `yaml:"max_attachments" usage:"most attachments per post, comment or chat message"`
+	PollQuestionMaxLength   int `yaml:"poll_question_max_length" usage:"longest allowed poll question"`
+	MaxPollOptions          int `yaml:"max_poll_options" usage:"most options per poll"`
+	PollOptionMaxLength     int `yaml:"poll_option_max_length" usage:"longest allowed poll option"`
+}
+
+// AttachmentsConfig holds where uploaded files are kept and which are accepted
+type AttachmentsConfig struct {
+	Dir           string   `yaml:"dir" env:"ATTACHMENTS_DIR" usage:"directory uploaded files are stored in"`
+	MaxSize       int      `yaml:"max_size" env:"ATTACHMENTS_MAX_SIZE" usage:"largest accepted upload in bytes"`
+	AllowedTypes  []string `yaml:"allowed_types" env:"ATTACHMENTS_ALLOWED_TYPES" usage:"comma separated MIME types accepted for upload, detected from the content"`
+	MaxPixels     int      `yaml:"max_pixels" usage:"most pixels of an accepted image"`
+	ThumbnailSize int      `yaml:"thumbnail_size" usage:"longest side of image thumbnails in pixels"`
+}
+
+// LinkPreviewsConfig holds how the pages linked from posts and chat messages are fetched
+type LinkPreviewsConfig struct {
+	Enabled      bool          `yaml:"enabled" env:"ENABLED" usage:"fetch previews of the links in posts and chat messages"`
+	Timeout      time.Duration `yaml:"timeout" env:"TIMEOUT" usage:"how long fetching a page may take"`
+	MaxSize      int           `yaml:"max_size" usage:"most bytes read from a page"`
+	CacheTTL     time.Duration `yaml:"cache_ttl" usage:"how long a fetched preview is reused before the page is fetched again"`
+	Workers      int           `yaml:"workers" usage:"pages fetched at the same time"`
+	AllowPrivate bool          `yaml:"allow_private" env:"ALLOW_PRIVATE" usage:"allow fetching pages on loopback and private addresses, for testing only"`
+}
+
+// WebhooksConfig holds how events are delivered to the registered webhooks
+type WebhooksConfig struct {
+	Timeout      time.Duration `yaml:"timeout" env:"TIMEOUT" usage:"how long a webhook endpoint may take to answer a delivery"`
+	MaxAttempts  int           `yaml:"max_attempts" env:"MAX_ATTEMPTS" usage:"attempts after which a delivery is marked failed"`
+	BackoffBase  time.Duration `yaml:"backoff_base" env:"BACKOFF_BASE" usage:"wait before the second attempt of a delivery, doubled for every further attempt"`
+	BackoffMax   time.Duration `yaml:"backoff_max" env:"BACKOFF_MAX" usage:"longest wait between two attempts of a delivery"`
+	PollInterval time.Duration `yaml:"poll_interval" env:"POLL_INTERVAL" usage:"how often the delivery queue is checked for retries that are due"`
+}
+
+// EventsConfig holds how the events recorded in the outbox are handed to
+// their subscribers
+type EventsConfig struct {
+	PollInterval time.Duration `yaml:"poll_interval" env:"POLL_INTERVAL" usage:"how often the outbox is checked for events recorded elsewhere or due for a retry"`
+	MaxAttempts  int           `yaml:"max_attempts" env:"MAX_ATTEMPTS" usage:"attempts after which an event a subscriber keeps failing on is given up"`
+	RetryDelay   time.Duration `yaml:"retry_delay" env:"RETRY_DELAY" usage:"wait before an event is handed out again after a subscriber failed on it"`
+	Retention    time.Duration `yaml:"retention" env:"RETENTION" usage:"how long dispatched events are kept in the outbox"`
+}
 
-	AppConfig = Config{
-		PortNumber:       mustGetEnv("PORT_NUMBER"),
-		CertFile:         mustGetEnv("CERT_FILE"),
-		KeyFile:          mustGetEnv("KEY_FILE"),
-		Database:         loadDatabaseConfig("DB_PATH", "DB_INIT_SCRIPT"),
-		MessagesDatabase: loadDatabaseConfig("MESSAGES_DB_PATH", ""),
+// Default returns the built-in configuration that the other sources are layered on
+func Default() Config {
+	return Config{
+		PortNumber:      ":8443",
+		CertFile:        "certs/localhost.crt",
+		KeyFile:         "certs/localhost.key",
+		HSTSMaxAge:      31536000,
+		ShutdownTimeout: 15 * time.Second,
+		PublicURL:       "https://localhost:8443",
+		Database: DatabaseConfig{
+			Driver:       DriverSQLite,
+			Path:         "pkg/db/data/app_database.db",
+			BusyTimeout:  5 * time.Second,
+			ReadPoolSize: 4,
+		},
+		MessagesDatabase: MessagesConfig{
+			Path: "pkg/db/data/messages.db",
+		},
+		Security: SecurityConfig{
+			CookieSameSite: "lax",
+		},
+		Session: SessionConfig{
+			Lifetime: 24 * time.Hour,
+		},
+		Logging: LoggingConfig{
+			Format: "json",
+			Level:  "info",
+		},
+		Pagination: PaginationConfig{
+			DefaultPageSize: 20,
+			MaxPageSize:     100,
+		},
+		WebSocket: WebSocketConfig{
+			PingInterval:        30 * time.Second,
+			ActiveUsersInterval: 5 * time.Second,
+			WriteTimeout:        10 * time.Second,
+		},
+		Voting: VotingConfig{
+			ReconcileInterval: time.Hour,
+			RankingInterval:   10 * time.Minute,
+		},
+		Drafts: DraftsConfig{
+			PublishInterval: time.Minute,
+		},
+		Validation: ValidationConfig{
+			NicknameMinLength:       3,
+			PasswordMinLength:       6,
+			TitleMinLength:          6,
+			TitleMaxLength:          48,
+			PostMaxLength:           256,
+			CommentMaxLength:        256,
+			MaxCategories:           5,
+			CategoryMaxLength:       15,
+			TokenNameMaxLength:      48,
+			TokenMaxLifetimeDays:    365,
+			CollectionNameMaxLength: 48,
+			MaxAttachments:          10,
+			PollQuestionMaxLength:   100,
+			MaxPollOptions:          10,
+			PollOptionMaxLength:     80,
+		},
+		Attachments: AttachmentsConfig{
+			Dir:           "pkg/db/data/attachments",
+			MaxSize:       10 << 20,
+			AllowedTypes:  []string{"image/jpeg", "image/png", "image/gif", "application/pdf", "text/plain"},
+			MaxPixels:     16000000,
+			ThumbnailSize: 320,
+		},
+		LinkPreviews: LinkPreviewsConfig{
+			Enabled:  true,
+			Timeout:  5 * time.Second,
+			MaxSize:  1 << 20,
+			CacheTTL: 24 * time.Hour,
+			Workers:  4,
+		},
+		Webhooks: WebhooksConfig{
+			Timeout:      10 * time.Second,
+			MaxAttempts:  8,
+			BackoffBase:  30 * time.Second,
+			BackoffMax:   6 * time.Hour,
+			PollInterval: 5 * time.Second,
+		},
+		Events: EventsConfig{
+			PollInterval: 5 * time.Second,
+			MaxAttempts:  5,
+			RetryDelay:   time.Minute,
+			Retention:    7 * 24 * time.Hour,
+		},
 	}
 }
 
-// loadDatabaseConfig loads database configuration from environment variables
-func loadDatabaseConfig(pathKey, initScriptKey string) DatabaseConfig {
-	return DatabaseConfig{
-		Path:       mustGetEnv(pathKey),
-		InitScript: getEnv(initScriptKey, ""),
+// Validate checks the configuration and returns all problems at once
+func (c Config) Validate() error {
+	var errs []error
+	check := func(ok bool, format string, args ...interface{}) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+
+	check(validAddr(c.PortNumber), "port_number: %q is not a valid listen address", c.PortNumber)
+	check(c.HTTPRedirectPort == "" || validAddr(c.HTTPRedirectPort), "http_redirect_port: %q is not a valid listen address", c.HTTPRedirectPort)
+	check(c.CertFile != "", "cert_file: must be set")
+	check(c.KeyFile != "", "key_file: must be set")
+	check(c.HSTSMaxAge >= 0, "hsts_max_age: must not be negative")
+	check(c.ShutdownTimeout > 0, "shutdown_timeout: must be positive")
+	check(validPublicURL(c.PublicURL), "public_url: %q must be an http or https URL without a query", c.PublicURL)
+	switch c.Database.Driver {
+	case DriverSQLite:
+		check(c.Database.Path != "", "database.path: must be set")
+		check(c.MessagesDatabase.Path != "", "messages_database.path: must be set")
+		check(c.Database.BusyTimeout >= 0, "database.busy_timeout: must not be negative")
+		check(c.Database.ReadPoolSize > 0, "database.read_pool_size: must be positive")
+	case DriverPostgres:
+		check(c.Database.DSN != "", "database.dsn: must be set for the postgres driver")
+	default:
+		check(false, "database.driver: %q must be sqlite3 or postgres", c.Database.Driver)
 	}
+
+	check(validSameSite(c.Security.CookieSameSite), "security.cookie_samesite: %q must be lax, strict or none", c.Security.CookieSameSite)
+	check(!strings.EqualFold(c.Security.CookieSameSite, "none") || c.Security.CookieSecure, "security.cookie_samesite: none requires security.cookie_secure")
+	check(c.Session.Lifetime > 0, "session.lifetime: must be positive")
+
+	check(c.Logging.Format == "json" || c.Logging.Format == "text", "logging.format: %q must be json or text", c.Logging.Format)
+	var level slog.Level
+	check(level.UnmarshalText([]byte(c.Logging.Level)) == nil, "logging.level: %q must be debug, info, warn or error", c.Logging.Level)
+
+	check(c.Pagination.DefaultPageSize > 0, "pagination.default_page_size: must be positive")
+	check(c.Pagination.MaxPageSize >= c.Pagination.DefaultPageSize, "pagination.max_page_size: must be at least default_page_size")
+	check(c.WebSocket.PingInterval > 0, "websocket.ping_interval: must be positive")
+	check(c.WebSocket.ActiveUsersInterval > 0, "websocket.active_users_interval: must be positive")
+	check(c.WebSocket.WriteTimeout > 0, "websocket.write_timeout: must be positive")
+	check(c.Voting.ReconcileInterval >= 0, "voting.reconcile_interval: must not be negative")
+	check(c.Voting.RankingInterval >= 0, "voting.ranking_interval: must not be negative")
+	check(c.Drafts.PublishInterval >= 0, "drafts.publish_interval: must not be negative")
+
+	v := c.Validation
+	check(v.NicknameMinLength > 0, "validation.nickname_min_length: must be positive")
+	check(v.PasswordMinLength > 0, "validation.password_min_length: must be positive")
+	check(v.TitleMinLength > 0 && v.TitleMinLength <= v.TitleMaxLength, "validation.title_min_length: must be positive and not above title_max_length")
+	check(v.PostMaxLength > 0, "validation.post_max_length: must be positive")
+	check(v.CommentMaxLength > 0, "validation.comment_max_length: must be positive")
+	check(v.MaxCategories > 0, "validation.max_categories: must be positive")
+	check(v.CategoryMaxLength > 0, "validation.category_max_length: must be positive")
+	check(v.TokenNameMaxLength > 0, "validation.token_name_max_length: must be positive")
+	check(v.TokenMaxLifetimeDays >= 0, "validation.token_max_lifetime_days: must not be negative")
+	check(v.CollectionNameMaxLength > 0, "validation.collection_name_max_length: must be positive")
+	check(v.MaxAttachments >= 0, "validation.max_attachments: must not be negative")
+	check(v.PollQuestionMaxLength > 0, "validation.poll_question_max_length: must be positive")
+	check(v.MaxPollOptions >= 2, "validation.max_poll_options: must be at least 2")
+	check(v.PollOptionMaxLength > 0, "validation.poll_option_max_length: must be positive")
+
+	a := c.Attachments
+	check(a.Dir != "", "attachments.dir: must be set")
+	check(a.MaxSize > 0, "attachments.max_size: must be positive")
+	check(len(a.AllowedTypes) > 0, "attachments.allowed_types: must not be empty")
+	check(a.MaxPixels > 0, "attachments.max_pixels: must be positive")
+	check(a.ThumbnailSize > 0, "attachments.thumbnail_size: must be positive")
+
+	lp := c.LinkPreviews
+	check(lp.Timeout > 0, "link_previews.timeout: must be positive")
+	check(lp.MaxSize > 0, "link_previews.max_size: must be positive")
+	check(lp.CacheTTL > 0, "link_previews.cache_ttl: must be positive")
+	check(lp.Workers > 0, "link_previews.workers: must be positive")
+
+	wh := c.Webhooks
+	check(wh.Timeout > 0, "webhooks.timeout: must be positive")
+	check(wh.MaxAttempts > 0, "webhooks.max_attempts: must be positive")
+	check(wh.BackoffBase > 0, "webhooks.backoff_base: must be positive")
+	check(wh.BackoffMax >= wh.BackoffBase, "webhooks.backoff_max: must not be shorter than webhooks.backoff_base")
+	check(wh.PollInterval > 0, "webhooks.poll_interval: must be positive")
+
+	ev := c.Events
+	check(ev.PollInterval > 0, "events.poll_interval: must be positive")
+	check(ev.MaxAttempts > 0, "events.max_attempts: must be positive")
+	check(ev.RetryDelay > 0, "events.retry_delay: must be positive")
+	check(ev.Retention > 0, "events.retention: must be positive")
+
+	return errors.Join(errs...)
 }
 
-// mustGetEnv reads an environment variable or logs a fatal error if not found
-func mustGetEnv(key string) string {
-	value, exists := os.LookupEnv(key)
-	if !exists {
-		log.Fatalf("Environment variable %s not set", key)
+// SameSiteMode converts the configured SameSite name to its http.SameSite value
+func (s SecurityConfig) SameSiteMode() http.SameSite {
+	switch strings.ToLower(s.CookieSameSite) {
+	case "strict":
+		return http.SameSiteStrictMode
+	case "none":
+		return http.SameSiteNoneMode
+	default:
+		return http.SameSiteLaxMode
 	}
-	return value
 }
 
-// getEnv reads an environment variable or returns a default value
-func getEnv(key, defaultValue string) string {
-	value, exists := os.LookupEnv(key)
-	if !exists {
-		return defaultValue
+// validSameSite reports whether value names a SameSite policy
+func validSameSite(value string) bool {
+	switch strings.ToLower(value) {
+	case "lax", "strict", "none":
+		return true
 	}
-	return value
-}
\ No newline at end of file
+	return false
+}
+
+// validPublicURL reports whether value is an absolute http or https URL that
+// links can be built on
+func validPublicURL(value string) bool {
+	u, err := url.Parse(value)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != "" &&
+		u.User == nil && u.RawQuery == "" && u.Fragment == ""
+}
+
+// validAddr reports whether addr is a host:port listen address
+func validAddr(addr string) bool {
+	_, port, err := net.SplitHostPort(addr)
+	return err == nil && port != ""
+}
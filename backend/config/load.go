@@ -0,0 +1,225 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/joho/godotenv"
+	"gopkg.in/yaml.v3"
+)
+
+// Options are command-line switches that are not part of the configuration itself
+type Options struct {
+	// File is the YAML config file, from -config or CONFIG_FILE
+	File string
+	// PrintConfig asks to print the effective configuration and exit
+	PrintConfig bool
+}
+
+// field is one configurable leaf of Config
+type field struct {
+	path   string // dotted yaml path, also the flag name
+	env    string
+	usage  string
+	secret bool
+	value  reflect.Value
+}
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// Load builds the configuration by layering, from lowest to highest precedence:
+// built-in defaults, the YAML config file, environment variables (including a
+// .env file) and command-line flags. The result is validated and all problems
+// are reported together.
+func Load(args []string) (Config, Options, error) {
+	cfg := Default()
+	var opts Options
+
+	// A missing .env file is fine, the other sources still apply
+	_ = godotenv.Load()
+
+	// Flags are collected first and applied last so that they win over every other source
+	fs := flag.NewFlagSet("forum", flag.ContinueOnError)
+	fs.StringVar(&opts.File, "config", os.Getenv("CONFIG_FILE"), "YAML config file")
+	fs.BoolVar(&opts.PrintConfig, "print-config", false, "print the effective configuration with secrets redacted and exit")
+	type flagValue struct {
+		field field
+		value string
+	}
+	var flagValues []flagValue
+	for _, f := range fields(reflect.ValueOf(&cfg).Elem(), "", "") {
+		f := f
+		usage := f.usage
+		if f.env != "" {
+			usage += " (env " + f.env + ")"
+		}
+		collect := func(value string) error {
+			flagValues = append(flagValues, flagValue{f, value})
+			return nil
+		}
+		if f.value.Kind() == reflect.Bool {
+			fs.BoolFunc(f.path, usage, collect)
+		} else {
+			fs.Func(f.path, usage, collect)
+		}
+	}
+	if err := fs.Parse(args); err != nil {
+		return cfg, opts, err
+	}
+
+	if opts.File != "" {
+		if err := loadFile(&cfg, opts.File); err != nil {
+			return cfg, opts, err
+		}
+	}
+
+	var errs []error
+	for _, f := range fields(reflect.ValueOf(&cfg).Elem(), "", "") {
+		if f.env == "" {
+			continue
+		}
+		if value, ok := os.LookupEnv(f.env); ok {
+			if err := setValue(f.value, value); err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", f.env, err))
+			}
+		}
+	}
+	for _, fv := range flagValues {
+		if err := setValue(fv.field.value, fv.value); err != nil {
+			errs = append(errs, fmt.Errorf("-%s: %w", fv.field.path, err))
+		}
+	}
+
+	cfg.normalize()
+	errs = append(errs, cfg.Validate())
+	return cfg, opts, errors.Join(errs...)
+}
+
+// loadFile decodes a YAML config file over cfg, rejecting unknown keys
+func loadFile(cfg *Config, path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("reading config file: %w", err)
+	}
+
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(cfg); err != nil && err != io.EOF {
+		return fmt.Errorf("parsing config file %s: %w", path, err)
+	}
+	return nil
+}
+
+// normalize cleans up values that may be written in several equivalent ways
+func (c *Config) normalize() {
+	for i, origin := range c.Security.AllowedOrigins {
+		c.Security.AllowedOrigins[i] = strings.TrimRight(origin, "/")
+	}
+	c.Security.CookieSameSite = strings.ToLower(c.Security.CookieSameSite)
+	c.Database.Driver = strings.ToLower(c.Database.Driver)
+	if c.Database.InitScript == "" {
+		c.Database.InitScript = initScripts[c.Database.Driver]
+	}
+}
+
+// Redacted returns a copy of the configuration with secret values replaced
+func (c Config) Redacted() Config {
+	for _, f := range fields(reflect.ValueOf(&c).Elem(), "", "") {
+		if f.secret && f.value.Kind() == reflect.String && f.value.String() != "" {
+			f.value.SetString("REDACTED")
+		}
+	}
+	return c
+}
+
+// Print writes the configuration as YAML with secrets redacted
+func (c Config) Print(w io.Writer) error {
+	encoder := yaml.NewEncoder(w)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(c.Redacted()); err != nil {
+		return err
+	}
+	return encoder.Close()
+}
+
+// fields lists the configurable leaves of a struct value, recursing into nested structs
+func fields(v reflect.Value, pathPrefix, envPrefix string) []field {
+	var result []field
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		name := strings.Split(sf.Tag.Get("yaml"), ",")[0]
+		if name == "" || name == "-" {
+			continue
+		}
+		path := pathPrefix + name
+		env := sf.Tag.Get("env")
+		if env != "" {
+			env = envPrefix + env
+		}
+
+		fv := v.Field(i)
+		if fv.Kind() == reflect.Struct && fv.Type() != durationType {
+			result = append(result, fields(fv, path+".", env)...)
+			continue
+		}
+		result = append(result, field{
+			path:   path,
+			env:    env,
+			usage:  sf.Tag.Get("usage"),
+			secret: sf.Tag.Get("secret") == "true",
+			value:  fv,
+		})
+	}
+	return result
+}
+
+// setValue parses a string from the environment or a flag into a config field
+func setValue(v reflect.Value, value string) error {
+	switch {
+	case v.Type() == durationType:
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return err
+		}
+		v.SetInt(int64(d))
+	case v.Kind() == reflect.String:
+		v.SetString(value)
+	case v.Kind() == reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case v.Kind() == reflect.Int:
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return err
+		}
+		v.SetInt(int64(n))
+	case v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.String:
+		v.Set(reflect.ValueOf(splitList(value)))
+	default:
+		return fmt.Errorf("unsupported config type %s", v.Type())
+	}
+	return nil
+}
+
+// splitList splits a comma separated value and drops empty items
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -1,51 +1,208 @@
 package main
 
 import (
-	"log"
+	"context"
+	"crypto/tls"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
 	"net/http"
+	"os"
+	"os/signal"
 	"project-root/config"
 	_ "project-root/docs" // This imports the generated Swagger docs
+	"project-root/pkg/attachments"
+	"project-root/pkg/clock"
 	"project-root/pkg/db"
 	"project-root/pkg/handlers"
+	"project-root/pkg/logging"
+	"project-root/pkg/metrics"
+	"project-root/pkg/middleware"
 	"project-root/pkg/repositories"
+	"project-root/pkg/repositories/postgres"
+	"project-root/pkg/server"
+	"project-root/pkg/services"
+	"project-root/pkg/unfurl"
 	"project-root/pkg/websockets"
+	"syscall"
+	"time"
 
 	"github.com/gorilla/mux"
 )
 
+const (
+	// certWatchInterval is how often the certificate files are checked for changes
+	certWatchInterval = time.Minute
+)
+
 // @swagger 2.0
 // @title           kood-rt-forum API
 // @version         1.0
 // @description     This is a sample server for kood-rt-forum.
-// @host            localhost:8080
+// @host            localhost:8443
+// @schemes         https
 // @BasePath        /api
+// @securityDefinitions.apikey BearerAuth
+// @in header
+// @name Authorization
+// @description Personal access token in the form "Bearer <token>"
 func main() {
-	// Load configuration
-	config.LoadConfig()
+	// Load configuration from defaults, config file, environment and flags
+	cfg, opts, err := config.Load(os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid configuration:\n%v\n", err)
+		os.Exit(2)
+	}
+	if opts.PrintConfig {
+		if err := cfg.Print(os.Stdout); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	// Exit non-zero on startup failures so process managers notice
+	if err := run(cfg); err != nil {
+		slog.Error("Server failed", "error", err)
+		os.Exit(1)
+	}
+}
+
+// run starts the server and blocks until it stops
+func run(cfg config.Config) error {
+	startedAt := time.Now()
+
+	// Set up structured logging; the level can be changed at runtime
+	logLevel := new(slog.LevelVar)
+	if level, err := logging.ParseLevel(cfg.Logging.Level); err == nil {
+		logLevel.Set(level)
+	}
+	logger := logging.New(os.Stdout, cfg.Logging.Format, logLevel)
+	slog.SetDefault(logger)
+	logger.Debug("Effective configuration", "config", cfg.Redacted())
 
 	// Create a new DBHandler instance
-	handler := db.NewDBHandler()
+	handler := db.NewDBHandler(db.SQLiteOptions{
+		BusyTimeout:  cfg.Database.BusyTimeout,
+		ReadPoolSize: cfg.Database.ReadPoolSize,
+	})
+	defer func() {
+		if err := handler.Close(); err != nil {
+			logger.Error("Error closing databases", "error", err)
+		}
+	}()
 
 	// Initialize main database
-	err := handler.InitMainDB(config.AppConfig.Database.Path, config.AppConfig.Database.InitScript)
+	mainDSN := cfg.Database.Path
+	if cfg.Database.Driver == config.DriverPostgres {
+		mainDSN = cfg.Database.DSN
+	}
+	err := handler.InitMainDB(cfg.Database.Driver, mainDSN, cfg.Database.InitScript)
 	if err != nil {
-		log.Println("Error initializing main database:", err)
-		return
+		return fmt.Errorf("initializing main database: %w", err)
 	}
 
 	// Initialize messages database
-	err = handler.InitMsgDB(config.AppConfig.MessagesDatabase.Path)
+	err = handler.InitMsgDB(cfg.MessagesDatabase.Path)
 	if err != nil {
-		log.Println("Error initializing messages database:", err)
-		return
+		return fmt.Errorf("initializing messages database: %w", err)
 	}
 
-	// Set the global DBHandler for repositories
-	repositories.SetDBHandler(handler)
+	// Build the stores for the configured driver and the components that use them
+	var stores repositories.Stores
+	if handler.Dialect == db.Postgres {
+		stores = postgres.NewStores(handler.MainDB, clock.System)
+	} else {
+		stores = repositories.NewSQLStores(handler, clock.System, logger.With("component", "repository"))
+	}
+	auth := services.NewAuthenticator(stores.Sessions, stores.Tokens)
+	var fetcher services.PageFetcher
+	if cfg.LinkPreviews.Enabled {
+		fetcher = unfurl.NewFetcher(unfurl.Options{
+			Timeout:      cfg.LinkPreviews.Timeout,
+			MaxSize:      cfg.LinkPreviews.MaxSize,
+			AllowPrivate: cfg.LinkPreviews.AllowPrivate,
+			UserAgent:    "kood-rt-forum link preview",
+		})
+	}
+	previews := services.NewLinkPreviewer(stores.Previews, fetcher, clock.System, cfg.LinkPreviews.CacheTTL, logger.With("component", "link_previews"))
+	events := services.NewEventBus(stores.Outbox, clock.System, services.EventPolicy{
+		MaxAttempts: cfg.Events.MaxAttempts,
+		RetryDelay:  cfg.Events.RetryDelay,
+		Retention:   cfg.Events.Retention,
+	}, logger.With("component", "events"))
+	security := services.NewSecurity(cfg.Security)
+	validator := services.NewValidator(cfg.Validation)
+	manager := websockets.NewWebSocketManager(logger, cfg.WebSocket, stores.Chats, auth, security, validator, previews, events, clock.System)
+	blobs, err := attachments.NewDiskStore(cfg.Attachments.Dir)
+	if err != nil {
+		return fmt.Errorf("opening attachments directory: %w", err)
+	}
+	uploads := attachments.Limits{
+		MaxSize:       cfg.Attachments.MaxSize,
+		AllowedTypes:  cfg.Attachments.AllowedTypes,
+		MaxPixels:     cfg.Attachments.MaxPixels,
+		ThumbnailSize: cfg.Attachments.ThumbnailSize,
+	}
+	webhooks := services.NewWebhookDispatcher(stores.Webhooks, clock.System, services.WebhookPolicy{
+		Timeout:     cfg.Webhooks.Timeout,
+		MaxAttempts: cfg.Webhooks.MaxAttempts,
+		BackoffBase: cfg.Webhooks.BackoffBase,
+		BackoffMax:  cfg.Webhooks.BackoffMax,
+	}, logger.With("component", "webhooks"))
+	services.SubscribeCounters(events, stores.Counts)
+	previews.Subscribe(events)
+	webhooks.Subscribe(events)
+	apiHandler := handlers.NewHandler(stores, auth, clock.System, manager, blobs, uploads, webhooks, events, handlers.Settings{
+		Security:   security,
+		Validator:  validator,
+		Session:    cfg.Session,
+		Pagination: cfg.Pagination,
+		PublicURL:  cfg.PublicURL,
+	})
 
 	// Create a new Gorilla Mux router instance
 	r := mux.NewRouter()
 
+	// Assign request IDs and log every request
+	r.Use(logging.Middleware(logger))
+
+	// Count requests and their latency per route
+	r.Use(middleware.Metrics)
+
+	// Tell browsers to stay on HTTPS
+	r.Use(middleware.HSTS(cfg.HSTSMaxAge))
+
+	// Protect cookie-authenticated requests against CSRF
+	r.Use(middleware.CSRF(security))
+
+	// Expose Prometheus metrics
+	r.Handle("/metrics", metrics.Default.Handler()).Methods("GET")
+
+	// Liveness, readiness and diagnostics
+	readinessChecks := []services.HealthCheck{
+		{Name: "databases", Check: handler.Ping},
+		{Name: "migrations", Check: func(context.Context) error { return handler.CheckMigrations() }},
+		{Name: "websocket", Check: func(context.Context) error {
+			if !manager.Accepting() {
+				return errors.New("websocket manager is shutting down")
+			}
+			return nil
+		}},
+	}
+	r.HandleFunc("/healthz", handlers.HandleHealthz).Methods("GET")
+	r.HandleFunc("/readyz", handlers.HandleReadyz(readinessChecks)).Methods("GET")
+	r.HandleFunc("/debug/status", apiHandler.HandleDebugStatus(handler, manager, startedAt)).Methods("GET")
+
+	// Atom and RSS feeds of the newest posts
+	r.HandleFunc("/feeds/posts.{format:atom|rss}", apiHandler.HandleSyndicationFeed).Methods("GET")
+	r.HandleFunc("/feeds/categories/{category:[^/]+}.{format:atom|rss}", apiHandler.HandleSyndicationFeed).Methods("GET")
+	r.HandleFunc("/feeds/users/{nickname:[^/]+}.{format:atom|rss}", apiHandler.HandleSyndicationFeed).Methods("GET")
+
 	// Serve Swagger UI
 	r.PathPrefix("/swagger/").Handler(handlers.SwaggerHandler())
 
@@ -56,30 +213,72 @@ func main() {
 	api := r.PathPrefix("/api").Subrouter()
 
 	// Posts
-	api.HandleFunc("/posts", handlers.HandleGetPosts).Methods("GET")
-	api.HandleFunc("/posts", handlers.HandleCreatePost).Methods("POST")
-	api.HandleFunc("/posts/{postId:[0-9]+}", handlers.HandleGetPostAndComments).Methods("GET")
-	api.HandleFunc("/posts/{postId:[0-9]+}/comments", handlers.HandleCreateComment).Methods("POST")
+	api.HandleFunc("/posts", apiHandler.HandleGetPosts).Methods("GET")
+	api.HandleFunc("/posts", apiHandler.HandleCreatePost).Methods("POST")
+	api.HandleFunc("/posts/{postId:[0-9]+}", apiHandler.HandleGetPostAndComments).Methods("GET")
+	api.HandleFunc("/posts/{postId:[0-9]+}/comments", apiHandler.HandleCreateComment).Methods("POST")
+	api.HandleFunc("/posts/{postId:[0-9]+}/poll/vote", apiHandler.HandlePollVote).Methods("PUT", "DELETE")
+	api.HandleFunc("/feed", apiHandler.HandleGetFeed).Methods("GET")
 
 	// Ratings
-	api.HandleFunc("/rate", handlers.HandleRate).Methods("PUT")
+	api.HandleFunc("/rate", apiHandler.HandleRate).Methods("PUT")
 
 	// Users
-	api.HandleFunc("/users", handlers.HandleGetUsers).Methods("GET")
-	api.HandleFunc("/users/{nickname}/{type:posts|comments}", handlers.HandleGetUser).Methods("GET")
+	api.HandleFunc("/users", apiHandler.HandleGetUsers).Methods("GET")
+	api.HandleFunc("/users/autocomplete", apiHandler.HandleAutocompleteUsers).Methods("GET")
+	api.HandleFunc("/users/{nickname}/{type:posts|comments}", apiHandler.HandleGetUser).Methods("GET")
+
+	// Follows
+	api.HandleFunc("/follows", apiHandler.HandleGetFollowing).Methods("GET")
+	api.HandleFunc("/follows/users/{nickname}", apiHandler.HandleFollowUser).Methods("PUT", "DELETE")
+	api.HandleFunc("/follows/categories/{category}", apiHandler.HandleFollowCategory).Methods("PUT", "DELETE")
+
+	// Drafts
+	api.HandleFunc("/drafts", apiHandler.HandleGetDrafts).Methods("GET")
+	api.HandleFunc("/drafts", apiHandler.HandleCreateDraft).Methods("POST")
+	api.HandleFunc("/drafts/{draftId:[0-9]+}", apiHandler.HandleDraft).Methods("PUT", "DELETE")
+	api.HandleFunc("/drafts/{draftId:[0-9]+}/publish", apiHandler.HandlePublishDraft).Methods("POST")
+
+	// Reactions
+	api.HandleFunc("/reactions", apiHandler.HandleReaction).Methods("PUT", "DELETE")
+
+	// Bookmarks
+	api.HandleFunc("/bookmarks/collections", apiHandler.HandleGetCollections).Methods("GET")
+	api.HandleFunc("/bookmarks/collections", apiHandler.HandleCreateCollection).Methods("POST")
+	api.HandleFunc("/bookmarks/collections/{collectionId:[0-9]+}", apiHandler.HandleDeleteCollection).Methods("DELETE")
+	api.HandleFunc("/bookmarks/collections/{collectionId:[0-9]+}/items", apiHandler.HandleGetBookmarks).Methods("GET")
+	api.HandleFunc("/bookmarks/collections/{collectionId:[0-9]+}/items", apiHandler.HandleAddBookmark).Methods("POST")
+	api.HandleFunc("/bookmarks/collections/{collectionId:[0-9]+}/items/{bookmarkId:[0-9]+}", apiHandler.HandleMoveBookmark).Methods("PUT")
+	api.HandleFunc("/bookmarks/collections/{collectionId:[0-9]+}/items/{bookmarkId:[0-9]+}", apiHandler.HandleRemoveBookmark).Methods("DELETE")
 
 	// Authentication
-	api.HandleFunc("/auth/register", handlers.HandleRegister).Methods("POST")
-	api.HandleFunc("/auth/login", handlers.HandleLogin).Methods("POST")
-	api.HandleFunc("/auth/logout", handlers.HandleLogout).Methods("DELETE")
+	api.HandleFunc("/auth/register", apiHandler.HandleRegister).Methods("POST")
+	api.HandleFunc("/auth/login", apiHandler.HandleLogin).Methods("POST")
+	api.HandleFunc("/auth/logout", apiHandler.HandleLogout).Methods("DELETE")
+
+	// Personal access tokens
+	api.HandleFunc("/tokens", apiHandler.HandleGetTokens).Methods("GET")
+	api.HandleFunc("/tokens", apiHandler.HandleCreateToken).Methods("POST")
+	api.HandleFunc("/tokens/{tokenId:[0-9]+}", apiHandler.HandleDeleteToken).Methods("DELETE")
+
+	// Admin
+	api.HandleFunc("/admin/log-level", apiHandler.HandleLogLevel(logLevel)).Methods("GET", "PUT")
+	api.HandleFunc("/admin/webhooks", apiHandler.HandleWebhooks).Methods("GET", "POST")
+	api.HandleFunc("/admin/webhooks/{webhookId:[0-9]+}", apiHandler.HandleWebhook).Methods("PUT", "DELETE")
+	api.HandleFunc("/admin/webhooks/{webhookId:[0-9]+}/deliveries", apiHandler.HandleGetWebhookDeliveries).Methods("GET")
+	api.HandleFunc("/admin/webhooks/{webhookId:[0-9]+}/deliveries/{deliveryId:[0-9]+}/redeliver", apiHandler.HandleRedeliverWebhookDelivery).Methods("POST")
+
+	// Attachments
+	api.HandleFunc("/attachments", apiHandler.HandleUploadAttachment).Methods("POST")
+	api.HandleFunc("/attachments/{attachmentId:[0-9]+}", apiHandler.HandleGetAttachment).Methods("GET")
+	api.HandleFunc("/attachments/{attachmentId:[0-9]+}/{thumbnail:thumbnail}", apiHandler.HandleGetAttachment).Methods("GET")
 
 	// Chats
-	api.HandleFunc("/chats", handlers.HandleGetChats).Methods("GET")
-	api.HandleFunc("/chats", handlers.HandleCreateChat).Methods("POST")
-	api.HandleFunc("/chats/{chatHash}", handlers.HandleGetChat).Methods("GET")
+	api.HandleFunc("/chats", apiHandler.HandleGetChats).Methods("GET")
+	api.HandleFunc("/chats", apiHandler.HandleCreateChat).Methods("POST")
+	api.HandleFunc("/chats/{chatHash}", apiHandler.HandleGetChat).Methods("GET")
 
 	// Websockets
-	manager := websockets.NewWebSocketManager()
 	api.HandleFunc("/ws", manager.WebSocketHandler).Methods("GET")
 
 	// Handle index path
@@ -87,8 +286,132 @@ func main() {
 		http.ServeFile(w, r, "../frontend/public/index.html")
 	})
 
+	// Generate a development certificate if none is available
+	if cfg.DevMode {
+		if err := server.EnsureSelfSignedCert(cfg.CertFile, cfg.KeyFile, []string{"localhost", "127.0.0.1"}, logger); err != nil {
+			return fmt.Errorf("generating development certificate: %w", err)
+		}
+	}
+
+	// Load the certificate and reload it on SIGHUP or when the files change
+	certReloader, err := server.NewCertReloader(cfg.CertFile, cfg.KeyFile, logger.With("component", "tls"))
+	if err != nil {
+		return fmt.Errorf("loading TLS certificate: %w", err)
+	}
+	stopCertWatch := make(chan struct{})
+	defer close(stopCertWatch)
+	go certReloader.Watch(certWatchInterval, stopCertWatch)
+
+	// Repair vote totals that drifted from the votes
+	if cfg.Voting.ReconcileInterval > 0 {
+		reconciler := services.NewVoteReconciler(stores.Rates, logger.With("component", "voting"))
+		stopReconcile := make(chan struct{})
+		defer close(stopReconcile)
+		go reconciler.Watch(cfg.Voting.ReconcileInterval, stopReconcile)
+	}
+
+	// Bring the ranking scores up to date, then keep the time-based ones fresh
+	rankings := services.NewRankingRefresher(stores.Rates, clock.System, logger.With("component", "ranking"))
+	rankings.Refresh()
+	if cfg.Voting.RankingInterval > 0 {
+		stopRankings := make(chan struct{})
+		defer close(stopRankings)
+		go rankings.Watch(cfg.Voting.RankingInterval, stopRankings)
+	}
+
+	// Publish scheduled drafts, catching up on those due while the server was down
+	if cfg.Drafts.PublishInterval > 0 {
+		publisher := services.NewDraftPublisher(stores.Drafts, clock.System, logger.With("component", "drafts"), apiHandler.AnnounceScheduledPost)
+		publisher.PublishDue()
+		stopDrafts := make(chan struct{})
+		defer close(stopDrafts)
+		go publisher.Watch(cfg.Drafts.PublishInterval, stopDrafts)
+	}
+
+	// Fetch the previews of links in new posts and chat messages
+	if cfg.LinkPreviews.Enabled {
+		stopPreviews := make(chan struct{})
+		defer close(stopPreviews)
+		go previews.Run(cfg.LinkPreviews.Workers, stopPreviews)
+	}
+
+	// Send webhook deliveries as events happen and retry the failed ones
+	stopWebhooks := make(chan struct{})
+	defer close(stopWebhooks)
+	go webhooks.Watch(cfg.Webhooks.PollInterval, stopWebhooks)
+
+	// Hand the events recorded with every change to their subscribers,
+	// catching up on those recorded while the server was down
+	stopEvents := make(chan struct{})
+	defer close(stopEvents)
+	go events.Watch(cfg.Events.PollInterval, stopEvents)
+	if handler.Dialect == db.Postgres {
+		// Other servers push the events recorded here to their clients at once
+		go postgres.ListenForEvents(cfg.Database.DSN, events.Wake, logger.With("component", "events"), stopEvents)
+	}
+
+	// Redirect plain HTTP to HTTPS
+	var redirectSrv *http.Server
+	if cfg.HTTPRedirectPort != "" {
+		redirectSrv = &http.Server{
+			Addr:    cfg.HTTPRedirectPort,
+			Handler: server.RedirectHandler(cfg.PortNumber),
+		}
+		go func() {
+			logger.Info("Redirecting HTTP to HTTPS", "addr", cfg.HTTPRedirectPort)
+			if err := redirectSrv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				logger.Error("Error starting HTTP redirect listener", "error", err)
+			}
+		}()
+	}
+
+	srv := &http.Server{
+		Addr:     cfg.PortNumber,
+		Handler:  r,
+		ErrorLog: slog.NewLogLogger(logger.Handler(), slog.LevelWarn),
+		TLSConfig: &tls.Config{
+			MinVersion:     tls.VersionTLS12,
+			GetCertificate: certReloader.GetCertificate,
+		},
+	}
+
+	// Stop on Ctrl + C or when the process manager asks us to
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
 	// Start the server
-	log.Printf("Server running on http://localhost%s\n", config.AppConfig.PortNumber)
-	log.Println("To stop the server press `Ctrl + C`")
-	log.Fatal(http.ListenAndServe(config.AppConfig.PortNumber, r))
+	serverErr := make(chan error, 1)
+	go func() {
+		logger.Info("Server running on https://localhost"+cfg.PortNumber, "addr", cfg.PortNumber)
+		logger.Info("To stop the server press `Ctrl + C`")
+		serverErr <- srv.ListenAndServeTLS("", "")
+	}()
+
+	select {
+	case err := <-serverErr:
+		if err != http.ErrServerClosed {
+			return fmt.Errorf("starting server: %w", err)
+		}
+		return nil
+	case <-ctx.Done():
+	}
+
+	logger.Info("Shutting down, draining connections")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+
+	// Tell chat clients first so they can reconnect once we are back
+	if err := manager.Shutdown(shutdownCtx); err != nil {
+		logger.Error("Error closing websocket connections", "error", err)
+	}
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		logger.Error("Error shutting down server", "error", err)
+	}
+	if redirectSrv != nil {
+		if err := redirectSrv.Shutdown(shutdownCtx); err != nil {
+			logger.Error("Error shutting down HTTP redirect listener", "error", err)
+		}
+	}
+	logger.Info("Server stopped")
+	return nil
 }
@@ -0,0 +1,6 @@
+package api
+
+// LogLevel is the current or requested log level
+type LogLevel struct {
+	Level string `json:"level" example:"debug"`
+}
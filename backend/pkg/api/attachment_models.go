@@ -0,0 +1,33 @@
+package api
+
+import "time"
+
+// Attachment is an uploaded file linked to a post, a comment or a chat
+// message. Uploads stay private to their uploader until they are linked by
+// passing their IDs as attachment_ids when creating the content.
+type Attachment struct {
+	ID       int    `json:"id"`
+	FileName string `json:"file_name"`
+	// MimeType is sniffed from the content of the file
+	MimeType string `json:"mime_type"`
+	Size     int    `json:"size"`
+	// Width and Height are set for images
+	Width  int    `json:"width,omitempty"`
+	Height int    `json:"height,omitempty"`
+	URL    string `json:"url"`
+	// ThumbnailURL is set for images
+	ThumbnailURL string    `json:"thumbnail_url,omitempty"`
+	CreatedAt    time.Time `json:"created_at"`
+
+	UserID       int    `json:"-"`
+	PostID       int    `json:"-"`
+	CommentID    int    `json:"-"`
+	ChatHash     string `json:"-"`
+	MessageID    int    `json:"-"`
+	BlobKey      string `json:"-"`
+	ThumbnailKey string `json:"-"`
+}
+
+type AttachmentResponse struct {
+	Attachment Attachment `json:"attachment"`
+}
@@ -0,0 +1,51 @@
+package api
+
+import (
+	"time"
+)
+
+// BookmarkCollection is a named, private list of saved posts and comments
+type BookmarkCollection struct {
+	ID         int       `json:"id"`
+	Name       string    `json:"name"`
+	ItemsCount int       `json:"items_count"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// BookmarkCollectionRequest represents the request payload for creating a collection
+type BookmarkCollectionRequest struct {
+	Name string `json:"name" example:"Read later"`
+}
+
+// Bookmark is a post or comment saved in a collection. Title is the title of
+// the post and Content and ContentHTML those of the saved post or comment.
+type Bookmark struct {
+	ID          int       `json:"id"`
+	PostID      int       `json:"post_id"`
+	CommentID   int       `json:"comment_id,omitempty"`
+	Position    int       `json:"position"`
+	Nickname    string    `json:"nickname"`
+	Title       string    `json:"title"`
+	Content     string    `json:"content"`
+	ContentHTML string    `json:"content_html"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// BookmarkRequest represents the request payload for saving a post, or one of its comments when CommentID is set
+type BookmarkRequest struct {
+	PostID    int `json:"post_id" example:"1"`
+	CommentID int `json:"comment_id" example:"0"`
+}
+
+// BookmarkMoveRequest moves a bookmark to a 1-based position within its collection
+type BookmarkMoveRequest struct {
+	Position int `json:"position" example:"1"`
+}
+
+type BookmarkCollectionsResponse struct {
+	Collections []BookmarkCollection `json:"collections"`
+}
+
+type BookmarksResponse struct {
+	Bookmarks []Bookmark `json:"bookmarks"`
+}
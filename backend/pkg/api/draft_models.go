@@ -0,0 +1,50 @@
+package api
+
+import "time"
+
+// DraftRequest creates or replaces a draft. Drafts may be incomplete; they
+// are validated like posts once PublishAt schedules them.
+type DraftRequest struct {
+	Title         string             `json:"title" example:"Test title"`
+	Content       string             `json:"content" example:"Test content"`
+	Categories    string             `json:"categories" example:"#category1 #category2"`
+	AttachmentIDs []int              `json:"attachment_ids,omitempty"`
+	Poll          *PollCreateRequest `json:"poll,omitempty"`
+	// PublishAt schedules the draft; it is published as a post once the time has come
+	PublishAt *time.Time `json:"publish_at,omitempty"`
+}
+
+// Draft is an unpublished post of its author. Published drafts become posts
+// and are gone.
+type Draft struct {
+	ID            int                `json:"id"`
+	UserID        int                `json:"-"`
+	Title         string             `json:"title"`
+	Content       string             `json:"content"`
+	Categories    string             `json:"categories"`
+	AttachmentIDs []int              `json:"attachment_ids,omitempty"`
+	Poll          *PollCreateRequest `json:"poll,omitempty"`
+	PublishAt     *time.Time         `json:"publish_at,omitempty"`
+	CreatedAt     time.Time          `json:"created_at"`
+	UpdatedAt     time.Time          `json:"updated_at"`
+}
+
+// PostCreateRequest returns the post the draft becomes
+func (d Draft) PostCreateRequest() PostCreateRequest {
+	return PostCreateRequest{
+		UserID:        d.UserID,
+		Title:         d.Title,
+		Content:       d.Content,
+		Categories:    d.Categories,
+		AttachmentIDs: d.AttachmentIDs,
+		Poll:          d.Poll,
+	}
+}
+
+type DraftResponse struct {
+	Draft Draft `json:"draft"`
+}
+
+type DraftsResponse struct {
+	Drafts []Draft `json:"drafts"`
+}
@@ -0,0 +1,91 @@
+package api
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Domain events, named the way webhooks subscribe to them
+const (
+	EventPostCreated    = "post.created"
+	EventCommentCreated = "comment.created"
+	EventRateChanged    = "rate.changed"
+	EventMessageSent    = "message.sent"
+	EventUserRegistered = "user.registered"
+	EventChatCreated    = "chat.created"
+)
+
+// Event is something that happened in the forum. Stores record events in
+// the outbox in the same transaction as the change they describe.
+type Event interface {
+	EventName() string
+}
+
+// OutboxEvent is a recorded event with its JSON encoded data
+type OutboxEvent struct {
+	ID        int             `json:"id"`
+	Name      string          `json:"event"`
+	Payload   json.RawMessage `json:"payload"`
+	CreatedAt time.Time       `json:"created_at"`
+	// Attempts counts how often the event was handed to its subscribers
+	Attempts int `json:"attempts"`
+	// Delivered names the subscribers that handled the event on an earlier attempt
+	Delivered []string `json:"delivered,omitempty"`
+}
+
+// PostCreatedEvent is the data of "post.created"
+type PostCreatedEvent struct {
+	PostID     int          `json:"post_id"`
+	Author     UserResponse `json:"author"`
+	Title      string       `json:"title"`
+	Content    string       `json:"content"`
+	Categories []string     `json:"categories"`
+	Mentions   []Mention    `json:"mentions,omitempty"`
+	CreatedAt  time.Time    `json:"created_at"`
+}
+
+// CommentCreatedEvent is the data of "comment.created"
+type CommentCreatedEvent struct {
+	CommentID   int          `json:"comment_id"`
+	PostID      int          `json:"post_id"`
+	Author      UserResponse `json:"author"`
+	Content     string       `json:"content"`
+	ContentHTML string       `json:"content_html"`
+	Mentions    []Mention    `json:"mentions,omitempty"`
+	Attachments []Attachment `json:"attachments,omitempty"`
+	CreatedAt   time.Time    `json:"created_at"`
+}
+
+// RateChangedEvent is the data of "rate.changed". Rate holds the new totals
+// and, as Status, the vote of User, empty when it was withdrawn.
+type RateChangedEvent struct {
+	PostID    int          `json:"post_id"`
+	CommentID int          `json:"comment_id,omitempty"`
+	User      UserResponse `json:"user"`
+	Rate      Rate         `json:"rate"`
+}
+
+// MessageSentEvent is the data of "message.sent". Chats are private, so it
+// is not published to webhooks.
+type MessageSentEvent struct {
+	Message MessageMessage `json:"message"`
+}
+
+// UserRegisteredEvent is the data of "user.registered"
+type UserRegisteredEvent struct {
+	User      UserResponse `json:"user"`
+	CreatedAt time.Time    `json:"created_at"`
+}
+
+// ChatCreatedEvent is the data of "chat.created"
+type ChatCreatedEvent struct {
+	ChatHash string `json:"chat_hash"`
+	UserIDs  []int  `json:"user_ids"`
+}
+
+func (PostCreatedEvent) EventName() string    { return EventPostCreated }
+func (CommentCreatedEvent) EventName() string { return EventCommentCreated }
+func (RateChangedEvent) EventName() string    { return EventRateChanged }
+func (MessageSentEvent) EventName() string    { return EventMessageSent }
+func (UserRegisteredEvent) EventName() string { return EventUserRegistered }
+func (ChatCreatedEvent) EventName() string    { return EventChatCreated }
@@ -0,0 +1,7 @@
+package api
+
+// FollowingResponse lists the users and categories a user follows
+type FollowingResponse struct {
+	Users      []UserResponse `json:"users"`
+	Categories []Category     `json:"categories"`
+}
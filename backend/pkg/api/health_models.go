@@ -0,0 +1,46 @@
+package api
+
+import "time"
+
+// HealthCheck is the result of one readiness check
+type HealthCheck struct {
+	Name       string `json:"name" example:"main_db"`
+	Status     string `json:"status" example:"ok"`
+	Error      string `json:"error,omitempty"`
+	DurationMs int64  `json:"duration_ms" example:"1"`
+}
+
+// ReadinessResponse lists the readiness checks and their results
+type ReadinessResponse struct {
+	Checks []HealthCheck `json:"checks"`
+}
+
+// DatabaseStatus describes one database in the debug status
+type DatabaseStatus struct {
+	Name            string `json:"name" example:"main"`
+	Path            string `json:"path" example:"pkg/db/data/app_database.db"`
+	SizeBytes       int64  `json:"size_bytes" example:"147456"`
+	WALSizeBytes    int64  `json:"wal_size_bytes" example:"0"`
+	JournalMode     string `json:"journal_mode" example:"wal"`
+	OpenConnections int    `json:"open_connections" example:"2"`
+	InUse           int    `json:"in_use" example:"0"`
+	Idle            int    `json:"idle" example:"2"`
+}
+
+// WebSocketStatus describes the chat connections in the debug status
+type WebSocketStatus struct {
+	Accepting   bool `json:"accepting" example:"true"`
+	Connections int  `json:"connections" example:"3"`
+	Rooms       int  `json:"rooms" example:"1"`
+}
+
+// DebugStatus is the diagnostic snapshot returned by /debug/status
+type DebugStatus struct {
+	Version       string           `json:"version" example:"v1.2.0"`
+	GoVersion     string           `json:"go_version" example:"go1.22.5"`
+	StartedAt     time.Time        `json:"started_at"`
+	UptimeSeconds int64            `json:"uptime_seconds" example:"3600"`
+	Goroutines    int              `json:"goroutines" example:"12"`
+	Databases     []DatabaseStatus `json:"databases"`
+	WebSocket     WebSocketStatus  `json:"websocket"`
+}
@@ -0,0 +1,28 @@
+package api
+
+import "time"
+
+// LinkPreview is what a page linked from a post or a chat message says about
+// itself in its OpenGraph or Twitter card tags. Previews are fetched in the
+// background after the content was created and cached by URL.
+type LinkPreview struct {
+	URL         string `json:"url"`
+	Title       string `json:"title,omitempty"`
+	Description string `json:"description,omitempty"`
+	ImageURL    string `json:"image_url,omitempty"`
+	SiteName    string `json:"site_name,omitempty"`
+
+	FetchedAt time.Time `json:"-"`
+}
+
+// Empty reports whether the page offered nothing to preview
+func (p LinkPreview) Empty() bool {
+	return p.Title == "" && p.Description == "" && p.ImageURL == ""
+}
+
+// LinkPreviewMessage is the payload of the "link_preview" WebSocket message
+// sent to a chat once the preview of a link in one of its messages is ready
+type LinkPreviewMessage struct {
+	RoomHash string      `json:"roomHash"`
+	Preview  LinkPreview `json:"preview"`
+}
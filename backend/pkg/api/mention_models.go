@@ -0,0 +1,27 @@
+package api
+
+// Mention is a user mentioned with @nickname in a post, comment or chat
+// message. Offset and Length locate the mention, including the @, in the
+// content in UTF-16 code units, the way JavaScript indexes strings. Mentions
+// refer to users by ID, so Nickname is the current nickname of the user even
+// when the content still shows an old one.
+type Mention struct {
+	UserID   int    `json:"user_id"`
+	Nickname string `json:"nickname"`
+	Offset   int    `json:"offset"`
+	Length   int    `json:"length"`
+}
+
+// MentionNotification is the payload of the "mention" WebSocket message sent
+// to mentioned users. It names either a post, a comment under PostID or a chat.
+type MentionNotification struct {
+	Author    *UserResponse `json:"author"`
+	PostID    int           `json:"post_id,omitempty"`
+	CommentID int           `json:"comment_id,omitempty"`
+	RoomHash  string        `json:"roomHash,omitempty"`
+}
+
+// UsersAutocompleteResponse lists the users whose nicknames start with a prefix
+type UsersAutocompleteResponse struct {
+	Users []UserResponse `json:"users"`
+}
@@ -0,0 +1,60 @@
+package api
+
+import "time"
+
+// PollCreateRequest adds a poll to a new post
+type PollCreateRequest struct {
+	Question string   `json:"question" example:"Where do we meet?"`
+	Options  []string `json:"options" example:"Park,Library"`
+	// Multiple lets voters pick more than one option
+	Multiple bool `json:"multiple"`
+	// Anonymous polls only count the votes, public ones list the voters of
+	// every option
+	Anonymous bool `json:"anonymous"`
+	// ClosesAt ends the voting when set
+	ClosesAt *time.Time `json:"closes_at,omitempty"`
+}
+
+// Poll is a poll attached to a post with its results. Closed is set once
+// ClosesAt has passed, and MyVotes lists the options the authenticated user
+// voted for.
+type Poll struct {
+	Question    string       `json:"question"`
+	Multiple    bool         `json:"multiple"`
+	Anonymous   bool         `json:"anonymous"`
+	ClosesAt    *time.Time   `json:"closes_at,omitempty"`
+	Closed      bool         `json:"closed"`
+	Options     []PollOption `json:"options"`
+	TotalVoters int          `json:"total_voters"`
+	MyVotes     []int        `json:"my_votes,omitempty"`
+}
+
+// PollOption is an answer of a poll. Voters is left empty in anonymous polls.
+type PollOption struct {
+	ID     int            `json:"id"`
+	Text   string         `json:"text"`
+	Votes  int            `json:"votes"`
+	Voters []UserResponse `json:"voters,omitempty"`
+}
+
+// PollVoteRequest replaces the ballot of the user with the given options
+type PollVoteRequest struct {
+	OptionIDs []int `json:"option_ids" example:"1"`
+}
+
+type PollResponse struct {
+	Poll Poll `json:"poll"`
+}
+
+// ViewPostMessage is sent by a client over the WebSocket when it shows a post,
+// to receive the "poll_results" messages of the post. A post ID of 0 stops them.
+type ViewPostMessage struct {
+	PostID int `json:"post_id"`
+}
+
+// PollResultsMessage is the payload of the "poll_results" WebSocket message
+// sent to the clients viewing a post after a vote in its poll
+type PollResultsMessage struct {
+	PostID int  `json:"post_id"`
+	Poll   Poll `json:"poll"`
+}
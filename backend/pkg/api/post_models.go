@@ -10,10 +10,20 @@ type Post struct {
 	Nickname         string     `json:"nickname"`
 	Title            string     `json:"title"`
 	Content          string     `json:"content"`
+	// ContentHTML is Content rendered from Markdown and sanitized
+	ContentHTML      string     `json:"content_html"`
 	CreatedAt        time.Time  `json:"created_at"`
 	AmountOfComments int        `json:"amount_of_comments"`
 	Rate             Rate        `json:"rate"`
 	Categories       []Category `json:"categories"`
+	// Bookmarked is set for the authenticated user, like Rate.Status
+	Bookmarked  bool         `json:"bookmarked"`
+	Mentions    []Mention    `json:"mentions,omitempty"`
+	Attachments []Attachment `json:"attachments,omitempty"`
+	// LinkPreviews are the fetched previews of the links in Content
+	LinkPreviews []LinkPreview `json:"link_previews,omitempty"`
+	Reactions    []Reaction    `json:"reactions,omitempty"`
+	Poll         *Poll         `json:"poll,omitempty"`
 }
 
 type Category struct {
@@ -27,8 +37,13 @@ type Comment struct {
 	UserID    int       `json:"user_id"`
 	Nickname  string    `json:"nickname"`
 	Content   string    `json:"content"`
+	// ContentHTML is Content rendered from Markdown and sanitized
+	ContentHTML string    `json:"content_html"`
 	CreatedAt time.Time `json:"created_at"`
 	Rate      Rate       `json:"rate"`
+	Mentions  []Mention  `json:"mentions,omitempty"`
+	Attachments []Attachment `json:"attachments,omitempty"`
+	Reactions   []Reaction   `json:"reactions,omitempty"`
 }
 
 type PostCreateRequest struct {
@@ -38,6 +53,13 @@ type PostCreateRequest struct {
 	Content    string    `json:"content" example:"Test content"`
 	Categories string    `json:"categories" example:"#category1 #category2"`
 	CreatedAt  time.Time `json:"created_at" swaggerignore:"true"`
+	// AttachmentIDs are uploads of the author to attach to the post
+	AttachmentIDs []int `json:"attachment_ids,omitempty"`
+	// Poll is stored together with the post when set
+	Poll *PollCreateRequest `json:"poll,omitempty"`
+	// Mentions and Attachments are set by PostStore.Create
+	Mentions    []Mention    `json:"-"`
+	Attachments []Attachment `json:"-"`
 }
 type PostCreateResponse struct {
 	ID int `json:"id"`
@@ -49,6 +71,12 @@ type CommentCreateRequest struct {
 	UserID    int       `json:"user_id" swaggerignore:"true"`
 	Content   string    `json:"content" example:"Test comment"`
 	CreatedAt time.Time `json:"created_at" swaggerignore:"true"`
+	// AttachmentIDs are uploads of the author to attach to the comment
+	AttachmentIDs []int `json:"attachment_ids,omitempty"`
+	// ContentHTML, Mentions and Attachments are set by CommentStore.Create
+	ContentHTML string       `json:"-"`
+	Mentions    []Mention    `json:"-"`
+	Attachments []Attachment `json:"-"`
 }
 
 type CommentResponse struct {
@@ -1,8 +1,10 @@
 package api
 
 type Rate struct {
-	Rate   int    `json:"rate"`
-	Status string `json:"status"`
+	Rate      int    `json:"rate"`
+	Upvotes   int    `json:"upvotes"`
+	Downvotes int    `json:"downvotes"`
+	Status    string `json:"status"`
 }
 
 type RateResponse struct {
@@ -12,5 +14,5 @@ type RateResponse struct {
 type RateRequest struct {
 	PostID    int    `json:"post_id" example:"1"`
 	CommentID int    `json:"comment_id" example:"2"`
-	Status    string `json:"status" example:"up"`
+	Status    string `json:"status" example:"up" enums:"up,down"`
 }
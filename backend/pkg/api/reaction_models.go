@@ -0,0 +1,35 @@
+package api
+
+// Reaction counts the users who reacted to a post, a comment or a chat
+// message with the same emoji. ReactedByMe is set for the authenticated user.
+type Reaction struct {
+	Emoji       string `json:"emoji"`
+	Count       int    `json:"count"`
+	ReactedByMe bool   `json:"reacted_by_me"`
+}
+
+// ReactionRequest adds or withdraws an emoji on a post, on one of its comments
+// when CommentID is set, or on the message MessageID of the chat ChatHash
+type ReactionRequest struct {
+	PostID    int    `json:"post_id,omitempty" example:"1"`
+	CommentID int    `json:"comment_id,omitempty" example:"0"`
+	ChatHash  string `json:"chat_hash,omitempty"`
+	MessageID int    `json:"message_id,omitempty"`
+	Emoji     string `json:"emoji" example:"👍"`
+}
+
+// ReactionsResponse lists the reactions to the content after a change
+type ReactionsResponse struct {
+	Reactions []Reaction `json:"reactions"`
+}
+
+// ReactionEvent is the payload of the "reaction_added" and "reaction_removed"
+// WebSocket messages sent to a chat. Count is the number of users who still
+// reacted with Emoji after the change.
+type ReactionEvent struct {
+	RoomHash  string        `json:"roomHash"`
+	MessageID int           `json:"message_id"`
+	Emoji     string        `json:"emoji"`
+	User      *UserResponse `json:"user"`
+	Count     int           `json:"count"`
+}
@@ -0,0 +1,34 @@
+package api
+
+import (
+	"time"
+)
+
+// APIToken represents a personal access token without its secret
+type APIToken struct {
+	ID         int        `json:"id"`
+	Name       string     `json:"name"`
+	Scopes     []string   `json:"scopes"`
+	CreatedAt  time.Time  `json:"created_at"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+}
+
+// TokenCreateRequest represents the request payload for creating a personal access token
+type TokenCreateRequest struct {
+	UserID        int      `json:"user_id" swaggerignore:"true"`
+	Name          string   `json:"name" example:"ci-bot"`
+	Scopes        []string `json:"scopes" example:"posts:write,chats:read"`
+	ExpiresInDays int      `json:"expires_in_days" example:"30"`
+}
+
+// TokenCreateResponse contains the created token and its plain secret.
+// The secret is only returned once and cannot be recovered later.
+type TokenCreateResponse struct {
+	Token  APIToken `json:"token"`
+	Secret string   `json:"secret"`
+}
+
+type TokensResponse struct {
+	Tokens []APIToken `json:"tokens"`
+}
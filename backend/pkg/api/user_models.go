@@ -13,6 +13,8 @@ type User struct {
 	CreatedAt        time.Time `json:"created_at"`
 	AmountOfPosts    int       `json:"amount_of_posts"`
 	AmountOfComments int       `json:"amount_of_comments"`
+	FollowersCount   int       `json:"followers_count"`
+	FollowingCount   int       `json:"following_count"`
 }
 
 // RegistrationRequest represents the request payload for user registration
@@ -0,0 +1,81 @@
+package api
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// WebhookRequest registers or changes a webhook endpoint
+type WebhookRequest struct {
+	URL    string   `json:"url" example:"https://tools.example.com/forum-hook"`
+	Events []string `json:"events" example:"post.created,comment.created"`
+	// Active pauses deliveries when false. New webhooks are active unless it is set.
+	Active *bool `json:"active,omitempty"`
+}
+
+// Webhook is an endpoint that receives the events it subscribed to. The
+// secret signing its deliveries is only returned when it is created.
+type Webhook struct {
+	ID        int       `json:"id"`
+	URL       string    `json:"url"`
+	Events    []string  `json:"events"`
+	Active    bool      `json:"active"`
+	Secret    string    `json:"-"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type WebhookResponse struct {
+	Webhook Webhook `json:"webhook"`
+}
+
+// WebhookCreateResponse carries the secret of a new webhook, which receivers
+// check the X-Webhook-Signature header of every delivery against
+type WebhookCreateResponse struct {
+	Webhook Webhook `json:"webhook"`
+	Secret  string  `json:"secret"`
+}
+
+type WebhooksResponse struct {
+	Webhooks []Webhook `json:"webhooks"`
+}
+
+// Webhook delivery statuses
+const (
+	DeliveryPending   = "pending"
+	DeliveryDelivered = "delivered"
+	DeliveryFailed    = "failed"
+)
+
+// WebhookDelivery is an event queued for a webhook, with the outcome of its
+// last attempt. Pending deliveries are attempted at NextAttemptAt; failed ones
+// ran out of attempts and are only sent again when redelivered.
+type WebhookDelivery struct {
+	ID             int             `json:"id"`
+	WebhookID      int             `json:"webhook_id"`
+	Event          string          `json:"event"`
+	Payload        json.RawMessage `json:"payload" swaggertype:"object"`
+	Status         string          `json:"status" enums:"pending,delivered,failed"`
+	Attempts       int             `json:"attempts"`
+	LastStatusCode int             `json:"last_status_code,omitempty"`
+	LastError      string          `json:"last_error,omitempty"`
+	NextAttemptAt  *time.Time      `json:"next_attempt_at,omitempty"`
+	CreatedAt      time.Time       `json:"created_at"`
+	DeliveredAt    *time.Time      `json:"delivered_at,omitempty"`
+}
+
+type WebhookDeliveriesResponse struct {
+	Deliveries []WebhookDelivery `json:"deliveries"`
+}
+
+type WebhookDeliveryResponse struct {
+	Delivery WebhookDelivery `json:"delivery"`
+}
+
+// WebhookPayload is the JSON body of every delivery. ID identifies the event
+// and stays the same across retries and redeliveries.
+type WebhookPayload struct {
+	ID        string      `json:"id"`
+	Event     string      `json:"event"`
+	CreatedAt time.Time   `json:"created_at"`
+	Data      interface{} `json:"data"`
+}
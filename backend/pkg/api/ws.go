@@ -15,10 +15,20 @@ type JoinRoomMessage struct {
 
 // MessageMessage represents a message sent within a room.
 type MessageMessage struct {
+	// ID is set by ChatStore.SaveMessage and is unique within the chat
+	ID       int           `json:"id"`
 	RoomHash string        `json:"roomHash"`
 	Sender   *UserResponse `json:"sender"`
 	Message  string        `json:"message"`
 	SendAt   time.Time     `json:"created_at" swaggerignore:"true"`
+	Mentions []Mention     `json:"mentions,omitempty"`
+	// AttachmentIDs are uploads of the sender to attach to a new message
+	AttachmentIDs []int        `json:"attachment_ids,omitempty"`
+	Attachments   []Attachment `json:"attachments,omitempty"`
+	// LinkPreviews are the fetched previews of the links in Message. Previews
+	// of new messages follow in "link_preview" messages.
+	LinkPreviews []LinkPreview `json:"link_previews,omitempty"`
+	Reactions    []Reaction    `json:"reactions,omitempty"`
 }
 
 // TypingMessage represents a typing status update.
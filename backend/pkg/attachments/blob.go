@@ -0,0 +1,121 @@
+// Package attachments checks uploaded files and keeps them in a BlobStore.
+// The database only records their metadata and what they are attached to.
+package attachments
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+var (
+	// ErrBlobNotFound is returned when no blob is stored under a key
+	ErrBlobNotFound = errors.New("blob not found")
+	// ErrInvalidKey is returned for keys not made by NewKey
+	ErrInvalidKey = errors.New("invalid blob key")
+)
+
+// BlobStore keeps the contents of uploaded files under opaque keys
+type BlobStore interface {
+	// Put stores the contents of r under key, replacing any blob stored there
+	Put(key string, r io.Reader) error
+	// Open returns the blob stored under key or ErrBlobNotFound
+	Open(key string) (io.ReadSeekCloser, error)
+	// Delete removes the blob stored under key; deleting a missing blob is no error
+	Delete(key string) error
+}
+
+// NewKey returns a random key for a new blob
+func NewKey() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// validKey reports whether key looks like a key made by NewKey, so that keys
+// can never name files outside the store
+func validKey(key string) bool {
+	if len(key) != 32 {
+		return false
+	}
+	_, err := hex.DecodeString(key)
+	return err == nil
+}
+
+// DiskStore is a BlobStore on the local disk. Blobs are spread over
+// subdirectories named after the first two characters of their keys.
+type DiskStore struct {
+	dir string
+}
+
+// NewDiskStore creates a DiskStore in dir, creating the directory if needed
+func NewDiskStore(dir string) (*DiskStore, error) {
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return nil, err
+	}
+	return &DiskStore{dir: dir}, nil
+}
+
+func (s *DiskStore) path(key string) (string, error) {
+	if !validKey(key) {
+		return "", ErrInvalidKey
+	}
+	return filepath.Join(s.dir, key[:2], key), nil
+}
+
+// Put writes the blob to a temporary file first, so readers never see a
+// partly written blob
+func (s *DiskStore) Put(key string, r io.Reader) error {
+	path, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o750); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), key+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := io.Copy(tmp, r); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+func (s *DiskStore) Open(key string) (io.ReadSeekCloser, error) {
+	path, err := s.path(key)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrBlobNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (s *DiskStore) Delete(key string) error {
+	path, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
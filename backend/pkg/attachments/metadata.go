@@ -0,0 +1,295 @@
+package attachments
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+)
+
+var errMalformed = errors.New("malformed image")
+
+// JPEG markers
+const (
+	markerAPP0  = 0xE0
+	markerAPP1  = 0xE1
+	markerAPP2  = 0xE2
+	markerAPP14 = 0xEE
+	markerAPP15 = 0xEF
+	markerCOM   = 0xFE
+	markerSOS   = 0xDA
+)
+
+const orientationTag = 0x0112
+
+// stripJPEG drops the EXIF, XMP, IPTC and comment segments of a JPEG without
+// re-encoding it and returns the EXIF orientation. JFIF, ICC profile and Adobe
+// segments are kept as they affect the colours. A non-default orientation is
+// written back as the only EXIF tag so that the image still shows upright.
+func stripJPEG(data []byte) ([]byte, int, error) {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		return nil, 0, errMalformed
+	}
+
+	var kept [][]byte
+	orientation := 1
+	i := 2
+	for {
+		if i+4 > len(data) || data[i] != 0xFF {
+			return nil, 0, errMalformed
+		}
+		marker := data[i+1]
+		if marker == 0xFF {
+			// Fill byte before a marker
+			i++
+			continue
+		}
+		if marker == markerSOS {
+			kept = append(kept, data[i:])
+			break
+		}
+		length := int(binary.BigEndian.Uint16(data[i+2:]))
+		end := i + 2 + length
+		if length < 2 || end > len(data) {
+			return nil, 0, errMalformed
+		}
+		segment := data[i:end]
+		i = end
+
+		if marker == markerAPP1 {
+			if o := exifOrientation(segment[4:]); o != 0 {
+				orientation = o
+			}
+		}
+		if !droppedJPEGSegment(marker) {
+			kept = append(kept, segment)
+		}
+	}
+
+	var out bytes.Buffer
+	out.Grow(len(data))
+	out.Write(data[:2])
+	if len(kept) > 1 && kept[0][1] == markerAPP0 {
+		out.Write(kept[0])
+		kept = kept[1:]
+	}
+	if orientation != 1 {
+		out.Write(orientationSegment(orientation))
+	}
+	for _, segment := range kept {
+		out.Write(segment)
+	}
+	return out.Bytes(), orientation, nil
+}
+
+// droppedJPEGSegment reports whether stripJPEG drops segments with marker
+func droppedJPEGSegment(marker byte) bool {
+	switch marker {
+	case markerAPP0, markerAPP2, markerAPP14:
+		return false
+	case markerCOM:
+		return true
+	}
+	return marker >= markerAPP0 && marker <= markerAPP15
+}
+
+// exifOrientation reads the orientation tag from the payload of an APP1
+// segment and returns 0 when there is none
+func exifOrientation(payload []byte) int {
+	if !bytes.HasPrefix(payload, []byte("Exif\x00\x00")) {
+		return 0
+	}
+	tiff := payload[6:]
+	if len(tiff) < 8 {
+		return 0
+	}
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 0
+	}
+
+	ifd := uint64(order.Uint32(tiff[4:]))
+	if ifd+2 > uint64(len(tiff)) {
+		return 0
+	}
+	entries := uint64(order.Uint16(tiff[ifd:]))
+	for n := uint64(0); n < entries; n++ {
+		entry := ifd + 2 + n*12
+		if entry+12 > uint64(len(tiff)) {
+			return 0
+		}
+		if order.Uint16(tiff[entry:]) == orientationTag {
+			if o := int(order.Uint16(tiff[entry+8:])); o >= 1 && o <= 8 {
+				return o
+			}
+			return 0
+		}
+	}
+	return 0
+}
+
+// orientationSegment builds an APP1 segment whose EXIF data holds nothing but
+// the orientation
+func orientationSegment(orientation int) []byte {
+	var b bytes.Buffer
+	b.Write([]byte{0xFF, markerAPP1, 0, 0})
+	b.WriteString("Exif\x00\x00")
+	b.WriteString("MM\x00\x2a")                                // big-endian TIFF header
+	binary.Write(&b, binary.BigEndian, uint32(8))              // offset of the first IFD
+	binary.Write(&b, binary.BigEndian, uint16(1))              // one entry
+	binary.Write(&b, binary.BigEndian, uint16(orientationTag)) // tag
+	binary.Write(&b, binary.BigEndian, uint16(3))              // SHORT
+	binary.Write(&b, binary.BigEndian, uint32(1))              // count
+	binary.Write(&b, binary.BigEndian, uint16(orientation))    // value, padded to four bytes
+	binary.Write(&b, binary.BigEndian, uint16(0))
+	binary.Write(&b, binary.BigEndian, uint32(0)) // no next IFD
+	segment := b.Bytes()
+	binary.BigEndian.PutUint16(segment[2:], uint16(len(segment)-2))
+	return segment
+}
+
+// pngMetadata are the PNG chunks dropped by stripPNG
+var pngMetadata = map[string]bool{
+	"eXIf": true,
+	"tEXt": true,
+	"zTXt": true,
+	"iTXt": true,
+	"tIME": true,
+}
+
+// stripPNG drops the EXIF, text and timestamp chunks of a PNG
+func stripPNG(data []byte) ([]byte, error) {
+	const signature = "\x89PNG\r\n\x1a\n"
+	if !bytes.HasPrefix(data, []byte(signature)) {
+		return nil, errMalformed
+	}
+
+	var out bytes.Buffer
+	out.Grow(len(data))
+	out.WriteString(signature)
+	for i := len(signature); i < len(data); {
+		if i+8 > len(data) {
+			return nil, errMalformed
+		}
+		// length, type, data and CRC
+		end := uint64(i) + 12 + uint64(binary.BigEndian.Uint32(data[i:]))
+		if end > uint64(len(data)) {
+			return nil, errMalformed
+		}
+		if !pngMetadata[string(data[i+4:i+8])] {
+			out.Write(data[i:end])
+		}
+		i = int(end)
+	}
+	return out.Bytes(), nil
+}
+
+// GIF block introducers and extension labels
+const (
+	gifExtension    = 0x21
+	gifImage        = 0x2C
+	gifTrailer      = 0x3B
+	gifComment      = 0xFE
+	gifApplication  = 0xFF
+	gifColorTable   = 0x80
+	gifColorBitsMax = 0x07
+)
+
+// gifAnimation are the application extensions kept by stripGIF, as they hold
+// the loop count of animations
+var gifAnimation = map[string]bool{
+	"NETSCAPE2.0": true,
+	"ANIMEXTS1.0": true,
+}
+
+// stripGIF drops the comment and application extensions of a GIF, such as
+// XMP, without re-encoding it. Extensions that loop animations are kept.
+func stripGIF(data []byte) ([]byte, error) {
+	const screen = 13 // header and logical screen descriptor
+	if len(data) < screen || (string(data[:6]) != "GIF87a" && string(data[:6]) != "GIF89a") {
+		return nil, errMalformed
+	}
+	i := screen + colorTableSize(data[10])
+	if i > len(data) {
+		return nil, errMalformed
+	}
+
+	var out bytes.Buffer
+	out.Grow(len(data))
+	out.Write(data[:i])
+	for {
+		if i >= len(data) {
+			return nil, errMalformed
+		}
+		start := i
+		switch data[i] {
+		case gifTrailer:
+			out.WriteByte(gifTrailer)
+			return out.Bytes(), nil
+		case gifExtension:
+			if i+2 > len(data) {
+				return nil, errMalformed
+			}
+			label := data[i+1]
+			end, err := gifSubBlocks(data, i+2)
+			if err != nil {
+				return nil, err
+			}
+			i = end
+			if label == gifComment || (label == gifApplication && !gifAnimation[gifApplicationID(data[start+2:end])]) {
+				continue
+			}
+		case gifImage:
+			// descriptor, local colour table and LZW minimum code size
+			if i+10 > len(data) {
+				return nil, errMalformed
+			}
+			end, err := gifSubBlocks(data, i+10+colorTableSize(data[i+9])+1)
+			if err != nil {
+				return nil, err
+			}
+			i = end
+		default:
+			return nil, errMalformed
+		}
+		out.Write(data[start:i])
+	}
+}
+
+// colorTableSize returns the size in bytes of the colour table announced by
+// the packed field of a screen or image descriptor
+func colorTableSize(packed byte) int {
+	if packed&gifColorTable == 0 {
+		return 0
+	}
+	return 3 << (packed&gifColorBitsMax + 1)
+}
+
+// gifSubBlocks returns the end of the data sub-blocks starting at i, past
+// their zero length terminator
+func gifSubBlocks(data []byte, i int) (int, error) {
+	for {
+		if i >= len(data) {
+			return 0, errMalformed
+		}
+		size := int(data[i])
+		i++
+		if size == 0 {
+			return i, nil
+		}
+		i += size
+	}
+}
+
+// gifApplicationID returns the identifier and authentication code of an
+// application extension from its sub-blocks
+func gifApplicationID(blocks []byte) string {
+	if len(blocks) < 12 || blocks[0] != 11 {
+		return ""
+	}
+	return string(blocks[1:12])
+}
@@ -0,0 +1,263 @@
+package attachments
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/color/palette"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"testing"
+)
+
+// secret marks the metadata that must not survive stripping
+const secret = "secret location"
+
+func encodeJPEG(t *testing.T, w, h int) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, image.NewRGBA(image.Rect(0, 0, w, h)), nil); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func encodePNG(t *testing.T, w, h int) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, w, h))); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// encodeGIF encodes an animation of two frames that loops forever
+func encodeGIF(t *testing.T, w, h int) []byte {
+	t.Helper()
+	frame := func(c color.Color) *image.Paletted {
+		img := image.NewPaletted(image.Rect(0, 0, w, h), palette.Plan9)
+		for i := range img.Pix {
+			img.Pix[i] = uint8(img.Palette.Index(c))
+		}
+		return img
+	}
+	var buf bytes.Buffer
+	anim := &gif.GIF{Image: []*image.Paletted{frame(color.White), frame(color.Black)}, Delay: []int{10, 10}}
+	if err := gif.EncodeAll(&buf, anim); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// jpegSegment builds a JPEG segment
+func jpegSegment(marker byte, payload string) []byte {
+	segment := []byte{0xFF, marker, 0, 0}
+	binary.BigEndian.PutUint16(segment[2:], uint16(len(payload)+2))
+	return append(segment, payload...)
+}
+
+// exifPayload builds the payload of an APP1 segment with a camera make and,
+// unless it is 0, an orientation, followed by other data
+func exifPayload(order binary.ByteOrder, orientation int) string {
+	var b bytes.Buffer
+	b.WriteString("Exif\x00\x00")
+	if order == binary.LittleEndian {
+		b.WriteString("II\x2a\x00")
+	} else {
+		b.WriteString("MM\x00\x2a")
+	}
+	entries := []struct{ tag, typ, value uint16 }{{0x010F, 2, 'X'}}
+	if orientation != 0 {
+		entries = append(entries, struct{ tag, typ, value uint16 }{orientationTag, 3, uint16(orientation)})
+	}
+	binary.Write(&b, order, uint32(8))
+	binary.Write(&b, order, uint16(len(entries)))
+	for _, e := range entries {
+		binary.Write(&b, order, e.tag)
+		binary.Write(&b, order, e.typ)
+		binary.Write(&b, order, uint32(1))
+		binary.Write(&b, order, e.value)
+		binary.Write(&b, order, uint16(0))
+	}
+	binary.Write(&b, order, uint32(0))
+	b.WriteString(secret)
+	return b.String()
+}
+
+// insert returns data with the blocks inserted at i
+func insert(data []byte, i int, blocks ...[]byte) []byte {
+	out := append([]byte(nil), data[:i]...)
+	for _, block := range blocks {
+		out = append(out, block...)
+	}
+	return append(out, data[i:]...)
+}
+
+func TestStripJPEG(t *testing.T) {
+	plain := encodeJPEG(t, 8, 4)
+	icc := jpegSegment(markerAPP2, "ICC_PROFILE\x00\x01\x01profile")
+	tests := []struct {
+		name        string
+		segments    [][]byte
+		orientation int
+		keep        []byte
+	}{
+		{"rotated", [][]byte{jpegSegment(markerAPP1, exifPayload(binary.LittleEndian, 6))}, 6, orientationSegment(6)},
+		{"upright", [][]byte{jpegSegment(markerAPP1, exifPayload(binary.BigEndian, 1))}, 1, nil},
+		{"comment", [][]byte{jpegSegment(markerCOM, secret)}, 1, nil},
+		{"XMP and IPTC", [][]byte{
+			jpegSegment(markerAPP1, "http://ns.adobe.com/xap/1.0/\x00"+secret),
+			jpegSegment(0xED, "Photoshop 3.0\x00"+secret),
+		}, 1, nil},
+		{"colour profile", [][]byte{icc, jpegSegment(markerCOM, secret)}, 1, icc},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, orientation, err := stripJPEG(insert(plain, 2, tt.segments...))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if orientation != tt.orientation {
+				t.Errorf("orientation = %d, want %d", orientation, tt.orientation)
+			}
+			if bytes.Contains(out, []byte(secret)) {
+				t.Error("the metadata was kept")
+			}
+			if tt.keep != nil && !bytes.Contains(out, tt.keep) {
+				t.Errorf("segment %q was dropped", tt.keep)
+			}
+			if tt.keep == nil && !bytes.Equal(out, plain) {
+				t.Error("the image changed beyond its metadata")
+			}
+			if _, err := jpeg.Decode(bytes.NewReader(out)); err != nil {
+				t.Errorf("stripped image does not decode: %v", err)
+			}
+		})
+	}
+
+	for name, data := range map[string][]byte{
+		"not a JPEG":        encodePNG(t, 1, 1),
+		"truncated segment": plain[:10],
+		"segment too long":  insert(plain[:2], 2, []byte{0xFF, markerCOM, 0xFF, 0xFF}),
+	} {
+		if _, _, err := stripJPEG(data); err == nil {
+			t.Errorf("%s: no error", name)
+		}
+	}
+}
+
+func TestExifOrientation(t *testing.T) {
+	noIFD := []byte(exifPayload(binary.BigEndian, 3))
+	binary.BigEndian.PutUint32(noIFD[10:], 1000)
+	tests := []struct {
+		name    string
+		payload string
+		want    int
+	}{
+		{"little endian", exifPayload(binary.LittleEndian, 3), 3},
+		{"big endian", exifPayload(binary.BigEndian, 8), 8},
+		{"no orientation", exifPayload(binary.BigEndian, 0), 0},
+		{"out of range", exifPayload(binary.BigEndian, 9), 0},
+		{"not EXIF", "http://ns.adobe.com/xap/1.0/\x00", 0},
+		{"unknown byte order", "Exif\x00\x00XX\x00\x2a\x00\x00\x00\x08", 0},
+		{"IFD past the end", string(noIFD), 0},
+		{"truncated entries", exifPayload(binary.BigEndian, 6)[:22], 0},
+	}
+	for _, tt := range tests {
+		if got := exifOrientation([]byte(tt.payload)); got != tt.want {
+			t.Errorf("%s: exifOrientation = %d, want %d", tt.name, got, tt.want)
+		}
+	}
+}
+
+// pngChunk builds a PNG chunk with its CRC
+func pngChunk(typ, data string) []byte {
+	chunk := binary.BigEndian.AppendUint32(nil, uint32(len(data)))
+	chunk = append(chunk, typ+data...)
+	return binary.BigEndian.AppendUint32(chunk, crc32.ChecksumIEEE([]byte(typ+data)))
+}
+
+func TestStripPNG(t *testing.T) {
+	plain := encodePNG(t, 4, 4)
+	const afterHeader = 8 + 25 // signature and IHDR
+	physical := pngChunk("pHYs", "\x00\x00\x0b\x13\x00\x00\x0b\x13\x01")
+	data := insert(plain, afterHeader,
+		pngChunk("tEXt", "Comment\x00"+secret),
+		pngChunk("zTXt", "Author\x00\x00"+secret),
+		pngChunk("iTXt", "XML:com.adobe.xmp\x00\x00\x00\x00\x00"+secret),
+		pngChunk("eXIf", exifPayload(binary.BigEndian, 6)[6:]),
+		pngChunk("tIME", "\x07\xe8\x05\x01\x0c\x00\x00"),
+		physical,
+	)
+
+	out, err := stripPNG(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := insert(plain, afterHeader, physical); !bytes.Equal(out, want) {
+		t.Errorf("stripped PNG keeps %d bytes, want %d with only the physical size chunk added", len(out), len(want))
+	}
+	if _, err := png.Decode(bytes.NewReader(out)); err != nil {
+		t.Errorf("stripped image does not decode: %v", err)
+	}
+
+	for name, data := range map[string][]byte{
+		"not a PNG":       encodeJPEG(t, 1, 1),
+		"truncated chunk": plain[:afterHeader-4],
+		"chunk too long":  append(plain[:afterHeader:afterHeader], "\xff\xff\xff\xfftEXt"...),
+	} {
+		if _, err := stripPNG(data); err == nil {
+			t.Errorf("%s: no error", name)
+		}
+	}
+}
+
+// gifExtensionBlock builds a GIF extension whose data fits in one sub-block
+func gifExtensionBlock(label byte, data string) []byte {
+	block := []byte{gifExtension, label, byte(len(data))}
+	return append(append(block, data...), 0)
+}
+
+func TestStripGIF(t *testing.T) {
+	plain := encodeGIF(t, 4, 4)
+	afterScreen := 13 + colorTableSize(plain[10])
+	xmp := []byte{gifExtension, gifApplication, 11}
+	xmp = append(xmp, "XMP DataXMP"...)
+	xmp = append(xmp, byte(len(secret)))
+	xmp = append(xmp, secret...)
+	xmp = append(xmp, 0)
+	data := insert(plain, afterScreen, gifExtensionBlock(gifComment, secret), xmp)
+
+	out, err := stripGIF(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(out, plain) {
+		t.Errorf("stripped GIF is %d bytes, want the %d of the image without metadata", len(out), len(plain))
+	}
+	if !bytes.Contains(out, []byte("NETSCAPE2.0")) {
+		t.Error("the loop count was dropped")
+	}
+	anim, err := gif.DecodeAll(bytes.NewReader(out))
+	if err != nil {
+		t.Fatalf("stripped image does not decode: %v", err)
+	}
+	if len(anim.Image) != 2 || anim.LoopCount != 0 {
+		t.Errorf("stripped animation has %d frames looping %d times, want 2 looping forever", len(anim.Image), anim.LoopCount)
+	}
+
+	for name, data := range map[string][]byte{
+		"not a GIF":             encodePNG(t, 1, 1),
+		"no trailer":            plain[:len(plain)-1],
+		"truncated comment":     insert(plain[:afterScreen], afterScreen, []byte{gifExtension, gifComment, 20, 'x'}),
+		"unknown block":         insert(plain[:afterScreen], afterScreen, []byte{0x42, gifTrailer}),
+		"truncated color table": plain[:afterScreen-1],
+	} {
+		if _, err := stripGIF(data); err == nil {
+			t.Errorf("%s: no error", name)
+		}
+	}
+}
@@ -0,0 +1,129 @@
+package attachments
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	_ "image/gif" // register the decoders of the accepted image types
+	_ "image/jpeg"
+	_ "image/png"
+	"mime"
+	"net/http"
+)
+
+var (
+	// ErrTooLarge is returned for files above Limits.MaxSize
+	ErrTooLarge = errors.New("file too large")
+	// ErrTypeNotAllowed is returned for files whose sniffed type is not in Limits.AllowedTypes
+	ErrTypeNotAllowed = errors.New("file type not allowed")
+	// ErrImageTooLarge is returned for images with more than Limits.MaxPixels pixels
+	ErrImageTooLarge = errors.New("image too large")
+	// ErrInvalidImage is returned for images that cannot be decoded
+	ErrInvalidImage = errors.New("invalid image")
+)
+
+// Limits are the checks applied to uploaded files
+type Limits struct {
+	// MaxSize is the largest accepted file in bytes
+	MaxSize int
+	// AllowedTypes are the accepted MIME types, without parameters
+	AllowedTypes []string
+	// MaxPixels bounds the memory needed to decode an image
+	MaxPixels int
+	// ThumbnailSize is the longest side of thumbnails in pixels
+	ThumbnailSize int
+}
+
+// File is an uploaded file that passed the limits
+type File struct {
+	Data []byte
+	// MimeType is sniffed from Data and may carry a charset parameter
+	MimeType string
+	// Width and Height are the displayed size of images
+	Width  int
+	Height int
+	// Thumbnail is a JPEG of an image, at most Limits.ThumbnailSize on its longest side
+	Thumbnail []byte
+}
+
+// IsImage reports whether files of mimeType get metadata stripping and thumbnails
+func IsImage(mimeType string) bool {
+	switch mediaType(mimeType) {
+	case "image/jpeg", "image/png", "image/gif":
+		return true
+	}
+	return false
+}
+
+// Process checks data against limits. The type is sniffed from the content
+// and never taken from the client. Images are decoded to prove they are
+// images, lose their EXIF, XMP and text metadata and get a thumbnail.
+func Process(data []byte, limits Limits) (*File, error) {
+	if len(data) > limits.MaxSize {
+		return nil, ErrTooLarge
+	}
+	file := &File{Data: data, MimeType: http.DetectContentType(data)}
+	if !allowed(file.MimeType, limits.AllowedTypes) {
+		return nil, ErrTypeNotAllowed
+	}
+	if !IsImage(file.MimeType) {
+		return file, nil
+	}
+
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, ErrInvalidImage
+	}
+	if config.Width <= 0 || config.Height <= 0 {
+		return nil, ErrInvalidImage
+	}
+	if config.Width > limits.MaxPixels/config.Height {
+		return nil, ErrImageTooLarge
+	}
+
+	orientation := 1
+	switch mediaType(file.MimeType) {
+	case "image/jpeg":
+		file.Data, orientation, err = stripJPEG(data)
+	case "image/png":
+		file.Data, err = stripPNG(data)
+	case "image/gif":
+		file.Data, err = stripGIF(data)
+	}
+	if err != nil {
+		return nil, ErrInvalidImage
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(file.Data))
+	if err != nil {
+		return nil, ErrInvalidImage
+	}
+	file.Width, file.Height = config.Width, config.Height
+	if orientation >= 5 {
+		file.Width, file.Height = file.Height, file.Width
+	}
+	if file.Thumbnail, err = thumbnail(img, limits.ThumbnailSize, orientation); err != nil {
+		return nil, err
+	}
+	return file, nil
+}
+
+// allowed reports whether the media type of mimeType is in types
+func allowed(mimeType string, types []string) bool {
+	t := mediaType(mimeType)
+	for _, a := range types {
+		if a == t {
+			return true
+		}
+	}
+	return false
+}
+
+// mediaType drops the parameters of a MIME type
+func mediaType(mimeType string) string {
+	t, _, err := mime.ParseMediaType(mimeType)
+	if err != nil {
+		return mimeType
+	}
+	return t
+}
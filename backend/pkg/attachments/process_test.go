@@ -0,0 +1,88 @@
+package attachments
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"image/jpeg"
+	"testing"
+)
+
+var testLimits = Limits{
+	MaxSize:       1 << 20,
+	AllowedTypes:  []string{"image/jpeg", "image/png", "image/gif", "text/plain"},
+	MaxPixels:     1 << 16,
+	ThumbnailSize: 16,
+}
+
+func TestProcessRejects(t *testing.T) {
+	imagesOnly := testLimits
+	imagesOnly.AllowedTypes = []string{"image/png"}
+	tests := []struct {
+		name   string
+		data   []byte
+		limits Limits
+		want   error
+	}{
+		{"too large", bytes.Repeat([]byte("a"), testLimits.MaxSize+1), testLimits, ErrTooLarge},
+		{"HTML", []byte("<!DOCTYPE html><script>alert(1)</script>"), testLimits, ErrTypeNotAllowed},
+		{"text where only images are allowed", []byte("just text"), imagesOnly, ErrTypeNotAllowed},
+		{"JPEG where only PNG is allowed", encodeJPEG(t, 4, 4), imagesOnly, ErrTypeNotAllowed},
+		{"PNG signature only", []byte("\x89PNG\r\n\x1a\nnot really"), testLimits, ErrInvalidImage},
+		{"too many pixels", encodePNG(t, 300, 300), testLimits, ErrImageTooLarge},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Process(tt.data, tt.limits); !errors.Is(err, tt.want) {
+				t.Errorf("Process: err = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestProcessText(t *testing.T) {
+	file, err := Process([]byte("plain notes"), testLimits)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if file.MimeType != "text/plain; charset=utf-8" || file.Thumbnail != nil {
+		t.Errorf("Process = %s with a %d byte thumbnail, want text without one", file.MimeType, len(file.Thumbnail))
+	}
+}
+
+func TestProcessImages(t *testing.T) {
+	rotated := insert(encodeJPEG(t, 40, 20), 2, jpegSegment(markerAPP1, exifPayload(binary.BigEndian, 6)))
+	tests := []struct {
+		name          string
+		data          []byte
+		mimeType      string
+		width, height int
+	}{
+		{"JPEG turned on its side", rotated, "image/jpeg", 20, 40},
+		{"PNG", encodePNG(t, 40, 20), "image/png", 40, 20},
+		{"GIF", encodeGIF(t, 40, 20), "image/gif", 40, 20},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file, err := Process(tt.data, testLimits)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if file.MimeType != tt.mimeType || file.Width != tt.width || file.Height != tt.height {
+				t.Errorf("Process = %s of %dx%d, want %s of %dx%d", file.MimeType, file.Width, file.Height, tt.mimeType, tt.width, tt.height)
+			}
+			if bytes.Contains(file.Data, []byte(secret)) {
+				t.Error("the metadata was kept")
+			}
+
+			thumb, err := jpeg.DecodeConfig(bytes.NewReader(file.Thumbnail))
+			if err != nil {
+				t.Fatalf("thumbnail does not decode: %v", err)
+			}
+			// The thumbnail is upright and fits in ThumbnailSize
+			if want := tt.width * testLimits.ThumbnailSize / max(tt.width, tt.height); thumb.Width != want || max(thumb.Width, thumb.Height) != testLimits.ThumbnailSize {
+				t.Errorf("thumbnail is %dx%d, want %d wide and %d on its longest side", thumb.Width, thumb.Height, want, testLimits.ThumbnailSize)
+			}
+		})
+	}
+}
@@ -0,0 +1,118 @@
+package attachments
+
+import (
+	"bytes"
+	"image"
+	"image/draw"
+	"image/jpeg"
+)
+
+const thumbnailQuality = 80
+
+// thumbnail scales img down to fit in a size by size square, turns it upright
+// according to its EXIF orientation and encodes it as a JPEG. Transparent
+// areas become white.
+func thumbnail(img image.Image, size, orientation int) ([]byte, error) {
+	b := img.Bounds()
+	w, h := fit(b.Dx(), b.Dy(), size)
+	small := orient(downscale(img, w, h), orientation)
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, small, &jpeg.Options{Quality: thumbnailQuality}); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// fit returns the size of a w by h image scaled down to fit in a size by size
+// square. Smaller images keep their size.
+func fit(w, h, size int) (int, int) {
+	if w <= size && h <= size {
+		return w, h
+	}
+	if w >= h {
+		return size, max(1, h*size/w)
+	}
+	return max(1, w*size/h), size
+}
+
+// downscale shrinks img to w by h with a box filter: every pixel of the
+// result is the average of the source pixels it covers. The source is
+// converted one row at a time to bound the memory needed for large images.
+func downscale(img image.Image, w, h int) *image.RGBA {
+	b := img.Bounds()
+	sw, sh := b.Dx(), b.Dy()
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	row := image.NewRGBA(image.Rect(0, 0, sw, 1))
+
+	// Source columns covered by each destination column
+	columns := make([]int, w)
+	for sx := 0; sx < sw; sx++ {
+		columns[sx*w/sw]++
+	}
+
+	sums := make([]int, w*4)
+	rows := 0
+	for sy := 0; sy < sh; sy++ {
+		draw.Draw(row, row.Bounds(), image.White, image.Point{}, draw.Src)
+		draw.Draw(row, row.Bounds(), img, image.Pt(b.Min.X, b.Min.Y+sy), draw.Over)
+		for sx := 0; sx < sw; sx++ {
+			dx := sx * w / sw
+			for c := 0; c < 4; c++ {
+				sums[dx*4+c] += int(row.Pix[sx*4+c])
+			}
+		}
+		rows++
+
+		dy := sy * h / sh
+		if sy+1 < sh && (sy+1)*h/sh == dy {
+			continue
+		}
+		out := dst.Pix[dy*dst.Stride:]
+		for dx := 0; dx < w; dx++ {
+			n := columns[dx] * rows
+			for c := 0; c < 4; c++ {
+				out[dx*4+c] = uint8(sums[dx*4+c] / n)
+				sums[dx*4+c] = 0
+			}
+		}
+		rows = 0
+	}
+	return dst
+}
+
+// orient turns img upright according to an EXIF orientation from 1 to 8
+func orient(img *image.RGBA, orientation int) *image.RGBA {
+	if orientation <= 1 || orientation > 8 {
+		return img
+	}
+	w, h := img.Rect.Dx(), img.Rect.Dy()
+	dw, dh := w, h
+	if orientation >= 5 {
+		dw, dh = h, w
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	for y := 0; y < dh; y++ {
+		for x := 0; x < dw; x++ {
+			var sx, sy int
+			switch orientation {
+			case 2: // flip horizontally
+				sx, sy = w-1-x, y
+			case 3: // rotate 180°
+				sx, sy = w-1-x, h-1-y
+			case 4: // flip vertically
+				sx, sy = x, h-1-y
+			case 5: // transpose
+				sx, sy = y, x
+			case 6: // rotate 90° clockwise
+				sx, sy = y, h-1-x
+			case 7: // transverse
+				sx, sy = w-1-y, h-1-x
+			case 8: // rotate 90° counterclockwise
+				sx, sy = w-1-y, x
+			}
+			copy(dst.Pix[dst.PixOffset(x, y):][:4], img.Pix[img.PixOffset(sx, sy):][:4])
+		}
+	}
+	return dst
+}
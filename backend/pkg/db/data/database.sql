@@ -70,5 +70,16 @@ CREATE TABLE IF NOT EXISTS "conversations" (
     FOREIGN KEY("user1_id") REFERENCES "users"("id"),
     FOREIGN KEY("user2_id") REFERENCES "users"("id")
 );
+CREATE TABLE IF NOT EXISTS "api_tokens" (
+    "id" INTEGER PRIMARY KEY AUTOINCREMENT,
+    "user_id" INTEGER NOT NULL,
+    "name" TEXT NOT NULL,
+    "token_hash" TEXT UNIQUE NOT NULL,
+    "scopes" TEXT NOT NULL,
+    "created_at" TIMESTAMP NOT NULL,
+    "expires_at" TIMESTAMP,
+    "last_used_at" TIMESTAMP,
+    FOREIGN KEY("user_id") REFERENCES "users"("id")
+);
 
 COMMIT;
\ No newline at end of file
@@ -0,0 +1,94 @@
+BEGIN;
+CREATE TABLE IF NOT EXISTS "users" (
+    "id" SERIAL PRIMARY KEY,
+    "nickname" TEXT UNIQUE NOT NULL,
+    "age" TEXT NOT NULL,
+    "gender" TEXT NOT NULL,
+    "first_name" TEXT NOT NULL,
+    "last_name" TEXT NOT NULL,
+    "email" TEXT UNIQUE,
+    "password_hash" TEXT,
+    "created_at" TIMESTAMPTZ NOT NULL,
+    "amount_of_posts" INTEGER NOT NULL DEFAULT 0,
+    "amount_of_comments" INTEGER NOT NULL DEFAULT 0
+);
+
+CREATE TABLE IF NOT EXISTS "active_sessions" (
+    "user_id" INTEGER NOT NULL,
+    "session_id" TEXT NOT NULL,
+    "created_at" TIMESTAMPTZ NOT NULL,
+    "expires_at" TIMESTAMPTZ NOT NULL,
+    "last_activity" TIMESTAMPTZ NOT NULL,
+    FOREIGN KEY("user_id") REFERENCES "users"("id")
+);
+
+CREATE TABLE IF NOT EXISTS "posts" (
+    "id" SERIAL PRIMARY KEY,
+    "user_id" INTEGER,
+    "title" TEXT NOT NULL,
+    "content" TEXT NOT NULL,
+    "created_at" TIMESTAMPTZ NOT NULL,
+    "amount_of_comments" INTEGER NOT NULL DEFAULT 0,
+    "rate" INTEGER NOT NULL DEFAULT 0,
+    FOREIGN KEY("user_id") REFERENCES "users"("id")
+);
+CREATE TABLE IF NOT EXISTS "categories" (
+    "id" SERIAL PRIMARY KEY,
+    "name" TEXT NOT NULL
+);
+CREATE TABLE IF NOT EXISTS "post_categories" (
+    "post_id" INTEGER,
+    "category_id" INTEGER,
+    PRIMARY KEY("post_id", "category_id"),
+    FOREIGN KEY("post_id") REFERENCES "posts"("id"),
+    FOREIGN KEY("category_id") REFERENCES "categories"("id")
+);
+CREATE TABLE IF NOT EXISTS "comments" (
+    "id" SERIAL PRIMARY KEY,
+    "post_id" INTEGER,
+    "user_id" INTEGER,
+    "content" TEXT NOT NULL,
+    "created_at" TIMESTAMPTZ NOT NULL,
+    "rate" INTEGER NOT NULL DEFAULT 0,
+    FOREIGN KEY("post_id") REFERENCES "posts"("id"),
+    FOREIGN KEY("user_id") REFERENCES "users"("id")
+);
+CREATE TABLE IF NOT EXISTS "rates" (
+    "user_id" INTEGER NOT NULL,
+    "post_id" INTEGER,
+    "comment_id" INTEGER,
+    "status" TEXT NOT NULL,
+    "rated_at" TIMESTAMPTZ NOT NULL,
+    FOREIGN KEY("user_id") REFERENCES "users"("id"),
+    FOREIGN KEY("post_id") REFERENCES "posts"("id"),
+    FOREIGN KEY("comment_id") REFERENCES "comments"("id")
+);
+CREATE TABLE IF NOT EXISTS "conversations" (
+    "user1_id" INTEGER NOT NULL,
+    "user2_id" INTEGER NOT NULL,
+    "hash" TEXT NOT NULL,
+    FOREIGN KEY("user1_id") REFERENCES "users"("id"),
+    FOREIGN KEY("user2_id") REFERENCES "users"("id")
+);
+CREATE TABLE IF NOT EXISTS "messages" (
+    "id" BIGSERIAL PRIMARY KEY,
+    "chat_hash" TEXT NOT NULL,
+    "sender_id" INTEGER NOT NULL,
+    "message_content" TEXT NOT NULL,
+    "sent_at" TIMESTAMPTZ NOT NULL,
+    FOREIGN KEY("sender_id") REFERENCES "users"("id")
+);
+CREATE INDEX IF NOT EXISTS "idx_messages_chat_hash_sent_at" ON "messages"("chat_hash", "sent_at");
+CREATE TABLE IF NOT EXISTS "api_tokens" (
+    "id" SERIAL PRIMARY KEY,
+    "user_id" INTEGER NOT NULL,
+    "name" TEXT NOT NULL,
+    "token_hash" TEXT UNIQUE NOT NULL,
+    "scopes" TEXT NOT NULL,
+    "created_at" TIMESTAMPTZ NOT NULL,
+    "expires_at" TIMESTAMPTZ,
+    "last_used_at" TIMESTAMPTZ,
+    FOREIGN KEY("user_id") REFERENCES "users"("id")
+);
+
+COMMIT;
@@ -0,0 +1,46 @@
+package db
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Dialect identifies the SQL flavour of a database, named after its driver
+type Dialect string
+
+const (
+	SQLite   Dialect = "sqlite3"
+	Postgres Dialect = "postgres"
+)
+
+// Rebind rewrites ? placeholders into the form the dialect expects.
+// PostgreSQL numbers its placeholders ($1, $2, ...); SQLite queries are returned unchanged.
+// Question marks inside quoted strings or identifiers are left alone.
+func (d Dialect) Rebind(query string) string {
+	if d != Postgres {
+		return query
+	}
+
+	var b strings.Builder
+	b.Grow(len(query) + 8)
+	n := 0
+	var quote byte
+	for i := 0; i < len(query); i++ {
+		c := query[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"':
+			quote = c
+		case c == '?':
+			n++
+			b.WriteByte('$')
+			b.WriteString(strconv.Itoa(n))
+			continue
+		}
+		b.WriteByte(c)
+	}
+	return b.String()
+}
@@ -0,0 +1,181 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"strings"
+	"time"
+
+	"project-root/pkg/metrics"
+)
+
+// openInstrumented opens a database whose statements are timed into the
+// forum_db_query_* metrics under the given name.
+func openInstrumented(driverName, dataSourceName, name string) (*sql.DB, error) {
+	// Open once to get hold of the registered driver, then wrap its connections
+	probe, err := sql.Open(driverName, dataSourceName)
+	if err != nil {
+		return nil, err
+	}
+	drv := probe.Driver()
+	probe.Close()
+
+	return sql.OpenDB(&instrumentedConnector{driver: drv, dsn: dataSourceName, name: name}), nil
+}
+
+type instrumentedConnector struct {
+	driver driver.Driver
+	dsn    string
+	name   string
+}
+
+func (c *instrumentedConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	conn, err := c.driver.Open(c.dsn)
+	if err != nil {
+		return nil, err
+	}
+	return &instrumentedConn{Conn: conn, name: c.name}, nil
+}
+
+func (c *instrumentedConnector) Driver() driver.Driver {
+	return c.driver
+}
+
+// observe records the duration and outcome of a statement
+func observe(name, query string, start time.Time, err error) {
+	op := operation(query)
+	metrics.DBQueryDuration.ObserveDuration(start, name, op)
+	if err != nil && err != driver.ErrSkip {
+		metrics.DBQueryErrors.Inc(name, op)
+	}
+}
+
+// operation returns the leading SQL keyword in lower case, e.g. "select"
+func operation(query string) string {
+	fields := strings.Fields(query)
+	if len(fields) == 0 {
+		return "other"
+	}
+	switch op := strings.ToLower(fields[0]); op {
+	case "select", "insert", "update", "delete", "create", "begin", "commit", "pragma", "with":
+		return op
+	default:
+		return "other"
+	}
+}
+
+type instrumentedConn struct {
+	driver.Conn
+	name string
+}
+
+func (c *instrumentedConn) Prepare(query string) (driver.Stmt, error) {
+	return c.PrepareContext(context.Background(), query)
+}
+
+func (c *instrumentedConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	var stmt driver.Stmt
+	var err error
+	if p, ok := c.Conn.(driver.ConnPrepareContext); ok {
+		stmt, err = p.PrepareContext(ctx, query)
+	} else {
+		stmt, err = c.Conn.Prepare(query)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &instrumentedStmt{Stmt: stmt, name: c.name, query: query}, nil
+}
+
+func (c *instrumentedConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	if b, ok := c.Conn.(driver.ConnBeginTx); ok {
+		return b.BeginTx(ctx, opts)
+	}
+	return c.Conn.Begin()
+}
+
+func (c *instrumentedConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	e, ok := c.Conn.(driver.ExecerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	start := time.Now()
+	result, err := e.ExecContext(ctx, query, args)
+	observe(c.name, query, start, err)
+	return result, err
+}
+
+func (c *instrumentedConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	q, ok := c.Conn.(driver.QueryerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	start := time.Now()
+	rows, err := q.QueryContext(ctx, query, args)
+	observe(c.name, query, start, err)
+	return rows, err
+}
+
+func (c *instrumentedConn) Ping(ctx context.Context) error {
+	if p, ok := c.Conn.(driver.Pinger); ok {
+		return p.Ping(ctx)
+	}
+	return nil
+}
+
+func (c *instrumentedConn) ResetSession(ctx context.Context) error {
+	if r, ok := c.Conn.(driver.SessionResetter); ok {
+		return r.ResetSession(ctx)
+	}
+	return nil
+}
+
+type instrumentedStmt struct {
+	driver.Stmt
+	name  string
+	query string
+}
+
+func (s *instrumentedStmt) ExecContext(ctx context.Context, args []driver.NamedValue) (driver.Result, error) {
+	start := time.Now()
+	var result driver.Result
+	var err error
+	if e, ok := s.Stmt.(driver.StmtExecContext); ok {
+		result, err = e.ExecContext(ctx, args)
+	} else {
+		var values []driver.Value
+		if values, err = namedToValues(args); err == nil {
+			result, err = s.Stmt.Exec(values)
+		}
+	}
+	observe(s.name, s.query, start, err)
+	return result, err
+}
+
+func (s *instrumentedStmt) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
+	start := time.Now()
+	var rows driver.Rows
+	var err error
+	if q, ok := s.Stmt.(driver.StmtQueryContext); ok {
+		rows, err = q.QueryContext(ctx, args)
+	} else {
+		var values []driver.Value
+		if values, err = namedToValues(args); err == nil {
+			rows, err = s.Stmt.Query(values)
+		}
+	}
+	observe(s.name, s.query, start, err)
+	return rows, err
+}
+
+func namedToValues(args []driver.NamedValue) ([]driver.Value, error) {
+	values := make([]driver.Value, len(args))
+	for i, arg := range args {
+		if arg.Name != "" {
+			return nil, driver.ErrSkip
+		}
+		values[i] = arg.Value
+	}
+	return values, nil
+}
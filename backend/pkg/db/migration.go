@@ -2,46 +2,101 @@ package db
 
 import (
 	"database/sql"
+	"errors"
+	"fmt"
 	"os"
 
+	_ "github.com/lib/pq"
 	_ "github.com/mattn/go-sqlite3"
 )
 
-// DBHandler holds the instances for main and message databases
+// DBHandler holds the instances for main and message databases.
+// With SQLite, MainDB and MsgDB are the writer connections of the Main and Msg
+// pools. With PostgreSQL there is a single database, MsgDB is the same as
+// MainDB and the pools are nil.
 type DBHandler struct {
-	MainDB *sql.DB
-	MsgDB  *sql.DB
+	MainDB  *sql.DB
+	MsgDB   *sql.DB
+	Main    *Pool
+	Msg     *Pool
+	Dialect Dialect
+
+	sqliteOptions SQLiteOptions
+
+	// mainPath and msgPath are kept for diagnostics
+	mainPath string
+	msgPath  string
 }
 
-// NewDBHandler creates a new DBHandler instance
-func NewDBHandler() *DBHandler {
-	return &DBHandler{}
+// NewDBHandler creates a new DBHandler instance; opts apply to SQLite databases
+func NewDBHandler(opts SQLiteOptions) *DBHandler {
+	return &DBHandler{sqliteOptions: opts}
 }
 
-// InitMainDB initializes the main database
-func (handler *DBHandler) InitMainDB(dataSourceName, initScript string) error {
-	var err error
-	handler.MainDB, err = sql.Open("sqlite3", dataSourceName)
-	if err != nil {
-		return err
+// InitMainDB initializes the main database with the given driver (sqlite3 or postgres)
+func (handler *DBHandler) InitMainDB(driver, dataSourceName, initScript string) error {
+	dialect := Dialect(driver)
+	if dialect != SQLite && dialect != Postgres {
+		return fmt.Errorf("unsupported database driver %q", driver)
+	}
+
+	handler.Dialect = dialect
+	if dialect == SQLite {
+		pool, err := openPool(dataSourceName, "main", handler.sqliteOptions)
+		if err != nil {
+			return err
+		}
+		handler.Main = pool
+		handler.MainDB = pool.Writer
+		handler.mainPath = dataSourceName
+	} else {
+		var err error
+		handler.MainDB, err = openInstrumented(driver, dataSourceName, "main")
+		if err != nil {
+			return err
+		}
+		if err = handler.MainDB.Ping(); err != nil {
+			return err
+		}
 	}
 
-	if err = handler.MainDB.Ping(); err != nil {
+	if err := runInitScript(handler.MainDB, initScript); err != nil {
 		return err
 	}
 
-	return runInitScript(handler.MainDB, initScript)
+	return applyMigrations(handler.MainDB, dialect, mainMigrations)
 }
 
-// InitMsgDB initializes the messages database
+// InitMsgDB initializes the messages database. PostgreSQL keeps messages in
+// the main database, so there the main connection pool is shared.
 func (handler *DBHandler) InitMsgDB(dataSourceName string) error {
-	var err error
-	handler.MsgDB, err = sql.Open("sqlite3", dataSourceName)
+	if handler.Dialect == Postgres {
+		handler.MsgDB = handler.MainDB
+		return nil
+	}
+
+	pool, err := openPool(dataSourceName, "messages", handler.sqliteOptions)
 	if err != nil {
 		return err
 	}
+	handler.Msg = pool
+	handler.MsgDB = pool.Writer
+	handler.msgPath = dataSourceName
+	return nil
+}
 
-	return handler.MsgDB.Ping()
+// Close closes both databases
+func (handler *DBHandler) Close() error {
+	var errs []error
+	for _, pool := range []*Pool{handler.Main, handler.Msg} {
+		if pool != nil {
+			errs = append(errs, pool.Close())
+		}
+	}
+	if handler.Dialect == Postgres && handler.MainDB != nil {
+		errs = append(errs, handler.MainDB.Close())
+	}
+	return errors.Join(errs...)
 }
 
 // runInitScript executes the initialization script for the database
@@ -0,0 +1,538 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Migration is a numbered schema change applied once on top of the init script
+type Migration struct {
+	Version int
+	Name    string
+	SQL     string
+	// Postgres replaces SQL on PostgreSQL when the statements differ between dialects
+	Postgres string
+}
+
+// statements returns the SQL of the migration for a dialect
+func (m Migration) statements(dialect Dialect) string {
+	if dialect == Postgres && m.Postgres != "" {
+		return m.Postgres
+	}
+	return m.SQL
+}
+
+// mainMigrations are the schema changes for the main database, in version order.
+// Never edit an applied migration; append a new one instead.
+var mainMigrations = []Migration{
+	{
+		Version: 1,
+		Name:    "lookup indexes",
+		SQL: `
+CREATE INDEX IF NOT EXISTS "idx_active_sessions_session_id" ON "active_sessions"("session_id");
+CREATE INDEX IF NOT EXISTS "idx_comments_post_id" ON "comments"("post_id");
+CREATE INDEX IF NOT EXISTS "idx_rates_user_post" ON "rates"("user_id", "post_id");
+CREATE INDEX IF NOT EXISTS "idx_rates_user_comment" ON "rates"("user_id", "comment_id");
+CREATE INDEX IF NOT EXISTS "idx_api_tokens_user_id" ON "api_tokens"("user_id");`,
+	},
+	{
+		// Racing requests could record the same vote twice; keep the latest one,
+		// make votes unique and derive the totals from them
+		Version:  2,
+		Name:     "vote counts",
+		SQL:      `DELETE FROM "rates" WHERE rowid NOT IN (SELECT MAX(rowid) FROM "rates" GROUP BY "user_id", "post_id", "comment_id");` + voteCounts,
+		Postgres: `DELETE FROM "rates" a USING "rates" b WHERE a.ctid < b.ctid AND a."user_id" = b."user_id" AND a."post_id" IS NOT DISTINCT FROM b."post_id" AND a."comment_id" IS NOT DISTINCT FROM b."comment_id";` + voteCounts,
+	},
+	{
+		// The scores are filled in by the ranking refresh on startup
+		Version:  3,
+		Name:     "ranking scores",
+		SQL:      rankingScores,
+		Postgres: strings.ReplaceAll(rankingScores, "REAL", "DOUBLE PRECISION"),
+	},
+	{
+		Version:  4,
+		Name:     "follows",
+		SQL:      follows,
+		Postgres: strings.ReplaceAll(follows, "TIMESTAMP", "TIMESTAMPTZ"),
+	},
+	{
+		Version: 5,
+		Name:    "bookmarks",
+		SQL:     bookmarks,
+		Postgres: strings.NewReplacer(
+			"INTEGER PRIMARY KEY AUTOINCREMENT", "SERIAL PRIMARY KEY",
+			"TIMESTAMP", "TIMESTAMPTZ",
+		).Replace(bookmarks),
+	},
+	{
+		// Posts written before Markdown keep rendering as escaped plain text
+		Version: 6,
+		Name:    "content html",
+		SQL:     contentHTML,
+	},
+	{
+		Version: 7,
+		Name:    "mentions",
+		SQL:     mentions,
+	},
+	{
+		Version: 8,
+		Name:    "attachments",
+		SQL:     attachments,
+		Postgres: strings.NewReplacer(
+			"INTEGER PRIMARY KEY AUTOINCREMENT", "SERIAL PRIMARY KEY",
+			"TIMESTAMP", "TIMESTAMPTZ",
+		).Replace(attachments),
+	},
+	{
+		Version: 9,
+		Name:    "link_previews",
+		SQL:     linkPreviews,
+		Postgres: strings.NewReplacer(
+			"TIMESTAMP", "TIMESTAMPTZ",
+		).Replace(linkPreviews),
+	},
+	{
+		Version: 10,
+		Name:    "reactions",
+		SQL:     reactions,
+		Postgres: strings.NewReplacer(
+			"INTEGER PRIMARY KEY AUTOINCREMENT", "SERIAL PRIMARY KEY",
+			"TIMESTAMP", "TIMESTAMPTZ",
+		).Replace(reactions),
+	},
+	{
+		Version: 11,
+		Name:    "polls",
+		SQL:     polls,
+		Postgres: strings.NewReplacer(
+			"INTEGER PRIMARY KEY AUTOINCREMENT", "SERIAL PRIMARY KEY",
+			"TIMESTAMP", "TIMESTAMPTZ",
+		).Replace(polls),
+	},
+	{
+		Version: 12,
+		Name:    "drafts",
+		SQL:     drafts,
+		Postgres: strings.NewReplacer(
+			"INTEGER PRIMARY KEY AUTOINCREMENT", "SERIAL PRIMARY KEY",
+			"TIMESTAMP", "TIMESTAMPTZ",
+		).Replace(drafts),
+	},
+	{
+		Version: 13,
+		Name:    "webhooks",
+		SQL:     webhooks,
+		Postgres: strings.NewReplacer(
+			"INTEGER PRIMARY KEY AUTOINCREMENT", "SERIAL PRIMARY KEY",
+			"TIMESTAMP", "TIMESTAMPTZ",
+		).Replace(webhooks),
+	},
+	{
+		Version: 14,
+		Name:    "outbox",
+		SQL:     outbox,
+		Postgres: strings.NewReplacer(
+			"INTEGER PRIMARY KEY AUTOINCREMENT", "SERIAL PRIMARY KEY",
+			"TIMESTAMP", "TIMESTAMPTZ",
+		).Replace(outbox),
+	},
+	{
+		// Tokens created before reads needed a scope keep their read access
+		Version: 15,
+		Name:    "token read scopes",
+		SQL:     `UPDATE "api_tokens" SET "scopes" = "scopes" || ' posts:read users:read follows:read attachments:read';`,
+	},
+	{
+		// The ranking refresh reads the votes of a range of posts or comments at a time
+		Version: 16,
+		Name:    "rate target indexes",
+		SQL: `
+CREATE INDEX IF NOT EXISTS "idx_rates_post_id" ON "rates"("post_id");
+CREATE INDEX IF NOT EXISTS "idx_rates_comment_id" ON "rates"("comment_id");`,
+	},
+	{
+		Version:  17,
+		Name:     "outbox deliveries",
+		SQL:      outboxDeliveries,
+		Postgres: strings.NewReplacer("TIMESTAMP", "TIMESTAMPTZ").Replace(outboxDeliveries),
+	},
+}
+
+// voteCounts is the dialect-independent part of migration 2
+const voteCounts = `
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_rates_unique_post_vote" ON "rates"("user_id", "post_id") WHERE "comment_id" IS NULL;
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_rates_unique_comment_vote" ON "rates"("user_id", "comment_id") WHERE "comment_id" IS NOT NULL;
+ALTER TABLE "posts" ADD COLUMN "upvotes" INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE "posts" ADD COLUMN "downvotes" INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE "comments" ADD COLUMN "upvotes" INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE "comments" ADD COLUMN "downvotes" INTEGER NOT NULL DEFAULT 0;
+UPDATE "posts" SET
+    "upvotes" = (SELECT COUNT(*) FROM "rates" WHERE "rates"."post_id" = "posts"."id" AND "rates"."comment_id" IS NULL AND "rates"."status" = 'up'),
+    "downvotes" = (SELECT COUNT(*) FROM "rates" WHERE "rates"."post_id" = "posts"."id" AND "rates"."comment_id" IS NULL AND "rates"."status" = 'down');
+UPDATE "posts" SET "rate" = "upvotes" - "downvotes";
+UPDATE "comments" SET
+    "upvotes" = (SELECT COUNT(*) FROM "rates" WHERE "rates"."comment_id" = "comments"."id" AND "rates"."status" = 'up'),
+    "downvotes" = (SELECT COUNT(*) FROM "rates" WHERE "rates"."comment_id" = "comments"."id" AND "rates"."status" = 'down');
+UPDATE "comments" SET "rate" = "upvotes" - "downvotes";`
+
+// rankingScores is migration 3. REAL is single precision on PostgreSQL, too
+// coarse for the hot score, so it uses DOUBLE PRECISION there.
+const rankingScores = `
+ALTER TABLE "posts" ADD COLUMN "hot" REAL NOT NULL DEFAULT 0;
+ALTER TABLE "posts" ADD COLUMN "controversy" REAL NOT NULL DEFAULT 0;
+ALTER TABLE "posts" ADD COLUMN "rising" REAL NOT NULL DEFAULT 0;
+ALTER TABLE "posts" ADD COLUMN "top_day" INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE "posts" ADD COLUMN "top_week" INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE "posts" ADD COLUMN "top_month" INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE "posts" ADD COLUMN "top_year" INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE "comments" ADD COLUMN "hot" REAL NOT NULL DEFAULT 0;
+ALTER TABLE "comments" ADD COLUMN "controversy" REAL NOT NULL DEFAULT 0;
+ALTER TABLE "comments" ADD COLUMN "rising" REAL NOT NULL DEFAULT 0;
+ALTER TABLE "comments" ADD COLUMN "top_day" INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE "comments" ADD COLUMN "top_week" INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE "comments" ADD COLUMN "top_month" INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE "comments" ADD COLUMN "top_year" INTEGER NOT NULL DEFAULT 0;
+CREATE INDEX IF NOT EXISTS "idx_posts_hot" ON "posts"("hot");`
+
+// follows is migration 4. The feed selects posts by author and by category,
+// so both lookups are indexed.
+const follows = `
+CREATE TABLE IF NOT EXISTS "user_follows" (
+    "follower_id" INTEGER NOT NULL,
+    "followee_id" INTEGER NOT NULL,
+    "created_at" TIMESTAMP NOT NULL,
+    PRIMARY KEY("follower_id", "followee_id"),
+    FOREIGN KEY("follower_id") REFERENCES "users"("id"),
+    FOREIGN KEY("followee_id") REFERENCES "users"("id")
+);
+CREATE INDEX IF NOT EXISTS "idx_user_follows_followee_id" ON "user_follows"("followee_id");
+CREATE TABLE IF NOT EXISTS "category_follows" (
+    "user_id" INTEGER NOT NULL,
+    "category_id" INTEGER NOT NULL,
+    "created_at" TIMESTAMP NOT NULL,
+    PRIMARY KEY("user_id", "category_id"),
+    FOREIGN KEY("user_id") REFERENCES "users"("id"),
+    FOREIGN KEY("category_id") REFERENCES "categories"("id")
+);
+CREATE INDEX IF NOT EXISTS "idx_posts_user_id" ON "posts"("user_id");
+CREATE INDEX IF NOT EXISTS "idx_post_categories_category_id" ON "post_categories"("category_id", "post_id");
+ALTER TABLE "users" ADD COLUMN "followers_count" INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE "users" ADD COLUMN "following_count" INTEGER NOT NULL DEFAULT 0;`
+
+// bookmarks is migration 5. Saved items go away with the collection, post or
+// comment they belong to. Positions order the items of a collection and may
+// have gaps.
+const bookmarks = `
+CREATE TABLE IF NOT EXISTS "bookmark_collections" (
+    "id" INTEGER PRIMARY KEY AUTOINCREMENT,
+    "user_id" INTEGER NOT NULL,
+    "name" TEXT NOT NULL,
+    "created_at" TIMESTAMP NOT NULL,
+    UNIQUE("user_id", "name"),
+    FOREIGN KEY("user_id") REFERENCES "users"("id") ON DELETE CASCADE
+);
+CREATE TABLE IF NOT EXISTS "bookmarks" (
+    "id" INTEGER PRIMARY KEY AUTOINCREMENT,
+    "collection_id" INTEGER NOT NULL,
+    "user_id" INTEGER NOT NULL,
+    "post_id" INTEGER NOT NULL,
+    "comment_id" INTEGER,
+    "position" INTEGER NOT NULL,
+    "created_at" TIMESTAMP NOT NULL,
+    FOREIGN KEY("collection_id") REFERENCES "bookmark_collections"("id") ON DELETE CASCADE,
+    FOREIGN KEY("user_id") REFERENCES "users"("id") ON DELETE CASCADE,
+    FOREIGN KEY("post_id") REFERENCES "posts"("id") ON DELETE CASCADE,
+    FOREIGN KEY("comment_id") REFERENCES "comments"("id") ON DELETE CASCADE
+);
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_bookmarks_unique_post" ON "bookmarks"("collection_id", "post_id") WHERE "comment_id" IS NULL;
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_bookmarks_unique_comment" ON "bookmarks"("collection_id", "comment_id") WHERE "comment_id" IS NOT NULL;
+CREATE INDEX IF NOT EXISTS "idx_bookmarks_collection_position" ON "bookmarks"("collection_id", "position");
+CREATE INDEX IF NOT EXISTS "idx_bookmarks_user_post" ON "bookmarks"("user_id", "post_id");`
+
+// contentHTML is migration 6. Posts and comments store their content rendered
+// from Markdown, so reads never render. Existing content is filled in escaped
+// as a single paragraph; both dialects share the SQL.
+const contentHTML = `
+ALTER TABLE "posts" ADD COLUMN "content_html" TEXT NOT NULL DEFAULT '';
+ALTER TABLE "comments" ADD COLUMN "content_html" TEXT NOT NULL DEFAULT '';
+UPDATE "posts" SET "content_html" = '<p>' || ` + escapeContent + ` || '</p>' WHERE "content" <> '';
+UPDATE "comments" SET "content_html" = '<p>' || ` + escapeContent + ` || '</p>' WHERE "content" <> '';`
+
+// escapeContent escapes the content column like html.EscapeString
+const escapeContent = `REPLACE(REPLACE(REPLACE(REPLACE(REPLACE("content", '&', '&amp;'), '<', '&lt;'), '>', '&gt;'), '"', '&#34;'), '''', '&#39;')`
+
+// mentions is migration 7. A mention belongs to a post, a comment or a chat
+// message, identified by the chat hash and the message ID (the rowid of the
+// chat table on SQLite). Chat messages live in another SQLite database, so
+// their mentions cannot reference them.
+const mentions = `
+CREATE TABLE IF NOT EXISTS "mentions" (
+    "user_id" INTEGER NOT NULL,
+    "post_id" INTEGER,
+    "comment_id" INTEGER,
+    "chat_hash" TEXT,
+    "message_id" INTEGER,
+    "start" INTEGER NOT NULL,
+    "length" INTEGER NOT NULL,
+    FOREIGN KEY("user_id") REFERENCES "users"("id") ON DELETE CASCADE,
+    FOREIGN KEY("post_id") REFERENCES "posts"("id") ON DELETE CASCADE,
+    FOREIGN KEY("comment_id") REFERENCES "comments"("id") ON DELETE CASCADE
+);
+CREATE INDEX IF NOT EXISTS "idx_mentions_post_id" ON "mentions"("post_id");
+CREATE INDEX IF NOT EXISTS "idx_mentions_comment_id" ON "mentions"("comment_id");
+CREATE INDEX IF NOT EXISTS "idx_mentions_chat" ON "mentions"("chat_hash", "message_id");`
+
+// attachments is migration 8. Uploads start out linked to nothing and are
+// linked to a post, a comment or a chat message, like mentions, when that is
+// created. The files are kept in a blob store under blob_key and
+// thumbnail_key; thumbnail_key is empty for files other than images.
+const attachments = `
+CREATE TABLE IF NOT EXISTS "attachments" (
+    "id" INTEGER PRIMARY KEY AUTOINCREMENT,
+    "user_id" INTEGER NOT NULL,
+    "post_id" INTEGER,
+    "comment_id" INTEGER,
+    "chat_hash" TEXT,
+    "message_id" INTEGER,
+    "file_name" TEXT NOT NULL,
+    "mime_type" TEXT NOT NULL,
+    "size" INTEGER NOT NULL,
+    "width" INTEGER NOT NULL DEFAULT 0,
+    "height" INTEGER NOT NULL DEFAULT 0,
+    "blob_key" TEXT NOT NULL,
+    "thumbnail_key" TEXT NOT NULL DEFAULT '',
+    "created_at" TIMESTAMP NOT NULL,
+    FOREIGN KEY("user_id") REFERENCES "users"("id") ON DELETE CASCADE,
+    FOREIGN KEY("post_id") REFERENCES "posts"("id") ON DELETE CASCADE,
+    FOREIGN KEY("comment_id") REFERENCES "comments"("id") ON DELETE CASCADE
+);
+CREATE INDEX IF NOT EXISTS "idx_attachments_user_id" ON "attachments"("user_id");
+CREATE INDEX IF NOT EXISTS "idx_attachments_post_id" ON "attachments"("post_id");
+CREATE INDEX IF NOT EXISTS "idx_attachments_comment_id" ON "attachments"("comment_id");
+CREATE INDEX IF NOT EXISTS "idx_attachments_chat" ON "attachments"("chat_hash", "message_id");`
+
+// linkPreviews is migration 9. Previews are cached by URL and found through
+// the links in the content, so nothing refers to them. Pages without metadata
+// are cached with empty fields so that they are not fetched over and over.
+const linkPreviews = `
+CREATE TABLE IF NOT EXISTS "link_previews" (
+    "url" TEXT PRIMARY KEY,
+    "title" TEXT NOT NULL DEFAULT '',
+    "description" TEXT NOT NULL DEFAULT '',
+    "image_url" TEXT NOT NULL DEFAULT '',
+    "site_name" TEXT NOT NULL DEFAULT '',
+    "fetched_at" TIMESTAMP NOT NULL
+);`
+
+// reactions is migration 10. Like mentions, a reaction names a post, a
+// comment or a chat message; each user reacts with an emoji only once.
+const reactions = `
+CREATE TABLE IF NOT EXISTS "reactions" (
+    "id" INTEGER PRIMARY KEY AUTOINCREMENT,
+    "user_id" INTEGER NOT NULL,
+    "post_id" INTEGER,
+    "comment_id" INTEGER,
+    "chat_hash" TEXT,
+    "message_id" INTEGER,
+    "emoji" TEXT NOT NULL,
+    "created_at" TIMESTAMP NOT NULL,
+    FOREIGN KEY("user_id") REFERENCES "users"("id") ON DELETE CASCADE,
+    FOREIGN KEY("post_id") REFERENCES "posts"("id") ON DELETE CASCADE,
+    FOREIGN KEY("comment_id") REFERENCES "comments"("id") ON DELETE CASCADE
+);
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_reactions_post" ON "reactions"("post_id", "user_id", "emoji") WHERE "post_id" IS NOT NULL;
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_reactions_comment" ON "reactions"("comment_id", "user_id", "emoji") WHERE "comment_id" IS NOT NULL;
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_reactions_message" ON "reactions"("chat_hash", "message_id", "user_id", "emoji") WHERE "chat_hash" IS NOT NULL;`
+
+// polls is migration 11. A post has at most one poll; every option a user
+// voted for is a row of poll_votes.
+const polls = `
+CREATE TABLE IF NOT EXISTS "polls" (
+    "post_id" INTEGER PRIMARY KEY,
+    "question" TEXT NOT NULL,
+    "multiple" BOOLEAN NOT NULL,
+    "anonymous" BOOLEAN NOT NULL,
+    "closes_at" TIMESTAMP,
+    FOREIGN KEY("post_id") REFERENCES "posts"("id") ON DELETE CASCADE
+);
+CREATE TABLE IF NOT EXISTS "poll_options" (
+    "id" INTEGER PRIMARY KEY AUTOINCREMENT,
+    "post_id" INTEGER NOT NULL,
+    "position" INTEGER NOT NULL,
+    "text" TEXT NOT NULL,
+    FOREIGN KEY("post_id") REFERENCES "polls"("post_id") ON DELETE CASCADE
+);
+CREATE INDEX IF NOT EXISTS "idx_poll_options_post" ON "poll_options"("post_id", "position");
+CREATE TABLE IF NOT EXISTS "poll_votes" (
+    "option_id" INTEGER NOT NULL,
+    "post_id" INTEGER NOT NULL,
+    "user_id" INTEGER NOT NULL,
+    "created_at" TIMESTAMP NOT NULL,
+    PRIMARY KEY("option_id", "user_id"),
+    FOREIGN KEY("option_id") REFERENCES "poll_options"("id") ON DELETE CASCADE,
+    FOREIGN KEY("post_id") REFERENCES "polls"("post_id") ON DELETE CASCADE,
+    FOREIGN KEY("user_id") REFERENCES "users"("id") ON DELETE CASCADE
+);
+CREATE INDEX IF NOT EXISTS "idx_poll_votes_post_user" ON "poll_votes"("post_id", "user_id");`
+
+// drafts is migration 12. Attachment IDs and the poll are kept as JSON until
+// the draft is published; the draft row is removed when it becomes a post.
+const drafts = `
+CREATE TABLE IF NOT EXISTS "drafts" (
+    "id" INTEGER PRIMARY KEY AUTOINCREMENT,
+    "user_id" INTEGER NOT NULL,
+    "title" TEXT NOT NULL,
+    "content" TEXT NOT NULL,
+    "categories" TEXT NOT NULL,
+    "attachment_ids" TEXT NOT NULL,
+    "poll" TEXT,
+    "publish_at" TIMESTAMP,
+    "created_at" TIMESTAMP NOT NULL,
+    "updated_at" TIMESTAMP NOT NULL,
+    FOREIGN KEY("user_id") REFERENCES "users"("id") ON DELETE CASCADE
+);
+CREATE INDEX IF NOT EXISTS "idx_drafts_user" ON "drafts"("user_id", "updated_at");
+CREATE INDEX IF NOT EXISTS "idx_drafts_publish_at" ON "drafts"("publish_at") WHERE "publish_at" IS NOT NULL;`
+
+// webhooks is migration 13. Events are stored space separated. Deliveries
+// are the retry queue and the delivery log at once: pending ones wait for
+// next_attempt_at, which a dispatcher also moves ahead while it sends them.
+const webhooks = `
+CREATE TABLE IF NOT EXISTS "webhooks" (
+    "id" INTEGER PRIMARY KEY AUTOINCREMENT,
+    "url" TEXT NOT NULL,
+    "secret" TEXT NOT NULL,
+    "events" TEXT NOT NULL,
+    "active" BOOLEAN NOT NULL,
+    "created_at" TIMESTAMP NOT NULL
+);
+CREATE TABLE IF NOT EXISTS "webhook_deliveries" (
+    "id" INTEGER PRIMARY KEY AUTOINCREMENT,
+    "webhook_id" INTEGER NOT NULL,
+    "event" TEXT NOT NULL,
+    "payload" TEXT NOT NULL,
+    "status" TEXT NOT NULL,
+    "attempts" INTEGER NOT NULL DEFAULT 0,
+    "last_status_code" INTEGER NOT NULL DEFAULT 0,
+    "last_error" TEXT NOT NULL DEFAULT '',
+    "next_attempt_at" TIMESTAMP,
+    "created_at" TIMESTAMP NOT NULL,
+    "delivered_at" TIMESTAMP,
+    FOREIGN KEY("webhook_id") REFERENCES "webhooks"("id") ON DELETE CASCADE
+);
+CREATE INDEX IF NOT EXISTS "idx_webhook_deliveries_webhook" ON "webhook_deliveries"("webhook_id", "id");
+CREATE INDEX IF NOT EXISTS "idx_webhook_deliveries_due" ON "webhook_deliveries"("next_attempt_at") WHERE "status" = 'pending';`
+
+// outbox is migration 14. Events wait in the outbox until available_at,
+// which a dispatcher moves ahead while it hands them to subscribers, and are
+// kept for a while once dispatched. The post and comment counters, which
+// used to be incremented outside the transactions, are counted afresh.
+const outbox = `
+CREATE TABLE IF NOT EXISTS "outbox" (
+    "id" INTEGER PRIMARY KEY AUTOINCREMENT,
+    "event" TEXT NOT NULL,
+    "payload" TEXT NOT NULL,
+    "attempts" INTEGER NOT NULL DEFAULT 0,
+    "available_at" TIMESTAMP NOT NULL,
+    "created_at" TIMESTAMP NOT NULL,
+    "dispatched_at" TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS "idx_outbox_pending" ON "outbox"("available_at") WHERE "dispatched_at" IS NULL;
+CREATE INDEX IF NOT EXISTS "idx_outbox_dispatched" ON "outbox"("dispatched_at") WHERE "dispatched_at" IS NOT NULL;
+UPDATE "users" SET
+    "amount_of_posts" = (SELECT COUNT(*) FROM "posts" WHERE "posts"."user_id" = "users"."id"),
+    "amount_of_comments" = (SELECT COUNT(*) FROM "comments" WHERE "comments"."user_id" = "users"."id");
+UPDATE "posts" SET "amount_of_comments" = (SELECT COUNT(*) FROM "comments" WHERE "comments"."post_id" = "posts"."id");`
+
+// outboxDeliveries is migration 17. An event that is to be handed out again
+// keeps the names of the subscribers that handled it already, which are
+// skipped on the next attempts; the names go with the event when it is pruned.
+const outboxDeliveries = `
+CREATE TABLE IF NOT EXISTS "outbox_deliveries" (
+    "event_id" INTEGER NOT NULL,
+    "subscriber" TEXT NOT NULL,
+    "delivered_at" TIMESTAMP NOT NULL,
+    PRIMARY KEY("event_id", "subscriber"),
+    FOREIGN KEY("event_id") REFERENCES "outbox"("id") ON DELETE CASCADE
+);`
+
+const createMigrationsTable = `CREATE TABLE IF NOT EXISTS "schema_migrations" (
+    "version" INTEGER PRIMARY KEY,
+    "name" TEXT NOT NULL,
+    "applied_at" TIMESTAMP NOT NULL
+)`
+
+// applyMigrations runs every migration that is not yet recorded in schema_migrations.
+// Each migration runs in its own transaction together with its bookkeeping row.
+func applyMigrations(db *sql.DB, dialect Dialect, migrations []Migration) error {
+	if _, err := db.Exec(createMigrationsTable); err != nil {
+		return err
+	}
+
+	applied, err := appliedVersions(db)
+	if err != nil {
+		return err
+	}
+
+	for _, m := range migrations {
+		if applied[m.Version] {
+			continue
+		}
+
+		tx, err := db.Begin()
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec(m.statements(dialect)); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("migration %d (%s): %w", m.Version, m.Name, err)
+		}
+		if _, err := tx.Exec(dialect.Rebind(`INSERT INTO schema_migrations (version, name, applied_at) VALUES (?, ?, ?)`), m.Version, m.Name, time.Now()); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("migration %d (%s): %w", m.Version, m.Name, err)
+		}
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// pendingMigrations returns the migrations that have not been applied yet
+func pendingMigrations(db *sql.DB, migrations []Migration) ([]Migration, error) {
+	applied, err := appliedVersions(db)
+	if err != nil {
+		return nil, err
+	}
+
+	var pending []Migration
+	for _, m := range migrations {
+		if !applied[m.Version] {
+			pending = append(pending, m)
+		}
+	}
+	return pending, nil
+}
+
+// appliedVersions reads the set of applied migration versions
+func appliedVersions(db *sql.DB) (map[int]bool, error) {
+	rows, err := db.Query(`SELECT version FROM schema_migrations`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := make(map[int]bool)
+	for rows.Next() {
+		var version int
+		if err := rows.Scan(&version); err != nil {
+			return nil, err
+		}
+		applied[version] = true
+	}
+	return applied, rows.Err()
+}
@@ -0,0 +1,93 @@
+package db
+
+import (
+	"database/sql"
+	"html"
+	"testing"
+	"time"
+
+	"project-root/pkg/markdown"
+)
+
+// TestContentHTMLEscapesExistingContent fills posts and comments written
+// before Markdown with hostile content and checks that migration 6 stores
+// it as one escaped paragraph that the sanitizer leaves as it is
+func TestContentHTMLEscapesExistingContent(t *testing.T) {
+	contents := []string{
+		"<script>alert(1)</script>",
+		"<img src=x onerror=alert(1)>",
+		`<a href="javascript:alert(1)">x</a>`,
+		"[x](javascript:alert(1))",
+		`" onmouseover="alert(1)`,
+		"' onmouseover='alert(1)",
+		"&lt;script&gt; &amp; &#60;b&#62;",
+		"```js\" onclick=\"alert(1)\n<b>x</b>\n```",
+		"plain text",
+	}
+
+	database, err := sql.Open("sqlite3", t.TempDir()+"/legacy.db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer database.Close()
+	if err := runInitScript(database, "data/database.sql"); err != nil {
+		t.Fatal(err)
+	}
+	var before, through []Migration
+	for _, m := range mainMigrations {
+		if m.Version < 6 {
+			before = append(before, m)
+		}
+		if m.Version <= 6 {
+			through = append(through, m)
+		}
+	}
+	if err := applyMigrations(database, SQLite, before); err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	if _, err := database.Exec(`INSERT INTO users (id, nickname, age, gender, first_name, last_name, created_at) VALUES (1, 'legacy', '30', 'other', 'Old', 'Timer', ?)`, now); err != nil {
+		t.Fatal(err)
+	}
+	for i, content := range contents {
+		if _, err := database.Exec(`INSERT INTO posts (id, user_id, title, content, created_at) VALUES (?, 1, 'Legacy post', ?, ?)`, i+1, content, now); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := database.Exec(`INSERT INTO comments (post_id, user_id, content, created_at) VALUES (?, 1, ?, ?)`, i+1, content, now); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := applyMigrations(database, SQLite, through); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, table := range []string{"posts", "comments"} {
+		rows, err := database.Query(`SELECT content, content_html FROM ` + table + ` ORDER BY id`)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var checked int
+		for rows.Next() {
+			var content, contentHTML string
+			if err := rows.Scan(&content, &contentHTML); err != nil {
+				t.Fatal(err)
+			}
+			if want := "<p>" + html.EscapeString(content) + "</p>"; contentHTML != want {
+				t.Errorf("%s: content %q migrated to %q, want %q", table, content, contentHTML, want)
+			}
+			if sanitized := markdown.Sanitize(contentHTML); sanitized != contentHTML {
+				t.Errorf("%s: migrated %q sanitizes to %q", table, contentHTML, sanitized)
+			}
+			checked++
+		}
+		if err := rows.Err(); err != nil {
+			t.Fatal(err)
+		}
+		rows.Close()
+		if checked != len(contents) {
+			t.Errorf("%s: checked %d rows, want %d", table, checked, len(contents))
+		}
+	}
+}
@@ -0,0 +1,164 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxCachedStatements bounds each statement cache. Queries built per chat
+// table would otherwise grow it without limit; once full they run unprepared.
+const maxCachedStatements = 256
+
+// Pool is a SQLite database opened twice: a single writer connection, so
+// writers queue in Go instead of failing with "database is locked", and a
+// pool of query-only connections that read concurrently thanks to WAL.
+//
+// Statements on the writer are prepared once and reused. Reads run
+// unprepared: a cache would make the concurrent readers take its lock and
+// that of the shared statement on every query, and prepare the statement
+// again on each connection it lands on. BenchmarkPoolReads compares both.
+// A Pool without a statement cache runs every statement unprepared.
+//
+// Query and QueryRow run on the query-only connections, so statements that
+// write and return rows, such as INSERT ... RETURNING, go through a
+// transaction from Begin.
+type Pool struct {
+	Writer *sql.DB
+	Reader *sql.DB
+
+	writeStmts *stmtCache
+}
+
+// SQLiteOptions tune the connections of a Pool
+type SQLiteOptions struct {
+	BusyTimeout  time.Duration
+	ReadPoolSize int
+}
+
+// openPool opens the writer and reader handles of a SQLite file
+func openPool(path, name string, opts SQLiteOptions) (*Pool, error) {
+	params := fmt.Sprintf("_busy_timeout=%d&_foreign_keys=on&_synchronous=NORMAL", opts.BusyTimeout.Milliseconds())
+
+	writer, err := openInstrumented("sqlite3", withParams(path, "_journal_mode=WAL&_txlock=immediate&"+params), name)
+	if err != nil {
+		return nil, err
+	}
+	writer.SetMaxOpenConns(1)
+	// Keep the connection open so its settings and prepared statements survive idle periods
+	writer.SetConnMaxIdleTime(0)
+	writer.SetConnMaxLifetime(0)
+
+	// The writer switches the file to WAL before any reader opens it
+	if err := writer.Ping(); err != nil {
+		writer.Close()
+		return nil, err
+	}
+
+	reader, err := openInstrumented("sqlite3", withParams(path, "_query_only=true&"+params), name)
+	if err != nil {
+		writer.Close()
+		return nil, err
+	}
+	reader.SetMaxOpenConns(opts.ReadPoolSize)
+	reader.SetMaxIdleConns(opts.ReadPoolSize)
+
+	return &Pool{
+		Writer:     writer,
+		Reader:     reader,
+		writeStmts: newStmtCache(writer),
+	}, nil
+}
+
+// withParams appends connection parameters to a SQLite path or DSN
+func withParams(path, params string) string {
+	if strings.Contains(path, "?") {
+		return path + "&" + params
+	}
+	return path + "?" + params
+}
+
+// Exec runs a statement on the writer connection
+func (p *Pool) Exec(query string, args ...interface{}) (sql.Result, error) {
+	stmt, err := p.writeStmts.get(query)
+	if err != nil {
+		return nil, err
+	}
+	if stmt == nil {
+		return p.Writer.Exec(query, args...)
+	}
+	return stmt.Exec(args...)
+}
+
+// Begin starts a transaction on the writer connection. Writer transactions
+// begin IMMEDIATE, so they hold the write lock from the start.
+func (p *Pool) Begin() (*sql.Tx, error) {
+	return p.Writer.Begin()
+}
+
+// Query runs a query on the read pool
+func (p *Pool) Query(query string, args ...interface{}) (*sql.Rows, error) {
+	return p.Reader.Query(query, args...)
+}
+
+// QueryRow runs a query that returns at most one row on the read pool
+func (p *Pool) QueryRow(query string, args ...interface{}) *sql.Row {
+	return p.Reader.QueryRow(query, args...)
+}
+
+// Close closes the cached statements and both handles
+func (p *Pool) Close() error {
+	return errors.Join(p.writeStmts.close(), p.Reader.Close(), p.Writer.Close())
+}
+
+// stmtCache holds the prepared statements of one handle, keyed by query text
+type stmtCache struct {
+	db    *sql.DB
+	mu    sync.Mutex
+	stmts map[string]*sql.Stmt
+}
+
+func newStmtCache(db *sql.DB) *stmtCache {
+	return &stmtCache{db: db, stmts: make(map[string]*sql.Stmt)}
+}
+
+// get returns the prepared statement for query, preparing it on first use.
+// It returns nil without an error when the cache is full or there is none.
+func (c *stmtCache) get(query string) (*sql.Stmt, error) {
+	if c == nil {
+		return nil, nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if stmt, ok := c.stmts[query]; ok {
+		return stmt, nil
+	}
+	if len(c.stmts) >= maxCachedStatements {
+		return nil, nil
+	}
+	stmt, err := c.db.Prepare(query)
+	if err != nil {
+		return nil, err
+	}
+	c.stmts[query] = stmt
+	return stmt, nil
+}
+
+func (c *stmtCache) close() error {
+	if c == nil {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var errs []error
+	for query, stmt := range c.stmts {
+		errs = append(errs, stmt.Close())
+		delete(c.stmts, query)
+	}
+	return errors.Join(errs...)
+}
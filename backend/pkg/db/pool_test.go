@@ -0,0 +1,183 @@
+package db
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// benchRows is the number of rows the benchmarks read and update
+const benchRows = 1000
+
+// benchWorkers is the number of goroutines that keep the other side busy
+const benchWorkers = 4
+
+const (
+	benchRead  = `SELECT value FROM items WHERE id = ?`
+	benchWrite = `UPDATE items SET value = ?, updated = updated + 1 WHERE id = ?`
+)
+
+// poolWrite runs the benchmark updates through the statement cache of the
+// writer, or straight on its handle like the pool does once the cache is full
+type poolWrite struct {
+	name  string
+	write func(p *Pool, id int, value string) error
+}
+
+var poolWrites = []poolWrite{
+	{"cached", func(p *Pool, id int, value string) error {
+		_, err := p.Exec(benchWrite, value, id)
+		return err
+	}},
+	{"uncached", func(p *Pool, id int, value string) error {
+		_, err := p.Writer.Exec(benchWrite, value, id)
+		return err
+	}},
+}
+
+// poolRead runs the benchmark reads on the read pool, either as plain
+// queries like the pool does or through a statement cache like the writer's
+type poolRead struct {
+	name string
+	open func(b *testing.B, p *Pool) func(id int) error
+}
+
+var poolReads = []poolRead{
+	{"unprepared", func(b *testing.B, p *Pool) func(id int) error {
+		return func(id int) error {
+			var value string
+			return p.QueryRow(benchRead, id).Scan(&value)
+		}
+	}},
+	{"cached", func(b *testing.B, p *Pool) func(id int) error {
+		cache := newStmtCache(p.Reader)
+		b.Cleanup(func() { cache.close() })
+		return func(id int) error {
+			stmt, err := cache.get(benchRead)
+			if err != nil {
+				return err
+			}
+			var value string
+			return stmt.QueryRow(id).Scan(&value)
+		}
+	}},
+}
+
+// openBenchPool opens a pool on a new database of benchRows items
+func openBenchPool(b *testing.B) *Pool {
+	b.Helper()
+	p, err := openPool(b.TempDir()+"/bench.db", "bench", SQLiteOptions{BusyTimeout: 5 * time.Second, ReadPoolSize: 4})
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.Cleanup(func() { p.Close() })
+
+	if _, err := p.Writer.Exec(`CREATE TABLE items (id INTEGER PRIMARY KEY, value TEXT NOT NULL, updated INTEGER NOT NULL DEFAULT 0)`); err != nil {
+		b.Fatal(err)
+	}
+	tx, err := p.Begin()
+	if err != nil {
+		b.Fatal(err)
+	}
+	for id := 1; id <= benchRows; id++ {
+		if _, err := tx.Exec(`INSERT INTO items (id, value) VALUES (?, ?)`, id, fmt.Sprint("item ", id)); err != nil {
+			tx.Rollback()
+			b.Fatal(err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		b.Fatal(err)
+	}
+	return p
+}
+
+// background runs work on benchWorkers goroutines until the returned stop
+// function is called, which reports the first error of work
+func background(b *testing.B, work func(worker, i int) error) (stop func()) {
+	b.Helper()
+	var (
+		done     = make(chan struct{})
+		wg       sync.WaitGroup
+		firstErr atomic.Value
+	)
+	for w := 0; w < benchWorkers; w++ {
+		wg.Add(1)
+		go func(worker int) {
+			defer wg.Done()
+			for i := 0; ; i++ {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				if err := work(worker, i); err != nil {
+					firstErr.CompareAndSwap(nil, err)
+					return
+				}
+			}
+		}(w)
+	}
+	return func() {
+		close(done)
+		wg.Wait()
+		if err, ok := firstErr.Load().(error); ok {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkPoolReads reads single rows concurrently while writers keep
+// updating other rows. It is why the read pool runs its queries unprepared.
+func BenchmarkPoolReads(b *testing.B) {
+	for _, access := range poolReads {
+		b.Run(access.name, func(b *testing.B) {
+			p := openBenchPool(b)
+			read := access.open(b, p)
+			stop := background(b, func(worker, i int) error {
+				return poolWrites[0].write(p, (worker*benchRows/benchWorkers+i)%benchRows+1, "written")
+			})
+			defer stop()
+
+			var next atomic.Int64
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					if err := read(int(next.Add(1))%benchRows + 1); err != nil {
+						b.Error(err)
+						return
+					}
+				}
+			})
+			b.StopTimer()
+		})
+	}
+}
+
+// BenchmarkPoolWrites updates rows concurrently, queueing on the writer
+// connection, while readers keep reading
+func BenchmarkPoolWrites(b *testing.B) {
+	for _, access := range poolWrites {
+		b.Run(access.name, func(b *testing.B) {
+			p := openBenchPool(b)
+			read := poolReads[0].open(b, p)
+			stop := background(b, func(worker, i int) error {
+				return read((worker*benchRows/benchWorkers+i)%benchRows + 1)
+			})
+			defer stop()
+
+			var next atomic.Int64
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					if err := access.write(p, int(next.Add(1))%benchRows+1, "written"); err != nil {
+						b.Error(err)
+						return
+					}
+				}
+			})
+			b.StopTimer()
+		})
+	}
+}
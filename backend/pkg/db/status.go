@@ -0,0 +1,123 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Status describes the state of one database for diagnostics
+type Status struct {
+	Name            string
+	Path            string
+	SizeBytes       int64
+	WALSizeBytes    int64
+	JournalMode     string
+	OpenConnections int
+	InUse           int
+	Idle            int
+}
+
+// Ping checks that both databases are reachable
+func (handler *DBHandler) Ping(ctx context.Context) error {
+	if handler.MainDB == nil || handler.MsgDB == nil {
+		return errors.New("databases are not initialized")
+	}
+	if err := handler.MainDB.PingContext(ctx); err != nil {
+		return fmt.Errorf("main database: %w", err)
+	}
+	if err := handler.MsgDB.PingContext(ctx); err != nil {
+		return fmt.Errorf("messages database: %w", err)
+	}
+	for _, pool := range []*Pool{handler.Main, handler.Msg} {
+		if pool == nil {
+			continue
+		}
+		if err := pool.Reader.PingContext(ctx); err != nil {
+			return fmt.Errorf("read pool: %w", err)
+		}
+	}
+	return nil
+}
+
+// CheckMigrations returns an error if the main database has pending migrations
+func (handler *DBHandler) CheckMigrations() error {
+	if handler.MainDB == nil {
+		return errors.New("main database is not initialized")
+	}
+	pending, err := pendingMigrations(handler.MainDB, mainMigrations)
+	if err != nil {
+		return err
+	}
+	if len(pending) > 0 {
+		return fmt.Errorf("%d pending migration(s), first is %d (%s)", len(pending), pending[0].Version, pending[0].Name)
+	}
+	return nil
+}
+
+// Status reports sizes, journal mode and pool usage of the databases
+func (handler *DBHandler) Status(ctx context.Context) []Status {
+	var statuses []Status
+	for _, d := range []struct {
+		name string
+		path string
+		conn *sql.DB
+		pool *Pool
+	}{
+		{"main", handler.mainPath, handler.MainDB, handler.Main},
+		{"messages", handler.msgPath, handler.MsgDB, handler.Msg},
+	} {
+		// A shared PostgreSQL pool is reported once
+		if d.conn == nil || (d.name == "messages" && d.conn == handler.MainDB) {
+			continue
+		}
+
+		status := Status{Name: d.name}
+		if handler.Dialect == SQLite {
+			status.Path = filePath(d.path)
+			status.SizeBytes = fileSize(status.Path)
+			status.WALSizeBytes = fileSize(status.Path + "-wal")
+			if err := d.conn.QueryRowContext(ctx, "PRAGMA journal_mode").Scan(&status.JournalMode); err != nil {
+				status.JournalMode = "unknown"
+			}
+		} else {
+			// The size stays 0 if the role may not read it
+			d.conn.QueryRowContext(ctx, "SELECT pg_database_size(current_database())").Scan(&status.SizeBytes)
+		}
+
+		// SQLite pools count the writer and the readers together
+		conns := []*sql.DB{d.conn}
+		if d.pool != nil {
+			conns = append(conns, d.pool.Reader)
+		}
+		for _, conn := range conns {
+			stats := conn.Stats()
+			status.OpenConnections += stats.OpenConnections
+			status.InUse += stats.InUse
+			status.Idle += stats.Idle
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses
+}
+
+// filePath strips the file: prefix and query parameters from a SQLite DSN
+func filePath(dsn string) string {
+	dsn = strings.TrimPrefix(dsn, "file:")
+	if i := strings.IndexByte(dsn, '?'); i >= 0 {
+		dsn = dsn[:i]
+	}
+	return dsn
+}
+
+// fileSize returns the size of a file, or 0 if it does not exist
+func fileSize(path string) int64 {
+	info, err := os.Stat(path)
+	if err != nil {
+		return 0
+	}
+	return info.Size()
+}
@@ -0,0 +1,51 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+
+	"project-root/pkg/api"
+	"project-root/pkg/logging"
+	"project-root/pkg/services"
+)
+
+// HandleLogLevel returns a handler that reports or changes the log level at runtime.
+// @Summary Get or change the log level
+// @Description Reports the current log level (GET) or changes it (PUT). Only available to admins.
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param body body api.LogLevel false "New log level: debug, info, warn or error"
+// @Success 200 {object} api.Response{payload=api.LogLevel} "Log level"
+// @Failure 400 {object} api.Response{error=api.ErrorDetails} "Invalid log level"
+// @Failure 403 {object} api.Response{error=api.ErrorDetails} "Forbidden"
+// @Router /admin/log-level [get]
+// @Router /admin/log-level [put]
+func (h *Handler) HandleLogLevel(levelVar *slog.LevelVar) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, authenticated := h.auth.AuthenticateSession(r)
+		if !h.settings.Security.IsAdmin(user) {
+			services.HTTPError(w, http.StatusForbidden, "Forbidden", "Admin access required", authenticated, user, nil)
+			return
+		}
+
+		if r.Method == http.MethodPut {
+			var levelForm api.LogLevel
+			if err := json.NewDecoder(r.Body).Decode(&levelForm); err != nil {
+				services.HTTPError(w, http.StatusBadRequest, "Bad Request", "Invalid request payload", authenticated, user, nil)
+				return
+			}
+			level, err := logging.ParseLevel(levelForm.Level)
+			if err != nil {
+				services.HTTPError(w, http.StatusBadRequest, "Bad Request", "Unknown log level", authenticated, user, nil)
+				return
+			}
+			levelVar.Set(level)
+			logging.FromContext(r.Context()).Info("log level changed", "level", level.String(), "user_id", user.ID)
+		}
+
+		payload := api.LogLevel{Level: levelVar.Level().String()}
+		services.RespondWithSuccess(w, http.StatusOK, "Log level", authenticated, payload, nil, user)
+	}
+}
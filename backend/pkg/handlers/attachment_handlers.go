@@ -0,0 +1,293 @@
+package handlers
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"project-root/pkg/api"
+	"project-root/pkg/attachments"
+	"project-root/pkg/logging"
+	"project-root/pkg/repositories"
+	"project-root/pkg/services"
+)
+
+const (
+	// multipartOverhead is allowed on top of the largest file for the
+	// boundaries and headers of the multipart body
+	multipartOverhead = 64 << 10
+	// fileNameMaxLength is the longest stored file name in bytes
+	fileNameMaxLength = 255
+)
+
+// HandleUploadAttachment stores an uploaded file for a later post, comment or chat message.
+// @Summary Upload an attachment
+// @Description Uploads a file as multipart/form-data in the field "file". The type is sniffed from the content and must be allowed. Images are stripped of their EXIF and text metadata and get a thumbnail. The upload stays private until its ID is passed in attachment_ids when creating a post, a comment or a chat message.
+// @Tags attachments
+// @Accept mpfd
+// @Produce json
+// @Security BearerAuth
+// @Param file formData file true "File to upload"
+// @Success 201 {object} api.Response{payload=api.AttachmentResponse} "Attachment uploaded successfully"
+// @Failure 400 {object} api.Response{error=api.ErrorDetails} "Invalid upload"
+// @Failure 401 {object} api.Response{error=api.ErrorDetails} "Unauthorized"
+// @Failure 413 {object} api.Response{error=api.ErrorDetails} "File too large"
+// @Failure 415 {object} api.Response{error=api.ErrorDetails} "File type not allowed"
+// @Router /attachments [post]
+func (h *Handler) HandleUploadAttachment(w http.ResponseWriter, r *http.Request) {
+	user, authenticated := h.auth.AuthorizeUser(r, services.ScopeAttachmentsWrite)
+	if !authenticated {
+		services.HTTPError(w, http.StatusUnauthorized, "Unauthorized", "User is not authenticated", false, nil, nil)
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, int64(h.uploads.MaxSize)+multipartOverhead)
+	data, fileName, err := readUpload(r, h.uploads.MaxSize)
+	var maxBytesErr *http.MaxBytesError
+	if errors.Is(err, attachments.ErrTooLarge) || errors.As(err, &maxBytesErr) {
+		services.HTTPError(w, http.StatusRequestEntityTooLarge, "Request Entity Too Large", "File too large", authenticated, user, nil)
+		return
+	}
+	if err != nil {
+		services.HTTPError(w, http.StatusBadRequest, "Bad Request", "Invalid upload", authenticated, user, nil)
+		return
+	}
+
+	file, err := attachments.Process(data, h.uploads)
+	switch {
+	case errors.Is(err, attachments.ErrTooLarge):
+		services.HTTPError(w, http.StatusRequestEntityTooLarge, "Request Entity Too Large", "File too large", authenticated, user, nil)
+		return
+	case errors.Is(err, attachments.ErrTypeNotAllowed):
+		services.HTTPError(w, http.StatusUnsupportedMediaType, "Unsupported Media Type", "File type not allowed", authenticated, user, nil)
+		return
+	case errors.Is(err, attachments.ErrImageTooLarge):
+		services.HTTPError(w, http.StatusBadRequest, "Bad Request", "Image dimensions too large", authenticated, user, nil)
+		return
+	case errors.Is(err, attachments.ErrInvalidImage):
+		services.HTTPError(w, http.StatusBadRequest, "Bad Request", "Invalid image", authenticated, user, nil)
+		return
+	case err != nil:
+		logging.FromContext(r.Context()).Error("Error processing upload", "error", err)
+		services.HTTPError(w, http.StatusInternalServerError, "Internal Server Error", "Error processing upload", authenticated, user, nil)
+		return
+	}
+
+	attachment := api.Attachment{
+		UserID:    user.ID,
+		FileName:  fileName,
+		MimeType:  file.MimeType,
+		Size:      len(file.Data),
+		Width:     file.Width,
+		Height:    file.Height,
+		CreatedAt: h.clock.Now(),
+	}
+	if err := h.storeBlobs(&attachment, file); err != nil {
+		logging.FromContext(r.Context()).Error("Error storing upload", "error", err)
+		services.HTTPError(w, http.StatusInternalServerError, "Internal Server Error", "Error storing upload", authenticated, user, nil)
+		return
+	}
+	if err := h.stores.Attachments.Create(&attachment); err != nil {
+		h.deleteBlobs(r, &attachment)
+		logging.FromContext(r.Context()).Error("Error creating attachment", "error", err)
+		services.HTTPError(w, http.StatusInternalServerError, "Internal Server Error", "Error creating attachment", authenticated, user, nil)
+		return
+	}
+
+	services.RespondWithSuccess(w, http.StatusCreated, "Attachment uploaded successfully", authenticated, api.AttachmentResponse{Attachment: attachment}, nil, user)
+}
+
+// HandleGetAttachment serves an attachment or, under /thumbnail, its thumbnail.
+// @Summary Download an attachment
+// @Description Serves the file of an attachment, or its JPEG thumbnail under /thumbnail. Attachments of posts and comments are public, those of chat messages are served only to the members of the chat and unlinked uploads only to their uploader.
+// @Tags attachments
+// @Produce octet-stream
+// @Param attachmentId path integer true "Attachment ID"
+// @Success 200 {file} file "The file"
+// @Failure 400 {object} api.Response{error=api.ErrorDetails} "Invalid attachment ID"
+// @Failure 404 {object} api.Response{error=api.ErrorDetails} "Attachment not found"
+// @Router /attachments/{attachmentId} [get]
+// @Router /attachments/{attachmentId}/thumbnail [get]
+func (h *Handler) HandleGetAttachment(w http.ResponseWriter, r *http.Request) {
+	params := services.GetRouteParams(r)
+	attachmentID, err := strconv.Atoi(params["attachmentId"])
+	if err != nil {
+		services.HTTPError(w, http.StatusBadRequest, "Bad Request", "Invalid attachment ID", false, nil, nil)
+		return
+	}
+
+	attachment, err := h.stores.Attachments.GetAttachment(attachmentID)
+	if errors.Is(err, repositories.ErrAttachmentNotFound) {
+		services.HTTPError(w, http.StatusNotFound, "Not Found", "Attachment not found", false, nil, nil)
+		return
+	}
+	if err != nil {
+		logging.FromContext(r.Context()).Error("Error fetching attachment", "attachment_id", attachmentID, "error", err)
+		services.HTTPError(w, http.StatusInternalServerError, "Internal Server Error", "Error fetching attachment", false, nil, nil)
+		return
+	}
+
+	public, allowed, err := h.attachmentAccess(r, attachment)
+	if err != nil {
+		logging.FromContext(r.Context()).Error("Error checking chat access", "attachment_id", attachmentID, "error", err)
+		services.HTTPError(w, http.StatusInternalServerError, "Internal Server Error", "Error checking access", false, nil, nil)
+		return
+	}
+	// Hide attachments from those who may not see them
+	if !allowed {
+		services.HTTPError(w, http.StatusNotFound, "Not Found", "Attachment not found", false, nil, nil)
+		return
+	}
+
+	key, contentType, disposition := attachment.BlobKey, attachment.MimeType, "inline"
+	if params["thumbnail"] != "" {
+		if attachment.ThumbnailKey == "" {
+			services.HTTPError(w, http.StatusNotFound, "Not Found", "Thumbnail not found", false, nil, nil)
+			return
+		}
+		key, contentType = attachment.ThumbnailKey, "image/jpeg"
+	} else if !attachments.IsImage(attachment.MimeType) {
+		disposition = "attachment"
+	}
+
+	blob, err := h.blobs.Open(key)
+	if err != nil {
+		logging.FromContext(r.Context()).Error("Error opening attachment", "attachment_id", attachmentID, "error", err)
+		services.HTTPError(w, http.StatusInternalServerError, "Internal Server Error", "Error opening attachment", false, nil, nil)
+		return
+	}
+	defer blob.Close()
+
+	// The content was checked on upload, but never let browsers run it
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Content-Security-Policy", "default-src 'none'; sandbox")
+	if d := mime.FormatMediaType(disposition, map[string]string{"filename": attachment.FileName}); d != "" {
+		w.Header().Set("Content-Disposition", d)
+	} else {
+		w.Header().Set("Content-Disposition", disposition)
+	}
+	if public {
+		w.Header().Set("Cache-Control", "public, max-age=86400")
+	} else {
+		w.Header().Set("Cache-Control", "private, no-cache")
+	}
+	http.ServeContent(w, r, "", attachment.CreatedAt, blob)
+}
+
+// attachmentAccess reports whether anyone may download an attachment and
+// whether the requester may. Attachments of posts and comments are public,
+// those of chat messages are for the members of the chat and unlinked
+// uploads are for their uploader.
+func (h *Handler) attachmentAccess(r *http.Request, a *api.Attachment) (public, allowed bool, err error) {
+	switch {
+	case a.ChatHash != "":
+		user, authenticated := h.auth.AuthorizeUser(r, services.ScopeChatsRead)
+		if !authenticated {
+			return false, false, nil
+		}
+		allowed, err := h.stores.Chats.CheckChatAccess(user.ID, a.ChatHash)
+		if errors.Is(err, repositories.ErrChatNotFound) {
+			return false, false, nil
+		}
+		return false, allowed, err
+	case a.PostID == 0 && a.CommentID == 0:
+		user, authenticated := h.auth.AuthorizeUser(r, services.ScopeAttachmentsRead)
+		return false, authenticated && user.ID == a.UserID, nil
+	}
+	return true, true, nil
+}
+
+// storeBlobs puts the file and its thumbnail into the blob store and sets their keys
+func (h *Handler) storeBlobs(a *api.Attachment, file *attachments.File) error {
+	key, err := attachments.NewKey()
+	if err != nil {
+		return err
+	}
+	if err := h.blobs.Put(key, bytes.NewReader(file.Data)); err != nil {
+		return err
+	}
+	a.BlobKey = key
+
+	if file.Thumbnail == nil {
+		return nil
+	}
+	if key, err = attachments.NewKey(); err != nil {
+		h.blobs.Delete(a.BlobKey)
+		return err
+	}
+	if err := h.blobs.Put(key, bytes.NewReader(file.Thumbnail)); err != nil {
+		h.blobs.Delete(a.BlobKey)
+		return err
+	}
+	a.ThumbnailKey = key
+	return nil
+}
+
+// deleteBlobs removes the file and thumbnail of an attachment that could not be recorded
+func (h *Handler) deleteBlobs(r *http.Request, a *api.Attachment) {
+	for _, key := range []string{a.BlobKey, a.ThumbnailKey} {
+		if key == "" {
+			continue
+		}
+		if err := h.blobs.Delete(key); err != nil {
+			logging.FromContext(r.Context()).Warn("Error deleting blob", "key", key, "error", err)
+		}
+	}
+}
+
+// readUpload reads the "file" part of a multipart request and returns its
+// contents, at most maxSize bytes, and its cleaned file name
+func readUpload(r *http.Request, maxSize int) ([]byte, string, error) {
+	reader, err := r.MultipartReader()
+	if err != nil {
+		return nil, "", err
+	}
+	for {
+		part, err := reader.NextPart()
+		if err != nil {
+			return nil, "", err
+		}
+		if part.FormName() != "file" {
+			part.Close()
+			continue
+		}
+		defer part.Close()
+
+		data, err := io.ReadAll(io.LimitReader(part, int64(maxSize)+1))
+		if err != nil {
+			return nil, "", err
+		}
+		if len(data) > maxSize {
+			return nil, "", attachments.ErrTooLarge
+		}
+		return data, cleanFileName(part.FileName()), nil
+	}
+}
+
+// cleanFileName keeps the last element of a client supplied path without
+// control characters, shortened to fileNameMaxLength bytes
+func cleanFileName(name string) string {
+	name = path.Base(strings.ReplaceAll(name, `\`, "/"))
+	name = strings.TrimSpace(strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			return -1
+		}
+		return r
+	}, name))
+	for len(name) > fileNameMaxLength {
+		_, size := utf8.DecodeLastRuneInString(name)
+		name = name[:len(name)-size]
+	}
+	if name == "" || name == "." || name == "/" {
+		return "file"
+	}
+	return name
+}
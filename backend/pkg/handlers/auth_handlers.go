@@ -2,12 +2,11 @@ package handlers
 
 import (
 	"encoding/json"
-	"log"
 	"net/http"
-	"time"
 
 	"project-root/pkg/api"
-	"project-root/pkg/repositories"
+	"project-root/pkg/logging"
+	"project-root/pkg/metrics"
 	"project-root/pkg/services"
 
 	"github.com/google/uuid"
@@ -25,7 +24,7 @@ import (
 // @Failure 400 {object} api.Response "Invalid request payload"
 // @Failure 409 {object} api.Response "User already registered"
 // @Router /auth/register [post]
-func HandleRegister(w http.ResponseWriter, r *http.Request) {
+func (h *Handler) HandleRegister(w http.ResponseWriter, r *http.Request) {
 	authenticated := false
 	var registrForm api.RegistrationRequest
 	if err := json.NewDecoder(r.Body).Decode(&registrForm); err != nil {
@@ -34,7 +33,7 @@ func HandleRegister(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Validate fields before proceeding
-	validationErrors := services.ValidateOperation("registration", registrForm)
+	validationErrors := h.settings.Validator.ValidateOperation("registration", registrForm)
 	if len(validationErrors) > 0 {
 		// Handle the HTTP error response
 		services.HTTPError(w, http.StatusBadRequest, "Validation error", "Validation error", authenticated, nil, validationErrors)
@@ -43,46 +42,46 @@ func HandleRegister(w http.ResponseWriter, r *http.Request) {
 
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(registrForm.Password), bcrypt.DefaultCost)
 	if err != nil {
-		log.Println("Error hashing password:", err)
+		logging.FromContext(r.Context()).Error("Error hashing password", "error", err)
 		services.HTTPError(w, http.StatusInternalServerError, "Internal server error", "Error hashing password", authenticated, nil, nil)
 		return
 	}
 	registrForm.Password = string(hashedPassword)
-	registrForm.CreatedAt = time.Now()
+	now := h.clock.Now()
+	registrForm.CreatedAt = now
 
 	// Create the user and get the UserResponse
-	userResponse, err := repositories.CreateUser(&registrForm)
+	userResponse, err := h.stores.Users.CreateUser(&registrForm)
 	if err != nil {
-		log.Println("Error creating user:", err)
+		logging.FromContext(r.Context()).Error("Error creating user", "error", err)
 		services.HTTPError(w, http.StatusConflict, "User already registered", "Error creating user", authenticated, nil, nil)
 		return
 	}
 
 	sessionID := uuid.New().String()
-	expiresAt := time.Now().Add(24 * time.Hour)
+	expiresAt := now.Add(h.settings.Session.Lifetime)
 
 	session := api.Session{
 		UserID:    userResponse.ID,
 		SessionID: sessionID,
-		CreatedAt: time.Now(),
+		CreatedAt: now,
 		ExpiresAt: expiresAt,
 	}
 
-	if err := repositories.CreateSession(&session); err != nil {
-		log.Println("Error creating session for new user:", err)
+	if err := h.stores.Sessions.CreateSession(&session); err != nil {
+		logging.FromContext(r.Context()).Error("Error creating session for new user", "error", err)
 		services.HTTPError(w, http.StatusInternalServerError, "Internal server error", "Error creating session", authenticated, nil, nil)
 		return
 	}
 
-	http.SetCookie(w, &http.Cookie{
-		Name:     "session_token",
-		Value:    sessionID,
-		Expires:  expiresAt,
-		HttpOnly: true,
-		Path:     "/",
-	})
+	h.settings.Security.SetSessionCookie(w, sessionID, expiresAt)
+	if _, err := h.settings.Security.IssueCSRFToken(w); err != nil {
+		logging.FromContext(r.Context()).Error("Error issuing CSRF token", "error", err)
+	}
 
 	authenticated = true
+	metrics.UsersRegistered.Inc()
+	h.events.Wake()
 
 	// Respond with success
 	services.RespondWithSuccess(w, http.StatusOK, "User registered successfully", authenticated, nil, nil, userResponse)
@@ -99,7 +98,7 @@ func HandleRegister(w http.ResponseWriter, r *http.Request) {
 // @Failure 400 {object} api.Response "Invalid request payload"
 // @Failure 401 {object} api.Response "Invalid email or password"
 // @Router /auth/login [post]
-func HandleLogin(w http.ResponseWriter, r *http.Request) {
+func (h *Handler) HandleLogin(w http.ResponseWriter, r *http.Request) {
 	authenticated := false
 	var loginForm api.LoginRequest
 	if err := json.NewDecoder(r.Body).Decode(&loginForm); err != nil {
@@ -107,44 +106,45 @@ func HandleLogin(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	storedUser, userResponse, err := repositories.ChekUserByEmail(loginForm.Email)
+	storedUser, userResponse, err := h.stores.Users.ChekUserByEmail(loginForm.Email)
 	if err != nil {
-		log.Println("User not found:", err)
+		logging.FromContext(r.Context()).Warn("User not found", "error", err)
+		metrics.Logins.Inc("failure")
 		services.HTTPError(w, http.StatusUnauthorized, "Invalid email or password", "User not found", authenticated, nil, nil)
 		return
 	}
 
 	if err := bcrypt.CompareHashAndPassword([]byte(storedUser.Password), []byte(loginForm.Password)); err != nil {
-		log.Println("Invalid password for user:", loginForm.Email)
+		logging.FromContext(r.Context()).Warn("Invalid password", "user_id", userResponse.ID)
+		metrics.Logins.Inc("failure")
 		services.HTTPError(w, http.StatusUnauthorized, "Invalid email or password", "Invalid password", authenticated, nil, nil)
 		return
 	}
 
+	now := h.clock.Now()
 	sessionID := uuid.New().String()
-	expiresAt := time.Now().Add(24 * time.Hour)
+	expiresAt := now.Add(h.settings.Session.Lifetime)
 
 	session := api.Session{
 		UserID:    userResponse.ID,
 		SessionID: sessionID,
-		CreatedAt: time.Now(),
+		CreatedAt: now,
 		ExpiresAt: expiresAt,
 	}
 
-	if err := repositories.CreateSession(&session); err != nil {
-		log.Println("Error creating session:", err)
+	if err := h.stores.Sessions.CreateSession(&session); err != nil {
+		logging.FromContext(r.Context()).Error("Error creating session", "error", err)
 		services.HTTPError(w, http.StatusInternalServerError, "Internal server error", "Error creating session", authenticated, nil, nil)
 		return
 	}
 
-	http.SetCookie(w, &http.Cookie{
-		Name:     "session_token",
-		Value:    sessionID,
-		Expires:  expiresAt,
-		HttpOnly: true,
-		Path:     "/",
-	})
+	h.settings.Security.SetSessionCookie(w, sessionID, expiresAt)
+	if _, err := h.settings.Security.IssueCSRFToken(w); err != nil {
+		logging.FromContext(r.Context()).Error("Error issuing CSRF token", "error", err)
+	}
 
 	authenticated = true
+	metrics.Logins.Inc("success")
 	services.RespondWithSuccess(w, http.StatusOK, "User logged in successfully", authenticated, nil, nil, userResponse)
 }
 
@@ -158,9 +158,9 @@ func HandleLogin(w http.ResponseWriter, r *http.Request) {
 // @Success 200 {object} api.Response "User logged out successfully"
 // @Failure 401 {object} api.Response "Missing session ID"
 // @Router /auth/logout [delete]
-func HandleLogout(w http.ResponseWriter, r *http.Request) {
+func (h *Handler) HandleLogout(w http.ResponseWriter, r *http.Request) {
 	authenticated := true
-	cookie, err := r.Cookie("session_token")
+	cookie, err := r.Cookie(services.SessionCookieName)
 	if err != nil {
 		if err == http.ErrNoCookie {
 			services.HTTPError(w, http.StatusUnauthorized, "Missing session ID", "Missing session ID", authenticated, nil, nil)
@@ -171,19 +171,13 @@ func HandleLogout(w http.ResponseWriter, r *http.Request) {
 	}
 	sessionID := cookie.Value
 
-	if err := repositories.DeleteSession(sessionID); err != nil {
-		log.Println("Error deleting session:", err)
+	if err := h.stores.Sessions.DeleteSession(sessionID); err != nil {
+		logging.FromContext(r.Context()).Error("Error deleting session", "error", err)
 		services.HTTPError(w, http.StatusInternalServerError, "Internal server error", "Error deleting session", authenticated, nil, nil)
 		return
 	}
 
-	http.SetCookie(w, &http.Cookie{
-		Name:     "session_token",
-		Value:    "",
-		Expires:  time.Now().Add(-1 * time.Hour),
-		HttpOnly: true,
-		Path:     "/",
-	})
+	h.settings.Security.ClearSessionCookie(w)
 
 	authenticated = false
 	services.RespondWithSuccess(w, http.StatusOK, "User logged out successfully", authenticated, nil, nil, nil)
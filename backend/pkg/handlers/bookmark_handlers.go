@@ -0,0 +1,339 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"project-root/pkg/api"
+	"project-root/pkg/logging"
+	"project-root/pkg/repositories"
+	"project-root/pkg/services"
+)
+
+// HandleGetCollections lists the bookmark collections of the current user.
+// @Summary List bookmark collections
+// @Description Lists the private bookmark collections of the authenticated user with their item counts.
+// @Tags bookmarks
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} api.Response{payload=api.BookmarkCollectionsResponse} "Collections fetched successfully"
+// @Failure 401 {object} api.Response{error=api.ErrorDetails} "Unauthorized"
+// @Router /bookmarks/collections [get]
+func (h *Handler) HandleGetCollections(w http.ResponseWriter, r *http.Request) {
+	user, authenticated := h.auth.AuthorizeUser(r, services.ScopeBookmarksRead)
+	if !authenticated {
+		services.HTTPError(w, http.StatusUnauthorized, "Unauthorized", "User is not authenticated", false, nil, nil)
+		return
+	}
+
+	collections, err := h.stores.Bookmarks.GetCollections(user.ID)
+	if err != nil {
+		logging.FromContext(r.Context()).Error("Error fetching collections", "error", err)
+		services.HTTPError(w, http.StatusInternalServerError, "Internal Server Error", "Error fetching collections", authenticated, user, nil)
+		return
+	}
+
+	services.RespondWithSuccess(w, http.StatusOK, "Collections fetched successfully", authenticated, api.BookmarkCollectionsResponse{Collections: collections}, nil, user)
+}
+
+// HandleCreateCollection creates a bookmark collection.
+// @Summary Create a bookmark collection
+// @Description Creates an empty, private bookmark collection. Names are unique per user.
+// @Tags bookmarks
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param body body api.BookmarkCollectionRequest true "Collection data"
+// @Success 201 {object} api.Response{payload=api.BookmarkCollection} "Collection created successfully"
+// @Failure 400 {object} api.Response{error=api.ErrorDetails} "Invalid request payload"
+// @Failure 401 {object} api.Response{error=api.ErrorDetails} "Unauthorized"
+// @Failure 409 {object} api.Response{error=api.ErrorDetails} "Collection already exists"
+// @Router /bookmarks/collections [post]
+func (h *Handler) HandleCreateCollection(w http.ResponseWriter, r *http.Request) {
+	user, authenticated := h.auth.AuthorizeUser(r, services.ScopeBookmarksWrite)
+	if !authenticated {
+		services.HTTPError(w, http.StatusUnauthorized, "Unauthorized", "User is not authenticated", false, nil, nil)
+		return
+	}
+
+	var collectionForm api.BookmarkCollectionRequest
+	if err := json.NewDecoder(r.Body).Decode(&collectionForm); err != nil {
+		services.HTTPError(w, http.StatusBadRequest, "Bad Request", "Invalid request payload", authenticated, user, nil)
+		return
+	}
+	collectionForm.Name = strings.TrimSpace(collectionForm.Name)
+
+	validationErrors := h.settings.Validator.ValidateOperation("collection", collectionForm)
+	if len(validationErrors) > 0 {
+		services.HTTPError(w, http.StatusBadRequest, "Validation error", "Validation error", authenticated, user, validationErrors)
+		return
+	}
+
+	collection, err := h.stores.Bookmarks.CreateCollection(user.ID, collectionForm.Name)
+	if errors.Is(err, repositories.ErrCollectionExists) {
+		services.HTTPError(w, http.StatusConflict, "Conflict", "Collection already exists", authenticated, user, nil)
+		return
+	}
+	if err != nil {
+		logging.FromContext(r.Context()).Error("Error creating collection", "error", err)
+		services.HTTPError(w, http.StatusInternalServerError, "Internal Server Error", "Error creating collection", authenticated, user, nil)
+		return
+	}
+
+	services.RespondWithSuccess(w, http.StatusCreated, "Collection created successfully", authenticated, collection, nil, user)
+}
+
+// HandleDeleteCollection deletes a bookmark collection.
+// @Summary Delete a bookmark collection
+// @Description Deletes a collection of the authenticated user together with its bookmarks.
+// @Tags bookmarks
+// @Produce json
+// @Security BearerAuth
+// @Param collectionId path integer true "Collection ID"
+// @Success 200 {object} api.Response "Collection deleted successfully"
+// @Failure 401 {object} api.Response{error=api.ErrorDetails} "Unauthorized"
+// @Failure 404 {object} api.Response{error=api.ErrorDetails} "Collection not found"
+// @Router /bookmarks/collections/{collectionId} [delete]
+func (h *Handler) HandleDeleteCollection(w http.ResponseWriter, r *http.Request) {
+	user, authenticated := h.auth.AuthorizeUser(r, services.ScopeBookmarksWrite)
+	if !authenticated {
+		services.HTTPError(w, http.StatusUnauthorized, "Unauthorized", "User is not authenticated", false, nil, nil)
+		return
+	}
+
+	params := services.GetRouteParams(r)
+	collectionID, _ := strconv.Atoi(params["collectionId"])
+
+	err := h.stores.Bookmarks.DeleteCollection(user.ID, collectionID)
+	if errors.Is(err, repositories.ErrCollectionNotFound) {
+		services.HTTPError(w, http.StatusNotFound, "Not Found", "Collection not found", authenticated, user, nil)
+		return
+	}
+	if err != nil {
+		logging.FromContext(r.Context()).Error("Error deleting collection", "collection_id", collectionID, "error", err)
+		services.HTTPError(w, http.StatusInternalServerError, "Internal Server Error", "Error deleting collection", authenticated, user, nil)
+		return
+	}
+
+	services.RespondWithSuccess(w, http.StatusOK, "Collection deleted successfully", authenticated, nil, nil, user)
+}
+
+// HandleGetBookmarks lists the bookmarks of a collection.
+// @Summary List saved items
+// @Description Lists the posts and comments saved in a collection of the authenticated user, in their saved order.
+// @Tags bookmarks
+// @Produce json
+// @Security BearerAuth
+// @Param collectionId path integer true "Collection ID"
+// @Param pageSize query integer false "Number of items per page (default: 20)"
+// @Param page query integer false "Page number (default: 1)"
+// @Success 200 {object} api.Response{payload=api.BookmarksResponse, pagination=api.GeneralPagination} "Bookmarks fetched successfully"
+// @Failure 401 {object} api.Response{error=api.ErrorDetails} "Unauthorized"
+// @Failure 404 {object} api.Response{error=api.ErrorDetails} "Collection or page not found"
+// @Router /bookmarks/collections/{collectionId}/items [get]
+func (h *Handler) HandleGetBookmarks(w http.ResponseWriter, r *http.Request) {
+	user, authenticated := h.auth.AuthorizeUser(r, services.ScopeBookmarksRead)
+	if !authenticated {
+		services.HTTPError(w, http.StatusUnauthorized, "Unauthorized", "User is not authenticated", false, nil, nil)
+		return
+	}
+
+	params := services.GetRouteParams(r)
+	collectionID, _ := strconv.Atoi(params["collectionId"])
+	// Bookmarks keep the order their owner gave them, so only the page is taken from the request
+	_, _, page, pageSize := h.paginationParams(r, "new", "bookmarks")
+
+	bookmarks, totalItems, totalPages, err := h.stores.Bookmarks.GetBookmarks(user.ID, collectionID, page, pageSize)
+	if errors.Is(err, repositories.ErrCollectionNotFound) {
+		services.HTTPError(w, http.StatusNotFound, "Not Found", "Collection not found", authenticated, user, nil)
+		return
+	}
+	if err != nil {
+		logging.FromContext(r.Context()).Error("Error fetching bookmarks", "collection_id", collectionID, "error", err)
+		services.HTTPError(w, http.StatusInternalServerError, "Internal Server Error", "Error fetching bookmarks", authenticated, user, nil)
+		return
+	}
+	if page > totalPages && totalItems > 0 {
+		services.HTTPError(w, http.StatusNotFound, "Not Found", "Page not found", authenticated, user, nil)
+		return
+	}
+
+	pagination := &api.GeneralPagination{
+		CurrentPage: page,
+		PerPage:     pageSize,
+		TotalCount:  totalItems,
+		TotalPages:  totalPages,
+		OrderBy:     "position",
+	}
+	services.RespondWithSuccess(w, http.StatusOK, "Bookmarks fetched successfully", authenticated, api.BookmarksResponse{Bookmarks: bookmarks}, pagination, user)
+}
+
+// HandleAddBookmark saves a post or comment in a collection.
+// @Summary Save a post or comment
+// @Description Appends a post, or a comment when comment_id is set, to the end of a collection of the authenticated user.
+// @Tags bookmarks
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param collectionId path integer true "Collection ID"
+// @Param body body api.BookmarkRequest true "Saved item"
+// @Success 201 {object} api.Response{payload=api.PostCreateResponse} "Bookmark added successfully"
+// @Failure 400 {object} api.Response{error=api.ErrorDetails} "Invalid request payload"
+// @Failure 401 {object} api.Response{error=api.ErrorDetails} "Unauthorized"
+// @Failure 404 {object} api.Response{error=api.ErrorDetails} "Collection, post or comment not found"
+// @Failure 409 {object} api.Response{error=api.ErrorDetails} "Already saved in the collection"
+// @Router /bookmarks/collections/{collectionId}/items [post]
+func (h *Handler) HandleAddBookmark(w http.ResponseWriter, r *http.Request) {
+	user, authenticated := h.auth.AuthorizeUser(r, services.ScopeBookmarksWrite)
+	if !authenticated {
+		services.HTTPError(w, http.StatusUnauthorized, "Unauthorized", "User is not authenticated", false, nil, nil)
+		return
+	}
+
+	params := services.GetRouteParams(r)
+	collectionID, _ := strconv.Atoi(params["collectionId"])
+
+	var bookmarkForm api.BookmarkRequest
+	if err := json.NewDecoder(r.Body).Decode(&bookmarkForm); err != nil {
+		services.HTTPError(w, http.StatusBadRequest, "Bad Request", "Invalid request payload", authenticated, user, nil)
+		return
+	}
+
+	validationErrors := h.settings.Validator.ValidateOperation("bookmark", bookmarkForm)
+	if len(validationErrors) > 0 {
+		services.HTTPError(w, http.StatusBadRequest, "Validation error", "Validation error", authenticated, user, validationErrors)
+		return
+	}
+
+	id, err := h.stores.Bookmarks.AddBookmark(user.ID, collectionID, bookmarkForm)
+	switch {
+	case errors.Is(err, repositories.ErrCollectionNotFound):
+		services.HTTPError(w, http.StatusNotFound, "Not Found", "Collection not found", authenticated, user, nil)
+		return
+	case errors.Is(err, repositories.ErrBookmarkTargetNotFound):
+		services.HTTPError(w, http.StatusNotFound, "Not Found", "Post or comment not found", authenticated, user, nil)
+		return
+	case errors.Is(err, repositories.ErrBookmarkExists):
+		services.HTTPError(w, http.StatusConflict, "Conflict", "Already saved in the collection", authenticated, user, nil)
+		return
+	case err != nil:
+		logging.FromContext(r.Context()).Error("Error adding bookmark", "collection_id", collectionID, "error", err)
+		services.HTTPError(w, http.StatusInternalServerError, "Internal Server Error", "Error adding bookmark", authenticated, user, nil)
+		return
+	}
+
+	services.RespondWithSuccess(w, http.StatusCreated, "Bookmark added successfully", authenticated, api.PostCreateResponse{ID: id}, nil, user)
+}
+
+// HandleMoveBookmark reorders a collection.
+// @Summary Move a saved item
+// @Description Moves a bookmark to a 1-based position within its collection. Positions past the end move it last.
+// @Tags bookmarks
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param collectionId path integer true "Collection ID"
+// @Param bookmarkId path integer true "Bookmark ID"
+// @Param body body api.BookmarkMoveRequest true "New position"
+// @Success 200 {object} api.Response "Bookmark moved successfully"
+// @Failure 400 {object} api.Response{error=api.ErrorDetails} "Invalid request payload"
+// @Failure 401 {object} api.Response{error=api.ErrorDetails} "Unauthorized"
+// @Failure 404 {object} api.Response{error=api.ErrorDetails} "Collection or bookmark not found"
+// @Router /bookmarks/collections/{collectionId}/items/{bookmarkId} [put]
+func (h *Handler) HandleMoveBookmark(w http.ResponseWriter, r *http.Request) {
+	user, authenticated := h.auth.AuthorizeUser(r, services.ScopeBookmarksWrite)
+	if !authenticated {
+		services.HTTPError(w, http.StatusUnauthorized, "Unauthorized", "User is not authenticated", false, nil, nil)
+		return
+	}
+
+	params := services.GetRouteParams(r)
+	collectionID, _ := strconv.Atoi(params["collectionId"])
+	bookmarkID, _ := strconv.Atoi(params["bookmarkId"])
+
+	var moveForm api.BookmarkMoveRequest
+	if err := json.NewDecoder(r.Body).Decode(&moveForm); err != nil {
+		services.HTTPError(w, http.StatusBadRequest, "Bad Request", "Invalid request payload", authenticated, user, nil)
+		return
+	}
+	if moveForm.Position <= 0 {
+		services.HTTPError(w, http.StatusBadRequest, "Validation error", "Validation error", authenticated, user,
+			[]api.ValidationError{{Field: "position", Message: "Position must be a positive number"}})
+		return
+	}
+
+	err := h.stores.Bookmarks.MoveBookmark(user.ID, collectionID, bookmarkID, moveForm.Position)
+	switch {
+	case errors.Is(err, repositories.ErrCollectionNotFound):
+		services.HTTPError(w, http.StatusNotFound, "Not Found", "Collection not found", authenticated, user, nil)
+		return
+	case errors.Is(err, repositories.ErrBookmarkNotFound):
+		services.HTTPError(w, http.StatusNotFound, "Not Found", "Bookmark not found", authenticated, user, nil)
+		return
+	case err != nil:
+		logging.FromContext(r.Context()).Error("Error moving bookmark", "bookmark_id", bookmarkID, "error", err)
+		services.HTTPError(w, http.StatusInternalServerError, "Internal Server Error", "Error moving bookmark", authenticated, user, nil)
+		return
+	}
+
+	services.RespondWithSuccess(w, http.StatusOK, "Bookmark moved successfully", authenticated, nil, nil, user)
+}
+
+// HandleRemoveBookmark removes a saved item from a collection.
+// @Summary Remove a saved item
+// @Description Removes a bookmark from a collection of the authenticated user.
+// @Tags bookmarks
+// @Produce json
+// @Security BearerAuth
+// @Param collectionId path integer true "Collection ID"
+// @Param bookmarkId path integer true "Bookmark ID"
+// @Success 200 {object} api.Response "Bookmark removed successfully"
+// @Failure 401 {object} api.Response{error=api.ErrorDetails} "Unauthorized"
+// @Failure 404 {object} api.Response{error=api.ErrorDetails} "Bookmark not found"
+// @Router /bookmarks/collections/{collectionId}/items/{bookmarkId} [delete]
+func (h *Handler) HandleRemoveBookmark(w http.ResponseWriter, r *http.Request) {
+	user, authenticated := h.auth.AuthorizeUser(r, services.ScopeBookmarksWrite)
+	if !authenticated {
+		services.HTTPError(w, http.StatusUnauthorized, "Unauthorized", "User is not authenticated", false, nil, nil)
+		return
+	}
+
+	params := services.GetRouteParams(r)
+	collectionID, _ := strconv.Atoi(params["collectionId"])
+	bookmarkID, _ := strconv.Atoi(params["bookmarkId"])
+
+	err := h.stores.Bookmarks.RemoveBookmark(user.ID, collectionID, bookmarkID)
+	if errors.Is(err, repositories.ErrBookmarkNotFound) {
+		services.HTTPError(w, http.StatusNotFound, "Not Found", "Bookmark not found", authenticated, user, nil)
+		return
+	}
+	if err != nil {
+		logging.FromContext(r.Context()).Error("Error removing bookmark", "bookmark_id", bookmarkID, "error", err)
+		services.HTTPError(w, http.StatusInternalServerError, "Internal Server Error", "Error removing bookmark", authenticated, user, nil)
+		return
+	}
+
+	services.RespondWithSuccess(w, http.StatusOK, "Bookmark removed successfully", authenticated, nil, nil, user)
+}
+
+// setPostBookmarks flags the posts that userID saved, with one query for the page
+func (h *Handler) setPostBookmarks(r *http.Request, posts []api.Post, userID int) {
+	if len(posts) == 0 || userID == 0 {
+		return
+	}
+	ids := make([]int, len(posts))
+	for i := range posts {
+		ids[i] = posts[i].ID
+	}
+	bookmarked, err := h.stores.Bookmarks.BookmarkedPosts(userID, ids)
+	if err != nil {
+		logging.FromContext(r.Context()).Warn("Error fetching bookmarks", "error", err)
+		return
+	}
+	for i := range posts {
+		posts[i].Bookmarked = bookmarked[posts[i].ID]
+	}
+}
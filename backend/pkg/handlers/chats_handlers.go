@@ -1,12 +1,12 @@
 package handlers
 
 import (
-	"log"
 	"net/http"
 
 	"encoding/json"
 	"github.com/gorilla/mux"
 	"project-root/pkg/api"
+	"project-root/pkg/logging"
 	"project-root/pkg/repositories"
 	"project-root/pkg/services"
 )
@@ -20,24 +20,24 @@ import (
 // @Security BearerAuth
 // @Success 200 {object} api.ChatsList "Successfully retrieved chats"
 // @Router /chats [get]
-func HandleGetChats(w http.ResponseWriter, r *http.Request) {
+func (h *Handler) HandleGetChats(w http.ResponseWriter, r *http.Request) {
 	authenticated := false
 	var user *api.UserResponse
 
 	// Authenticate the user
-	user, authenticated = services.AuthenticateUser(r)
+	user, authenticated = h.auth.AuthorizeUser(r, services.ScopeChatsRead)
 	if !authenticated {
 		services.HTTPError(w, http.StatusUnauthorized, "Unauthorized", "User not authenticated", false, nil, nil)
 		return
 	}
 
 	// Create a new Chat repository
-	chatRepo := repositories.NewChatRepository()
+	chatRepo := h.stores.Chats
 
 	// Get the user's chats
 	chats, err := chatRepo.GetChatsForUser(user.ID)
 	if err != nil {
-		log.Println("Error getting chats:", err)
+		logging.FromContext(r.Context()).Error("Error getting chats", "error", err)
 		services.HTTPError(w, http.StatusInternalServerError, "Internal Server Error", "Error retrieving chats", authenticated, user, nil)
 		return
 	}
@@ -61,12 +61,16 @@ func HandleGetChats(w http.ResponseWriter, r *http.Request) {
 // @Param chat body api.CreateChatMessage true "Chat creation details"
 // @Success 201 {object} api.ChatCreateResponse "Successfully created chat"
 // @Router /chats [post]
-func HandleCreateChat(w http.ResponseWriter, r *http.Request) {
+func (h *Handler) HandleCreateChat(w http.ResponseWriter, r *http.Request) {
 	authenticated := false
 	var user *api.UserResponse
 
 	// Authenticate the user
-	user, authenticated = services.AuthenticateUser(r)
+	user, authenticated = h.auth.AuthorizeUser(r, services.ScopeChatsWrite)
+	if !authenticated {
+		services.HTTPError(w, http.StatusUnauthorized, "Unauthorized", "User not authenticated", false, nil, nil)
+		return
+	}
 
 	// Parse the request body
 	var chat api.CreateChatMessage
@@ -76,15 +80,16 @@ func HandleCreateChat(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Create a new Chat repository
-	chatRepo := repositories.NewChatRepository()
+	chatRepo := h.stores.Chats
 
 	// Create the chat
 	chatHash, err := chatRepo.CreateChat(chat.User1ID, chat.User2ID)
 	if err != nil {
-		log.Println("Error creating chat:", err)
+		logging.FromContext(r.Context()).Error("Error creating chat", "error", err)
 		services.HTTPError(w, http.StatusInternalServerError, "Internal Server Error", "Error creating chat", authenticated, user, nil)
 		return
 	}
+	h.events.Wake()
 
 	// Prepare response payload
 	payload := api.ChatCreateResponse{
@@ -105,12 +110,12 @@ func HandleCreateChat(w http.ResponseWriter, r *http.Request) {
 // @Success 200 {object} api.Chat "Successfully retrieved chat details"
 // @Router /chats/{chatHash} [get]
 // HandleGetChat handles the request to get a specific chat by hash.
-func HandleGetChat(w http.ResponseWriter, r *http.Request) {
+func (h *Handler) HandleGetChat(w http.ResponseWriter, r *http.Request) {
 	authenticated := false
 	var user *api.UserResponse
 
 	// Authenticate the user
-	user, authenticated = services.AuthenticateUser(r)
+	user, authenticated = h.auth.AuthorizeUser(r, services.ScopeChatsRead)
 	if !authenticated {
 		services.HTTPError(w, http.StatusUnauthorized, "Unauthorized", "User not authenticated", false, nil, nil)
 		return
@@ -121,7 +126,7 @@ func HandleGetChat(w http.ResponseWriter, r *http.Request) {
 	chatHash := vars["chatHash"]
 
 	// Create a new Chat repository
-	chatRepo := repositories.NewChatRepository()
+	chatRepo := h.stores.Chats
 
 	// Check if the user has access to the chat and get chat details
 	chat, err := chatRepo.GetChatDetails(user.ID, chatHash)
@@ -134,8 +139,8 @@ func HandleGetChat(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	userID_1, _ := repositories.GetUserByID(chat.ChatInfo.User1ID)
-	userID_2, _ := repositories.GetUserByID(chat.ChatInfo.User2ID)
+	userID_1, _ := h.stores.Users.GetUserByID(chat.ChatInfo.User1ID)
+	userID_2, _ := h.stores.Users.GetUserByID(chat.ChatInfo.User2ID)
 
 	for i := 0; i < len(chat.Message); i++ {
 		if chat.Message[i].Sender.ID == chat.ChatInfo.User1ID {
@@ -145,6 +150,9 @@ func HandleGetChat(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	h.setMessageLinkPreviews(r, chat.Message)
+	h.setMessageReactions(r, chatHash, chat.Message, user.ID)
+
 	// Send the success response
 	services.RespondWithSuccess(w, http.StatusOK, "Chat retrieved successfully", authenticated, chat, nil, user)
 }
@@ -0,0 +1,230 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"project-root/pkg/api"
+	"project-root/pkg/logging"
+	"project-root/pkg/repositories"
+	"project-root/pkg/services"
+)
+
+// HandleGetDrafts lists the drafts of the user
+// @Summary List drafts
+// @Description Lists the unpublished posts of the authenticated user, most recently updated first.
+// @Tags drafts
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} api.Response{payload=api.DraftsResponse} "Drafts fetched successfully"
+// @Failure 401 {object} api.Response{error=api.ErrorDetails} "Unauthorized"
+// @Failure 500 {object} api.Response{error=api.ErrorDetails} "Internal server error"
+// @Router /drafts [get]
+func (h *Handler) HandleGetDrafts(w http.ResponseWriter, r *http.Request) {
+	user, authenticated := h.auth.AuthorizeUser(r, services.ScopePostsWrite)
+	if !authenticated {
+		services.HTTPError(w, http.StatusUnauthorized, "Unauthorized", "User is not authenticated", false, nil, nil)
+		return
+	}
+
+	drafts, err := h.stores.Drafts.GetDrafts(user.ID)
+	if err != nil {
+		logging.FromContext(r.Context()).Error("Error fetching drafts", "error", err)
+		services.HTTPError(w, http.StatusInternalServerError, "Internal Server Error", "Error fetching drafts", authenticated, user, nil)
+		return
+	}
+
+	services.RespondWithSuccess(w, http.StatusOK, "Drafts fetched successfully", authenticated, api.DraftsResponse{Drafts: drafts}, nil, user)
+}
+
+// HandleCreateDraft saves a new draft
+// @Summary Create a draft
+// @Description Saves an unpublished post. Drafts may be incomplete unless publish_at is set; a draft with publish_at must make a valid post and is published by the server once the time has come.
+// @Tags drafts
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param body body api.DraftRequest true "Draft"
+// @Success 201 {object} api.Response{payload=api.DraftResponse} "Draft created successfully"
+// @Failure 400 {object} api.Response{error=api.ErrorDetails} "Bad request"
+// @Failure 401 {object} api.Response{error=api.ErrorDetails} "Unauthorized"
+// @Failure 500 {object} api.Response{error=api.ErrorDetails} "Internal server error"
+// @Router /drafts [post]
+func (h *Handler) HandleCreateDraft(w http.ResponseWriter, r *http.Request) {
+	user, authenticated := h.auth.AuthorizeUser(r, services.ScopePostsWrite)
+	if !authenticated {
+		services.HTTPError(w, http.StatusUnauthorized, "Unauthorized", "User is not authenticated", false, nil, nil)
+		return
+	}
+
+	req, ok := h.decodeDraft(w, r, user)
+	if !ok {
+		return
+	}
+
+	draft, err := h.stores.Drafts.CreateDraft(user.ID, req, h.clock.Now())
+	if err != nil {
+		logging.FromContext(r.Context()).Error("Error creating draft", "error", err)
+		services.HTTPError(w, http.StatusInternalServerError, "Internal Server Error", "Error creating draft", authenticated, user, nil)
+		return
+	}
+
+	services.RespondWithSuccess(w, http.StatusCreated, "Draft created successfully", authenticated, api.DraftResponse{Draft: *draft}, nil, user)
+}
+
+// HandleDraft replaces (PUT) or deletes (DELETE) a draft of the user.
+// @Summary Update or delete a draft
+// @Description Replaces the draft with PUT, validated like on creation, and deletes it with DELETE, which takes no body. Clearing publish_at unschedules the draft.
+// @Tags drafts
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param draftId path integer true "Draft ID"
+// @Param body body api.DraftRequest false "Draft, PUT only"
+// @Success 200 {object} api.Response{payload=api.DraftResponse} "Draft updated successfully"
+// @Failure 400 {object} api.Response{error=api.ErrorDetails} "Bad request"
+// @Failure 401 {object} api.Response{error=api.ErrorDetails} "Unauthorized"
+// @Failure 404 {object} api.Response{error=api.ErrorDetails} "Draft not found"
+// @Failure 500 {object} api.Response{error=api.ErrorDetails} "Internal server error"
+// @Router /drafts/{draftId} [put]
+// @Router /drafts/{draftId} [delete]
+func (h *Handler) HandleDraft(w http.ResponseWriter, r *http.Request) {
+	user, authenticated := h.auth.AuthorizeUser(r, services.ScopePostsWrite)
+	if !authenticated {
+		services.HTTPError(w, http.StatusUnauthorized, "Unauthorized", "User is not authenticated", false, nil, nil)
+		return
+	}
+
+	draftID, err := strconv.Atoi(services.GetRouteParams(r)["draftId"])
+	if err != nil {
+		services.HTTPError(w, http.StatusBadRequest, "Bad Request", "Invalid draft ID", authenticated, user, nil)
+		return
+	}
+
+	if r.Method == http.MethodDelete {
+		err := h.stores.Drafts.DeleteDraft(user.ID, draftID)
+		if errors.Is(err, repositories.ErrDraftNotFound) {
+			services.HTTPError(w, http.StatusNotFound, "Not Found", "Draft not found", authenticated, user, nil)
+			return
+		}
+		if err != nil {
+			logging.FromContext(r.Context()).Error("Error deleting draft", "draft_id", draftID, "error", err)
+			services.HTTPError(w, http.StatusInternalServerError, "Internal Server Error", "Error deleting draft", authenticated, user, nil)
+			return
+		}
+		services.RespondWithSuccess(w, http.StatusOK, "Draft deleted successfully", authenticated, nil, nil, user)
+		return
+	}
+
+	req, ok := h.decodeDraft(w, r, user)
+	if !ok {
+		return
+	}
+
+	draft, err := h.stores.Drafts.UpdateDraft(user.ID, draftID, req, h.clock.Now())
+	if errors.Is(err, repositories.ErrDraftNotFound) {
+		services.HTTPError(w, http.StatusNotFound, "Not Found", "Draft not found", authenticated, user, nil)
+		return
+	}
+	if err != nil {
+		logging.FromContext(r.Context()).Error("Error updating draft", "draft_id", draftID, "error", err)
+		services.HTTPError(w, http.StatusInternalServerError, "Internal Server Error", "Error updating draft", authenticated, user, nil)
+		return
+	}
+
+	services.RespondWithSuccess(w, http.StatusOK, "Draft updated successfully", authenticated, api.DraftResponse{Draft: *draft}, nil, user)
+}
+
+// HandlePublishDraft publishes a draft of the user right away
+// @Summary Publish a draft
+// @Description Turns the draft into a post now, whether or not it is scheduled. The draft must make a valid post and is removed.
+// @Tags drafts
+// @Produce json
+// @Security BearerAuth
+// @Param draftId path integer true "Draft ID"
+// @Success 201 {object} api.Response{payload=api.PostCreateResponse} "Post created successfully"
+// @Failure 400 {object} api.Response{error=api.ErrorDetails} "Bad request"
+// @Failure 401 {object} api.Response{error=api.ErrorDetails} "Unauthorized"
+// @Failure 404 {object} api.Response{error=api.ErrorDetails} "Draft not found"
+// @Failure 500 {object} api.Response{error=api.ErrorDetails} "Internal server error"
+// @Router /drafts/{draftId}/publish [post]
+func (h *Handler) HandlePublishDraft(w http.ResponseWriter, r *http.Request) {
+	user, authenticated := h.auth.AuthorizeUser(r, services.ScopePostsWrite)
+	if !authenticated {
+		services.HTTPError(w, http.StatusUnauthorized, "Unauthorized", "User is not authenticated", false, nil, nil)
+		return
+	}
+
+	draftID, err := strconv.Atoi(services.GetRouteParams(r)["draftId"])
+	if err != nil {
+		services.HTTPError(w, http.StatusBadRequest, "Bad Request", "Invalid draft ID", authenticated, user, nil)
+		return
+	}
+
+	draft, err := h.stores.Drafts.GetDraft(user.ID, draftID)
+	if errors.Is(err, repositories.ErrDraftNotFound) {
+		services.HTTPError(w, http.StatusNotFound, "Not Found", "Draft not found", authenticated, user, nil)
+		return
+	}
+	if err != nil {
+		logging.FromContext(r.Context()).Error("Error fetching draft", "draft_id", draftID, "error", err)
+		services.HTTPError(w, http.StatusInternalServerError, "Internal Server Error", "Error fetching draft", authenticated, user, nil)
+		return
+	}
+	if validationErrors := h.settings.Validator.ValidateOperation("post", draft.PostCreateRequest()); len(validationErrors) > 0 {
+		services.HTTPError(w, http.StatusBadRequest, "Validation error", "Validation error", authenticated, user, validationErrors)
+		return
+	}
+
+	post, err := h.stores.Drafts.PublishDraft(user.ID, draftID, h.clock.Now())
+	switch {
+	case errors.Is(err, repositories.ErrDraftNotFound):
+		services.HTTPError(w, http.StatusNotFound, "Not Found", "Draft not found", authenticated, user, nil)
+		return
+	case errors.Is(err, repositories.ErrAttachmentNotFound):
+		services.HTTPError(w, http.StatusBadRequest, "Bad Request", "Unknown attachment", authenticated, user, nil)
+		return
+	case err != nil:
+		logging.FromContext(r.Context()).Error("Error publishing draft", "draft_id", draftID, "error", err)
+		services.HTTPError(w, http.StatusInternalServerError, "Internal Server Error", "Error publishing draft", authenticated, user, nil)
+		return
+	}
+
+	h.announcePost()
+	services.RespondWithSuccess(w, http.StatusCreated, "Post created successfully", authenticated, api.PostCreateResponse{ID: post.ID}, nil, user)
+}
+
+// AnnounceScheduledPost announces a post published from a scheduled draft
+// like one created through the API
+func (h *Handler) AnnounceScheduledPost(api.PostCreateRequest) {
+	h.announcePost()
+}
+
+// decodeDraft reads, normalizes and validates the draft in the request body
+// and reports whether it may be saved, answering the request otherwise
+func (h *Handler) decodeDraft(w http.ResponseWriter, r *http.Request, user *api.UserResponse) (api.DraftRequest, bool) {
+	var req api.DraftRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		services.HTTPError(w, http.StatusBadRequest, "Bad Request", "Invalid request payload", true, user, nil)
+		return req, false
+	}
+
+	req.Title = services.TrimAndNormalizeSpaces(req.Title)
+	req.Content = services.TrimMarkdown(req.Content)
+	normalizePoll(req.Poll)
+	// Drafts keep their categories the way the post will store them
+	if categories := services.ParseCategories(req.Categories); len(categories) > 0 {
+		req.Categories = "#" + strings.Join(categories, " #")
+	} else {
+		req.Categories = ""
+	}
+
+	if validationErrors := h.settings.Validator.ValidateOperation("draft", req); len(validationErrors) > 0 {
+		services.HTTPError(w, http.StatusBadRequest, "Validation error", "Validation error", true, user, validationErrors)
+		return req, false
+	}
+	return req, true
+}
@@ -0,0 +1,191 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"project-root/pkg/api"
+	"project-root/pkg/logging"
+	"project-root/pkg/repositories"
+	"project-root/pkg/services"
+)
+
+// HandleGetFeed retrieves the posts of the users and categories the current user follows.
+// @Summary Get the personal feed
+// @Description Retrieves the posts written by followed users or filed under followed categories, with optional sorting and pagination.
+// @Tags follows
+// @Produce json
+// @Param sort query string false "Sorting criteria: new, old, popular, hot, top, controversial, rising (default: new)"
+// @Param period query string false "Window of the top sorting: day, week, month, year, all (default: all)"
+// @Param pageSize query integer false "Number of items per page (default: 20)"
+// @Param page query integer false "Page number (default: 1)"
+// @Param after query integer false "ID of the last post of the previous page; the page continues after it and page is ignored"
+// @Success 200 {object} api.Response{payload=api.PostsResponse, pagination=api.GeneralPagination} "Successful operation"
+// @Failure 401 {object} api.Response{error=api.ErrorDetails} "Unauthorized"
+// @Failure 404 {object} api.Response{error=api.ErrorDetails} "Page not found"
+// @Router /feed [get]
+func (h *Handler) HandleGetFeed(w http.ResponseWriter, r *http.Request) {
+	user, authenticated := h.auth.AuthorizeUser(r, services.ScopeFollowsRead)
+	if !authenticated {
+		services.HTTPError(w, http.StatusUnauthorized, "Unauthorized", "User is not authenticated", false, nil, nil)
+		return
+	}
+
+	sortType, sortBy, page, pageSize := h.paginationParams(r, "new", "posts")
+
+	// A page that continues after a post is found by seeking, not by its number
+	after, err := strconv.Atoi(r.URL.Query().Get("after"))
+	if err != nil || after < 0 {
+		after = 0
+	}
+	if after != 0 {
+		page = 1
+	}
+
+	posts, totalItems, totalPages, err := h.stores.Posts.GetFeed(user.ID, page, pageSize, sortBy, after)
+	if err != nil {
+		logging.FromContext(r.Context()).Error("Error fetching feed", "error", err)
+		services.HTTPError(w, http.StatusInternalServerError, "Internal Server Error", "Error fetching feed", authenticated, user, nil)
+		return
+	}
+
+	// An empty feed is a valid first page
+	if page > totalPages && totalItems > 0 {
+		services.HTTPError(w, http.StatusNotFound, "Not Found", "Page not found", authenticated, user, nil)
+		return
+	}
+
+	h.setPostLinkPreviews(r, posts)
+	h.setPostReactions(r, posts, user.ID)
+	h.setPostBookmarks(r, posts, user.ID)
+	h.setPostPolls(r, posts, user.ID)
+	payload := api.PostsResponse{
+		Posts: posts,
+	}
+	pagination := &api.GeneralPagination{
+		CurrentPage: page,
+		PerPage:     pageSize,
+		TotalCount:  totalItems,
+		TotalPages:  totalPages,
+		OrderBy:     sortType,
+	}
+
+	services.RespondWithSuccess(w, http.StatusOK, "Feed fetched successfully", authenticated, payload, pagination, user)
+}
+
+// HandleGetFollowing lists what the current user follows.
+// @Summary List followed users and categories
+// @Description Lists the users and categories the authenticated user follows, in the order they were followed.
+// @Tags follows
+// @Produce json
+// @Success 200 {object} api.Response{payload=api.FollowingResponse} "Follows fetched successfully"
+// @Failure 401 {object} api.Response{error=api.ErrorDetails} "Unauthorized"
+// @Router /follows [get]
+func (h *Handler) HandleGetFollowing(w http.ResponseWriter, r *http.Request) {
+	user, authenticated := h.auth.AuthorizeUser(r, services.ScopeFollowsRead)
+	if !authenticated {
+		services.HTTPError(w, http.StatusUnauthorized, "Unauthorized", "User is not authenticated", false, nil, nil)
+		return
+	}
+
+	following, err := h.stores.Follows.GetFollowing(user.ID)
+	if err != nil {
+		logging.FromContext(r.Context()).Error("Error fetching follows", "error", err)
+		services.HTTPError(w, http.StatusInternalServerError, "Internal Server Error", "Error fetching follows", authenticated, user, nil)
+		return
+	}
+
+	services.RespondWithSuccess(w, http.StatusOK, "Follows fetched successfully", authenticated, following, nil, user)
+}
+
+// HandleFollowUser follows (PUT) or unfollows (DELETE) a user.
+// @Summary Follow or unfollow a user
+// @Description Follows the user with PUT and unfollows them with DELETE. Both are idempotent.
+// @Tags follows
+// @Produce json
+// @Security BearerAuth
+// @Param nickname path string true "Nickname of the user"
+// @Success 200 {object} api.Response "Follow updated successfully"
+// @Failure 400 {object} api.Response{error=api.ErrorDetails} "Users cannot follow themselves"
+// @Failure 401 {object} api.Response{error=api.ErrorDetails} "Unauthorized"
+// @Failure 404 {object} api.Response{error=api.ErrorDetails} "User not found"
+// @Router /follows/users/{nickname} [put]
+// @Router /follows/users/{nickname} [delete]
+func (h *Handler) HandleFollowUser(w http.ResponseWriter, r *http.Request) {
+	user, authenticated := h.auth.AuthorizeUser(r, services.ScopeFollowsWrite)
+	if !authenticated {
+		services.HTTPError(w, http.StatusUnauthorized, "Unauthorized", "User is not authenticated", false, nil, nil)
+		return
+	}
+
+	params := services.GetRouteParams(r)
+	followee, err := h.stores.Users.GetUserByNickname(params["nickname"])
+	if errors.Is(err, sql.ErrNoRows) {
+		services.HTTPError(w, http.StatusNotFound, "User not found", "User not found", authenticated, user, nil)
+		return
+	}
+	if err != nil {
+		logging.FromContext(r.Context()).Error("Error fetching user", "error", err)
+		services.HTTPError(w, http.StatusInternalServerError, "Internal Server Error", "Error fetching user", authenticated, user, nil)
+		return
+	}
+	if followee.ID == user.ID {
+		services.HTTPError(w, http.StatusBadRequest, "Bad Request", "Users cannot follow themselves", authenticated, user, nil)
+		return
+	}
+
+	if r.Method == http.MethodDelete {
+		err = h.stores.Follows.UnfollowUser(user.ID, followee.ID)
+	} else {
+		err = h.stores.Follows.FollowUser(user.ID, followee.ID)
+	}
+	if err != nil {
+		logging.FromContext(r.Context()).Error("Error updating follow", "followee_id", followee.ID, "error", err)
+		services.HTTPError(w, http.StatusInternalServerError, "Internal Server Error", "Error updating follow", authenticated, user, nil)
+		return
+	}
+
+	services.RespondWithSuccess(w, http.StatusOK, "Follow updated successfully", authenticated, nil, nil, user)
+}
+
+// HandleFollowCategory follows (PUT) or unfollows (DELETE) a category.
+// @Summary Follow or unfollow a category
+// @Description Follows the category with PUT and unfollows it with DELETE. Both are idempotent.
+// @Tags follows
+// @Produce json
+// @Security BearerAuth
+// @Param category path string true "Category name"
+// @Success 200 {object} api.Response "Follow updated successfully"
+// @Failure 401 {object} api.Response{error=api.ErrorDetails} "Unauthorized"
+// @Failure 404 {object} api.Response{error=api.ErrorDetails} "Category not found"
+// @Router /follows/categories/{category} [put]
+// @Router /follows/categories/{category} [delete]
+func (h *Handler) HandleFollowCategory(w http.ResponseWriter, r *http.Request) {
+	user, authenticated := h.auth.AuthorizeUser(r, services.ScopeFollowsWrite)
+	if !authenticated {
+		services.HTTPError(w, http.StatusUnauthorized, "Unauthorized", "User is not authenticated", false, nil, nil)
+		return
+	}
+
+	category := services.GetRouteParams(r)["category"]
+
+	var err error
+	if r.Method == http.MethodDelete {
+		err = h.stores.Follows.UnfollowCategory(user.ID, category)
+	} else {
+		err = h.stores.Follows.FollowCategory(user.ID, category)
+	}
+	if errors.Is(err, repositories.ErrCategoryNotFound) {
+		services.HTTPError(w, http.StatusNotFound, "Not Found", "Category not found", authenticated, user, nil)
+		return
+	}
+	if err != nil {
+		logging.FromContext(r.Context()).Error("Error updating follow", "category", category, "error", err)
+		services.HTTPError(w, http.StatusInternalServerError, "Internal Server Error", "Error updating follow", authenticated, user, nil)
+		return
+	}
+
+	services.RespondWithSuccess(w, http.StatusOK, "Follow updated successfully", authenticated, nil, nil, user)
+}
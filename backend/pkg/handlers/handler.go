@@ -0,0 +1,64 @@
+package handlers
+
+import (
+	"net/http"
+
+	"project-root/config"
+	"project-root/pkg/api"
+	"project-root/pkg/attachments"
+	"project-root/pkg/clock"
+	"project-root/pkg/repositories"
+	"project-root/pkg/services"
+)
+
+// Handler serves the HTTP API on top of the injected stores
+type Handler struct {
+	stores   repositories.Stores
+	auth     *services.Authenticator
+	clock    clock.Clock
+	notifier Notifier
+	blobs    attachments.BlobStore
+	uploads  attachments.Limits
+	webhooks *services.WebhookDispatcher
+	events   *services.EventBus
+	settings Settings
+}
+
+// Settings are the configured policies the handlers apply to requests
+type Settings struct {
+	Security   *services.Security
+	Validator  *services.Validator
+	Session    config.SessionConfig
+	Pagination config.PaginationConfig
+	// PublicURL is the URL the forum is reached at, which links are built on
+	PublicURL string
+}
+
+// Notifier tells connected users about changes that are not events on the
+// bus: reactions to chat messages go to the chat and poll results to the
+// users viewing the post.
+type Notifier interface {
+	NotifyReaction(eventType string, e api.ReactionEvent)
+	NotifyPollResults(postID int, poll api.Poll)
+}
+
+// NewHandler creates a Handler that reads and writes through stores, takes
+// the current time from clk, tells users about reactions and poll results
+// through notifier, keeps uploaded files within the uploads limits in blobs,
+// redelivers to webhooks through webhooks, wakes events after changes that
+// record events, so that their subscribers handle them at once, and applies
+// the policies in settings
+func NewHandler(stores repositories.Stores, auth *services.Authenticator, clk clock.Clock, notifier Notifier, blobs attachments.BlobStore, uploads attachments.Limits, webhooks *services.WebhookDispatcher, events *services.EventBus, settings Settings) *Handler {
+	return &Handler{stores: stores, auth: auth, clock: clk, notifier: notifier, blobs: blobs, uploads: uploads, webhooks: webhooks, events: events, settings: settings}
+}
+
+// paginationParams reads the sorting and paging parameters of a list request
+func (h *Handler) paginationParams(r *http.Request, baseSortType, sortWhat string) (sortBy, sqlSortExp string, page, pageSize int) {
+	return services.ExtractPaginationParams(r, h.settings.Pagination, baseSortType, sortWhat)
+}
+
+// refuseToken answers a request whose bearer token is not valid or was not
+// granted scope
+func refuseToken(w http.ResponseWriter, scope string) {
+	services.HTTPError(w, http.StatusUnauthorized, "Unauthorized", "Token is not valid or lacks the "+scope+" scope", false, nil, nil)
+}
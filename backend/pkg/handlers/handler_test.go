@@ -0,0 +1,512 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"project-root/config"
+	"project-root/pkg/api"
+	"project-root/pkg/attachments"
+	"project-root/pkg/clock"
+	"project-root/pkg/repositories"
+	"project-root/pkg/repositories/memory"
+	"project-root/pkg/services"
+)
+
+// handlerFixture serves the API routes under test on the in-memory stores,
+// with a manual clock and an event bus that is dispatched by hand
+type handlerFixture struct {
+	stores repositories.Stores
+	clock  *clock.Manual
+	events *services.EventBus
+	router *mux.Router
+	blobs  attachments.BlobStore
+}
+
+// discardNotifier drops reaction and poll notifications
+type discardNotifier struct{}
+
+func (discardNotifier) NotifyReaction(string, api.ReactionEvent) {}
+func (discardNotifier) NotifyPollResults(int, api.Poll)          {}
+
+func newHandlerFixture(t *testing.T) *handlerFixture {
+	t.Helper()
+	cfg := config.Default()
+	clk := clock.NewManual(time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC))
+	stores := memory.NewStores(clk)
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	events := services.NewEventBus(stores.Outbox, clk, services.EventPolicy{MaxAttempts: 3, RetryDelay: time.Minute, Retention: time.Hour}, logger)
+	services.SubscribeCounters(events, stores.Counts)
+	blobs, err := attachments.NewDiskStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	h := NewHandler(stores, services.NewAuthenticator(stores.Sessions, stores.Tokens), clk, discardNotifier{}, blobs, attachments.Limits{}, nil, events, Settings{
+		Security:   services.NewSecurity(cfg.Security),
+		Validator:  services.NewValidator(cfg.Validation),
+		Session:    cfg.Session,
+		Pagination: cfg.Pagination,
+		PublicURL:  "https://forum.example.com/",
+	})
+
+	r := mux.NewRouter()
+	r.HandleFunc("/api/auth/register", h.HandleRegister).Methods("POST")
+	r.HandleFunc("/api/auth/login", h.HandleLogin).Methods("POST")
+	r.HandleFunc("/api/posts", h.HandleGetPosts).Methods("GET")
+	r.HandleFunc("/api/posts", h.HandleCreatePost).Methods("POST")
+	r.HandleFunc("/api/posts/{postId:[0-9]+}", h.HandleGetPostAndComments).Methods("GET")
+	r.HandleFunc("/api/posts/{postId:[0-9]+}/comments", h.HandleCreateComment).Methods("POST")
+	r.HandleFunc("/api/rate", h.HandleRate).Methods("PUT")
+	r.HandleFunc("/api/users/{nickname}/{type:posts|comments}", h.HandleGetUser).Methods("GET")
+	r.HandleFunc("/api/feed", h.HandleGetFeed).Methods("GET")
+	r.HandleFunc("/api/attachments/{attachmentId:[0-9]+}", h.HandleGetAttachment).Methods("GET")
+	r.HandleFunc("/feeds/posts.{format:atom|rss}", h.HandleSyndicationFeed).Methods("GET")
+
+	return &handlerFixture{stores: stores, clock: clk, events: events, router: r, blobs: blobs}
+}
+
+// newUser stores a user with a session and returns the session ID
+func (f *handlerFixture) newUser(t *testing.T, nickname string) (int, string) {
+	t.Helper()
+	user, err := f.stores.Users.CreateUser(&api.RegistrationRequest{Nickname: nickname, Email: nickname + "@example.com", CreatedAt: f.clock.Now()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sessionID := "session-" + nickname
+	if err := f.stores.Sessions.CreateSession(&api.Session{UserID: user.ID, SessionID: sessionID, CreatedAt: f.clock.Now(), ExpiresAt: f.clock.Now().Add(time.Hour)}); err != nil {
+		t.Fatal(err)
+	}
+	return user.ID, sessionID
+}
+
+// newToken stores a token of userID with the given scopes and returns its secret
+func (f *handlerFixture) newToken(t *testing.T, userID int, scopes ...string) string {
+	t.Helper()
+	secret, err := services.GenerateToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.stores.Tokens.Create(userID, "test", services.HashToken(secret), scopes, nil); err != nil {
+		t.Fatal(err)
+	}
+	return secret
+}
+
+// credentials authenticate a request with a session cookie or a bearer token
+type credentials struct {
+	session string
+	token   string
+}
+
+// do serves a request with body encoded as JSON and decodes the response,
+// with its payload into payload when it is not nil
+func (f *handlerFixture) do(t *testing.T, method, target string, as credentials, body, payload interface{}) (*httptest.ResponseRecorder, api.Response) {
+	t.Helper()
+	var reader io.Reader
+	if body != nil {
+		encoded, err := json.Marshal(body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		reader = bytes.NewReader(encoded)
+	}
+	r := httptest.NewRequest(method, target, reader)
+	if as.session != "" {
+		r.AddCookie(&http.Cookie{Name: services.SessionCookieName, Value: as.session})
+	}
+	if as.token != "" {
+		r.Header.Set("Authorization", "Bearer "+as.token)
+	}
+	w := httptest.NewRecorder()
+	f.router.ServeHTTP(w, r)
+
+	var raw struct {
+		api.Response
+		Payload json.RawMessage `json:"payload"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &raw); err != nil {
+		t.Fatalf("%s %s: decoding %q: %v", method, target, w.Body.String(), err)
+	}
+	if payload != nil && len(raw.Payload) > 0 {
+		if err := json.Unmarshal(raw.Payload, payload); err != nil {
+			t.Fatalf("%s %s: decoding payload %s: %v", method, target, raw.Payload, err)
+		}
+	}
+	return w, raw.Response
+}
+
+// get serves a GET request with header and returns the raw response
+func (f *handlerFixture) get(target string, header http.Header) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(http.MethodGet, target, nil)
+	for name, values := range header {
+		r.Header[name] = values
+	}
+	if host := header.Get("Host"); host != "" {
+		r.Host = host
+	}
+	w := httptest.NewRecorder()
+	f.router.ServeHTTP(w, r)
+	return w
+}
+
+// createPost creates a post as the user of session and returns its ID
+func (f *handlerFixture) createPost(t *testing.T, session, title string) int {
+	t.Helper()
+	var created api.PostCreateResponse
+	w, _ := f.do(t, http.MethodPost, "/api/posts", credentials{session: session}, api.PostCreateRequest{Title: title, Content: "Body of " + title, Categories: "#testing"}, &created)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("creating post: status %d, body %s", w.Code, w.Body)
+	}
+	return created.ID
+}
+
+func TestRegisterAndPost(t *testing.T) {
+	f := newHandlerFixture(t)
+
+	w, resp := f.do(t, http.MethodPost, "/api/auth/register", credentials{}, api.RegistrationRequest{
+		Nickname:  "newcomer",
+		Email:     "newcomer@example.com",
+		Password:  "!QAZ2wsx",
+		Age:       "02.02.2002",
+		Gender:    "female",
+		FirstName: "New",
+		LastName:  "Comer",
+	}, nil)
+	if w.Code != http.StatusOK || !resp.Authenticated {
+		t.Fatalf("register: status %d, body %s", w.Code, w.Body)
+	}
+	var session string
+	for _, c := range w.Result().Cookies() {
+		if c.Name == services.SessionCookieName {
+			session = c.Value
+		}
+	}
+	if session == "" {
+		t.Fatal("register did not set a session cookie")
+	}
+
+	postID := f.createPost(t, session, "First post")
+	f.events.DispatchPending()
+
+	var post api.PostAndCommentsResponse
+	w, _ = f.do(t, http.MethodGet, "/api/posts/"+strconv.Itoa(postID), credentials{}, nil, &post)
+	if w.Code != http.StatusOK {
+		t.Fatalf("get post: status %d, body %s", w.Code, w.Body)
+	}
+	if post.Post.Nickname != "newcomer" || !post.Post.CreatedAt.Equal(f.clock.Now()) {
+		t.Errorf("post = %s at %v, want newcomer at %v", post.Post.Nickname, post.Post.CreatedAt, f.clock.Now())
+	}
+	if len(post.Post.Categories) != 1 || post.Post.Categories[0].Name != "testing" {
+		t.Errorf("categories = %+v, want testing", post.Post.Categories)
+	}
+
+	user, err := f.stores.Users.GetUserByNickname("newcomer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.AmountOfPosts != 1 {
+		t.Errorf("amount of posts after dispatching = %d, want 1", user.AmountOfPosts)
+	}
+}
+
+func TestEndpointScopes(t *testing.T) {
+	f := newHandlerFixture(t)
+	userID, session := f.newUser(t, "author")
+	postID := f.createPost(t, session, "Scoped post")
+	reader := f.newToken(t, userID, services.ScopePostsRead, services.ScopeUsersRead)
+	writer := f.newToken(t, userID, services.ScopePostsWrite, services.ScopeRatesWrite)
+
+	post := api.PostCreateRequest{Title: "Token post", Content: "Posted with a token", Categories: "#testing"}
+	vote := api.RateRequest{PostID: postID, Status: "up"}
+	tests := []struct {
+		name   string
+		method string
+		target string
+		as     credentials
+		body   interface{}
+		status int
+	}{
+		{"anonymous reads posts", http.MethodGet, "/api/posts", credentials{}, nil, http.StatusOK},
+		{"read token reads posts", http.MethodGet, "/api/posts", credentials{token: reader}, nil, http.StatusOK},
+		{"write token cannot read posts", http.MethodGet, "/api/posts", credentials{token: writer}, nil, http.StatusUnauthorized},
+		{"write token cannot read a post", http.MethodGet, "/api/posts/" + strconv.Itoa(postID), credentials{token: writer}, nil, http.StatusUnauthorized},
+		{"read token reads users", http.MethodGet, "/api/users/author/posts", credentials{token: reader}, nil, http.StatusOK},
+		{"write token cannot read users", http.MethodGet, "/api/users/author/posts", credentials{token: writer}, nil, http.StatusUnauthorized},
+		{"anonymous cannot post", http.MethodPost, "/api/posts", credentials{}, post, http.StatusUnauthorized},
+		{"read token cannot post", http.MethodPost, "/api/posts", credentials{token: reader}, post, http.StatusUnauthorized},
+		{"write token posts", http.MethodPost, "/api/posts", credentials{token: writer}, post, http.StatusCreated},
+		{"read token cannot vote", http.MethodPut, "/api/rate", credentials{token: reader}, vote, http.StatusUnauthorized},
+		{"write token votes", http.MethodPut, "/api/rate", credentials{token: writer}, vote, http.StatusOK},
+		{"session votes", http.MethodPut, "/api/rate", credentials{session: session}, vote, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if w, _ := f.do(t, tt.method, tt.target, tt.as, tt.body, nil); w.Code != tt.status {
+				t.Errorf("status = %d, want %d; body %s", w.Code, tt.status, w.Body)
+			}
+		})
+	}
+}
+
+func TestRateToggles(t *testing.T) {
+	f := newHandlerFixture(t)
+	_, author := f.newUser(t, "author")
+	_, voter := f.newUser(t, "voter")
+	postID := f.createPost(t, author, "Rated post")
+
+	steps := []struct {
+		status string
+		want   api.Rate
+	}{
+		{"up", api.Rate{Rate: 1, Upvotes: 1, Status: "up"}},
+		{"up", api.Rate{}},
+		{"down", api.Rate{Rate: -1, Downvotes: 1, Status: "down"}},
+		{"up", api.Rate{Rate: 1, Upvotes: 1, Status: "up"}},
+	}
+	for i, step := range steps {
+		var rated api.RateResponse
+		w, _ := f.do(t, http.MethodPut, "/api/rate", credentials{session: voter}, api.RateRequest{PostID: postID, Status: step.status}, &rated)
+		if w.Code != http.StatusOK {
+			t.Fatalf("step %d: status %d, body %s", i, w.Code, w.Body)
+		}
+		if rated.Rate != step.want {
+			t.Errorf("step %d: voting %s gave %+v, want %+v", i, step.status, rated.Rate, step.want)
+		}
+	}
+
+	if w, _ := f.do(t, http.MethodPut, "/api/rate", credentials{session: voter}, api.RateRequest{PostID: postID + 100, Status: "up"}, nil); w.Code != http.StatusNotFound {
+		t.Errorf("voting on a missing post: status %d, want %d", w.Code, http.StatusNotFound)
+	}
+	if w, _ := f.do(t, http.MethodPut, "/api/rate", credentials{session: voter}, api.RateRequest{PostID: postID, Status: "sideways"}, nil); w.Code != http.StatusBadRequest {
+		t.Errorf("voting sideways: status %d, want %d", w.Code, http.StatusBadRequest)
+	}
+}
+
+func TestListsFlagBookmarks(t *testing.T) {
+	f := newHandlerFixture(t)
+	authorID, author := f.newUser(t, "author")
+	readerID, reader := f.newUser(t, "reader")
+	saved := f.createPost(t, author, "Saved post")
+	f.createPost(t, author, "Other post")
+
+	collection, err := f.stores.Bookmarks.CreateCollection(readerID, "Later")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.stores.Bookmarks.AddBookmark(readerID, collection.ID, api.BookmarkRequest{PostID: saved}); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.stores.Follows.FollowUser(readerID, authorID); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, target := range []string{"/api/posts", "/api/users/author/posts", "/api/feed"} {
+		for _, as := range []struct {
+			session string
+			want    bool
+		}{{reader, true}, {author, false}} {
+			var payload struct {
+				Posts []api.Post `json:"posts"`
+			}
+			if w, _ := f.do(t, http.MethodGet, target, credentials{session: as.session}, nil, &payload); w.Code != http.StatusOK {
+				t.Fatalf("GET %s: status %d, body %s", target, w.Code, w.Body)
+			}
+			if as.want && len(payload.Posts) != 2 {
+				t.Errorf("GET %s as %s lists %d posts, want 2", target, as.session, len(payload.Posts))
+			}
+			for _, post := range payload.Posts {
+				if want := as.want && post.ID == saved; post.Bookmarked != want {
+					t.Errorf("GET %s as %s: %q bookmarked = %v, want %v", target, as.session, post.Title, post.Bookmarked, want)
+				}
+			}
+		}
+	}
+}
+
+func TestCommentCountsAfterDispatch(t *testing.T) {
+	f := newHandlerFixture(t)
+	_, author := f.newUser(t, "author")
+	_, commenter := f.newUser(t, "commenter")
+	postID := f.createPost(t, author, "Discussed post")
+
+	for i := 0; i < 2; i++ {
+		f.clock.Advance(time.Minute)
+		if w, _ := f.do(t, http.MethodPost, "/api/posts/"+strconv.Itoa(postID)+"/comments", credentials{session: commenter}, api.CommentCreateRequest{Content: "Comment " + strconv.Itoa(i)}, nil); w.Code != http.StatusCreated {
+			t.Fatalf("comment %d: status %d, body %s", i, w.Code, w.Body)
+		}
+	}
+
+	var post api.PostAndCommentsResponse
+	f.do(t, http.MethodGet, "/api/posts/"+strconv.Itoa(postID), credentials{}, nil, &post)
+	if post.Post.AmountOfComments != 0 {
+		t.Errorf("amount of comments before dispatching = %d, want 0", post.Post.AmountOfComments)
+	}
+
+	f.events.DispatchPending()
+	f.do(t, http.MethodGet, "/api/posts/"+strconv.Itoa(postID), credentials{}, nil, &post)
+	if post.Post.AmountOfComments != 2 {
+		t.Errorf("amount of comments after dispatching = %d, want 2", post.Post.AmountOfComments)
+	}
+}
+
+func TestChatAttachmentsForMembersOnly(t *testing.T) {
+	f := newHandlerFixture(t)
+	aliceID, alice := f.newUser(t, "alice")
+	bobID, bob := f.newUser(t, "bob")
+	_, carol := f.newUser(t, "carol")
+
+	key, err := attachments.NewKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := f.blobs.Put(key, strings.NewReader("private notes")); err != nil {
+		t.Fatal(err)
+	}
+	attachment := &api.Attachment{UserID: aliceID, FileName: "notes.txt", MimeType: "text/plain; charset=utf-8", Size: 13, BlobKey: key, CreatedAt: f.clock.Now()}
+	if err := f.stores.Attachments.Create(attachment); err != nil {
+		t.Fatal(err)
+	}
+	hash, err := f.stores.Chats.CreateChat(aliceID, bobID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	message := &api.MessageMessage{RoomHash: hash, Sender: &api.UserResponse{ID: aliceID, Nickname: "alice"}, Message: "Notes", SendAt: f.clock.Now(), AttachmentIDs: []int{attachment.ID}}
+	if err := f.stores.Chats.SaveMessage(message); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		session string
+		want    int
+	}{
+		{"sender", alice, http.StatusOK},
+		{"recipient", bob, http.StatusOK},
+		{"not a member", carol, http.StatusNotFound},
+		{"anonymous", "", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header := http.Header{}
+			if tt.session != "" {
+				header.Set("Cookie", (&http.Cookie{Name: services.SessionCookieName, Value: tt.session}).String())
+			}
+			w := f.get("/api/attachments/"+strconv.Itoa(attachment.ID), header)
+			if w.Code != tt.want {
+				t.Fatalf("status %d, want %d", w.Code, tt.want)
+			}
+			if leaked := strings.Contains(w.Body.String(), "private notes"); leaked != (tt.want == http.StatusOK) {
+				t.Errorf("body %q", w.Body)
+			}
+		})
+	}
+}
+
+func TestSyndicationFeedEscapesPosts(t *testing.T) {
+	f := newHandlerFixture(t)
+	_, author := f.newUser(t, "author")
+	const title = `Less <b>bold</b> & ]]> more`
+	post := api.PostCreateRequest{Title: title, Content: "Compare a < b & c ]]> d, then <script>alert(1)</script>", Categories: "#testing"}
+	var created api.PostCreateResponse
+	if w, _ := f.do(t, http.MethodPost, "/api/posts", credentials{session: author}, post, &created); w.Code != http.StatusCreated {
+		t.Fatalf("creating post: status %d, body %s", w.Code, w.Body)
+	}
+	stored, err := f.stores.Posts.GetPostByID(created.ID, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	link := "https://forum.example.com/post/" + strconv.Itoa(created.ID)
+
+	var atom struct {
+		Entries []struct {
+			Title   string `xml:"title"`
+			Content string `xml:"content"`
+			Link    struct {
+				Href string `xml:"href,attr"`
+			} `xml:"link"`
+		} `xml:"entry"`
+	}
+	var rss struct {
+		Items []struct {
+			Title       string `xml:"title"`
+			Description string `xml:"description"`
+			Link        string `xml:"link"`
+		} `xml:"channel>item"`
+	}
+	for target, doc := range map[string]interface{}{"/feeds/posts.atom": &atom, "/feeds/posts.rss": &rss} {
+		// A forged Host header must not end up in the cached feed
+		w := f.get(target, http.Header{"Host": {"attacker.example"}})
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: status %d", target, w.Code)
+		}
+		body := w.Body.String()
+		if strings.Contains(body, "attacker.example") || strings.Contains(body, "<script") || strings.Contains(body, "]]>") || strings.Contains(body, "<b>") {
+			t.Errorf("%s is not escaped or links to the request host: %s", target, body)
+		}
+		if err := xml.Unmarshal(w.Body.Bytes(), doc); err != nil {
+			t.Fatalf("%s: %v", target, err)
+		}
+	}
+
+	if len(atom.Entries) != 1 || atom.Entries[0].Title != title || atom.Entries[0].Content != stored.ContentHTML || atom.Entries[0].Link.Href != link {
+		t.Errorf("Atom entries = %+v, want %q with the post HTML at %s", atom.Entries, title, link)
+	}
+	if len(rss.Items) != 1 || rss.Items[0].Title != title || rss.Items[0].Description != stored.ContentHTML || rss.Items[0].Link != link {
+		t.Errorf("RSS items = %+v, want %q with the post HTML at %s", rss.Items, title, link)
+	}
+}
+
+func TestSyndicationFeedNotModified(t *testing.T) {
+	f := newHandlerFixture(t)
+	_, author := f.newUser(t, "author")
+	f.createPost(t, author, "First post")
+
+	first := f.get("/feeds/posts.atom", nil)
+	etag, lastModified := first.Header().Get("ETag"), first.Header().Get("Last-Modified")
+	if first.Code != http.StatusOK || etag == "" || lastModified == "" {
+		t.Fatalf("status %d with ETag %q and Last-Modified %q", first.Code, etag, lastModified)
+	}
+
+	tests := []struct {
+		name   string
+		header http.Header
+		want   int
+	}{
+		{"matching ETag", http.Header{"If-None-Match": {etag}}, http.StatusNotModified},
+		{"not modified since", http.Header{"If-Modified-Since": {lastModified}}, http.StatusNotModified},
+		{"other ETag", http.Header{"If-None-Match": {`"stale"`}}, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := f.get("/feeds/posts.atom", tt.header)
+			if w.Code != tt.want {
+				t.Errorf("status %d, want %d", w.Code, tt.want)
+			}
+			if w.Code == http.StatusNotModified && w.Body.Len() != 0 {
+				t.Errorf("304 with a body of %d bytes", w.Body.Len())
+			}
+		})
+	}
+
+	// A new post changes the feed
+	f.clock.Advance(time.Minute)
+	f.createPost(t, author, "Second post")
+	if w := f.get("/feeds/posts.atom", http.Header{"If-None-Match": {etag}}); w.Code != http.StatusOK {
+		t.Errorf("after a new post: status %d, want 200", w.Code)
+	}
+	if w := f.get("/feeds/posts.atom", http.Header{"If-Modified-Since": {lastModified}}); w.Code != http.StatusOK {
+		t.Errorf("after a new post, not modified since: status %d, want 200", w.Code)
+	}
+}
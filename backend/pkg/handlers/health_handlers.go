@@ -0,0 +1,92 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"runtime"
+	"time"
+
+	"project-root/pkg/api"
+	"project-root/pkg/db"
+	"project-root/pkg/logging"
+	"project-root/pkg/services"
+	"project-root/pkg/websockets"
+)
+
+// readinessTimeout bounds how long all readiness checks together may take
+const readinessTimeout = 2 * time.Second
+
+// HandleHealthz reports that the process is alive. It does not touch any dependency.
+func HandleHealthz(w http.ResponseWriter, r *http.Request) {
+	services.RespondWithSuccess(w, http.StatusOK, "OK", false, nil, nil, nil)
+}
+
+// HandleReadyz returns a handler that runs the readiness checks and answers
+// 503 Service Unavailable, listing the failed checks, if any of them fails.
+func HandleReadyz(checks []services.HealthCheck) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), readinessTimeout)
+		defer cancel()
+
+		results, ready := services.RunHealthChecks(ctx, checks)
+		if !ready {
+			var failed []api.ValidationError
+			for _, result := range results {
+				if result.Status != "ok" {
+					failed = append(failed, api.ValidationError{Field: result.Name, Message: result.Error})
+				}
+			}
+			logging.FromContext(r.Context()).Warn("Readiness check failed", "failed", failed)
+			services.HTTPError(w, http.StatusServiceUnavailable, "Not ready", "Readiness check failed", false, nil, failed)
+			return
+		}
+
+		services.RespondWithSuccess(w, http.StatusOK, "Ready", false, api.ReadinessResponse{Checks: results}, nil, nil)
+	}
+}
+
+// HandleDebugStatus returns a handler with build, uptime, database and WebSocket diagnostics.
+// Only available to admins.
+func (h *Handler) HandleDebugStatus(dbHandler *db.DBHandler, manager *websockets.WebSocketManager, startedAt time.Time) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, authenticated := h.auth.AuthenticateSession(r)
+		if !authenticated {
+			services.HTTPError(w, http.StatusUnauthorized, "Unauthorized", "User is not authenticated", false, nil, nil)
+			return
+		}
+		if !h.settings.Security.IsAdmin(user) {
+			services.HTTPError(w, http.StatusForbidden, "Forbidden", "Admin access required", authenticated, user, nil)
+			return
+		}
+
+		var databases []api.DatabaseStatus
+		for _, status := range dbHandler.Status(r.Context()) {
+			databases = append(databases, api.DatabaseStatus{
+				Name:            status.Name,
+				Path:            status.Path,
+				SizeBytes:       status.SizeBytes,
+				WALSizeBytes:    status.WALSizeBytes,
+				JournalMode:     status.JournalMode,
+				OpenConnections: status.OpenConnections,
+				InUse:           status.InUse,
+				Idle:            status.Idle,
+			})
+		}
+
+		connections, rooms := manager.Stats()
+		payload := api.DebugStatus{
+			Version:       services.BuildVersion(),
+			GoVersion:     runtime.Version(),
+			StartedAt:     startedAt,
+			UptimeSeconds: int64(time.Since(startedAt).Seconds()),
+			Goroutines:    runtime.NumGoroutine(),
+			Databases:     databases,
+			WebSocket: api.WebSocketStatus{
+				Accepting:   manager.Accepting(),
+				Connections: connections,
+				Rooms:       rooms,
+			},
+		}
+		services.RespondWithSuccess(w, http.StatusOK, "Status", authenticated, payload, nil, user)
+	}
+}
@@ -0,0 +1,38 @@
+package handlers
+
+import (
+	"net/http"
+
+	"project-root/pkg/api"
+	"project-root/pkg/logging"
+	"project-root/pkg/services"
+)
+
+// setPostLinkPreviews adds the cached previews of the links in the posts.
+// Previews are extras, so failing to read them only gets logged.
+func (h *Handler) setPostLinkPreviews(r *http.Request, posts []api.Post) {
+	texts := make([]string, len(posts))
+	for i := range posts {
+		texts[i] = posts[i].Content
+	}
+	err := services.AttachLinkPreviews(h.stores.Previews, texts, func(i int, previews []api.LinkPreview) {
+		posts[i].LinkPreviews = previews
+	})
+	if err != nil {
+		logging.FromContext(r.Context()).Warn("Error fetching link previews", "error", err)
+	}
+}
+
+// setMessageLinkPreviews adds the cached previews of the links in chat messages
+func (h *Handler) setMessageLinkPreviews(r *http.Request, messages []api.MessageMessage) {
+	texts := make([]string, len(messages))
+	for i := range messages {
+		texts[i] = messages[i].Message
+	}
+	err := services.AttachLinkPreviews(h.stores.Previews, texts, func(i int, previews []api.LinkPreview) {
+		messages[i].LinkPreviews = previews
+	})
+	if err != nil {
+		logging.FromContext(r.Context()).Warn("Error fetching link previews", "error", err)
+	}
+}
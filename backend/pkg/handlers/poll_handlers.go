@@ -0,0 +1,127 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"project-root/pkg/api"
+	"project-root/pkg/logging"
+	"project-root/pkg/metrics"
+	"project-root/pkg/repositories"
+	"project-root/pkg/services"
+)
+
+// HandlePollVote casts (PUT) or withdraws (DELETE) the vote of the user in the poll of a post.
+// @Summary Vote in the poll of a post
+// @Description Replaces the ballot of the user with the options in option_ids with PUT and withdraws it with DELETE, which takes no body. Single choice polls take one option. Votes are refused once the poll closed. Clients viewing the post over the WebSocket receive the new results as a "poll_results" message.
+// @Tags posts
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param postId path integer true "Post ID"
+// @Param body body api.PollVoteRequest false "Ballot, PUT only"
+// @Success 200 {object} api.Response{payload=api.PollResponse} "Vote updated successfully"
+// @Failure 400 {object} api.Response{error=api.ErrorDetails} "Bad request"
+// @Failure 401 {object} api.Response{error=api.ErrorDetails} "Unauthorized"
+// @Failure 404 {object} api.Response{error=api.ErrorDetails} "Poll not found"
+// @Failure 409 {object} api.Response{error=api.ErrorDetails} "Poll is closed"
+// @Failure 500 {object} api.Response{error=api.ErrorDetails} "Internal server error"
+// @Router /posts/{postId}/poll/vote [put]
+// @Router /posts/{postId}/poll/vote [delete]
+func (h *Handler) HandlePollVote(w http.ResponseWriter, r *http.Request) {
+	user, authenticated := h.auth.AuthorizeUser(r, services.ScopePollsWrite)
+	if !authenticated {
+		services.HTTPError(w, http.StatusUnauthorized, "Unauthorized", "User is not authenticated", false, nil, nil)
+		return
+	}
+
+	postID, err := strconv.Atoi(services.GetRouteParams(r)["postId"])
+	if err != nil {
+		services.HTTPError(w, http.StatusBadRequest, "Bad Request", "Invalid post ID", authenticated, user, nil)
+		return
+	}
+
+	changed := true
+	action := "cast"
+	if r.Method == http.MethodDelete {
+		action = "withdrawn"
+		changed, err = h.stores.Polls.WithdrawVote(postID, user.ID, h.clock.Now())
+	} else {
+		var vote api.PollVoteRequest
+		if err := json.NewDecoder(r.Body).Decode(&vote); err != nil {
+			services.HTTPError(w, http.StatusBadRequest, "Bad Request", "Invalid request payload", authenticated, user, nil)
+			return
+		}
+		if validationErrors := h.settings.Validator.ValidateOperation("poll_vote", vote); len(validationErrors) > 0 {
+			services.HTTPError(w, http.StatusBadRequest, "Validation error", "Validation error", authenticated, user, validationErrors)
+			return
+		}
+		err = h.stores.Polls.Vote(postID, user.ID, vote.OptionIDs, h.clock.Now())
+	}
+	switch {
+	case errors.Is(err, repositories.ErrPollNotFound):
+		services.HTTPError(w, http.StatusNotFound, "Not Found", "Poll not found", authenticated, user, nil)
+		return
+	case errors.Is(err, repositories.ErrPollClosed):
+		services.HTTPError(w, http.StatusConflict, "Conflict", "Poll is closed", authenticated, user, nil)
+		return
+	case errors.Is(err, repositories.ErrPollOptionNotFound):
+		services.HTTPError(w, http.StatusBadRequest, "Bad Request", "Unknown poll option", authenticated, user, nil)
+		return
+	case errors.Is(err, repositories.ErrPollSingleChoice):
+		services.HTTPError(w, http.StatusBadRequest, "Bad Request", "Poll allows a single choice", authenticated, user, nil)
+		return
+	case err != nil:
+		logging.FromContext(r.Context()).Error("Error updating poll vote", "post_id", postID, "error", err)
+		services.HTTPError(w, http.StatusInternalServerError, "Internal Server Error", "Error updating vote", authenticated, user, nil)
+		return
+	}
+
+	polls, err := h.stores.Polls.GetPolls([]int{postID}, user.ID)
+	if err != nil || polls[postID] == nil {
+		logging.FromContext(r.Context()).Error("Error fetching poll", "post_id", postID, "error", err)
+		services.HTTPError(w, http.StatusInternalServerError, "Internal Server Error", "Error fetching poll", authenticated, user, nil)
+		return
+	}
+	poll := *polls[postID]
+	poll.Closed = h.pollClosed(poll)
+
+	if changed {
+		metrics.PollVotes.Inc(action)
+		results := poll
+		results.MyVotes = nil
+		h.notifier.NotifyPollResults(postID, results)
+	}
+
+	services.RespondWithSuccess(w, http.StatusOK, "Vote updated successfully", authenticated, api.PollResponse{Poll: poll}, nil, user)
+}
+
+// pollClosed reports whether the closing time of the poll has passed
+func (h *Handler) pollClosed(poll api.Poll) bool {
+	return poll.ClosesAt != nil && !h.clock.Now().Before(*poll.ClosesAt)
+}
+
+// setPostPolls adds the polls with their results to the posts, with the votes
+// of userID. Failing to read them only gets logged.
+func (h *Handler) setPostPolls(r *http.Request, posts []api.Post, userID int) {
+	if len(posts) == 0 {
+		return
+	}
+	ids := make([]int, len(posts))
+	for i := range posts {
+		ids[i] = posts[i].ID
+	}
+	polls, err := h.stores.Polls.GetPolls(ids, userID)
+	if err != nil {
+		logging.FromContext(r.Context()).Warn("Error fetching polls", "error", err)
+		return
+	}
+	for i := range posts {
+		if poll := polls[posts[i].ID]; poll != nil {
+			poll.Closed = h.pollClosed(*poll)
+			posts[i].Poll = poll
+		}
+	}
+}
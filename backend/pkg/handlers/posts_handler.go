@@ -1,11 +1,13 @@
 package handlers
 
 import (
-	"log"
+	"errors"
 	"net/http"
 
 	"encoding/json"
 	"project-root/pkg/api"
+	"project-root/pkg/logging"
+	"project-root/pkg/metrics"
 	"project-root/pkg/repositories"
 	"project-root/pkg/services"
 	"strconv"
@@ -16,25 +18,31 @@ import (
 // @Description Retrieves all posts from the database, with optional sorting and pagination.
 // @Tags posts
 // @Produce json
-// @Param sort query string false "Sorting criteria: new, old, popular (default: new)"
+// @Param sort query string false "Sorting criteria: new, old, popular, hot, top, controversial, rising (default: new)"
+// @Param period query string false "Window of the top sorting: day, week, month, year, all (default: all)"
 // @Param pageSize query integer false "Number of items per page (default: 20)"
 // @Param page query integer false "Page number (default: 1)"
 // @Success 200 {object} api.Response{payload=api.PostsResponse, pagination=api.GeneralPagination} "Successful operation"
 // @Failure 404 {object} api.Response{error=api.ErrorDetails} "Posts not found"
+// @Failure 401 {object} api.Response{error=api.ErrorDetails} "Token is not valid or lacks the read scope"
 // @Router /posts [get]
-func HandleGetPosts(w http.ResponseWriter, r *http.Request) {
+func (h *Handler) HandleGetPosts(w http.ResponseWriter, r *http.Request) {
 	authenticated := false
 	var user *api.UserResponse
 
-	user, authenticated = services.AuthenticateUser(r)
+	user, authenticated, refused := h.auth.AuthorizeOptional(r, services.ScopePostsRead)
+	if refused {
+		refuseToken(w, services.ScopePostsRead)
+		return
+	}
 
-	sortType, sortBy, page, pageSize := services.ExtractPaginationParams(r, "new", "posts")
+	sortType, sortBy, page, pageSize := h.paginationParams(r, "new", "posts")
 
-	postRepo := repositories.NewPostRepository()
+	postRepo := h.stores.Posts
 
 	posts, totalItems, totalPages, err := postRepo.GetPosts(page, pageSize, sortBy, "", "")
 	if err != nil {
-		log.Println("Error fetching posts:", err)
+		logging.FromContext(r.Context()).Error("Error fetching posts", "error", err)
 		services.HTTPError(w, http.StatusInternalServerError, "Internal Server Error", "Error fetching posts", authenticated, user, nil)
 		return
 	}
@@ -44,6 +52,10 @@ func HandleGetPosts(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	h.setPostLinkPreviews(r, posts)
+	h.setPostReactions(r, posts, user.ID)
+	h.setPostBookmarks(r, posts, user.ID)
+	h.setPostPolls(r, posts, user.ID)
 	payload := api.PostsResponse{
 		Posts: posts,
 	}
@@ -64,17 +76,23 @@ func HandleGetPosts(w http.ResponseWriter, r *http.Request) {
 // @Tags posts
 // @Produce json
 // @Param id path integer true "Post ID"
-// @Param sort query string false "Sorting criteria: new, old, popular (default: new)"
+// @Param sort query string false "Sorting criteria: new, old, popular, hot, top, controversial, rising (default: new)"
+// @Param period query string false "Window of the top sorting: day, week, month, year, all (default: all)"
 // @Param pageSize query integer false "Number of items per page (default: 20)"
 // @Param page query integer false "Page number (default: 1)"
 // @Success 200 {object} api.Response{payload=api.PostAndCommentsResponse, pagination=api.GeneralPagination} "Successful operation"
 // @Failure 400 {object} api.Response{error=api.ErrorDetails} "Invalid post ID"
+// @Failure 401 {object} api.Response{error=api.ErrorDetails} "Token is not valid or lacks the read scope"
 // @Router /posts/{id} [get]
-func HandleGetPostAndComments(w http.ResponseWriter, r *http.Request) {
+func (h *Handler) HandleGetPostAndComments(w http.ResponseWriter, r *http.Request) {
 	authenticated := false
 	var user *api.UserResponse
 
-	user, authenticated = services.AuthenticateUser(r)
+	user, authenticated, refused := h.auth.AuthorizeOptional(r, services.ScopePostsRead)
+	if refused {
+		refuseToken(w, services.ScopePostsRead)
+		return
+	}
 
 	params := services.GetRouteParams(r)
 	postID, err := strconv.Atoi(params["postId"])
@@ -83,23 +101,30 @@ func HandleGetPostAndComments(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	sortType, sortBy, page, pageSize := services.ExtractPaginationParams(r, "popular", "comments")
-	postRepo := repositories.NewPostRepository()
+	sortType, sortBy, page, pageSize := h.paginationParams(r, "popular", "comments")
+	postRepo := h.stores.Posts
 	post, err := postRepo.GetPostByID(postID, user.ID)
 	if err != nil {
 		services.HTTPError(w, http.StatusNotFound, "Not Found", "Post not found", authenticated, user, nil)
 		return
 	}
 
-	commentRepo := repositories.NewCommentRepository()
+	commentRepo := h.stores.Comments
 	comments, totalItems, totalPages, err := commentRepo.GetComments(page, pageSize, sortBy, "postID", postID, user.ID)
 	if err != nil {
 		services.HTTPError(w, http.StatusInternalServerError, "Internal Server Error", "Error fetching comments", authenticated, user, nil)
 		return
 	}
 
+	posts := []api.Post{*post}
+	h.setPostLinkPreviews(r, posts)
+	h.setPostReactions(r, posts, user.ID)
+	h.setPostPolls(r, posts, user.ID)
+	if comments != nil {
+		h.setCommentReactions(r, *comments, user.ID)
+	}
 	payload := api.PostAndCommentsResponse{
-		Post:     *post,
+		Post:     posts[0],
 		Comments: comments,
 	}
 
@@ -127,11 +152,11 @@ func HandleGetPostAndComments(w http.ResponseWriter, r *http.Request) {
 // @Failure 401 {object} api.Response{error=api.ErrorDetails} "Unauthorized: User is not authenticated"
 // @Failure 500 {object} api.Response{error=api.ErrorDetails} "Internal Server Error: Error creating post"
 // @Router /posts [post]
-func HandleCreatePost(w http.ResponseWriter, r *http.Request) {
+func (h *Handler) HandleCreatePost(w http.ResponseWriter, r *http.Request) {
 	authenticated := false
 	var user *api.UserResponse
 
-	user, authenticated = services.AuthenticateUser(r)
+	user, authenticated = h.auth.AuthorizeUser(r, services.ScopePostsWrite)
 	if !authenticated {
 		services.HTTPError(w, http.StatusUnauthorized, "Unauthorized", "User is not authenticated", false, nil, nil)
 		return
@@ -144,29 +169,31 @@ func HandleCreatePost(w http.ResponseWriter, r *http.Request) {
 	}
 
 	postForm.Title = services.TrimAndNormalizeSpaces(postForm.Title)
-	postForm.Content = services.TrimAndNormalizeSpaces(postForm.Content)
+	postForm.Content = services.TrimMarkdown(postForm.Content)
+	normalizePoll(postForm.Poll)
 
-	validationErrors := services.ValidateOperation("post", postForm)
+	validationErrors := h.settings.Validator.ValidateOperation("post", postForm)
 	if len(validationErrors) > 0 {
 		services.HTTPError(w, http.StatusBadRequest, "Validation error", "Validation error", authenticated, nil, validationErrors)
 		return
 	}
 	postForm.UserID = user.ID
+	postForm.CreatedAt = h.clock.Now()
 
-	postRepo := repositories.NewPostRepository()
+	postRepo := h.stores.Posts
 
-	if err := postRepo.Create(&postForm); err != nil {
-		log.Println("Error creating post:", err)
-		services.HTTPError(w, http.StatusInternalServerError, "Internal Server Error", "Error creating post", authenticated, user, nil)
+	err := postRepo.Create(&postForm, services.ParseCategories(postForm.Categories))
+	if errors.Is(err, repositories.ErrAttachmentNotFound) {
+		services.HTTPError(w, http.StatusBadRequest, "Bad Request", "Unknown attachment", authenticated, user, nil)
 		return
 	}
-
-	if err := postRepo.AddPostCategories(postForm.ID, services.ParseCategories(postForm.Categories)); err != nil {
-		log.Println("Error creating categories:", err)
-		services.HTTPError(w, http.StatusInternalServerError, "Internal Server Error", "Error creating categories", authenticated, user, nil)
+	if err != nil {
+		logging.FromContext(r.Context()).Error("Error creating post", "error", err)
+		services.HTTPError(w, http.StatusInternalServerError, "Internal Server Error", "Error creating post", authenticated, user, nil)
 		return
 	}
 
+	h.announcePost()
 	services.RespondWithJSON(w, http.StatusCreated, api.Response{
 		Status:        "success",
 		Message:       "Post created successfully",
@@ -176,6 +203,25 @@ func HandleCreatePost(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+// normalizePoll trims the question and options of the poll of a new post, if any
+func normalizePoll(poll *api.PollCreateRequest) {
+	if poll == nil {
+		return
+	}
+	poll.Question = services.TrimAndNormalizeSpaces(poll.Question)
+	for i, option := range poll.Options {
+		poll.Options[i] = services.TrimAndNormalizeSpaces(option)
+	}
+}
+
+// announcePost counts a new post and has its PostCreatedEvent handed to the
+// subscribers, which tell the users it mentions, preview its links and
+// publish it to webhooks
+func (h *Handler) announcePost() {
+	metrics.PostsCreated.Inc()
+	h.events.Wake()
+}
+
 // HandleCreateComment creates a new comment for a post
 // @Summary Create a new comment for a post
 // @Description Creates a new comment for a specified post ID. Requires authentication.
@@ -190,11 +236,11 @@ func HandleCreatePost(w http.ResponseWriter, r *http.Request) {
 // @Failure 401 {object} api.Response{error=api.ErrorDetails} "Unauthorized"
 // @Failure 500 {object} api.Response{error=api.ErrorDetails} "Internal server error"
 // @Router /posts/{postId}/comments [post]
-func HandleCreateComment(w http.ResponseWriter, r *http.Request) {
+func (h *Handler) HandleCreateComment(w http.ResponseWriter, r *http.Request) {
 	authenticated := false
 	var user *api.UserResponse
 
-	user, authenticated = services.AuthenticateUser(r)
+	user, authenticated = h.auth.AuthorizeUser(r, services.ScopeCommentsWrite)
 	if !authenticated {
 		services.HTTPError(w, http.StatusUnauthorized, "Unauthorized", "User is not authenticated", false, nil, nil)
 		return
@@ -213,33 +259,44 @@ func HandleCreateComment(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	commentForm.Content = services.TrimAndNormalizeSpaces(commentForm.Content)
+	commentForm.Content = services.TrimMarkdown(commentForm.Content)
 
-	validationErrors := services.ValidateOperation("comment", commentForm)
+	validationErrors := h.settings.Validator.ValidateOperation("comment", commentForm)
 	if len(validationErrors) > 0 {
 		services.HTTPError(w, http.StatusBadRequest, "Validation error", "Validation error", authenticated, nil, validationErrors)
 		return
 	}
 	commentForm.PostID = postID
 	commentForm.UserID = user.ID
-	commentRepo := repositories.NewCommentRepository()
+	commentForm.CreatedAt = h.clock.Now()
+	commentRepo := h.stores.Comments
 
-	if err := commentRepo.Create(&commentForm); err != nil {
-		log.Println("Error creating comment:", err)
+	err = commentRepo.Create(&commentForm)
+	if errors.Is(err, repositories.ErrAttachmentNotFound) {
+		services.HTTPError(w, http.StatusBadRequest, "Bad Request", "Unknown attachment", authenticated, user, nil)
+		return
+	}
+	if err != nil {
+		logging.FromContext(r.Context()).Error("Error creating comment", "error", err)
 		services.HTTPError(w, http.StatusInternalServerError, "Internal Server Error", "Error creating comment", authenticated, user, nil)
 		return
 	}
 	payload := api.CommentResponse{
 		Comment: api.Comment{
-			ID:        commentForm.ID,
-			PostID:    commentForm.PostID,
-			UserID:    commentForm.UserID,
-			Nickname:  user.Nickname,
-			Content:   commentForm.Content,
-			CreatedAt: commentForm.CreatedAt,
-			Rate:      api.Rate{Rate: 0, Status: ""},
+			ID:          commentForm.ID,
+			PostID:      commentForm.PostID,
+			UserID:      commentForm.UserID,
+			Nickname:    user.Nickname,
+			Content:     commentForm.Content,
+			ContentHTML: commentForm.ContentHTML,
+			CreatedAt:   commentForm.CreatedAt,
+			Rate:        api.Rate{Rate: 0, Status: ""},
+			Mentions:    commentForm.Mentions,
+			Attachments: commentForm.Attachments,
 		}}
 
+	metrics.CommentsCreated.Inc()
+	h.events.Wake()
 	services.RespondWithJSON(w, http.StatusCreated, api.Response{
 		Status:        "success",
 		Message:       "Comment added successfully",
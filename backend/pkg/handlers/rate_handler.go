@@ -2,11 +2,13 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
 	"project-root/pkg/api"
+	"project-root/pkg/logging"
+	"project-root/pkg/metrics"
 	"project-root/pkg/repositories"
 	"project-root/pkg/services"
-	"log"
 )
 
 // @Summary Rate a post or comment.
@@ -17,14 +19,16 @@ import (
 
 // @Param body body api.RateRequest true "Rate details"
 // @Success 200 {object} api.Response{payload=api.RateResponse} "Rating updated successfully"
+// @Failure 400 {object} api.Response{error=api.ErrorDetails} "Invalid vote"
 // @Failure 401 {object} api.Response{error=api.ErrorDetails} "Unauthorized"
+// @Failure 404 {object} api.Response{error=api.ErrorDetails} "Post or comment not found"
 // @Failure 500 {object} api.Response{error=api.ErrorDetails} "Internal Server Error"
 // @Router /rate [PUT]
-func HandleRate(w http.ResponseWriter, r *http.Request) {
+func (h *Handler) HandleRate(w http.ResponseWriter, r *http.Request) {
 	authenticated := false
 	var user *api.UserResponse
 
-	user, authenticated = services.AuthenticateUser(r)
+	user, authenticated = h.auth.AuthorizeUser(r, services.ScopeRatesWrite)
 	if !authenticated {
 		services.HTTPError(w, http.StatusUnauthorized, "Unauthorized", "User is not authenticated", false, nil, nil)
 		return
@@ -35,19 +39,37 @@ func HandleRate(w http.ResponseWriter, r *http.Request) {
 		services.HTTPError(w, http.StatusBadRequest, "Bad Request", "Invalid request payload", authenticated, user, nil)
 		return
 	}
-	log.Printf("Rate form: %v", rateForm)
+	logging.FromContext(r.Context()).Debug("Rate request", "post_id", rateForm.PostID, "comment_id", rateForm.CommentID, "status", rateForm.Status)
 
-	rate, status, err := repositories.UpdateRate(user.ID, rateForm)
+	validationErrors := h.settings.Validator.ValidateOperation("rate", rateForm)
+	if len(validationErrors) > 0 {
+		services.HTTPError(w, http.StatusBadRequest, "Validation error", "Validation error", authenticated, user, validationErrors)
+		return
+	}
+
+	rate, err := h.stores.Rates.UpdateRate(user.ID, rateForm)
+	if errors.Is(err, repositories.ErrRateTargetNotFound) {
+		services.HTTPError(w, http.StatusNotFound, "Not Found", "Rate target not found", authenticated, user, nil)
+		return
+	}
 	if err != nil {
+		logging.FromContext(r.Context()).Error("Error updating rating", "post_id", rateForm.PostID, "comment_id", rateForm.CommentID, "error", err)
 		services.HTTPError(w, http.StatusInternalServerError, "Internal Server Error", "Error updating rating", authenticated, user, nil)
 		return
 	}
 
-	payload := api.RateResponse{
-		Rate: api.Rate{
-			Rate:   rate,
-			Status: status},
+	target := "post"
+	if rateForm.CommentID != 0 {
+		target = "comment"
+	}
+	metricStatus := rate.Status
+	if metricStatus == "" {
+		metricStatus = "none"
 	}
+	metrics.RatesChanged.Inc(target, metricStatus)
+	h.events.Wake()
+
+	payload := api.RateResponse{Rate: rate}
 
 	services.RespondWithJSON(w, http.StatusOK, api.Response{
 		Status:        "success",
@@ -0,0 +1,182 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"project-root/pkg/api"
+	"project-root/pkg/logging"
+	"project-root/pkg/metrics"
+	"project-root/pkg/repositories"
+	"project-root/pkg/services"
+)
+
+// HandleReaction adds (PUT) or withdraws (DELETE) an emoji reaction.
+// @Summary React to a post, comment or chat message
+// @Description Adds the emoji with PUT and withdraws it with DELETE. Both are idempotent. Set post_id for a post, post_id and comment_id for a comment, or chat_hash and message_id for a message of a chat the user takes part in. A user may react with several emoji. Reactions to chat messages are sent to the chat as "reaction_added" and "reaction_removed" WebSocket messages.
+// @Tags reactions
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param body body api.ReactionRequest true "Reaction"
+// @Success 200 {object} api.Response{payload=api.ReactionsResponse} "Reaction updated successfully"
+// @Failure 400 {object} api.Response{error=api.ErrorDetails} "Bad request"
+// @Failure 401 {object} api.Response{error=api.ErrorDetails} "Unauthorized"
+// @Failure 404 {object} api.Response{error=api.ErrorDetails} "Reaction target not found"
+// @Failure 500 {object} api.Response{error=api.ErrorDetails} "Internal server error"
+// @Router /reactions [put]
+// @Router /reactions [delete]
+func (h *Handler) HandleReaction(w http.ResponseWriter, r *http.Request) {
+	user, authenticated := h.auth.AuthorizeUser(r, services.ScopeReactionsWrite)
+	if !authenticated {
+		services.HTTPError(w, http.StatusUnauthorized, "Unauthorized", "User is not authenticated", false, nil, nil)
+		return
+	}
+
+	var req api.ReactionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		services.HTTPError(w, http.StatusBadRequest, "Bad Request", "Invalid request payload", authenticated, user, nil)
+		return
+	}
+	validationErrors := h.settings.Validator.ValidateOperation("reaction", req)
+	if len(validationErrors) > 0 {
+		services.HTTPError(w, http.StatusBadRequest, "Validation error", "Validation error", authenticated, user, validationErrors)
+		return
+	}
+
+	added := r.Method != http.MethodDelete
+	var changed bool
+	var err error
+	if added {
+		changed, err = h.stores.Reactions.AddReaction(user.ID, req)
+	} else {
+		changed, err = h.stores.Reactions.RemoveReaction(user.ID, req)
+	}
+	if errors.Is(err, repositories.ErrReactionTargetNotFound) {
+		services.HTTPError(w, http.StatusNotFound, "Not Found", "Reaction target not found", authenticated, user, nil)
+		return
+	}
+	if err != nil {
+		logging.FromContext(r.Context()).Error("Error updating reaction", "error", err)
+		services.HTTPError(w, http.StatusInternalServerError, "Internal Server Error", "Error updating reaction", authenticated, user, nil)
+		return
+	}
+
+	reactions, err := h.targetReactions(req, user.ID)
+	if err != nil {
+		logging.FromContext(r.Context()).Error("Error fetching reactions", "error", err)
+		services.HTTPError(w, http.StatusInternalServerError, "Internal Server Error", "Error fetching reactions", authenticated, user, nil)
+		return
+	}
+
+	if changed {
+		action := "added"
+		if !added {
+			action = "removed"
+		}
+		metrics.ReactionsChanged.Inc(reactionTargetType(req), action)
+		if req.ChatHash != "" {
+			event := api.ReactionEvent{RoomHash: req.ChatHash, MessageID: req.MessageID, Emoji: req.Emoji, User: user}
+			for _, reaction := range reactions {
+				if reaction.Emoji == req.Emoji {
+					event.Count = reaction.Count
+				}
+			}
+			h.notifier.NotifyReaction("reaction_"+action, event)
+		}
+	}
+
+	services.RespondWithSuccess(w, http.StatusOK, "Reaction updated successfully", authenticated, api.ReactionsResponse{Reactions: reactions}, nil, user)
+}
+
+// targetReactions returns the reactions to the target of req, flagged for userID
+func (h *Handler) targetReactions(req api.ReactionRequest, userID int) ([]api.Reaction, error) {
+	var byID map[int][]api.Reaction
+	var id int
+	var err error
+	switch {
+	case req.ChatHash != "":
+		id = req.MessageID
+		byID, err = h.stores.Reactions.GetMessageReactions(req.ChatHash, userID)
+	case req.CommentID != 0:
+		id = req.CommentID
+		byID, err = h.stores.Reactions.GetCommentReactions([]int{id}, userID)
+	default:
+		id = req.PostID
+		byID, err = h.stores.Reactions.GetPostReactions([]int{id}, userID)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if byID[id] == nil {
+		return []api.Reaction{}, nil
+	}
+	return byID[id], nil
+}
+
+// reactionTargetType names the kind of content reacted to for the metrics
+func reactionTargetType(req api.ReactionRequest) string {
+	switch {
+	case req.ChatHash != "":
+		return "message"
+	case req.CommentID != 0:
+		return "comment"
+	default:
+		return "post"
+	}
+}
+
+// setPostReactions adds the reactions to the posts, flagged for userID.
+// Reactions are extras, so failing to read them only gets logged.
+func (h *Handler) setPostReactions(r *http.Request, posts []api.Post, userID int) {
+	if len(posts) == 0 {
+		return
+	}
+	ids := make([]int, len(posts))
+	for i := range posts {
+		ids[i] = posts[i].ID
+	}
+	reactions, err := h.stores.Reactions.GetPostReactions(ids, userID)
+	if err != nil {
+		logging.FromContext(r.Context()).Warn("Error fetching reactions", "error", err)
+		return
+	}
+	for i := range posts {
+		posts[i].Reactions = reactions[posts[i].ID]
+	}
+}
+
+// setCommentReactions adds the reactions to the comments, flagged for userID
+func (h *Handler) setCommentReactions(r *http.Request, comments []api.Comment, userID int) {
+	if len(comments) == 0 {
+		return
+	}
+	ids := make([]int, len(comments))
+	for i := range comments {
+		ids[i] = comments[i].ID
+	}
+	reactions, err := h.stores.Reactions.GetCommentReactions(ids, userID)
+	if err != nil {
+		logging.FromContext(r.Context()).Warn("Error fetching reactions", "error", err)
+		return
+	}
+	for i := range comments {
+		comments[i].Reactions = reactions[comments[i].ID]
+	}
+}
+
+// setMessageReactions adds the reactions to the messages of a chat, flagged for userID
+func (h *Handler) setMessageReactions(r *http.Request, chatHash string, messages []api.MessageMessage, userID int) {
+	if len(messages) == 0 {
+		return
+	}
+	reactions, err := h.stores.Reactions.GetMessageReactions(chatHash, userID)
+	if err != nil {
+		logging.FromContext(r.Context()).Warn("Error fetching reactions", "error", err)
+		return
+	}
+	for i := range messages {
+		messages[i].Reactions = reactions[messages[i].ID]
+	}
+}
@@ -0,0 +1,109 @@
+package handlers
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"project-root/pkg/logging"
+	"project-root/pkg/services"
+	"project-root/pkg/syndication"
+)
+
+// syndicationEntries is the number of newest posts in a feed
+const syndicationEntries = 30
+
+// HandleSyndicationFeed serves the newest posts of the forum, of a category
+// or of a user as an Atom or RSS feed, depending on the route variables
+// category, nickname and format ("atom" or "rss"). Feeds answer conditional
+// requests: the ETag is a hash of the document and Last-Modified the time of
+// the newest post.
+func (h *Handler) HandleSyndicationFeed(w http.ResponseWriter, r *http.Request) {
+	params := services.GetRouteParams(r)
+	// Links come from the configuration, never from the Host header, as
+	// feeds are cached by shared caches
+	base := strings.TrimSuffix(h.settings.PublicURL, "/")
+
+	feed := syndication.Feed{
+		Title:       "kood-rt-forum",
+		Description: "Newest posts on kood-rt-forum",
+		Link:        base + "/",
+	}
+	filterType, filterValue := "", ""
+	switch {
+	case params["category"] != "":
+		filterType, filterValue = "category", strings.ToLower(params["category"])
+		feed.Title = "#" + filterValue + " on kood-rt-forum"
+		feed.Description = "Newest posts filed under #" + filterValue
+		feed.Link = base + "/?search=" + url.QueryEscape("#"+filterValue)
+	case params["nickname"] != "":
+		author, err := h.stores.Users.GetUserByNickname(params["nickname"])
+		if errors.Is(err, sql.ErrNoRows) || (err == nil && author == nil) {
+			services.HTTPError(w, http.StatusNotFound, "User not found", "User not found", false, nil, nil)
+			return
+		}
+		if err != nil {
+			logging.FromContext(r.Context()).Error("Error fetching user", "error", err)
+			services.HTTPError(w, http.StatusInternalServerError, "Internal Server Error", "Error fetching user", false, nil, nil)
+			return
+		}
+		filterType, filterValue = "user_id", strconv.Itoa(author.ID)
+		feed.Title = author.Nickname + " on kood-rt-forum"
+		feed.Description = "Newest posts by " + author.Nickname
+		feed.Link = base + "/users/" + url.PathEscape(author.Nickname)
+	}
+	feed.Self = base + r.URL.EscapedPath()
+
+	_, sortBy := services.GetSortingCriteria("new", "posts")
+	posts, _, _, err := h.stores.Posts.GetPosts(1, syndicationEntries, sortBy, filterType, filterValue)
+	if err != nil {
+		logging.FromContext(r.Context()).Error("Error fetching posts", "error", err)
+		services.HTTPError(w, http.StatusInternalServerError, "Internal Server Error", "Error fetching posts", false, nil, nil)
+		return
+	}
+
+	// ServeContent sends no Last-Modified for the epoch, so an empty feed
+	// is only validated by its ETag
+	feed.Updated = time.Unix(0, 0)
+	for _, post := range posts {
+		entry := syndication.Entry{
+			Title:     post.Title,
+			Link:      base + "/post/" + strconv.Itoa(post.ID),
+			Author:    post.Nickname,
+			Published: post.CreatedAt,
+			Content:   post.ContentHTML,
+		}
+		for _, category := range post.Categories {
+			entry.Categories = append(entry.Categories, category.Name)
+		}
+		feed.Entries = append(feed.Entries, entry)
+		if post.CreatedAt.After(feed.Updated) {
+			feed.Updated = post.CreatedAt
+		}
+	}
+
+	render, contentType := syndication.Atom, syndication.AtomContentType
+	if params["format"] == "rss" {
+		render, contentType = syndication.RSS, syndication.RSSContentType
+	}
+	body, err := render(feed)
+	if err != nil {
+		logging.FromContext(r.Context()).Error("Error rendering feed", "error", err)
+		services.HTTPError(w, http.StatusInternalServerError, "Internal Server Error", "Error rendering feed", false, nil, nil)
+		return
+	}
+
+	sum := sha256.Sum256(body)
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("ETag", `"`+hex.EncodeToString(sum[:16])+`"`)
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	// ServeContent answers If-None-Match and If-Modified-Since with 304
+	http.ServeContent(w, r, "", feed.Updated, bytes.NewReader(body))
+}
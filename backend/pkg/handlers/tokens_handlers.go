@@ -0,0 +1,139 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"project-root/pkg/api"
+	"project-root/pkg/logging"
+	"project-root/pkg/repositories"
+	"project-root/pkg/services"
+)
+
+// HandleGetTokens lists the personal access tokens of the current user.
+// @Summary List personal access tokens
+// @Description Lists the personal access tokens of the authenticated user, including their last-used times. Requires a session cookie.
+// @Tags tokens
+// @Produce json
+// @Success 200 {object} api.Response{payload=api.TokensResponse} "Tokens fetched successfully"
+// @Failure 401 {object} api.Response{error=api.ErrorDetails} "Unauthorized"
+// @Router /tokens [get]
+func (h *Handler) HandleGetTokens(w http.ResponseWriter, r *http.Request) {
+	// Tokens can only be managed from a browser session, never with another token
+	user, authenticated := h.auth.AuthenticateSession(r)
+	if !authenticated {
+		services.HTTPError(w, http.StatusUnauthorized, "Unauthorized", "User is not authenticated", false, nil, nil)
+		return
+	}
+
+	tokenRepo := h.stores.Tokens
+	tokens, err := tokenRepo.GetTokensForUser(user.ID)
+	if err != nil {
+		logging.FromContext(r.Context()).Error("Error fetching tokens", "error", err)
+		services.HTTPError(w, http.StatusInternalServerError, "Internal Server Error", "Error fetching tokens", authenticated, user, nil)
+		return
+	}
+
+	services.RespondWithSuccess(w, http.StatusOK, "Tokens fetched successfully", authenticated, api.TokensResponse{Tokens: tokens}, nil, user)
+}
+
+// HandleCreateToken creates a new personal access token.
+// @Summary Create a personal access token
+// @Description Creates a named, scoped and optionally expiring token for use in the Authorization: Bearer header. The secret is only returned once.
+// @Tags tokens
+// @Accept json
+// @Produce json
+// @Param body body api.TokenCreateRequest true "Token data"
+// @Success 201 {object} api.Response{payload=api.TokenCreateResponse} "Token created successfully"
+// @Failure 400 {object} api.Response{error=api.ErrorDetails} "Invalid request payload"
+// @Failure 401 {object} api.Response{error=api.ErrorDetails} "Unauthorized"
+// @Router /tokens [post]
+func (h *Handler) HandleCreateToken(w http.ResponseWriter, r *http.Request) {
+	user, authenticated := h.auth.AuthenticateSession(r)
+	if !authenticated {
+		services.HTTPError(w, http.StatusUnauthorized, "Unauthorized", "User is not authenticated", false, nil, nil)
+		return
+	}
+
+	var tokenForm api.TokenCreateRequest
+	if err := json.NewDecoder(r.Body).Decode(&tokenForm); err != nil {
+		services.HTTPError(w, http.StatusBadRequest, "Bad Request", "Invalid request payload", authenticated, user, nil)
+		return
+	}
+	tokenForm.Name = strings.TrimSpace(tokenForm.Name)
+
+	validationErrors := h.settings.Validator.ValidateOperation("token", tokenForm)
+	if len(validationErrors) > 0 {
+		services.HTTPError(w, http.StatusBadRequest, "Validation error", "Validation error", authenticated, user, validationErrors)
+		return
+	}
+	tokenForm.UserID = user.ID
+
+	secret, err := services.GenerateToken()
+	if err != nil {
+		logging.FromContext(r.Context()).Error("Error generating token", "error", err)
+		services.HTTPError(w, http.StatusInternalServerError, "Internal Server Error", "Error generating token", authenticated, user, nil)
+		return
+	}
+
+	var expiresAt *time.Time
+	if tokenForm.ExpiresInDays > 0 {
+		t := h.clock.Now().Add(time.Duration(tokenForm.ExpiresInDays) * 24 * time.Hour)
+		expiresAt = &t
+	}
+
+	tokenRepo := h.stores.Tokens
+	token, err := tokenRepo.Create(tokenForm.UserID, tokenForm.Name, services.HashToken(secret), tokenForm.Scopes, expiresAt)
+	if err != nil {
+		logging.FromContext(r.Context()).Error("Error creating token", "error", err)
+		services.HTTPError(w, http.StatusInternalServerError, "Internal Server Error", "Error creating token", authenticated, user, nil)
+		return
+	}
+
+	payload := api.TokenCreateResponse{
+		Token:  *token,
+		Secret: secret,
+	}
+	services.RespondWithSuccess(w, http.StatusCreated, "Token created successfully", authenticated, payload, nil, user)
+}
+
+// HandleDeleteToken revokes a personal access token.
+// @Summary Revoke a personal access token
+// @Description Deletes a personal access token owned by the authenticated user.
+// @Tags tokens
+// @Produce json
+// @Param tokenId path integer true "Token ID"
+// @Success 200 {object} api.Response "Token revoked successfully"
+// @Failure 401 {object} api.Response{error=api.ErrorDetails} "Unauthorized"
+// @Failure 404 {object} api.Response{error=api.ErrorDetails} "Token not found"
+// @Router /tokens/{tokenId} [delete]
+func (h *Handler) HandleDeleteToken(w http.ResponseWriter, r *http.Request) {
+	user, authenticated := h.auth.AuthenticateSession(r)
+	if !authenticated {
+		services.HTTPError(w, http.StatusUnauthorized, "Unauthorized", "User is not authenticated", false, nil, nil)
+		return
+	}
+
+	params := services.GetRouteParams(r)
+	tokenID, err := strconv.Atoi(params["tokenId"])
+	if err != nil {
+		services.HTTPError(w, http.StatusBadRequest, "Bad Request", "Invalid token ID", authenticated, user, nil)
+		return
+	}
+
+	tokenRepo := h.stores.Tokens
+	if err := tokenRepo.Delete(user.ID, tokenID); err != nil {
+		if err == repositories.ErrTokenNotFound {
+			services.HTTPError(w, http.StatusNotFound, "Not Found", "Token not found", authenticated, user, nil)
+			return
+		}
+		logging.FromContext(r.Context()).Error("Error deleting token", "error", err)
+		services.HTTPError(w, http.StatusInternalServerError, "Internal Server Error", "Error deleting token", authenticated, user, nil)
+		return
+	}
+
+	services.RespondWithSuccess(w, http.StatusOK, "Token revoked successfully", authenticated, nil, nil, user)
+}
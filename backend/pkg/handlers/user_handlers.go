@@ -3,8 +3,9 @@ package handlers
 import (
 	"net/http"
 	"project-root/pkg/api"
-	"project-root/pkg/repositories"
+	"project-root/pkg/logging"
 	"project-root/pkg/services"
+	"strings"
 )
 
 // HandleGetUser retrieves posts or comments by user nickname with pagination and sorting.
@@ -14,19 +15,25 @@ import (
 // @Produce json
 // @Param nickname path string true "User Nickname (e.g., admin)"
 // @Param type path string true "Type of data to retrieve: posts or comments"
-// @Param sort query string false "Sorting criteria: new, old, popular (default: new)"
+// @Param sort query string false "Sorting criteria: new, old, popular, hot, top, controversial, rising (default: new)"
+// @Param period query string false "Window of the top sorting: day, week, month, year, all (default: all)"
 // @Param pageSize query integer false "Number of items per page (default: 20)"
 // @Param page query integer false "Page number (default: 1)"
 // @Success 200 {object} api.Response{payload=api.GetUserResponse, pagination=api.GeneralPagination} "Successful operation"
 // @Failure 404 {object} api.Response{error=api.ErrorDetails} "User not found"
+// @Failure 401 {object} api.Response{error=api.ErrorDetails} "Token is not valid or lacks the read scope"
 // @Router /users/{nickname}/{type} [get]
-func HandleGetUser(w http.ResponseWriter, r *http.Request) {
+func (h *Handler) HandleGetUser(w http.ResponseWriter, r *http.Request) {
 	authenticated := false
 	var user *api.UserResponse
 
-	user, authenticated = services.AuthenticateUser(r)
+	user, authenticated, refused := h.auth.AuthorizeOptional(r, services.ScopeUsersRead)
+	if refused {
+		refuseToken(w, services.ScopeUsersRead)
+		return
+	}
 	params := services.GetRouteParams(r)
-	userInfo, err := repositories.GetUserByNickname(params["nickname"])
+	userInfo, err := h.stores.Users.GetUserByNickname(params["nickname"])
 	if err != nil {
 		services.HTTPError(w, http.StatusInternalServerError, "Internal Server Error", "Error fetching user", authenticated, user, nil)
 		return
@@ -36,7 +43,7 @@ func HandleGetUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	sortType, sortBy, page, pageSize := services.ExtractPaginationParams(r, "new", params["type"])
+	sortType, sortBy, page, pageSize := h.paginationParams(r, "new", params["type"])
 
 	var (
 		payload    api.GetUserResponse
@@ -46,7 +53,7 @@ func HandleGetUser(w http.ResponseWriter, r *http.Request) {
 
 	switch params["type"] {
 	case "posts":
-		postRepo := repositories.NewPostRepository()
+		postRepo := h.stores.Posts
 		posts, items, pages, err := postRepo.GetPosts(page, pageSize, sortBy, "nickname", params["nickname"])
 		if err != nil {
 			services.HTTPError(w, http.StatusInternalServerError, "Internal Server Error", "Error fetching posts", authenticated, user, nil)
@@ -54,12 +61,16 @@ func HandleGetUser(w http.ResponseWriter, r *http.Request) {
 		}
 		totalItems = items
 		totalPages = pages
+		h.setPostLinkPreviews(r, posts)
+		h.setPostReactions(r, posts, user.ID)
+		h.setPostBookmarks(r, posts, user.ID)
+		h.setPostPolls(r, posts, user.ID)
 		payload = api.GetUserResponse{
 			User:  *userInfo,
 			Posts: posts,
 		}
 	case "comments":
-		commentRepo := repositories.NewCommentRepository()
+		commentRepo := h.stores.Comments
 		comments, items, pages, err := commentRepo.GetComments(page, pageSize, sortBy, "nickname", params["nickname"], user.ID)
 		if err != nil {
 			services.HTTPError(w, http.StatusInternalServerError, "Internal Server Error", "Error fetching comments", authenticated, user, nil)
@@ -67,6 +78,7 @@ func HandleGetUser(w http.ResponseWriter, r *http.Request) {
 		}
 		totalItems = items
 		totalPages = pages
+		h.setCommentReactions(r, *comments, user.ID)
 		payload = api.GetUserResponse{
 			User:     *userInfo,
 			Comments: *comments,
@@ -101,15 +113,20 @@ func HandleGetUser(w http.ResponseWriter, r *http.Request) {
 // @Param pageSize query integer false "Number of items per page (default: 20)"
 // @Param page query integer false "Page number (default: 1)"
 // @Success 200 {object} api.Response{payload=api.GetUsersResponse, pagination=api.GeneralPagination} "Successful operation"
+// @Failure 401 {object} api.Response{error=api.ErrorDetails} "Token is not valid or lacks the read scope"
 // @Router /users [get]
-func HandleGetUsers(w http.ResponseWriter, r *http.Request) {
+func (h *Handler) HandleGetUsers(w http.ResponseWriter, r *http.Request) {
 	authenticated := false
 	var user *api.UserResponse
 
-	user, authenticated = services.AuthenticateUser(r)
-	sortType, sortBy, page, pageSize := services.ExtractPaginationParams(r, "name_ABC", "users")
+	user, authenticated, refused := h.auth.AuthorizeOptional(r, services.ScopeUsersRead)
+	if refused {
+		refuseToken(w, services.ScopeUsersRead)
+		return
+	}
+	sortType, sortBy, page, pageSize := h.paginationParams(r, "name_ABC", "users")
 
-	userRepo := repositories.NewUserRepository()
+	userRepo := h.stores.Users
 	users, totalItems, totalPages, err := userRepo.GetAllUsers(page, pageSize, sortBy, user.ID)
 	if err != nil {
 		services.HTTPError(w, http.StatusInternalServerError, "Internal Server Error", "Error fetching users", authenticated, user, nil)
@@ -130,3 +147,37 @@ func HandleGetUsers(w http.ResponseWriter, r *http.Request) {
 	services.RespondWithSuccess(w, http.StatusOK, "Data fetched successfully", authenticated, payload, pagination, user)
 
 }
+
+// autocompleteLimit is the number of users suggested for a prefix
+const autocompleteLimit = 10
+
+// HandleAutocompleteUsers suggests users to mention for a nickname prefix.
+// @Summary Autocomplete nicknames
+// @Description Lists up to 10 users whose nicknames start with the prefix, ignoring case, shortest first. A leading @ is ignored.
+// @Tags users
+// @Produce json
+// @Param prefix query string true "Start of the nickname (e.g., @Test)"
+// @Success 200 {object} api.Response{payload=api.UsersAutocompleteResponse} "Successful operation"
+// @Failure 500 {object} api.Response{error=api.ErrorDetails} "Internal Server Error"
+// @Failure 401 {object} api.Response{error=api.ErrorDetails} "Token is not valid or lacks the read scope"
+// @Router /users/autocomplete [get]
+func (h *Handler) HandleAutocompleteUsers(w http.ResponseWriter, r *http.Request) {
+	user, authenticated, refused := h.auth.AuthorizeOptional(r, services.ScopeUsersRead)
+	if refused {
+		refuseToken(w, services.ScopeUsersRead)
+		return
+	}
+
+	payload := api.UsersAutocompleteResponse{Users: []api.UserResponse{}}
+	prefix := strings.TrimPrefix(strings.TrimSpace(r.URL.Query().Get("prefix")), "@")
+	if prefix != "" {
+		users, err := h.stores.Users.AutocompleteUsers(prefix, autocompleteLimit)
+		if err != nil {
+			logging.FromContext(r.Context()).Error("Error autocompleting users", "error", err)
+			services.HTTPError(w, http.StatusInternalServerError, "Internal Server Error", "Error fetching users", authenticated, user, nil)
+			return
+		}
+		payload.Users = users
+	}
+	services.RespondWithSuccess(w, http.StatusOK, "Data fetched successfully", authenticated, payload, nil, user)
+}
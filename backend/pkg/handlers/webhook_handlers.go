@@ -0,0 +1,259 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"project-root/pkg/api"
+	"project-root/pkg/logging"
+	"project-root/pkg/repositories"
+	"project-root/pkg/services"
+)
+
+// HandleWebhooks lists (GET) or registers (POST) webhooks.
+// @Summary List or register webhooks
+// @Description Lists the webhooks (GET) or registers an endpoint for the given events (POST): post.created, comment.created, rate.changed, user.registered and chat.created. The secret that signs the deliveries is only returned on registration. Only available to admins.
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param body body api.WebhookRequest false "Webhook, POST only"
+// @Success 200 {object} api.Response{payload=api.WebhooksResponse} "Webhooks fetched successfully"
+// @Success 201 {object} api.Response{payload=api.WebhookCreateResponse} "Webhook created successfully"
+// @Failure 400 {object} api.Response{error=api.ErrorDetails} "Bad request"
+// @Failure 403 {object} api.Response{error=api.ErrorDetails} "Forbidden"
+// @Failure 500 {object} api.Response{error=api.ErrorDetails} "Internal server error"
+// @Router /admin/webhooks [get]
+// @Router /admin/webhooks [post]
+func (h *Handler) HandleWebhooks(w http.ResponseWriter, r *http.Request) {
+	user, authenticated := h.auth.AuthenticateSession(r)
+	if !h.settings.Security.IsAdmin(user) {
+		services.HTTPError(w, http.StatusForbidden, "Forbidden", "Admin access required", authenticated, user, nil)
+		return
+	}
+
+	if r.Method == http.MethodGet {
+		webhooks, err := h.stores.Webhooks.GetWebhooks()
+		if err != nil {
+			logging.FromContext(r.Context()).Error("Error fetching webhooks", "error", err)
+			services.HTTPError(w, http.StatusInternalServerError, "Internal Server Error", "Error fetching webhooks", authenticated, user, nil)
+			return
+		}
+		services.RespondWithSuccess(w, http.StatusOK, "Webhooks fetched successfully", authenticated, api.WebhooksResponse{Webhooks: webhooks}, nil, user)
+		return
+	}
+
+	req, ok := h.decodeWebhook(w, r, user)
+	if !ok {
+		return
+	}
+	secret, err := services.GenerateWebhookSecret()
+	if err != nil {
+		logging.FromContext(r.Context()).Error("Error generating webhook secret", "error", err)
+		services.HTTPError(w, http.StatusInternalServerError, "Internal Server Error", "Error creating webhook", authenticated, user, nil)
+		return
+	}
+
+	webhook := api.Webhook{
+		URL:       req.URL,
+		Events:    req.Events,
+		Active:    req.Active == nil || *req.Active,
+		Secret:    secret,
+		CreatedAt: h.clock.Now(),
+	}
+	if err := h.stores.Webhooks.CreateWebhook(&webhook); err != nil {
+		logging.FromContext(r.Context()).Error("Error creating webhook", "error", err)
+		services.HTTPError(w, http.StatusInternalServerError, "Internal Server Error", "Error creating webhook", authenticated, user, nil)
+		return
+	}
+
+	logging.FromContext(r.Context()).Info("Webhook registered", "webhook_id", webhook.ID, "url", webhook.URL, "user_id", user.ID)
+	services.RespondWithSuccess(w, http.StatusCreated, "Webhook created successfully", authenticated, api.WebhookCreateResponse{Webhook: webhook, Secret: secret}, nil, user)
+}
+
+// HandleWebhook changes (PUT) or removes (DELETE) a webhook.
+// @Summary Update or delete a webhook
+// @Description Replaces the URL, events and state of the webhook with PUT, validated like on registration; active is left as it was unless set. DELETE removes the webhook with its delivery log and takes no body. Only available to admins.
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param webhookId path integer true "Webhook ID"
+// @Param body body api.WebhookRequest false "Webhook, PUT only"
+// @Success 200 {object} api.Response{payload=api.WebhookResponse} "Webhook updated successfully"
+// @Failure 400 {object} api.Response{error=api.ErrorDetails} "Bad request"
+// @Failure 403 {object} api.Response{error=api.ErrorDetails} "Forbidden"
+// @Failure 404 {object} api.Response{error=api.ErrorDetails} "Webhook not found"
+// @Failure 500 {object} api.Response{error=api.ErrorDetails} "Internal server error"
+// @Router /admin/webhooks/{webhookId} [put]
+// @Router /admin/webhooks/{webhookId} [delete]
+func (h *Handler) HandleWebhook(w http.ResponseWriter, r *http.Request) {
+	user, authenticated := h.auth.AuthenticateSession(r)
+	if !h.settings.Security.IsAdmin(user) {
+		services.HTTPError(w, http.StatusForbidden, "Forbidden", "Admin access required", authenticated, user, nil)
+		return
+	}
+
+	webhookID, err := strconv.Atoi(services.GetRouteParams(r)["webhookId"])
+	if err != nil {
+		services.HTTPError(w, http.StatusBadRequest, "Bad Request", "Invalid webhook ID", authenticated, user, nil)
+		return
+	}
+
+	if r.Method == http.MethodDelete {
+		err := h.stores.Webhooks.DeleteWebhook(webhookID)
+		if errors.Is(err, repositories.ErrWebhookNotFound) {
+			services.HTTPError(w, http.StatusNotFound, "Not Found", "Webhook not found", authenticated, user, nil)
+			return
+		}
+		if err != nil {
+			logging.FromContext(r.Context()).Error("Error deleting webhook", "webhook_id", webhookID, "error", err)
+			services.HTTPError(w, http.StatusInternalServerError, "Internal Server Error", "Error deleting webhook", authenticated, user, nil)
+			return
+		}
+		logging.FromContext(r.Context()).Info("Webhook deleted", "webhook_id", webhookID, "user_id", user.ID)
+		services.RespondWithSuccess(w, http.StatusOK, "Webhook deleted successfully", authenticated, nil, nil, user)
+		return
+	}
+
+	req, ok := h.decodeWebhook(w, r, user)
+	if !ok {
+		return
+	}
+
+	webhook, err := h.stores.Webhooks.GetWebhook(webhookID)
+	if err == nil {
+		webhook.URL = req.URL
+		webhook.Events = req.Events
+		if req.Active != nil {
+			webhook.Active = *req.Active
+		}
+		err = h.stores.Webhooks.UpdateWebhook(*webhook)
+	}
+	if errors.Is(err, repositories.ErrWebhookNotFound) {
+		services.HTTPError(w, http.StatusNotFound, "Not Found", "Webhook not found", authenticated, user, nil)
+		return
+	}
+	if err != nil {
+		logging.FromContext(r.Context()).Error("Error updating webhook", "webhook_id", webhookID, "error", err)
+		services.HTTPError(w, http.StatusInternalServerError, "Internal Server Error", "Error updating webhook", authenticated, user, nil)
+		return
+	}
+
+	services.RespondWithSuccess(w, http.StatusOK, "Webhook updated successfully", authenticated, api.WebhookResponse{Webhook: *webhook}, nil, user)
+}
+
+// HandleGetWebhookDeliveries lists the delivery log of a webhook
+// @Summary List webhook deliveries
+// @Description Lists the deliveries queued for the webhook, newest first, with their payload, status, attempts and the outcome of the last attempt. Only available to admins.
+// @Tags admin
+// @Produce json
+// @Param webhookId path integer true "Webhook ID"
+// @Param pageSize query integer false "Number of items per page (default: 20)"
+// @Param page query integer false "Page number (default: 1)"
+// @Success 200 {object} api.Response{payload=api.WebhookDeliveriesResponse, pagination=api.GeneralPagination} "Deliveries fetched successfully"
+// @Failure 403 {object} api.Response{error=api.ErrorDetails} "Forbidden"
+// @Failure 404 {object} api.Response{error=api.ErrorDetails} "Webhook or page not found"
+// @Failure 500 {object} api.Response{error=api.ErrorDetails} "Internal server error"
+// @Router /admin/webhooks/{webhookId}/deliveries [get]
+func (h *Handler) HandleGetWebhookDeliveries(w http.ResponseWriter, r *http.Request) {
+	user, authenticated := h.auth.AuthenticateSession(r)
+	if !h.settings.Security.IsAdmin(user) {
+		services.HTTPError(w, http.StatusForbidden, "Forbidden", "Admin access required", authenticated, user, nil)
+		return
+	}
+
+	webhookID, _ := strconv.Atoi(services.GetRouteParams(r)["webhookId"])
+	// The log is always newest first, so only the page is taken from the request
+	_, _, page, pageSize := h.paginationParams(r, "new", "deliveries")
+
+	if _, err := h.stores.Webhooks.GetWebhook(webhookID); err != nil {
+		if errors.Is(err, repositories.ErrWebhookNotFound) {
+			services.HTTPError(w, http.StatusNotFound, "Not Found", "Webhook not found", authenticated, user, nil)
+			return
+		}
+		logging.FromContext(r.Context()).Error("Error fetching webhook", "webhook_id", webhookID, "error", err)
+		services.HTTPError(w, http.StatusInternalServerError, "Internal Server Error", "Error fetching deliveries", authenticated, user, nil)
+		return
+	}
+
+	deliveries, totalItems, totalPages, err := h.stores.Webhooks.GetDeliveries(webhookID, page, pageSize)
+	if err != nil {
+		logging.FromContext(r.Context()).Error("Error fetching webhook deliveries", "webhook_id", webhookID, "error", err)
+		services.HTTPError(w, http.StatusInternalServerError, "Internal Server Error", "Error fetching deliveries", authenticated, user, nil)
+		return
+	}
+	if page > totalPages && totalItems > 0 {
+		services.HTTPError(w, http.StatusNotFound, "Not Found", "Page not found", authenticated, user, nil)
+		return
+	}
+
+	pagination := &api.GeneralPagination{
+		CurrentPage: page,
+		PerPage:     pageSize,
+		TotalCount:  totalItems,
+		TotalPages:  totalPages,
+		OrderBy:     "new",
+	}
+	services.RespondWithSuccess(w, http.StatusOK, "Deliveries fetched successfully", authenticated, api.WebhookDeliveriesResponse{Deliveries: deliveries}, pagination, user)
+}
+
+// HandleRedeliverWebhookDelivery queues a delivery again
+// @Summary Redeliver a webhook delivery
+// @Description Queues the delivery to be sent again right away with its original payload and a fresh series of attempts, whatever its status. Only available to admins.
+// @Tags admin
+// @Produce json
+// @Param webhookId path integer true "Webhook ID"
+// @Param deliveryId path integer true "Delivery ID"
+// @Success 202 {object} api.Response{payload=api.WebhookDeliveryResponse} "Delivery queued"
+// @Failure 403 {object} api.Response{error=api.ErrorDetails} "Forbidden"
+// @Failure 404 {object} api.Response{error=api.ErrorDetails} "Delivery not found"
+// @Failure 500 {object} api.Response{error=api.ErrorDetails} "Internal server error"
+// @Router /admin/webhooks/{webhookId}/deliveries/{deliveryId}/redeliver [post]
+func (h *Handler) HandleRedeliverWebhookDelivery(w http.ResponseWriter, r *http.Request) {
+	user, authenticated := h.auth.AuthenticateSession(r)
+	if !h.settings.Security.IsAdmin(user) {
+		services.HTTPError(w, http.StatusForbidden, "Forbidden", "Admin access required", authenticated, user, nil)
+		return
+	}
+
+	params := services.GetRouteParams(r)
+	webhookID, _ := strconv.Atoi(params["webhookId"])
+	deliveryID, _ := strconv.Atoi(params["deliveryId"])
+
+	delivery, err := h.stores.Webhooks.RedeliverDelivery(webhookID, deliveryID, h.clock.Now())
+	if errors.Is(err, repositories.ErrWebhookDeliveryNotFound) {
+		services.HTTPError(w, http.StatusNotFound, "Not Found", "Delivery not found", authenticated, user, nil)
+		return
+	}
+	if err != nil {
+		logging.FromContext(r.Context()).Error("Error queueing webhook delivery", "delivery_id", deliveryID, "error", err)
+		services.HTTPError(w, http.StatusInternalServerError, "Internal Server Error", "Error queueing delivery", authenticated, user, nil)
+		return
+	}
+
+	h.webhooks.Wake()
+	services.RespondWithSuccess(w, http.StatusAccepted, "Delivery queued", authenticated, api.WebhookDeliveryResponse{Delivery: *delivery}, nil, user)
+}
+
+// decodeWebhook reads, normalizes and validates the webhook in the request
+// body and reports whether it may be saved, answering the request otherwise
+func (h *Handler) decodeWebhook(w http.ResponseWriter, r *http.Request, user *api.UserResponse) (api.WebhookRequest, bool) {
+	var req api.WebhookRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		services.HTTPError(w, http.StatusBadRequest, "Bad Request", "Invalid request payload", true, user, nil)
+		return req, false
+	}
+
+	req.URL = strings.TrimSpace(req.URL)
+	slices.Sort(req.Events)
+	req.Events = slices.Compact(req.Events)
+
+	if validationErrors := h.settings.Validator.ValidateOperation("webhook", req); len(validationErrors) > 0 {
+		services.HTTPError(w, http.StatusBadRequest, "Validation error", "Validation error", true, user, validationErrors)
+		return req, false
+	}
+	return req, true
+}
@@ -0,0 +1,104 @@
+package logging
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"project-root/pkg/middleware"
+
+	"github.com/google/uuid"
+)
+
+// RequestIDHeader is the header used to accept and propagate request IDs
+const RequestIDHeader = "X-Request-ID"
+
+type contextKey int
+
+const (
+	loggerKey contextKey = iota
+	requestIDKey
+)
+
+// New creates a logger writing JSON (or text) records at the level held by levelVar
+func New(w io.Writer, format string, levelVar *slog.LevelVar) *slog.Logger {
+	opts := &slog.HandlerOptions{Level: levelVar}
+	if strings.EqualFold(format, "text") {
+		return slog.New(slog.NewTextHandler(w, opts))
+	}
+	return slog.New(slog.NewJSONHandler(w, opts))
+}
+
+// ParseLevel converts a level name (debug, info, warn, error) to a slog.Level
+func ParseLevel(name string) (slog.Level, error) {
+	var level slog.Level
+	err := level.UnmarshalText([]byte(name))
+	return level, err
+}
+
+// WithLogger stores a logger in the context
+func WithLogger(ctx context.Context, logger *slog.Logger) context.Context {
+	return context.WithValue(ctx, loggerKey, logger)
+}
+
+// FromContext returns the request-scoped logger, or the default logger if none is set
+func FromContext(ctx context.Context) *slog.Logger {
+	if logger, ok := ctx.Value(loggerKey).(*slog.Logger); ok {
+		return logger
+	}
+	return slog.Default()
+}
+
+// RequestID returns the request ID stored in the context
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey).(string)
+	return id
+}
+
+// Middleware assigns every request an ID (reusing a well-formed incoming
+// X-Request-ID), echoes it in the response, stores a logger carrying it in the
+// request context and logs each completed request.
+func Middleware(logger *slog.Logger) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+
+			requestID := r.Header.Get(RequestIDHeader)
+			if !validRequestID(requestID) {
+				requestID = uuid.New().String()
+			}
+			w.Header().Set(RequestIDHeader, requestID)
+
+			reqLogger := logger.With(slog.String("request_id", requestID))
+			ctx := context.WithValue(r.Context(), requestIDKey, requestID)
+			ctx = WithLogger(ctx, reqLogger)
+
+			rec := middleware.NewStatusRecorder(w)
+			next.ServeHTTP(rec, r.WithContext(ctx))
+
+			reqLogger.LogAttrs(ctx, slog.LevelInfo, "request completed",
+				slog.String("method", r.Method),
+				slog.String("path", r.URL.Path),
+				slog.Int("status", rec.Status),
+				slog.Duration("duration", time.Since(start)),
+				slog.String("remote_addr", r.RemoteAddr),
+			)
+		})
+	}
+}
+
+// validRequestID accepts short printable IDs so clients cannot inject log noise
+func validRequestID(id string) bool {
+	if id == "" || len(id) > 128 {
+		return false
+	}
+	for _, c := range id {
+		if c < 0x21 || c > 0x7e {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,335 @@
+package markdown
+
+import (
+	"html"
+	"strings"
+)
+
+// linkRel is set on every link, since the targets are chosen by users
+const linkRel = "nofollow ugc noopener"
+
+// renderInline renders the inline markup of a paragraph
+func renderInline(text string) string {
+	var b strings.Builder
+	writeInline(&b, strings.TrimRight(text, " \t"), true)
+	return b.String()
+}
+
+// writeInline writes text with its code spans, emphasis, links and line
+// breaks. Link texts cannot contain further links.
+func writeInline(b *strings.Builder, s string, links bool) {
+	for i := 0; i < len(s); {
+		switch s[i] {
+		case '\\':
+			if i+1 < len(s) && isPunct(s[i+1]) {
+				b.WriteString(html.EscapeString(s[i+1 : i+2]))
+				i += 2
+				continue
+			}
+			if i+1 < len(s) && s[i+1] == '\n' {
+				b.WriteString("<br>\n")
+				i += 2
+				continue
+			}
+		case ' ':
+			// Two or more spaces before a newline make a hard line break
+			n := runLength(s, i)
+			if i+n < len(s) && s[i+n] == '\n' {
+				if n >= 2 {
+					b.WriteString("<br>")
+				}
+				b.WriteString("\n")
+				i += n + 1
+				continue
+			}
+			b.WriteString(s[i : i+n])
+			i += n
+			continue
+		case '`':
+			if end, code, ok := codeSpan(s, i); ok {
+				b.WriteString("<code>" + html.EscapeString(code) + "</code>")
+				i = end
+				continue
+			}
+			// An unmatched run of backticks is literal text
+			n := runLength(s, i)
+			b.WriteString(s[i : i+n])
+			i += n
+			continue
+		case '<':
+			if end, href, label, ok := autolink(s, i); ok && links {
+				b.WriteString(`<a href="` + html.EscapeString(href) + `" rel="` + linkRel + `">` + html.EscapeString(label) + "</a>")
+				i = end
+				continue
+			}
+		case '[':
+			if end, text, href, title, ok := inlineLink(s, i); ok && links {
+				if !safeURL(href) {
+					writeInline(b, text, false)
+				} else {
+					b.WriteString(`<a href="` + html.EscapeString(href) + `"`)
+					if title != "" {
+						b.WriteString(` title="` + html.EscapeString(title) + `"`)
+					}
+					b.WriteString(` rel="` + linkRel + `">`)
+					writeInline(b, text, false)
+					b.WriteString("</a>")
+				}
+				i = end
+				continue
+			}
+		case '*', '_':
+			if end, tag, inner, ok := emphasis(s, i); ok {
+				b.WriteString("<" + tag + ">")
+				writeInline(b, inner, links)
+				b.WriteString("</" + tag + ">")
+				i = end
+				continue
+			}
+			// Delimiters that open or close nothing are literal text
+			n := runLength(s, i)
+			b.WriteString(s[i : i+n])
+			i += n
+			continue
+		}
+		b.WriteString(html.EscapeString(s[i : i+1]))
+		i++
+	}
+}
+
+// codeSpan matches the code span opened by the backticks at s[i] and returns
+// the index after it and its content
+func codeSpan(s string, i int) (end int, code string, ok bool) {
+	n := runLength(s, i)
+	for j := i + n; j < len(s); {
+		if s[j] != '`' {
+			j++
+			continue
+		}
+		m := runLength(s, j)
+		if m == n {
+			code = strings.ReplaceAll(s[i+n:j], "\n", " ")
+			if len(code) >= 2 && code[0] == ' ' && code[len(code)-1] == ' ' && strings.Trim(code, " ") != "" {
+				code = code[1 : len(code)-1]
+			}
+			return j + m, code, true
+		}
+		j += m
+	}
+	return 0, "", false
+}
+
+// emphasis matches the emphasis opened by the delimiter run at s[i]. Runs of
+// two delimiters make strong emphasis, single ones emphasis and three both;
+// underscores do not work inside words.
+func emphasis(s string, i int) (end int, tag string, inner string, ok bool) {
+	c := s[i]
+	run := runLength(s, i)
+	if i+run >= len(s) || isSpace(s[i+run]) || (c == '_' && i > 0 && isAlnum(s[i-1])) {
+		return 0, "", "", false
+	}
+
+	for _, n := range []int{3, 2, 1} {
+		if run < n {
+			continue
+		}
+		start := i + n
+		for j := start; j < len(s); {
+			switch {
+			case s[j] == '\\':
+				j += 2
+				continue
+			case s[j] == '`':
+				if codeEnd, _, found := codeSpan(s, j); found {
+					j = codeEnd
+					continue
+				}
+			case s[j] == c:
+				m := runLength(s, j)
+				closes := m == n && j > start && !isSpace(s[j-1]) &&
+					(c != '_' || j+m >= len(s) || !isAlnum(s[j+m]))
+				if closes && n == 3 {
+					// The inner strong emphasis is matched again by the caller
+					return j + m, "em", s[i+1 : j+2], true
+				}
+				if closes {
+					return j + m, map[int]string{1: "em", 2: "strong"}[n], s[start:j], true
+				}
+				j += m
+				continue
+			}
+			j++
+		}
+	}
+	return 0, "", "", false
+}
+
+// inlineLink matches [text](destination "title") at s[i]
+func inlineLink(s string, i int) (end int, text, href, title string, ok bool) {
+	// Find the matching bracket; brackets in code spans and escaped ones do not count
+	depth := 0
+	closing := -1
+	for j := i; j < len(s) && closing < 0; {
+		switch s[j] {
+		case '\\':
+			j += 2
+			continue
+		case '`':
+			if codeEnd, _, found := codeSpan(s, j); found {
+				j = codeEnd
+				continue
+			}
+		case '[':
+			depth++
+		case ']':
+			depth--
+			if depth == 0 {
+				closing = j
+			}
+		}
+		j++
+	}
+	if closing < 0 || closing+1 >= len(s) || s[closing+1] != '(' {
+		return 0, "", "", "", false
+	}
+
+	j := skipSpaces(s, closing+2)
+	if j < len(s) && s[j] == '<' {
+		k := strings.IndexAny(s[j+1:], ">\n")
+		if k < 0 || s[j+1+k] != '>' {
+			return 0, "", "", "", false
+		}
+		href = s[j+1 : j+1+k]
+		j += k + 2
+	} else {
+		// Bare destinations may contain balanced parentheses but no spaces
+		parens, start := 0, j
+		for ; j < len(s) && !isSpace(s[j]); j++ {
+			if s[j] == '\\' && j+1 < len(s) && isPunct(s[j+1]) {
+				j++
+				continue
+			}
+			if s[j] == '(' {
+				parens++
+			} else if s[j] == ')' {
+				if parens == 0 {
+					break
+				}
+				parens--
+			}
+		}
+		href = unescape(s[start:j])
+	}
+
+	if k := skipSpaces(s, j); k > j && k < len(s) && strings.IndexByte(`"'(`, s[k]) >= 0 {
+		closer := s[k]
+		if closer == '(' {
+			closer = ')'
+		}
+		t := k + 1
+		for ; t < len(s) && s[t] != closer; t++ {
+			if s[t] == '\\' {
+				t++
+			}
+		}
+		if t >= len(s) {
+			return 0, "", "", "", false
+		}
+		title = unescape(s[k+1 : t])
+		j = t + 1
+	}
+	j = skipSpaces(s, j)
+	if j >= len(s) || s[j] != ')' {
+		return 0, "", "", "", false
+	}
+	return j + 1, s[i+1 : closing], href, title, true
+}
+
+// autolink matches <https://example.com> or <user@example.com> at s[i]
+func autolink(s string, i int) (end int, href, label string, ok bool) {
+	k := strings.IndexByte(s[i+1:], '>')
+	if k < 0 {
+		return 0, "", "", false
+	}
+	label = s[i+1 : i+1+k]
+	if label == "" || strings.ContainsAny(label, " \t\n<") {
+		return 0, "", "", false
+	}
+	href = label
+	if at := strings.IndexByte(label, '@'); at > 0 && !strings.Contains(label, ":") && strings.Contains(label[at:], ".") {
+		href = "mailto:" + label
+	}
+	scheme, _, found := strings.Cut(href, ":")
+	if !found || !allowedSchemes[strings.ToLower(scheme)] {
+		return 0, "", "", false
+	}
+	return i + k + 2, href, label, true
+}
+
+// allowedSchemes are the URL schemes links may use
+var allowedSchemes = map[string]bool{
+	"http":   true,
+	"https":  true,
+	"mailto": true,
+}
+
+// safeURL reports whether a link destination is relative or uses an allowed
+// scheme. Browsers ignore control characters and whitespace inside schemes,
+// so "java\tscript:" counts as a scheme too.
+func safeURL(href string) bool {
+	cleaned := strings.Map(func(r rune) rune {
+		if r <= ' ' || r == 0x7f {
+			return -1
+		}
+		return r
+	}, href)
+	colon := strings.IndexByte(cleaned, ':')
+	if colon < 0 || strings.ContainsAny(cleaned[:colon], "/?#") {
+		return true
+	}
+	return allowedSchemes[strings.ToLower(cleaned[:colon])]
+}
+
+// unescape removes the backslashes of escaped punctuation
+func unescape(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+1 < len(s) && isPunct(s[i+1]) {
+			i++
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
+
+// runLength counts the repetitions of s[i] starting at i
+func runLength(s string, i int) int {
+	n := 1
+	for i+n < len(s) && s[i+n] == s[i] {
+		n++
+	}
+	return n
+}
+
+func skipSpaces(s string, i int) int {
+	for i < len(s) && isSpace(s[i]) {
+		i++
+	}
+	return i
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n'
+}
+
+func isAlnum(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c >= 0x80
+}
+
+// isPunct reports whether c is ASCII punctuation, which a backslash escapes
+func isPunct(c byte) bool {
+	return strings.IndexByte("!\"#$%&'()*+,-./:;<=>?@[\\]^_`{|}~", c) >= 0
+}
@@ -0,0 +1,330 @@
+// Package markdown renders the CommonMark subset that posts and comments are
+// written in: paragraphs, fenced and indented code blocks, block quotes,
+// ordered and unordered lists, inline code, emphasis, links and autolinks.
+// Raw HTML is never passed through. Everything the renderer writes is escaped
+// and the result is sanitized against an allow-list on top, so a bug in the
+// parser cannot produce markup that the allow-list does not permit.
+package markdown
+
+import (
+	"html"
+	"strconv"
+	"strings"
+)
+
+// Render converts Markdown source to sanitized HTML
+func Render(source string) string {
+	source = strings.NewReplacer("\r\n", "\n", "\r", "\n", "\x00", "�").Replace(source)
+	var b strings.Builder
+	renderBlocks(&b, strings.Split(source, "\n"), false)
+	return Sanitize(b.String())
+}
+
+// renderBlocks writes the blocks of lines. In tight lists paragraphs are
+// written without <p> tags.
+func renderBlocks(b *strings.Builder, lines []string, tight bool) {
+	for i := 0; i < len(lines); {
+		line := lines[i]
+		switch {
+		case isBlank(line):
+			i++
+		case fenceOf(line) != "":
+			i = renderFence(b, lines, i)
+		case indentOf(line) >= 4:
+			i = renderIndentedCode(b, lines, i)
+		case isQuote(line):
+			i = renderQuote(b, lines, i)
+		case listMarkerOf(line, false).width > 0:
+			i = renderList(b, lines, i)
+		default:
+			i = renderParagraph(b, lines, i, tight)
+		}
+	}
+}
+
+// renderFence writes the fenced code block starting at lines[i] and returns the index after it
+func renderFence(b *strings.Builder, lines []string, i int) int {
+	indent := indentOf(lines[i])
+	opening := strings.TrimLeft(lines[i], " ")
+	fence := fenceOf(lines[i])
+	info := strings.Fields(strings.TrimSpace(opening[len(fence):]))
+
+	b.WriteString("<pre><code")
+	if len(info) > 0 && isLanguage(info[0]) {
+		b.WriteString(` class="language-` + info[0] + `"`)
+	}
+	b.WriteString(">")
+	for i++; i < len(lines); i++ {
+		trimmed := strings.TrimLeft(lines[i], " ")
+		if indentOf(lines[i]) < 4 && strings.HasPrefix(trimmed, fence) && strings.Trim(trimmed, fence[:1]+" ") == "" {
+			i++
+			break
+		}
+		b.WriteString(html.EscapeString(stripIndent(lines[i], indent)) + "\n")
+	}
+	b.WriteString("</code></pre>\n")
+	return i
+}
+
+// renderIndentedCode writes the code block indented by four spaces starting at lines[i]
+func renderIndentedCode(b *strings.Builder, lines []string, i int) int {
+	end := i
+	for j := i; j < len(lines) && (isBlank(lines[j]) || indentOf(lines[j]) >= 4); j++ {
+		if !isBlank(lines[j]) {
+			end = j + 1
+		}
+	}
+	b.WriteString("<pre><code>")
+	for _, line := range lines[i:end] {
+		b.WriteString(html.EscapeString(stripIndent(line, 4)) + "\n")
+	}
+	b.WriteString("</code></pre>\n")
+	return end
+}
+
+// renderQuote writes the block quote starting at lines[i]
+func renderQuote(b *strings.Builder, lines []string, i int) int {
+	var inner []string
+	for ; i < len(lines) && isQuote(lines[i]); i++ {
+		line := strings.TrimLeft(lines[i], " ")[1:]
+		inner = append(inner, strings.TrimPrefix(line, " "))
+	}
+	b.WriteString("<blockquote>\n")
+	renderBlocks(b, inner, false)
+	b.WriteString("</blockquote>\n")
+	return i
+}
+
+// renderList writes the list starting at lines[i]. Items continue on lines
+// indented past their marker; a list is tight when no blank line separates
+// its items or their blocks.
+func renderList(b *strings.Builder, lines []string, i int) int {
+	first := listMarkerOf(lines[i], false)
+	var items [][]string
+	tight, blankBefore := true, false
+	for i < len(lines) {
+		marker := listMarkerOf(lines[i], false)
+		if marker.width == 0 || marker.ordered != first.ordered || marker.delimiter != first.delimiter {
+			break
+		}
+		if blankBefore {
+			tight = false
+		}
+		// The marker and its indentation are plain bytes, but an empty item is shorter than its width
+		item := []string{lines[i][min(marker.width, len(lines[i])):]}
+		for i++; i < len(lines); i++ {
+			line := lines[i]
+			if isBlank(line) {
+				item = append(item, "")
+				continue
+			}
+			if indentOf(line) >= marker.width {
+				item = append(item, stripIndent(line, marker.width))
+				continue
+			}
+			// A lazy continuation line extends the paragraph the item ends with,
+			// unless it starts the next item
+			if !isBlank(item[len(item)-1]) && startsParagraph(line) && listMarkerOf(line, false).width == 0 {
+				item = append(item, line)
+				continue
+			}
+			break
+		}
+		// Trailing blank lines separate items rather than belong to them
+		blankBefore = false
+		for len(item) > 1 && isBlank(item[len(item)-1]) {
+			item = item[:len(item)-1]
+			blankBefore = true
+		}
+		for _, line := range item[1:] {
+			if isBlank(line) {
+				tight = false
+			}
+		}
+		items = append(items, item)
+	}
+
+	tag := "ul"
+	if first.ordered {
+		tag = "ol"
+	}
+	b.WriteString("<" + tag)
+	if first.ordered && first.start != 1 {
+		b.WriteString(` start="` + strconv.Itoa(first.start) + `"`)
+	}
+	b.WriteString(">\n")
+	for _, item := range items {
+		b.WriteString("<li>")
+		renderBlocks(b, item, tight)
+		b.WriteString("</li>\n")
+	}
+	b.WriteString("</" + tag + ">\n")
+	return i
+}
+
+// renderParagraph writes the paragraph starting at lines[i]
+func renderParagraph(b *strings.Builder, lines []string, i int, tight bool) int {
+	start := i
+	for i++; i < len(lines) && !isBlank(lines[i]) && startsParagraph(lines[i]); i++ {
+	}
+
+	text := make([]string, 0, i-start)
+	for _, line := range lines[start:i] {
+		text = append(text, strings.TrimLeft(line, " \t"))
+	}
+	content := renderInline(strings.Join(text, "\n"))
+	if tight {
+		b.WriteString(content)
+	} else {
+		b.WriteString("<p>" + content + "</p>\n")
+	}
+	return i
+}
+
+// startsParagraph reports whether a non-blank line continues a paragraph
+// instead of starting another block. Ordered lists only interrupt a
+// paragraph when they start at 1, so that numbers in prose stay text.
+func startsParagraph(line string) bool {
+	if fenceOf(line) != "" || isQuote(line) {
+		return false
+	}
+	return listMarkerOf(line, true).width == 0
+}
+
+// listMarker describes the marker of a list item
+type listMarker struct {
+	// width is the indentation of the item content, 0 when the line is no item
+	width     int
+	ordered   bool
+	start     int
+	delimiter byte
+}
+
+// listMarkerOf parses the list item marker that line starts with. When
+// interrupting a paragraph, items must not be empty and ordered ones must
+// start at 1.
+func listMarkerOf(line string, interrupting bool) listMarker {
+	indent := indentOf(line)
+	if indent >= 4 {
+		return listMarker{}
+	}
+	rest := line[indent:]
+
+	var m listMarker
+	switch {
+	case rest != "" && strings.ContainsRune("-*+", rune(rest[0])):
+		m.delimiter = rest[0]
+		rest = rest[1:]
+		m.width = indent + 1
+	default:
+		digits := 0
+		for digits < len(rest) && digits < 9 && rest[digits] >= '0' && rest[digits] <= '9' {
+			digits++
+		}
+		if digits == 0 || digits == len(rest) || (rest[digits] != '.' && rest[digits] != ')') {
+			return listMarker{}
+		}
+		m.ordered = true
+		m.start, _ = strconv.Atoi(rest[:digits])
+		m.delimiter = rest[digits]
+		rest = rest[digits+1:]
+		m.width = indent + digits + 1
+	}
+
+	if isBlank(rest) {
+		if interrupting {
+			return listMarker{}
+		}
+		return listMarker{width: m.width + 1, ordered: m.ordered, start: m.start, delimiter: m.delimiter}
+	}
+	spaces := len(rest) - len(strings.TrimLeft(rest, " "))
+	if spaces == 0 {
+		return listMarker{}
+	}
+	// More than four spaces start indented code inside the item
+	if spaces > 4 {
+		spaces = 1
+	}
+	if interrupting && m.ordered && m.start != 1 {
+		return listMarker{}
+	}
+	// A thematic break such as "* * *" is not a list; it is kept as text
+	if !m.ordered && strings.Trim(line, " "+string(m.delimiter)) == "" {
+		return listMarker{}
+	}
+	m.width += spaces
+	return m
+}
+
+// fenceOf returns the backtick or tilde fence that opens a code block, or ""
+func fenceOf(line string) string {
+	if indentOf(line) >= 4 {
+		return ""
+	}
+	trimmed := strings.TrimLeft(line, " ")
+	if trimmed == "" || (trimmed[0] != '`' && trimmed[0] != '~') {
+		return ""
+	}
+	n := len(trimmed) - len(strings.TrimLeft(trimmed, trimmed[:1]))
+	if n < 3 {
+		return ""
+	}
+	// Backtick fences cannot have backticks in their info string
+	if trimmed[0] == '`' && strings.Contains(trimmed[n:], "`") {
+		return ""
+	}
+	return trimmed[:n]
+}
+
+func isQuote(line string) bool {
+	return indentOf(line) < 4 && strings.HasPrefix(strings.TrimLeft(line, " "), ">")
+}
+
+// isLanguage reports whether a code block info string is safe to use as a class name
+func isLanguage(s string) bool {
+	if len(s) > 32 {
+		return false
+	}
+	for _, c := range s {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_' || c == '+' || c == '#') {
+			return false
+		}
+	}
+	return true
+}
+
+func isBlank(line string) bool {
+	return strings.TrimSpace(line) == ""
+}
+
+// indentOf counts the leading spaces of a line, with tabs to the next multiple of four
+func indentOf(line string) int {
+	n := 0
+	for _, c := range line {
+		switch c {
+		case ' ':
+			n++
+		case '\t':
+			n += 4 - n%4
+		default:
+			return n
+		}
+	}
+	return n
+}
+
+// stripIndent removes up to width columns of leading whitespace
+func stripIndent(line string, width int) string {
+	n := 0
+	for i, c := range line {
+		if n >= width || (c != ' ' && c != '\t') {
+			return line[i:]
+		}
+		if c == '\t' {
+			n += 4 - n%4
+		} else {
+			n++
+		}
+	}
+	return ""
+}
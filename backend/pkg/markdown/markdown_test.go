@@ -0,0 +1,113 @@
+package markdown
+
+import (
+	"io"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/html"
+)
+
+func TestRenderXSS(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+		want   string
+	}{
+		{"javascript link", "[x](javascript:alert(1))", "<p>x</p>\n"},
+		{"javascript link in mixed case", "[x](JaVaScRiPt:alert(1))", "<p>x</p>\n"},
+		{"javascript link after a space", "[x]( javascript:alert(1))", "<p>x</p>\n"},
+		{"javascript link with a tab", "[x](java\tscript:alert(1))", "<p>[x](java\tscript:alert(1))</p>\n"},
+		{"javascript link behind an entity", "[x](&#106;avascript:alert(1))", `<p><a href="&amp;#106;avascript:alert(1)" rel="nofollow ugc noopener">x</a></p>` + "\n"},
+		{"javascript autolink", "<javascript:alert(1)>", "<p>&lt;javascript:alert(1)&gt;</p>\n"},
+		{"vbscript link", "[x](vbscript:msgbox(1))", "<p>x</p>\n"},
+		{"data link", "[x](data:text/html;base64,PHNjcmlwdD5hbGVydCgxKTwvc2NyaXB0Pg==)", "<p>x</p>\n"},
+		{"data image link", "[x](data:image/svg+xml;base64,PHN2ZyBvbmxvYWQ9YWxlcnQoMSk+)", "<p>x</p>\n"},
+		{"quote in a link title", `[x](https://example.com "a\" onclick=\"alert(1)")`, `<p><a href="https://example.com" title="a&#34; onclick=&#34;alert(1)" rel="nofollow ugc noopener">x</a></p>` + "\n"},
+		{"quote in a link destination", `[x](https://example.com" onclick="alert(1))`, "<p>[x](https://example.com&#34; onclick=&#34;alert(1))</p>\n"},
+		{"allowed link", "[x](https://example.com/a?b=1&c=2)", `<p><a href="https://example.com/a?b=1&amp;c=2" rel="nofollow ugc noopener">x</a></p>` + "\n"},
+		{"script tag", "<script>alert(1)</script>", "<p>&lt;script&gt;alert(1)&lt;/script&gt;</p>\n"},
+		{"img onerror", "<img src=x onerror=alert(1)>", "<p>&lt;img src=x onerror=alert(1)&gt;</p>\n"},
+		{"img onerror in emphasis", "**<img src=x onerror=alert(1)>**", "<p><strong>&lt;img src=x onerror=alert(1)&gt;</strong></p>\n"},
+		{"img onerror in a link text", "[<img src=x onerror=alert(1)>](https://example.com)", `<p><a href="https://example.com" rel="nofollow ugc noopener">&lt;img src=x onerror=alert(1)&gt;</a></p>` + "\n"},
+		{"img onerror in a code span", "`<img src=x onerror=alert(1)>`", "<p><code>&lt;img src=x onerror=alert(1)&gt;</code></p>\n"},
+		{"iframe in a quote", "> <iframe src=javascript:alert(1)>", "<blockquote>\n<p>&lt;iframe src=javascript:alert(1)&gt;</p>\n</blockquote>\n"},
+		{"svg onload in a list", "- <svg onload=alert(1)>", "<ul>\n<li>&lt;svg onload=alert(1)&gt;</li>\n</ul>\n"},
+		{"escaped entities stay text", "&lt;script&gt;", "<p>&amp;lt;script&amp;gt;</p>\n"},
+		{"fence language with an attribute", "```js\" onmouseover=\"alert(1)\nx\n```", "<pre><code>x\n</code></pre>\n"},
+		{"fence language closing the tag", "```\"><script>alert(1)</script>\nx\n```", "<pre><code>x\n</code></pre>\n"},
+		{"fence language with a tag", "```js><img src=x onerror=alert(1)>\nx\n```", "<pre><code>x\n</code></pre>\n"},
+		{"fence language followed by an attribute", "~~~go onclick=alert(1)\nx\n~~~", `<pre><code class="language-go">x` + "\n</code></pre>\n"},
+		{"script inside a fence", "```html\n<script>alert(1)</script>\n```", `<pre><code class="language-html">&lt;script&gt;alert(1)&lt;/script&gt;` + "\n</code></pre>\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Render(tt.source)
+			if got != tt.want {
+				t.Errorf("Render(%q) = %q, want %q", tt.source, got, tt.want)
+			}
+			checkInert(t, got)
+		})
+	}
+}
+
+func TestSanitize(t *testing.T) {
+	tests := []struct {
+		name     string
+		fragment string
+		want     string
+	}{
+		{"javascript href", `<a href="javascript:alert(1)">x</a>`, "<a>x</a>"},
+		{"javascript href with a tab entity", `<a href="java&#x09;script:alert(1)">x</a>`, "<a>x</a>"},
+		{"data href", `<a href="data:text/html,x">x</a>`, "<a>x</a>"},
+		{"foreign rel", `<a href="https://example.com" rel="opener">x</a>`, `<a href="https://example.com">x</a>`},
+		{"img onerror", `<img src=x onerror=alert(1)>`, ""},
+		{"event handler", `<p onclick="alert(1)">x</p>`, "<p>x</p>"},
+		{"script", `<script>alert(1)</script>after`, "after"},
+		{"script in svg", `<svg><script>alert(1)</script></svg>`, ""},
+		{"style", `<style>body{display:none}</style>x`, "x"},
+		{"unknown element", `<div title="x"><em>y</em></div>`, "<em>y</em>"},
+		{"class with an attribute", `<code class="language-js onclick">x</code>`, "<code>x</code>"},
+		{"class without a language", `<code class="x">x</code>`, "<code>x</code>"},
+		{"start with an attribute", `<ol start="1 onclick=x"><li>x</li></ol>`, "<ol><li>x</li></ol>"},
+		{"comment", `<!-- <script>alert(1)</script> -->x`, "x"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Sanitize(tt.fragment)
+			if got != tt.want {
+				t.Errorf("Sanitize(%q) = %q, want %q", tt.fragment, got, tt.want)
+			}
+			checkInert(t, got)
+		})
+	}
+}
+
+// checkInert fails unless fragment consists of allowed elements and
+// attributes only, with safe link destinations
+func checkInert(t *testing.T, fragment string) {
+	t.Helper()
+	z := html.NewTokenizer(strings.NewReader(fragment))
+	for {
+		switch z.Next() {
+		case html.ErrorToken:
+			if z.Err() != io.EOF {
+				t.Errorf("tokenizing %q: %v", fragment, z.Err())
+			}
+			return
+		case html.StartTagToken, html.SelfClosingTagToken:
+			token := z.Token()
+			attributes, ok := allowed[token.DataAtom]
+			if !ok {
+				t.Errorf("%q contains a <%s> element", fragment, token.Data)
+			}
+			for _, a := range token.Attr {
+				if !attributes[a.Key] || !allowedValue(a.Key, a.Val) {
+					t.Errorf("%q contains %s=%q on <%s>", fragment, a.Key, a.Val, token.Data)
+				}
+			}
+		case html.CommentToken, html.DoctypeToken:
+			t.Errorf("%q contains markup other than elements", fragment)
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package markdown
+
+import (
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// allowed lists the elements the renderer produces and the attributes each may keep
+var allowed = map[atom.Atom]map[string]bool{
+	atom.P:          nil,
+	atom.Br:         nil,
+	atom.Pre:        nil,
+	atom.Code:       {"class": true},
+	atom.Blockquote: nil,
+	atom.Ul:         nil,
+	atom.Ol:         {"start": true},
+	atom.Li:         nil,
+	atom.Em:         nil,
+	atom.Strong:     nil,
+	atom.A:          {"href": true, "title": true, "rel": true},
+}
+
+// dropped are the elements whose content is removed along with them rather than kept as text
+var dropped = map[atom.Atom]bool{
+	atom.Script:   true,
+	atom.Style:    true,
+	atom.Iframe:   true,
+	atom.Object:   true,
+	atom.Embed:    true,
+	atom.Template: true,
+	atom.Textarea: true,
+	atom.Title:    true,
+	atom.Noscript: true,
+	atom.Svg:      true,
+	atom.Math:     true,
+}
+
+// Sanitize keeps only the allowed elements and attributes of an HTML
+// fragment. Other elements are unwrapped, keeping their text, except for
+// those whose content is code or styling, which are removed entirely.
+func Sanitize(fragment string) string {
+	context := &html.Node{Type: html.ElementNode, Data: "div", DataAtom: atom.Div}
+	nodes, err := html.ParseFragment(strings.NewReader(fragment), context)
+	if err != nil {
+		return html.EscapeString(fragment)
+	}
+
+	var b strings.Builder
+	for _, n := range nodes {
+		sanitizeNode(&b, n)
+	}
+	return b.String()
+}
+
+func sanitizeNode(b *strings.Builder, n *html.Node) {
+	switch n.Type {
+	case html.TextNode:
+		b.WriteString(html.EscapeString(n.Data))
+		return
+	case html.ElementNode:
+	default:
+		// Comments and doctypes are dropped
+		return
+	}
+
+	if dropped[n.DataAtom] {
+		return
+	}
+	attributes, ok := allowed[n.DataAtom]
+	if ok {
+		b.WriteString("<" + n.Data)
+		for _, a := range n.Attr {
+			if a.Namespace == "" && attributes[a.Key] && allowedValue(a.Key, a.Val) {
+				b.WriteString(" " + a.Key + `="` + html.EscapeString(a.Val) + `"`)
+			}
+		}
+		b.WriteString(">")
+		if n.DataAtom == atom.Br {
+			return
+		}
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		sanitizeNode(b, c)
+	}
+	if ok {
+		b.WriteString("</" + n.Data + ">")
+	}
+}
+
+// allowedValue checks the values of attributes that could carry code or break the layout
+func allowedValue(key, value string) bool {
+	switch key {
+	case "href":
+		return safeURL(value)
+	case "class":
+		return strings.HasPrefix(value, "language-") && isLanguage(strings.TrimPrefix(value, "language-"))
+	case "start":
+		_, err := strconv.Atoi(value)
+		return err == nil
+	case "rel":
+		return value == linkRel
+	}
+	return true
+}
@@ -0,0 +1,83 @@
+// Package mention finds @nickname mentions in posts, comments and chat
+// messages. Resolving the nicknames to users is left to the stores.
+package mention
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// MaxPerText caps the mentions taken from one text, so that a single post
+// cannot notify a whole forum
+const MaxPerText = 20
+
+// Match is a mention of Nickname. Offset and Length locate it in the text,
+// including the @, in UTF-16 code units, the way JavaScript indexes strings.
+type Match struct {
+	Nickname string
+	Offset   int
+	Length   int
+}
+
+// Find returns the mentions in text in order. A mention is an @ at the start
+// of the text or after a character that cannot end a word, followed by
+// letters, digits, underscores, hyphens and dots. Trailing dots end the
+// sentence rather than the nickname, and e-mail addresses are no mentions.
+func Find(text string) []Match {
+	var matches []Match
+	var prev rune
+	offset := 0
+	for i := 0; i < len(text) && len(matches) < MaxPerText; {
+		r, size := utf8.DecodeRuneInString(text[i:])
+		if r == '@' && !isWordRune(prev) && prev != '@' {
+			end := i + size
+			for end < len(text) {
+				next, n := utf8.DecodeRuneInString(text[end:])
+				if !isNicknameRune(next) {
+					break
+				}
+				end += n
+			}
+			nickname := strings.TrimRight(text[i+size:end], ".")
+			if nickname != "" {
+				length := utf16Len("@" + nickname)
+				matches = append(matches, Match{Nickname: nickname, Offset: offset, Length: length})
+				offset += length
+				i += size + len(nickname)
+				prev, _ = utf8.DecodeLastRuneInString(nickname)
+				continue
+			}
+		}
+		prev = r
+		offset += runeLen(r)
+		i += size
+	}
+	return matches
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_'
+}
+
+func isNicknameRune(r rune) bool {
+	return isWordRune(r) || unicode.IsMark(r) || r == '-' || r == '.'
+}
+
+// utf16Len counts the UTF-16 code units of s
+func utf16Len(s string) int {
+	n := 0
+	for _, r := range s {
+		n += runeLen(r)
+	}
+	return n
+}
+
+// runeLen counts the UTF-16 code units of r; runes outside the Basic
+// Multilingual Plane take a surrogate pair
+func runeLen(r rune) int {
+	if r >= 0x10000 {
+		return 2
+	}
+	return 1
+}
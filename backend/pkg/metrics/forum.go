@@ -0,0 +1,69 @@
+package metrics
+
+// Default is the registry served on /metrics
+var Default = NewRegistry()
+
+// HTTP metrics, labelled by the mux route template rather than the raw path
+var (
+	HTTPRequests = Default.NewCounterVec("forum_http_requests_total",
+		"Total HTTP requests by method, route template and status code.", "method", "route", "status")
+	HTTPDuration = Default.NewHistogramVec("forum_http_request_duration_seconds",
+		"HTTP request latency by method and route template.", DefBuckets, "method", "route")
+)
+
+// Database metrics, labelled by database (main or messages) and SQL operation
+var (
+	DBQueryDuration = Default.NewHistogramVec("forum_db_query_duration_seconds",
+		"SQL statement latency by database and operation.", DefBuckets, "db", "op")
+	DBQueryErrors = Default.NewCounterVec("forum_db_query_errors_total",
+		"SQL statements that returned an error, by database and operation.", "db", "op")
+)
+
+// WebSocket metrics
+var (
+	WSConnections = Default.NewGaugeVec("forum_ws_connections",
+		"Currently open WebSocket connections.")
+	WSRooms = Default.NewGaugeVec("forum_ws_rooms",
+		"Chat rooms with at least one connected client.")
+	WSMessagesBroadcast = Default.NewCounterVec("forum_ws_messages_broadcast_total",
+		"Frames broadcast to WebSocket clients by message type.", "type")
+	WSSendFailures = Default.NewCounterVec("forum_ws_send_failures_total",
+		"Frames that could not be written to a WebSocket client.")
+	WSDroppedClients = Default.NewCounterVec("forum_ws_dropped_clients_total",
+		"WebSocket clients disconnected without a normal close handshake.")
+)
+
+// Business counters
+var (
+	PostsCreated = Default.NewCounterVec("forum_posts_created_total",
+		"Posts created.")
+	CommentsCreated = Default.NewCounterVec("forum_comments_created_total",
+		"Comments created.")
+	RatesChanged = Default.NewCounterVec("forum_rates_changed_total",
+		"Votes cast, changed or withdrawn, by target type and resulting status.", "target", "status")
+	VoteTotalsCorrected = Default.NewCounterVec("forum_vote_totals_corrected_total",
+		"Posts and comments whose vote totals were repaired by reconciliation.")
+	Logins = Default.NewCounterVec("forum_logins_total",
+		"Login attempts by result.", "result")
+	UsersRegistered = Default.NewCounterVec("forum_users_registered_total",
+		"Users registered.")
+	LinkPreviewsFetched = Default.NewCounterVec("forum_link_previews_fetched_total",
+		"Linked pages fetched for previews by result: ok, empty or error.", "result")
+	ReactionsChanged = Default.NewCounterVec("forum_reactions_changed_total",
+		"Reactions added or removed by target (post, comment or message) and action.", "target", "action")
+	PollVotes = Default.NewCounterVec("forum_poll_votes_total",
+		"Poll ballots cast or withdrawn, by action.", "action")
+	WebhookDeliveries = Default.NewCounterVec("forum_webhook_deliveries_total",
+		"Webhook delivery attempts by result: delivered, retry or failed.", "result")
+	EventsHandled = Default.NewCounterVec("forum_events_handled_total",
+		"Domain events handed to subscribers, by event and result: ok or error.", "event", "result")
+)
+
+func init() {
+	// Expose unlabelled series from the first scrape instead of after the first event
+	for _, c := range []*CounterVec{WSSendFailures, WSDroppedClients, PostsCreated, CommentsCreated, UsersRegistered} {
+		c.Add(0)
+	}
+	WSConnections.Set(0)
+	WSRooms.Set(0)
+}
@@ -0,0 +1,319 @@
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefBuckets are the default latency histogram buckets, in seconds
+var DefBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// collector is a metric family that can write itself in the Prometheus text format
+type collector interface {
+	write(w io.Writer)
+}
+
+// Registry holds metric families and renders them in the Prometheus text exposition format
+type Registry struct {
+	mu         sync.Mutex
+	collectors []collector
+}
+
+// NewRegistry creates an empty registry
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+func (reg *Registry) register(c collector) {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	reg.collectors = append(reg.collectors, c)
+}
+
+// WriteText writes every registered metric family to w
+func (reg *Registry) WriteText(w io.Writer) error {
+	reg.mu.Lock()
+	collectors := append([]collector(nil), reg.collectors...)
+	reg.mu.Unlock()
+
+	buf := bufio.NewWriter(w)
+	for _, c := range collectors {
+		c.write(buf)
+	}
+	return buf.Flush()
+}
+
+// Handler serves the registry for Prometheus scrapes
+func (reg *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		reg.WriteText(w)
+	})
+}
+
+// desc describes a metric family
+type desc struct {
+	name   string
+	help   string
+	kind   string
+	labels []string
+}
+
+func (d *desc) writeHeader(w io.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", d.name, escapeHelp(d.help), d.name, d.kind)
+}
+
+// key joins label values into a map key
+func key(values []string) string {
+	return strings.Join(values, "\xff")
+}
+
+// labelPairs renders {a="x",b="y"} for the given names and values plus optional extra pairs
+func labelPairs(names, values []string, extra ...string) string {
+	if len(names) == 0 && len(extra) == 0 {
+		return ""
+	}
+	var sb strings.Builder
+	sb.WriteByte('{')
+	for i, name := range names {
+		if i > 0 {
+			sb.WriteByte(',')
+		}
+		sb.WriteString(name + `="` + escapeLabel(values[i]) + `"`)
+	}
+	for i := 0; i+1 < len(extra); i += 2 {
+		if sb.Len() > 1 {
+			sb.WriteByte(',')
+		}
+		sb.WriteString(extra[i] + `="` + escapeLabel(extra[i+1]) + `"`)
+	}
+	sb.WriteByte('}')
+	return sb.String()
+}
+
+func escapeLabel(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`).Replace(s)
+}
+
+func escapeHelp(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(s)
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// sortedKeys returns map keys in a stable order so scrapes are deterministic
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// CounterVec is a family of monotonically increasing counters partitioned by labels
+type CounterVec struct {
+	desc
+	mu     sync.Mutex
+	values map[string]float64
+	labels map[string][]string
+}
+
+// NewCounterVec creates and registers a counter family
+func (reg *Registry) NewCounterVec(name, help string, labels ...string) *CounterVec {
+	c := &CounterVec{
+		desc:   desc{name: name, help: help, kind: "counter", labels: labels},
+		values: make(map[string]float64),
+		labels: make(map[string][]string),
+	}
+	reg.register(c)
+	return c
+}
+
+// Inc increments the counter for the label values by one
+func (c *CounterVec) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+// Add increments the counter for the label values by delta, which must not be negative
+func (c *CounterVec) Add(delta float64, labelValues ...string) {
+	if delta < 0 {
+		return
+	}
+	k := key(labelValues)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.labels[k]; !ok {
+		c.labels[k] = append([]string(nil), labelValues...)
+	}
+	c.values[k] += delta
+}
+
+// Value returns the current value for the label values
+func (c *CounterVec) Value(labelValues ...string) float64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.values[key(labelValues)]
+}
+
+func (c *CounterVec) write(w io.Writer) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.writeHeader(w)
+	for _, k := range sortedKeys(c.values) {
+		fmt.Fprintf(w, "%s%s %s\n", c.name, labelPairs(c.desc.labels, c.labels[k]), formatFloat(c.values[k]))
+	}
+}
+
+// GaugeVec is a family of values that can go up and down, partitioned by labels
+type GaugeVec struct {
+	desc
+	mu     sync.Mutex
+	values map[string]float64
+	labels map[string][]string
+}
+
+// NewGaugeVec creates and registers a gauge family
+func (reg *Registry) NewGaugeVec(name, help string, labels ...string) *GaugeVec {
+	g := &GaugeVec{
+		desc:   desc{name: name, help: help, kind: "gauge", labels: labels},
+		values: make(map[string]float64),
+		labels: make(map[string][]string),
+	}
+	reg.register(g)
+	return g
+}
+
+// Set sets the gauge for the label values
+func (g *GaugeVec) Set(value float64, labelValues ...string) {
+	k := key(labelValues)
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if _, ok := g.labels[k]; !ok {
+		g.labels[k] = append([]string(nil), labelValues...)
+	}
+	g.values[k] = value
+}
+
+// Add changes the gauge for the label values by delta
+func (g *GaugeVec) Add(delta float64, labelValues ...string) {
+	k := key(labelValues)
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if _, ok := g.labels[k]; !ok {
+		g.labels[k] = append([]string(nil), labelValues...)
+	}
+	g.values[k] += delta
+}
+
+// Value returns the current value for the label values
+func (g *GaugeVec) Value(labelValues ...string) float64 {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.values[key(labelValues)]
+}
+
+func (g *GaugeVec) write(w io.Writer) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.writeHeader(w)
+	for _, k := range sortedKeys(g.values) {
+		fmt.Fprintf(w, "%s%s %s\n", g.name, labelPairs(g.desc.labels, g.labels[k]), formatFloat(g.values[k]))
+	}
+}
+
+// HistogramVec is a family of histograms partitioned by labels
+type HistogramVec struct {
+	desc
+	buckets []float64
+	mu      sync.Mutex
+	series  map[string]*histogram
+}
+
+type histogram struct {
+	labels []string
+	counts []uint64 // per bucket, not cumulative
+	count  uint64
+	sum    float64
+}
+
+// NewHistogramVec creates and registers a histogram family. Buckets must be sorted ascending.
+func (reg *Registry) NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	h := &HistogramVec{
+		desc:    desc{name: name, help: help, kind: "histogram", labels: labels},
+		buckets: buckets,
+		series:  make(map[string]*histogram),
+	}
+	reg.register(h)
+	return h
+}
+
+// Observe records a single value for the label values
+func (h *HistogramVec) Observe(value float64, labelValues ...string) {
+	k := key(labelValues)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	s, ok := h.series[k]
+	if !ok {
+		s = &histogram{labels: append([]string(nil), labelValues...), counts: make([]uint64, len(h.buckets))}
+		h.series[k] = s
+	}
+	for i, upper := range h.buckets {
+		if value <= upper {
+			s.counts[i]++
+			break
+		}
+	}
+	s.count++
+	s.sum += value
+}
+
+// ObserveDuration records the time elapsed since start, in seconds
+func (h *HistogramVec) ObserveDuration(start time.Time, labelValues ...string) {
+	h.Observe(time.Since(start).Seconds(), labelValues...)
+}
+
+// Count returns the number of observations for the label values
+func (h *HistogramVec) Count(labelValues ...string) uint64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if s, ok := h.series[key(labelValues)]; ok {
+		return s.count
+	}
+	return 0
+}
+
+func (h *HistogramVec) write(w io.Writer) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.writeHeader(w)
+	for _, k := range sortedKeys(h.series) {
+		s := h.series[k]
+		var cumulative uint64
+		for i, upper := range h.buckets {
+			cumulative += s.counts[i]
+			fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, labelPairs(h.desc.labels, s.labels, "le", formatFloat(upper)), cumulative)
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, labelPairs(h.desc.labels, s.labels, "le", "+Inf"), s.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", h.name, labelPairs(h.desc.labels, s.labels), formatFloat(s.sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", h.name, labelPairs(h.desc.labels, s.labels), s.count)
+	}
+}
@@ -0,0 +1,20 @@
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+)
+
+// HSTS tells browsers to only use HTTPS for the next maxAge seconds.
+// A maxAge of zero disables the header.
+func HSTS(maxAge int) func(http.Handler) http.Handler {
+	value := "max-age=" + strconv.Itoa(maxAge) + "; includeSubDomains"
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if maxAge > 0 && r.TLS != nil {
+				w.Header().Set("Strict-Transport-Security", value)
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,30 @@
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"project-root/pkg/metrics"
+
+	"github.com/gorilla/mux"
+)
+
+// Metrics records request counts and latencies labelled by the matched route
+// template (e.g. /api/posts/{postId:[0-9]+}) to keep label cardinality bounded.
+func Metrics(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := NewStatusRecorder(w)
+		next.ServeHTTP(rec, r)
+
+		route := "unmatched"
+		if current := mux.CurrentRoute(r); current != nil {
+			if tpl, err := current.GetPathTemplate(); err == nil {
+				route = tpl
+			}
+		}
+		metrics.HTTPRequests.Inc(r.Method, route, strconv.Itoa(rec.Status))
+		metrics.HTTPDuration.ObserveDuration(start, r.Method, route)
+	})
+}
@@ -0,0 +1,66 @@
+package middleware
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"project-root/pkg/metrics"
+
+	"github.com/gorilla/mux"
+)
+
+func TestMetricsScrape(t *testing.T) {
+	r := mux.NewRouter()
+	r.Use(Metrics)
+	r.HandleFunc("/api/scrape-test/{postId:[0-9]+}", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	}).Methods("GET")
+	r.Handle("/metrics", metrics.Default.Handler()).Methods("GET")
+	server := httptest.NewServer(r)
+	defer server.Close()
+
+	for _, path := range []string{"/api/scrape-test/1", "/api/scrape-test/2"} {
+		resp, err := http.Get(server.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+	}
+
+	resp, err := http.Get(server.URL + "/metrics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status = %d, want 200", resp.StatusCode)
+	}
+	if ct := resp.Header.Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+		t.Errorf("Content-Type = %q, want the text exposition format", ct)
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	text := string(body)
+
+	route := `route="/api/scrape-test/{postId:[0-9]+}"`
+	for _, want := range []string{
+		"# HELP forum_http_requests_total Total HTTP requests by method, route template and status code.\n",
+		"# TYPE forum_http_requests_total counter\n",
+		`forum_http_requests_total{method="GET",` + route + `,status="418"} 2` + "\n",
+		"# TYPE forum_http_request_duration_seconds histogram\n",
+		`forum_http_request_duration_seconds_bucket{method="GET",` + route + `,le="+Inf"} 2` + "\n",
+		`forum_http_request_duration_seconds_count{method="GET",` + route + `} 2` + "\n",
+	} {
+		if !strings.Contains(text, want) {
+			t.Errorf("scrape lacks %q", want)
+		}
+	}
+	if strings.Contains(text, "/api/scrape-test/1") {
+		t.Error("scrape labels requests by their raw path")
+	}
+}
@@ -0,0 +1,53 @@
+package middleware
+
+import (
+	"bufio"
+	"errors"
+	"net"
+	"net/http"
+)
+
+// StatusRecorder captures the response status while still allowing WebSocket upgrades
+type StatusRecorder struct {
+	http.ResponseWriter
+	Status      int
+	wroteHeader bool
+}
+
+// NewStatusRecorder wraps w, assuming 200 OK until a status is written
+func NewStatusRecorder(w http.ResponseWriter) *StatusRecorder {
+	if rec, ok := w.(*StatusRecorder); ok {
+		return rec
+	}
+	return &StatusRecorder{ResponseWriter: w, Status: http.StatusOK}
+}
+
+func (rec *StatusRecorder) WriteHeader(status int) {
+	if !rec.wroteHeader {
+		rec.Status = status
+		rec.wroteHeader = true
+	}
+	rec.ResponseWriter.WriteHeader(status)
+}
+
+func (rec *StatusRecorder) Write(b []byte) (int, error) {
+	rec.wroteHeader = true
+	return rec.ResponseWriter.Write(b)
+}
+
+// Hijack lets the WebSocket upgrader take over the connection
+func (rec *StatusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := rec.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("response writer does not support hijacking")
+	}
+	rec.Status = http.StatusSwitchingProtocols
+	return hijacker.Hijack()
+}
+
+// Flush implements http.Flusher
+func (rec *StatusRecorder) Flush() {
+	if flusher, ok := rec.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
@@ -0,0 +1,145 @@
+// Package ranking computes the scores that posts and comments are ordered by.
+// Scores are stored with each post and comment: votes update them in the vote
+// transaction and a periodic refresh ages the time-windowed ones, so listing
+// never computes them per request.
+package ranking
+
+import (
+	"math"
+	"time"
+)
+
+// Period is a window of the top ranking
+type Period struct {
+	Name   string
+	Length time.Duration
+}
+
+// Column is the column holding the net votes cast within the period
+func (p Period) Column() string {
+	return "top_" + p.Name
+}
+
+// Periods are the windows of the top ranking, shortest first. "all" is not
+// listed: the top of all time is the rate itself.
+var Periods = [4]Period{
+	{Name: "day", Length: 24 * time.Hour},
+	{Name: "week", Length: 7 * 24 * time.Hour},
+	{Name: "month", Length: 30 * 24 * time.Hour},
+	{Name: "year", Length: 365 * 24 * time.Hour},
+}
+
+// PeriodByName looks up a period of the top ranking
+func PeriodByName(name string) (Period, bool) {
+	for _, p := range Periods {
+		if p.Name == name {
+			return p, true
+		}
+	}
+	return Period{}, false
+}
+
+// Scores are the ranking values stored with a post or comment
+type Scores struct {
+	Hot         float64
+	Controversy float64
+	Rising      float64
+	// Top holds the net votes cast within each of Periods
+	Top [len(Periods)]int
+}
+
+const (
+	// hotEpoch anchors the hot score so that values stay small
+	hotEpoch = 1704067200 // 2024-01-01T00:00:00Z
+	// hotDecay is how many seconds of age weigh as much as a tenfold score
+	hotDecay = 45000
+	// risingGravity is how steeply the rising score falls with age
+	risingGravity = 1.5
+)
+
+// Hot orders by score on a logarithmic scale, offset by the creation time:
+// a post needs ten times the score to outrank one 12.5 hours newer.
+// It only changes when the votes change.
+func Hot(upvotes, downvotes int, createdAt time.Time) float64 {
+	score := upvotes - downvotes
+	order := math.Log10(math.Max(math.Abs(float64(score)), 1))
+	sign := 0.0
+	if score > 0 {
+		sign = 1
+	} else if score < 0 {
+		sign = -1
+	}
+	seconds := float64(createdAt.Unix() - hotEpoch)
+	return round(sign*order + seconds/hotDecay)
+}
+
+// Controversy is high for targets with many votes split evenly between up and down
+func Controversy(upvotes, downvotes int) float64 {
+	if upvotes <= 0 || downvotes <= 0 {
+		return 0
+	}
+	magnitude := float64(upvotes + downvotes)
+	balance := float64(downvotes) / float64(upvotes)
+	if upvotes < downvotes {
+		balance = float64(upvotes) / float64(downvotes)
+	}
+	return round(math.Pow(magnitude, balance))
+}
+
+// Rising is the net votes of the last day divided by a power of the age in
+// hours, so young targets that collect votes quickly come first
+func Rising(lastDay int, createdAt, now time.Time) float64 {
+	if lastDay <= 0 {
+		return 0
+	}
+	hours := math.Max(now.Sub(createdAt).Hours(), 0)
+	return round(float64(lastDay) / math.Pow(hours+2, risingGravity))
+}
+
+// Compute derives all scores of a target from its vote counts
+func Compute(upvotes, downvotes int, top [len(Periods)]int, createdAt, now time.Time) Scores {
+	return Scores{
+		Hot:         Hot(upvotes, downvotes, createdAt),
+		Controversy: Controversy(upvotes, downvotes),
+		Rising:      Rising(top[0], createdAt, now),
+		Top:         top,
+	}
+}
+
+// VoteValue is what a vote adds to the score: 1 for up, -1 for down, 0 for none
+func VoteValue(status string) int {
+	switch status {
+	case "up":
+		return 1
+	case "down":
+		return -1
+	}
+	return 0
+}
+
+// TopDeltas returns how the net votes within each period change when a vote
+// with oldStatus cast at oldAt ("" if there was none) becomes newStatus at now
+func TopDeltas(oldStatus string, oldAt time.Time, newStatus string, now time.Time) [len(Periods)]int {
+	var deltas [len(Periods)]int
+	for i, p := range Periods {
+		deltas[i] = VoteValue(newStatus)
+		if oldStatus != "" && now.Sub(oldAt) < p.Length {
+			deltas[i] -= VoteValue(oldStatus)
+		}
+	}
+	return deltas
+}
+
+// Tally adds a vote cast at ratedAt to the net votes within each period
+func Tally(top *[len(Periods)]int, status string, ratedAt, now time.Time) {
+	for i, p := range Periods {
+		if now.Sub(ratedAt) < p.Length {
+			top[i] += VoteValue(status)
+		}
+	}
+}
+
+// round keeps scores comparable after a round trip through the database
+func round(v float64) float64 {
+	return math.Round(v*1e7) / 1e7
+}
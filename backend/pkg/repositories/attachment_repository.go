@@ -0,0 +1,209 @@
+package repositories
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"project-root/pkg/api"
+	"project-root/pkg/clock"
+	"project-root/pkg/db"
+)
+
+// ErrAttachmentNotFound is returned for attachments that do not exist, and
+// when linking uploads that belong to another user or are already linked.
+var ErrAttachmentNotFound = errors.New("attachment not found")
+
+// attachmentColumns are the columns read by scanAttachment
+const attachmentColumns = "attachments.id, attachments.user_id, attachments.post_id, attachments.comment_id, attachments.chat_hash, attachments.message_id, " +
+	"attachments.file_name, attachments.mime_type, attachments.size, attachments.width, attachments.height, " +
+	"attachments.blob_key, attachments.thumbnail_key, attachments.created_at"
+
+// pendingAttachment matches uploads not linked to any content yet
+const pendingAttachment = "attachments.post_id IS NULL AND attachments.comment_id IS NULL AND attachments.chat_hash IS NULL"
+
+// AttachmentRepository provides access to the metadata of uploaded files.
+type AttachmentRepository struct {
+	DB    *db.Pool
+	clock clock.Clock
+}
+
+// NewAttachmentRepository creates a new AttachmentRepository
+func NewAttachmentRepository(pool *db.Pool, clk clock.Clock) *AttachmentRepository {
+	return &AttachmentRepository{DB: pool, clock: clk}
+}
+
+// Create records an upload that is not linked to any content yet
+func (r *AttachmentRepository) Create(a *api.Attachment) error {
+	if a.CreatedAt.IsZero() {
+		a.CreatedAt = r.clock.Now()
+	}
+	result, err := r.DB.Exec(`
+		INSERT INTO attachments (user_id, file_name, mime_type, size, width, height, blob_key, thumbnail_key, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		a.UserID, a.FileName, a.MimeType, a.Size, a.Width, a.Height, a.BlobKey, a.ThumbnailKey, a.CreatedAt)
+	if err != nil {
+		return err
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+	a.ID = int(id)
+	SetAttachmentURLs(a)
+	return nil
+}
+
+func (r *AttachmentRepository) GetAttachment(id int) (*api.Attachment, error) {
+	return GetAttachment(r.DB, db.SQLite, id)
+}
+
+// GetAttachment returns the attachment with the given ID or ErrAttachmentNotFound
+func GetAttachment(q Queryer, dialect db.Dialect, id int) (*api.Attachment, error) {
+	attachments, err := queryAttachments(q, dialect, "attachments.id = ?", id)
+	if err != nil {
+		return nil, err
+	}
+	if len(attachments) == 0 {
+		return nil, ErrAttachmentNotFound
+	}
+	return &attachments[0], nil
+}
+
+// LinkAttachments links uploads of userID to target inside tx and returns
+// them in the given order. Unless every ID names an upload of the user that
+// is not linked yet, nothing is linked and ErrAttachmentNotFound is returned.
+func LinkAttachments(tx *sql.Tx, dialect db.Dialect, userID int, ids []int, target ContentTarget) ([]api.Attachment, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	var unique []interface{}
+	seen := make(map[int]bool)
+	for _, id := range ids {
+		if !seen[id] {
+			seen[id] = true
+			unique = append(unique, id)
+		}
+	}
+
+	args := []interface{}{
+		sql.NullInt64{Int64: int64(target.PostID), Valid: target.PostID != 0},
+		sql.NullInt64{Int64: int64(target.CommentID), Valid: target.CommentID != 0},
+		sql.NullString{String: target.ChatHash, Valid: target.ChatHash != ""},
+		sql.NullInt64{Int64: int64(target.MessageID), Valid: target.ChatHash != ""},
+		userID,
+	}
+	result, err := tx.Exec(dialect.Rebind(`
+		UPDATE attachments SET post_id = ?, comment_id = ?, chat_hash = ?, message_id = ?
+		WHERE user_id = ? AND `+pendingAttachment+` AND id IN (`+placeholders(len(unique))+`)`), append(args, unique...)...)
+	if err != nil {
+		return nil, err
+	}
+	linked, err := result.RowsAffected()
+	if err != nil {
+		return nil, err
+	}
+	if int(linked) != len(unique) {
+		return nil, ErrAttachmentNotFound
+	}
+
+	attachments, err := queryAttachments(tx, dialect, "attachments.id IN ("+placeholders(len(unique))+")", unique...)
+	if err != nil {
+		return nil, err
+	}
+	byID := make(map[int]api.Attachment, len(attachments))
+	for _, a := range attachments {
+		byID[a.ID] = a
+	}
+	ordered := make([]api.Attachment, len(unique))
+	for i, id := range unique {
+		ordered[i] = byID[id.(int)]
+	}
+	return ordered, nil
+}
+
+// LoadAttachments returns the attachments of the posts or comments with the
+// given IDs, keyed by ID; column is "post_id" or "comment_id"
+func LoadAttachments(q Queryer, dialect db.Dialect, column string, ids []int) (map[int][]api.Attachment, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	args := make([]interface{}, len(ids))
+	for i, id := range ids {
+		args[i] = id
+	}
+	attachments, err := queryAttachments(q, dialect, "attachments."+column+" IN ("+placeholders(len(ids))+")", args...)
+	if err != nil {
+		return nil, err
+	}
+	return groupAttachments(attachments, func(a api.Attachment) int {
+		if column == "post_id" {
+			return a.PostID
+		}
+		return a.CommentID
+	}), nil
+}
+
+// LoadMessageAttachments returns the attachments of the messages of a chat, keyed by message ID
+func LoadMessageAttachments(q Queryer, dialect db.Dialect, chatHash string) (map[int][]api.Attachment, error) {
+	attachments, err := queryAttachments(q, dialect, "attachments.chat_hash = ?", chatHash)
+	if err != nil {
+		return nil, err
+	}
+	return groupAttachments(attachments, func(a api.Attachment) int { return a.MessageID }), nil
+}
+
+// SetAttachmentURLs sets the URLs the attachment is served from
+func SetAttachmentURLs(a *api.Attachment) {
+	a.URL = fmt.Sprintf("/api/attachments/%d", a.ID)
+	a.ThumbnailURL = ""
+	if a.ThumbnailKey != "" {
+		a.ThumbnailURL = a.URL + "/thumbnail"
+	}
+}
+
+// scanAttachment reads a row of attachmentColumns
+func scanAttachment(rows *sql.Rows) (api.Attachment, error) {
+	var a api.Attachment
+	var postID, commentID, messageID sql.NullInt64
+	var chatHash sql.NullString
+	err := rows.Scan(&a.ID, &a.UserID, &postID, &commentID, &chatHash, &messageID,
+		&a.FileName, &a.MimeType, &a.Size, &a.Width, &a.Height,
+		&a.BlobKey, &a.ThumbnailKey, &a.CreatedAt)
+	if err != nil {
+		return a, err
+	}
+	a.PostID = int(postID.Int64)
+	a.CommentID = int(commentID.Int64)
+	a.ChatHash = chatHash.String
+	a.MessageID = int(messageID.Int64)
+	SetAttachmentURLs(&a)
+	return a, nil
+}
+
+// queryAttachments reads the attachments matching where, oldest first
+func queryAttachments(q Queryer, dialect db.Dialect, where string, args ...interface{}) ([]api.Attachment, error) {
+	rows, err := q.Query(dialect.Rebind("SELECT "+attachmentColumns+" FROM attachments WHERE "+where+" ORDER BY attachments.id"), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var attachments []api.Attachment
+	for rows.Next() {
+		a, err := scanAttachment(rows)
+		if err != nil {
+			return nil, err
+		}
+		attachments = append(attachments, a)
+	}
+	return attachments, rows.Err()
+}
+
+// groupAttachments groups attachments by the key of their content
+func groupAttachments(attachments []api.Attachment, key func(api.Attachment) int) map[int][]api.Attachment {
+	grouped := make(map[int][]api.Attachment)
+	for _, a := range attachments {
+		grouped[key(a)] = append(grouped[key(a)], a)
+	}
+	return grouped
+}
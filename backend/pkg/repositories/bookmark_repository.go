@@ -0,0 +1,350 @@
+package repositories
+
+import (
+	"database/sql"
+	"errors"
+	"project-root/pkg/api"
+	"project-root/pkg/clock"
+	"project-root/pkg/db"
+)
+
+var (
+	// ErrCollectionNotFound is returned when a collection does not exist or belongs to another user.
+	ErrCollectionNotFound = errors.New("collection not found")
+	// ErrCollectionExists is returned when the user already has a collection of that name.
+	ErrCollectionExists = errors.New("collection already exists")
+	// ErrBookmarkNotFound is returned when a bookmark is not in the collection.
+	ErrBookmarkNotFound = errors.New("bookmark not found")
+	// ErrBookmarkExists is returned when the post or comment is already saved in the collection.
+	ErrBookmarkExists = errors.New("bookmark already exists")
+	// ErrBookmarkTargetNotFound is returned when saving a post or comment that does not exist.
+	ErrBookmarkTargetNotFound = errors.New("bookmark target not found")
+)
+
+// BookmarkRepository provides access to the bookmark collections of users.
+type BookmarkRepository struct {
+	DB    *db.Pool
+	clock clock.Clock
+}
+
+// NewBookmarkRepository creates a new BookmarkRepository
+func NewBookmarkRepository(pool *db.Pool, clk clock.Clock) *BookmarkRepository {
+	return &BookmarkRepository{DB: pool, clock: clk}
+}
+
+// GetCollections lists the collections of the user with their item counts, oldest first
+func (r *BookmarkRepository) GetCollections(userID int) ([]api.BookmarkCollection, error) {
+	rows, err := r.DB.Query(`
+		SELECT bookmark_collections.id, bookmark_collections.name, bookmark_collections.created_at, COUNT(bookmarks.id)
+		FROM bookmark_collections
+		LEFT JOIN bookmarks ON bookmarks.collection_id = bookmark_collections.id
+		WHERE bookmark_collections.user_id = ?
+		GROUP BY bookmark_collections.id, bookmark_collections.name, bookmark_collections.created_at
+		ORDER BY bookmark_collections.id`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	collections := []api.BookmarkCollection{}
+	for rows.Next() {
+		var c api.BookmarkCollection
+		if err := rows.Scan(&c.ID, &c.Name, &c.CreatedAt, &c.ItemsCount); err != nil {
+			return nil, err
+		}
+		collections = append(collections, c)
+	}
+	return collections, rows.Err()
+}
+
+// CreateCollection creates an empty collection for the user
+func (r *BookmarkRepository) CreateCollection(userID int, name string) (*api.BookmarkCollection, error) {
+	collection := api.BookmarkCollection{Name: name, CreatedAt: r.clock.Now()}
+
+	result, err := r.DB.Exec("INSERT INTO bookmark_collections (user_id, name, created_at) VALUES (?, ?, ?) ON CONFLICT DO NOTHING",
+		userID, name, collection.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return nil, err
+	}
+	if affected == 0 {
+		return nil, ErrCollectionExists
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+	collection.ID = int(id)
+	return &collection, nil
+}
+
+// DeleteCollection deletes a collection together with its bookmarks
+func (r *BookmarkRepository) DeleteCollection(userID, collectionID int) error {
+	result, err := r.DB.Exec("DELETE FROM bookmark_collections WHERE id = ? AND user_id = ?", collectionID, userID)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrCollectionNotFound
+	}
+	return nil
+}
+
+// GetBookmarks lists one page of the bookmarks of a collection in their saved order
+func (r *BookmarkRepository) GetBookmarks(userID, collectionID, page, pageSize int) ([]api.Bookmark, int, int, error) {
+	var totalItems int
+	err := r.DB.QueryRow(`
+		SELECT COUNT(bookmarks.id)
+		FROM bookmark_collections
+		LEFT JOIN bookmarks ON bookmarks.collection_id = bookmark_collections.id
+		WHERE bookmark_collections.id = ? AND bookmark_collections.user_id = ?
+		GROUP BY bookmark_collections.id`, collectionID, userID).Scan(&totalItems)
+	if err == sql.ErrNoRows {
+		return nil, 0, 0, ErrCollectionNotFound
+	}
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	totalPages := totalItems / pageSize
+	if totalItems%pageSize != 0 {
+		totalPages++
+	}
+
+	rows, err := r.DB.Query(SelectBookmarks+" LIMIT ? OFFSET ?", collectionID, pageSize, (page-1)*pageSize)
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	defer rows.Close()
+
+	bookmarks, err := ScanBookmarks(rows, (page-1)*pageSize)
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	return bookmarks, totalItems, totalPages, nil
+}
+
+// SelectBookmarks lists the bookmarks of the collection bound to its only
+// placeholder. The author and content are those of the saved comment, if any.
+const SelectBookmarks = `
+	SELECT
+		bookmarks.id,
+		bookmarks.post_id,
+		bookmarks.comment_id,
+		users.nickname,
+		posts.title,
+		COALESCE(comments.content, posts.content),
+		COALESCE(comments.content_html, posts.content_html),
+		bookmarks.created_at
+	FROM bookmarks
+	JOIN posts ON posts.id = bookmarks.post_id
+	LEFT JOIN comments ON comments.id = bookmarks.comment_id
+	JOIN users ON users.id = COALESCE(comments.user_id, posts.user_id)
+	WHERE bookmarks.collection_id = ?
+	ORDER BY bookmarks.position, bookmarks.id`
+
+// ScanBookmarks reads rows of SelectBookmarks. Positions are numbered from
+// offset+1, so gaps left by removed bookmarks never show.
+func ScanBookmarks(rows *sql.Rows, offset int) ([]api.Bookmark, error) {
+	bookmarks := []api.Bookmark{}
+	for rows.Next() {
+		var b api.Bookmark
+		var commentID sql.NullInt64
+		if err := rows.Scan(&b.ID, &b.PostID, &commentID, &b.Nickname, &b.Title, &b.Content, &b.ContentHTML, &b.CreatedAt); err != nil {
+			return nil, err
+		}
+		b.CommentID = int(commentID.Int64)
+		b.Position = offset + len(bookmarks) + 1
+		bookmarks = append(bookmarks, b)
+	}
+	return bookmarks, rows.Err()
+}
+
+// AddBookmark appends a post or comment to the end of a collection and returns the bookmark ID
+func (r *BookmarkRepository) AddBookmark(userID, collectionID int, req api.BookmarkRequest) (int, error) {
+	tx, err := r.DB.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	if err := CheckBookmarkTarget(tx, db.SQLite, userID, collectionID, req); err != nil {
+		return 0, err
+	}
+
+	var commentID interface{}
+	if req.CommentID != 0 {
+		commentID = req.CommentID
+	}
+	result, err := tx.Exec(`
+		INSERT INTO bookmarks (collection_id, user_id, post_id, comment_id, position, created_at)
+		VALUES (?, ?, ?, ?, (SELECT COALESCE(MAX(position), 0) + 1 FROM bookmarks WHERE collection_id = ?), ?)
+		ON CONFLICT DO NOTHING`,
+		collectionID, userID, req.PostID, commentID, collectionID, r.clock.Now())
+	if err != nil {
+		return 0, err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	if affected == 0 {
+		return 0, ErrBookmarkExists
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+	return int(id), tx.Commit()
+}
+
+// CheckBookmarkTarget makes sure inside tx that the collection belongs to the
+// user and that the post, or the comment under it, exists
+func CheckBookmarkTarget(tx *sql.Tx, dialect db.Dialect, userID, collectionID int, req api.BookmarkRequest) error {
+	if err := checkCollection(tx, dialect, userID, collectionID); err != nil {
+		return err
+	}
+
+	var exists int
+	var err error
+	if req.CommentID != 0 {
+		err = tx.QueryRow(dialect.Rebind("SELECT 1 FROM comments WHERE id = ? AND post_id = ?"), req.CommentID, req.PostID).Scan(&exists)
+	} else {
+		err = tx.QueryRow(dialect.Rebind("SELECT 1 FROM posts WHERE id = ?"), req.PostID).Scan(&exists)
+	}
+	if err == sql.ErrNoRows {
+		return ErrBookmarkTargetNotFound
+	}
+	return err
+}
+
+// checkCollection returns ErrCollectionNotFound unless the collection belongs to the user
+func checkCollection(tx *sql.Tx, dialect db.Dialect, userID, collectionID int) error {
+	var exists int
+	err := tx.QueryRow(dialect.Rebind("SELECT 1 FROM bookmark_collections WHERE id = ? AND user_id = ?"), collectionID, userID).Scan(&exists)
+	if err == sql.ErrNoRows {
+		return ErrCollectionNotFound
+	}
+	return err
+}
+
+// MoveBookmark moves a bookmark to a 1-based position within its collection
+func (r *BookmarkRepository) MoveBookmark(userID, collectionID, bookmarkID, position int) error {
+	tx, err := r.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := MoveBookmark(tx, db.SQLite, userID, collectionID, bookmarkID, position); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// MoveBookmark moves a bookmark to a 1-based position within its collection
+// inside tx. Positions past the end move it last. The collection is numbered
+// afresh, which closes the gaps left by removed bookmarks.
+func MoveBookmark(tx *sql.Tx, dialect db.Dialect, userID, collectionID, bookmarkID, position int) error {
+	if err := checkCollection(tx, dialect, userID, collectionID); err != nil {
+		return err
+	}
+
+	rows, err := tx.Query(dialect.Rebind("SELECT id, position FROM bookmarks WHERE collection_id = ? ORDER BY position, id"), collectionID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	var ids []int
+	positions := make(map[int]int)
+	for rows.Next() {
+		var id, pos int
+		if err := rows.Scan(&id, &pos); err != nil {
+			return err
+		}
+		positions[id] = pos
+		if id != bookmarkID {
+			ids = append(ids, id)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	rows.Close()
+	if _, ok := positions[bookmarkID]; !ok {
+		return ErrBookmarkNotFound
+	}
+
+	to := min(max(position, 1), len(ids)+1) - 1
+	ids = append(ids[:to], append([]int{bookmarkID}, ids[to:]...)...)
+
+	for i, id := range ids {
+		if positions[id] == i+1 {
+			continue
+		}
+		if _, err := tx.Exec(dialect.Rebind("UPDATE bookmarks SET position = ? WHERE id = ?"), i+1, id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RemoveBookmark removes a bookmark from a collection
+func (r *BookmarkRepository) RemoveBookmark(userID, collectionID, bookmarkID int) error {
+	result, err := r.DB.Exec(`
+		DELETE FROM bookmarks
+		WHERE id = ? AND collection_id = ? AND user_id = ?`, bookmarkID, collectionID, userID)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrBookmarkNotFound
+	}
+	return nil
+}
+
+// BookmarkedPosts reports which of the posts the user saved itself in any of their collections
+func (r *BookmarkRepository) BookmarkedPosts(userID int, postIDs []int) (map[int]bool, error) {
+	return LoadBookmarkedPosts(r.DB, db.SQLite, userID, postIDs)
+}
+
+// LoadBookmarkedPosts returns the posts among postIDs that the user saved
+// itself in any of their collections
+func LoadBookmarkedPosts(q Queryer, dialect db.Dialect, userID int, postIDs []int) (map[int]bool, error) {
+	if len(postIDs) == 0 {
+		return nil, nil
+	}
+	args := []interface{}{userID}
+	for _, id := range postIDs {
+		args = append(args, id)
+	}
+	rows, err := q.Query(dialect.Rebind(`
+		SELECT DISTINCT post_id
+		FROM bookmarks
+		WHERE user_id = ? AND comment_id IS NULL AND post_id IN (`+placeholders(len(postIDs))+`)`), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	bookmarked := make(map[int]bool)
+	for rows.Next() {
+		var postID int
+		if err := rows.Scan(&postID); err != nil {
+			return nil, err
+		}
+		bookmarked[postID] = true
+	}
+	return bookmarked, rows.Err()
+}
@@ -5,19 +5,25 @@ import (
 	"database/sql"
 	"encoding/hex"
 	"fmt"
+	"log/slog"
 	"project-root/pkg/api"
+	"project-root/pkg/clock"
+	"project-root/pkg/db"
 	"time"
 )
 
 // ChatRepository interacts with chat-related data sources.
 type ChatRepository struct {
-	DB    *sql.DB
-	MsgDB *sql.DB
+	DB     *db.Pool
+	MsgDB  *db.Pool
+	logger *slog.Logger
+	clock  clock.Clock
 }
 
 // NewChatRepository creates a new ChatRepository instance with multiple DB connections if needed.
-func NewChatRepository() *ChatRepository {
-	return &ChatRepository{DB: dbHandler.MainDB, MsgDB: dbHandler.MsgDB}
+// logger reports the errors that cannot be returned.
+func NewChatRepository(pool, msgPool *db.Pool, logger *slog.Logger, clk clock.Clock) *ChatRepository {
+	return &ChatRepository{DB: pool, MsgDB: msgPool, logger: logger, clock: clk}
 }
 
 // GenerateChatHash generates a unique hash for the chat based on user IDs and timestamp.
@@ -57,14 +63,27 @@ func (repo *ChatRepository) CreateChat(user1ID, user2ID int) (string, error) {
 	chatHash := GenerateChatHash(user1ID, user2ID)
 
 	// Create a new conversation in the main database
+	tx, err := repo.DB.Begin()
+	if err != nil {
+		return "", fmt.Errorf("error creating conversation: %v", err)
+	}
+	defer tx.Rollback()
+
 	insertQuery := `
 		INSERT INTO conversations (user1_id, user2_id, hash)
 		VALUES (?, ?, ?);
 	`
-	_, err = repo.DB.Exec(insertQuery, user1ID, user2ID, chatHash)
+	_, err = tx.Exec(insertQuery, user1ID, user2ID, chatHash)
 	if err != nil {
 		return "", fmt.Errorf("error creating conversation: %v", err)
 	}
+	event := api.ChatCreatedEvent{ChatHash: chatHash, UserIDs: []int{user1ID, user2ID}}
+	if err := RecordEvent(tx, db.SQLite, event, repo.clock.Now()); err != nil {
+		return "", fmt.Errorf("error creating conversation: %v", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return "", fmt.Errorf("error creating conversation: %v", err)
+	}
 
 	// Create a corresponding messages table in the MsgDB
 	createTableQuery := fmt.Sprintf(`
@@ -183,7 +202,7 @@ func (repo *ChatRepository) GetMessagesForChat(chatHash string) ([]api.MessageMe
 	sanitizedChatHash := fmt.Sprintf(`"%s"`, chatHash)
 
 	query := fmt.Sprintf(`
-	SELECT m.sender_id, m.message_content, m.sent_at
+	SELECT m.rowid, m.sender_id, m.message_content, m.sent_at
 	FROM %s m
 	ORDER BY m.sent_at;
 	`, sanitizedChatHash)
@@ -195,37 +214,103 @@ func (repo *ChatRepository) GetMessagesForChat(chatHash string) ([]api.MessageMe
 	defer rows.Close()
 
 	var messages []api.MessageMessage
+	var ids []int
 
 	for rows.Next() {
+		var id int
 		var msg api.MessageMessage
 		var user api.UserResponse
 
-		if err := rows.Scan(&user.ID, &msg.Message, &msg.SendAt); err != nil {
+		if err := rows.Scan(&id, &user.ID, &msg.Message, &msg.SendAt); err != nil {
 			return nil, fmt.Errorf("error scanning row: %v", err)
 		}
 
+		msg.ID = id
 		msg.Sender = &user
 		msg.RoomHash = chatHash 
 
 		messages = append(messages, msg)
+		ids = append(ids, id)
 	}
 
 	if err := rows.Err(); err != nil {
 		return nil, fmt.Errorf("error iterating rows: %v", err)
 	}
+	rows.Close()
+
+	// Mentions and attachments are kept in the main database, keyed by the rowid of the message
+	mentions, err := LoadMessageMentions(repo.DB, db.SQLite, chatHash)
+	if err != nil {
+		return nil, fmt.Errorf("error loading mentions: %v", err)
+	}
+	attachments, err := LoadMessageAttachments(repo.DB, db.SQLite, chatHash)
+	if err != nil {
+		return nil, fmt.Errorf("error loading attachments: %v", err)
+	}
+	for i, id := range ids {
+		messages[i].Mentions = mentions[id]
+		messages[i].Attachments = attachments[id]
+	}
 
 	return messages, nil
 }
-func (repo *ChatRepository) SaveMessage(chatHash string, senderID  int, messageContent string) error {
+// SaveMessage stores a message in a chat, and its mentions and attachments in
+// the main database. The databases are separate, so the message is deleted
+// again when its mentions or attachments fail to save.
+func (repo *ChatRepository) SaveMessage(msg *api.MessageMessage) error {
 	query := fmt.Sprintf(`
 		INSERT INTO "%s" (sender_id, message_content, sent_at)
 		VALUES (?, ?, CURRENT_TIMESTAMP);
-	`, chatHash)
+	`, msg.RoomHash)
 
-	_, err := repo.MsgDB.Exec(query, senderID, messageContent)
+	result, err := repo.MsgDB.Exec(query, msg.Sender.ID, msg.Message)
 	if err != nil {
 		return fmt.Errorf("error saving message: %v", err)
 	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return fmt.Errorf("error saving message: %v", err)
+	}
+
+	if err := repo.saveMessageLinks(msg, int(id)); err != nil {
+		if _, deleteErr := repo.MsgDB.Exec(fmt.Sprintf(`DELETE FROM "%s" WHERE rowid = ?`, msg.RoomHash), id); deleteErr != nil {
+			repo.logger.Error("Error deleting message", "chat_hash", msg.RoomHash, "error", deleteErr)
+		}
+		return err
+	}
+	msg.ID = int(id)
+	return nil
+}
+
+// saveMessageLinks stores the mentions and attachments of the message with
+// the given rowid and records a MessageSentEvent
+func (repo *ChatRepository) saveMessageLinks(msg *api.MessageMessage, id int) error {
+	tx, err := repo.DB.Begin()
+	if err != nil {
+		return fmt.Errorf("error saving mentions: %v", err)
+	}
+	defer tx.Rollback()
 
+	target := ContentTarget{ChatHash: msg.RoomHash, MessageID: id}
+	if msg.Mentions, err = SaveMentions(tx, db.SQLite, target, msg.Message); err != nil {
+		return fmt.Errorf("error saving mentions: %v", err)
+	}
+	if msg.Attachments, err = LinkAttachments(tx, db.SQLite, msg.Sender.ID, msg.AttachmentIDs, target); err != nil {
+		return fmt.Errorf("error linking attachments: %w", err)
+	}
+	if err := RecordMessageSent(tx, db.SQLite, *msg, id, repo.clock.Now()); err != nil {
+		return fmt.Errorf("error saving message: %v", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error saving mentions: %v", err)
+	}
 	return nil
 }
+
+// RecordMessageSent records a MessageSentEvent for a message with the given
+// ID stored inside tx. The attachment IDs of the request are left out.
+func RecordMessageSent(tx *sql.Tx, dialect db.Dialect, msg api.MessageMessage, id int, now time.Time) error {
+	msg.ID = id
+	msg.AttachmentIDs = nil
+	return RecordEvent(tx, dialect, api.MessageSentEvent{Message: msg}, now)
+}
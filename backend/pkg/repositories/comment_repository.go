@@ -3,27 +3,36 @@ package repositories
 import (
 	"database/sql"
 	"project-root/pkg/api"
-	"log"
-	"time"
+	"project-root/pkg/clock"
+	"project-root/pkg/db"
+	"project-root/pkg/markdown"
+	"project-root/pkg/ranking"
 )
 
 type CommentRepository struct {
-	DB *sql.DB
+	DB    *db.Pool
+	clock clock.Clock
 }
 
 // NewCommentRepository creates a new CommentRepository instance.
-func NewCommentRepository() *CommentRepository {
-	return &CommentRepository{DB: dbHandler.MainDB}
+func NewCommentRepository(pool *db.Pool, clk clock.Clock) *CommentRepository {
+	return &CommentRepository{DB: pool, clock: clk}
 }
 
 // Create inserts a new comment into the database.
 func (r *CommentRepository) Create(c *api.CommentCreateRequest) error {
-	stmt, err := dbHandler.MainDB.Prepare("INSERT INTO comments (post_id, user_id, content, created_at) VALUES (?, ?, ?, ?)")
+	if c.CreatedAt.IsZero() {
+		c.CreatedAt = r.clock.Now()
+	}
+	tx, err := r.DB.Begin()
 	if err != nil {
-		log.Fatal(err)
+		return err
 	}
-	c.CreatedAt = time.Now()
-	result, err := stmt.Exec(c.PostID, c.UserID, c.Content, c.CreatedAt)
+	defer tx.Rollback()
+
+	c.ContentHTML = markdown.Render(c.Content)
+	result, err := tx.Exec("INSERT INTO comments (post_id, user_id, content, content_html, created_at, hot) VALUES (?, ?, ?, ?, ?, ?)",
+		c.PostID, c.UserID, c.Content, c.ContentHTML, c.CreatedAt, ranking.Hot(0, 0, c.CreatedAt))
 	if err != nil {
 		return err
 	}
@@ -32,9 +41,34 @@ func (r *CommentRepository) Create(c *api.CommentCreateRequest) error {
 		return err
 	}
 	c.ID = int(id)
-	UpdatePostAmount(c.PostID)
-	IncrementCount(c.UserID, "comments")
-	return nil
+	if c.Mentions, err = SaveMentions(tx, db.SQLite, ContentTarget{CommentID: c.ID}, c.Content); err != nil {
+		return err
+	}
+	if c.Attachments, err = LinkAttachments(tx, db.SQLite, c.UserID, c.AttachmentIDs, ContentTarget{CommentID: c.ID}); err != nil {
+		return err
+	}
+	if err := RecordCommentCreated(tx, db.SQLite, c); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// RecordCommentCreated records a CommentCreatedEvent for a comment stored inside tx
+func RecordCommentCreated(tx *sql.Tx, dialect db.Dialect, c *api.CommentCreateRequest) error {
+	author, err := LoadUserResponse(tx, dialect, c.UserID)
+	if err != nil {
+		return err
+	}
+	return RecordEvent(tx, dialect, api.CommentCreatedEvent{
+		CommentID:   c.ID,
+		PostID:      c.PostID,
+		Author:      author,
+		Content:     c.Content,
+		ContentHTML: c.ContentHTML,
+		Mentions:    c.Mentions,
+		Attachments: c.Attachments,
+		CreatedAt:   c.CreatedAt,
+	}, c.CreatedAt)
 }
 
 func (r *CommentRepository) GetComments(page, pageSize int, sortBy, filterType string, filterValue interface{}, userIdAuth int) (*[]api.Comment, int, int, error) {
@@ -45,8 +79,11 @@ func (r *CommentRepository) GetComments(page, pageSize int, sortBy, filterType s
             comments.user_id, 
             users.nickname, 
             comments.content, 
+            comments.content_html,
             comments.created_at, 
-            comments.rate 
+            comments.rate,
+            comments.upvotes,
+            comments.downvotes 
         FROM comments
         JOIN users ON comments.user_id = users.id
     `
@@ -79,7 +116,7 @@ func (r *CommentRepository) GetComments(page, pageSize int, sortBy, filterType s
 
 
 	var totalItems int
-	err := dbHandler.MainDB.QueryRow(countQuery, filterValue).Scan(&totalItems)
+	err := r.DB.QueryRow(countQuery, filterValue).Scan(&totalItems)
 	if err != nil {
 		return nil, 0, 0, err
 	}
@@ -90,7 +127,7 @@ func (r *CommentRepository) GetComments(page, pageSize int, sortBy, filterType s
 	}
 
 
-	rows, err := dbHandler.MainDB.Query(baseQuery, args...)
+	rows, err := r.DB.Query(baseQuery, args...)
 	if err != nil {
 		return nil, 0, 0, err
 	}
@@ -99,23 +136,64 @@ func (r *CommentRepository) GetComments(page, pageSize int, sortBy, filterType s
 	var comments []api.Comment
 	for rows.Next() {
 		var comment api.Comment
-		if err := rows.Scan(&comment.ID, &comment.PostID, &comment.UserID, &comment.Nickname, &comment.Content, &comment.CreatedAt, &comment.Rate.Rate); err != nil {
+		if err := rows.Scan(&comment.ID, &comment.PostID, &comment.UserID, &comment.Nickname, &comment.Content, &comment.ContentHTML, &comment.CreatedAt, &comment.Rate.Rate, &comment.Rate.Upvotes, &comment.Rate.Downvotes); err != nil {
 			return nil, 0, 0, err
 		}
+		comments = append(comments, comment)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, 0, err
+	}
+	rows.Close()
 
-		if userIdAuth != 0 {
-			status, err := getRateStatus("comment", comment.ID, userIdAuth)
+	// Rate statuses are loaded after the rows are closed so that a small read pool cannot deadlock
+	if userIdAuth != 0 {
+		for i := range comments {
+			status, err := getRateStatus(r.DB, "comment", comments[i].ID, userIdAuth)
 			if err != nil && err != sql.ErrNoRows {
 				return nil, 0, 0, err
 			}
-			comment.Rate.Status = status
+			comments[i].Rate.Status = status
 		}
-
-		comments = append(comments, comment)
 	}
-	if err := rows.Err(); err != nil {
+	if err := LoadCommentMentions(r.DB, db.SQLite, comments); err != nil {
+		return nil, 0, 0, err
+	}
+	if err := LoadCommentAttachments(r.DB, db.SQLite, comments); err != nil {
 		return nil, 0, 0, err
 	}
 
 	return &comments, totalItems, totalPages, nil
-}
\ No newline at end of file
+}
+
+// LoadCommentMentions sets the mentions of comments
+func LoadCommentMentions(q Queryer, dialect db.Dialect, comments []api.Comment) error {
+	ids := make([]int, len(comments))
+	for i, comment := range comments {
+		ids[i] = comment.ID
+	}
+	mentions, err := LoadMentions(q, dialect, "comment_id", ids)
+	if err != nil {
+		return err
+	}
+	for i := range comments {
+		comments[i].Mentions = mentions[comments[i].ID]
+	}
+	return nil
+}
+
+// LoadCommentAttachments sets the attachments of comments
+func LoadCommentAttachments(q Queryer, dialect db.Dialect, comments []api.Comment) error {
+	ids := make([]int, len(comments))
+	for i, comment := range comments {
+		ids[i] = comment.ID
+	}
+	attachments, err := LoadAttachments(q, dialect, "comment_id", ids)
+	if err != nil {
+		return err
+	}
+	for i := range comments {
+		comments[i].Attachments = attachments[comments[i].ID]
+	}
+	return nil
+}
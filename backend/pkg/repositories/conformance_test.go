@@ -0,0 +1,1029 @@
+package repositories_test
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"project-root/config"
+	"project-root/pkg/api"
+	"project-root/pkg/clock"
+	"project-root/pkg/db"
+	"project-root/pkg/repositories"
+	"project-root/pkg/repositories/memory"
+	"project-root/pkg/repositories/postgres"
+)
+
+// postgresDSNEnv names the variable with the DSN of a PostgreSQL database to
+// run the conformance suite against; every test gets a schema of its own
+const postgresDSNEnv = "TEST_POSTGRES_DSN"
+
+// backend opens empty stores that take the current time from clk, along
+// with their main database, which is nil for the in-memory stores
+type backend struct {
+	name string
+	open func(t *testing.T, clk clock.Clock) (repositories.Stores, *sql.DB)
+}
+
+func backends(t *testing.T) []backend {
+	backends := []backend{
+		{"memory", func(t *testing.T, clk clock.Clock) (repositories.Stores, *sql.DB) { return memory.NewStores(clk), nil }},
+		{"sqlite", openSQLite},
+	}
+	if dsn := os.Getenv(postgresDSNEnv); dsn != "" {
+		backends = append(backends, backend{"postgres", func(t *testing.T, clk clock.Clock) (repositories.Stores, *sql.DB) {
+			return openPostgres(t, dsn, clk)
+		}})
+	} else {
+		t.Logf("%s is not set, skipping PostgreSQL", postgresDSNEnv)
+	}
+	return backends
+}
+
+// openSQLite creates the main and messages databases in a temporary directory
+func openSQLite(t *testing.T, clk clock.Clock) (repositories.Stores, *sql.DB) {
+	t.Helper()
+	dir := t.TempDir()
+	handler := db.NewDBHandler(db.SQLiteOptions{BusyTimeout: 5 * time.Second, ReadPoolSize: 4})
+	t.Cleanup(func() { handler.Close() })
+	if err := handler.InitMainDB(config.DriverSQLite, dir+"/main.db", "../db/data/database.sql"); err != nil {
+		t.Fatal(err)
+	}
+	if err := handler.InitMsgDB(dir + "/messages.db"); err != nil {
+		t.Fatal(err)
+	}
+	return repositories.NewSQLStores(handler, clk, slog.New(slog.NewTextHandler(io.Discard, nil))), handler.MainDB
+}
+
+var schemaCount atomic.Int64
+
+// openPostgres creates the schema in a fresh PostgreSQL schema that is
+// dropped after the test
+func openPostgres(t *testing.T, dsn string, clk clock.Clock) (repositories.Stores, *sql.DB) {
+	t.Helper()
+	schema := fmt.Sprintf("conformance_%d_%d", os.Getpid(), schemaCount.Add(1))
+	admin, err := sql.Open("postgres", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		admin.Exec(`DROP SCHEMA "` + schema + `" CASCADE`)
+		admin.Close()
+	})
+	if _, err := admin.Exec(`CREATE SCHEMA "` + schema + `"`); err != nil {
+		t.Fatal(err)
+	}
+
+	handler := db.NewDBHandler(db.SQLiteOptions{})
+	t.Cleanup(func() { handler.Close() })
+	if err := handler.InitMainDB(config.DriverPostgres, withSearchPath(dsn, schema), "../db/data/postgres.sql"); err != nil {
+		t.Fatal(err)
+	}
+	if err := handler.InitMsgDB(""); err != nil {
+		t.Fatal(err)
+	}
+	return postgres.NewStores(handler.MainDB, clk), handler.MainDB
+}
+
+// withSearchPath adds the search_path run-time parameter to a URL or key=value DSN
+func withSearchPath(dsn, schema string) string {
+	if !strings.Contains(dsn, "://") {
+		return dsn + " search_path=" + schema
+	}
+	if strings.Contains(dsn, "?") {
+		return dsn + "&search_path=" + schema
+	}
+	return dsn + "?search_path=" + schema
+}
+
+// conformance is what every implementation of the stores must do
+var conformance = []struct {
+	name string
+	run  func(t *testing.T, s repositories.Stores, clk *clock.Manual)
+}{
+	{"users", testUsers},
+	{"sessions", testSessions},
+	{"posts", testPosts},
+	{"comments and counts", testCommentsAndCounts},
+	{"rates", testRates},
+	{"rankings", testRankings},
+	{"follows and feed", testFollows},
+	{"bookmarks", testBookmarks},
+	{"chats", testChats},
+	{"reactions", testReactions},
+	{"polls", testPolls},
+	{"drafts", testDrafts},
+	{"webhooks", testWebhooks},
+	{"outbox", testOutbox},
+	{"tokens", testTokens},
+}
+
+func TestStoresConformance(t *testing.T) {
+	for _, b := range backends(t) {
+		t.Run(b.name, func(t *testing.T) {
+			for _, c := range conformance {
+				t.Run(c.name, func(t *testing.T) {
+					clk := clock.NewManual(time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC))
+					stores, _ := b.open(t, clk)
+					c.run(t, stores, clk)
+				})
+			}
+		})
+	}
+}
+
+func mustUser(t testing.TB, s repositories.Stores, clk clock.Clock, nickname string) int {
+	t.Helper()
+	user, err := s.Users.CreateUser(&api.RegistrationRequest{
+		Nickname:  nickname,
+		Email:     strings.ToLower(nickname) + "@example.com",
+		Password:  "hash-of-" + nickname,
+		Age:       "02.02.2002",
+		Gender:    "other",
+		FirstName: nickname,
+		LastName:  "Tester",
+		CreatedAt: clk.Now(),
+	})
+	if err != nil {
+		t.Fatalf("creating user %s: %v", nickname, err)
+	}
+	return user.ID
+}
+
+func mustPost(t testing.TB, s repositories.Stores, clk clock.Clock, userID int, title string, categories ...string) int {
+	t.Helper()
+	post := &api.PostCreateRequest{UserID: userID, Title: title, Content: "Content of " + title, CreatedAt: clk.Now()}
+	if err := s.Posts.Create(post, categories); err != nil {
+		t.Fatalf("creating post %q: %v", title, err)
+	}
+	return post.ID
+}
+
+func mustComment(t testing.TB, s repositories.Stores, clk clock.Clock, userID, postID int, content string) int {
+	t.Helper()
+	comment := &api.CommentCreateRequest{PostID: postID, UserID: userID, Content: content, CreatedAt: clk.Now()}
+	if err := s.Comments.Create(comment); err != nil {
+		t.Fatalf("creating comment %q: %v", content, err)
+	}
+	return comment.ID
+}
+
+func postTitles(posts []api.Post) []string {
+	titles := make([]string, len(posts))
+	for i, p := range posts {
+		titles[i] = p.Title
+	}
+	return titles
+}
+
+func categoryNames(categories []api.Category) []string {
+	names := make([]string, len(categories))
+	for i, c := range categories {
+		names[i] = c.Name
+	}
+	return names
+}
+
+func equalStrings(a, b []string) bool {
+	return strings.Join(a, "\x00") == strings.Join(b, "\x00")
+}
+
+func testUsers(t *testing.T, s repositories.Stores, clk *clock.Manual) {
+	aliceID := mustUser(t, s, clk, "Alice")
+	bobID := mustUser(t, s, clk, "bob")
+	mustUser(t, s, clk, "alfred")
+
+	if _, err := s.Users.CreateUser(&api.RegistrationRequest{Nickname: "Alice2", Email: "alice@example.com", CreatedAt: clk.Now()}); err == nil {
+		t.Error("a second user with the same email was created")
+	}
+
+	stored, user, err := s.Users.ChekUserByEmail("alice@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.ID != aliceID || user.Nickname != "Alice" || stored.Password != "hash-of-Alice" {
+		t.Errorf("ChekUserByEmail = %+v, %+v", stored, user)
+	}
+
+	byNickname, err := s.Users.GetUserByNickname("bob")
+	if err != nil || byNickname.ID != bobID {
+		t.Errorf("GetUserByNickname(bob) = %+v, %v; want ID %d", byNickname, err, bobID)
+	}
+	byID, err := s.Users.GetUserByID(bobID)
+	if err != nil || byID.Nickname != "bob" {
+		t.Errorf("GetUserByID = %+v, %v; want bob", byID, err)
+	}
+
+	matches, err := s.Users.AutocompleteUsers("AL", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var nicknames []string
+	for _, m := range matches {
+		nicknames = append(nicknames, m.Nickname)
+	}
+	if len(nicknames) != 2 || strings.Contains(strings.Join(nicknames, " "), "bob") {
+		t.Errorf("AutocompleteUsers(AL) = %v, want Alice and alfred", nicknames)
+	}
+
+	users, total, _, err := s.Users.GetAllUsers(1, 10, "LOWER(users.nickname) ASC", aliceID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total != 2 || len(users) != 2 || users[0].Nickname != "alfred" || users[1].Nickname != "bob" {
+		t.Errorf("GetAllUsers excluding Alice = %+v (total %d), want alfred and bob", users, total)
+	}
+}
+
+func testSessions(t *testing.T, s repositories.Stores, clk *clock.Manual) {
+	userID := mustUser(t, s, clk, "alice")
+	session := &api.Session{UserID: userID, SessionID: "session-1", CreatedAt: clk.Now(), ExpiresAt: clk.Now().Add(time.Hour), LastActivity: clk.Now()}
+	if err := s.Sessions.CreateSession(session); err != nil {
+		t.Fatal(err)
+	}
+
+	user, err := s.Sessions.GetUserBySessionID("session-1")
+	if err != nil || user == nil || user.ID != userID {
+		t.Fatalf("GetUserBySessionID = %+v, %v; want user %d", user, err, userID)
+	}
+	if err := s.Sessions.UpdateLastActivity("session-1"); err != nil {
+		t.Fatal(err)
+	}
+	if user, err := s.Sessions.GetUserBySessionID("unknown"); user != nil || err != nil {
+		t.Errorf("unknown session = %+v, %v; want nil, nil", user, err)
+	}
+
+	if err := s.Sessions.DeleteSession("session-1"); err != nil {
+		t.Fatal(err)
+	}
+	if user, err := s.Sessions.GetUserBySessionID("session-1"); user != nil || err != nil {
+		t.Errorf("deleted session = %+v, %v; want nil, nil", user, err)
+	}
+}
+
+func testPosts(t *testing.T, s repositories.Stores, clk *clock.Manual) {
+	aliceID := mustUser(t, s, clk, "alice")
+	bobID := mustUser(t, s, clk, "bob")
+	firstID := mustPost(t, s, clk, aliceID, "First", "go", "sql")
+	clk.Advance(time.Minute)
+	mustPost(t, s, clk, bobID, "Second", "go")
+	clk.Advance(time.Minute)
+	mustPost(t, s, clk, aliceID, "Third", "rust")
+
+	post, err := s.Posts.GetPostByID(firstID, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if post.Title != "First" || post.Nickname != "alice" || !post.CreatedAt.Equal(clk.Now().Add(-2*time.Minute)) {
+		t.Errorf("GetPostByID = %q by %s at %v", post.Title, post.Nickname, post.CreatedAt)
+	}
+	if names := categoryNames(post.Categories); !equalStrings(names, []string{"go", "sql"}) {
+		t.Errorf("categories of the post = %v, want [go sql]", names)
+	}
+	categories, err := s.Posts.GetCategoriesByPostID(firstID)
+	if err != nil || !equalStrings(categoryNames(categories), []string{"go", "sql"}) {
+		t.Errorf("GetCategoriesByPostID = %v, %v; want [go sql]", categoryNames(categories), err)
+	}
+
+	tests := []struct {
+		name        string
+		page, size  int
+		sort        string
+		filterType  string
+		filterValue string
+		titles      []string
+		total       int
+		pages       int
+	}{
+		{"newest first", 1, 10, "posts.created_at DESC", "", "", []string{"Third", "Second", "First"}, 3, 1},
+		{"oldest first", 1, 10, "posts.created_at ASC", "", "", []string{"First", "Second", "Third"}, 3, 1},
+		{"second page", 2, 2, "posts.created_at DESC", "", "", []string{"First"}, 3, 2},
+		{"equal rates", 1, 2, "posts.rate DESC", "", "", []string{"Third", "Second"}, 3, 2},
+		{"equal rates, second page", 2, 2, "posts.rate DESC", "", "", []string{"First"}, 3, 2},
+		{"by category", 1, 10, "posts.created_at DESC", "category", "go", []string{"Second", "First"}, 2, 1},
+		{"by nickname", 1, 10, "posts.created_at DESC", "nickname", "alice", []string{"Third", "First"}, 2, 1},
+		{"by user ID", 1, 10, "posts.created_at DESC", "user_id", fmt.Sprint(bobID), []string{"Second"}, 1, 1},
+		{"unknown category", 1, 10, "posts.created_at DESC", "category", "cobol", []string{}, 0, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			posts, total, pages, err := s.Posts.GetPosts(tt.page, tt.size, tt.sort, tt.filterType, tt.filterValue)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !equalStrings(postTitles(posts), tt.titles) || total != tt.total || pages != tt.pages {
+				t.Errorf("GetPosts = %v, %d items, %d pages; want %v, %d, %d", postTitles(posts), total, pages, tt.titles, tt.total, tt.pages)
+			}
+		})
+	}
+
+	attachment := &api.PostCreateRequest{UserID: bobID, Title: "Attached", CreatedAt: clk.Now(), AttachmentIDs: []int{12345}}
+	if err := s.Posts.Create(attachment, []string{"go"}); !errors.Is(err, repositories.ErrAttachmentNotFound) {
+		t.Errorf("creating a post with an unknown attachment: err = %v, want ErrAttachmentNotFound", err)
+	}
+}
+
+func testCommentsAndCounts(t *testing.T, s repositories.Stores, clk *clock.Manual) {
+	aliceID := mustUser(t, s, clk, "alice")
+	bobID := mustUser(t, s, clk, "bob")
+	postID := mustPost(t, s, clk, aliceID, "Discussed", "go")
+	for i := 0; i < 3; i++ {
+		clk.Advance(time.Minute)
+		mustComment(t, s, clk, bobID, postID, fmt.Sprintf("Comment %d", i))
+	}
+
+	comments, total, _, err := s.Comments.GetComments(1, 2, "comments.created_at ASC", "post_id", postID, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total != 3 || len(*comments) != 2 || (*comments)[0].Content != "Comment 0" || (*comments)[0].Nickname != "bob" {
+		t.Errorf("GetComments = %+v (total %d), want the first two of three", *comments, total)
+	}
+
+	if err := s.Counts.RecountPost(postID); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Counts.RecountUser(bobID); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Counts.RecountUser(aliceID); err != nil {
+		t.Fatal(err)
+	}
+	post, err := s.Posts.GetPostByID(postID, 0)
+	if err != nil || post.AmountOfComments != 3 {
+		t.Errorf("amount of comments = %d, %v; want 3", post.AmountOfComments, err)
+	}
+	bob, err := s.Users.GetUserByNickname("bob")
+	if err != nil || bob.AmountOfComments != 3 || bob.AmountOfPosts != 0 {
+		t.Errorf("bob has %d comments and %d posts, %v; want 3 and 0", bob.AmountOfComments, bob.AmountOfPosts, err)
+	}
+	alice, err := s.Users.GetUserByNickname("alice")
+	if err != nil || alice.AmountOfPosts != 1 {
+		t.Errorf("alice has %d posts, %v; want 1", alice.AmountOfPosts, err)
+	}
+}
+
+func testRates(t *testing.T, s repositories.Stores, clk *clock.Manual) {
+	aliceID := mustUser(t, s, clk, "alice")
+	bobID := mustUser(t, s, clk, "bob")
+	postID := mustPost(t, s, clk, aliceID, "Rated", "go")
+	commentID := mustComment(t, s, clk, aliceID, postID, "Rated comment")
+
+	steps := []struct {
+		userID int
+		req    api.RateRequest
+		want   api.Rate
+	}{
+		{bobID, api.RateRequest{PostID: postID, Status: "up"}, api.Rate{Rate: 1, Upvotes: 1, Status: "up"}},
+		{aliceID, api.RateRequest{PostID: postID, Status: "down"}, api.Rate{Rate: 0, Upvotes: 1, Downvotes: 1, Status: "down"}},
+		{bobID, api.RateRequest{PostID: postID, Status: "up"}, api.Rate{Rate: -1, Downvotes: 1}},
+		{bobID, api.RateRequest{PostID: postID, Status: "down"}, api.Rate{Rate: -2, Downvotes: 2, Status: "down"}},
+		{bobID, api.RateRequest{PostID: postID, CommentID: commentID, Status: "up"}, api.Rate{Rate: 1, Upvotes: 1, Status: "up"}},
+	}
+	for i, step := range steps {
+		rate, err := s.Rates.UpdateRate(step.userID, step.req)
+		if err != nil {
+			t.Fatalf("step %d: %v", i, err)
+		}
+		if rate != step.want {
+			t.Errorf("step %d: UpdateRate(%+v) = %+v, want %+v", i, step.req, rate, step.want)
+		}
+	}
+
+	if _, err := s.Rates.UpdateRate(bobID, api.RateRequest{PostID: postID + 100, Status: "up"}); !errors.Is(err, repositories.ErrRateTargetNotFound) {
+		t.Errorf("voting on a missing post: err = %v, want ErrRateTargetNotFound", err)
+	}
+	if _, err := s.Rates.UpdateRate(bobID, api.RateRequest{PostID: postID, CommentID: commentID + 100, Status: "up"}); !errors.Is(err, repositories.ErrRateTargetNotFound) {
+		t.Errorf("voting on a missing comment: err = %v, want ErrRateTargetNotFound", err)
+	}
+
+	post, err := s.Posts.GetPostByID(postID, bobID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if post.Rate != (api.Rate{Rate: -2, Downvotes: 2, Status: "down"}) {
+		t.Errorf("rate of the post for bob = %+v", post.Rate)
+	}
+	if fixed, err := s.Rates.Reconcile(); err != nil || fixed != 0 {
+		t.Errorf("Reconcile = %d, %v; want no wrong totals", fixed, err)
+	}
+	if _, err := s.Rates.RefreshRankings(clk.Now()); err != nil {
+		t.Errorf("RefreshRankings: %v", err)
+	}
+}
+
+func testRankings(t *testing.T, s repositories.Stores, clk *clock.Manual) {
+	aliceID := mustUser(t, s, clk, "alice")
+	bobID := mustUser(t, s, clk, "bob")
+	oldID := mustPost(t, s, clk, aliceID, "Old favourite", "go")
+	for _, voterID := range []int{aliceID, bobID} {
+		if _, err := s.Rates.UpdateRate(voterID, api.RateRequest{PostID: oldID, Status: "up"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	clk.Advance(36 * time.Hour)
+	newID := mustPost(t, s, clk, bobID, "Fresh", "go")
+	if _, err := s.Rates.UpdateRate(aliceID, api.RateRequest{PostID: newID, Status: "up"}); err != nil {
+		t.Fatal(err)
+	}
+
+	topOfDay := func() []string {
+		t.Helper()
+		posts, _, _, err := s.Posts.GetPosts(1, 10, "posts.top_day DESC", "", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return postTitles(posts)
+	}
+	if titles := topOfDay(); !equalStrings(titles, []string{"Old favourite", "Fresh"}) {
+		t.Errorf("top of the day before refreshing = %v, still counting the old votes", titles)
+	}
+
+	if changed, err := s.Rates.RefreshRankings(clk.Now()); err != nil || changed == 0 {
+		t.Errorf("RefreshRankings = %d, %v; want the aged scores changed", changed, err)
+	}
+	if titles := topOfDay(); !equalStrings(titles, []string{"Fresh", "Old favourite"}) {
+		t.Errorf("top of the day after refreshing = %v, want Fresh first", titles)
+	}
+	if changed, err := s.Rates.RefreshRankings(clk.Now()); err != nil || changed != 0 {
+		t.Errorf("refreshing again = %d, %v; want nothing changed", changed, err)
+	}
+}
+
+func testFollows(t *testing.T, s repositories.Stores, clk *clock.Manual) {
+	aliceID := mustUser(t, s, clk, "alice")
+	bobID := mustUser(t, s, clk, "bob")
+	carolID := mustUser(t, s, clk, "carol")
+	mustPost(t, s, clk, bobID, "By bob", "misc")
+	clk.Advance(time.Minute)
+	mustPost(t, s, clk, carolID, "About go", "go")
+	clk.Advance(time.Minute)
+	mustPost(t, s, clk, carolID, "About rust", "rust")
+	clk.Advance(time.Minute)
+	mustPost(t, s, clk, aliceID, "By alice", "go")
+
+	if err := s.Follows.FollowUser(aliceID, bobID); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Follows.FollowUser(aliceID, bobID); err != nil {
+		t.Errorf("following a user twice: %v", err)
+	}
+	if err := s.Follows.FollowCategory(aliceID, "go"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Follows.FollowCategory(aliceID, "cobol"); !errors.Is(err, repositories.ErrCategoryNotFound) {
+		t.Errorf("following an unknown category: err = %v, want ErrCategoryNotFound", err)
+	}
+
+	following, err := s.Follows.GetFollowing(aliceID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(following.Users) != 1 || following.Users[0].Nickname != "bob" || !equalStrings(categoryNames(following.Categories), []string{"go"}) {
+		t.Errorf("GetFollowing = %+v", following)
+	}
+
+	feed, total, _, err := s.Posts.GetFeed(aliceID, 1, 10, "posts.created_at DESC", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"By alice", "About go", "By bob"}; !equalStrings(postTitles(feed), want) || total != 3 {
+		t.Errorf("GetFeed = %v (total %d), want %v", postTitles(feed), total, want)
+	}
+	for _, post := range feed {
+		if len(post.Categories) != 1 {
+			t.Errorf("%q has categories %v, want one", post.Title, categoryNames(post.Categories))
+		}
+	}
+
+	// Pages that continue after a post are not shifted by newer posts
+	first, _, _, err := s.Posts.GetFeed(aliceID, 1, 2, "posts.created_at DESC", 0)
+	if err != nil || len(first) != 2 {
+		t.Fatalf("first page = %v, %v", postTitles(first), err)
+	}
+	clk.Advance(time.Minute)
+	mustPost(t, s, clk, bobID, "Newer by bob", "misc")
+	for _, order := range []struct {
+		sortBy string
+		after  int
+		want   []string
+	}{
+		{"posts.created_at DESC", first[1].ID, []string{"By bob"}},
+		{"posts.created_at DESC", feed[2].ID, nil},
+		{"posts.created_at ASC", feed[1].ID, []string{"By alice", "Newer by bob"}},
+	} {
+		page, total, _, err := s.Posts.GetFeed(aliceID, 1, 2, order.sortBy, order.after)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !equalStrings(postTitles(page), order.want) || total != 4 {
+			t.Errorf("GetFeed(%s) after %d = %v (total %d), want %v", order.sortBy, order.after, postTitles(page), total, order.want)
+		}
+	}
+
+	if err := s.Follows.UnfollowUser(aliceID, bobID); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Follows.UnfollowCategory(aliceID, "go"); err != nil {
+		t.Fatal(err)
+	}
+	if feed, total, _, err := s.Posts.GetFeed(aliceID, 1, 10, "posts.created_at DESC", 0); err != nil || len(feed) != 0 || total != 0 {
+		t.Errorf("feed after unfollowing = %v (total %d), %v; want empty", postTitles(feed), total, err)
+	}
+}
+
+func testBookmarks(t *testing.T, s repositories.Stores, clk *clock.Manual) {
+	aliceID := mustUser(t, s, clk, "alice")
+	bobID := mustUser(t, s, clk, "bob")
+	var postIDs []int
+	for _, title := range []string{"One", "Two", "Three"} {
+		postIDs = append(postIDs, mustPost(t, s, clk, bobID, title, "go"))
+	}
+
+	collection, err := s.Bookmarks.CreateCollection(aliceID, "Read later")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Bookmarks.CreateCollection(aliceID, "Read later"); !errors.Is(err, repositories.ErrCollectionExists) {
+		t.Errorf("duplicate collection: err = %v, want ErrCollectionExists", err)
+	}
+	if _, err := s.Bookmarks.CreateCollection(bobID, "Read later"); err != nil {
+		t.Errorf("another user's collection of the same name: %v", err)
+	}
+
+	var bookmarkIDs []int
+	for _, postID := range postIDs {
+		id, err := s.Bookmarks.AddBookmark(aliceID, collection.ID, api.BookmarkRequest{PostID: postID})
+		if err != nil {
+			t.Fatal(err)
+		}
+		bookmarkIDs = append(bookmarkIDs, id)
+	}
+	if _, err := s.Bookmarks.AddBookmark(aliceID, collection.ID, api.BookmarkRequest{PostID: postIDs[0]}); !errors.Is(err, repositories.ErrBookmarkExists) {
+		t.Errorf("saving a post twice: err = %v, want ErrBookmarkExists", err)
+	}
+	if _, err := s.Bookmarks.AddBookmark(aliceID, collection.ID, api.BookmarkRequest{PostID: postIDs[2] + 100}); !errors.Is(err, repositories.ErrBookmarkTargetNotFound) {
+		t.Errorf("saving a missing post: err = %v, want ErrBookmarkTargetNotFound", err)
+	}
+	if _, err := s.Bookmarks.AddBookmark(bobID, collection.ID, api.BookmarkRequest{PostID: postIDs[0]}); !errors.Is(err, repositories.ErrCollectionNotFound) {
+		t.Errorf("saving into another user's collection: err = %v, want ErrCollectionNotFound", err)
+	}
+
+	if err := s.Bookmarks.MoveBookmark(aliceID, collection.ID, bookmarkIDs[2], 1); err != nil {
+		t.Fatal(err)
+	}
+	bookmarks, total, _, err := s.Bookmarks.GetBookmarks(aliceID, collection.ID, 1, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var titles []string
+	for i, b := range bookmarks {
+		titles = append(titles, b.Title)
+		if b.Position != i+1 {
+			t.Errorf("bookmark %q is at position %d, want %d", b.Title, b.Position, i+1)
+		}
+	}
+	if want := []string{"Three", "One", "Two"}; !equalStrings(titles, want) || total != 3 {
+		t.Errorf("bookmarks after moving = %v (total %d), want %v", titles, total, want)
+	}
+
+	if err := s.Bookmarks.RemoveBookmark(aliceID, collection.ID, bookmarkIDs[0]); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Bookmarks.RemoveBookmark(aliceID, collection.ID, bookmarkIDs[0]); !errors.Is(err, repositories.ErrBookmarkNotFound) {
+		t.Errorf("removing a removed bookmark: err = %v, want ErrBookmarkNotFound", err)
+	}
+	for _, user := range []struct {
+		id   int
+		want map[int]bool
+	}{
+		{aliceID, map[int]bool{postIDs[1]: true, postIDs[2]: true}},
+		{bobID, map[int]bool{}},
+	} {
+		bookmarked, err := s.Bookmarks.BookmarkedPosts(user.id, postIDs)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(bookmarked) != len(user.want) {
+			t.Errorf("BookmarkedPosts(%d) = %v, want %v", user.id, bookmarked, user.want)
+		}
+		for id := range user.want {
+			if !bookmarked[id] {
+				t.Errorf("BookmarkedPosts(%d) = %v, want %v", user.id, bookmarked, user.want)
+			}
+		}
+	}
+	if post, err := s.Posts.GetPostByID(postIDs[1], aliceID); err != nil || !post.Bookmarked {
+		t.Errorf("GetPostByID of a saved post: Bookmarked = %v, %v", post != nil && post.Bookmarked, err)
+	}
+
+	collections, err := s.Bookmarks.GetCollections(aliceID)
+	if err != nil || len(collections) != 1 || collections[0].ItemsCount != 2 {
+		t.Errorf("GetCollections = %+v, %v; want one collection of 2 items", collections, err)
+	}
+
+	if err := s.Bookmarks.DeleteCollection(bobID, collection.ID); !errors.Is(err, repositories.ErrCollectionNotFound) {
+		t.Errorf("deleting another user's collection: err = %v, want ErrCollectionNotFound", err)
+	}
+	if err := s.Bookmarks.DeleteCollection(aliceID, collection.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, _, err := s.Bookmarks.GetBookmarks(aliceID, collection.ID, 1, 10); !errors.Is(err, repositories.ErrCollectionNotFound) {
+		t.Errorf("listing a deleted collection: err = %v, want ErrCollectionNotFound", err)
+	}
+}
+
+func testChats(t *testing.T, s repositories.Stores, clk *clock.Manual) {
+	aliceID := mustUser(t, s, clk, "alice")
+	bobID := mustUser(t, s, clk, "bob")
+	carolID := mustUser(t, s, clk, "carol")
+
+	hash, err := s.Chats.CreateChat(aliceID, bobID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again, err := s.Chats.CreateChat(bobID, aliceID); err != nil || again != hash {
+		t.Errorf("creating the chat again = %q, %v; want %q", again, err, hash)
+	}
+
+	for _, tt := range []struct {
+		userID int
+		hash   string
+		err    error
+	}{{aliceID, hash, nil}, {bobID, hash, nil}, {carolID, hash, repositories.ErrChatNotFound}, {aliceID, "unknown", repositories.ErrChatNotFound}} {
+		if access, err := s.Chats.CheckChatAccess(tt.userID, tt.hash); !errors.Is(err, tt.err) || access != (tt.err == nil) {
+			t.Errorf("CheckChatAccess(%d, %s) = %v, %v; want error %v", tt.userID, tt.hash, access, err, tt.err)
+		}
+	}
+
+	for i, text := range []string{"Hello @bob", "Hi alice"} {
+		sender := &api.UserResponse{ID: aliceID, Nickname: "alice"}
+		if i == 1 {
+			sender = &api.UserResponse{ID: bobID, Nickname: "bob"}
+		}
+		clk.Advance(time.Second)
+		msg := &api.MessageMessage{RoomHash: hash, Sender: sender, Message: text, SendAt: clk.Now()}
+		if err := s.Chats.SaveMessage(msg); err != nil {
+			t.Fatal(err)
+		}
+		if msg.ID == 0 {
+			t.Errorf("message %q has no ID", text)
+		}
+	}
+
+	messages, err := s.Chats.GetMessagesForChat(hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(messages) != 2 || messages[0].Message != "Hello @bob" || messages[1].Sender.ID != bobID {
+		t.Fatalf("GetMessagesForChat = %+v", messages)
+	}
+	if len(messages[0].Mentions) != 1 || messages[0].Mentions[0].Nickname != "bob" {
+		t.Errorf("mentions of the first message = %+v, want bob", messages[0].Mentions)
+	}
+
+	chats, err := s.Chats.GetChatsForUser(bobID)
+	if err != nil || len(chats) != 1 || chats[0].ChatHash != hash {
+		t.Errorf("GetChatsForUser = %+v, %v", chats, err)
+	}
+	if chats, err := s.Chats.GetChatsForUser(carolID); err != nil || len(chats) != 0 {
+		t.Errorf("chats of carol = %+v, %v; want none", chats, err)
+	}
+}
+
+func testReactions(t *testing.T, s repositories.Stores, clk *clock.Manual) {
+	aliceID := mustUser(t, s, clk, "alice")
+	bobID := mustUser(t, s, clk, "bob")
+	postID := mustPost(t, s, clk, aliceID, "Reacted", "go")
+	commentID := mustComment(t, s, clk, bobID, postID, "Reacted comment")
+
+	steps := []struct {
+		userID int
+		req    api.ReactionRequest
+		added  bool
+	}{
+		{aliceID, api.ReactionRequest{PostID: postID, Emoji: "👍"}, true},
+		{aliceID, api.ReactionRequest{PostID: postID, Emoji: "👍"}, false},
+		{bobID, api.ReactionRequest{PostID: postID, Emoji: "👍"}, true},
+		{bobID, api.ReactionRequest{PostID: postID, Emoji: "🎉"}, true},
+		{aliceID, api.ReactionRequest{PostID: postID, CommentID: commentID, Emoji: "❤️"}, true},
+	}
+	for i, step := range steps {
+		added, err := s.Reactions.AddReaction(step.userID, step.req)
+		if err != nil || added != step.added {
+			t.Errorf("step %d: AddReaction = %v, %v; want %v", i, added, err, step.added)
+		}
+	}
+	if _, err := s.Reactions.AddReaction(aliceID, api.ReactionRequest{PostID: postID + 100, Emoji: "👍"}); !errors.Is(err, repositories.ErrReactionTargetNotFound) {
+		t.Errorf("reacting to a missing post: err = %v, want ErrReactionTargetNotFound", err)
+	}
+
+	reactions, err := s.Reactions.GetPostReactions([]int{postID}, aliceID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	counts := map[string]api.Reaction{}
+	for _, r := range reactions[postID] {
+		counts[r.Emoji] = r
+	}
+	if counts["👍"] != (api.Reaction{Emoji: "👍", Count: 2, ReactedByMe: true}) || counts["🎉"] != (api.Reaction{Emoji: "🎉", Count: 1}) || len(counts) != 2 {
+		t.Errorf("reactions to the post for alice = %+v", reactions[postID])
+	}
+
+	if removed, err := s.Reactions.RemoveReaction(bobID, api.ReactionRequest{PostID: postID, Emoji: "🎉"}); err != nil || !removed {
+		t.Errorf("RemoveReaction = %v, %v; want true", removed, err)
+	}
+	if removed, err := s.Reactions.RemoveReaction(bobID, api.ReactionRequest{PostID: postID, Emoji: "🎉"}); err != nil || removed {
+		t.Errorf("removing a removed reaction = %v, %v; want false", removed, err)
+	}
+	comments, err := s.Reactions.GetCommentReactions([]int{commentID}, bobID)
+	if err != nil || len(comments[commentID]) != 1 || comments[commentID][0].ReactedByMe {
+		t.Errorf("reactions to the comment for bob = %+v, %v", comments[commentID], err)
+	}
+}
+
+func testPolls(t *testing.T, s repositories.Stores, clk *clock.Manual) {
+	aliceID := mustUser(t, s, clk, "alice")
+	bobID := mustUser(t, s, clk, "bob")
+	closesAt := clk.Now().Add(time.Hour)
+	post := &api.PostCreateRequest{UserID: aliceID, Title: "Poll", CreatedAt: clk.Now(), Poll: &api.PollCreateRequest{
+		Question: "Where?",
+		Options:  []string{"Park", "Library"},
+		ClosesAt: &closesAt,
+	}}
+	if err := s.Posts.Create(post, []string{"go"}); err != nil {
+		t.Fatal(err)
+	}
+	plainID := mustPost(t, s, clk, aliceID, "No poll", "go")
+
+	polls, err := s.Polls.GetPolls([]int{post.ID, plainID}, bobID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	poll := polls[post.ID]
+	if poll == nil || len(poll.Options) != 2 || polls[plainID] != nil {
+		t.Fatalf("GetPolls = %+v", polls)
+	}
+	park, library := poll.Options[0].ID, poll.Options[1].ID
+
+	tests := []struct {
+		name    string
+		postID  int
+		options []int
+		err     error
+	}{
+		{"single choice", post.ID, []int{park, library}, repositories.ErrPollSingleChoice},
+		{"unknown option", post.ID, []int{library + 100}, repositories.ErrPollOptionNotFound},
+		{"post without poll", plainID, []int{park}, repositories.ErrPollNotFound},
+		{"vote", post.ID, []int{park}, nil},
+		{"change the vote", post.ID, []int{library}, nil},
+	}
+	for _, tt := range tests {
+		if err := s.Polls.Vote(tt.postID, bobID, tt.options, clk.Now()); !errors.Is(err, tt.err) {
+			t.Errorf("%s: err = %v, want %v", tt.name, err, tt.err)
+		}
+	}
+
+	polls, err = s.Polls.GetPolls([]int{post.ID}, bobID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	poll = polls[post.ID]
+	if poll.TotalVoters != 1 || poll.Options[0].Votes != 0 || poll.Options[1].Votes != 1 || len(poll.MyVotes) != 1 || poll.MyVotes[0] != library {
+		t.Errorf("poll after changing the vote = %+v", poll)
+	}
+
+	clk.Advance(2 * time.Hour)
+	if err := s.Polls.Vote(post.ID, aliceID, []int{park}, clk.Now()); !errors.Is(err, repositories.ErrPollClosed) {
+		t.Errorf("voting in a closed poll: err = %v, want ErrPollClosed", err)
+	}
+	if _, err := s.Polls.WithdrawVote(post.ID, bobID, clk.Now()); !errors.Is(err, repositories.ErrPollClosed) {
+		t.Errorf("withdrawing from a closed poll: err = %v, want ErrPollClosed", err)
+	}
+}
+
+func testDrafts(t *testing.T, s repositories.Stores, clk *clock.Manual) {
+	aliceID := mustUser(t, s, clk, "alice")
+	bobID := mustUser(t, s, clk, "bob")
+	// Scheduled from another time zone, whose local time sorts before the
+	// current time in UTC when compared as text
+	publishAt := clk.Now().Add(time.Hour).In(time.FixedZone("HST", -10*60*60))
+
+	draft, err := s.Drafts.CreateDraft(aliceID, api.DraftRequest{Title: "Later", Content: "Scheduled", Categories: "#go", PublishAt: &publishAt}, clk.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Drafts.CreateDraft(aliceID, api.DraftRequest{Title: "Unscheduled"}, clk.Now()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Drafts.GetDraft(bobID, draft.ID); !errors.Is(err, repositories.ErrDraftNotFound) {
+		t.Errorf("another user's draft: err = %v, want ErrDraftNotFound", err)
+	}
+
+	clk.Advance(time.Minute)
+	updated, err := s.Drafts.UpdateDraft(aliceID, draft.ID, api.DraftRequest{Title: "Later, edited", Content: "Scheduled", Categories: "#go", PublishAt: &publishAt}, clk.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !updated.UpdatedAt.Equal(clk.Now()) || !updated.CreatedAt.Equal(clk.Now().Add(-time.Minute)) {
+		t.Errorf("updated draft created %v, updated %v", updated.CreatedAt, updated.UpdatedAt)
+	}
+	drafts, err := s.Drafts.GetDrafts(aliceID)
+	if err != nil || len(drafts) != 2 || drafts[0].ID != draft.ID {
+		t.Errorf("GetDrafts = %+v, %v; want the edited draft first", drafts, err)
+	}
+
+	if due, err := s.Drafts.GetDueDrafts(clk.Now()); err != nil || len(due) != 0 {
+		t.Errorf("due drafts before the time = %+v, %v", due, err)
+	}
+	clk.Advance(2 * time.Hour)
+	due, err := s.Drafts.GetDueDrafts(clk.Now())
+	if err != nil || len(due) != 1 || due[0].ID != draft.ID {
+		t.Fatalf("due drafts = %+v, %v", due, err)
+	}
+
+	post, err := s.Drafts.PublishDraft(aliceID, draft.ID, clk.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !post.CreatedAt.Equal(publishAt) {
+		t.Errorf("published post is dated %v, want the scheduled %v", post.CreatedAt, publishAt)
+	}
+	published, err := s.Posts.GetPostByID(post.ID, 0)
+	if err != nil || published.Title != "Later, edited" || !equalStrings(categoryNames(published.Categories), []string{"go"}) {
+		t.Errorf("published post = %+v, %v", published, err)
+	}
+	if _, err := s.Drafts.PublishDraft(aliceID, draft.ID, clk.Now()); !errors.Is(err, repositories.ErrDraftNotFound) {
+		t.Errorf("publishing twice: err = %v, want ErrDraftNotFound", err)
+	}
+}
+
+func testWebhooks(t *testing.T, s repositories.Stores, clk *clock.Manual) {
+	hook := &api.Webhook{URL: "https://example.com/hook", Events: []string{"post.created"}, Active: true, Secret: "secret", CreatedAt: clk.Now()}
+	if err := s.Webhooks.CreateWebhook(hook); err != nil {
+		t.Fatal(err)
+	}
+	inactive := &api.Webhook{URL: "https://example.com/off", Events: []string{"post.created"}, Secret: "secret", CreatedAt: clk.Now()}
+	if err := s.Webhooks.CreateWebhook(inactive); err != nil {
+		t.Fatal(err)
+	}
+
+	payload := json.RawMessage(`{"post_id":1}`)
+	if queued, err := s.Webhooks.EnqueueDeliveries("post.created", payload, clk.Now()); err != nil || queued != 1 {
+		t.Errorf("EnqueueDeliveries(post.created) = %d, %v; want 1", queued, err)
+	}
+	if queued, err := s.Webhooks.EnqueueDeliveries("comment.created", payload, clk.Now()); err != nil || queued != 0 {
+		t.Errorf("EnqueueDeliveries(comment.created) = %d, %v; want 0", queued, err)
+	}
+
+	claimed, err := s.Webhooks.ClaimDueDeliveries(clk.Now(), clk.Now().Add(time.Minute), 10)
+	if err != nil || len(claimed) != 1 || claimed[0].WebhookID != hook.ID || string(claimed[0].Payload) != string(payload) {
+		t.Fatalf("ClaimDueDeliveries = %+v, %v", claimed, err)
+	}
+	if again, err := s.Webhooks.ClaimDueDeliveries(clk.Now(), clk.Now().Add(time.Minute), 10); err != nil || len(again) != 0 {
+		t.Errorf("claiming a claimed delivery = %+v, %v; want none", again, err)
+	}
+
+	delivered := claimed[0]
+	deliveredAt := clk.Now()
+	delivered.Status = "delivered"
+	delivered.Attempts = 1
+	delivered.LastStatusCode = 204
+	delivered.NextAttemptAt = nil
+	delivered.DeliveredAt = &deliveredAt
+	if err := s.Webhooks.SaveDeliveryResult(delivered); err != nil {
+		t.Fatal(err)
+	}
+	clk.Advance(time.Hour)
+	if again, err := s.Webhooks.ClaimDueDeliveries(clk.Now(), clk.Now().Add(time.Minute), 10); err != nil || len(again) != 0 {
+		t.Errorf("claiming a delivered delivery = %+v, %v; want none", again, err)
+	}
+	deliveries, total, _, err := s.Webhooks.GetDeliveries(hook.ID, 1, 10)
+	if err != nil || total != 1 || deliveries[0].Status != "delivered" || deliveries[0].LastStatusCode != 204 {
+		t.Errorf("GetDeliveries = %+v (total %d), %v", deliveries, total, err)
+	}
+
+	redelivery, err := s.Webhooks.RedeliverDelivery(hook.ID, delivered.ID, clk.Now())
+	if err != nil || redelivery.Status != "pending" || redelivery.Attempts != 0 {
+		t.Errorf("RedeliverDelivery = %+v, %v", redelivery, err)
+	}
+	if _, err := s.Webhooks.RedeliverDelivery(inactive.ID, delivered.ID, clk.Now()); !errors.Is(err, repositories.ErrWebhookDeliveryNotFound) {
+		t.Errorf("redelivering through another webhook: err = %v, want ErrWebhookDeliveryNotFound", err)
+	}
+
+	if err := s.Webhooks.DeleteWebhook(hook.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Webhooks.GetWebhook(hook.ID); !errors.Is(err, repositories.ErrWebhookNotFound) {
+		t.Errorf("deleted webhook: err = %v, want ErrWebhookNotFound", err)
+	}
+}
+
+func testOutbox(t *testing.T, s repositories.Stores, clk *clock.Manual) {
+	aliceID := mustUser(t, s, clk, "alice")
+	clk.Advance(time.Second)
+	postID := mustPost(t, s, clk, aliceID, "Announced", "go")
+
+	until := clk.Now().Add(time.Minute)
+	events, err := s.Outbox.ClaimEvents(clk.Now(), until, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 2 || events[0].Name != "user.registered" || events[1].Name != "post.created" || events[1].Attempts != 1 {
+		t.Fatalf("ClaimEvents = %+v, want user.registered and post.created", events)
+	}
+	var created api.PostCreatedEvent
+	if err := json.Unmarshal(events[1].Payload, &created); err != nil || created.PostID != postID || created.Author.ID != aliceID {
+		t.Errorf("post.created payload = %s, %v", events[1].Payload, err)
+	}
+
+	if again, err := s.Outbox.ClaimEvents(clk.Now(), until, 10); err != nil || len(again) != 0 {
+		t.Errorf("claiming claimed events = %+v, %v; want none", again, err)
+	}
+	if err := s.Outbox.MarkDispatched(events[0].ID, clk.Now()); err != nil {
+		t.Fatal(err)
+	}
+	// Recording a subscriber twice is harmless
+	for _, subscribers := range [][]string{{"webhooks", "counters"}, {"counters"}, nil} {
+		if err := s.Outbox.MarkDelivered(events[1].ID, subscribers, clk.Now()); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	clk.Advance(2 * time.Minute)
+	again, err := s.Outbox.ClaimEvents(clk.Now(), clk.Now().Add(time.Minute), 10)
+	if err != nil || len(again) != 1 || again[0].ID != events[1].ID || again[0].Attempts != 2 {
+		t.Fatalf("claiming after the claim lapsed = %+v, %v; want post.created again", again, err)
+	}
+	if !slices.Equal(again[0].Delivered, []string{"counters", "webhooks"}) {
+		t.Errorf("post.created delivered to %v, want counters and webhooks", again[0].Delivered)
+	}
+	if err := s.Outbox.MarkDispatched(again[0].ID, clk.Now()); err != nil {
+		t.Fatal(err)
+	}
+
+	// Dispatched or not, events stay readable by the servers following the outbox
+	if last, err := s.Outbox.LastEventID(); err != nil || last != events[1].ID {
+		t.Errorf("LastEventID = %d, %v; want %d", last, err, events[1].ID)
+	}
+	if after, err := s.Outbox.EventsAfter(events[0].ID, 10); err != nil || len(after) != 1 || after[0].ID != events[1].ID || after[0].Name != "post.created" {
+		t.Errorf("EventsAfter(%d) = %+v, %v; want post.created", events[0].ID, after, err)
+	}
+	if after, err := s.Outbox.EventsAfter(0, 1); err != nil || len(after) != 1 || after[0].ID != events[0].ID {
+		t.Errorf("EventsAfter(0) limited to 1 = %+v, %v; want user.registered", after, err)
+	}
+
+	clk.Advance(time.Hour)
+	if pruned, err := s.Outbox.PruneEvents(clk.Now().Add(-30 * time.Minute)); err != nil || pruned != 2 {
+		t.Errorf("PruneEvents = %d, %v; want 2", pruned, err)
+	}
+	if last, err := s.Outbox.LastEventID(); err != nil || last != 0 {
+		t.Errorf("LastEventID of an empty outbox = %d, %v; want 0", last, err)
+	}
+}
+
+func testTokens(t *testing.T, s repositories.Stores, clk *clock.Manual) {
+	aliceID := mustUser(t, s, clk, "alice")
+	bobID := mustUser(t, s, clk, "bob")
+	expiresAt := clk.Now().Add(time.Hour)
+
+	token, err := s.Tokens.Create(aliceID, "ci", "hash-1", []string{"posts:read", "posts:write"}, &expiresAt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	user, scopes, err := s.Tokens.GetUserByTokenHash("hash-1")
+	if err != nil || user == nil || user.ID != aliceID || !equalStrings(scopes, []string{"posts:read", "posts:write"}) {
+		t.Fatalf("GetUserByTokenHash = %+v, %v, %v", user, scopes, err)
+	}
+	tokens, err := s.Tokens.GetTokensForUser(aliceID)
+	if err != nil || len(tokens) != 1 || tokens[0].LastUsedAt == nil || !tokens[0].LastUsedAt.Equal(clk.Now()) {
+		t.Errorf("GetTokensForUser = %+v, %v; want one used now", tokens, err)
+	}
+	if user, _, err := s.Tokens.GetUserByTokenHash("unknown"); user != nil || err != nil {
+		t.Errorf("unknown token = %+v, %v; want nil, nil", user, err)
+	}
+
+	if err := s.Tokens.Delete(bobID, token.ID); !errors.Is(err, repositories.ErrTokenNotFound) {
+		t.Errorf("deleting another user's token: err = %v, want ErrTokenNotFound", err)
+	}
+
+	clk.Advance(2 * time.Hour)
+	if user, _, err := s.Tokens.GetUserByTokenHash("hash-1"); user != nil || err != nil {
+		t.Errorf("expired token = %+v, %v; want nil, nil", user, err)
+	}
+	if err := s.Tokens.Delete(aliceID, token.ID); err != nil {
+		t.Fatal(err)
+	}
+	if tokens, err := s.Tokens.GetTokensForUser(aliceID); err != nil || len(tokens) != 0 {
+		t.Errorf("tokens after deleting = %+v, %v; want none", tokens, err)
+	}
+}
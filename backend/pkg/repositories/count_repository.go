@@ -0,0 +1,40 @@
+package repositories
+
+import (
+	"project-root/pkg/db"
+)
+
+// CountRepository keeps the post and comment counters of users and posts
+type CountRepository struct {
+	DB *db.Pool
+}
+
+// NewCountRepository creates a new CountRepository
+func NewCountRepository(pool *db.Pool) *CountRepository {
+	return &CountRepository{DB: pool}
+}
+
+func (r *CountRepository) RecountUser(userID int) error {
+	return RecountUser(r.DB, db.SQLite, userID)
+}
+
+func (r *CountRepository) RecountPost(postID int) error {
+	return RecountPost(r.DB, db.SQLite, postID)
+}
+
+// RecountUser counts the posts and comments of a user afresh. Counting
+// instead of incrementing gives the same result however often it runs.
+func RecountUser(e Execer, dialect db.Dialect, userID int) error {
+	_, err := e.Exec(dialect.Rebind(`
+		UPDATE users SET
+			amount_of_posts = (SELECT COUNT(*) FROM posts WHERE posts.user_id = users.id),
+			amount_of_comments = (SELECT COUNT(*) FROM comments WHERE comments.user_id = users.id)
+		WHERE id = ?`), userID)
+	return err
+}
+
+// RecountPost counts the comments of a post afresh
+func RecountPost(e Execer, dialect db.Dialect, postID int) error {
+	_, err := e.Exec(dialect.Rebind("UPDATE posts SET amount_of_comments = (SELECT COUNT(*) FROM comments WHERE comments.post_id = posts.id) WHERE id = ?"), postID)
+	return err
+}
@@ -0,0 +1,248 @@
+package repositories
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	"project-root/pkg/api"
+	"project-root/pkg/db"
+)
+
+// ErrDraftNotFound is returned for drafts that do not exist, belong to
+// another user or were published already
+var ErrDraftNotFound = errors.New("draft not found")
+
+// draftColumns are read by scanDraft, in order
+const draftColumns = "id, user_id, title, content, categories, attachment_ids, poll, publish_at, created_at, updated_at"
+
+// DraftRepository provides access to the drafts of unpublished posts
+type DraftRepository struct {
+	DB *db.Pool
+}
+
+// NewDraftRepository creates a new DraftRepository
+func NewDraftRepository(pool *db.Pool) *DraftRepository {
+	return &DraftRepository{DB: pool}
+}
+
+// CreateDraft stores a new draft
+func (r *DraftRepository) CreateDraft(userID int, req api.DraftRequest, now time.Time) (*api.Draft, error) {
+	tx, err := r.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	draft, err := InsertDraft(tx, db.SQLite, userID, req, now)
+	if err != nil {
+		return nil, err
+	}
+	return draft, tx.Commit()
+}
+
+func (r *DraftRepository) UpdateDraft(userID, draftID int, req api.DraftRequest, now time.Time) (*api.Draft, error) {
+	tx, err := r.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	draft, err := UpdateDraft(tx, db.SQLite, userID, draftID, req, now)
+	if err != nil {
+		return nil, err
+	}
+	return draft, tx.Commit()
+}
+
+func (r *DraftRepository) GetDrafts(userID int) ([]api.Draft, error) {
+	return LoadDrafts(r.DB, db.SQLite, "user_id = ? ORDER BY updated_at DESC, id DESC", userID)
+}
+
+func (r *DraftRepository) GetDraft(userID, draftID int) (*api.Draft, error) {
+	return LoadDraft(r.DB, db.SQLite, userID, draftID)
+}
+
+func (r *DraftRepository) DeleteDraft(userID, draftID int) error {
+	return DeleteDraft(r.DB, db.SQLite, userID, draftID)
+}
+
+func (r *DraftRepository) GetDueDrafts(now time.Time) ([]api.Draft, error) {
+	return LoadDrafts(r.DB, db.SQLite, "publish_at <= ? ORDER BY publish_at, id", now.UTC())
+}
+
+func (r *DraftRepository) UnscheduleDraft(userID, draftID int) error {
+	_, err := r.DB.Exec("UPDATE drafts SET publish_at = NULL WHERE id = ? AND user_id = ?", draftID, userID)
+	return err
+}
+
+// PublishDraft turns a draft into a post in a single transaction
+func (r *DraftRepository) PublishDraft(userID, draftID int, now time.Time) (*api.PostCreateRequest, error) {
+	tx, err := r.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	post, err := PublishDraft(tx, db.SQLite, userID, draftID, now)
+	if err != nil {
+		return nil, err
+	}
+	return post, tx.Commit()
+}
+
+// draftValues encodes the parts of a draft that are stored as JSON
+func draftValues(req api.DraftRequest) (attachmentIDs string, poll sql.NullString, publishAt sql.NullTime, err error) {
+	ids, err := json.Marshal(req.AttachmentIDs)
+	if err != nil {
+		return "", poll, publishAt, err
+	}
+	if req.Poll != nil {
+		encoded, err := json.Marshal(req.Poll)
+		if err != nil {
+			return "", poll, publishAt, err
+		}
+		poll = sql.NullString{String: string(encoded), Valid: true}
+	}
+	if req.PublishAt != nil {
+		// SQLite compares the times as text, so they are all kept in UTC
+		publishAt = sql.NullTime{Time: req.PublishAt.UTC(), Valid: true}
+	}
+	return string(ids), poll, publishAt, nil
+}
+
+// InsertDraft stores a new draft of the user
+func InsertDraft(q Queryer, dialect db.Dialect, userID int, req api.DraftRequest, now time.Time) (*api.Draft, error) {
+	attachmentIDs, poll, publishAt, err := draftValues(req)
+	if err != nil {
+		return nil, err
+	}
+	drafts, err := scanDrafts(q, dialect.Rebind(`
+		INSERT INTO drafts (user_id, title, content, categories, attachment_ids, poll, publish_at, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+		RETURNING `+draftColumns),
+		userID, req.Title, req.Content, req.Categories, attachmentIDs, poll, publishAt, now, now)
+	if err != nil {
+		return nil, err
+	}
+	return &drafts[0], nil
+}
+
+// UpdateDraft replaces a draft of the user
+func UpdateDraft(q Queryer, dialect db.Dialect, userID, draftID int, req api.DraftRequest, now time.Time) (*api.Draft, error) {
+	attachmentIDs, poll, publishAt, err := draftValues(req)
+	if err != nil {
+		return nil, err
+	}
+	drafts, err := scanDrafts(q, dialect.Rebind(`
+		UPDATE drafts SET title = ?, content = ?, categories = ?, attachment_ids = ?, poll = ?, publish_at = ?, updated_at = ?
+		WHERE id = ? AND user_id = ?
+		RETURNING `+draftColumns),
+		req.Title, req.Content, req.Categories, attachmentIDs, poll, publishAt, now, draftID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if len(drafts) == 0 {
+		return nil, ErrDraftNotFound
+	}
+	return &drafts[0], nil
+}
+
+// LoadDraft returns a draft of the user
+func LoadDraft(q Queryer, dialect db.Dialect, userID, draftID int) (*api.Draft, error) {
+	drafts, err := LoadDrafts(q, dialect, "id = ? AND user_id = ?", draftID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if len(drafts) == 0 {
+		return nil, ErrDraftNotFound
+	}
+	return &drafts[0], nil
+}
+
+// LoadDrafts returns the drafts matching where
+func LoadDrafts(q Queryer, dialect db.Dialect, where string, args ...interface{}) ([]api.Draft, error) {
+	return scanDrafts(q, dialect.Rebind("SELECT "+draftColumns+" FROM drafts WHERE "+where), args...)
+}
+
+// DeleteDraft removes a draft of the user
+func DeleteDraft(e Execer, dialect db.Dialect, userID, draftID int) error {
+	result, err := e.Exec(dialect.Rebind("DELETE FROM drafts WHERE id = ? AND user_id = ?"), draftID, userID)
+	if err != nil {
+		return err
+	}
+	if deleted, err := result.RowsAffected(); err != nil || deleted == 0 {
+		if err == nil {
+			err = ErrDraftNotFound
+		}
+		return err
+	}
+	return nil
+}
+
+// PublishDraft removes a draft of the user inside tx and creates its post
+// with its categories, recording a PostCreatedEvent. As the draft is removed
+// in the same transaction, it is published once however often this runs.
+// The post is dated at the scheduled time once it has come, else at now.
+func PublishDraft(tx *sql.Tx, dialect db.Dialect, userID, draftID int, now time.Time) (*api.PostCreateRequest, error) {
+	drafts, err := scanDrafts(tx, dialect.Rebind("DELETE FROM drafts WHERE id = ? AND user_id = ? RETURNING "+draftColumns), draftID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if len(drafts) == 0 {
+		return nil, ErrDraftNotFound
+	}
+	draft := drafts[0]
+
+	post := draft.PostCreateRequest()
+	post.CreatedAt = now
+	if draft.PublishAt != nil && !draft.PublishAt.After(now) {
+		post.CreatedAt = *draft.PublishAt
+	}
+	if err := CreatePost(tx, dialect, &post, draftCategories(draft.Categories)); err != nil {
+		return nil, err
+	}
+	return &post, nil
+}
+
+// draftCategories splits the categories of a draft, which the handlers store
+// normalized as "#first #second"
+func draftCategories(categories string) []string {
+	var names []string
+	for _, name := range strings.Split(categories, "#") {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// scanDrafts runs a query returning draftColumns and reads the drafts
+func scanDrafts(q Queryer, query string, args ...interface{}) ([]api.Draft, error) {
+	drafts := []api.Draft{}
+	err := scanRows(q, query, args, func(rows *sql.Rows) error {
+		var d api.Draft
+		var attachmentIDs string
+		var poll sql.NullString
+		var publishAt sql.NullTime
+		if err := rows.Scan(&d.ID, &d.UserID, &d.Title, &d.Content, &d.Categories, &attachmentIDs, &poll, &publishAt, &d.CreatedAt, &d.UpdatedAt); err != nil {
+			return err
+		}
+		if err := json.Unmarshal([]byte(attachmentIDs), &d.AttachmentIDs); err != nil {
+			return err
+		}
+		if poll.Valid {
+			if err := json.Unmarshal([]byte(poll.String), &d.Poll); err != nil {
+				return err
+			}
+		}
+		if publishAt.Valid {
+			d.PublishAt = &publishAt.Time
+		}
+		drafts = append(drafts, d)
+		return nil
+	})
+	return drafts, err
+}
@@ -0,0 +1,149 @@
+package repositories
+
+import (
+	"database/sql"
+	"errors"
+	"project-root/pkg/api"
+	"project-root/pkg/clock"
+	"project-root/pkg/db"
+)
+
+// ErrCategoryNotFound is returned when following a category that no post uses
+var ErrCategoryNotFound = errors.New("category not found")
+
+// FollowRepository provides access to the users and categories users follow.
+type FollowRepository struct {
+	DB    *db.Pool
+	clock clock.Clock
+}
+
+// NewFollowRepository creates a new FollowRepository
+func NewFollowRepository(pool *db.Pool, clk clock.Clock) *FollowRepository {
+	return &FollowRepository{DB: pool, clock: clk}
+}
+
+// FollowUser makes follower follow followee. Following twice is not an error.
+func (r *FollowRepository) FollowUser(followerID, followeeID int) error {
+	tx, err := r.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec("INSERT INTO user_follows (follower_id, followee_id, created_at) VALUES (?, ?, ?) ON CONFLICT DO NOTHING",
+		followerID, followeeID, r.clock.Now())
+	if err != nil {
+		return err
+	}
+	if err := updateFollowCounts(tx, result, followerID, followeeID, 1); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// UnfollowUser stops follower from following followee. Unfollowing twice is not an error.
+func (r *FollowRepository) UnfollowUser(followerID, followeeID int) error {
+	tx, err := r.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec("DELETE FROM user_follows WHERE follower_id = ? AND followee_id = ?", followerID, followeeID)
+	if err != nil {
+		return err
+	}
+	if err := updateFollowCounts(tx, result, followerID, followeeID, -1); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// updateFollowCounts adjusts the follower and following counts when a follow was actually added or removed
+func updateFollowCounts(tx *sql.Tx, result sql.Result, followerID, followeeID, delta int) error {
+	affected, err := result.RowsAffected()
+	if err != nil || affected == 0 {
+		return err
+	}
+	if _, err := tx.Exec("UPDATE users SET following_count = following_count + ? WHERE id = ?", delta, followerID); err != nil {
+		return err
+	}
+	_, err = tx.Exec("UPDATE users SET followers_count = followers_count + ? WHERE id = ?", delta, followeeID)
+	return err
+}
+
+// FollowCategory makes the user follow a category by name
+func (r *FollowRepository) FollowCategory(userID int, category string) error {
+	categoryID, err := r.categoryID(category)
+	if err != nil {
+		return err
+	}
+	_, err = r.DB.Exec("INSERT INTO category_follows (user_id, category_id, created_at) VALUES (?, ?, ?) ON CONFLICT DO NOTHING",
+		userID, categoryID, r.clock.Now())
+	return err
+}
+
+// UnfollowCategory stops the user from following a category by name
+func (r *FollowRepository) UnfollowCategory(userID int, category string) error {
+	categoryID, err := r.categoryID(category)
+	if err != nil {
+		return err
+	}
+	_, err = r.DB.Exec("DELETE FROM category_follows WHERE user_id = ? AND category_id = ?", userID, categoryID)
+	return err
+}
+
+func (r *FollowRepository) categoryID(name string) (int, error) {
+	var id int
+	err := r.DB.QueryRow("SELECT id FROM categories WHERE name = ?", name).Scan(&id)
+	if err == sql.ErrNoRows {
+		return 0, ErrCategoryNotFound
+	}
+	return id, err
+}
+
+// GetFollowing lists the users and categories the user follows, in the order they were followed
+func (r *FollowRepository) GetFollowing(userID int) (*api.FollowingResponse, error) {
+	following := api.FollowingResponse{Users: []api.UserResponse{}, Categories: []api.Category{}}
+
+	rows, err := r.DB.Query(`
+		SELECT users.id, users.nickname
+		FROM user_follows
+		JOIN users ON users.id = user_follows.followee_id
+		WHERE user_follows.follower_id = ?
+		ORDER BY user_follows.created_at`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var user api.UserResponse
+		if err := rows.Scan(&user.ID, &user.Nickname); err != nil {
+			return nil, err
+		}
+		following.Users = append(following.Users, user)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	rows, err = r.DB.Query(`
+		SELECT categories.id, categories.name
+		FROM category_follows
+		JOIN categories ON categories.id = category_follows.category_id
+		WHERE category_follows.user_id = ?
+		ORDER BY category_follows.created_at`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var category api.Category
+		if err := rows.Scan(&category.ID, &category.Name); err != nil {
+			return nil, err
+		}
+		following.Categories = append(following.Categories, category)
+	}
+	return &following, rows.Err()
+}
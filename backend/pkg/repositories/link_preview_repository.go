@@ -0,0 +1,58 @@
+package repositories
+
+import (
+	"project-root/pkg/api"
+	"project-root/pkg/db"
+)
+
+// LinkPreviewRepository caches the previews of linked pages
+type LinkPreviewRepository struct {
+	DB *db.Pool
+}
+
+// NewLinkPreviewRepository creates a new LinkPreviewRepository
+func NewLinkPreviewRepository(pool *db.Pool) *LinkPreviewRepository {
+	return &LinkPreviewRepository{DB: pool}
+}
+
+func (r *LinkPreviewRepository) GetLinkPreviews(urls []string) (map[string]api.LinkPreview, error) {
+	return GetLinkPreviews(r.DB, db.SQLite, urls)
+}
+
+func (r *LinkPreviewRepository) SaveLinkPreview(p api.LinkPreview) error {
+	_, err := r.DB.Exec(`
+		INSERT INTO link_previews (url, title, description, image_url, site_name, fetched_at)
+		VALUES (?, ?, ?, ?, ?, ?)
+		ON CONFLICT (url) DO UPDATE SET title = excluded.title, description = excluded.description,
+			image_url = excluded.image_url, site_name = excluded.site_name, fetched_at = excluded.fetched_at`,
+		p.URL, p.Title, p.Description, p.ImageURL, p.SiteName, p.FetchedAt)
+	return err
+}
+
+// GetLinkPreviews returns the cached previews of urls keyed by URL
+func GetLinkPreviews(q Queryer, dialect db.Dialect, urls []string) (map[string]api.LinkPreview, error) {
+	previews := make(map[string]api.LinkPreview)
+	if len(urls) == 0 {
+		return previews, nil
+	}
+	args := make([]interface{}, len(urls))
+	for i, u := range urls {
+		args[i] = u
+	}
+	rows, err := q.Query(dialect.Rebind(`
+		SELECT url, title, description, image_url, site_name, fetched_at
+		FROM link_previews WHERE url IN (`+placeholders(len(urls))+`)`), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var p api.LinkPreview
+		if err := rows.Scan(&p.URL, &p.Title, &p.Description, &p.ImageURL, &p.SiteName, &p.FetchedAt); err != nil {
+			return nil, err
+		}
+		previews[p.URL] = p
+	}
+	return previews, rows.Err()
+}
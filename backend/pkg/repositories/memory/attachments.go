@@ -0,0 +1,80 @@
+package memory
+
+import (
+	"project-root/pkg/api"
+	"project-root/pkg/repositories"
+)
+
+// Attachments is the in-memory AttachmentStore
+type Attachments struct{ d *data }
+
+func (s *Attachments) Create(a *api.Attachment) error {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	if a.CreatedAt.IsZero() {
+		a.CreatedAt = s.d.clock.Now()
+	}
+	a.ID = len(s.d.attachments) + 1
+	a.PostID, a.CommentID, a.ChatHash, a.MessageID = 0, 0, "", 0
+	repositories.SetAttachmentURLs(a)
+	stored := *a
+	s.d.attachments = append(s.d.attachments, &stored)
+	return nil
+}
+
+func (s *Attachments) GetAttachment(id int) (*api.Attachment, error) {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	for _, a := range s.d.attachments {
+		if a.ID == id {
+			attachment := *a
+			return &attachment, nil
+		}
+	}
+	return nil, repositories.ErrAttachmentNotFound
+}
+
+// linkAttachments links unlinked uploads of userID to target and returns
+// them, or links nothing when one of them is not such an upload. Callers must
+// hold d.mu.
+func (d *data) linkAttachments(userID int, ids []int, target repositories.ContentTarget) ([]api.Attachment, error) {
+	var linked []*api.Attachment
+	seen := make(map[int]bool)
+	for _, id := range ids {
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		var found *api.Attachment
+		for _, a := range d.attachments {
+			if a.ID == id && a.UserID == userID && a.PostID == 0 && a.CommentID == 0 && a.ChatHash == "" {
+				found = a
+				break
+			}
+		}
+		if found == nil {
+			return nil, repositories.ErrAttachmentNotFound
+		}
+		linked = append(linked, found)
+	}
+
+	var attachments []api.Attachment
+	for _, a := range linked {
+		a.PostID, a.CommentID, a.ChatHash, a.MessageID = target.PostID, target.CommentID, target.ChatHash, target.MessageID
+		attachments = append(attachments, *a)
+	}
+	return attachments, nil
+}
+
+// contentAttachments returns the attachments linked to target. Callers must hold d.mu.
+func (d *data) contentAttachments(target repositories.ContentTarget) []api.Attachment {
+	var attachments []api.Attachment
+	for _, a := range d.attachments {
+		if a.PostID == target.PostID && a.CommentID == target.CommentID && a.ChatHash == target.ChatHash && a.MessageID == target.MessageID {
+			attachments = append(attachments, *a)
+		}
+	}
+	return attachments
+}
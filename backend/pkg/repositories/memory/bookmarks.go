@@ -0,0 +1,243 @@
+package memory
+
+import (
+	"sort"
+
+	"project-root/pkg/api"
+	"project-root/pkg/repositories"
+)
+
+// collection is a bookmark collection with its owner
+type collection struct {
+	api.BookmarkCollection
+	userID int
+}
+
+// bookmark is a saved post or comment. Position orders the bookmarks of a
+// collection and may have gaps, like in the SQL stores.
+type bookmark struct {
+	api.Bookmark
+	collectionID int
+	userID       int
+}
+
+// Bookmarks is the in-memory BookmarkStore
+type Bookmarks struct{ d *data }
+
+func (s *Bookmarks) GetCollections(userID int) ([]api.BookmarkCollection, error) {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	collections := []api.BookmarkCollection{}
+	for _, c := range s.d.collections {
+		if c.userID == userID {
+			collection := c.BookmarkCollection
+			collection.ItemsCount = len(s.d.collectionBookmarks(c.ID))
+			collections = append(collections, collection)
+		}
+	}
+	return collections, nil
+}
+
+func (s *Bookmarks) CreateCollection(userID int, name string) (*api.BookmarkCollection, error) {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	for _, c := range s.d.collections {
+		if c.userID == userID && c.Name == name {
+			return nil, repositories.ErrCollectionExists
+		}
+	}
+	id := 1
+	if n := len(s.d.collections); n > 0 {
+		id = s.d.collections[n-1].ID + 1
+	}
+	c := &collection{
+		BookmarkCollection: api.BookmarkCollection{ID: id, Name: name, CreatedAt: s.d.clock.Now()},
+		userID:             userID,
+	}
+	s.d.collections = append(s.d.collections, c)
+	collection := c.BookmarkCollection
+	return &collection, nil
+}
+
+func (s *Bookmarks) DeleteCollection(userID, collectionID int) error {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	i := s.d.collectionIndex(userID, collectionID)
+	if i < 0 {
+		return repositories.ErrCollectionNotFound
+	}
+	s.d.collections = append(s.d.collections[:i], s.d.collections[i+1:]...)
+
+	kept := s.d.bookmarks[:0]
+	for _, b := range s.d.bookmarks {
+		if b.collectionID != collectionID {
+			kept = append(kept, b)
+		}
+	}
+	s.d.bookmarks = kept
+	return nil
+}
+
+func (s *Bookmarks) GetBookmarks(userID, collectionID, page_, pageSize int) ([]api.Bookmark, int, int, error) {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	if s.d.collectionIndex(userID, collectionID) < 0 {
+		return nil, 0, 0, repositories.ErrCollectionNotFound
+	}
+
+	var all []api.Bookmark
+	for i, b := range s.d.collectionBookmarks(collectionID) {
+		item := b.Bookmark
+		item.Position = i + 1
+		if p := s.d.postByID(b.PostID); p != nil {
+			item.Nickname, item.Title, item.Content, item.ContentHTML = s.d.nickname(p.UserID), p.Title, p.Content, p.ContentHTML
+		}
+		if c := s.d.commentByID(b.CommentID); c != nil {
+			item.Nickname, item.Content, item.ContentHTML = s.d.nickname(c.UserID), c.Content, c.ContentHTML
+		}
+		all = append(all, item)
+	}
+
+	bookmarks, totalPages := page(all, page_, pageSize)
+	if bookmarks == nil {
+		bookmarks = []api.Bookmark{}
+	}
+	return bookmarks, len(all), totalPages, nil
+}
+
+func (s *Bookmarks) AddBookmark(userID, collectionID int, req api.BookmarkRequest) (int, error) {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	if s.d.collectionIndex(userID, collectionID) < 0 {
+		return 0, repositories.ErrCollectionNotFound
+	}
+	if req.CommentID != 0 {
+		if c := s.d.commentByID(req.CommentID); c == nil || c.PostID != req.PostID {
+			return 0, repositories.ErrBookmarkTargetNotFound
+		}
+	} else if s.d.postByID(req.PostID) == nil {
+		return 0, repositories.ErrBookmarkTargetNotFound
+	}
+
+	position := 1
+	for _, b := range s.d.collectionBookmarks(collectionID) {
+		if b.PostID == req.PostID && b.CommentID == req.CommentID {
+			return 0, repositories.ErrBookmarkExists
+		}
+		position = b.Position + 1
+	}
+
+	id := 1
+	if n := len(s.d.bookmarks); n > 0 {
+		id = s.d.bookmarks[n-1].ID + 1
+	}
+	s.d.bookmarks = append(s.d.bookmarks, &bookmark{
+		Bookmark: api.Bookmark{
+			ID:        id,
+			PostID:    req.PostID,
+			CommentID: req.CommentID,
+			Position:  position,
+			CreatedAt: s.d.clock.Now(),
+		},
+		collectionID: collectionID,
+		userID:       userID,
+	})
+	return id, nil
+}
+
+func (s *Bookmarks) MoveBookmark(userID, collectionID, bookmarkID, position int) error {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	if s.d.collectionIndex(userID, collectionID) < 0 {
+		return repositories.ErrCollectionNotFound
+	}
+
+	var moved *bookmark
+	var others []*bookmark
+	for _, b := range s.d.collectionBookmarks(collectionID) {
+		if b.ID == bookmarkID {
+			moved = b
+		} else {
+			others = append(others, b)
+		}
+	}
+	if moved == nil {
+		return repositories.ErrBookmarkNotFound
+	}
+
+	to := min(max(position, 1), len(others)+1) - 1
+	ordered := append(others[:to:to], append([]*bookmark{moved}, others[to:]...)...)
+	for i, b := range ordered {
+		b.Position = i + 1
+	}
+	return nil
+}
+
+func (s *Bookmarks) RemoveBookmark(userID, collectionID, bookmarkID int) error {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	for i, b := range s.d.bookmarks {
+		if b.ID == bookmarkID && b.collectionID == collectionID && b.userID == userID {
+			s.d.bookmarks = append(s.d.bookmarks[:i], s.d.bookmarks[i+1:]...)
+			return nil
+		}
+	}
+	return repositories.ErrBookmarkNotFound
+}
+
+// collectionIndex returns the position of a collection of the user in
+// d.collections or -1. Callers must hold d.mu.
+func (d *data) collectionIndex(userID, collectionID int) int {
+	for i, c := range d.collections {
+		if c.ID == collectionID && c.userID == userID {
+			return i
+		}
+	}
+	return -1
+}
+
+// collectionBookmarks returns the bookmarks of a collection in their saved
+// order. Callers must hold d.mu.
+func (d *data) collectionBookmarks(collectionID int) []*bookmark {
+	var bookmarks []*bookmark
+	for _, b := range d.bookmarks {
+		if b.collectionID == collectionID {
+			bookmarks = append(bookmarks, b)
+		}
+	}
+	sort.SliceStable(bookmarks, func(i, j int) bool {
+		return bookmarks[i].Position < bookmarks[j].Position
+	})
+	return bookmarks
+}
+
+func (s *Bookmarks) BookmarkedPosts(userID int, postIDs []int) (map[int]bool, error) {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	bookmarked := make(map[int]bool)
+	for _, postID := range postIDs {
+		if s.d.isBookmarked(userID, postID) {
+			bookmarked[postID] = true
+		}
+	}
+	return bookmarked, nil
+}
+
+// isBookmarked reports whether the user saved the post itself in any of
+// their collections. Callers must hold d.mu.
+func (d *data) isBookmarked(userID, postID int) bool {
+	for _, b := range d.bookmarks {
+		if b.userID == userID && b.PostID == postID && b.CommentID == 0 {
+			return true
+		}
+	}
+	return false
+}
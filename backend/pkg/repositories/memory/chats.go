@@ -0,0 +1,198 @@
+package memory
+
+import (
+	"sort"
+	"time"
+
+	"project-root/pkg/api"
+	"project-root/pkg/repositories"
+)
+
+// Chats is the in-memory ChatStore
+type Chats struct{ d *data }
+
+func (s *Chats) CreateChat(user1ID, user2ID int) (string, error) {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	for _, c := range s.d.chats {
+		if (c.User1ID == user1ID && c.User2ID == user2ID) || (c.User1ID == user2ID && c.User2ID == user1ID) {
+			return c.ChatHash, nil
+		}
+	}
+
+	chatHash := repositories.GenerateChatHash(user1ID, user2ID)
+	s.d.chats = append(s.d.chats, api.ChatInfo{ChatHash: chatHash, User1ID: user1ID, User2ID: user2ID})
+	return chatHash, s.d.record(api.ChatCreatedEvent{ChatHash: chatHash, UserIDs: []int{user1ID, user2ID}}, s.d.clock.Now())
+}
+
+func (s *Chats) GetChatsForUser(userID int) ([]api.ChatInfo, error) {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	var chats []api.ChatInfo
+	for _, c := range s.d.chats {
+		if c.User1ID == userID || c.User2ID == userID {
+			chats = append(chats, c)
+		}
+	}
+	return chats, nil
+}
+
+func (s *Chats) CheckChatAccess(userID int, chatHash string) (bool, error) {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	if _, ok := s.d.chat(userID, chatHash); !ok {
+		return false, repositories.ErrChatNotFound
+	}
+	return true, nil
+}
+
+func (s *Chats) GetChatDetails(userID int, chatHash string) (*api.Chat, error) {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	info, ok := s.d.chat(userID, chatHash)
+	if !ok {
+		return nil, repositories.ErrChatNotFound
+	}
+	return &api.Chat{ChatInfo: info, Message: s.d.chatMessages(chatHash)}, nil
+}
+
+func (s *Chats) GetMessagesForChat(chatHash string) ([]api.MessageMessage, error) {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	return s.d.chatMessages(chatHash), nil
+}
+
+func (s *Chats) SaveMessage(msg *api.MessageMessage) error {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	// Messages are numbered from 1 in each chat, like SQLite rowids
+	target := repositories.ContentTarget{ChatHash: msg.RoomHash, MessageID: len(s.d.messages[msg.RoomHash]) + 1}
+	attachments, err := s.d.linkAttachments(msg.Sender.ID, msg.AttachmentIDs, target)
+	if err != nil {
+		return err
+	}
+	msg.ID = target.MessageID
+	msg.Mentions = s.d.mentions(msg.Message)
+	msg.Attachments = attachments
+	now := s.d.clock.Now()
+	s.d.messages[msg.RoomHash] = append(s.d.messages[msg.RoomHash], message{
+		senderID: msg.Sender.ID,
+		content:  msg.Message,
+		sentAt:   now,
+		mentions: msg.Mentions,
+	})
+	event := *msg
+	event.AttachmentIDs = nil
+	return s.d.record(api.MessageSentEvent{Message: event}, now)
+}
+
+// chat returns the chat if the user takes part in it. Callers must hold d.mu.
+func (d *data) chat(userID int, chatHash string) (api.ChatInfo, bool) {
+	for _, c := range d.chats {
+		if c.ChatHash == chatHash && (c.User1ID == userID || c.User2ID == userID) {
+			return c, true
+		}
+	}
+	return api.ChatInfo{}, false
+}
+
+// chatMessages returns the messages of a chat ordered by send time. Callers must hold d.mu.
+func (d *data) chatMessages(chatHash string) []api.MessageMessage {
+	var messages []api.MessageMessage
+	for i, m := range d.messages[chatHash] {
+		messages = append(messages, api.MessageMessage{
+			ID:          i + 1,
+			RoomHash:    chatHash,
+			Sender:      &api.UserResponse{ID: m.senderID},
+			Message:     m.content,
+			SendAt:      m.sentAt,
+			Mentions:    d.currentMentions(m.mentions),
+			Attachments: d.contentAttachments(repositories.ContentTarget{ChatHash: chatHash, MessageID: i + 1}),
+		})
+	}
+	sort.SliceStable(messages, func(i, j int) bool { return messages[i].SendAt.Before(messages[j].SendAt) })
+	return messages
+}
+
+// Tokens is the in-memory TokenStore
+type Tokens struct{ d *data }
+
+func (s *Tokens) Create(userID int, name, tokenHash string, scopes []string, expiresAt *time.Time) (*api.APIToken, error) {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	// IDs are never reused, even after a token is deleted
+	id := 1
+	if n := len(s.d.tokens); n > 0 {
+		id = s.d.tokens[n-1].ID + 1
+	}
+	t := &token{
+		APIToken: api.APIToken{
+			ID:        id,
+			Name:      name,
+			Scopes:    scopes,
+			CreatedAt: s.d.clock.Now(),
+			ExpiresAt: expiresAt,
+		},
+		userID:    userID,
+		tokenHash: tokenHash,
+	}
+	s.d.tokens = append(s.d.tokens, t)
+	result := t.APIToken
+	return &result, nil
+}
+
+func (s *Tokens) GetTokensForUser(userID int) ([]api.APIToken, error) {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	tokens := []api.APIToken{}
+	for _, t := range s.d.tokens {
+		if t.userID == userID {
+			tokens = append(tokens, t.APIToken)
+		}
+	}
+	sort.SliceStable(tokens, func(i, j int) bool { return tokens[i].CreatedAt.After(tokens[j].CreatedAt) })
+	return tokens, nil
+}
+
+func (s *Tokens) Delete(userID, tokenID int) error {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	for i, t := range s.d.tokens {
+		if t.ID == tokenID && t.userID == userID {
+			s.d.tokens = append(s.d.tokens[:i], s.d.tokens[i+1:]...)
+			return nil
+		}
+	}
+	return repositories.ErrTokenNotFound
+}
+
+func (s *Tokens) GetUserByTokenHash(tokenHash string) (*api.User, []string, error) {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	now := s.d.clock.Now()
+	for _, t := range s.d.tokens {
+		if t.tokenHash != tokenHash {
+			continue
+		}
+		if t.ExpiresAt != nil && now.After(*t.ExpiresAt) {
+			return nil, nil, nil
+		}
+		u := s.d.userByID(t.userID)
+		if u == nil {
+			return nil, nil, nil
+		}
+		t.LastUsedAt = &now
+		return &api.User{ID: u.ID, Nickname: u.Nickname}, t.Scopes, nil
+	}
+	return nil, nil, nil
+}
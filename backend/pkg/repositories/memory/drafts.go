@@ -0,0 +1,175 @@
+package memory
+
+import (
+	"slices"
+	"strings"
+	"time"
+
+	"project-root/pkg/api"
+	"project-root/pkg/repositories"
+)
+
+// Drafts is the in-memory DraftStore
+type Drafts struct{ d *data }
+
+func (s *Drafts) CreateDraft(userID int, req api.DraftRequest, now time.Time) (*api.Draft, error) {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	s.d.draftID++
+	draft := &api.Draft{ID: s.d.draftID, UserID: userID, CreatedAt: now}
+	setDraft(draft, req, now)
+	s.d.drafts = append(s.d.drafts, draft)
+	return copyDraft(draft), nil
+}
+
+func (s *Drafts) UpdateDraft(userID, draftID int, req api.DraftRequest, now time.Time) (*api.Draft, error) {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	i := s.d.draftIndex(userID, draftID)
+	if i < 0 {
+		return nil, repositories.ErrDraftNotFound
+	}
+	setDraft(s.d.drafts[i], req, now)
+	return copyDraft(s.d.drafts[i]), nil
+}
+
+func (s *Drafts) GetDrafts(userID int) ([]api.Draft, error) {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	drafts := []api.Draft{}
+	for _, draft := range s.d.drafts {
+		if draft.UserID == userID {
+			drafts = append(drafts, *copyDraft(draft))
+		}
+	}
+	slices.SortStableFunc(drafts, func(a, b api.Draft) int {
+		if c := b.UpdatedAt.Compare(a.UpdatedAt); c != 0 {
+			return c
+		}
+		return b.ID - a.ID
+	})
+	return drafts, nil
+}
+
+func (s *Drafts) GetDraft(userID, draftID int) (*api.Draft, error) {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	i := s.d.draftIndex(userID, draftID)
+	if i < 0 {
+		return nil, repositories.ErrDraftNotFound
+	}
+	return copyDraft(s.d.drafts[i]), nil
+}
+
+func (s *Drafts) DeleteDraft(userID, draftID int) error {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	i := s.d.draftIndex(userID, draftID)
+	if i < 0 {
+		return repositories.ErrDraftNotFound
+	}
+	s.d.drafts = slices.Delete(s.d.drafts, i, i+1)
+	return nil
+}
+
+func (s *Drafts) GetDueDrafts(now time.Time) ([]api.Draft, error) {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	drafts := []api.Draft{}
+	for _, draft := range s.d.drafts {
+		if draft.PublishAt != nil && !draft.PublishAt.After(now) {
+			drafts = append(drafts, *copyDraft(draft))
+		}
+	}
+	slices.SortStableFunc(drafts, func(a, b api.Draft) int {
+		return a.PublishAt.Compare(*b.PublishAt)
+	})
+	return drafts, nil
+}
+
+func (s *Drafts) UnscheduleDraft(userID, draftID int) error {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	if i := s.d.draftIndex(userID, draftID); i >= 0 {
+		s.d.drafts[i].PublishAt = nil
+	}
+	return nil
+}
+
+// PublishDraft takes the draft out before creating its post, so concurrent
+// calls publish it once, and puts it back when the post cannot be created
+func (s *Drafts) PublishDraft(userID, draftID int, now time.Time) (*api.PostCreateRequest, error) {
+	s.d.mu.Lock()
+	i := s.d.draftIndex(userID, draftID)
+	if i < 0 {
+		s.d.mu.Unlock()
+		return nil, repositories.ErrDraftNotFound
+	}
+	draft := s.d.drafts[i]
+	s.d.drafts = slices.Delete(s.d.drafts, i, i+1)
+	s.d.mu.Unlock()
+
+	post := draft.PostCreateRequest()
+	post.CreatedAt = now
+	if draft.PublishAt != nil && !draft.PublishAt.After(now) {
+		post.CreatedAt = *draft.PublishAt
+	}
+	var categories []string
+	for _, name := range strings.Split(draft.Categories, "#") {
+		if name = strings.TrimSpace(name); name != "" {
+			categories = append(categories, name)
+		}
+	}
+	posts := &Posts{s.d}
+	if err := posts.Create(&post, categories); err != nil {
+		s.d.mu.Lock()
+		s.d.drafts = append(s.d.drafts, draft)
+		s.d.mu.Unlock()
+		return nil, err
+	}
+	return &post, nil
+}
+
+// draftIndex returns the position of a draft of the user or -1. Callers must hold d.mu.
+func (d *data) draftIndex(userID, draftID int) int {
+	return slices.IndexFunc(d.drafts, func(draft *api.Draft) bool {
+		return draft.ID == draftID && draft.UserID == userID
+	})
+}
+
+// setDraft replaces the content of a draft with req
+func setDraft(draft *api.Draft, req api.DraftRequest, now time.Time) {
+	draft.Title = req.Title
+	draft.Content = req.Content
+	draft.Categories = req.Categories
+	draft.AttachmentIDs = slices.Clone(req.AttachmentIDs)
+	draft.Poll = nil
+	if req.Poll != nil {
+		poll := *req.Poll
+		poll.Options = slices.Clone(req.Poll.Options)
+		draft.Poll = &poll
+	}
+	draft.PublishAt = req.PublishAt
+	draft.UpdatedAt = now
+}
+
+// copyDraft returns a copy of a stored draft that callers may change
+func copyDraft(draft *api.Draft) *api.Draft {
+	c := *draft
+	setDraft(&c, api.DraftRequest{
+		Title:         draft.Title,
+		Content:       draft.Content,
+		Categories:    draft.Categories,
+		AttachmentIDs: draft.AttachmentIDs,
+		Poll:          draft.Poll,
+		PublishAt:     draft.PublishAt,
+	}, draft.UpdatedAt)
+	return &c
+}
@@ -0,0 +1,126 @@
+package memory
+
+import (
+	"database/sql"
+
+	"project-root/pkg/api"
+	"project-root/pkg/repositories"
+)
+
+// Follows is the in-memory FollowStore
+type Follows struct{ d *data }
+
+func (s *Follows) FollowUser(followerID, followeeID int) error {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	if indexOf(s.d.userFollows, followerID, followeeID) >= 0 {
+		return nil
+	}
+	follower, followee := s.d.userByID(followerID), s.d.userByID(followeeID)
+	if follower == nil || followee == nil {
+		return sql.ErrNoRows
+	}
+	s.d.userFollows = append(s.d.userFollows, follow{userID: followerID, targetID: followeeID})
+	follower.FollowingCount++
+	followee.FollowersCount++
+	return nil
+}
+
+func (s *Follows) UnfollowUser(followerID, followeeID int) error {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	i := indexOf(s.d.userFollows, followerID, followeeID)
+	if i < 0 {
+		return nil
+	}
+	s.d.userFollows = append(s.d.userFollows[:i], s.d.userFollows[i+1:]...)
+	if u := s.d.userByID(followerID); u != nil {
+		u.FollowingCount--
+	}
+	if u := s.d.userByID(followeeID); u != nil {
+		u.FollowersCount--
+	}
+	return nil
+}
+
+func (s *Follows) FollowCategory(userID int, category string) error {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	categoryID := s.d.categoryID(category)
+	if categoryID == 0 {
+		return repositories.ErrCategoryNotFound
+	}
+	if indexOf(s.d.categoryFollows, userID, categoryID) < 0 {
+		s.d.categoryFollows = append(s.d.categoryFollows, follow{userID: userID, targetID: categoryID})
+	}
+	return nil
+}
+
+func (s *Follows) UnfollowCategory(userID int, category string) error {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	categoryID := s.d.categoryID(category)
+	if categoryID == 0 {
+		return repositories.ErrCategoryNotFound
+	}
+	if i := indexOf(s.d.categoryFollows, userID, categoryID); i >= 0 {
+		s.d.categoryFollows = append(s.d.categoryFollows[:i], s.d.categoryFollows[i+1:]...)
+	}
+	return nil
+}
+
+func (s *Follows) GetFollowing(userID int) (*api.FollowingResponse, error) {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	following := api.FollowingResponse{Users: []api.UserResponse{}, Categories: []api.Category{}}
+	for _, f := range s.d.userFollows {
+		if f.userID == userID {
+			following.Users = append(following.Users, api.UserResponse{ID: f.targetID, Nickname: s.d.nickname(f.targetID)})
+		}
+	}
+	for _, f := range s.d.categoryFollows {
+		if f.userID == userID {
+			following.Categories = append(following.Categories, s.d.categories[f.targetID-1])
+		}
+	}
+	return &following, nil
+}
+
+// indexOf returns the position of a follow in follows or -1
+func indexOf(follows []follow, userID, targetID int) int {
+	for i, f := range follows {
+		if f.userID == userID && f.targetID == targetID {
+			return i
+		}
+	}
+	return -1
+}
+
+// categoryID returns the ID of a category by name or 0. Callers must hold d.mu.
+func (d *data) categoryID(name string) int {
+	for _, c := range d.categories {
+		if c.Name == name {
+			return c.ID
+		}
+	}
+	return 0
+}
+
+// inFeed reports whether a post was written by a user or filed under a
+// category that userID follows. Callers must hold d.mu.
+func (d *data) inFeed(userID int, p *api.Post) bool {
+	if indexOf(d.userFollows, userID, p.UserID) >= 0 {
+		return true
+	}
+	for _, categoryID := range d.postCategories[p.ID] {
+		if indexOf(d.categoryFollows, userID, categoryID) >= 0 {
+			return true
+		}
+	}
+	return false
+}
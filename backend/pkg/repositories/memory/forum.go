@@ -0,0 +1,623 @@
+package memory
+
+import (
+	"database/sql"
+	"errors"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"project-root/pkg/api"
+	"project-root/pkg/markdown"
+	"project-root/pkg/ranking"
+	"project-root/pkg/repositories"
+)
+
+// Users is the in-memory UserStore
+type Users struct{ d *data }
+
+func (s *Users) GetAllUsers(page_, pageSize int, sortExpr string, excludeID int) ([]api.Users, int, int, error) {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	all := []*user{}
+	for _, u := range s.d.users {
+		if excludeID == 0 || u.ID != excludeID {
+			all = append(all, u)
+		}
+	}
+	if sortExpr == "" {
+		sortExpr = "LOWER(users.nickname) ASC"
+	}
+	sortBy(all, sortExpr, func(a, b *user, field string) bool {
+		if field == "created_at" {
+			return a.CreatedAt.Before(b.CreatedAt)
+		}
+		return strings.ToLower(a.Nickname) < strings.ToLower(b.Nickname)
+	})
+
+	items, totalPages := page(all, page_, pageSize)
+	users := []api.Users{}
+	for _, u := range items {
+		users = append(users, api.Users{ID: u.ID, Nickname: u.Nickname})
+	}
+	return users, len(all), totalPages, nil
+}
+
+func (s *Users) CreateUser(r *api.RegistrationRequest) (*api.UserResponse, error) {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	for _, u := range s.d.users {
+		if u.Nickname == r.Nickname || u.email == r.Email {
+			return nil, errors.New("UNIQUE constraint failed")
+		}
+	}
+
+	u := &user{
+		User: api.User{
+			ID:        len(s.d.users) + 1,
+			Nickname:  r.Nickname,
+			FirstName: r.FirstName,
+			LastName:  r.LastName,
+			CreatedAt: r.CreatedAt,
+		},
+		email:        r.Email,
+		passwordHash: r.Password,
+	}
+	s.d.users = append(s.d.users, u)
+	newUser := api.UserResponse{ID: u.ID, Nickname: u.Nickname}
+	if err := s.d.record(api.UserRegisteredEvent{User: newUser, CreatedAt: r.CreatedAt}, r.CreatedAt); err != nil {
+		return nil, err
+	}
+	return &newUser, nil
+}
+
+func (s *Users) ChekUserByEmail(email string) (*api.LoginRequest, *api.UserResponse, error) {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	for _, u := range s.d.users {
+		if u.email == email {
+			return &api.LoginRequest{Email: u.email, Password: u.passwordHash}, &api.UserResponse{ID: u.ID, Nickname: u.Nickname}, nil
+		}
+	}
+	return nil, nil, sql.ErrNoRows
+}
+
+func (s *Users) GetUserByNickname(nickname string) (*api.User, error) {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	for _, u := range s.d.users {
+		if u.Nickname == nickname {
+			result := u.User
+			return &result, nil
+		}
+	}
+	return nil, sql.ErrNoRows
+}
+
+func (s *Users) GetUserByID(userID int) (api.UserResponse, error) {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	if u := s.d.userByID(userID); u != nil {
+		return api.UserResponse{ID: u.ID, Nickname: u.Nickname}, nil
+	}
+	return api.UserResponse{}, sql.ErrNoRows
+}
+
+func (s *Users) AutocompleteUsers(prefix string, limit int) ([]api.UserResponse, error) {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	users := []api.UserResponse{}
+	for _, u := range s.d.users {
+		if len(u.Nickname) >= len(prefix) && strings.EqualFold(u.Nickname[:len(prefix)], prefix) {
+			users = append(users, api.UserResponse{ID: u.ID, Nickname: u.Nickname})
+		}
+	}
+	sort.Slice(users, func(i, j int) bool {
+		if len(users[i].Nickname) != len(users[j].Nickname) {
+			return len(users[i].Nickname) < len(users[j].Nickname)
+		}
+		return users[i].Nickname < users[j].Nickname
+	})
+	return users[:min(limit, len(users))], nil
+}
+
+// Sessions is the in-memory SessionStore
+type Sessions struct{ d *data }
+
+func (s *Sessions) CreateSession(session *api.Session) error {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	s.d.sessions[session.SessionID] = *session
+	return nil
+}
+
+func (s *Sessions) GetUserBySessionID(sessionID string) (*api.User, error) {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	session, ok := s.d.sessions[sessionID]
+	if !ok {
+		return nil, nil
+	}
+	u := s.d.userByID(session.UserID)
+	if u == nil {
+		return nil, nil
+	}
+	return &api.User{ID: u.ID, Nickname: u.Nickname}, nil
+}
+
+func (s *Sessions) UpdateLastActivity(sessionID string) error {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	if session, ok := s.d.sessions[sessionID]; ok {
+		session.LastActivity = s.d.clock.Now()
+		s.d.sessions[sessionID] = session
+	}
+	return nil
+}
+
+func (s *Sessions) DeleteSession(sessionID string) error {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	delete(s.d.sessions, sessionID)
+	return nil
+}
+
+// Posts is the in-memory PostStore
+type Posts struct{ d *data }
+
+func (s *Posts) GetPosts(page_, pageSize int, sortExpr, filterType, filterValue string) ([]api.Post, int, int, error) {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	var all []api.Post
+	for _, p := range s.d.posts {
+		post := s.d.post(p)
+		if filterValue != "" {
+			if filterType == "nickname" && post.Nickname != filterValue {
+				continue
+			}
+			if filterType == "user_id" && filterValue != strconv.Itoa(post.UserID) {
+				continue
+			}
+			if filterType == "category" && !slices.ContainsFunc(post.Categories, func(c api.Category) bool { return c.Name == filterValue }) {
+				continue
+			}
+		}
+		all = append(all, post)
+	}
+	s.d.sortPosts(all, sortExpr)
+
+	posts, totalPages := page(all, page_, pageSize)
+	return posts, len(all), totalPages, nil
+}
+
+func (s *Posts) GetFeed(userID, page_, pageSize int, sortExpr string, after int) ([]api.Post, int, int, error) {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	var all []api.Post
+	for _, p := range s.d.posts {
+		if s.d.inFeed(userID, p) {
+			all = append(all, s.d.post(p))
+		}
+	}
+	s.d.sortPosts(all, sortExpr)
+
+	posts, totalPages := page(all, page_, pageSize)
+	if after != 0 {
+		// The page starts after the post with ID after and is empty once that post is gone
+		posts = nil
+		if i := slices.IndexFunc(all, func(p api.Post) bool { return p.ID == after }); i >= 0 {
+			posts, _ = page(all[i+1:], 1, pageSize)
+		}
+	}
+	return posts, len(all), totalPages, nil
+}
+
+// sortPosts orders posts by an ORDER BY expression, newest first by default,
+// breaking ties by ID in the same direction as repositories.PostOrder does.
+// Callers must hold d.mu.
+func (d *data) sortPosts(posts []api.Post, sortExpr string) {
+	if sortExpr == "" {
+		sortExpr = "posts.created_at DESC"
+	}
+	less := func(a, b api.Post, field string) bool {
+		if less, ok := lessScores(d.postScores[a.ID], d.postScores[b.ID], field); ok {
+			return less
+		}
+		return lessPost(a, b, field)
+	}
+	sortBy(posts, sortExpr, func(a, b api.Post, field string) bool {
+		if less(a, b, field) || less(b, a, field) {
+			return less(a, b, field)
+		}
+		return a.ID < b.ID
+	})
+}
+
+func (s *Posts) GetPostByID(postID int, userIdAuth int) (*api.Post, error) {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	for _, p := range s.d.posts {
+		if p.ID == postID {
+			post := s.d.post(p)
+			if userIdAuth != 0 {
+				post.Rate.Status = s.d.rates[rateKey{userID: userIdAuth, postID: postID}].status
+				post.Bookmarked = s.d.isBookmarked(userIdAuth, postID)
+			}
+			return &post, nil
+		}
+	}
+	return nil, sql.ErrNoRows
+}
+
+func (s *Posts) GetCategoriesByPostID(postID int) ([]api.Category, error) {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	return s.d.postCategoryList(postID), nil
+}
+
+func (s *Posts) Create(r *api.PostCreateRequest, categories []string) error {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	if r.CreatedAt.IsZero() {
+		r.CreatedAt = s.d.clock.Now()
+	}
+	attachments, err := s.d.linkAttachments(r.UserID, r.AttachmentIDs, repositories.ContentTarget{PostID: len(s.d.posts) + 1})
+	if err != nil {
+		return err
+	}
+	r.ID = len(s.d.posts) + 1
+	r.Mentions = s.d.mentions(r.Content)
+	r.Attachments = attachments
+	if r.Poll != nil {
+		p := &poll{PollCreateRequest: *r.Poll}
+		for range r.Poll.Options {
+			s.d.pollOptions++
+			p.optionIDs = append(p.optionIDs, s.d.pollOptions)
+		}
+		s.d.polls[r.ID] = p
+	}
+	s.d.posts = append(s.d.posts, &api.Post{
+		ID:          r.ID,
+		UserID:      r.UserID,
+		Title:       r.Title,
+		Content:     r.Content,
+		ContentHTML: markdown.Render(r.Content),
+		CreatedAt:   r.CreatedAt,
+		Mentions:    r.Mentions,
+	})
+	s.d.postScores[r.ID] = &ranking.Scores{Hot: ranking.Hot(0, 0, r.CreatedAt)}
+	if err := s.d.linkCategories(r.ID, categories); err != nil {
+		return err
+	}
+	return s.d.record(api.PostCreatedEvent{
+		PostID:     r.ID,
+		Author:     api.UserResponse{ID: r.UserID, Nickname: s.d.nickname(r.UserID)},
+		Title:      r.Title,
+		Content:    r.Content,
+		Categories: categories,
+		Mentions:   r.Mentions,
+		CreatedAt:  r.CreatedAt,
+	}, r.CreatedAt)
+}
+
+// linkCategories links categories to a post, creating the missing ones.
+// Callers must hold d.mu.
+func (d *data) linkCategories(postID int, categories []string) error {
+	for _, name := range categories {
+		categoryID := 0
+		for _, c := range d.categories {
+			if c.Name == name {
+				categoryID = c.ID
+				break
+			}
+		}
+		if categoryID == 0 {
+			categoryID = len(d.categories) + 1
+			d.categories = append(d.categories, api.Category{ID: categoryID, Name: name})
+		}
+		for _, id := range d.postCategories[postID] {
+			if id == categoryID {
+				return errors.New("UNIQUE constraint failed: post_categories")
+			}
+		}
+		d.postCategories[postID] = append(d.postCategories[postID], categoryID)
+	}
+	return nil
+}
+
+// post returns a copy of a stored post with its nickname and categories filled in.
+// Callers must hold d.mu.
+func (d *data) post(p *api.Post) api.Post {
+	post := *p
+	post.Nickname = d.nickname(p.UserID)
+	post.Categories = d.postCategoryList(p.ID)
+	post.Mentions = d.currentMentions(p.Mentions)
+	post.Attachments = d.contentAttachments(repositories.ContentTarget{PostID: p.ID})
+	return post
+}
+
+// postByID returns the stored post with the given ID or nil. Callers must hold d.mu.
+func (d *data) postByID(id int) *api.Post {
+	for _, p := range d.posts {
+		if p.ID == id {
+			return p
+		}
+	}
+	return nil
+}
+
+// commentByID returns the stored comment with the given ID or nil. Callers must hold d.mu.
+func (d *data) commentByID(id int) *api.Comment {
+	for _, c := range d.comments {
+		if c.ID == id {
+			return c
+		}
+	}
+	return nil
+}
+
+// postCategoryList returns the categories of a post. Callers must hold d.mu.
+func (d *data) postCategoryList(postID int) []api.Category {
+	var categories []api.Category
+	for _, id := range d.postCategories[postID] {
+		categories = append(categories, d.categories[id-1])
+	}
+	return categories
+}
+
+func lessPost(a, b api.Post, field string) bool {
+	switch field {
+	case "rate":
+		return a.Rate.Rate < b.Rate.Rate
+	case "nickname":
+		return strings.ToLower(a.Nickname) < strings.ToLower(b.Nickname)
+	default:
+		return a.CreatedAt.Before(b.CreatedAt)
+	}
+}
+
+// Comments is the in-memory CommentStore
+type Comments struct{ d *data }
+
+func (s *Comments) Create(r *api.CommentCreateRequest) error {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	if r.CreatedAt.IsZero() {
+		r.CreatedAt = s.d.clock.Now()
+	}
+	attachments, err := s.d.linkAttachments(r.UserID, r.AttachmentIDs, repositories.ContentTarget{CommentID: len(s.d.comments) + 1})
+	if err != nil {
+		return err
+	}
+	r.ID = len(s.d.comments) + 1
+	r.ContentHTML = markdown.Render(r.Content)
+	r.Mentions = s.d.mentions(r.Content)
+	r.Attachments = attachments
+	s.d.comments = append(s.d.comments, &api.Comment{
+		ID:          r.ID,
+		PostID:      r.PostID,
+		UserID:      r.UserID,
+		Content:     r.Content,
+		ContentHTML: r.ContentHTML,
+		CreatedAt:   r.CreatedAt,
+		Mentions:    r.Mentions,
+	})
+	s.d.commentScores[r.ID] = &ranking.Scores{Hot: ranking.Hot(0, 0, r.CreatedAt)}
+	return s.d.record(api.CommentCreatedEvent{
+		CommentID:   r.ID,
+		PostID:      r.PostID,
+		Author:      api.UserResponse{ID: r.UserID, Nickname: s.d.nickname(r.UserID)},
+		Content:     r.Content,
+		ContentHTML: r.ContentHTML,
+		Mentions:    r.Mentions,
+		Attachments: r.Attachments,
+		CreatedAt:   r.CreatedAt,
+	}, r.CreatedAt)
+}
+
+func (s *Comments) GetComments(page_, pageSize int, sortExpr, filterType string, filterValue interface{}, userIdAuth int) (*[]api.Comment, int, int, error) {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	var all []api.Comment
+	for _, c := range s.d.comments {
+		comment := *c
+		comment.Nickname = s.d.nickname(c.UserID)
+		comment.Mentions = s.d.currentMentions(c.Mentions)
+		comment.Attachments = s.d.contentAttachments(repositories.ContentTarget{CommentID: c.ID})
+		switch filterType {
+		case "userID":
+			if filterValue != comment.UserID {
+				continue
+			}
+		case "nickname":
+			if filterValue != comment.Nickname {
+				continue
+			}
+		default:
+			if filterValue != comment.PostID {
+				continue
+			}
+		}
+		if userIdAuth != 0 {
+			comment.Rate.Status = s.d.rates[rateKey{userID: userIdAuth, commentID: c.ID}].status
+		}
+		all = append(all, comment)
+	}
+	if sortExpr == "" {
+		sortExpr = "comments.created_at DESC"
+	}
+	sortBy(all, sortExpr, func(a, b api.Comment, field string) bool {
+		if less, ok := lessScores(s.d.commentScores[a.ID], s.d.commentScores[b.ID], field); ok {
+			return less
+		}
+		switch field {
+		case "rate":
+			return a.Rate.Rate < b.Rate.Rate
+		case "nickname":
+			return strings.ToLower(a.Nickname) < strings.ToLower(b.Nickname)
+		default:
+			return a.CreatedAt.Before(b.CreatedAt)
+		}
+	})
+
+	comments, totalPages := page(all, page_, pageSize)
+	return &comments, len(all), totalPages, nil
+}
+
+// Rates is the in-memory RateStore
+type Rates struct{ d *data }
+
+func (s *Rates) UpdateRate(userID int, req api.RateRequest) (api.Rate, error) {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	var target *api.Rate
+	var createdAt time.Time
+	var scores *ranking.Scores
+	if req.CommentID != 0 {
+		for _, c := range s.d.comments {
+			if c.ID == req.CommentID && c.PostID == req.PostID {
+				target, createdAt, scores = &c.Rate, c.CreatedAt, s.d.commentScores[c.ID]
+			}
+		}
+	} else {
+		for _, p := range s.d.posts {
+			if p.ID == req.PostID {
+				target, createdAt, scores = &p.Rate, p.CreatedAt, s.d.postScores[p.ID]
+			}
+		}
+	}
+	if target == nil {
+		return api.Rate{}, repositories.ErrRateTargetNotFound
+	}
+
+	key := rateKey{userID: userID, postID: req.PostID}
+	if req.CommentID != 0 {
+		key = rateKey{userID: userID, commentID: req.CommentID}
+	}
+
+	now := s.d.clock.Now()
+	existing := s.d.rates[key]
+	newStatus, upDelta, downDelta := repositories.VoteChange(existing.status, req.Status)
+	if newStatus == "" {
+		delete(s.d.rates, key)
+	} else {
+		s.d.rates[key] = rate{status: newStatus, ratedAt: now}
+	}
+
+	target.Upvotes += upDelta
+	target.Downvotes += downDelta
+	target.Rate = target.Upvotes - target.Downvotes
+
+	top := scores.Top
+	for i, delta := range ranking.TopDeltas(existing.status, existing.ratedAt, newStatus, now) {
+		top[i] += delta
+	}
+	*scores = ranking.Compute(target.Upvotes, target.Downvotes, top, createdAt, now)
+	result := api.Rate{Rate: target.Rate, Upvotes: target.Upvotes, Downvotes: target.Downvotes, Status: newStatus}
+	err := s.d.record(api.RateChangedEvent{
+		PostID:    req.PostID,
+		CommentID: req.CommentID,
+		User:      api.UserResponse{ID: userID, Nickname: s.d.nickname(userID)},
+		Rate:      result,
+	}, now)
+	return result, err
+}
+
+func (s *Rates) Reconcile() (int, error) {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	postVotes := make(map[int]*api.Rate)
+	commentVotes := make(map[int]*api.Rate)
+	for key, r := range s.d.rates {
+		votes := postVotes
+		id := key.postID
+		if key.commentID != 0 {
+			votes, id = commentVotes, key.commentID
+		}
+		if votes[id] == nil {
+			votes[id] = &api.Rate{}
+		}
+		if r.status == "up" {
+			votes[id].Upvotes++
+		} else {
+			votes[id].Downvotes++
+		}
+	}
+
+	fixed := 0
+	reconcile := func(current *api.Rate, want *api.Rate) {
+		if want == nil {
+			want = &api.Rate{}
+		}
+		if current.Upvotes != want.Upvotes || current.Downvotes != want.Downvotes || current.Rate != want.Upvotes-want.Downvotes {
+			current.Upvotes, current.Downvotes = want.Upvotes, want.Downvotes
+			current.Rate = want.Upvotes - want.Downvotes
+			fixed++
+		}
+	}
+	for _, p := range s.d.posts {
+		reconcile(&p.Rate, postVotes[p.ID])
+	}
+	for _, c := range s.d.comments {
+		reconcile(&c.Rate, commentVotes[c.ID])
+	}
+	return fixed, nil
+}
+
+func (s *Rates) RefreshRankings(now time.Time) (int, error) {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	postTop := make(map[int]*[len(ranking.Periods)]int)
+	commentTop := make(map[int]*[len(ranking.Periods)]int)
+	for key, r := range s.d.rates {
+		tally, id := postTop, key.postID
+		if key.commentID != 0 {
+			tally, id = commentTop, key.commentID
+		}
+		if tally[id] == nil {
+			tally[id] = new([len(ranking.Periods)]int)
+		}
+		ranking.Tally(tally[id], r.status, r.ratedAt, now)
+	}
+
+	refreshed := 0
+	refresh := func(current *ranking.Scores, votes api.Rate, top *[len(ranking.Periods)]int, createdAt time.Time) {
+		var counts [len(ranking.Periods)]int
+		if top != nil {
+			counts = *top
+		}
+		if scores := ranking.Compute(votes.Upvotes, votes.Downvotes, counts, createdAt, now); scores != *current {
+			*current = scores
+			refreshed++
+		}
+	}
+	for _, p := range s.d.posts {
+		refresh(s.d.postScores[p.ID], p.Rate, postTop[p.ID], p.CreatedAt)
+	}
+	for _, c := range s.d.comments {
+		refresh(s.d.commentScores[c.ID], c.Rate, commentTop[c.ID], c.CreatedAt)
+	}
+	return refreshed, nil
+}
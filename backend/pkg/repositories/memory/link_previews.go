@@ -0,0 +1,27 @@
+package memory
+
+import "project-root/pkg/api"
+
+// LinkPreviews is the in-memory LinkPreviewStore
+type LinkPreviews struct{ d *data }
+
+func (s *LinkPreviews) GetLinkPreviews(urls []string) (map[string]api.LinkPreview, error) {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	previews := make(map[string]api.LinkPreview)
+	for _, u := range urls {
+		if p, ok := s.d.previews[u]; ok {
+			previews[u] = p
+		}
+	}
+	return previews, nil
+}
+
+func (s *LinkPreviews) SaveLinkPreview(p api.LinkPreview) error {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	s.d.previews[p.URL] = p
+	return nil
+}
@@ -0,0 +1,280 @@
+// Package memory provides in-memory implementations of the repository stores.
+// They behave like the SQL repositories closely enough to exercise handlers
+// and the WebSocket manager in tests without a database file.
+package memory
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"project-root/pkg/api"
+	"project-root/pkg/clock"
+	"project-root/pkg/mention"
+	"project-root/pkg/ranking"
+	"project-root/pkg/repositories"
+)
+
+// data is the state shared by all stores created by one NewStores call
+type data struct {
+	mu    sync.Mutex
+	clock clock.Clock
+
+	users    []*user
+	sessions map[string]api.Session
+
+	posts          []*api.Post
+	comments       []*api.Comment
+	categories     []api.Category
+	postCategories map[int][]int
+	rates          map[rateKey]rate
+	postScores     map[int]*ranking.Scores
+	commentScores  map[int]*ranking.Scores
+
+	userFollows     []follow
+	categoryFollows []follow
+
+	collections []*collection
+	bookmarks   []*bookmark
+
+	chats    []api.ChatInfo
+	messages map[string][]message
+
+	attachments []*api.Attachment
+	previews    map[string]api.LinkPreview
+	reactions   []reaction
+	polls       map[int]*poll
+	pollOptions int
+	pollVotes   []pollVote
+	drafts      []*api.Draft
+	draftID     int
+	webhooks    []*api.Webhook
+	webhookID   int
+	deliveries  []*api.WebhookDelivery
+	deliveryID  int
+	outbox      []*outboxEvent
+	outboxID    int
+
+	tokens []*token
+}
+
+type user struct {
+	api.User
+	email        string
+	passwordHash string
+}
+
+type rateKey struct {
+	userID    int
+	postID    int
+	commentID int
+}
+
+type rate struct {
+	status  string
+	ratedAt time.Time
+}
+
+// follow links a user to a followed user or category, kept in the order they were followed
+type follow struct {
+	userID   int
+	targetID int
+}
+
+type message struct {
+	senderID int
+	content  string
+	sentAt   time.Time
+	mentions []api.Mention
+}
+
+type reaction struct {
+	userID int
+	target repositories.ContentTarget
+	emoji  string
+}
+
+// poll keeps the options of a poll in order; option IDs count up across polls
+type poll struct {
+	api.PollCreateRequest
+	optionIDs []int
+}
+
+// pollVote is a vote of a user for an option, kept in the order they were cast
+type pollVote struct {
+	postID   int
+	optionID int
+	userID   int
+}
+
+type token struct {
+	api.APIToken
+	userID    int
+	tokenHash string
+}
+
+// NewStores creates an empty set of in-memory stores that take the current time from clk
+func NewStores(clk clock.Clock) repositories.Stores {
+	d := &data{
+		clock:          clk,
+		sessions:       make(map[string]api.Session),
+		postCategories: make(map[int][]int),
+		rates:          make(map[rateKey]rate),
+		postScores:     make(map[int]*ranking.Scores),
+		commentScores:  make(map[int]*ranking.Scores),
+		messages:       make(map[string][]message),
+		previews:       make(map[string]api.LinkPreview),
+		polls:          make(map[int]*poll),
+	}
+	return repositories.Stores{
+		Users:       &Users{d},
+		Sessions:    &Sessions{d},
+		Posts:       &Posts{d},
+		Comments:    &Comments{d},
+		Rates:       &Rates{d},
+		Follows:     &Follows{d},
+		Bookmarks:   &Bookmarks{d},
+		Chats:       &Chats{d},
+		Attachments: &Attachments{d},
+		Previews:    &LinkPreviews{d},
+		Reactions:   &Reactions{d},
+		Polls:       &Polls{d},
+		Drafts:      &Drafts{d},
+		Webhooks:    &Webhooks{d},
+		Outbox:      &Outbox{d},
+		Counts:      &Counts{d},
+		Tokens:      &Tokens{d},
+	}
+}
+
+// The in-memory stores implement the store interfaces
+var (
+	_ repositories.UserStore        = (*Users)(nil)
+	_ repositories.SessionStore     = (*Sessions)(nil)
+	_ repositories.PostStore        = (*Posts)(nil)
+	_ repositories.CommentStore     = (*Comments)(nil)
+	_ repositories.RateStore        = (*Rates)(nil)
+	_ repositories.FollowStore      = (*Follows)(nil)
+	_ repositories.BookmarkStore    = (*Bookmarks)(nil)
+	_ repositories.ChatStore        = (*Chats)(nil)
+	_ repositories.AttachmentStore  = (*Attachments)(nil)
+	_ repositories.LinkPreviewStore = (*LinkPreviews)(nil)
+	_ repositories.ReactionStore    = (*Reactions)(nil)
+	_ repositories.PollStore        = (*Polls)(nil)
+	_ repositories.DraftStore       = (*Drafts)(nil)
+	_ repositories.WebhookStore     = (*Webhooks)(nil)
+	_ repositories.OutboxStore      = (*Outbox)(nil)
+	_ repositories.CountStore       = (*Counts)(nil)
+	_ repositories.TokenStore       = (*Tokens)(nil)
+)
+
+// userByID returns the user with the given ID or nil. Callers must hold d.mu.
+func (d *data) userByID(id int) *user {
+	for _, u := range d.users {
+		if u.ID == id {
+			return u
+		}
+	}
+	return nil
+}
+
+// nickname returns the nickname of a user or an empty string. Callers must hold d.mu.
+func (d *data) nickname(id int) string {
+	if u := d.userByID(id); u != nil {
+		return u.Nickname
+	}
+	return ""
+}
+
+// mentions resolves the mentions in content against the nicknames of users.
+// Callers must hold d.mu.
+func (d *data) mentions(content string) []api.Mention {
+	var mentions []api.Mention
+	for _, m := range mention.Find(content) {
+		for _, u := range d.users {
+			if u.Nickname == m.Nickname {
+				mentions = append(mentions, api.Mention{UserID: u.ID, Nickname: u.Nickname, Offset: m.Offset, Length: m.Length})
+				break
+			}
+		}
+	}
+	return mentions
+}
+
+// currentMentions returns a copy of stored mentions with the current
+// nicknames of the users. Callers must hold d.mu.
+func (d *data) currentMentions(stored []api.Mention) []api.Mention {
+	if len(stored) == 0 {
+		return nil
+	}
+	mentions := make([]api.Mention, len(stored))
+	for i, m := range stored {
+		m.Nickname = d.nickname(m.UserID)
+		mentions[i] = m
+	}
+	return mentions
+}
+
+// sortOrder parses an ORDER BY expression as built by services.GetSortingCriteria,
+// such as "posts.created_at DESC" or "LOWER(users.nickname) ASC".
+func sortOrder(expr string) (field string, desc bool) {
+	expr = strings.TrimSpace(expr)
+	desc = strings.HasSuffix(strings.ToUpper(expr), " DESC")
+	if i := strings.LastIndexByte(expr, ' '); i >= 0 {
+		expr = expr[:i]
+	}
+	expr = strings.TrimSuffix(strings.TrimPrefix(expr, "LOWER("), ")")
+	if i := strings.LastIndexByte(expr, '.'); i >= 0 {
+		expr = expr[i+1:]
+	}
+	return expr, desc
+}
+
+// lessScores compares the ranking scores of two targets on a field and reports
+// whether it is a ranking field at all
+func lessScores(a, b *ranking.Scores, field string) (less, ok bool) {
+	switch field {
+	case "hot":
+		return a.Hot < b.Hot, true
+	case "controversy":
+		return a.Controversy < b.Controversy, true
+	case "rising":
+		return a.Rising < b.Rising, true
+	}
+	for i, p := range ranking.Periods {
+		if field == p.Column() {
+			return a.Top[i] < b.Top[i], true
+		}
+	}
+	return false, false
+}
+
+// sortBy sorts items stably by an ordering expression; less compares two items on a field
+func sortBy[T any](items []T, expr string, less func(a, b T, field string) bool) {
+	field, desc := sortOrder(expr)
+	sort.SliceStable(items, func(i, j int) bool {
+		if desc {
+			return less(items[j], items[i], field)
+		}
+		return less(items[i], items[j], field)
+	})
+}
+
+// page returns the items of one page and the total page count
+func page[T any](items []T, page, pageSize int) ([]T, int) {
+	totalPages := len(items) / pageSize
+	if len(items)%pageSize != 0 {
+		totalPages++
+	}
+
+	start := (page - 1) * pageSize
+	if start >= len(items) {
+		return nil, totalPages
+	}
+	end := start + pageSize
+	if end > len(items) {
+		end = len(items)
+	}
+	return items[start:end], totalPages
+}
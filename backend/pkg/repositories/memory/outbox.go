@@ -0,0 +1,168 @@
+package memory
+
+import (
+	"encoding/json"
+	"slices"
+	"time"
+
+	"project-root/pkg/api"
+)
+
+// outboxEvent is a recorded event with the times the outbox keeps for it
+type outboxEvent struct {
+	api.OutboxEvent
+	availableAt  time.Time
+	dispatchedAt *time.Time
+	delivered    []string
+}
+
+// Outbox is the in-memory OutboxStore
+type Outbox struct{ d *data }
+
+func (s *Outbox) ClaimEvents(now, until time.Time, limit int) ([]api.OutboxEvent, error) {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	events := []api.OutboxEvent{}
+	for _, e := range s.d.outbox {
+		if len(events) == limit {
+			break
+		}
+		if e.dispatchedAt != nil || e.availableAt.After(now) {
+			continue
+		}
+		e.Attempts++
+		e.availableAt = until
+		c := e.OutboxEvent
+		c.Payload = slices.Clone(e.Payload)
+		c.Delivered = slices.Clone(e.delivered)
+		events = append(events, c)
+	}
+	return events, nil
+}
+
+func (s *Outbox) MarkDelivered(id int, subscribers []string, now time.Time) error {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	for _, e := range s.d.outbox {
+		if e.ID != id {
+			continue
+		}
+		for _, subscriber := range subscribers {
+			if !slices.Contains(e.delivered, subscriber) {
+				e.delivered = append(e.delivered, subscriber)
+			}
+		}
+		slices.Sort(e.delivered)
+	}
+	return nil
+}
+
+func (s *Outbox) MarkDispatched(id int, now time.Time) error {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	for _, e := range s.d.outbox {
+		if e.ID == id {
+			e.dispatchedAt = &now
+		}
+	}
+	return nil
+}
+
+func (s *Outbox) EventsAfter(id, limit int) ([]api.OutboxEvent, error) {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	events := []api.OutboxEvent{}
+	for _, e := range s.d.outbox {
+		if len(events) == limit {
+			break
+		}
+		if e.ID > id {
+			c := e.OutboxEvent
+			c.Payload = slices.Clone(e.Payload)
+			events = append(events, c)
+		}
+	}
+	return events, nil
+}
+
+func (s *Outbox) LastEventID() (int, error) {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	if len(s.d.outbox) == 0 {
+		return 0, nil
+	}
+	return s.d.outbox[len(s.d.outbox)-1].ID, nil
+}
+
+func (s *Outbox) PruneEvents(before time.Time) (int, error) {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	count := len(s.d.outbox)
+	s.d.outbox = slices.DeleteFunc(s.d.outbox, func(e *outboxEvent) bool {
+		return e.dispatchedAt != nil && e.dispatchedAt.Before(before)
+	})
+	return count - len(s.d.outbox), nil
+}
+
+// record adds an event to the outbox. Callers must hold d.mu.
+func (d *data) record(event api.Event, now time.Time) error {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	d.outboxID++
+	d.outbox = append(d.outbox, &outboxEvent{
+		OutboxEvent: api.OutboxEvent{ID: d.outboxID, Name: event.EventName(), Payload: payload, CreatedAt: now},
+		availableAt: now,
+	})
+	return nil
+}
+
+// Counts is the in-memory CountStore
+type Counts struct{ d *data }
+
+func (s *Counts) RecountUser(userID int) error {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	u := s.d.userByID(userID)
+	if u == nil {
+		return nil
+	}
+	u.AmountOfPosts, u.AmountOfComments = 0, 0
+	for _, p := range s.d.posts {
+		if p.UserID == userID {
+			u.AmountOfPosts++
+		}
+	}
+	for _, c := range s.d.comments {
+		if c.UserID == userID {
+			u.AmountOfComments++
+		}
+	}
+	return nil
+}
+
+func (s *Counts) RecountPost(postID int) error {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	for _, p := range s.d.posts {
+		if p.ID != postID {
+			continue
+		}
+		p.AmountOfComments = 0
+		for _, c := range s.d.comments {
+			if c.PostID == postID {
+				p.AmountOfComments++
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,109 @@
+package memory
+
+import (
+	"slices"
+	"time"
+
+	"project-root/pkg/api"
+	"project-root/pkg/repositories"
+)
+
+// Polls is the in-memory PollStore
+type Polls struct{ d *data }
+
+func (s *Polls) Vote(postID, userID int, optionIDs []int, now time.Time) error {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	p, err := s.d.openPoll(postID, now)
+	if err != nil {
+		return err
+	}
+	if !p.Multiple && len(optionIDs) > 1 {
+		return repositories.ErrPollSingleChoice
+	}
+	for _, id := range optionIDs {
+		if !slices.Contains(p.optionIDs, id) {
+			return repositories.ErrPollOptionNotFound
+		}
+	}
+	s.d.removePollVotes(postID, userID)
+	for _, id := range optionIDs {
+		s.d.pollVotes = append(s.d.pollVotes, pollVote{postID: postID, optionID: id, userID: userID})
+	}
+	return nil
+}
+
+func (s *Polls) WithdrawVote(postID, userID int, now time.Time) (bool, error) {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	if _, err := s.d.openPoll(postID, now); err != nil {
+		return false, err
+	}
+	return s.d.removePollVotes(postID, userID), nil
+}
+
+func (s *Polls) GetPolls(postIDs []int, userID int) (map[int]*api.Poll, error) {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	polls := make(map[int]*api.Poll)
+	for _, postID := range postIDs {
+		p, ok := s.d.polls[postID]
+		if !ok {
+			continue
+		}
+		result := &api.Poll{
+			Question:  p.Question,
+			Multiple:  p.Multiple,
+			Anonymous: p.Anonymous,
+			ClosesAt:  p.ClosesAt,
+			Options:   []api.PollOption{},
+		}
+		for i, id := range p.optionIDs {
+			result.Options = append(result.Options, api.PollOption{ID: id, Text: p.Options[i]})
+		}
+		voted := make(map[int]bool)
+		for _, v := range s.d.pollVotes {
+			if v.postID != postID {
+				continue
+			}
+			if !voted[v.userID] {
+				voted[v.userID] = true
+				result.TotalVoters++
+			}
+			if v.userID == userID {
+				result.MyVotes = append(result.MyVotes, v.optionID)
+			}
+			option := &result.Options[slices.Index(p.optionIDs, v.optionID)]
+			option.Votes++
+			if u := s.d.userByID(v.userID); u != nil && !p.Anonymous {
+				option.Voters = append(option.Voters, api.UserResponse{ID: u.ID, Nickname: u.Nickname})
+			}
+		}
+		polls[postID] = result
+	}
+	return polls, nil
+}
+
+// openPoll returns the poll of a post unless it is missing or closed at now
+func (d *data) openPoll(postID int, now time.Time) (*poll, error) {
+	p, ok := d.polls[postID]
+	if !ok || d.postByID(postID) == nil {
+		return nil, repositories.ErrPollNotFound
+	}
+	if p.ClosesAt != nil && !now.Before(*p.ClosesAt) {
+		return nil, repositories.ErrPollClosed
+	}
+	return p, nil
+}
+
+// removePollVotes drops the ballot of the user and reports whether there was one
+func (d *data) removePollVotes(postID, userID int) bool {
+	n := len(d.pollVotes)
+	d.pollVotes = slices.DeleteFunc(d.pollVotes, func(v pollVote) bool {
+		return v.postID == postID && v.userID == userID
+	})
+	return len(d.pollVotes) < n
+}
@@ -0,0 +1,111 @@
+package memory
+
+import (
+	"project-root/pkg/api"
+	"project-root/pkg/repositories"
+)
+
+// Reactions is the in-memory ReactionStore
+type Reactions struct{ d *data }
+
+func (s *Reactions) AddReaction(userID int, req api.ReactionRequest) (bool, error) {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	switch {
+	case req.ChatHash != "":
+		if _, ok := s.d.chat(userID, req.ChatHash); !ok || req.MessageID < 1 || req.MessageID > len(s.d.messages[req.ChatHash]) {
+			return false, repositories.ErrReactionTargetNotFound
+		}
+	case req.CommentID != 0:
+		if c := s.d.commentByID(req.CommentID); c == nil || c.PostID != req.PostID {
+			return false, repositories.ErrReactionTargetNotFound
+		}
+	default:
+		if s.d.postByID(req.PostID) == nil {
+			return false, repositories.ErrReactionTargetNotFound
+		}
+	}
+
+	r := reaction{userID: userID, target: repositories.ReactionTarget(req), emoji: req.Emoji}
+	for _, existing := range s.d.reactions {
+		if existing == r {
+			return false, nil
+		}
+	}
+	s.d.reactions = append(s.d.reactions, r)
+	return true, nil
+}
+
+func (s *Reactions) RemoveReaction(userID int, req api.ReactionRequest) (bool, error) {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	r := reaction{userID: userID, target: repositories.ReactionTarget(req), emoji: req.Emoji}
+	for i, existing := range s.d.reactions {
+		if existing == r {
+			s.d.reactions = append(s.d.reactions[:i], s.d.reactions[i+1:]...)
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (s *Reactions) GetPostReactions(postIDs []int, userID int) (map[int][]api.Reaction, error) {
+	return s.reactions(userID, func(t repositories.ContentTarget) int {
+		return t.PostID
+	}, postIDs), nil
+}
+
+func (s *Reactions) GetCommentReactions(commentIDs []int, userID int) (map[int][]api.Reaction, error) {
+	return s.reactions(userID, func(t repositories.ContentTarget) int {
+		return t.CommentID
+	}, commentIDs), nil
+}
+
+func (s *Reactions) GetMessageReactions(chatHash string, userID int) (map[int][]api.Reaction, error) {
+	s.d.mu.Lock()
+	var ids []int
+	for i := range s.d.messages[chatHash] {
+		ids = append(ids, i+1)
+	}
+	s.d.mu.Unlock()
+
+	return s.reactions(userID, func(t repositories.ContentTarget) int {
+		if t.ChatHash != chatHash {
+			return 0
+		}
+		return t.MessageID
+	}, ids), nil
+}
+
+// reactions counts the reactions to the content with the given IDs per emoji,
+// in the order the emoji were first used; key returns 0 for other content
+func (s *Reactions) reactions(userID int, key func(repositories.ContentTarget) int, ids []int) map[int][]api.Reaction {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	wanted := make(map[int]bool, len(ids))
+	for _, id := range ids {
+		wanted[id] = true
+	}
+	reactions := make(map[int][]api.Reaction)
+	for _, r := range s.d.reactions {
+		id := key(r.target)
+		if id == 0 || !wanted[id] {
+			continue
+		}
+		i := 0
+		for i < len(reactions[id]) && reactions[id][i].Emoji != r.emoji {
+			i++
+		}
+		if i == len(reactions[id]) {
+			reactions[id] = append(reactions[id], api.Reaction{Emoji: r.emoji})
+		}
+		reactions[id][i].Count++
+		if r.userID == userID {
+			reactions[id][i].ReactedByMe = true
+		}
+	}
+	return reactions
+}
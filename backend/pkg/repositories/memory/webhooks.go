@@ -0,0 +1,202 @@
+package memory
+
+import (
+	"slices"
+	"time"
+
+	"project-root/pkg/api"
+	"project-root/pkg/repositories"
+)
+
+// Webhooks is the in-memory WebhookStore
+type Webhooks struct{ d *data }
+
+func (s *Webhooks) CreateWebhook(w *api.Webhook) error {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	s.d.webhookID++
+	w.ID = s.d.webhookID
+	s.d.webhooks = append(s.d.webhooks, copyWebhook(w))
+	return nil
+}
+
+func (s *Webhooks) UpdateWebhook(w api.Webhook) error {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	webhook := s.d.webhook(w.ID)
+	if webhook == nil {
+		return repositories.ErrWebhookNotFound
+	}
+	webhook.URL = w.URL
+	webhook.Events = slices.Clone(w.Events)
+	webhook.Active = w.Active
+	return nil
+}
+
+func (s *Webhooks) GetWebhooks() ([]api.Webhook, error) {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	webhooks := []api.Webhook{}
+	for _, w := range s.d.webhooks {
+		webhooks = append(webhooks, *copyWebhook(w))
+	}
+	return webhooks, nil
+}
+
+func (s *Webhooks) GetWebhook(id int) (*api.Webhook, error) {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	webhook := s.d.webhook(id)
+	if webhook == nil {
+		return nil, repositories.ErrWebhookNotFound
+	}
+	return copyWebhook(webhook), nil
+}
+
+func (s *Webhooks) DeleteWebhook(id int) error {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	if s.d.webhook(id) == nil {
+		return repositories.ErrWebhookNotFound
+	}
+	s.d.webhooks = slices.DeleteFunc(s.d.webhooks, func(w *api.Webhook) bool { return w.ID == id })
+	s.d.deliveries = slices.DeleteFunc(s.d.deliveries, func(d *api.WebhookDelivery) bool { return d.WebhookID == id })
+	return nil
+}
+
+func (s *Webhooks) EnqueueDeliveries(event string, payload []byte, now time.Time) (int, error) {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	queued := 0
+	for _, w := range s.d.webhooks {
+		if !w.Active || !slices.Contains(w.Events, event) {
+			continue
+		}
+		s.d.deliveryID++
+		due := now
+		s.d.deliveries = append(s.d.deliveries, &api.WebhookDelivery{
+			ID:            s.d.deliveryID,
+			WebhookID:     w.ID,
+			Event:         event,
+			Payload:       slices.Clone(payload),
+			Status:        api.DeliveryPending,
+			NextAttemptAt: &due,
+			CreatedAt:     now,
+		})
+		queued++
+	}
+	return queued, nil
+}
+
+func (s *Webhooks) ClaimDueDeliveries(now, until time.Time, limit int) ([]api.WebhookDelivery, error) {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	var due []*api.WebhookDelivery
+	for _, d := range s.d.deliveries {
+		if d.Status == api.DeliveryPending && !d.NextAttemptAt.After(now) {
+			due = append(due, d)
+		}
+	}
+	slices.SortStableFunc(due, func(a, b *api.WebhookDelivery) int {
+		if c := a.NextAttemptAt.Compare(*b.NextAttemptAt); c != 0 {
+			return c
+		}
+		return a.ID - b.ID
+	})
+	if len(due) > limit {
+		due = due[:limit]
+	}
+
+	deliveries := []api.WebhookDelivery{}
+	for _, d := range due {
+		next := until
+		d.NextAttemptAt = &next
+		deliveries = append(deliveries, *copyDelivery(d))
+	}
+	return deliveries, nil
+}
+
+func (s *Webhooks) SaveDeliveryResult(d api.WebhookDelivery) error {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	if delivery := s.d.delivery(d.WebhookID, d.ID); delivery != nil {
+		*delivery = *copyDelivery(&d)
+	}
+	return nil
+}
+
+func (s *Webhooks) GetDeliveries(webhookID, page_, pageSize int) ([]api.WebhookDelivery, int, int, error) {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	all := []api.WebhookDelivery{}
+	for i := len(s.d.deliveries) - 1; i >= 0; i-- {
+		if s.d.deliveries[i].WebhookID == webhookID {
+			all = append(all, *copyDelivery(s.d.deliveries[i]))
+		}
+	}
+	deliveries, totalPages := page(all, page_, pageSize)
+	return deliveries, len(all), totalPages, nil
+}
+
+func (s *Webhooks) RedeliverDelivery(webhookID, deliveryID int, now time.Time) (*api.WebhookDelivery, error) {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+
+	delivery := s.d.delivery(webhookID, deliveryID)
+	if delivery == nil {
+		return nil, repositories.ErrWebhookDeliveryNotFound
+	}
+	delivery.Status = api.DeliveryPending
+	delivery.Attempts = 0
+	delivery.NextAttemptAt = &now
+	return copyDelivery(delivery), nil
+}
+
+// webhook returns the webhook with the given ID or nil. Callers must hold d.mu.
+func (d *data) webhook(id int) *api.Webhook {
+	for _, w := range d.webhooks {
+		if w.ID == id {
+			return w
+		}
+	}
+	return nil
+}
+
+// delivery returns a delivery of the webhook or nil. Callers must hold d.mu.
+func (d *data) delivery(webhookID, deliveryID int) *api.WebhookDelivery {
+	for _, delivery := range d.deliveries {
+		if delivery.ID == deliveryID && delivery.WebhookID == webhookID {
+			return delivery
+		}
+	}
+	return nil
+}
+
+func copyWebhook(w *api.Webhook) *api.Webhook {
+	c := *w
+	c.Events = slices.Clone(w.Events)
+	return &c
+}
+
+func copyDelivery(d *api.WebhookDelivery) *api.WebhookDelivery {
+	c := *d
+	c.Payload = slices.Clone(d.Payload)
+	if d.NextAttemptAt != nil {
+		next := *d.NextAttemptAt
+		c.NextAttemptAt = &next
+	}
+	if d.DeliveredAt != nil {
+		delivered := *d.DeliveredAt
+		c.DeliveredAt = &delivered
+	}
+	return &c
+}
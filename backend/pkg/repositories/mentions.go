@@ -0,0 +1,132 @@
+package repositories
+
+import (
+	"database/sql"
+	"strings"
+
+	"project-root/pkg/api"
+	"project-root/pkg/db"
+	"project-root/pkg/mention"
+)
+
+// Queryer runs queries; *db.Pool, *sql.DB and *sql.Tx implement it
+type Queryer interface {
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+}
+
+// Execer runs statements; *db.Pool, *sql.DB and *sql.Tx implement it
+type Execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+// ContentTarget is content that mentions users or carries attachments: a
+// post, a comment or a message of a chat
+type ContentTarget struct {
+	PostID    int
+	CommentID int
+	ChatHash  string
+	MessageID int
+}
+
+// SaveMentions finds the @nickname mentions in content inside tx, stores
+// those naming existing users for target and returns them. Nicknames are
+// matched exactly.
+func SaveMentions(tx *sql.Tx, dialect db.Dialect, target ContentTarget, content string) ([]api.Mention, error) {
+	matches := mention.Find(content)
+	if len(matches) == 0 {
+		return nil, nil
+	}
+
+	nicknames := make([]interface{}, len(matches))
+	for i, m := range matches {
+		nicknames[i] = m.Nickname
+	}
+	rows, err := tx.Query(dialect.Rebind("SELECT id, nickname FROM users WHERE nickname IN ("+placeholders(len(nicknames))+")"), nicknames...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	userIDs := make(map[string]int)
+	for rows.Next() {
+		var id int
+		var nickname string
+		if err := rows.Scan(&id, &nickname); err != nil {
+			return nil, err
+		}
+		userIDs[nickname] = id
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	var mentions []api.Mention
+	for _, m := range matches {
+		userID, ok := userIDs[m.Nickname]
+		if !ok {
+			continue
+		}
+		_, err := tx.Exec(dialect.Rebind("INSERT INTO mentions (user_id, post_id, comment_id, chat_hash, message_id, start, length) VALUES (?, ?, ?, ?, ?, ?, ?)"),
+			userID,
+			sql.NullInt64{Int64: int64(target.PostID), Valid: target.PostID != 0},
+			sql.NullInt64{Int64: int64(target.CommentID), Valid: target.CommentID != 0},
+			sql.NullString{String: target.ChatHash, Valid: target.ChatHash != ""},
+			sql.NullInt64{Int64: int64(target.MessageID), Valid: target.ChatHash != ""},
+			m.Offset, m.Length)
+		if err != nil {
+			return nil, err
+		}
+		mentions = append(mentions, api.Mention{UserID: userID, Nickname: m.Nickname, Offset: m.Offset, Length: m.Length})
+	}
+	return mentions, nil
+}
+
+// LoadMentions returns the mentions in the posts or comments with the given
+// IDs, keyed by ID; column is "post_id" or "comment_id"
+func LoadMentions(q Queryer, dialect db.Dialect, column string, ids []int) (map[int][]api.Mention, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	args := make([]interface{}, len(ids))
+	for i, id := range ids {
+		args[i] = id
+	}
+	return loadMentions(q, dialect, column, "mentions."+column+" IN ("+placeholders(len(ids))+")", args...)
+}
+
+// LoadMessageMentions returns the mentions in the messages of a chat, keyed by message ID
+func LoadMessageMentions(q Queryer, dialect db.Dialect, chatHash string) (map[int][]api.Mention, error) {
+	return loadMentions(q, dialect, "message_id", "mentions.chat_hash = ?", chatHash)
+}
+
+// loadMentions reads the mentions matching where with the current nicknames
+// of the mentioned users and groups them by column
+func loadMentions(q Queryer, dialect db.Dialect, column, where string, args ...interface{}) (map[int][]api.Mention, error) {
+	rows, err := q.Query(dialect.Rebind(`
+		SELECT mentions.`+column+`, mentions.user_id, users.nickname, mentions.start, mentions.length
+		FROM mentions
+		JOIN users ON users.id = mentions.user_id
+		WHERE `+where+`
+		ORDER BY mentions.start`), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	mentions := make(map[int][]api.Mention)
+	for rows.Next() {
+		var id int
+		var m api.Mention
+		if err := rows.Scan(&id, &m.UserID, &m.Nickname, &m.Offset, &m.Length); err != nil {
+			return nil, err
+		}
+		mentions[id] = append(mentions[id], m)
+	}
+	return mentions, rows.Err()
+}
+
+// placeholders returns n comma separated ? placeholders
+func placeholders(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?, ", n), ", ")
+}
@@ -0,0 +1,203 @@
+package repositories
+
+import (
+	"database/sql"
+	"encoding/json"
+	"slices"
+	"strings"
+	"time"
+
+	"project-root/pkg/api"
+	"project-root/pkg/db"
+)
+
+// OutboxChannel is the PostgreSQL notification channel on which every
+// recorded event is announced
+const OutboxChannel = "outbox"
+
+// OutboxRepository provides access to the recorded events
+type OutboxRepository struct {
+	DB *db.Pool
+}
+
+// NewOutboxRepository creates a new OutboxRepository
+func NewOutboxRepository(pool *db.Pool) *OutboxRepository {
+	return &OutboxRepository{DB: pool}
+}
+
+// ClaimEvents claims events in a transaction. SQLite serializes writers, so
+// no other dispatcher can claim the same events meanwhile.
+func (r *OutboxRepository) ClaimEvents(now, until time.Time, limit int) ([]api.OutboxEvent, error) {
+	tx, err := r.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	events, err := ClaimOutboxEvents(tx, db.SQLite, now, until, limit)
+	if err != nil {
+		return nil, err
+	}
+	return events, tx.Commit()
+}
+
+func (r *OutboxRepository) MarkDelivered(id int, subscribers []string, now time.Time) error {
+	return MarkOutboxEventDelivered(r.DB, db.SQLite, id, subscribers, now)
+}
+
+func (r *OutboxRepository) MarkDispatched(id int, now time.Time) error {
+	return MarkOutboxEventDispatched(r.DB, db.SQLite, id, now)
+}
+
+func (r *OutboxRepository) EventsAfter(id, limit int) ([]api.OutboxEvent, error) {
+	return OutboxEventsAfter(r.DB, db.SQLite, id, limit)
+}
+
+func (r *OutboxRepository) LastEventID() (int, error) {
+	return LastOutboxEventID(r.DB)
+}
+
+func (r *OutboxRepository) PruneEvents(before time.Time) (int, error) {
+	return PruneOutbox(r.DB, db.SQLite, before)
+}
+
+// RecordEvent stores an event in the outbox. Stores call it inside the
+// transaction of the change the event describes, so that the event is
+// recorded exactly when the change is committed.
+func RecordEvent(e Execer, dialect db.Dialect, event api.Event, now time.Time) error {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	now = now.UTC()
+	_, err = e.Exec(dialect.Rebind("INSERT INTO outbox (event, payload, available_at, created_at) VALUES (?, ?, ?, ?)"),
+		event.EventName(), string(payload), now, now)
+	if err != nil || dialect != db.Postgres {
+		return err
+	}
+	// Servers listening learn of the event when the transaction commits
+	_, err = e.Exec("NOTIFY " + OutboxChannel)
+	return err
+}
+
+// ClaimOutboxEvents returns up to limit undispatched events available at now,
+// oldest first, counts the attempt and makes them available again at until.
+// A dispatcher that stops while handling them leaves them to be claimed again
+// once until has passed. The events name the subscribers that handled them
+// on earlier attempts.
+func ClaimOutboxEvents(tx *sql.Tx, dialect db.Dialect, now, until time.Time, limit int) ([]api.OutboxEvent, error) {
+	due := "SELECT id FROM outbox WHERE dispatched_at IS NULL AND available_at <= ? ORDER BY id LIMIT ?"
+	if dialect == db.Postgres {
+		// Dispatchers sharing the database claim different events
+		due += " FOR UPDATE SKIP LOCKED"
+	}
+	events := []api.OutboxEvent{}
+	err := scanRows(tx, dialect.Rebind("UPDATE outbox SET attempts = attempts + 1, available_at = ? WHERE id IN ("+due+") RETURNING id, event, payload, attempts, created_at"),
+		[]interface{}{until.UTC(), now.UTC(), limit}, func(rows *sql.Rows) error {
+			e, err := scanOutboxEvent(rows)
+			events = append(events, e)
+			return err
+		})
+	if err != nil || len(events) == 0 {
+		return events, err
+	}
+	// RETURNING keeps no order
+	slices.SortFunc(events, func(a, b api.OutboxEvent) int { return a.ID - b.ID })
+
+	ids := make([]interface{}, len(events))
+	byID := make(map[int]*api.OutboxEvent, len(events))
+	for i := range events {
+		ids[i] = events[i].ID
+		byID[events[i].ID] = &events[i]
+	}
+	err = scanRows(tx, dialect.Rebind("SELECT event_id, subscriber FROM outbox_deliveries WHERE event_id IN ("+placeholders(len(ids))+") ORDER BY event_id, subscriber"),
+		ids, func(rows *sql.Rows) error {
+			var id int
+			var subscriber string
+			if err := rows.Scan(&id, &subscriber); err != nil {
+				return err
+			}
+			byID[id].Delivered = append(byID[id].Delivered, subscriber)
+			return nil
+		})
+	return events, err
+}
+
+// OutboxEventsAfter returns up to limit events with an ID above id, whether
+// dispatched or not, in ID order
+func OutboxEventsAfter(q Queryer, dialect db.Dialect, id, limit int) ([]api.OutboxEvent, error) {
+	events := []api.OutboxEvent{}
+	err := scanRows(q, dialect.Rebind("SELECT id, event, payload, attempts, created_at FROM outbox WHERE id > ? ORDER BY id LIMIT ?"),
+		[]interface{}{id, limit}, func(rows *sql.Rows) error {
+			e, err := scanOutboxEvent(rows)
+			events = append(events, e)
+			return err
+		})
+	return events, err
+}
+
+// LastOutboxEventID returns the highest event ID in the outbox, 0 when it is empty
+func LastOutboxEventID(q Queryer) (int, error) {
+	var id int
+	err := scanRows(q, "SELECT COALESCE(MAX(id), 0) FROM outbox", nil, func(rows *sql.Rows) error {
+		return rows.Scan(&id)
+	})
+	return id, err
+}
+
+// scanOutboxEvent reads the id, event, payload, attempts and created_at columns
+func scanOutboxEvent(rows *sql.Rows) (api.OutboxEvent, error) {
+	var e api.OutboxEvent
+	var payload string
+	err := rows.Scan(&e.ID, &e.Name, &payload, &e.Attempts, &e.CreatedAt)
+	e.Payload = json.RawMessage(payload)
+	return e, err
+}
+
+// MarkOutboxEventDelivered records that the subscribers handled an event
+func MarkOutboxEventDelivered(e Execer, dialect db.Dialect, id int, subscribers []string, now time.Time) error {
+	if len(subscribers) == 0 {
+		return nil
+	}
+	values := make([]string, len(subscribers))
+	args := make([]interface{}, 0, 3*len(subscribers))
+	for i, subscriber := range subscribers {
+		values[i] = "(?, ?, ?)"
+		args = append(args, id, subscriber, now.UTC())
+	}
+	_, err := e.Exec(dialect.Rebind("INSERT INTO outbox_deliveries (event_id, subscriber, delivered_at) VALUES "+strings.Join(values, ", ")+" ON CONFLICT DO NOTHING"), args...)
+	return err
+}
+
+// MarkOutboxEventDispatched sets the dispatched_at of an event, once all its
+// subscribers handled it or gave up, so that it is no longer claimed and can
+// be pruned
+func MarkOutboxEventDispatched(e Execer, dialect db.Dialect, id int, now time.Time) error {
+	_, err := e.Exec(dialect.Rebind("UPDATE outbox SET dispatched_at = ? WHERE id = ?"), now.UTC(), id)
+	return err
+}
+
+// PruneOutbox removes the events dispatched before before and returns how many
+func PruneOutbox(e Execer, dialect db.Dialect, before time.Time) (int, error) {
+	result, err := e.Exec(dialect.Rebind("DELETE FROM outbox WHERE dispatched_at IS NOT NULL AND dispatched_at < ?"), before.UTC())
+	if err != nil {
+		return 0, err
+	}
+	pruned, err := result.RowsAffected()
+	return int(pruned), err
+}
+
+// LoadUserResponse returns the ID and nickname of a user, for the events
+// recorded by stores that only know the user ID
+func LoadUserResponse(q Queryer, dialect db.Dialect, userID int) (api.UserResponse, error) {
+	user := api.UserResponse{ID: userID}
+	found := false
+	err := scanRows(q, dialect.Rebind("SELECT nickname FROM users WHERE id = ?"), []interface{}{userID}, func(rows *sql.Rows) error {
+		found = true
+		return rows.Scan(&user.Nickname)
+	})
+	if err == nil && !found {
+		err = sql.ErrNoRows
+	}
+	return user, err
+}
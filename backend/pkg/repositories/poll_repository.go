@@ -0,0 +1,258 @@
+package repositories
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"project-root/pkg/api"
+	"project-root/pkg/db"
+)
+
+var (
+	// ErrPollNotFound is returned when voting on a post without a poll
+	ErrPollNotFound = errors.New("poll not found")
+	// ErrPollClosed is returned when voting after the poll closed
+	ErrPollClosed = errors.New("poll closed")
+	// ErrPollOptionNotFound is returned when voting for an option of another poll
+	ErrPollOptionNotFound = errors.New("poll option not found")
+	// ErrPollSingleChoice is returned when voting for several options of a
+	// single choice poll
+	ErrPollSingleChoice = errors.New("poll allows a single choice")
+)
+
+// PollRepository provides access to the polls attached to posts
+type PollRepository struct {
+	DB *db.Pool
+}
+
+// NewPollRepository creates a new PollRepository
+func NewPollRepository(pool *db.Pool) *PollRepository {
+	return &PollRepository{DB: pool}
+}
+
+// Vote replaces the ballot of the user in a single transaction
+func (r *PollRepository) Vote(postID, userID int, optionIDs []int, now time.Time) error {
+	tx, err := r.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := CastPollVote(tx, db.SQLite, postID, userID, optionIDs, now); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (r *PollRepository) WithdrawVote(postID, userID int, now time.Time) (bool, error) {
+	tx, err := r.DB.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	withdrawn, err := WithdrawPollVote(tx, db.SQLite, postID, userID, now)
+	if err != nil {
+		return false, err
+	}
+	return withdrawn, tx.Commit()
+}
+
+func (r *PollRepository) GetPolls(postIDs []int, userID int) (map[int]*api.Poll, error) {
+	return LoadPolls(r.DB, db.SQLite, postIDs, userID)
+}
+
+// SavePoll stores the poll of a new post inside tx
+func SavePoll(tx *sql.Tx, dialect db.Dialect, postID int, poll *api.PollCreateRequest) error {
+	var closesAt sql.NullTime
+	if poll.ClosesAt != nil {
+		closesAt = sql.NullTime{Time: *poll.ClosesAt, Valid: true}
+	}
+	if _, err := tx.Exec(dialect.Rebind("INSERT INTO polls (post_id, question, multiple, anonymous, closes_at) VALUES (?, ?, ?, ?, ?)"),
+		postID, poll.Question, poll.Multiple, poll.Anonymous, closesAt); err != nil {
+		return err
+	}
+	for i, text := range poll.Options {
+		if _, err := tx.Exec(dialect.Rebind("INSERT INTO poll_options (post_id, position, text) VALUES (?, ?, ?)"), postID, i, text); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// openPoll checks inside tx that the post has a poll that is still open at
+// now and reports whether it allows several choices
+func openPoll(tx *sql.Tx, dialect db.Dialect, postID int, now time.Time) (bool, error) {
+	query := "SELECT multiple, closes_at FROM polls WHERE post_id = ?"
+	if dialect == db.Postgres {
+		// Concurrent ballots of a user must not interleave; SQLite already
+		// serializes the writers
+		query += " FOR UPDATE"
+	}
+	var multiple bool
+	var closesAt sql.NullTime
+	err := tx.QueryRow(dialect.Rebind(query), postID).Scan(&multiple, &closesAt)
+	if err == sql.ErrNoRows {
+		return false, ErrPollNotFound
+	}
+	if err != nil {
+		return false, err
+	}
+	if closesAt.Valid && !now.Before(closesAt.Time) {
+		return false, ErrPollClosed
+	}
+	return multiple, nil
+}
+
+// CastPollVote replaces the ballot of the user in the poll of a post inside
+// tx. optionIDs must be distinct.
+func CastPollVote(tx *sql.Tx, dialect db.Dialect, postID, userID int, optionIDs []int, now time.Time) error {
+	multiple, err := openPoll(tx, dialect, postID, now)
+	if err != nil {
+		return err
+	}
+	if !multiple && len(optionIDs) > 1 {
+		return ErrPollSingleChoice
+	}
+
+	args := []interface{}{postID}
+	for _, id := range optionIDs {
+		args = append(args, id)
+	}
+	var found int
+	if err := tx.QueryRow(dialect.Rebind("SELECT COUNT(*) FROM poll_options WHERE post_id = ? AND id IN ("+placeholders(len(optionIDs))+")"), args...).Scan(&found); err != nil {
+		return err
+	}
+	if found != len(optionIDs) {
+		return ErrPollOptionNotFound
+	}
+
+	if _, err := tx.Exec(dialect.Rebind("DELETE FROM poll_votes WHERE post_id = ? AND user_id = ?"), postID, userID); err != nil {
+		return err
+	}
+	for _, id := range optionIDs {
+		if _, err := tx.Exec(dialect.Rebind("INSERT INTO poll_votes (option_id, post_id, user_id, created_at) VALUES (?, ?, ?, ?)"), id, postID, userID, now); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WithdrawPollVote removes the ballot of the user from the poll of a post
+// inside tx and reports whether there was one
+func WithdrawPollVote(tx *sql.Tx, dialect db.Dialect, postID, userID int, now time.Time) (bool, error) {
+	if _, err := openPoll(tx, dialect, postID, now); err != nil {
+		return false, err
+	}
+	result, err := tx.Exec(dialect.Rebind("DELETE FROM poll_votes WHERE post_id = ? AND user_id = ?"), postID, userID)
+	if err != nil {
+		return false, err
+	}
+	removed, err := result.RowsAffected()
+	return removed > 0, err
+}
+
+// LoadPolls returns the polls of the posts with the given IDs, keyed by post
+// ID, with the votes of userID. Voters are listed in the order they voted.
+func LoadPolls(q Queryer, dialect db.Dialect, postIDs []int, userID int) (map[int]*api.Poll, error) {
+	if len(postIDs) == 0 {
+		return nil, nil
+	}
+	ids := make([]interface{}, len(postIDs))
+	for i, id := range postIDs {
+		ids[i] = id
+	}
+	in := "post_id IN (" + placeholders(len(ids)) + ")"
+
+	polls := make(map[int]*api.Poll)
+	err := scanRows(q, dialect.Rebind("SELECT post_id, question, multiple, anonymous, closes_at FROM polls WHERE "+in), ids, func(rows *sql.Rows) error {
+		var postID int
+		var poll api.Poll
+		var closesAt sql.NullTime
+		if err := rows.Scan(&postID, &poll.Question, &poll.Multiple, &poll.Anonymous, &closesAt); err != nil {
+			return err
+		}
+		if closesAt.Valid {
+			poll.ClosesAt = &closesAt.Time
+		}
+		poll.Options = []api.PollOption{}
+		polls[postID] = &poll
+		return nil
+	})
+	if err != nil || len(polls) == 0 {
+		return nil, err
+	}
+
+	// option IDs map to the position of the option in its poll
+	options := make(map[int]int)
+	err = scanRows(q, dialect.Rebind(`
+		SELECT poll_options.post_id, poll_options.id, poll_options.text, COUNT(poll_votes.user_id)
+		FROM poll_options
+		LEFT JOIN poll_votes ON poll_votes.option_id = poll_options.id
+		WHERE poll_options.`+in+`
+		GROUP BY poll_options.post_id, poll_options.id, poll_options.text, poll_options.position
+		ORDER BY poll_options.post_id, poll_options.position`), ids, func(rows *sql.Rows) error {
+		var postID int
+		var option api.PollOption
+		if err := rows.Scan(&postID, &option.ID, &option.Text, &option.Votes); err != nil {
+			return err
+		}
+		poll := polls[postID]
+		options[option.ID] = len(poll.Options)
+		poll.Options = append(poll.Options, option)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	voters := make(map[int]map[int]bool)
+	err = scanRows(q, dialect.Rebind(`
+		SELECT poll_votes.post_id, poll_votes.option_id, users.id, users.nickname
+		FROM poll_votes
+		JOIN users ON users.id = poll_votes.user_id
+		WHERE poll_votes.`+in+`
+		ORDER BY poll_votes.created_at, poll_votes.option_id`), ids, func(rows *sql.Rows) error {
+		var postID, optionID int
+		var voter api.UserResponse
+		if err := rows.Scan(&postID, &optionID, &voter.ID, &voter.Nickname); err != nil {
+			return err
+		}
+		poll := polls[postID]
+		if voters[postID] == nil {
+			voters[postID] = make(map[int]bool)
+		}
+		if !voters[postID][voter.ID] {
+			voters[postID][voter.ID] = true
+			poll.TotalVoters++
+		}
+		if voter.ID == userID {
+			poll.MyVotes = append(poll.MyVotes, optionID)
+		}
+		if !poll.Anonymous {
+			option := &poll.Options[options[optionID]]
+			option.Voters = append(option.Voters, voter)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return polls, nil
+}
+
+// scanRows runs query and calls scan for every row
+func scanRows(q Queryer, query string, args []interface{}, scan func(*sql.Rows) error) error {
+	rows, err := q.Query(query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		if err := scan(rows); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
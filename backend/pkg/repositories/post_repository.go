@@ -2,19 +2,23 @@ package repositories
 
 import (
 	"database/sql"
-	"log"
 	"project-root/pkg/api"
-	"time"
+	"project-root/pkg/clock"
+	"project-root/pkg/db"
+	"project-root/pkg/markdown"
+	"project-root/pkg/ranking"
+	"strings"
 )
 
 // PostRepository provides access to the post storage.
 type PostRepository struct {
-	DB *sql.DB
+	DB    *db.Pool
+	clock clock.Clock
 }
 
 // NewPostRepository creates a new PostRepository instance.
-func NewPostRepository() *PostRepository {
-	return &PostRepository{DB: dbHandler.MainDB}
+func NewPostRepository(pool *db.Pool, clk clock.Clock) *PostRepository {
+	return &PostRepository{DB: pool, clock: clk}
 }
 
 // GetAllPosts retrieves all posts with pagination, sorting, and optional filtering.
@@ -26,9 +30,12 @@ func (r *PostRepository) GetPosts(page, pageSize int, sortBy, filterType, filter
             users.nickname, 
             posts.title, 
             posts.content, 
+            posts.content_html,
             posts.created_at, 
             posts.amount_of_comments, 
-            posts.rate 
+            posts.rate,
+            posts.upvotes,
+            posts.downvotes 
         FROM posts
         JOIN users ON posts.user_id = users.id
     `
@@ -40,15 +47,13 @@ func (r *PostRepository) GetPosts(page, pageSize int, sortBy, filterType, filter
 			query += " WHERE users.nickname = ?"
 		case "user_id":
 			query += " WHERE posts.user_id = ?"
+		case "category":
+			query += " WHERE posts.id IN (" + PostsInCategory + ")"
 		}
 	}
 
 	// Add sorting to the query
-	if sortBy != "" {
-		query += " ORDER BY " + sortBy
-	} else {
-		query += " ORDER BY posts.created_at DESC"
-	}
+	query += PostOrder(sortBy)
 
 	query += " LIMIT ? OFFSET ?"
 
@@ -58,14 +63,16 @@ func (r *PostRepository) GetPosts(page, pageSize int, sortBy, filterType, filter
 		countQuery += " JOIN users ON posts.user_id = users.id WHERE users.nickname = ?"
 	} else if filterType == "user_id" && filterValue != "" {
 		countQuery += " WHERE posts.user_id = ?"
+	} else if filterType == "category" && filterValue != "" {
+		countQuery += " WHERE posts.id IN (" + PostsInCategory + ")"
 	}
 
 	var totalItems int
 	var err error
 	if filterType != "" && filterValue != "" {
-		err = dbHandler.MainDB.QueryRow(countQuery, filterValue).Scan(&totalItems)
+		err = r.DB.QueryRow(countQuery, filterValue).Scan(&totalItems)
 	} else {
-		err = dbHandler.MainDB.QueryRow(countQuery).Scan(&totalItems)
+		err = r.DB.QueryRow(countQuery).Scan(&totalItems)
 	}
 	if err != nil {
 		return nil, 0, 0, err
@@ -79,9 +86,9 @@ func (r *PostRepository) GetPosts(page, pageSize int, sortBy, filterType, filter
 	// Execute the query with the pagination and filter parameters
 	var rows *sql.Rows
 	if filterType != "" && filterValue != "" {
-		rows, err = dbHandler.MainDB.Query(query, filterValue, pageSize, (page-1)*pageSize)
+		rows, err = r.DB.Query(query, filterValue, pageSize, (page-1)*pageSize)
 	} else {
-		rows, err = dbHandler.MainDB.Query(query, pageSize, (page-1)*pageSize)
+		rows, err = r.DB.Query(query, pageSize, (page-1)*pageSize)
 	}
 	if err != nil {
 		return nil, 0, 0, err
@@ -91,21 +98,149 @@ func (r *PostRepository) GetPosts(page, pageSize int, sortBy, filterType, filter
 	var posts []api.Post
 	for rows.Next() {
 		var post api.Post
-		if err := rows.Scan(&post.ID, &post.UserID, &post.Nickname, &post.Title, &post.Content, &post.CreatedAt, &post.AmountOfComments, &post.Rate.Rate); err != nil {
+		if err := rows.Scan(&post.ID, &post.UserID, &post.Nickname, &post.Title, &post.Content, &post.ContentHTML, &post.CreatedAt, &post.AmountOfComments, &post.Rate.Rate, &post.Rate.Upvotes, &post.Rate.Downvotes); err != nil {
 			return nil, 0, 0, err
 		}
+		posts = append(posts, post)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, 0, err
+	}
+	rows.Close()
 
-		categories, err := r.GetCategoriesByPostID(post.ID)
-		if err != nil {
+	// Categories are loaded after the rows are closed so that a small read pool cannot deadlock
+	if err := LoadPostCategories(r.DB, db.SQLite, posts); err != nil {
+		return nil, 0, 0, err
+	}
+	if err := LoadPostMentions(r.DB, db.SQLite, posts); err != nil {
+		return nil, 0, 0, err
+	}
+	if err := LoadPostAttachments(r.DB, db.SQLite, posts); err != nil {
+		return nil, 0, 0, err
+	}
+
+	return posts, totalItems, totalPages, nil
+}
+
+// PostsInCategory selects the IDs of the posts filed under the category with
+// the bound name
+const PostsInCategory = `
+	SELECT post_categories.post_id
+	FROM post_categories
+	JOIN categories ON categories.id = post_categories.category_id
+	WHERE categories.name = ?`
+
+// FeedFilter limits posts to those written by users or filed under categories
+// that the user with the two bound IDs follows. Both lookups are indexed
+// semi-joins, so the feed stays cheap however many sources a user follows.
+const FeedFilter = `
+	WHERE (posts.user_id IN (SELECT followee_id FROM user_follows WHERE follower_id = ?)
+	   OR posts.id IN (
+		SELECT post_categories.post_id
+		FROM post_categories
+		JOIN category_follows ON category_follows.category_id = post_categories.category_id
+		WHERE category_follows.user_id = ?))`
+
+// PostOrder returns the ORDER BY clause for posts in the order of sortBy,
+// newest first when it is empty. Ties are broken by the post ID in the same
+// direction, so that paging through posts of equal score neither repeats nor
+// skips any of them.
+func PostOrder(sortBy string) string {
+	if sortBy == "" {
+		sortBy = "posts.created_at DESC"
+	}
+	direction := "DESC"
+	if strings.HasSuffix(strings.ToUpper(sortBy), " ASC") {
+		direction = "ASC"
+	}
+	return " ORDER BY " + sortBy + ", posts.id " + direction
+}
+
+// FeedPage returns the clauses that follow FeedFilter to select a page of
+// the feed in the order of sortBy, with their arguments. Ties are broken by
+// the post ID so that pages never overlap. When after is not zero the page
+// starts after the post with that ID, seeking on the sort column and the
+// post ID instead of skipping rows with OFFSET, so deep pages cost as much as
+// the first one and new posts do not shift them. Orders that are not a
+// single posts column fall back to page.
+func FeedPage(sortBy string, page, pageSize, after int) (string, []interface{}) {
+	fields := strings.Fields(sortBy)
+	if len(fields) != 2 || !strings.HasPrefix(fields[0], "posts.") || strings.ContainsAny(fields[0], "()") {
+		return PostOrder(sortBy) + " LIMIT ? OFFSET ?", []interface{}{pageSize, (page - 1) * pageSize}
+	}
+	column, direction := fields[0], strings.ToUpper(fields[1])
+	seek := ">"
+	if direction == "DESC" {
+		seek = "<"
+	}
+	orderBy := " ORDER BY " + column + " " + direction + ", posts.id " + direction + " LIMIT ?"
+	if after == 0 {
+		return orderBy + " OFFSET ?", []interface{}{pageSize, (page - 1) * pageSize}
+	}
+	previous := "previous." + strings.TrimPrefix(column, "posts.")
+	return " AND (" + column + ", posts.id) " + seek + " (SELECT " + previous + ", previous.id FROM posts previous WHERE previous.id = ?)" + orderBy,
+		[]interface{}{after, pageSize}
+}
+
+// GetFeed retrieves the posts from the users and categories the user follows
+func (r *PostRepository) GetFeed(userID, page, pageSize int, sortBy string, after int) ([]api.Post, int, int, error) {
+	if sortBy == "" {
+		sortBy = "posts.created_at DESC"
+	}
+
+	var totalItems int
+	if err := r.DB.QueryRow("SELECT COUNT(*) FROM posts"+FeedFilter, userID, userID).Scan(&totalItems); err != nil {
+		return nil, 0, 0, err
+	}
+	totalPages := totalItems / pageSize
+	if totalItems%pageSize != 0 {
+		totalPages++
+	}
+
+	clauses, pageArgs := FeedPage(sortBy, page, pageSize, after)
+	rows, err := r.DB.Query(`
+        SELECT
+            posts.id,
+            posts.user_id,
+            users.nickname,
+            posts.title,
+            posts.content,
+            posts.content_html,
+            posts.created_at,
+            posts.amount_of_comments,
+            posts.rate,
+            posts.upvotes,
+            posts.downvotes
+        FROM posts
+        JOIN users ON posts.user_id = users.id`+FeedFilter+clauses,
+		append([]interface{}{userID, userID}, pageArgs...)...)
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	defer rows.Close()
+
+	var posts []api.Post
+	for rows.Next() {
+		var post api.Post
+		if err := rows.Scan(&post.ID, &post.UserID, &post.Nickname, &post.Title, &post.Content, &post.ContentHTML, &post.CreatedAt, &post.AmountOfComments, &post.Rate.Rate, &post.Rate.Upvotes, &post.Rate.Downvotes); err != nil {
 			return nil, 0, 0, err
 		}
-		post.Categories = categories
-
 		posts = append(posts, post)
 	}
 	if err := rows.Err(); err != nil {
 		return nil, 0, 0, err
 	}
+	rows.Close()
+
+	if err := LoadPostCategories(r.DB, db.SQLite, posts); err != nil {
+		return nil, 0, 0, err
+	}
+	if err := LoadPostMentions(r.DB, db.SQLite, posts); err != nil {
+		return nil, 0, 0, err
+	}
+	if err := LoadPostAttachments(r.DB, db.SQLite, posts); err != nil {
+		return nil, 0, 0, err
+	}
 
 	return posts, totalItems, totalPages, nil
 }
@@ -113,20 +248,23 @@ func (r *PostRepository) GetPosts(page, pageSize int, sortBy, filterType, filter
 // GetPostByID retrieves a post by its ID.
 func (r *PostRepository) GetPostByID(postID int, userIdAuth int) (*api.Post, error) {
 	var post api.Post
-	err := dbHandler.MainDB.QueryRow(`
+	err := r.DB.QueryRow(`
         SELECT 
             posts.id, 
             posts.user_id, 
             users.nickname, 
             posts.title, 
             posts.content, 
+            posts.content_html,
             posts.created_at, 
             posts.amount_of_comments, 
-            posts.rate 
+            posts.rate,
+            posts.upvotes,
+            posts.downvotes 
         FROM posts
         JOIN users ON posts.user_id = users.id
         WHERE posts.id = ?`, postID).Scan(
-		&post.ID, &post.UserID, &post.Nickname, &post.Title, &post.Content, &post.CreatedAt, &post.AmountOfComments, &post.Rate.Rate)
+		&post.ID, &post.UserID, &post.Nickname, &post.Title, &post.Content, &post.ContentHTML, &post.CreatedAt, &post.AmountOfComments, &post.Rate.Rate, &post.Rate.Upvotes, &post.Rate.Downvotes)
 	if err != nil {
 		return nil, err
 	}
@@ -137,14 +275,31 @@ func (r *PostRepository) GetPostByID(postID int, userIdAuth int) (*api.Post, err
 	}
 	post.Categories = categories
 
+	mentions, err := LoadMentions(r.DB, db.SQLite, "post_id", []int{post.ID})
+	if err != nil {
+		return nil, err
+	}
+	post.Mentions = mentions[post.ID]
+
+	attachments, err := LoadAttachments(r.DB, db.SQLite, "post_id", []int{post.ID})
+	if err != nil {
+		return nil, err
+	}
+	post.Attachments = attachments[post.ID]
+
 	// If userIdAuth is provided and not zero, fetch rate status
 	if userIdAuth != 0 {
-		status, err := getRateStatus("post", post.ID, userIdAuth)
+		status, err := getRateStatus(r.DB, "post", post.ID, userIdAuth)
 		if err != nil && err != sql.ErrNoRows {
-			log.Printf("error retrieving rate status: %v", err)
 			return nil, err
 		}
 		post.Rate.Status = status
+
+		bookmarked, err := LoadBookmarkedPosts(r.DB, db.SQLite, userIdAuth, []int{post.ID})
+		if err != nil {
+			return nil, err
+		}
+		post.Bookmarked = bookmarked[post.ID]
 	}
 
 	return &post, nil
@@ -152,96 +307,171 @@ func (r *PostRepository) GetPostByID(postID int, userIdAuth int) (*api.Post, err
 
 // GetCategoriesByPostID retrieves categories for a given post ID.
 func (r *PostRepository) GetCategoriesByPostID(postID int) ([]api.Category, error) {
-	query := `
-        SELECT 
-            categories.id, 
-            categories.name 
-        FROM categories
-        JOIN post_categories ON categories.id = post_categories.category_id
-        WHERE post_categories.post_id = ?
-    `
-	rows, err := dbHandler.MainDB.Query(query, postID)
+	categories, err := LoadCategories(r.DB, db.SQLite, []int{postID})
 	if err != nil {
 		return nil, err
 	}
-	defer rows.Close()
-
-	var categories []api.Category
-	for rows.Next() {
-		var category api.Category
-		if err := rows.Scan(&category.ID, &category.Name); err != nil {
-			return nil, err
-		}
-		categories = append(categories, category)
-	}
-	return categories, nil
+	return categories[postID], nil
 }
 
 // Create inserts a new post into the database.
-func (r *PostRepository) Create(post *api.PostCreateRequest) error {
-	stmt, err := dbHandler.MainDB.Prepare("INSERT INTO posts (user_id, title, content, created_at) VALUES (?, ?, ?, ?)")
+func (r *PostRepository) Create(post *api.PostCreateRequest, categories []string) error {
+	if post.CreatedAt.IsZero() {
+		post.CreatedAt = r.clock.Now()
+	}
+
+	tx, err := r.DB.Begin()
 	if err != nil {
 		return err
 	}
-	post.CreatedAt = time.Now()
+	defer tx.Rollback()
+
+	if err := CreatePost(tx, db.SQLite, post, categories); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
 
-	result, err := stmt.Exec(post.UserID, post.Title, post.Content, post.CreatedAt)
+// CreatePost stores a new post inside tx, links its categories and records
+// a PostCreatedEvent
+func CreatePost(tx *sql.Tx, dialect db.Dialect, post *api.PostCreateRequest, categories []string) error {
+	if err := InsertPost(tx, dialect, post); err != nil {
+		return err
+	}
+	if err := LinkPostCategories(tx, dialect, post.ID, categories); err != nil {
+		return err
+	}
+	author, err := LoadUserResponse(tx, dialect, post.UserID)
 	if err != nil {
 		return err
 	}
-	id, err := result.LastInsertId()
+	return RecordEvent(tx, dialect, api.PostCreatedEvent{
+		PostID:     post.ID,
+		Author:     author,
+		Title:      post.Title,
+		Content:    post.Content,
+		Categories: categories,
+		Mentions:   post.Mentions,
+		CreatedAt:  post.CreatedAt,
+	}, post.CreatedAt)
+}
+
+// InsertPost stores a new post inside tx together with its mentions,
+// attachments and poll, and sets its ID. CreatePost also links its categories.
+func InsertPost(tx *sql.Tx, dialect db.Dialect, post *api.PostCreateRequest) error {
+	err := tx.QueryRow(dialect.Rebind("INSERT INTO posts (user_id, title, content, content_html, created_at, hot) VALUES (?, ?, ?, ?, ?, ?) RETURNING id"),
+		post.UserID, post.Title, post.Content, markdown.Render(post.Content), post.CreatedAt, ranking.Hot(0, 0, post.CreatedAt)).Scan(&post.ID)
 	if err != nil {
 		return err
 	}
-	post.ID = int(id)
-	IncrementCount(int(post.UserID), "posts")
+	if post.Mentions, err = SaveMentions(tx, dialect, ContentTarget{PostID: post.ID}, post.Content); err != nil {
+		return err
+	}
+	if post.Attachments, err = LinkAttachments(tx, dialect, post.UserID, post.AttachmentIDs, ContentTarget{PostID: post.ID}); err != nil {
+		return err
+	}
+	if post.Poll != nil {
+		if err := SavePoll(tx, dialect, post.ID, post.Poll); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
-// AddPostCategories inserts categories for a specific post into the database.
-func (r *PostRepository) AddPostCategories(postID int, categories []string) error {
+// LinkPostCategories links categories to a post inside tx, creating the missing ones
+func LinkPostCategories(tx *sql.Tx, dialect db.Dialect, postID int, categories []string) error {
 	for _, category := range categories {
 		var categoryID int
-		err := dbHandler.MainDB.QueryRow("SELECT id FROM categories WHERE name = ?", category).Scan(&categoryID)
-		if err != nil {
-			if err == sql.ErrNoRows {
-				stmt, err := dbHandler.MainDB.Prepare("INSERT INTO categories (name) VALUES (?)")
-				if err != nil {
-					log.Fatal(err)
-				}
-				result, err := stmt.Exec(category)
-				if err != nil {
-					return err
-				}
-				id, err := result.LastInsertId()
-				if err != nil {
-					return err
-				}
-				categoryID = int(id)
-			} else {
-				return err
-			}
+		err := tx.QueryRow(dialect.Rebind("SELECT id FROM categories WHERE name = ?"), category).Scan(&categoryID)
+		if err == sql.ErrNoRows {
+			err = tx.QueryRow(dialect.Rebind("INSERT INTO categories (name) VALUES (?) RETURNING id"), category).Scan(&categoryID)
 		}
-
-		stmt, err := dbHandler.MainDB.Prepare("INSERT INTO post_categories (post_id, category_id) VALUES (?, ?)")
 		if err != nil {
-			log.Fatal(err)
+			return err
 		}
-		_, err = stmt.Exec(postID, categoryID)
-		if err != nil {
+		if _, err := tx.Exec(dialect.Rebind("INSERT INTO post_categories (post_id, category_id) VALUES (?, ?)"), postID, categoryID); err != nil {
 			return err
 		}
 	}
 	return nil
 }
 
-// UpdatePostAmount updates the amount of comments for a specific post.
-func UpdatePostAmount(postID int) error {
-	log.Println("Updating post amount")
-	stmt, err := dbHandler.MainDB.Prepare("UPDATE posts SET amount_of_comments = amount_of_comments + 1 WHERE id = ?")
+// LoadCategories returns the categories of the posts with ids, keyed by post ID
+func LoadCategories(q Queryer, dialect db.Dialect, ids []int) (map[int][]api.Category, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	args := make([]interface{}, len(ids))
+	for i, id := range ids {
+		args[i] = id
+	}
+	rows, err := q.Query(dialect.Rebind(`
+		SELECT post_categories.post_id, categories.id, categories.name
+		FROM categories
+		JOIN post_categories ON categories.id = post_categories.category_id
+		WHERE post_categories.post_id IN (`+placeholders(len(ids))+`)
+		ORDER BY categories.id`), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	categories := make(map[int][]api.Category)
+	for rows.Next() {
+		var postID int
+		var category api.Category
+		if err := rows.Scan(&postID, &category.ID, &category.Name); err != nil {
+			return nil, err
+		}
+		categories[postID] = append(categories[postID], category)
+	}
+	return categories, rows.Err()
+}
+
+// LoadPostCategories sets the categories of posts
+func LoadPostCategories(q Queryer, dialect db.Dialect, posts []api.Post) error {
+	ids := make([]int, len(posts))
+	for i, post := range posts {
+		ids[i] = post.ID
+	}
+	categories, err := LoadCategories(q, dialect, ids)
 	if err != nil {
 		return err
 	}
-	_, err = stmt.Exec(postID)
-	return err
+	for i := range posts {
+		posts[i].Categories = categories[posts[i].ID]
+	}
+	return nil
+}
+
+// LoadPostMentions sets the mentions of posts
+func LoadPostMentions(q Queryer, dialect db.Dialect, posts []api.Post) error {
+	ids := make([]int, len(posts))
+	for i, post := range posts {
+		ids[i] = post.ID
+	}
+	mentions, err := LoadMentions(q, dialect, "post_id", ids)
+	if err != nil {
+		return err
+	}
+	for i := range posts {
+		posts[i].Mentions = mentions[posts[i].ID]
+	}
+	return nil
+}
+
+// LoadPostAttachments sets the attachments of posts
+func LoadPostAttachments(q Queryer, dialect db.Dialect, posts []api.Post) error {
+	ids := make([]int, len(posts))
+	for i, post := range posts {
+		ids[i] = post.ID
+	}
+	attachments, err := LoadAttachments(q, dialect, "post_id", ids)
+	if err != nil {
+		return err
+	}
+	for i := range posts {
+		posts[i].Attachments = attachments[posts[i].ID]
+	}
+	return nil
 }
@@ -0,0 +1,36 @@
+package postgres
+
+import (
+	"database/sql"
+
+	"project-root/pkg/api"
+	"project-root/pkg/clock"
+	"project-root/pkg/db"
+	"project-root/pkg/repositories"
+)
+
+// Attachments is the PostgreSQL AttachmentStore
+type Attachments struct {
+	DB    *sql.DB
+	clock clock.Clock
+}
+
+// Create records an upload that is not linked to any content yet
+func (r *Attachments) Create(a *api.Attachment) error {
+	if a.CreatedAt.IsZero() {
+		a.CreatedAt = r.clock.Now()
+	}
+	err := r.DB.QueryRow(`
+		INSERT INTO attachments (user_id, file_name, mime_type, size, width, height, blob_key, thumbnail_key, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9) RETURNING id`,
+		a.UserID, a.FileName, a.MimeType, a.Size, a.Width, a.Height, a.BlobKey, a.ThumbnailKey, a.CreatedAt).Scan(&a.ID)
+	if err != nil {
+		return err
+	}
+	repositories.SetAttachmentURLs(a)
+	return nil
+}
+
+func (r *Attachments) GetAttachment(id int) (*api.Attachment, error) {
+	return repositories.GetAttachment(r.DB, db.Postgres, id)
+}
@@ -0,0 +1,175 @@
+package postgres
+
+import (
+	"database/sql"
+
+	"project-root/pkg/api"
+	"project-root/pkg/clock"
+	"project-root/pkg/db"
+	"project-root/pkg/repositories"
+)
+
+// Bookmarks is the PostgreSQL BookmarkStore
+type Bookmarks struct {
+	DB    *sql.DB
+	clock clock.Clock
+}
+
+// GetCollections lists the collections of the user with their item counts, oldest first
+func (r *Bookmarks) GetCollections(userID int) ([]api.BookmarkCollection, error) {
+	rows, err := r.DB.Query(`
+		SELECT bookmark_collections.id, bookmark_collections.name, bookmark_collections.created_at, COUNT(bookmarks.id)
+		FROM bookmark_collections
+		LEFT JOIN bookmarks ON bookmarks.collection_id = bookmark_collections.id
+		WHERE bookmark_collections.user_id = $1
+		GROUP BY bookmark_collections.id
+		ORDER BY bookmark_collections.id`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	collections := []api.BookmarkCollection{}
+	for rows.Next() {
+		var c api.BookmarkCollection
+		if err := rows.Scan(&c.ID, &c.Name, &c.CreatedAt, &c.ItemsCount); err != nil {
+			return nil, err
+		}
+		collections = append(collections, c)
+	}
+	return collections, rows.Err()
+}
+
+// CreateCollection creates an empty collection for the user
+func (r *Bookmarks) CreateCollection(userID int, name string) (*api.BookmarkCollection, error) {
+	collection := api.BookmarkCollection{Name: name, CreatedAt: r.clock.Now()}
+
+	err := r.DB.QueryRow("INSERT INTO bookmark_collections (user_id, name, created_at) VALUES ($1, $2, $3) ON CONFLICT DO NOTHING RETURNING id",
+		userID, name, collection.CreatedAt).Scan(&collection.ID)
+	if err == sql.ErrNoRows {
+		return nil, repositories.ErrCollectionExists
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &collection, nil
+}
+
+// DeleteCollection deletes a collection together with its bookmarks
+func (r *Bookmarks) DeleteCollection(userID, collectionID int) error {
+	result, err := r.DB.Exec("DELETE FROM bookmark_collections WHERE id = $1 AND user_id = $2", collectionID, userID)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return repositories.ErrCollectionNotFound
+	}
+	return nil
+}
+
+// GetBookmarks lists one page of the bookmarks of a collection in their saved order
+func (r *Bookmarks) GetBookmarks(userID, collectionID, page, pageSize int) ([]api.Bookmark, int, int, error) {
+	var totalItems int
+	err := r.DB.QueryRow(`
+		SELECT COUNT(bookmarks.id)
+		FROM bookmark_collections
+		LEFT JOIN bookmarks ON bookmarks.collection_id = bookmark_collections.id
+		WHERE bookmark_collections.id = $1 AND bookmark_collections.user_id = $2
+		GROUP BY bookmark_collections.id`, collectionID, userID).Scan(&totalItems)
+	if err == sql.ErrNoRows {
+		return nil, 0, 0, repositories.ErrCollectionNotFound
+	}
+	if err != nil {
+		return nil, 0, 0, err
+	}
+
+	rows, err := r.DB.Query(db.Postgres.Rebind(repositories.SelectBookmarks+" LIMIT ? OFFSET ?"), collectionID, pageSize, (page-1)*pageSize)
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	defer rows.Close()
+
+	bookmarks, err := repositories.ScanBookmarks(rows, (page-1)*pageSize)
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	return bookmarks, totalItems, totalPages(totalItems, pageSize), nil
+}
+
+// AddBookmark appends a post or comment to the end of a collection and returns the bookmark ID
+func (r *Bookmarks) AddBookmark(userID, collectionID int, req api.BookmarkRequest) (int, error) {
+	tx, err := r.DB.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	// Lock the collection so that concurrent additions do not share a position
+	if _, err := tx.Exec("SELECT id FROM bookmark_collections WHERE id = $1 FOR UPDATE", collectionID); err != nil {
+		return 0, err
+	}
+	if err := repositories.CheckBookmarkTarget(tx, db.Postgres, userID, collectionID, req); err != nil {
+		return 0, err
+	}
+
+	var commentID interface{}
+	if req.CommentID != 0 {
+		commentID = req.CommentID
+	}
+	var id int
+	err = tx.QueryRow(`
+		INSERT INTO bookmarks (collection_id, user_id, post_id, comment_id, position, created_at)
+		VALUES ($1, $2, $3, $4, (SELECT COALESCE(MAX(position), 0) + 1 FROM bookmarks WHERE collection_id = $1), $5)
+		ON CONFLICT DO NOTHING
+		RETURNING id`,
+		collectionID, userID, req.PostID, commentID, r.clock.Now()).Scan(&id)
+	if err == sql.ErrNoRows {
+		return 0, repositories.ErrBookmarkExists
+	}
+	if err != nil {
+		return 0, err
+	}
+	return id, tx.Commit()
+}
+
+// MoveBookmark moves a bookmark to a 1-based position within its collection
+func (r *Bookmarks) MoveBookmark(userID, collectionID, bookmarkID, position int) error {
+	tx, err := r.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("SELECT id FROM bookmark_collections WHERE id = $1 FOR UPDATE", collectionID); err != nil {
+		return err
+	}
+	if err := repositories.MoveBookmark(tx, db.Postgres, userID, collectionID, bookmarkID, position); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// RemoveBookmark removes a bookmark from a collection
+func (r *Bookmarks) RemoveBookmark(userID, collectionID, bookmarkID int) error {
+	result, err := r.DB.Exec("DELETE FROM bookmarks WHERE id = $1 AND collection_id = $2 AND user_id = $3", bookmarkID, collectionID, userID)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return repositories.ErrBookmarkNotFound
+	}
+	return nil
+}
+
+// BookmarkedPosts reports which of the posts the user saved itself in any of their collections
+func (r *Bookmarks) BookmarkedPosts(userID int, postIDs []int) (map[int]bool, error) {
+	return repositories.LoadBookmarkedPosts(r.DB, db.Postgres, userID, postIDs)
+}
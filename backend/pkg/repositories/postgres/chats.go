@@ -0,0 +1,273 @@
+package postgres
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"project-root/pkg/api"
+	"project-root/pkg/clock"
+	"project-root/pkg/db"
+	"project-root/pkg/repositories"
+)
+
+// Chats is the PostgreSQL ChatStore. Messages of every chat share the messages table.
+type Chats struct {
+	DB    *sql.DB
+	clock clock.Clock
+}
+
+// CreateChat returns the chat of the two users, creating it if it does not exist yet
+func (repo *Chats) CreateChat(user1ID, user2ID int) (string, error) {
+	var existingHash string
+	err := repo.DB.QueryRow(`
+		SELECT hash FROM conversations
+		WHERE (user1_id = $1 AND user2_id = $2)
+		   OR (user1_id = $2 AND user2_id = $1)`, user1ID, user2ID).Scan(&existingHash)
+	if err == nil {
+		return existingHash, nil
+	} else if err != sql.ErrNoRows {
+		return "", fmt.Errorf("error checking existing chat: %v", err)
+	}
+
+	tx, err := repo.DB.Begin()
+	if err != nil {
+		return "", fmt.Errorf("error creating conversation: %v", err)
+	}
+	defer tx.Rollback()
+
+	chatHash := repositories.GenerateChatHash(user1ID, user2ID)
+	if _, err := tx.Exec("INSERT INTO conversations (user1_id, user2_id, hash) VALUES ($1, $2, $3)", user1ID, user2ID, chatHash); err != nil {
+		return "", fmt.Errorf("error creating conversation: %v", err)
+	}
+	event := api.ChatCreatedEvent{ChatHash: chatHash, UserIDs: []int{user1ID, user2ID}}
+	if err := repositories.RecordEvent(tx, db.Postgres, event, repo.clock.Now()); err != nil {
+		return "", fmt.Errorf("error creating conversation: %v", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return "", fmt.Errorf("error creating conversation: %v", err)
+	}
+	return chatHash, nil
+}
+
+// GetChatsForUser retrieves all chats of a user
+func (repo *Chats) GetChatsForUser(userID int) ([]api.ChatInfo, error) {
+	rows, err := repo.DB.Query("SELECT hash, user1_id, user2_id FROM conversations WHERE user1_id = $1 OR user2_id = $1", userID)
+	if err != nil {
+		return nil, fmt.Errorf("error querying chats: %v", err)
+	}
+	defer rows.Close()
+
+	var chats []api.ChatInfo
+	for rows.Next() {
+		var chat api.ChatInfo
+		if err := rows.Scan(&chat.ChatHash, &chat.User1ID, &chat.User2ID); err != nil {
+			return nil, fmt.Errorf("error scanning row: %v", err)
+		}
+		chats = append(chats, chat)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rows: %v", err)
+	}
+	return chats, nil
+}
+
+// CheckChatAccess returns repositories.ErrChatNotFound unless the user takes part in the chat
+func (repo *Chats) CheckChatAccess(userID int, chatHash string) (bool, error) {
+	var count int
+	err := repo.DB.QueryRow("SELECT COUNT(*) FROM conversations WHERE hash = $1 AND (user1_id = $2 OR user2_id = $2)", chatHash, userID).Scan(&count)
+	if err != nil {
+		return false, fmt.Errorf("error checking chat access: %v", err)
+	}
+	if count == 0 {
+		return false, repositories.ErrChatNotFound
+	}
+	return true, nil
+}
+
+// GetChatDetails retrieves a chat and its messages if the user takes part in it
+func (repo *Chats) GetChatDetails(userID int, chatHash string) (*api.Chat, error) {
+	var chat api.Chat
+	err := repo.DB.QueryRow("SELECT hash, user1_id, user2_id FROM conversations WHERE hash = $1 AND (user1_id = $2 OR user2_id = $2)", chatHash, userID).Scan(
+		&chat.ChatInfo.ChatHash, &chat.ChatInfo.User1ID, &chat.ChatInfo.User2ID)
+	if err == sql.ErrNoRows {
+		return nil, repositories.ErrChatNotFound
+	} else if err != nil {
+		return nil, fmt.Errorf("error retrieving chat details: %v", err)
+	}
+
+	messages, err := repo.GetMessagesForChat(chatHash)
+	if err != nil {
+		return nil, fmt.Errorf("error retrieving messages: %v", err)
+	}
+	chat.Message = messages
+
+	return &chat, nil
+}
+
+// GetMessagesForChat retrieves all messages of a chat ordered by send time
+func (repo *Chats) GetMessagesForChat(chatHash string) ([]api.MessageMessage, error) {
+	rows, err := repo.DB.Query("SELECT id, sender_id, message_content, sent_at FROM messages WHERE chat_hash = $1 ORDER BY sent_at, id", chatHash)
+	if err != nil {
+		return nil, fmt.Errorf("error querying messages: %v", err)
+	}
+	defer rows.Close()
+
+	var messages []api.MessageMessage
+	var ids []int
+	for rows.Next() {
+		var id int
+		var msg api.MessageMessage
+		var user api.UserResponse
+		if err := rows.Scan(&id, &user.ID, &msg.Message, &msg.SendAt); err != nil {
+			return nil, fmt.Errorf("error scanning row: %v", err)
+		}
+		msg.ID = id
+		msg.Sender = &user
+		msg.RoomHash = chatHash
+		messages = append(messages, msg)
+		ids = append(ids, id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rows: %v", err)
+	}
+	rows.Close()
+
+	mentions, err := repositories.LoadMessageMentions(repo.DB, db.Postgres, chatHash)
+	if err != nil {
+		return nil, fmt.Errorf("error loading mentions: %v", err)
+	}
+	attachments, err := repositories.LoadMessageAttachments(repo.DB, db.Postgres, chatHash)
+	if err != nil {
+		return nil, fmt.Errorf("error loading attachments: %v", err)
+	}
+	for i, id := range ids {
+		messages[i].Mentions = mentions[id]
+		messages[i].Attachments = attachments[id]
+	}
+	return messages, nil
+}
+
+// SaveMessage stores a message in a chat together with its mentions and attachments
+func (repo *Chats) SaveMessage(msg *api.MessageMessage) error {
+	tx, err := repo.DB.Begin()
+	if err != nil {
+		return fmt.Errorf("error saving message: %v", err)
+	}
+	defer tx.Rollback()
+
+	var id int
+	now := repo.clock.Now()
+	err = tx.QueryRow("INSERT INTO messages (chat_hash, sender_id, message_content, sent_at) VALUES ($1, $2, $3, $4) RETURNING id",
+		msg.RoomHash, msg.Sender.ID, msg.Message, now).Scan(&id)
+	if err != nil {
+		return fmt.Errorf("error saving message: %v", err)
+	}
+	target := repositories.ContentTarget{ChatHash: msg.RoomHash, MessageID: id}
+	if msg.Mentions, err = repositories.SaveMentions(tx, db.Postgres, target, msg.Message); err != nil {
+		return fmt.Errorf("error saving mentions: %v", err)
+	}
+	if msg.Attachments, err = repositories.LinkAttachments(tx, db.Postgres, msg.Sender.ID, msg.AttachmentIDs, target); err != nil {
+		return fmt.Errorf("error linking attachments: %w", err)
+	}
+	if err := repositories.RecordMessageSent(tx, db.Postgres, *msg, id, now); err != nil {
+		return fmt.Errorf("error saving message: %v", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error saving message: %v", err)
+	}
+	msg.ID = id
+	return nil
+}
+
+// Tokens is the PostgreSQL TokenStore
+type Tokens struct {
+	DB    *sql.DB
+	clock clock.Clock
+}
+
+// Create stores a new token for the user. Only the hash of the secret is persisted.
+func (r *Tokens) Create(userID int, name, tokenHash string, scopes []string, expiresAt *time.Time) (*api.APIToken, error) {
+	token := api.APIToken{
+		Name:      name,
+		Scopes:    scopes,
+		CreatedAt: r.clock.Now(),
+		ExpiresAt: expiresAt,
+	}
+
+	err := r.DB.QueryRow("INSERT INTO api_tokens (user_id, name, token_hash, scopes, created_at, expires_at) VALUES ($1, $2, $3, $4, $5, $6) RETURNING id",
+		userID, name, tokenHash, strings.Join(scopes, " "), token.CreatedAt, expiresAt).Scan(&token.ID)
+	if err != nil {
+		return nil, err
+	}
+	return &token, nil
+}
+
+// GetTokensForUser retrieves all tokens that belong to the user, newest first
+func (r *Tokens) GetTokensForUser(userID int) ([]api.APIToken, error) {
+	rows, err := r.DB.Query(`
+		SELECT id, name, scopes, created_at, expires_at, last_used_at
+		FROM api_tokens
+		WHERE user_id = $1
+		ORDER BY created_at DESC`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tokens := []api.APIToken{}
+	for rows.Next() {
+		var token api.APIToken
+		var scopes string
+		var expiresAt, lastUsedAt sql.NullTime
+		if err := rows.Scan(&token.ID, &token.Name, &scopes, &token.CreatedAt, &expiresAt, &lastUsedAt); err != nil {
+			return nil, err
+		}
+		token.Scopes = strings.Fields(scopes)
+		if expiresAt.Valid {
+			token.ExpiresAt = &expiresAt.Time
+		}
+		if lastUsedAt.Valid {
+			token.LastUsedAt = &lastUsedAt.Time
+		}
+		tokens = append(tokens, token)
+	}
+	return tokens, rows.Err()
+}
+
+// Delete revokes a token owned by the user
+func (r *Tokens) Delete(userID, tokenID int) error {
+	result, err := r.DB.Exec("DELETE FROM api_tokens WHERE id = $1 AND user_id = $2", tokenID, userID)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return repositories.ErrTokenNotFound
+	}
+	return nil
+}
+
+// GetUserByTokenHash resolves a token hash to its owner and granted scopes.
+// Expired tokens are treated as missing. A successful lookup refreshes last_used_at.
+func (r *Tokens) GetUserByTokenHash(tokenHash string) (*api.User, []string, error) {
+	var user api.User
+	var scopes string
+	err := r.DB.QueryRow(`
+		UPDATE api_tokens t SET last_used_at = $2
+		FROM users u
+		WHERE u.id = t.user_id AND t.token_hash = $1 AND (t.expires_at IS NULL OR t.expires_at > $2)
+		RETURNING u.id, u.nickname, t.scopes
+	`, tokenHash, r.clock.Now()).Scan(&user.ID, &user.Nickname, &scopes)
+	if err == sql.ErrNoRows {
+		return nil, nil, nil
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	return &user, strings.Fields(scopes), nil
+}
@@ -0,0 +1,59 @@
+package postgres
+
+import (
+	"database/sql"
+	"time"
+
+	"project-root/pkg/api"
+	"project-root/pkg/db"
+	"project-root/pkg/repositories"
+)
+
+// Drafts is the PostgreSQL DraftStore
+type Drafts struct {
+	DB *sql.DB
+}
+
+func (r *Drafts) CreateDraft(userID int, req api.DraftRequest, now time.Time) (*api.Draft, error) {
+	return repositories.InsertDraft(r.DB, db.Postgres, userID, req, now)
+}
+
+func (r *Drafts) UpdateDraft(userID, draftID int, req api.DraftRequest, now time.Time) (*api.Draft, error) {
+	return repositories.UpdateDraft(r.DB, db.Postgres, userID, draftID, req, now)
+}
+
+func (r *Drafts) GetDrafts(userID int) ([]api.Draft, error) {
+	return repositories.LoadDrafts(r.DB, db.Postgres, "user_id = ? ORDER BY updated_at DESC, id DESC", userID)
+}
+
+func (r *Drafts) GetDraft(userID, draftID int) (*api.Draft, error) {
+	return repositories.LoadDraft(r.DB, db.Postgres, userID, draftID)
+}
+
+func (r *Drafts) DeleteDraft(userID, draftID int) error {
+	return repositories.DeleteDraft(r.DB, db.Postgres, userID, draftID)
+}
+
+func (r *Drafts) GetDueDrafts(now time.Time) ([]api.Draft, error) {
+	return repositories.LoadDrafts(r.DB, db.Postgres, "publish_at <= ? ORDER BY publish_at, id", now)
+}
+
+func (r *Drafts) UnscheduleDraft(userID, draftID int) error {
+	_, err := r.DB.Exec("UPDATE drafts SET publish_at = NULL WHERE id = $1 AND user_id = $2", draftID, userID)
+	return err
+}
+
+// PublishDraft turns a draft into a post in a single transaction
+func (r *Drafts) PublishDraft(userID, draftID int, now time.Time) (*api.PostCreateRequest, error) {
+	tx, err := r.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	post, err := repositories.PublishDraft(tx, db.Postgres, userID, draftID, now)
+	if err != nil {
+		return nil, err
+	}
+	return post, tx.Commit()
+}
@@ -0,0 +1,140 @@
+package postgres
+
+import (
+	"database/sql"
+
+	"project-root/pkg/api"
+	"project-root/pkg/clock"
+	"project-root/pkg/repositories"
+)
+
+// Follows is the PostgreSQL FollowStore
+type Follows struct {
+	DB    *sql.DB
+	clock clock.Clock
+}
+
+// FollowUser makes follower follow followee. Following twice is not an error.
+func (r *Follows) FollowUser(followerID, followeeID int) error {
+	tx, err := r.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec("INSERT INTO user_follows (follower_id, followee_id, created_at) VALUES ($1, $2, $3) ON CONFLICT DO NOTHING",
+		followerID, followeeID, r.clock.Now())
+	if err != nil {
+		return err
+	}
+	if err := updateFollowCounts(tx, result, followerID, followeeID, 1); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// UnfollowUser stops follower from following followee. Unfollowing twice is not an error.
+func (r *Follows) UnfollowUser(followerID, followeeID int) error {
+	tx, err := r.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec("DELETE FROM user_follows WHERE follower_id = $1 AND followee_id = $2", followerID, followeeID)
+	if err != nil {
+		return err
+	}
+	if err := updateFollowCounts(tx, result, followerID, followeeID, -1); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// updateFollowCounts adjusts the follower and following counts when a follow was actually added or removed
+func updateFollowCounts(tx *sql.Tx, result sql.Result, followerID, followeeID, delta int) error {
+	affected, err := result.RowsAffected()
+	if err != nil || affected == 0 {
+		return err
+	}
+	if _, err := tx.Exec("UPDATE users SET following_count = following_count + $1 WHERE id = $2", delta, followerID); err != nil {
+		return err
+	}
+	_, err = tx.Exec("UPDATE users SET followers_count = followers_count + $1 WHERE id = $2", delta, followeeID)
+	return err
+}
+
+// FollowCategory makes the user follow a category by name
+func (r *Follows) FollowCategory(userID int, category string) error {
+	categoryID, err := r.categoryID(category)
+	if err != nil {
+		return err
+	}
+	_, err = r.DB.Exec("INSERT INTO category_follows (user_id, category_id, created_at) VALUES ($1, $2, $3) ON CONFLICT DO NOTHING",
+		userID, categoryID, r.clock.Now())
+	return err
+}
+
+// UnfollowCategory stops the user from following a category by name
+func (r *Follows) UnfollowCategory(userID int, category string) error {
+	categoryID, err := r.categoryID(category)
+	if err != nil {
+		return err
+	}
+	_, err = r.DB.Exec("DELETE FROM category_follows WHERE user_id = $1 AND category_id = $2", userID, categoryID)
+	return err
+}
+
+func (r *Follows) categoryID(name string) (int, error) {
+	var id int
+	err := r.DB.QueryRow("SELECT id FROM categories WHERE name = $1", name).Scan(&id)
+	if err == sql.ErrNoRows {
+		return 0, repositories.ErrCategoryNotFound
+	}
+	return id, err
+}
+
+// GetFollowing lists the users and categories the user follows, in the order they were followed
+func (r *Follows) GetFollowing(userID int) (*api.FollowingResponse, error) {
+	following := api.FollowingResponse{Users: []api.UserResponse{}, Categories: []api.Category{}}
+
+	rows, err := r.DB.Query(`
+		SELECT users.id, users.nickname
+		FROM user_follows
+		JOIN users ON users.id = user_follows.followee_id
+		WHERE user_follows.follower_id = $1
+		ORDER BY user_follows.created_at`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var user api.UserResponse
+		if err := rows.Scan(&user.ID, &user.Nickname); err != nil {
+			return nil, err
+		}
+		following.Users = append(following.Users, user)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	rows, err = r.DB.Query(`
+		SELECT categories.id, categories.name
+		FROM category_follows
+		JOIN categories ON categories.id = category_follows.category_id
+		WHERE category_follows.user_id = $1
+		ORDER BY category_follows.created_at`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var category api.Category
+		if err := rows.Scan(&category.ID, &category.Name); err != nil {
+			return nil, err
+		}
+		following.Categories = append(following.Categories, category)
+	}
+	return &following, rows.Err()
+}
@@ -0,0 +1,28 @@
+package postgres
+
+import (
+	"database/sql"
+
+	"project-root/pkg/api"
+	"project-root/pkg/db"
+	"project-root/pkg/repositories"
+)
+
+// LinkPreviews is the PostgreSQL LinkPreviewStore
+type LinkPreviews struct {
+	DB *sql.DB
+}
+
+func (r *LinkPreviews) GetLinkPreviews(urls []string) (map[string]api.LinkPreview, error) {
+	return repositories.GetLinkPreviews(r.DB, db.Postgres, urls)
+}
+
+func (r *LinkPreviews) SaveLinkPreview(p api.LinkPreview) error {
+	_, err := r.DB.Exec(`
+		INSERT INTO link_previews (url, title, description, image_url, site_name, fetched_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (url) DO UPDATE SET title = excluded.title, description = excluded.description,
+			image_url = excluded.image_url, site_name = excluded.site_name, fetched_at = excluded.fetched_at`,
+		p.URL, p.Title, p.Description, p.ImageURL, p.SiteName, p.FetchedAt)
+	return err
+}
@@ -0,0 +1,100 @@
+package postgres
+
+import (
+	"database/sql"
+	"log/slog"
+	"time"
+
+	"github.com/lib/pq"
+
+	"project-root/pkg/api"
+	"project-root/pkg/db"
+	"project-root/pkg/repositories"
+)
+
+// Outbox is the PostgreSQL OutboxStore
+type Outbox struct {
+	DB *sql.DB
+}
+
+// ClaimEvents claims events in a transaction whose row locks keep other
+// servers from claiming the same events
+func (r *Outbox) ClaimEvents(now, until time.Time, limit int) ([]api.OutboxEvent, error) {
+	tx, err := r.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	events, err := repositories.ClaimOutboxEvents(tx, db.Postgres, now, until, limit)
+	if err != nil {
+		return nil, err
+	}
+	return events, tx.Commit()
+}
+
+func (r *Outbox) MarkDelivered(id int, subscribers []string, now time.Time) error {
+	return repositories.MarkOutboxEventDelivered(r.DB, db.Postgres, id, subscribers, now)
+}
+
+func (r *Outbox) MarkDispatched(id int, now time.Time) error {
+	return repositories.MarkOutboxEventDispatched(r.DB, db.Postgres, id, now)
+}
+
+func (r *Outbox) EventsAfter(id, limit int) ([]api.OutboxEvent, error) {
+	return repositories.OutboxEventsAfter(r.DB, db.Postgres, id, limit)
+}
+
+func (r *Outbox) LastEventID() (int, error) {
+	return repositories.LastOutboxEventID(r.DB)
+}
+
+func (r *Outbox) PruneEvents(before time.Time) (int, error) {
+	return repositories.PruneOutbox(r.DB, db.Postgres, before)
+}
+
+// listenerPingInterval is how often an idle event listener checks that its
+// connection is still alive
+const listenerPingInterval = 90 * time.Second
+
+// ListenForEvents calls wake whenever a server records an event, until stop
+// is closed. It reconnects on its own when the connection drops and calls
+// wake then too, as the events recorded meanwhile were not announced.
+func ListenForEvents(dsn string, wake func(), logger *slog.Logger, stop <-chan struct{}) {
+	listener := pq.NewListener(dsn, time.Second, time.Minute, func(event pq.ListenerEventType, err error) {
+		if err != nil {
+			logger.Warn("Event listener connection failed", "error", err)
+		}
+	})
+	defer listener.Close()
+	if err := listener.Listen(repositories.OutboxChannel); err != nil {
+		logger.Error("Error listening for events", "error", err)
+		return
+	}
+
+	ticker := time.NewTicker(listenerPingInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-listener.Notify:
+			wake()
+		case <-ticker.C:
+			go listener.Ping()
+		}
+	}
+}
+
+// Counts is the PostgreSQL CountStore
+type Counts struct {
+	DB *sql.DB
+}
+
+func (r *Counts) RecountUser(userID int) error {
+	return repositories.RecountUser(r.DB, db.Postgres, userID)
+}
+
+func (r *Counts) RecountPost(postID int) error {
+	return repositories.RecountPost(r.DB, db.Postgres, postID)
+}
@@ -0,0 +1,47 @@
+package postgres
+
+import (
+	"database/sql"
+	"time"
+
+	"project-root/pkg/api"
+	"project-root/pkg/db"
+	"project-root/pkg/repositories"
+)
+
+// Polls is the PostgreSQL PollStore
+type Polls struct {
+	DB *sql.DB
+}
+
+// Vote replaces the ballot of the user in a single transaction
+func (r *Polls) Vote(postID, userID int, optionIDs []int, now time.Time) error {
+	tx, err := r.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := repositories.CastPollVote(tx, db.Postgres, postID, userID, optionIDs, now); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (r *Polls) WithdrawVote(postID, userID int, now time.Time) (bool, error) {
+	tx, err := r.DB.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	withdrawn, err := repositories.WithdrawPollVote(tx, db.Postgres, postID, userID, now)
+	if err != nil {
+		return false, err
+	}
+	return withdrawn, tx.Commit()
+}
+
+func (r *Polls) GetPolls(postIDs []int, userID int) (map[int]*api.Poll, error) {
+	return repositories.LoadPolls(r.DB, db.Postgres, postIDs, userID)
+}
@@ -0,0 +1,85 @@
+// Package postgres implements the repository stores on PostgreSQL.
+// Queries use $n placeholders, new rows report their IDs with RETURNING and
+// chat messages live in a single messages table keyed by chat hash.
+package postgres
+
+import (
+	"database/sql"
+
+	"project-root/pkg/clock"
+	"project-root/pkg/repositories"
+)
+
+// NewStores creates the PostgreSQL backed stores on top of an opened database
+// that take the current time from clk
+func NewStores(db *sql.DB, clk clock.Clock) repositories.Stores {
+	return repositories.Stores{
+		Users:       &Users{db},
+		Sessions:    &Sessions{db, clk},
+		Posts:       &Posts{db, clk},
+		Comments:    &Comments{db, clk},
+		Rates:       &Rates{db, clk},
+		Follows:     &Follows{db, clk},
+		Bookmarks:   &Bookmarks{db, clk},
+		Chats:       &Chats{db, clk},
+		Attachments: &Attachments{db, clk},
+		Previews:    &LinkPreviews{db},
+		Reactions:   &Reactions{db, clk},
+		Polls:       &Polls{db},
+		Drafts:      &Drafts{db},
+		Webhooks:    &Webhooks{db},
+		Outbox:      &Outbox{db},
+		Counts:      &Counts{db},
+		Tokens:      &Tokens{db, clk},
+	}
+}
+
+// The PostgreSQL stores implement the store interfaces
+var (
+	_ repositories.UserStore        = (*Users)(nil)
+	_ repositories.SessionStore     = (*Sessions)(nil)
+	_ repositories.PostStore        = (*Posts)(nil)
+	_ repositories.CommentStore     = (*Comments)(nil)
+	_ repositories.RateStore        = (*Rates)(nil)
+	_ repositories.FollowStore      = (*Follows)(nil)
+	_ repositories.BookmarkStore    = (*Bookmarks)(nil)
+	_ repositories.ChatStore        = (*Chats)(nil)
+	_ repositories.AttachmentStore  = (*Attachments)(nil)
+	_ repositories.LinkPreviewStore = (*LinkPreviews)(nil)
+	_ repositories.ReactionStore    = (*Reactions)(nil)
+	_ repositories.PollStore        = (*Polls)(nil)
+	_ repositories.DraftStore       = (*Drafts)(nil)
+	_ repositories.WebhookStore     = (*Webhooks)(nil)
+	_ repositories.OutboxStore      = (*Outbox)(nil)
+	_ repositories.CountStore       = (*Counts)(nil)
+	_ repositories.TokenStore       = (*Tokens)(nil)
+)
+
+// getRateStatus returns the vote of a user on a post or comment, or an empty string
+func getRateStatus(db *sql.DB, itemType string, itemID, userID int) (string, error) {
+	var query string
+	switch itemType {
+	case "post":
+		query = "SELECT status FROM rates WHERE user_id = $1 AND post_id = $2 AND comment_id IS NULL"
+	case "comment":
+		query = "SELECT status FROM rates WHERE user_id = $1 AND comment_id = $2"
+	default:
+		return "", nil
+	}
+
+	var status sql.NullString
+	err := db.QueryRow(query, userID, itemID).Scan(&status)
+	if err != nil && err != sql.ErrNoRows {
+		return "", err
+	}
+	return status.String, nil
+}
+
+// totalPages returns the number of pages needed for totalItems
+func totalPages(totalItems, pageSize int) int {
+	pages := totalItems / pageSize
+	if totalItems%pageSize != 0 {
+		pages++
+	}
+	return pages
+}
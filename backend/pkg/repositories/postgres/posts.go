@@ -0,0 +1,424 @@
+package postgres
+
+import (
+	"database/sql"
+	"time"
+
+	"project-root/pkg/api"
+	"project-root/pkg/clock"
+	"project-root/pkg/db"
+	"project-root/pkg/markdown"
+	"project-root/pkg/ranking"
+	"project-root/pkg/repositories"
+)
+
+// Posts is the PostgreSQL PostStore
+type Posts struct {
+	DB    *sql.DB
+	clock clock.Clock
+}
+
+const selectPosts = `
+	SELECT
+		posts.id,
+		posts.user_id,
+		users.nickname,
+		posts.title,
+		posts.content,
+		posts.content_html,
+		posts.created_at,
+		posts.amount_of_comments,
+		posts.rate,
+		posts.upvotes,
+		posts.downvotes
+	FROM posts
+	JOIN users ON posts.user_id = users.id`
+
+// GetPosts retrieves posts with pagination, sorting and optional filtering by nickname or user_id
+func (r *Posts) GetPosts(page, pageSize int, sortBy, filterType, filterValue string) ([]api.Post, int, int, error) {
+	where := ""
+	args := []interface{}{}
+	if filterValue != "" {
+		switch filterType {
+		case "nickname":
+			where = " WHERE users.nickname = $1"
+			args = append(args, filterValue)
+		case "user_id":
+			where = " WHERE posts.user_id = $1"
+			args = append(args, filterValue)
+		case "category":
+			where = db.Postgres.Rebind(" WHERE posts.id IN (" + repositories.PostsInCategory + ")")
+			args = append(args, filterValue)
+		}
+	}
+
+	var totalItems int
+	if err := r.DB.QueryRow("SELECT COUNT(*) FROM posts JOIN users ON posts.user_id = users.id"+where, args...).Scan(&totalItems); err != nil {
+		return nil, 0, 0, err
+	}
+
+	query := selectPosts + where + repositories.PostOrder(sortBy)
+	if len(args) > 0 {
+		query += " LIMIT $2 OFFSET $3"
+	} else {
+		query += " LIMIT $1 OFFSET $2"
+	}
+	args = append(args, pageSize, (page-1)*pageSize)
+
+	rows, err := r.DB.Query(query, args...)
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	defer rows.Close()
+
+	var posts []api.Post
+	for rows.Next() {
+		var post api.Post
+		if err := rows.Scan(&post.ID, &post.UserID, &post.Nickname, &post.Title, &post.Content, &post.ContentHTML, &post.CreatedAt, &post.AmountOfComments, &post.Rate.Rate, &post.Rate.Upvotes, &post.Rate.Downvotes); err != nil {
+			return nil, 0, 0, err
+		}
+		posts = append(posts, post)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, 0, err
+	}
+	rows.Close()
+
+	// Categories are loaded after the rows are closed so the connection is free again
+	if err := repositories.LoadPostCategories(r.DB, db.Postgres, posts); err != nil {
+		return nil, 0, 0, err
+	}
+	if err := repositories.LoadPostMentions(r.DB, db.Postgres, posts); err != nil {
+		return nil, 0, 0, err
+	}
+	if err := repositories.LoadPostAttachments(r.DB, db.Postgres, posts); err != nil {
+		return nil, 0, 0, err
+	}
+
+	return posts, totalItems, totalPages(totalItems, pageSize), nil
+}
+
+// GetFeed retrieves the posts from the users and categories the user follows
+func (r *Posts) GetFeed(userID, page, pageSize int, sortBy string, after int) ([]api.Post, int, int, error) {
+	if sortBy == "" {
+		sortBy = "posts.created_at DESC"
+	}
+
+	var totalItems int
+	if err := r.DB.QueryRow(db.Postgres.Rebind("SELECT COUNT(*) FROM posts"+repositories.FeedFilter), userID, userID).Scan(&totalItems); err != nil {
+		return nil, 0, 0, err
+	}
+
+	clauses, pageArgs := repositories.FeedPage(sortBy, page, pageSize, after)
+	rows, err := r.DB.Query(db.Postgres.Rebind(selectPosts+repositories.FeedFilter+clauses), append([]interface{}{userID, userID}, pageArgs...)...)
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	defer rows.Close()
+
+	var posts []api.Post
+	for rows.Next() {
+		var post api.Post
+		if err := rows.Scan(&post.ID, &post.UserID, &post.Nickname, &post.Title, &post.Content, &post.ContentHTML, &post.CreatedAt, &post.AmountOfComments, &post.Rate.Rate, &post.Rate.Upvotes, &post.Rate.Downvotes); err != nil {
+			return nil, 0, 0, err
+		}
+		posts = append(posts, post)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, 0, err
+	}
+	rows.Close()
+
+	if err := repositories.LoadPostCategories(r.DB, db.Postgres, posts); err != nil {
+		return nil, 0, 0, err
+	}
+	if err := repositories.LoadPostMentions(r.DB, db.Postgres, posts); err != nil {
+		return nil, 0, 0, err
+	}
+	if err := repositories.LoadPostAttachments(r.DB, db.Postgres, posts); err != nil {
+		return nil, 0, 0, err
+	}
+
+	return posts, totalItems, totalPages(totalItems, pageSize), nil
+}
+
+// GetPostByID retrieves a post with the vote of userIdAuth when it is not zero
+func (r *Posts) GetPostByID(postID int, userIdAuth int) (*api.Post, error) {
+	var post api.Post
+	err := r.DB.QueryRow(selectPosts+" WHERE posts.id = $1", postID).Scan(
+		&post.ID, &post.UserID, &post.Nickname, &post.Title, &post.Content, &post.ContentHTML, &post.CreatedAt, &post.AmountOfComments, &post.Rate.Rate, &post.Rate.Upvotes, &post.Rate.Downvotes)
+	if err != nil {
+		return nil, err
+	}
+
+	categories, err := r.GetCategoriesByPostID(post.ID)
+	if err != nil {
+		return nil, err
+	}
+	post.Categories = categories
+
+	mentions, err := repositories.LoadMentions(r.DB, db.Postgres, "post_id", []int{post.ID})
+	if err != nil {
+		return nil, err
+	}
+	post.Mentions = mentions[post.ID]
+
+	attachments, err := repositories.LoadAttachments(r.DB, db.Postgres, "post_id", []int{post.ID})
+	if err != nil {
+		return nil, err
+	}
+	post.Attachments = attachments[post.ID]
+
+	if userIdAuth != 0 {
+		status, err := getRateStatus(r.DB, "post", post.ID, userIdAuth)
+		if err != nil {
+			return nil, err
+		}
+		post.Rate.Status = status
+
+		bookmarked, err := repositories.LoadBookmarkedPosts(r.DB, db.Postgres, userIdAuth, []int{post.ID})
+		if err != nil {
+			return nil, err
+		}
+		post.Bookmarked = bookmarked[post.ID]
+	}
+
+	return &post, nil
+}
+
+// GetCategoriesByPostID retrieves the categories of a post
+func (r *Posts) GetCategoriesByPostID(postID int) ([]api.Category, error) {
+	categories, err := repositories.LoadCategories(r.DB, db.Postgres, []int{postID})
+	if err != nil {
+		return nil, err
+	}
+	return categories[postID], nil
+}
+
+// Create inserts a new post with its categories
+func (r *Posts) Create(post *api.PostCreateRequest, categories []string) error {
+	if post.CreatedAt.IsZero() {
+		post.CreatedAt = r.clock.Now()
+	}
+
+	tx, err := r.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := repositories.CreatePost(tx, db.Postgres, post, categories); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Comments is the PostgreSQL CommentStore
+type Comments struct {
+	DB    *sql.DB
+	clock clock.Clock
+}
+
+// Create inserts a new comment
+func (r *Comments) Create(c *api.CommentCreateRequest) error {
+	if c.CreatedAt.IsZero() {
+		c.CreatedAt = r.clock.Now()
+	}
+
+	tx, err := r.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	c.ContentHTML = markdown.Render(c.Content)
+	err = tx.QueryRow("INSERT INTO comments (post_id, user_id, content, content_html, created_at, hot) VALUES ($1, $2, $3, $4, $5, $6) RETURNING id",
+		c.PostID, c.UserID, c.Content, c.ContentHTML, c.CreatedAt, ranking.Hot(0, 0, c.CreatedAt)).Scan(&c.ID)
+	if err != nil {
+		return err
+	}
+	if c.Mentions, err = repositories.SaveMentions(tx, db.Postgres, repositories.ContentTarget{CommentID: c.ID}, c.Content); err != nil {
+		return err
+	}
+	if c.Attachments, err = repositories.LinkAttachments(tx, db.Postgres, c.UserID, c.AttachmentIDs, repositories.ContentTarget{CommentID: c.ID}); err != nil {
+		return err
+	}
+	if err := repositories.RecordCommentCreated(tx, db.Postgres, c); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// GetComments retrieves comments filtered by userID, nickname or, by default, post ID
+func (r *Comments) GetComments(page, pageSize int, sortBy, filterType string, filterValue interface{}, userIdAuth int) (*[]api.Comment, int, int, error) {
+	var where string
+	switch filterType {
+	case "userID":
+		where = " WHERE comments.user_id = $1"
+	case "nickname":
+		where = " WHERE users.nickname = $1"
+	default:
+		where = " WHERE comments.post_id = $1"
+	}
+
+	var totalItems int
+	err := r.DB.QueryRow("SELECT COUNT(*) FROM comments JOIN users ON comments.user_id = users.id"+where, filterValue).Scan(&totalItems)
+	if err != nil {
+		return nil, 0, 0, err
+	}
+
+	if sortBy == "" {
+		sortBy = "comments.created_at DESC"
+	}
+	query := `
+		SELECT
+			comments.id,
+			comments.post_id,
+			comments.user_id,
+			users.nickname,
+			comments.content,
+			comments.content_html,
+			comments.created_at,
+			comments.rate,
+			comments.upvotes,
+			comments.downvotes
+		FROM comments
+		JOIN users ON comments.user_id = users.id` + where + " ORDER BY " + sortBy + " LIMIT $2 OFFSET $3"
+
+	rows, err := r.DB.Query(query, filterValue, pageSize, (page-1)*pageSize)
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	defer rows.Close()
+
+	var comments []api.Comment
+	for rows.Next() {
+		var comment api.Comment
+		if err := rows.Scan(&comment.ID, &comment.PostID, &comment.UserID, &comment.Nickname, &comment.Content, &comment.ContentHTML, &comment.CreatedAt, &comment.Rate.Rate, &comment.Rate.Upvotes, &comment.Rate.Downvotes); err != nil {
+			return nil, 0, 0, err
+		}
+		comments = append(comments, comment)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, 0, err
+	}
+	rows.Close()
+
+	if userIdAuth != 0 {
+		for i := range comments {
+			status, err := getRateStatus(r.DB, "comment", comments[i].ID, userIdAuth)
+			if err != nil {
+				return nil, 0, 0, err
+			}
+			comments[i].Rate.Status = status
+		}
+	}
+	if err := repositories.LoadCommentMentions(r.DB, db.Postgres, comments); err != nil {
+		return nil, 0, 0, err
+	}
+	if err := repositories.LoadCommentAttachments(r.DB, db.Postgres, comments); err != nil {
+		return nil, 0, 0, err
+	}
+
+	return &comments, totalItems, totalPages(totalItems, pageSize), nil
+}
+
+// Rates is the PostgreSQL RateStore
+type Rates struct {
+	DB    *sql.DB
+	clock clock.Clock
+}
+
+// UpdateRate applies a vote of the user in a single transaction and returns the
+// new totals of the target together with the user's resulting vote
+func (r *Rates) UpdateRate(userID int, req api.RateRequest) (api.Rate, error) {
+	target, column, itemID, match := "posts", "post_id", req.PostID, "id = $1"
+	voteFilter := " AND comment_id IS NULL"
+	targetArgs := []interface{}{req.PostID}
+	if req.CommentID != 0 {
+		target, column, itemID, match = "comments", "comment_id", req.CommentID, "id = $1 AND post_id = $2"
+		voteFilter = ""
+		targetArgs = []interface{}{req.CommentID, req.PostID}
+	}
+
+	tx, err := r.DB.Begin()
+	if err != nil {
+		return api.Rate{}, err
+	}
+	defer tx.Rollback()
+
+	// Locking the target row serializes concurrent votes on it
+	var createdAt time.Time
+	var top [len(ranking.Periods)]int
+	dest := []interface{}{&createdAt}
+	for i := range top {
+		dest = append(dest, &top[i])
+	}
+	if err := tx.QueryRow("SELECT created_at, "+repositories.TopColumns+" FROM "+target+" WHERE "+match+" FOR UPDATE", targetArgs...).Scan(dest...); err != nil {
+		if err == sql.ErrNoRows {
+			return api.Rate{}, repositories.ErrRateTargetNotFound
+		}
+		return api.Rate{}, err
+	}
+
+	var existingStatus string
+	var existingAt time.Time
+	err = tx.QueryRow("SELECT status, rated_at FROM rates WHERE user_id = $1 AND "+column+" = $2"+voteFilter, userID, itemID).Scan(&existingStatus, &existingAt)
+	if err != nil && err != sql.ErrNoRows {
+		return api.Rate{}, err
+	}
+
+	now := r.clock.Now()
+	newStatus, upDelta, downDelta := repositories.VoteChange(existingStatus, req.Status)
+	switch {
+	case newStatus == "":
+		_, err = tx.Exec("DELETE FROM rates WHERE user_id = $1 AND "+column+" = $2"+voteFilter, userID, itemID)
+	case existingStatus == "":
+		_, err = tx.Exec("INSERT INTO rates (user_id, "+column+", status, rated_at) VALUES ($1, $2, $3, $4)", userID, itemID, newStatus, now)
+	default:
+		_, err = tx.Exec("UPDATE rates SET status = $1, rated_at = $2 WHERE user_id = $3 AND "+column+" = $4"+voteFilter, newStatus, now, userID, itemID)
+	}
+	if err != nil {
+		return api.Rate{}, err
+	}
+
+	rate := api.Rate{Status: newStatus}
+	err = tx.QueryRow("UPDATE "+target+" SET upvotes = upvotes + $1, downvotes = downvotes + $2, rate = rate + $3 WHERE id = $4 RETURNING rate, upvotes, downvotes",
+		upDelta, downDelta, upDelta-downDelta, itemID).Scan(&rate.Rate, &rate.Upvotes, &rate.Downvotes)
+	if err != nil {
+		return api.Rate{}, err
+	}
+
+	for i, delta := range ranking.TopDeltas(existingStatus, existingAt, newStatus, now) {
+		top[i] += delta
+	}
+	scores := ranking.Compute(rate.Upvotes, rate.Downvotes, top, createdAt, now)
+	if err := repositories.SaveScores(tx, db.Postgres, target, itemID, scores); err != nil {
+		return api.Rate{}, err
+	}
+	if err := repositories.RecordRateChanged(tx, db.Postgres, userID, req, rate, now); err != nil {
+		return api.Rate{}, err
+	}
+
+	return rate, tx.Commit()
+}
+
+// RefreshRankings recomputes the ranking scores of all posts and comments as of now
+func (r *Rates) RefreshRankings(now time.Time) (int, error) {
+	return repositories.RefreshRankings(r.DB, r.DB.Begin, db.Postgres, now)
+}
+
+// Reconcile recomputes the vote totals of all posts and comments from the votes
+func (r *Rates) Reconcile() (int, error) {
+	tx, err := r.DB.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	fixed, err := repositories.ReconcileVotes(tx)
+	if err != nil {
+		return 0, err
+	}
+	return fixed, tx.Commit()
+}
@@ -0,0 +1,62 @@
+package postgres
+
+import (
+	"database/sql"
+
+	"project-root/pkg/api"
+	"project-root/pkg/clock"
+	"project-root/pkg/db"
+	"project-root/pkg/repositories"
+)
+
+// Reactions is the PostgreSQL ReactionStore
+type Reactions struct {
+	DB    *sql.DB
+	clock clock.Clock
+}
+
+// AddReaction adds an emoji of the user to the target of req
+func (r *Reactions) AddReaction(userID int, req api.ReactionRequest) (bool, error) {
+	tx, err := r.DB.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	target, err := repositories.CheckReactionTarget(tx, db.Postgres, userID, req)
+	if err != nil {
+		return false, err
+	}
+	if target.ChatHash != "" {
+		var exists int
+		err := tx.QueryRow("SELECT 1 FROM messages WHERE id = $1 AND chat_hash = $2", target.MessageID, target.ChatHash).Scan(&exists)
+		if err == sql.ErrNoRows {
+			return false, repositories.ErrReactionTargetNotFound
+		}
+		if err != nil {
+			return false, err
+		}
+	}
+
+	added, err := repositories.InsertReaction(tx, db.Postgres, userID, target, req.Emoji, r.clock.Now())
+	if err != nil {
+		return false, err
+	}
+	return added, tx.Commit()
+}
+
+func (r *Reactions) RemoveReaction(userID int, req api.ReactionRequest) (bool, error) {
+	return repositories.DeleteReaction(r.DB, db.Postgres, userID, req)
+}
+
+func (r *Reactions) GetPostReactions(postIDs []int, userID int) (map[int][]api.Reaction, error) {
+	return repositories.LoadReactions(r.DB, db.Postgres, "post_id", postIDs, userID)
+}
+
+func (r *Reactions) GetCommentReactions(commentIDs []int, userID int) (map[int][]api.Reaction, error) {
+	return repositories.LoadReactions(r.DB, db.Postgres, "comment_id", commentIDs, userID)
+}
+
+func (r *Reactions) GetMessageReactions(chatHash string, userID int) (map[int][]api.Reaction, error) {
+	return repositories.LoadMessageReactions(r.DB, db.Postgres, chatHash, userID)
+}
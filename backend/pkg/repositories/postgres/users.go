@@ -0,0 +1,171 @@
+package postgres
+
+import (
+	"database/sql"
+
+	"project-root/pkg/api"
+	"project-root/pkg/clock"
+	"project-root/pkg/db"
+	"project-root/pkg/repositories"
+)
+
+// Users is the PostgreSQL UserStore
+type Users struct {
+	DB *sql.DB
+}
+
+// GetAllUsers retrieves a page of users, optionally leaving one user out
+func (r *Users) GetAllUsers(page, pageSize int, sortBy string, excludeID int) ([]api.Users, int, int, error) {
+	where := ""
+	args := []interface{}{}
+	if excludeID != 0 {
+		where = " WHERE users.id != $1"
+		args = append(args, excludeID)
+	}
+
+	var totalUsers int
+	if err := r.DB.QueryRow("SELECT COUNT(*) FROM users"+where, args...).Scan(&totalUsers); err != nil {
+		return nil, 0, 0, err
+	}
+
+	if sortBy == "" {
+		sortBy = "LOWER(users.nickname) ASC"
+	}
+	query := "SELECT users.id, users.nickname FROM users" + where + " ORDER BY " + sortBy
+	if excludeID != 0 {
+		query += " LIMIT $2 OFFSET $3"
+	} else {
+		query += " LIMIT $1 OFFSET $2"
+	}
+	args = append(args, pageSize, (page-1)*pageSize)
+
+	rows, err := r.DB.Query(query, args...)
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	defer rows.Close()
+
+	users := []api.Users{}
+	for rows.Next() {
+		var user api.Users
+		if err := rows.Scan(&user.ID, &user.Nickname); err != nil {
+			return nil, 0, 0, err
+		}
+		users = append(users, user)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, 0, err
+	}
+
+	return users, totalUsers, totalPages(totalUsers, pageSize), nil
+}
+
+// CreateUser creates a new user and returns a UserResponse
+func (r *Users) CreateUser(u *api.RegistrationRequest) (*api.UserResponse, error) {
+	tx, err := r.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var newUser api.UserResponse
+	err = tx.QueryRow(`
+		INSERT INTO users (nickname, age, gender, first_name, last_name, email, password_hash, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		RETURNING id, nickname`,
+		u.Nickname, u.Age, u.Gender, u.FirstName, u.LastName, u.Email, u.Password, u.CreatedAt).Scan(&newUser.ID, &newUser.Nickname)
+	if err != nil {
+		return nil, err
+	}
+	if err := repositories.RecordEvent(tx, db.Postgres, api.UserRegisteredEvent{User: newUser, CreatedAt: u.CreatedAt}, u.CreatedAt); err != nil {
+		return nil, err
+	}
+	return &newUser, tx.Commit()
+}
+
+// ChekUserByEmail retrieves the login credentials of a user by email
+func (r *Users) ChekUserByEmail(email string) (*api.LoginRequest, *api.UserResponse, error) {
+	var user api.LoginRequest
+	var userD api.UserResponse
+	err := r.DB.QueryRow("SELECT email, password_hash, id, nickname FROM users WHERE email = $1", email).Scan(
+		&user.Email, &user.Password, &userD.ID, &userD.Nickname)
+	if err != nil {
+		return nil, nil, err
+	}
+	return &user, &userD, nil
+}
+
+// GetUserByNickname retrieves a user by nickname
+func (r *Users) GetUserByNickname(nickname string) (*api.User, error) {
+	var user api.User
+	err := r.DB.QueryRow("SELECT id, nickname, first_name, last_name, created_at, amount_of_posts, amount_of_comments, followers_count, following_count FROM users WHERE nickname = $1", nickname).Scan(
+		&user.ID, &user.Nickname, &user.FirstName, &user.LastName, &user.CreatedAt, &user.AmountOfPosts, &user.AmountOfComments, &user.FollowersCount, &user.FollowingCount)
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// GetUserByID retrieves a user by ID
+func (r *Users) GetUserByID(userID int) (api.UserResponse, error) {
+	var user api.UserResponse
+	err := r.DB.QueryRow("SELECT id, nickname FROM users WHERE id = $1", userID).Scan(&user.ID, &user.Nickname)
+	if err != nil {
+		return api.UserResponse{}, err
+	}
+	return user, nil
+}
+
+// AutocompleteUsers lists up to limit users whose nicknames start with prefix, ignoring case, shortest first
+func (r *Users) AutocompleteUsers(prefix string, limit int) ([]api.UserResponse, error) {
+	rows, err := r.DB.Query(`SELECT id, nickname FROM users WHERE nickname ILIKE $1 ESCAPE '\' ORDER BY LENGTH(nickname), nickname LIMIT $2`,
+		repositories.LikePrefix(prefix), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	return repositories.ScanUserResponses(rows)
+}
+
+// Sessions is the PostgreSQL SessionStore
+type Sessions struct {
+	DB    *sql.DB
+	clock clock.Clock
+}
+
+// CreateSession stores a new login session
+func (r *Sessions) CreateSession(s *api.Session) error {
+	_, err := r.DB.Exec("INSERT INTO active_sessions (user_id, session_id, created_at, expires_at, last_activity) VALUES ($1, $2, $3, $4, $5)",
+		s.UserID, s.SessionID, s.CreatedAt, s.ExpiresAt, s.LastActivity)
+	return err
+}
+
+// UpdateLastActivity updates the last activity timestamp for a session
+func (r *Sessions) UpdateLastActivity(sessionID string) error {
+	_, err := r.DB.Exec("UPDATE active_sessions SET last_activity = $1 WHERE session_id = $2", r.clock.Now(), sessionID)
+	return err
+}
+
+// DeleteSession deletes a session
+func (r *Sessions) DeleteSession(sessionID string) error {
+	_, err := r.DB.Exec("DELETE FROM active_sessions WHERE session_id = $1", sessionID)
+	return err
+}
+
+// GetUserBySessionID retrieves the user that owns a session, or nil if there is none
+func (r *Sessions) GetUserBySessionID(sessionID string) (*api.User, error) {
+	var user api.User
+	err := r.DB.QueryRow(`
+		SELECT u.id, u.nickname
+		FROM users u
+		INNER JOIN active_sessions s ON u.id = s.user_id
+		WHERE s.session_id = $1
+	`, sessionID).Scan(&user.ID, &user.Nickname)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
@@ -0,0 +1,67 @@
+package postgres
+
+import (
+	"database/sql"
+	"time"
+
+	"project-root/pkg/api"
+	"project-root/pkg/db"
+	"project-root/pkg/repositories"
+)
+
+// Webhooks is the PostgreSQL WebhookStore
+type Webhooks struct {
+	DB *sql.DB
+}
+
+func (r *Webhooks) CreateWebhook(w *api.Webhook) error {
+	return repositories.InsertWebhook(r.DB, db.Postgres, w)
+}
+
+func (r *Webhooks) UpdateWebhook(w api.Webhook) error {
+	return repositories.UpdateWebhook(r.DB, db.Postgres, w)
+}
+
+func (r *Webhooks) GetWebhooks() ([]api.Webhook, error) {
+	return repositories.LoadWebhooks(r.DB, db.Postgres, "TRUE ORDER BY id")
+}
+
+func (r *Webhooks) GetWebhook(id int) (*api.Webhook, error) {
+	return repositories.LoadWebhook(r.DB, db.Postgres, id)
+}
+
+func (r *Webhooks) DeleteWebhook(id int) error {
+	return repositories.DeleteWebhook(r.DB, db.Postgres, id)
+}
+
+func (r *Webhooks) EnqueueDeliveries(event string, payload []byte, now time.Time) (int, error) {
+	return repositories.EnqueueWebhookDeliveries(r.DB, db.Postgres, event, payload, now)
+}
+
+// ClaimDueDeliveries claims deliveries in a transaction whose row locks keep
+// other servers from claiming the same deliveries
+func (r *Webhooks) ClaimDueDeliveries(now, until time.Time, limit int) ([]api.WebhookDelivery, error) {
+	tx, err := r.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	deliveries, err := repositories.ClaimWebhookDeliveries(tx, db.Postgres, now, until, limit)
+	if err != nil {
+		return nil, err
+	}
+	return deliveries, tx.Commit()
+}
+
+func (r *Webhooks) SaveDeliveryResult(d api.WebhookDelivery) error {
+	return repositories.SaveWebhookDeliveryResult(r.DB, db.Postgres, d)
+}
+
+func (r *Webhooks) GetDeliveries(webhookID, page, pageSize int) ([]api.WebhookDelivery, int, int, error) {
+	return repositories.LoadWebhookDeliveries(r.DB, db.Postgres, webhookID, page, pageSize)
+}
+
+func (r *Webhooks) RedeliverDelivery(webhookID, deliveryID int, now time.Time) (*api.WebhookDelivery, error) {
+	return repositories.RedeliverWebhookDelivery(r.DB, db.Postgres, webhookID, deliveryID, now)
+}
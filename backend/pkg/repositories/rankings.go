@@ -0,0 +1,193 @@
+package repositories
+
+import (
+	"database/sql"
+	"strings"
+	"time"
+
+	"project-root/pkg/db"
+	"project-root/pkg/ranking"
+)
+
+// TopColumns lists the columns of the top ranking in the order of ranking.Periods
+var TopColumns = func() string {
+	columns := make([]string, len(ranking.Periods))
+	for i, p := range ranking.Periods {
+		columns[i] = p.Column()
+	}
+	return strings.Join(columns, ", ")
+}()
+
+// scoreAssignments sets all ranking columns in the order of the SaveScores arguments
+var scoreAssignments = "hot = ?, controversy = ?, rising = ?, " + strings.ReplaceAll(TopColumns, ",", " = ?,") + " = ?"
+
+// SaveScores stores the ranking scores of a post or comment inside tx
+func SaveScores(tx *sql.Tx, dialect db.Dialect, table string, id int, s ranking.Scores) error {
+	args := []interface{}{s.Hot, s.Controversy, s.Rising}
+	for _, top := range s.Top {
+		args = append(args, top)
+	}
+	args = append(args, id)
+
+	_, err := tx.Exec(dialect.Rebind("UPDATE "+table+" SET "+scoreAssignments+" WHERE id = ?"), args...)
+	return err
+}
+
+// rankingBatchSize is how many posts or comments RefreshRankings reads and
+// saves at a time
+const rankingBatchSize = 500
+
+// unchangedGuard matches a row only while its votes and top counts are the
+// ones read, in the order of the scoredRow.guardArgs arguments
+var unchangedGuard = " AND upvotes = ? AND downvotes = ? AND " + strings.ReplaceAll(TopColumns, ",", " = ? AND") + " = ?"
+
+// RefreshRankings recomputes the ranking scores of all posts and comments.
+// Votes move out of the top windows and targets age, so the scores kept up to
+// date by voting drift until they are refreshed. The rows and their votes are
+// read through q in batches of rankingBatchSize, outside any transaction, and
+// only the changed scores of a batch are saved, in a short transaction begun
+// by begin, so that votes wait for a batch at most. Rows voted on since they
+// were read keep the scores saved by the vote. It returns how many rows changed.
+func RefreshRankings(q Queryer, begin func() (*sql.Tx, error), dialect db.Dialect, now time.Time) (int, error) {
+	refreshed := 0
+	for _, target := range []struct {
+		table, voteColumn, voteFilter string
+	}{{"posts", "post_id", " AND comment_id IS NULL"}, {"comments", "comment_id", ""}} {
+		for afterID := 0; ; {
+			rows, err := scoredRows(q, dialect, target.table, afterID)
+			if err != nil {
+				return 0, err
+			}
+			if len(rows) == 0 {
+				break
+			}
+			lastID := rows[len(rows)-1].id
+			tops, err := tallyVotes(q, dialect, target.voteColumn, target.voteFilter, afterID, lastID, now)
+			if err != nil {
+				return 0, err
+			}
+			saved, err := saveChangedScores(begin, dialect, target.table, rows, tops, now)
+			if err != nil {
+				return 0, err
+			}
+			refreshed += saved
+			afterID = lastID
+		}
+	}
+	return refreshed, nil
+}
+
+// scoredRow is a post or comment with its votes and stored scores
+type scoredRow struct {
+	id                 int
+	createdAt          time.Time
+	upvotes, downvotes int
+	stored             ranking.Scores
+}
+
+// guardArgs are the arguments of unchangedGuard
+func (r scoredRow) guardArgs() []interface{} {
+	args := []interface{}{r.upvotes, r.downvotes}
+	for _, top := range r.stored.Top {
+		args = append(args, top)
+	}
+	return args
+}
+
+// scoredRows reads the next rankingBatchSize rows of table after afterID, by ID
+func scoredRows(q Queryer, dialect db.Dialect, table string, afterID int) ([]scoredRow, error) {
+	rows, err := q.Query(dialect.Rebind("SELECT id, created_at, upvotes, downvotes, hot, controversy, rising, "+TopColumns+" FROM "+table+" WHERE id > ? ORDER BY id LIMIT ?"), afterID, rankingBatchSize)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var batch []scoredRow
+	for rows.Next() {
+		var r scoredRow
+		dest := []interface{}{&r.id, &r.createdAt, &r.upvotes, &r.downvotes, &r.stored.Hot, &r.stored.Controversy, &r.stored.Rising}
+		for i := range r.stored.Top {
+			dest = append(dest, &r.stored.Top[i])
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return nil, err
+		}
+		batch = append(batch, r)
+	}
+	return batch, rows.Err()
+}
+
+// tallyVotes counts the net votes within each period of the targets with IDs
+// in (afterID, lastID]. Timestamps are compared in Go because SQLite stores
+// them as text with the offset of the writer.
+func tallyVotes(q Queryer, dialect db.Dialect, column, filter string, afterID, lastID int, now time.Time) (map[int]*[len(ranking.Periods)]int, error) {
+	rows, err := q.Query(dialect.Rebind("SELECT "+column+", status, rated_at FROM rates WHERE "+column+" > ? AND "+column+" <= ?"+filter), afterID, lastID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tops := make(map[int]*[len(ranking.Periods)]int)
+	for rows.Next() {
+		var id int
+		var status string
+		var ratedAt time.Time
+		if err := rows.Scan(&id, &status, &ratedAt); err != nil {
+			return nil, err
+		}
+		if tops[id] == nil {
+			tops[id] = new([len(ranking.Periods)]int)
+		}
+		ranking.Tally(tops[id], status, ratedAt, now)
+	}
+	return tops, rows.Err()
+}
+
+// saveChangedScores saves the recomputed scores of the rows that differ from
+// the stored ones, unless they were voted on since they were read, and
+// returns how many it saved
+func saveChangedScores(begin func() (*sql.Tx, error), dialect db.Dialect, table string, rows []scoredRow, tops map[int]*[len(ranking.Periods)]int, now time.Time) (int, error) {
+	changed := make(map[int]ranking.Scores)
+	for _, r := range rows {
+		var top [len(ranking.Periods)]int
+		if tops[r.id] != nil {
+			top = *tops[r.id]
+		}
+		if scores := ranking.Compute(r.upvotes, r.downvotes, top, r.createdAt, now); scores != r.stored {
+			changed[r.id] = scores
+		}
+	}
+	if len(changed) == 0 {
+		return 0, nil
+	}
+
+	tx, err := begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	query := dialect.Rebind("UPDATE " + table + " SET " + scoreAssignments + " WHERE id = ?" + unchangedGuard)
+	saved := 0
+	for _, r := range rows {
+		scores, ok := changed[r.id]
+		if !ok {
+			continue
+		}
+		args := []interface{}{scores.Hot, scores.Controversy, scores.Rising}
+		for _, top := range scores.Top {
+			args = append(args, top)
+		}
+		args = append(append(args, r.id), r.guardArgs()...)
+		result, err := tx.Exec(query, args...)
+		if err != nil {
+			return 0, err
+		}
+		affected, err := result.RowsAffected()
+		if err != nil {
+			return 0, err
+		}
+		saved += int(affected)
+	}
+	return saved, tx.Commit()
+}
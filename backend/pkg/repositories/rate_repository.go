@@ -3,132 +3,143 @@ package repositories
 import (
 	"database/sql"
 	"project-root/pkg/api"
+	"project-root/pkg/clock"
+	"project-root/pkg/db"
+	"project-root/pkg/ranking"
 	"time"
 )
 
-type RateableRepository interface {
-	UpdateRateM(delta, postID, commentID int) (int, error)
+// RateRepository provides access to the votes on posts and comments.
+type RateRepository struct {
+	DB    *db.Pool
+	clock clock.Clock
 }
 
-func (p *PostRepository) UpdateRateM(delta, postID, commentID int) (int, error) {
-	_, err := dbHandler.MainDB.Exec("UPDATE posts SET rate = rate + ? WHERE id = ?", delta, postID)
-	if err != nil {
-		return 0, err
-	}
-
-	var newRate int
-	err = dbHandler.MainDB.QueryRow("SELECT rate FROM posts WHERE id = ?", postID).Scan(&newRate)
-	if err != nil {
-		return 0, err
-	}
-
-	return newRate, nil
+// NewRateRepository creates a new RateRepository instance.
+func NewRateRepository(pool *db.Pool, clk clock.Clock) *RateRepository {
+	return &RateRepository{DB: pool, clock: clk}
 }
 
-func (c *CommentRepository) UpdateRateM(delta, postID, commentID int) (int, error) {
-	_, err := dbHandler.MainDB.Exec("UPDATE comments SET rate = rate + ? WHERE id = ? AND post_id = ?", delta, commentID, postID)
-	if err != nil {
-		return 0, err
+// UpdateRate applies a vote of the user in a single transaction and returns the
+// new totals of the target together with the user's resulting vote.
+func (r *RateRepository) UpdateRate(userID int, req api.RateRequest) (api.Rate, error) {
+	// Comment votes are keyed by comment_id, post votes by post_id with no comment
+	target, column, itemID, match := "posts", "post_id", req.PostID, "id = ?"
+	voteFilter := " AND comment_id IS NULL"
+	targetArgs := []interface{}{req.PostID}
+	if req.CommentID != 0 {
+		target, column, itemID, match = "comments", "comment_id", req.CommentID, "id = ? AND post_id = ?"
+		voteFilter = ""
+		targetArgs = []interface{}{req.CommentID, req.PostID}
 	}
 
-	var newRate int
-	err = dbHandler.MainDB.QueryRow("SELECT rate FROM comments WHERE id = ? AND post_id = ?", commentID, postID).Scan(&newRate)
+	// BEGIN IMMEDIATE on the single writer serializes concurrent votes
+	tx, err := r.DB.Begin()
 	if err != nil {
-		return 0, err
+		return api.Rate{}, err
 	}
+	defer tx.Rollback()
 
-	return newRate, nil
-}
-
-func UpdateRate(userID int, req api.RateRequest) (int, string, error) {
-	var rateable RateableRepository
-	var itemType string
-	var searched_id int
-
-	if req.CommentID != 0 {
-		rateable = &CommentRepository{}
-		itemType = "comment_id"
-		searched_id = req.CommentID
-	} else {
-		rateable = &PostRepository{}
-		itemType = "post_id"
-		searched_id = req.PostID
+	var createdAt time.Time
+	var top [len(ranking.Periods)]int
+	dest := []interface{}{&createdAt}
+	for i := range top {
+		dest = append(dest, &top[i])
+	}
+	if err := tx.QueryRow("SELECT created_at, "+TopColumns+" FROM "+target+" WHERE "+match, targetArgs...).Scan(dest...); err != nil {
+		if err == sql.ErrNoRows {
+			return api.Rate{}, ErrRateTargetNotFound
+		}
+		return api.Rate{}, err
 	}
 
 	var existingStatus string
-	query := "SELECT status FROM rates WHERE user_id = ? AND " + itemType + " = ?"
-	err := dbHandler.MainDB.QueryRow(query, userID, searched_id).Scan(&existingStatus)
+	var existingAt time.Time
+	err = tx.QueryRow("SELECT status, rated_at FROM rates WHERE user_id = ? AND "+column+" = ?"+voteFilter, userID, itemID).Scan(&existingStatus, &existingAt)
 	if err != nil && err != sql.ErrNoRows {
-		return 0, "", err
+		return api.Rate{}, err
 	}
 
-	delta := 0
-	newStatus := req.Status
-	var newRate int
+	now := r.clock.Now()
+	newStatus, upDelta, downDelta := VoteChange(existingStatus, req.Status)
 	switch {
-	case existingStatus == req.Status:
-		deleteQuery := "DELETE FROM rates WHERE user_id = ? AND " + itemType + " = ?"
-		_, err = dbHandler.MainDB.Exec(deleteQuery, userID, searched_id)
-		if err != nil {
-			return 0, "", err
-		}
-		if req.Status == "up" {
-			delta = -1
-		} else {
-			delta = 1
-		}
-		newStatus = ""
+	case newStatus == "":
+		_, err = tx.Exec("DELETE FROM rates WHERE user_id = ? AND "+column+" = ?"+voteFilter, userID, itemID)
 	case existingStatus == "":
-		insertQuery := "INSERT INTO rates (user_id, " + itemType + ", status, rated_at) VALUES (?, ?, ?, ?)"
-		_, err = dbHandler.MainDB.Exec(insertQuery, userID, searched_id, req.Status, time.Now())
-		if err != nil {
-			return 0, "", err
-		}
-		if req.Status == "up" {
-			delta = 1
-		} else {
-			delta = -1
-		}
+		_, err = tx.Exec("INSERT INTO rates (user_id, "+column+", status, rated_at) VALUES (?, ?, ?, ?)", userID, itemID, newStatus, now)
 	default:
-		updateQuery := "UPDATE rates SET status = ?, rated_at = ? WHERE user_id = ? AND " + itemType + " = ?"
-		_, err = dbHandler.MainDB.Exec(updateQuery, req.Status, time.Now(), userID, searched_id)
-		if err != nil {
-			return 0, "", err
-		}
-		if req.Status == "up" && existingStatus == "down" {
-			delta = 2
-		} else if req.Status == "down" && existingStatus == "up" {
-			delta = -2
-		}
+		_, err = tx.Exec("UPDATE rates SET status = ?, rated_at = ? WHERE user_id = ? AND "+column+" = ?"+voteFilter, newStatus, now, userID, itemID)
 	}
-	var updateErr error
-	if req.CommentID != 0 {
-		newRate, updateErr = rateable.UpdateRateM(delta, req.PostID, req.CommentID)
-	} else {
-		newRate, updateErr = rateable.UpdateRateM(delta, req.PostID, 0)
+	if err != nil {
+		return api.Rate{}, err
+	}
+
+	rate := api.Rate{Status: newStatus}
+	err = tx.QueryRow("UPDATE "+target+" SET upvotes = upvotes + ?, downvotes = downvotes + ?, rate = rate + ? WHERE id = ? RETURNING rate, upvotes, downvotes",
+		upDelta, downDelta, upDelta-downDelta, itemID).Scan(&rate.Rate, &rate.Upvotes, &rate.Downvotes)
+	if err != nil {
+		return api.Rate{}, err
 	}
 
-	if updateErr != nil {
-		return 0, "", updateErr
+	for i, delta := range ranking.TopDeltas(existingStatus, existingAt, newStatus, now) {
+		top[i] += delta
 	}
+	scores := ranking.Compute(rate.Upvotes, rate.Downvotes, top, createdAt, now)
+	if err := SaveScores(tx, db.SQLite, target, itemID, scores); err != nil {
+		return api.Rate{}, err
+	}
+	if err := RecordRateChanged(tx, db.SQLite, userID, req, rate, now); err != nil {
+		return api.Rate{}, err
+	}
+
+	return rate, tx.Commit()
+}
 
-	return newRate, newStatus, nil
+// RecordRateChanged records a RateChangedEvent for a vote changed inside tx
+func RecordRateChanged(tx *sql.Tx, dialect db.Dialect, userID int, req api.RateRequest, rate api.Rate, now time.Time) error {
+	user, err := LoadUserResponse(tx, dialect, userID)
+	if err != nil {
+		return err
+	}
+	return RecordEvent(tx, dialect, api.RateChangedEvent{PostID: req.PostID, CommentID: req.CommentID, User: user, Rate: rate}, now)
+}
+
+// RefreshRankings recomputes the ranking scores of all posts and comments as
+// of now, reading from the read pool and taking the writer once per batch
+func (r *RateRepository) RefreshRankings(now time.Time) (int, error) {
+	return RefreshRankings(r.DB, r.DB.Begin, db.SQLite, now)
+}
+
+// Reconcile recomputes the vote totals of all posts and comments from the
+// individual votes and returns how many were corrected.
+func (r *RateRepository) Reconcile() (int, error) {
+	tx, err := r.DB.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	fixed, err := ReconcileVotes(tx)
+	if err != nil {
+		return 0, err
+	}
+	return fixed, tx.Commit()
 }
 
-func getRateStatus(itemType string, itemID, userID int) (string, error) {
+func getRateStatus(pool *db.Pool, itemType string, itemID, userID int) (string, error) {
 	var status sql.NullString
 	var query string
 
 	switch itemType {
 	case "post":
-		query = "SELECT status FROM rates WHERE user_id = ? AND post_id = ?"
+		query = "SELECT status FROM rates WHERE user_id = ? AND post_id = ? AND comment_id IS NULL"
 	case "comment":
 		query = "SELECT status FROM rates WHERE user_id = ? AND comment_id = ?"
 	default:
 		return "", nil
 	}
 
-	err := dbHandler.MainDB.QueryRow(query, userID, itemID).Scan(&status)
+	err := pool.QueryRow(query, userID, itemID).Scan(&status)
 	if err != nil && err != sql.ErrNoRows {
 		return "", err
 	}
@@ -0,0 +1,203 @@
+package repositories
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"project-root/pkg/api"
+	"project-root/pkg/clock"
+	"project-root/pkg/db"
+)
+
+// ErrReactionTargetNotFound is returned when reacting to a post, comment or
+// chat message that does not exist, or to a message of a chat the user does
+// not take part in
+var ErrReactionTargetNotFound = errors.New("reaction target not found")
+
+// ReactionRepository provides access to emoji reactions. Reactions to chat
+// messages are kept in the main database, keyed by chat hash and rowid.
+type ReactionRepository struct {
+	DB    *db.Pool
+	MsgDB *db.Pool
+	clock clock.Clock
+}
+
+// NewReactionRepository creates a new ReactionRepository
+func NewReactionRepository(pool, msgPool *db.Pool, clk clock.Clock) *ReactionRepository {
+	return &ReactionRepository{DB: pool, MsgDB: msgPool, clock: clk}
+}
+
+// AddReaction adds an emoji of the user to the target of req
+func (r *ReactionRepository) AddReaction(userID int, req api.ReactionRequest) (bool, error) {
+	tx, err := r.DB.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	target, err := CheckReactionTarget(tx, db.SQLite, userID, req)
+	if err != nil {
+		return false, err
+	}
+	if target.ChatHash != "" {
+		// The hash names an existing chat, so it is safe to use as table name
+		var exists int
+		err := r.MsgDB.QueryRow(fmt.Sprintf(`SELECT 1 FROM "%s" WHERE rowid = ?`, target.ChatHash), target.MessageID).Scan(&exists)
+		if err == sql.ErrNoRows {
+			return false, ErrReactionTargetNotFound
+		}
+		if err != nil {
+			return false, err
+		}
+	}
+
+	added, err := InsertReaction(tx, db.SQLite, userID, target, req.Emoji, r.clock.Now())
+	if err != nil {
+		return false, err
+	}
+	return added, tx.Commit()
+}
+
+func (r *ReactionRepository) RemoveReaction(userID int, req api.ReactionRequest) (bool, error) {
+	return DeleteReaction(r.DB, db.SQLite, userID, req)
+}
+
+func (r *ReactionRepository) GetPostReactions(postIDs []int, userID int) (map[int][]api.Reaction, error) {
+	return LoadReactions(r.DB, db.SQLite, "post_id", postIDs, userID)
+}
+
+func (r *ReactionRepository) GetCommentReactions(commentIDs []int, userID int) (map[int][]api.Reaction, error) {
+	return LoadReactions(r.DB, db.SQLite, "comment_id", commentIDs, userID)
+}
+
+func (r *ReactionRepository) GetMessageReactions(chatHash string, userID int) (map[int][]api.Reaction, error) {
+	return LoadMessageReactions(r.DB, db.SQLite, chatHash, userID)
+}
+
+// ReactionTarget returns the content req reacts to. Reactions to comments
+// name only the comment, like mentions.
+func ReactionTarget(req api.ReactionRequest) ContentTarget {
+	switch {
+	case req.ChatHash != "":
+		return ContentTarget{ChatHash: req.ChatHash, MessageID: req.MessageID}
+	case req.CommentID != 0:
+		return ContentTarget{CommentID: req.CommentID}
+	}
+	return ContentTarget{PostID: req.PostID}
+}
+
+// CheckReactionTarget makes sure inside tx that the post, or the comment
+// under it, exists or that the user takes part in the chat, and returns the
+// target. Whether a chat message exists is left to the caller, as messages
+// may live in another database.
+func CheckReactionTarget(tx *sql.Tx, dialect db.Dialect, userID int, req api.ReactionRequest) (ContentTarget, error) {
+	var exists int
+	var err error
+	switch {
+	case req.ChatHash != "":
+		err = tx.QueryRow(dialect.Rebind("SELECT 1 FROM conversations WHERE hash = ? AND (user1_id = ? OR user2_id = ?)"), req.ChatHash, userID, userID).Scan(&exists)
+	case req.CommentID != 0:
+		err = tx.QueryRow(dialect.Rebind("SELECT 1 FROM comments WHERE id = ? AND post_id = ?"), req.CommentID, req.PostID).Scan(&exists)
+	default:
+		err = tx.QueryRow(dialect.Rebind("SELECT 1 FROM posts WHERE id = ?"), req.PostID).Scan(&exists)
+	}
+	if err == sql.ErrNoRows {
+		return ContentTarget{}, ErrReactionTargetNotFound
+	}
+	if err != nil {
+		return ContentTarget{}, err
+	}
+	return ReactionTarget(req), nil
+}
+
+// InsertReaction stores a reaction of the user to target and reports
+// whether it is new
+func InsertReaction(e Execer, dialect db.Dialect, userID int, target ContentTarget, emoji string, now time.Time) (bool, error) {
+	result, err := e.Exec(dialect.Rebind(`
+		INSERT INTO reactions (user_id, post_id, comment_id, chat_hash, message_id, emoji, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT DO NOTHING`),
+		userID,
+		sql.NullInt64{Int64: int64(target.PostID), Valid: target.PostID != 0},
+		sql.NullInt64{Int64: int64(target.CommentID), Valid: target.CommentID != 0},
+		sql.NullString{String: target.ChatHash, Valid: target.ChatHash != ""},
+		sql.NullInt64{Int64: int64(target.MessageID), Valid: target.ChatHash != ""},
+		emoji, now)
+	if err != nil {
+		return false, err
+	}
+	added, err := result.RowsAffected()
+	return added > 0, err
+}
+
+// DeleteReaction withdraws a reaction of the user and reports whether there was one
+func DeleteReaction(e Execer, dialect db.Dialect, userID int, req api.ReactionRequest) (bool, error) {
+	where, args := reactionTargetCondition(ReactionTarget(req))
+	result, err := e.Exec(dialect.Rebind("DELETE FROM reactions WHERE user_id = ? AND emoji = ? AND "+where),
+		append([]interface{}{userID, req.Emoji}, args...)...)
+	if err != nil {
+		return false, err
+	}
+	removed, err := result.RowsAffected()
+	return removed > 0, err
+}
+
+// LoadReactions returns the reactions to the posts or comments with the given
+// IDs, keyed by ID, flagged for userID; column is "post_id" or "comment_id"
+func LoadReactions(q Queryer, dialect db.Dialect, column string, ids []int, userID int) (map[int][]api.Reaction, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	args := make([]interface{}, len(ids))
+	for i, id := range ids {
+		args[i] = id
+	}
+	return loadReactions(q, dialect, column, userID, "reactions."+column+" IN ("+placeholders(len(ids))+")", args...)
+}
+
+// LoadMessageReactions returns the reactions to the messages of a chat, keyed
+// by message ID, flagged for userID
+func LoadMessageReactions(q Queryer, dialect db.Dialect, chatHash string, userID int) (map[int][]api.Reaction, error) {
+	return loadReactions(q, dialect, "message_id", userID, "reactions.chat_hash = ?", chatHash)
+}
+
+// loadReactions counts the reactions matching where per column and emoji, in
+// the order the emoji were first used
+func loadReactions(q Queryer, dialect db.Dialect, column string, userID int, where string, args ...interface{}) (map[int][]api.Reaction, error) {
+	rows, err := q.Query(dialect.Rebind(`
+		SELECT reactions.`+column+`, reactions.emoji, COUNT(*),
+			MAX(CASE WHEN reactions.user_id = ? THEN 1 ELSE 0 END)
+		FROM reactions
+		WHERE `+where+`
+		GROUP BY reactions.`+column+`, reactions.emoji
+		ORDER BY MIN(reactions.id)`), append([]interface{}{userID}, args...)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	reactions := make(map[int][]api.Reaction)
+	for rows.Next() {
+		var id, mine int
+		var r api.Reaction
+		if err := rows.Scan(&id, &r.Emoji, &r.Count, &mine); err != nil {
+			return nil, err
+		}
+		r.ReactedByMe = mine == 1
+		reactions[id] = append(reactions[id], r)
+	}
+	return reactions, rows.Err()
+}
+
+// reactionTargetCondition matches the reactions to target
+func reactionTargetCondition(target ContentTarget) (string, []interface{}) {
+	switch {
+	case target.ChatHash != "":
+		return "chat_hash = ? AND message_id = ?", []interface{}{target.ChatHash, target.MessageID}
+	case target.CommentID != 0:
+		return "comment_id = ?", []interface{}{target.CommentID}
+	}
+	return "post_id = ?", []interface{}{target.PostID}
+}
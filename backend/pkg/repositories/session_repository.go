@@ -1,43 +1,58 @@
 package repositories
 
 import (
-	"log"
+	"database/sql"
 	"project-root/pkg/api"
-	"time"
+	"project-root/pkg/clock"
+	"project-root/pkg/db"
 )
 
+// SessionRepository provides access to the login session storage.
+type SessionRepository struct {
+	DB    *db.Pool
+	clock clock.Clock
+}
+
+// NewSessionRepository creates a new SessionRepository instance.
+func NewSessionRepository(pool *db.Pool, clk clock.Clock) *SessionRepository {
+	return &SessionRepository{DB: pool, clock: clk}
+}
+
 // CreateSession creates a new session in the database
-func CreateSession(s *api.Session) error {
-	stmt, err := dbHandler.MainDB.Prepare("INSERT INTO active_sessions (user_id, session_id, created_at, expires_at, last_activity) VALUES (?, ?, ?, ?, ?)")
-	if err != nil {
-		log.Fatal(err)
-	}
-	_, err = stmt.Exec(s.UserID, s.SessionID, s.CreatedAt, s.ExpiresAt, s.LastActivity)
-	if err != nil {
-		return err
-	}
-	return nil
+func (r *SessionRepository) CreateSession(s *api.Session) error {
+	_, err := r.DB.Exec("INSERT INTO active_sessions (user_id, session_id, created_at, expires_at, last_activity) VALUES (?, ?, ?, ?, ?)",
+		s.UserID, s.SessionID, s.CreatedAt, s.ExpiresAt, s.LastActivity)
+	return err
 }
 
 // UpdateLastActivity updates the last activity timestamp for a session
-func UpdateLastActivity(sessionID string) error {
-	stmt, err := dbHandler.MainDB.Prepare("UPDATE active_sessions SET last_activity = ? WHERE session_id = ?")
-	if err != nil {
-		return err
-	}
-	_, err = stmt.Exec(time.Now(), sessionID)
+func (r *SessionRepository) UpdateLastActivity(sessionID string) error {
+	_, err := r.DB.Exec("UPDATE active_sessions SET last_activity = ? WHERE session_id = ?", r.clock.Now(), sessionID)
 	return err
 }
 
 // DeleteSession deletes a session from the database
-func DeleteSession(sessionID string) error {
-	stmt, err := dbHandler.MainDB.Prepare("DELETE FROM active_sessions WHERE session_id = ?")
-	if err != nil {
-		return err
-	}
-	_, err = stmt.Exec(sessionID)
+func (r *SessionRepository) DeleteSession(sessionID string) error {
+	_, err := r.DB.Exec("DELETE FROM active_sessions WHERE session_id = ?", sessionID)
+	return err
+}
+
+// GetUserBySessionID retrieves the user that owns a session
+func (r *SessionRepository) GetUserBySessionID(sessionID string) (*api.User, error) {
+	var user api.User
+	err := r.DB.QueryRow(`
+		SELECT u.id, u.nickname 
+		FROM users u
+		INNER JOIN active_sessions s ON u.id = s.user_id
+		WHERE s.session_id = ?
+	`, sessionID).Scan(&user.ID, &user.Nickname)
+
 	if err != nil {
-		return err
+		if err == sql.ErrNoRows {
+			return nil, nil // No user found with the session ID
+		}
+		return nil, err // Other error occurred
 	}
-	return nil
+
+	return &user, nil
 }
@@ -1,10 +0,0 @@
-package repositories
-
-import "project-root/pkg/db"
-
-var dbHandler *db.DBHandler
-
-// SetDBHandler sets the database handler to be used by the repository
-func SetDBHandler(handler *db.DBHandler) {
-	dbHandler = handler
-}
\ No newline at end of file
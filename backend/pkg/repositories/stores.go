@@ -0,0 +1,320 @@
+package repositories
+
+import (
+	"log/slog"
+	"time"
+
+	"project-root/pkg/api"
+	"project-root/pkg/clock"
+	"project-root/pkg/db"
+)
+
+// UserStore provides access to user accounts
+type UserStore interface {
+	GetAllUsers(page, pageSize int, sortBy string, excludeID int) ([]api.Users, int, int, error)
+	// CreateUser stores a new user and records a UserRegisteredEvent
+	CreateUser(u *api.RegistrationRequest) (*api.UserResponse, error)
+	ChekUserByEmail(email string) (*api.LoginRequest, *api.UserResponse, error)
+	GetUserByNickname(nickname string) (*api.User, error)
+	GetUserByID(userID int) (api.UserResponse, error)
+	// AutocompleteUsers lists up to limit users whose nicknames start with prefix, ignoring case
+	AutocompleteUsers(prefix string, limit int) ([]api.UserResponse, error)
+}
+
+// SessionStore provides access to login sessions
+type SessionStore interface {
+	CreateSession(s *api.Session) error
+	GetUserBySessionID(sessionID string) (*api.User, error)
+	UpdateLastActivity(sessionID string) error
+	DeleteSession(sessionID string) error
+}
+
+// PostStore provides access to posts and their categories
+type PostStore interface {
+	// GetPosts filters by filterType "nickname", "user_id" or "category" (a
+	// category name) when filterValue is set
+	GetPosts(page, pageSize int, sortBy, filterType, filterValue string) ([]api.Post, int, int, error)
+	// GetFeed lists the posts of the users and categories that userID follows,
+	// starting after the post with ID after when it is not zero
+	GetFeed(userID, page, pageSize int, sortBy string, after int) ([]api.Post, int, int, error)
+	GetPostByID(postID int, userIdAuth int) (*api.Post, error)
+	GetCategoriesByPostID(postID int) ([]api.Category, error)
+	// Create stores the post with its categories, creating the missing ones,
+	// and sets its ID, the users it mentions and its attachments. It returns
+	// ErrAttachmentNotFound unless every attachment ID names an unlinked
+	// upload of the author. It records a PostCreatedEvent.
+	Create(post *api.PostCreateRequest, categories []string) error
+}
+
+// CommentStore provides access to comments
+type CommentStore interface {
+	// Create stores the comment and sets its ID, HTML, the users it mentions
+	// and its attachments. Attachment IDs are checked like by PostStore.Create.
+	// It records a CommentCreatedEvent.
+	Create(c *api.CommentCreateRequest) error
+	GetComments(page, pageSize int, sortBy, filterType string, filterValue interface{}, userIdAuth int) (*[]api.Comment, int, int, error)
+}
+
+// RateStore provides access to votes on posts and comments
+type RateStore interface {
+	// UpdateRate atomically casts, changes or withdraws a vote, records a
+	// RateChangedEvent and returns the new totals
+	UpdateRate(userID int, req api.RateRequest) (api.Rate, error)
+	// Reconcile recomputes all vote totals from the votes and returns how many were wrong
+	Reconcile() (int, error)
+	// RefreshRankings recomputes the ranking scores as of now and returns how many changed
+	RefreshRankings(now time.Time) (int, error)
+}
+
+// FollowStore provides access to the users and categories users follow
+type FollowStore interface {
+	FollowUser(followerID, followeeID int) error
+	UnfollowUser(followerID, followeeID int) error
+	// FollowCategory and UnfollowCategory return ErrCategoryNotFound for unknown categories
+	FollowCategory(userID int, category string) error
+	UnfollowCategory(userID int, category string) error
+	GetFollowing(userID int) (*api.FollowingResponse, error)
+}
+
+// BookmarkStore provides access to the private bookmark collections of users.
+// Methods on a collection return ErrCollectionNotFound for collections of other users.
+type BookmarkStore interface {
+	GetCollections(userID int) ([]api.BookmarkCollection, error)
+	// CreateCollection returns ErrCollectionExists when the user has a collection of that name
+	CreateCollection(userID int, name string) (*api.BookmarkCollection, error)
+	DeleteCollection(userID, collectionID int) error
+	GetBookmarks(userID, collectionID, page, pageSize int) ([]api.Bookmark, int, int, error)
+	// AddBookmark appends a post or comment to a collection and returns the bookmark ID.
+	// It returns ErrBookmarkTargetNotFound for unknown targets and ErrBookmarkExists for saved ones.
+	AddBookmark(userID, collectionID int, req api.BookmarkRequest) (int, error)
+	// MoveBookmark moves a bookmark to a 1-based position, or last when position is past the end
+	MoveBookmark(userID, collectionID, bookmarkID, position int) error
+	RemoveBookmark(userID, collectionID, bookmarkID int) error
+	// BookmarkedPosts reports which of the posts the user saved itself, for
+	// setting Bookmarked on a whole page at once
+	BookmarkedPosts(userID int, postIDs []int) (map[int]bool, error)
+}
+
+// ChatStore provides access to private conversations and their messages
+type ChatStore interface {
+	// CreateChat returns the chat of the users, creating it and recording a
+	// ChatCreatedEvent when they have none
+	CreateChat(user1ID, user2ID int) (string, error)
+	GetChatsForUser(userID int) ([]api.ChatInfo, error)
+	// CheckChatAccess returns ErrChatNotFound unless the user takes part in the chat
+	CheckChatAccess(userID int, chatHash string) (bool, error)
+	GetChatDetails(userID int, chatHash string) (*api.Chat, error)
+	GetMessagesForChat(chatHash string) ([]api.MessageMessage, error)
+	// SaveMessage stores a message of msg.Sender in msg.RoomHash and sets the
+	// users it mentions and its attachments. Attachment IDs are checked like
+	// by PostStore.Create. It records a MessageSentEvent.
+	SaveMessage(msg *api.MessageMessage) error
+}
+
+// AttachmentStore provides access to the metadata of uploaded files. The
+// files themselves are kept in an attachments.BlobStore.
+type AttachmentStore interface {
+	// Create records an upload of a.UserID that is not linked to any content
+	// yet and sets its ID and URLs
+	Create(a *api.Attachment) error
+	// GetAttachment returns ErrAttachmentNotFound for unknown attachments
+	GetAttachment(id int) (*api.Attachment, error)
+}
+
+// ReactionStore provides access to the emoji reactions to posts, comments and
+// chat messages. A user may react to the same content with several emoji.
+type ReactionStore interface {
+	// AddReaction adds an emoji of the user to a post, to a comment under
+	// req.PostID or to a message of a chat the user takes part in, and
+	// reports whether it is new. It returns ErrReactionTargetNotFound for
+	// unknown targets.
+	AddReaction(userID int, req api.ReactionRequest) (bool, error)
+	// RemoveReaction withdraws an emoji of the user and reports whether the user had reacted with it
+	RemoveReaction(userID int, req api.ReactionRequest) (bool, error)
+	// GetPostReactions, GetCommentReactions and GetMessageReactions return the
+	// reactions keyed by post, comment or message ID, flagged for userID
+	GetPostReactions(postIDs []int, userID int) (map[int][]api.Reaction, error)
+	GetCommentReactions(commentIDs []int, userID int) (map[int][]api.Reaction, error)
+	GetMessageReactions(chatHash string, userID int) (map[int][]api.Reaction, error)
+}
+
+// PollStore provides access to the polls attached to posts. Polls are
+// created with their post by PostStore.Create. A user has one ballot per
+// poll, with several options in multiple choice polls.
+type PollStore interface {
+	// Vote replaces the ballot of the user in the poll of a post. It returns
+	// ErrPollNotFound, ErrPollClosed once the poll closed at now,
+	// ErrPollOptionNotFound for options of other polls and
+	// ErrPollSingleChoice for several options of a single choice poll.
+	Vote(postID, userID int, optionIDs []int, now time.Time) error
+	// WithdrawVote removes the ballot of the user from an open poll and reports whether there was one
+	WithdrawVote(postID, userID int, now time.Time) (bool, error)
+	// GetPolls returns the polls of the posts keyed by post ID, with the votes of userID
+	GetPolls(postIDs []int, userID int) (map[int]*api.Poll, error)
+}
+
+// DraftStore provides access to the drafts of unpublished posts. Drafts are
+// private to their author; other users' drafts are reported as
+// ErrDraftNotFound.
+type DraftStore interface {
+	CreateDraft(userID int, req api.DraftRequest, now time.Time) (*api.Draft, error)
+	UpdateDraft(userID, draftID int, req api.DraftRequest, now time.Time) (*api.Draft, error)
+	// GetDrafts returns the drafts of the user, most recently updated first
+	GetDrafts(userID int) ([]api.Draft, error)
+	GetDraft(userID, draftID int) (*api.Draft, error)
+	DeleteDraft(userID, draftID int) error
+	// GetDueDrafts returns the drafts of all users scheduled at or before now
+	GetDueDrafts(now time.Time) ([]api.Draft, error)
+	// PublishDraft removes the draft and creates its post with its categories
+	// in one step, recording a PostCreatedEvent, dated at the scheduled time once it has passed, else at now.
+	// A draft that was published already returns ErrDraftNotFound, and unknown
+	// attachments ErrAttachmentNotFound, leaving the draft in place.
+	PublishDraft(userID, draftID int, now time.Time) (*api.PostCreateRequest, error)
+	// UnscheduleDraft clears the publishing time of a draft that cannot be published
+	UnscheduleDraft(userID, draftID int) error
+}
+
+// WebhookStore provides access to webhooks and the queue of their deliveries.
+// Webhooks and deliveries that do not exist are reported as ErrWebhookNotFound
+// and ErrWebhookDeliveryNotFound.
+type WebhookStore interface {
+	// CreateWebhook stores the webhook and sets its ID
+	CreateWebhook(w *api.Webhook) error
+	// UpdateWebhook changes the URL, events and state of a webhook
+	UpdateWebhook(w api.Webhook) error
+	GetWebhooks() ([]api.Webhook, error)
+	GetWebhook(id int) (*api.Webhook, error)
+	// DeleteWebhook removes the webhook with its deliveries
+	DeleteWebhook(id int) error
+	// EnqueueDeliveries queues the payload for every active webhook subscribed
+	// to the event, due at now, and returns how many deliveries were queued
+	EnqueueDeliveries(event string, payload []byte, now time.Time) (int, error)
+	// ClaimDueDeliveries returns up to limit pending deliveries due at now and
+	// moves their next attempt to until, so that they are attempted again
+	// should their results never be saved
+	ClaimDueDeliveries(now, until time.Time, limit int) ([]api.WebhookDelivery, error)
+	// SaveDeliveryResult stores the status, attempts, last response, next
+	// attempt and delivery time of d
+	SaveDeliveryResult(d api.WebhookDelivery) error
+	// GetDeliveries returns one page of the deliveries of a webhook, newest first
+	GetDeliveries(webhookID, page, pageSize int) ([]api.WebhookDelivery, int, int, error)
+	// RedeliverDelivery queues a delivery of the webhook again, due at now,
+	// with a fresh series of attempts
+	RedeliverDelivery(webhookID, deliveryID int, now time.Time) (*api.WebhookDelivery, error)
+}
+
+// OutboxStore provides access to the events recorded by the other stores,
+// which wait in the outbox until their subscribers have handled them
+type OutboxStore interface {
+	// ClaimEvents returns up to limit undispatched events available at now,
+	// oldest first, counts the attempt and makes them available again at
+	// until, so that they are handed out again should they never be marked
+	// as dispatched. The events name the subscribers recorded as having
+	// handled them.
+	ClaimEvents(now, until time.Time, limit int) ([]api.OutboxEvent, error)
+	// MarkDelivered records that the subscribers handled an event
+	MarkDelivered(id int, subscribers []string, now time.Time) error
+	// MarkDispatched sets the dispatched time of an event so that it is no
+	// longer claimed
+	MarkDispatched(id int, now time.Time) error
+	// EventsAfter returns up to limit events with an ID above id, whether
+	// dispatched or not, in ID order
+	EventsAfter(id, limit int) ([]api.OutboxEvent, error)
+	// LastEventID returns the highest event ID, 0 when there are no events
+	LastEventID() (int, error)
+	// PruneEvents removes the events dispatched before before and returns how many
+	PruneEvents(before time.Time) (int, error)
+}
+
+// CountStore keeps the post and comment counters of users and posts. The
+// counters are counted afresh, so recounting more often than needed is harmless.
+type CountStore interface {
+	// RecountUser counts the posts and comments of a user
+	RecountUser(userID int) error
+	// RecountPost counts the comments of a post
+	RecountPost(postID int) error
+}
+
+// LinkPreviewStore caches the previews of linked pages by URL
+type LinkPreviewStore interface {
+	// GetLinkPreviews returns the cached previews of urls keyed by URL,
+	// including the empty previews of pages that had no metadata
+	GetLinkPreviews(urls []string) (map[string]api.LinkPreview, error)
+	// SaveLinkPreview stores p, replacing the cached preview of p.URL
+	SaveLinkPreview(p api.LinkPreview) error
+}
+
+// TokenStore provides access to personal access tokens
+type TokenStore interface {
+	Create(userID int, name, tokenHash string, scopes []string, expiresAt *time.Time) (*api.APIToken, error)
+	GetTokensForUser(userID int) ([]api.APIToken, error)
+	Delete(userID, tokenID int) error
+	GetUserByTokenHash(tokenHash string) (*api.User, []string, error)
+}
+
+// Stores bundles every store the application needs
+type Stores struct {
+	Users       UserStore
+	Sessions    SessionStore
+	Posts       PostStore
+	Comments    CommentStore
+	Rates       RateStore
+	Follows     FollowStore
+	Bookmarks   BookmarkStore
+	Chats       ChatStore
+	Attachments AttachmentStore
+	Previews    LinkPreviewStore
+	Reactions   ReactionStore
+	Polls       PollStore
+	Drafts      DraftStore
+	Webhooks    WebhookStore
+	Outbox      OutboxStore
+	Counts      CountStore
+	Tokens      TokenStore
+}
+
+// NewSQLStores creates the SQLite backed stores on top of the opened databases
+// that take the current time from clk. logger reports the errors that the
+// stores cannot return.
+func NewSQLStores(handler *db.DBHandler, clk clock.Clock, logger *slog.Logger) Stores {
+	return Stores{
+		Users:       NewUserRepository(handler.Main),
+		Sessions:    NewSessionRepository(handler.Main, clk),
+		Posts:       NewPostRepository(handler.Main, clk),
+		Comments:    NewCommentRepository(handler.Main, clk),
+		Rates:       NewRateRepository(handler.Main, clk),
+		Follows:     NewFollowRepository(handler.Main, clk),
+		Bookmarks:   NewBookmarkRepository(handler.Main, clk),
+		Chats:       NewChatRepository(handler.Main, handler.Msg, logger, clk),
+		Attachments: NewAttachmentRepository(handler.Main, clk),
+		Previews:    NewLinkPreviewRepository(handler.Main),
+		Reactions:   NewReactionRepository(handler.Main, handler.Msg, clk),
+		Polls:       NewPollRepository(handler.Main),
+		Drafts:      NewDraftRepository(handler.Main),
+		Webhooks:    NewWebhookRepository(handler.Main),
+		Outbox:      NewOutboxRepository(handler.Main),
+		Counts:      NewCountRepository(handler.Main),
+		Tokens:      NewTokenRepository(handler.Main, clk),
+	}
+}
+
+// The SQL repositories implement the store interfaces
+var (
+	_ UserStore        = (*UserRepository)(nil)
+	_ SessionStore     = (*SessionRepository)(nil)
+	_ PostStore        = (*PostRepository)(nil)
+	_ CommentStore     = (*CommentRepository)(nil)
+	_ RateStore        = (*RateRepository)(nil)
+	_ FollowStore      = (*FollowRepository)(nil)
+	_ BookmarkStore    = (*BookmarkRepository)(nil)
+	_ ChatStore        = (*ChatRepository)(nil)
+	_ AttachmentStore  = (*AttachmentRepository)(nil)
+	_ LinkPreviewStore = (*LinkPreviewRepository)(nil)
+	_ ReactionStore    = (*ReactionRepository)(nil)
+	_ PollStore        = (*PollRepository)(nil)
+	_ DraftStore       = (*DraftRepository)(nil)
+	_ WebhookStore     = (*WebhookRepository)(nil)
+	_ OutboxStore      = (*OutboxRepository)(nil)
+	_ CountStore       = (*CountRepository)(nil)
+	_ TokenStore       = (*TokenRepository)(nil)
+)
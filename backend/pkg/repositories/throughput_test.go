@@ -0,0 +1,157 @@
+package repositories_test
+
+import (
+	"database/sql"
+	"io"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"project-root/config"
+	"project-root/pkg/api"
+	"project-root/pkg/clock"
+	"project-root/pkg/db"
+	"project-root/pkg/repositories"
+)
+
+// throughputReaders is the number of goroutines reading while the benchmarks write
+const throughputReaders = 4
+
+// sqliteSetup opens the SQLite databases of the stores one way or another
+type sqliteSetup struct {
+	name string
+	open func(b *testing.B) repositories.Stores
+}
+
+// sqliteSetups are the databases as the server opened them before tuning,
+// with sql.Open and nothing else, and as it opens them now
+var sqliteSetups = []sqliteSetup{
+	{"default", openDefaultSQLite},
+	{"tuned", openTunedSQLite},
+}
+
+// migrateSQLite creates the main and messages databases in a temporary
+// directory and returns the handler that opened them
+func migrateSQLite(b *testing.B) (handler *db.DBHandler, mainPath, msgPath string) {
+	b.Helper()
+	dir := b.TempDir()
+	mainPath, msgPath = dir+"/main.db", dir+"/messages.db"
+	handler = db.NewDBHandler(db.SQLiteOptions{BusyTimeout: 5 * time.Second, ReadPoolSize: 4})
+	if err := handler.InitMainDB(config.DriverSQLite, mainPath, "../db/data/database.sql"); err != nil {
+		b.Fatal(err)
+	}
+	if err := handler.InitMsgDB(msgPath); err != nil {
+		b.Fatal(err)
+	}
+	return handler, mainPath, msgPath
+}
+
+func openTunedSQLite(b *testing.B) repositories.Stores {
+	handler, _, _ := migrateSQLite(b)
+	b.Cleanup(func() { handler.Close() })
+	return repositories.NewSQLStores(handler, clock.System, slog.New(slog.NewTextHandler(io.Discard, nil)))
+}
+
+// openDefaultSQLite opens each database with one handle of default settings
+// in rollback journal mode, used for reads and writes alike
+func openDefaultSQLite(b *testing.B) repositories.Stores {
+	handler, mainPath, msgPath := migrateSQLite(b)
+	if err := handler.Close(); err != nil {
+		b.Fatal(err)
+	}
+
+	open := func(path string) *db.Pool {
+		plain, err := sql.Open("sqlite3", path)
+		if err != nil {
+			b.Fatal(err)
+		}
+		b.Cleanup(func() { plain.Close() })
+		if _, err := plain.Exec("PRAGMA journal_mode=DELETE"); err != nil {
+			b.Fatal(err)
+		}
+		return &db.Pool{Writer: plain, Reader: plain}
+	}
+	handler = &db.DBHandler{Main: open(mainPath), Msg: open(msgPath), Dialect: db.SQLite}
+	return repositories.NewSQLStores(handler, clock.System, slog.New(slog.NewTextHandler(io.Discard, nil)))
+}
+
+// throughput runs write on parallel goroutines while throughputReaders
+// goroutines keep running read, and reports the share of writes that failed
+func throughput(b *testing.B, read func() error, write func() error) {
+	b.Helper()
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	for r := 0; r < throughputReaders; r++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				read()
+			}
+		}()
+	}
+
+	var failed atomic.Int64
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			if write() != nil {
+				failed.Add(1)
+			}
+		}
+	})
+	b.StopTimer()
+	close(done)
+	wg.Wait()
+	b.ReportMetric(float64(failed.Load())/float64(b.N), "failed/op")
+}
+
+// BenchmarkPostCreate creates posts concurrently while readers open a post
+func BenchmarkPostCreate(b *testing.B) {
+	for _, setup := range sqliteSetups {
+		b.Run(setup.name, func(b *testing.B) {
+			s := setup.open(b)
+			authorID := mustUser(b, s, clock.System, "author")
+			postID := mustPost(b, s, clock.System, authorID, "Read while posting", "go")
+
+			throughput(b, func() error {
+				_, err := s.Posts.GetPostByID(postID, authorID)
+				return err
+			}, func() error {
+				post := &api.PostCreateRequest{UserID: authorID, Title: "Benchmark", Content: "Posted while others post", CreatedAt: time.Now()}
+				return s.Posts.Create(post, []string{"go", "benchmarks"})
+			})
+		})
+	}
+}
+
+// BenchmarkSaveMessage saves chat messages concurrently while readers check
+// chat access, as every message sent over a WebSocket does
+func BenchmarkSaveMessage(b *testing.B) {
+	for _, setup := range sqliteSetups {
+		b.Run(setup.name, func(b *testing.B) {
+			s := setup.open(b)
+			aliceID := mustUser(b, s, clock.System, "alice")
+			bobID := mustUser(b, s, clock.System, "bob")
+			hash, err := s.Chats.CreateChat(aliceID, bobID)
+			if err != nil {
+				b.Fatal(err)
+			}
+			sender := &api.UserResponse{ID: aliceID, Nickname: "alice"}
+
+			throughput(b, func() error {
+				_, err := s.Chats.CheckChatAccess(bobID, hash)
+				return err
+			}, func() error {
+				return s.Chats.SaveMessage(&api.MessageMessage{RoomHash: hash, Sender: sender, Message: "Hello @bob", SendAt: time.Now()})
+			})
+		})
+	}
+}
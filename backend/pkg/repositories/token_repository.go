@@ -0,0 +1,129 @@
+package repositories
+
+import (
+	"database/sql"
+	"errors"
+	"project-root/pkg/api"
+	"project-root/pkg/clock"
+	"project-root/pkg/db"
+	"strings"
+	"time"
+)
+
+// ErrTokenNotFound is returned when a token does not exist or belongs to another user.
+var ErrTokenNotFound = errors.New("token not found")
+
+// TokenRepository provides access to the personal access token storage.
+type TokenRepository struct {
+	DB    *db.Pool
+	clock clock.Clock
+}
+
+// NewTokenRepository creates a new TokenRepository instance.
+func NewTokenRepository(pool *db.Pool, clk clock.Clock) *TokenRepository {
+	return &TokenRepository{DB: pool, clock: clk}
+}
+
+// Create stores a new token for the user. Only the hash of the secret is persisted.
+func (r *TokenRepository) Create(userID int, name, tokenHash string, scopes []string, expiresAt *time.Time) (*api.APIToken, error) {
+	token := api.APIToken{
+		Name:      name,
+		Scopes:    scopes,
+		CreatedAt: r.clock.Now(),
+		ExpiresAt: expiresAt,
+	}
+
+	result, err := r.DB.Exec("INSERT INTO api_tokens (user_id, name, token_hash, scopes, created_at, expires_at) VALUES (?, ?, ?, ?, ?, ?)",
+		userID, name, tokenHash, strings.Join(scopes, " "), token.CreatedAt, expiresAt)
+	if err != nil {
+		return nil, err
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+	token.ID = int(id)
+	return &token, nil
+}
+
+// GetTokensForUser retrieves all tokens that belong to the user.
+func (r *TokenRepository) GetTokensForUser(userID int) ([]api.APIToken, error) {
+	rows, err := r.DB.Query(`
+		SELECT id, name, scopes, created_at, expires_at, last_used_at
+		FROM api_tokens
+		WHERE user_id = ?
+		ORDER BY created_at DESC`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tokens := []api.APIToken{}
+	for rows.Next() {
+		var token api.APIToken
+		var scopes string
+		var expiresAt, lastUsedAt sql.NullTime
+		if err := rows.Scan(&token.ID, &token.Name, &scopes, &token.CreatedAt, &expiresAt, &lastUsedAt); err != nil {
+			return nil, err
+		}
+		token.Scopes = strings.Fields(scopes)
+		if expiresAt.Valid {
+			token.ExpiresAt = &expiresAt.Time
+		}
+		if lastUsedAt.Valid {
+			token.LastUsedAt = &lastUsedAt.Time
+		}
+		tokens = append(tokens, token)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return tokens, nil
+}
+
+// Delete revokes a token owned by the user.
+func (r *TokenRepository) Delete(userID, tokenID int) error {
+	result, err := r.DB.Exec("DELETE FROM api_tokens WHERE id = ? AND user_id = ?", tokenID, userID)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrTokenNotFound
+	}
+	return nil
+}
+
+// GetUserByTokenHash resolves a token hash to its owner and granted scopes.
+// Expired tokens are treated as missing. A successful lookup refreshes last_used_at.
+func (r *TokenRepository) GetUserByTokenHash(tokenHash string) (*api.User, []string, error) {
+	var user api.User
+	var tokenID int
+	var scopes string
+	var expiresAt sql.NullTime
+	err := r.DB.QueryRow(`
+		SELECT u.id, u.nickname, t.id, t.scopes, t.expires_at
+		FROM users u
+		INNER JOIN api_tokens t ON u.id = t.user_id
+		WHERE t.token_hash = ?
+	`, tokenHash).Scan(&user.ID, &user.Nickname, &tokenID, &scopes, &expiresAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil, nil
+		}
+		return nil, nil, err
+	}
+
+	if expiresAt.Valid && r.clock.Now().After(expiresAt.Time) {
+		return nil, nil, nil
+	}
+
+	if _, err := r.DB.Exec("UPDATE api_tokens SET last_used_at = ? WHERE id = ?", r.clock.Now(), tokenID); err != nil {
+		return nil, nil, err
+	}
+
+	return &user, strings.Fields(scopes), nil
+}
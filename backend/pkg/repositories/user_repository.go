@@ -3,17 +3,20 @@ package repositories
 import (
 	"database/sql"
 	"project-root/pkg/api"
+	"project-root/pkg/db"
+	"strings"
 )
 
 type UserRepository struct {
-	DB *sql.DB
+	DB *db.Pool
 }
 
-func NewUserRepository() *UserRepository {
-	return &UserRepository{DB: dbHandler.MainDB}
+// NewUserRepository creates a new UserRepository instance.
+func NewUserRepository(pool *db.Pool) *UserRepository {
+	return &UserRepository{DB: pool}
 }
 
-func (u *UserRepository) GetAllUsers(page, pageSize int, sortBy string, excludeID int) ([]api.Users, int, int, error) {
+func (r *UserRepository) GetAllUsers(page, pageSize int, sortBy string, excludeID int) ([]api.Users, int, int, error) {
 	// Define the base query
 	query := `
 		SELECT 
@@ -43,9 +46,9 @@ func (u *UserRepository) GetAllUsers(page, pageSize int, sortBy string, excludeI
 
 	// Execute the query with or without excludeID condition
 	if excludeID != 0 {
-		rows, err = u.DB.Query(query, excludeID, pageSize, offset)
+		rows, err = r.DB.Query(query, excludeID, pageSize, offset)
 	} else {
-		rows, err = u.DB.Query(query, pageSize, offset)
+		rows, err = r.DB.Query(query, pageSize, offset)
 	}
 
 	if err != nil {
@@ -71,9 +74,9 @@ func (u *UserRepository) GetAllUsers(page, pageSize int, sortBy string, excludeI
 
 	var totalUsers int
 	if excludeID != 0 {
-		err = u.DB.QueryRow(countQuery, excludeID).Scan(&totalUsers)
+		err = r.DB.QueryRow(countQuery, excludeID).Scan(&totalUsers)
 	} else {
-		err = u.DB.QueryRow(countQuery).Scan(&totalUsers)
+		err = r.DB.QueryRow(countQuery).Scan(&totalUsers)
 	}
 	if err != nil {
 		return nil, 0, 0, err
@@ -90,35 +93,32 @@ func (u *UserRepository) GetAllUsers(page, pageSize int, sortBy string, excludeI
 
 
 // CreateUser creates a new user in the database and returns a UserResponse
-func CreateUser(u *api.RegistrationRequest) (*api.UserResponse, error) {
-	stmt, err := dbHandler.MainDB.Prepare("INSERT INTO users (nickname, age, gender, first_name, last_name, email, password_hash, created_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?)")
+func (r *UserRepository) CreateUser(u *api.RegistrationRequest) (*api.UserResponse, error) {
+	tx, err := r.DB.Begin()
 	if err != nil {
 		return nil, err
 	}
-	defer stmt.Close()
-	
+	defer tx.Rollback()
 
-	_, err = stmt.Exec(u.Nickname, u.Age, u.Gender, u.FirstName, u.LastName, u.Email, u.Password, u.CreatedAt)
+	var newUser api.UserResponse
+	err = tx.QueryRow("INSERT INTO users (nickname, age, gender, first_name, last_name, email, password_hash, created_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?) RETURNING id, nickname",
+		u.Nickname, u.Age, u.Gender, u.FirstName, u.LastName, u.Email, u.Password, u.CreatedAt).Scan(&newUser.ID, &newUser.Nickname)
 	if err != nil {
 		return nil, err
 	}
-
-	// Fetch the newly created user from the database
-	var newUser api.UserResponse
-	err = dbHandler.MainDB.QueryRow("SELECT id, nickname FROM users WHERE email = ?", u.Email).Scan(&newUser.ID, &newUser.Nickname)
-	if err != nil {
+	if err := RecordEvent(tx, db.SQLite, api.UserRegisteredEvent{User: newUser, CreatedAt: u.CreatedAt}, u.CreatedAt); err != nil {
 		return nil, err
 	}
 
-	return &newUser, nil
+	return &newUser, tx.Commit()
 }
 
 // GetUserByEmail retrieves a user by email from the database
 // ChekUserByEmail retrieves a user by email from the database
-func ChekUserByEmail(email string) (*api.LoginRequest, *api.UserResponse, error) {
+func (r *UserRepository) ChekUserByEmail(email string) (*api.LoginRequest, *api.UserResponse, error) {
 	var user api.LoginRequest
 	var userD api.UserResponse
-	err := dbHandler.MainDB.QueryRow("SELECT email, password_hash, id, nickname FROM users WHERE email = ?", email).Scan(
+	err := r.DB.QueryRow("SELECT email, password_hash, id, nickname FROM users WHERE email = ?", email).Scan(
 		&user.Email, &user.Password, &userD.ID, &userD.Nickname)
 	if err == sql.ErrNoRows {
 		return nil, nil, err
@@ -129,10 +129,10 @@ func ChekUserByEmail(email string) (*api.LoginRequest, *api.UserResponse, error)
 }
 
 // GetUserByNickname retrieves a user by nickname from the database
-func GetUserByNickname(nickname string) (*api.User, error) {
+func (r *UserRepository) GetUserByNickname(nickname string) (*api.User, error) {
 	var user api.User
-	err := dbHandler.MainDB.QueryRow("SELECT id, nickname, first_name, last_name, created_at, amount_of_posts, amount_of_comments FROM users WHERE nickname = ?", nickname).Scan(
-		&user.ID, &user.Nickname, &user.FirstName, &user.LastName, &user.CreatedAt, &user.AmountOfPosts, &user.AmountOfComments)
+	err := r.DB.QueryRow("SELECT id, nickname, first_name, last_name, created_at, amount_of_posts, amount_of_comments, followers_count, following_count FROM users WHERE nickname = ?", nickname).Scan(
+		&user.ID, &user.Nickname, &user.FirstName, &user.LastName, &user.CreatedAt, &user.AmountOfPosts, &user.AmountOfComments, &user.FollowersCount, &user.FollowingCount)
 	if err == sql.ErrNoRows {
 		return nil, err
 	} else if err != nil {
@@ -141,68 +141,42 @@ func GetUserByNickname(nickname string) (*api.User, error) {
 	return &user, nil
 }
 
-func GetUserBySessionID(sessionID string) (*api.User, error) {
-	var user api.User
-	err := dbHandler.MainDB.QueryRow(`
-		SELECT u.id, u.nickname 
-		FROM users u
-		INNER JOIN active_sessions s ON u.id = s.user_id
-		WHERE s.session_id = ?
-	`, sessionID).Scan(&user.ID, &user.Nickname)
-
+func (r *UserRepository) GetUserByID(userID int) (api.UserResponse, error) {
+	var user api.UserResponse
+	err := r.DB.QueryRow("SELECT id, nickname FROM users WHERE id = ?", userID).Scan(&user.ID, &user.Nickname)
 	if err != nil {
-		if err == sql.ErrNoRows {
-			return nil, nil // No user found with the session ID
-		}
-		return nil, err // Other error occurred
+		return api.UserResponse{}, err
 	}
-
-	return &user, nil
+	return user, nil
 }
 
-// // UpdateUser updates user information in the database
-// func UpdateUser(u *api.UpdateUserRequest) error {
-// 	stmt, err := dbHandler.MainDB.Prepare("UPDATE users SET nickname=?, age=?, gender=?, first_name=?, last_name=?, email=? WHERE id=?")
-// 	if err != nil {
-// 		log.Fatal(err)
-// 	}
-// 	defer stmt.Close()
-
-// 	_, err = stmt.Exec(u.Nickname, u.Age, u.Gender, u.FirstName, u.LastName, u.Email, u.ID)
-// 	if err != nil {
-// 		return err
-// 	}
-// 	return nil
-// }
-// // IncrementPostCount increments the post count for a user
-// func IncrementPostCount(userID int) error {
-// 	stmt, err := dbHandler.MainDB.Prepare("UPDATE users SET amount_of_posts = amount_of_posts + 1 WHERE id = ?")
-// 	if err != nil {
-// 		return err
-// 	}
-// 	_, err = stmt.Exec(userID)
-// 	return err
-// }
-
-// IncrementCount increments a specific count (e.g., amount_of_comments) for a user.
-func IncrementCount(userID int, what string) error {
-	// Prepare the SQL statement with a placeholder for the count field
-	what = "amount_of_" + what
-	stmt, err := dbHandler.MainDB.Prepare("UPDATE users SET " + what + " = " + what + " + 1 WHERE id = ?")
+// AutocompleteUsers lists up to limit users whose nicknames start with
+// prefix, shortest first. LIKE ignores the case of ASCII letters in SQLite.
+func (r *UserRepository) AutocompleteUsers(prefix string, limit int) ([]api.UserResponse, error) {
+	rows, err := r.DB.Query(`SELECT id, nickname FROM users WHERE nickname LIKE ? ESCAPE '\' ORDER BY LENGTH(nickname), nickname LIMIT ?`,
+		LikePrefix(prefix), limit)
 	if err != nil {
-		return err
+		return nil, err
 	}
+	defer rows.Close()
+	return ScanUserResponses(rows)
+}
 
-	// Execute the prepared statement with the userID parameter
-	_, err = stmt.Exec(userID)
-	return err
+// LikePrefix turns prefix into a LIKE pattern matching the strings that
+// start with it, with backslash as the escape character
+func LikePrefix(prefix string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(prefix) + "%"
 }
 
-func GetUserByID(userID int) (api.UserResponse, error) {
-	var user api.UserResponse
-	err := dbHandler.MainDB.QueryRow("SELECT id, nickname FROM users WHERE id = ?", userID).Scan(&user.ID, &user.Nickname)
-	if err != nil {
-		return api.UserResponse{}, err
+// ScanUserResponses reads rows of user IDs and nicknames
+func ScanUserResponses(rows *sql.Rows) ([]api.UserResponse, error) {
+	users := []api.UserResponse{}
+	for rows.Next() {
+		var user api.UserResponse
+		if err := rows.Scan(&user.ID, &user.Nickname); err != nil {
+			return nil, err
+		}
+		users = append(users, user)
 	}
-	return user, nil
-}
\ No newline at end of file
+	return users, rows.Err()
+}
@@ -0,0 +1,75 @@
+package repositories
+
+import (
+	"database/sql"
+	"errors"
+)
+
+// ErrRateTargetNotFound is returned when a vote is cast on a post or comment that does not exist.
+var ErrRateTargetNotFound = errors.New("rate target not found")
+
+// VoteChange works out the effect of a user voting requested ("up" or "down")
+// on a target they had voted existing on ("" if they had not voted).
+// Voting the same way twice withdraws the vote. It returns the resulting vote
+// and the changes to the upvote and downvote counts.
+func VoteChange(existing, requested string) (status string, upDelta, downDelta int) {
+	status = requested
+	if existing == requested {
+		status = ""
+	}
+	return status, count(status, "up") - count(existing, "up"), count(status, "down") - count(existing, "down")
+}
+
+func count(status, want string) int {
+	if status == want {
+		return 1
+	}
+	return 0
+}
+
+// reconcileQueries recompute the vote counts of posts and comments from the
+// rates table and fix the totals derived from them. The first statement of
+// each pair reports how many rows were wrong. They take no parameters, so
+// every dialect can run them unchanged.
+var reconcileQueries = [][2]string{
+	{`
+		UPDATE posts SET
+			upvotes = (SELECT COUNT(*) FROM rates WHERE rates.post_id = posts.id AND rates.comment_id IS NULL AND rates.status = 'up'),
+			downvotes = (SELECT COUNT(*) FROM rates WHERE rates.post_id = posts.id AND rates.comment_id IS NULL AND rates.status = 'down')
+		WHERE upvotes != (SELECT COUNT(*) FROM rates WHERE rates.post_id = posts.id AND rates.comment_id IS NULL AND rates.status = 'up')
+		   OR downvotes != (SELECT COUNT(*) FROM rates WHERE rates.post_id = posts.id AND rates.comment_id IS NULL AND rates.status = 'down')
+		   OR rate != upvotes - downvotes`,
+		`UPDATE posts SET rate = upvotes - downvotes WHERE rate != upvotes - downvotes`,
+	},
+	{`
+		UPDATE comments SET
+			upvotes = (SELECT COUNT(*) FROM rates WHERE rates.comment_id = comments.id AND rates.status = 'up'),
+			downvotes = (SELECT COUNT(*) FROM rates WHERE rates.comment_id = comments.id AND rates.status = 'down')
+		WHERE upvotes != (SELECT COUNT(*) FROM rates WHERE rates.comment_id = comments.id AND rates.status = 'up')
+		   OR downvotes != (SELECT COUNT(*) FROM rates WHERE rates.comment_id = comments.id AND rates.status = 'down')
+		   OR rate != upvotes - downvotes`,
+		`UPDATE comments SET rate = upvotes - downvotes WHERE rate != upvotes - downvotes`,
+	},
+}
+
+// ReconcileVotes recomputes all vote totals inside tx and returns how many
+// posts and comments had drifted from their rates.
+func ReconcileVotes(tx *sql.Tx) (int, error) {
+	fixed := 0
+	for _, pair := range reconcileQueries {
+		result, err := tx.Exec(pair[0])
+		if err != nil {
+			return 0, err
+		}
+		affected, err := result.RowsAffected()
+		if err != nil {
+			return 0, err
+		}
+		fixed += int(affected)
+
+		if _, err := tx.Exec(pair[1]); err != nil {
+			return 0, err
+		}
+	}
+	return fixed, nil
+}
@@ -0,0 +1,120 @@
+package repositories_test
+
+import (
+	"database/sql"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"project-root/pkg/api"
+	"project-root/pkg/clock"
+)
+
+// TestConcurrentVotes has voters cast, change and withdraw votes on the same
+// post and comment from several goroutines each, like double clicks and
+// several open tabs do, and checks that the totals match the votes and that
+// no vote was recorded twice
+func TestConcurrentVotes(t *testing.T) {
+	const (
+		voters          = 8
+		clientsPerVoter = 3
+		rounds          = 40
+	)
+	for _, b := range backends(t) {
+		t.Run(b.name, func(t *testing.T) {
+			clk := clock.NewManual(time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC))
+			s, database := b.open(t, clk)
+			authorID := mustUser(t, s, clk, "author")
+			postID := mustPost(t, s, clk, authorID, "Contested", "go")
+			commentID := mustComment(t, s, clk, authorID, postID, "Contested comment")
+			var voterIDs []int
+			for v := 0; v < voters; v++ {
+				voterIDs = append(voterIDs, mustUser(t, s, clk, fmt.Sprintf("voter%d", v)))
+			}
+
+			var wg sync.WaitGroup
+			errs := make(chan error, voters*clientsPerVoter)
+			for v, voterID := range voterIDs {
+				for c := 0; c < clientsPerVoter; c++ {
+					wg.Add(1)
+					go func(voterID, client int) {
+						defer wg.Done()
+						for i := 0; i < rounds; i++ {
+							req := api.RateRequest{PostID: postID, Status: "up"}
+							if (client+i)%3 == 0 {
+								req.Status = "down"
+							}
+							if i%2 == 1 {
+								req.CommentID = commentID
+							}
+							if _, err := s.Rates.UpdateRate(voterID, req); err != nil {
+								errs <- fmt.Errorf("voter %d, client %d, round %d: %w", voterID, client, i, err)
+								return
+							}
+						}
+					}(voterID, v*clientsPerVoter+c)
+				}
+			}
+			wg.Wait()
+			close(errs)
+			for err := range errs {
+				t.Error(err)
+			}
+
+			if fixed, err := s.Rates.Reconcile(); err != nil || fixed != 0 {
+				t.Errorf("Reconcile = %d, %v; want the totals to match the votes", fixed, err)
+			}
+			if database == nil {
+				return
+			}
+
+			checkVoteTotals(t, database, "posts", postID, fmt.Sprintf("post_id = %d AND comment_id IS NULL", postID))
+			checkVoteTotals(t, database, "comments", commentID, fmt.Sprintf("comment_id = %d", commentID))
+			for _, duplicates := range []string{
+				`SELECT COUNT(*) FROM (SELECT user_id FROM rates WHERE comment_id IS NULL GROUP BY user_id, post_id HAVING COUNT(*) > 1) d`,
+				`SELECT COUNT(*) FROM (SELECT user_id FROM rates WHERE comment_id IS NOT NULL GROUP BY user_id, comment_id HAVING COUNT(*) > 1) d`,
+			} {
+				var count int
+				if err := database.QueryRow(duplicates).Scan(&count); err != nil {
+					t.Fatal(err)
+				}
+				if count != 0 {
+					t.Errorf("%d votes were recorded twice: %s", count, duplicates)
+				}
+			}
+
+			// The unique indexes refuse a second vote that bypasses the store
+			for _, req := range []api.RateRequest{{PostID: postID, Status: "up"}, {PostID: postID, CommentID: commentID, Status: "up"}} {
+				if _, err := s.Rates.UpdateRate(authorID, req); err != nil {
+					t.Fatal(err)
+				}
+			}
+			for _, duplicate := range []string{
+				fmt.Sprintf(`INSERT INTO rates (user_id, post_id, status, rated_at) SELECT user_id, post_id, 'down', rated_at FROM rates WHERE user_id = %d AND comment_id IS NULL`, authorID),
+				fmt.Sprintf(`INSERT INTO rates (user_id, comment_id, status, rated_at) SELECT user_id, comment_id, 'down', rated_at FROM rates WHERE user_id = %d AND comment_id IS NOT NULL`, authorID),
+			} {
+				if _, err := database.Exec(duplicate); err == nil {
+					t.Errorf("a duplicate vote was stored: %s", duplicate)
+				}
+			}
+		})
+	}
+}
+
+// checkVoteTotals compares the stored totals of a post or comment with the
+// votes in the rates table that match where
+func checkVoteTotals(t *testing.T, database *sql.DB, table string, id int, where string) {
+	t.Helper()
+	var up, down, rate, countedUp, countedDown int
+	query := fmt.Sprintf(`SELECT upvotes, downvotes, rate,
+		(SELECT COUNT(*) FROM rates WHERE %[1]s AND status = 'up'),
+		(SELECT COUNT(*) FROM rates WHERE %[1]s AND status = 'down')
+		FROM %[2]s WHERE id = %[3]d`, where, table, id)
+	if err := database.QueryRow(query).Scan(&up, &down, &rate, &countedUp, &countedDown); err != nil {
+		t.Fatal(err)
+	}
+	if up != countedUp || down != countedDown || rate != up-down {
+		t.Errorf("%s %d stores %d up, %d down, rate %d; the rates table has %d up and %d down", table, id, up, down, rate, countedUp, countedDown)
+	}
+}
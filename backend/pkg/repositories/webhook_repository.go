@@ -0,0 +1,280 @@
+package repositories
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"project-root/pkg/api"
+	"project-root/pkg/db"
+)
+
+var (
+	// ErrWebhookNotFound is returned for unknown webhooks
+	ErrWebhookNotFound = errors.New("webhook not found")
+	// ErrWebhookDeliveryNotFound is returned for deliveries of other webhooks
+	ErrWebhookDeliveryNotFound = errors.New("webhook delivery not found")
+)
+
+// webhookColumns and deliveryColumns are read by LoadWebhooks and scanDeliveries, in order
+const (
+	webhookColumns  = "id, url, secret, events, active, created_at"
+	deliveryColumns = "id, webhook_id, event, payload, status, attempts, last_status_code, last_error, next_attempt_at, created_at, delivered_at"
+)
+
+// WebhookRepository provides access to webhooks and their deliveries
+type WebhookRepository struct {
+	DB *db.Pool
+}
+
+// NewWebhookRepository creates a new WebhookRepository
+func NewWebhookRepository(pool *db.Pool) *WebhookRepository {
+	return &WebhookRepository{DB: pool}
+}
+
+// CreateWebhook stores a new webhook
+func (r *WebhookRepository) CreateWebhook(w *api.Webhook) error {
+	tx, err := r.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := InsertWebhook(tx, db.SQLite, w); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (r *WebhookRepository) UpdateWebhook(w api.Webhook) error {
+	return UpdateWebhook(r.DB, db.SQLite, w)
+}
+
+func (r *WebhookRepository) GetWebhooks() ([]api.Webhook, error) {
+	return LoadWebhooks(r.DB, db.SQLite, "1 = 1 ORDER BY id")
+}
+
+func (r *WebhookRepository) GetWebhook(id int) (*api.Webhook, error) {
+	return LoadWebhook(r.DB, db.SQLite, id)
+}
+
+func (r *WebhookRepository) DeleteWebhook(id int) error {
+	return DeleteWebhook(r.DB, db.SQLite, id)
+}
+
+func (r *WebhookRepository) EnqueueDeliveries(event string, payload []byte, now time.Time) (int, error) {
+	return EnqueueWebhookDeliveries(r.DB, db.SQLite, event, payload, now)
+}
+
+// ClaimDueDeliveries claims deliveries in a transaction. SQLite serializes
+// writers, so no other dispatcher can claim the same deliveries meanwhile.
+func (r *WebhookRepository) ClaimDueDeliveries(now, until time.Time, limit int) ([]api.WebhookDelivery, error) {
+	tx, err := r.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	deliveries, err := ClaimWebhookDeliveries(tx, db.SQLite, now, until, limit)
+	if err != nil {
+		return nil, err
+	}
+	return deliveries, tx.Commit()
+}
+
+func (r *WebhookRepository) SaveDeliveryResult(d api.WebhookDelivery) error {
+	return SaveWebhookDeliveryResult(r.DB, db.SQLite, d)
+}
+
+func (r *WebhookRepository) GetDeliveries(webhookID, page, pageSize int) ([]api.WebhookDelivery, int, int, error) {
+	return LoadWebhookDeliveries(r.DB, db.SQLite, webhookID, page, pageSize)
+}
+
+func (r *WebhookRepository) RedeliverDelivery(webhookID, deliveryID int, now time.Time) (*api.WebhookDelivery, error) {
+	tx, err := r.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	delivery, err := RedeliverWebhookDelivery(tx, db.SQLite, webhookID, deliveryID, now)
+	if err != nil {
+		return nil, err
+	}
+	return delivery, tx.Commit()
+}
+
+// InsertWebhook stores a new webhook and sets its ID
+func InsertWebhook(q Queryer, dialect db.Dialect, w *api.Webhook) error {
+	return scanRows(q, dialect.Rebind("INSERT INTO webhooks (url, secret, events, active, created_at) VALUES (?, ?, ?, ?, ?) RETURNING id"),
+		[]interface{}{w.URL, w.Secret, strings.Join(w.Events, " "), w.Active, w.CreatedAt.UTC()}, func(rows *sql.Rows) error {
+			return rows.Scan(&w.ID)
+		})
+}
+
+// UpdateWebhook changes the URL, events and state of a webhook
+func UpdateWebhook(e Execer, dialect db.Dialect, w api.Webhook) error {
+	result, err := e.Exec(dialect.Rebind("UPDATE webhooks SET url = ?, events = ?, active = ? WHERE id = ?"),
+		w.URL, strings.Join(w.Events, " "), w.Active, w.ID)
+	return affectedOr(result, err, ErrWebhookNotFound)
+}
+
+// LoadWebhook returns a webhook with its secret
+func LoadWebhook(q Queryer, dialect db.Dialect, id int) (*api.Webhook, error) {
+	webhooks, err := LoadWebhooks(q, dialect, "id = ?", id)
+	if err != nil {
+		return nil, err
+	}
+	if len(webhooks) == 0 {
+		return nil, ErrWebhookNotFound
+	}
+	return &webhooks[0], nil
+}
+
+// LoadWebhooks returns the webhooks matching where
+func LoadWebhooks(q Queryer, dialect db.Dialect, where string, args ...interface{}) ([]api.Webhook, error) {
+	webhooks := []api.Webhook{}
+	err := scanRows(q, dialect.Rebind("SELECT "+webhookColumns+" FROM webhooks WHERE "+where), args, func(rows *sql.Rows) error {
+		var w api.Webhook
+		var events string
+		if err := rows.Scan(&w.ID, &w.URL, &w.Secret, &events, &w.Active, &w.CreatedAt); err != nil {
+			return err
+		}
+		w.Events = strings.Fields(events)
+		webhooks = append(webhooks, w)
+		return nil
+	})
+	return webhooks, err
+}
+
+// DeleteWebhook removes a webhook with its deliveries
+func DeleteWebhook(e Execer, dialect db.Dialect, id int) error {
+	result, err := e.Exec(dialect.Rebind("DELETE FROM webhooks WHERE id = ?"), id)
+	return affectedOr(result, err, ErrWebhookNotFound)
+}
+
+// EnqueueWebhookDeliveries queues the payload of an event for every active
+// webhook subscribed to it, due at now, and returns how many were queued
+func EnqueueWebhookDeliveries(e Execer, dialect db.Dialect, event string, payload []byte, now time.Time) (int, error) {
+	now = now.UTC()
+	result, err := e.Exec(dialect.Rebind(`
+		INSERT INTO webhook_deliveries (webhook_id, event, payload, status, next_attempt_at, created_at)
+		SELECT id, ?, ?, ?, ?, ?
+		FROM webhooks
+		WHERE active = ? AND ' ' || events || ' ' LIKE ?`),
+		event, string(payload), api.DeliveryPending, now, now, true, "% "+event+" %")
+	if err != nil {
+		return 0, err
+	}
+	queued, err := result.RowsAffected()
+	return int(queued), err
+}
+
+// ClaimWebhookDeliveries returns up to limit pending deliveries due at now
+// and moves their next attempt to until. A dispatcher that stops while
+// sending them leaves them to be claimed again once until has passed.
+func ClaimWebhookDeliveries(tx *sql.Tx, dialect db.Dialect, now, until time.Time, limit int) ([]api.WebhookDelivery, error) {
+	due := "SELECT id FROM webhook_deliveries WHERE status = ? AND next_attempt_at <= ? ORDER BY next_attempt_at, id LIMIT ?"
+	if dialect == db.Postgres {
+		// Dispatchers sharing the database claim different deliveries
+		due += " FOR UPDATE SKIP LOCKED"
+	}
+	return scanDeliveries(tx, dialect.Rebind("UPDATE webhook_deliveries SET next_attempt_at = ? WHERE id IN ("+due+") RETURNING "+deliveryColumns),
+		until.UTC(), api.DeliveryPending, now.UTC(), limit)
+}
+
+// SaveWebhookDeliveryResult stores the outcome of an attempt to send d
+func SaveWebhookDeliveryResult(e Execer, dialect db.Dialect, d api.WebhookDelivery) error {
+	_, err := e.Exec(dialect.Rebind(`
+		UPDATE webhook_deliveries
+		SET status = ?, attempts = ?, last_status_code = ?, last_error = ?, next_attempt_at = ?, delivered_at = ?
+		WHERE id = ?`),
+		d.Status, d.Attempts, d.LastStatusCode, d.LastError, utcOrNull(d.NextAttemptAt), utcOrNull(d.DeliveredAt), d.ID)
+	return err
+}
+
+// LoadWebhookDeliveries returns one page of the deliveries of a webhook, newest first
+func LoadWebhookDeliveries(q Queryer, dialect db.Dialect, webhookID, page, pageSize int) ([]api.WebhookDelivery, int, int, error) {
+	var totalItems int
+	err := scanRows(q, dialect.Rebind("SELECT COUNT(*) FROM webhook_deliveries WHERE webhook_id = ?"), []interface{}{webhookID}, func(rows *sql.Rows) error {
+		return rows.Scan(&totalItems)
+	})
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	totalPages := totalItems / pageSize
+	if totalItems%pageSize != 0 {
+		totalPages++
+	}
+
+	deliveries, err := scanDeliveries(q, dialect.Rebind("SELECT "+deliveryColumns+" FROM webhook_deliveries WHERE webhook_id = ? ORDER BY id DESC LIMIT ? OFFSET ?"),
+		webhookID, pageSize, (page-1)*pageSize)
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	return deliveries, totalItems, totalPages, nil
+}
+
+// RedeliverWebhookDelivery queues a delivery of the webhook again, due at
+// now, with a fresh series of attempts
+func RedeliverWebhookDelivery(q Queryer, dialect db.Dialect, webhookID, deliveryID int, now time.Time) (*api.WebhookDelivery, error) {
+	deliveries, err := scanDeliveries(q, dialect.Rebind(`
+		UPDATE webhook_deliveries SET status = ?, attempts = 0, next_attempt_at = ?
+		WHERE id = ? AND webhook_id = ?
+		RETURNING `+deliveryColumns),
+		api.DeliveryPending, now.UTC(), deliveryID, webhookID)
+	if err != nil {
+		return nil, err
+	}
+	if len(deliveries) == 0 {
+		return nil, ErrWebhookDeliveryNotFound
+	}
+	return &deliveries[0], nil
+}
+
+// scanDeliveries runs a query returning deliveryColumns and reads the deliveries
+func scanDeliveries(q Queryer, query string, args ...interface{}) ([]api.WebhookDelivery, error) {
+	deliveries := []api.WebhookDelivery{}
+	err := scanRows(q, query, args, func(rows *sql.Rows) error {
+		var d api.WebhookDelivery
+		var payload string
+		var nextAttemptAt, deliveredAt sql.NullTime
+		if err := rows.Scan(&d.ID, &d.WebhookID, &d.Event, &payload, &d.Status, &d.Attempts, &d.LastStatusCode, &d.LastError, &nextAttemptAt, &d.CreatedAt, &deliveredAt); err != nil {
+			return err
+		}
+		d.Payload = []byte(payload)
+		if nextAttemptAt.Valid {
+			d.NextAttemptAt = &nextAttemptAt.Time
+		}
+		if deliveredAt.Valid {
+			d.DeliveredAt = &deliveredAt.Time
+		}
+		deliveries = append(deliveries, d)
+		return nil
+	})
+	return deliveries, err
+}
+
+// affectedOr returns err, or notFound when the statement changed no rows
+func affectedOr(result sql.Result, err error, notFound error) error {
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return notFound
+	}
+	return nil
+}
+
+// utcOrNull binds an optional time, in UTC as SQLite compares times as text
+func utcOrNull(t *time.Time) sql.NullTime {
+	if t == nil {
+		return sql.NullTime{}
+	}
+	return sql.NullTime{Time: t.UTC(), Valid: true}
+}
@@ -0,0 +1,22 @@
+package server
+
+import (
+	"net"
+	"net/http"
+)
+
+// RedirectHandler redirects plain HTTP requests to the same URL on the HTTPS port
+func RedirectHandler(httpsPort string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(r.Host); err == nil {
+			host = h
+		}
+		if _, port, err := net.SplitHostPort(httpsPort); err == nil && port != "443" {
+			host = net.JoinHostPort(host, port)
+		}
+
+		target := "https://" + host + r.URL.RequestURI()
+		http.Redirect(w, r, target, http.StatusMovedPermanently)
+	})
+}
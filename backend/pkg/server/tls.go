@@ -0,0 +1,211 @@
+package server
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"log/slog"
+	"math/big"
+	"net"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// CertReloader keeps the serving certificate in memory and swaps it when the
+// files on disk change. Only new TLS handshakes pick up the new certificate,
+// so established connections (including WebSockets) are left untouched.
+type CertReloader struct {
+	certFile string
+	keyFile  string
+	logger   *slog.Logger
+
+	mu      sync.RWMutex
+	cert    *tls.Certificate
+	modTime time.Time
+}
+
+// NewCertReloader loads the certificate pair and returns a reloader for it
+func NewCertReloader(certFile, keyFile string, logger *slog.Logger) (*CertReloader, error) {
+	reloader := &CertReloader{certFile: certFile, keyFile: keyFile, logger: logger}
+	if err := reloader.Reload(); err != nil {
+		return nil, err
+	}
+	return reloader, nil
+}
+
+// Reload reads the certificate pair from disk and replaces the served certificate
+func (r *CertReloader) Reload() error {
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return err
+	}
+	modTime, err := r.latestModTime()
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	r.cert = &cert
+	r.modTime = modTime
+	r.mu.Unlock()
+	return nil
+}
+
+// GetCertificate implements tls.Config.GetCertificate
+func (r *CertReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.cert, nil
+}
+
+// Watch reloads the certificate when SIGHUP is received or when the files
+// change on disk, checking every interval. It returns when stop is closed.
+func (r *CertReloader) Watch(interval time.Duration, stop <-chan struct{}) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-hup:
+			r.reloadAndLog("SIGHUP received")
+		case <-ticker.C:
+			modTime, err := r.latestModTime()
+			if err != nil {
+				r.logger.Error("Error checking certificate files", "error", err)
+				continue
+			}
+			r.mu.RLock()
+			changed := modTime.After(r.modTime)
+			r.mu.RUnlock()
+			if changed {
+				r.reloadAndLog("certificate files changed")
+			}
+		}
+	}
+}
+
+func (r *CertReloader) reloadAndLog(reason string) {
+	if err := r.Reload(); err != nil {
+		// Keep serving the previous certificate
+		r.logger.Error("Error reloading certificate", "reason", reason, "error", err)
+		return
+	}
+	r.logger.Info("Certificate reloaded", "reason", reason)
+}
+
+// latestModTime returns the most recent modification time of the certificate pair
+func (r *CertReloader) latestModTime() (time.Time, error) {
+	var latest time.Time
+	for _, file := range []string{r.certFile, r.keyFile} {
+		info, err := os.Stat(file)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	return latest, nil
+}
+
+// EnsureSelfSignedCert generates a self-signed certificate for local development
+// when the certificate or key file is missing, or the certificate has expired.
+func EnsureSelfSignedCert(certFile, keyFile string, hosts []string, logger *slog.Logger) error {
+	if usable, err := certUsable(certFile, keyFile); err != nil || usable {
+		return err
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return err
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return err
+	}
+
+	template := x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{Organization: []string{"kood-rt-forum development"}, CommonName: hosts[0]},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().AddDate(1, 0, 0),
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+	}
+	for _, host := range hosts {
+		if ip := net.ParseIP(host); ip != nil {
+			template.IPAddresses = append(template.IPAddresses, ip)
+		} else {
+			template.DNSNames = append(template.DNSNames, host)
+		}
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, &template, &template, &key.PublicKey, key)
+	if err != nil {
+		return err
+	}
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return err
+	}
+
+	if err := writePEM(certFile, "CERTIFICATE", der, 0644); err != nil {
+		return err
+	}
+	if err := writePEM(keyFile, "PRIVATE KEY", keyDER, 0600); err != nil {
+		return err
+	}
+	logger.Info("Generated self-signed development certificate", "cert_file", certFile)
+	return nil
+}
+
+// certUsable reports whether both files exist and the certificate has not expired
+func certUsable(certFile, keyFile string) (bool, error) {
+	if _, err := os.Stat(keyFile); errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	data, err := os.ReadFile(certFile)
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return false, errors.New("no PEM data found in " + certFile)
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return false, err
+	}
+	return time.Now().Before(cert.NotAfter), nil
+}
+
+func writePEM(path, blockType string, der []byte, perm os.FileMode) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	return pem.Encode(file, &pem.Block{Type: blockType, Bytes: der})
+}
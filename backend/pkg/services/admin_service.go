@@ -0,0 +1,16 @@
+package services
+
+import "project-root/pkg/api"
+
+// IsAdmin reports whether the user is listed in the configured admin nicknames
+func (s *Security) IsAdmin(user *api.UserResponse) bool {
+	if user == nil || user.ID == 0 {
+		return false
+	}
+	for _, nickname := range s.cfg.AdminNicknames {
+		if nickname == user.Nickname {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,90 @@
+package services
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	// SessionCookieName is the cookie that carries the session ID
+	SessionCookieName = "session_token"
+	// CSRFCookieName is the cookie that carries the double-submit CSRF token
+	CSRFCookieName = "csrf_token"
+	// CSRFHeaderName is the header in which clients echo the CSRF token back
+	CSRFHeaderName = "X-CSRF-Token"
+)
+
+// SetSessionCookie writes the session cookie using the configured cookie policy
+func (s *Security) SetSessionCookie(w http.ResponseWriter, sessionID string, expiresAt time.Time) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     SessionCookieName,
+		Value:    sessionID,
+		Expires:  expiresAt,
+		HttpOnly: true,
+		Secure:   s.cfg.CookieSecure,
+		SameSite: s.cfg.SameSiteMode(),
+		Path:     "/",
+	})
+}
+
+// ClearSessionCookie expires the session cookie in the browser
+func (s *Security) ClearSessionCookie(w http.ResponseWriter) {
+	s.SetSessionCookie(w, "", time.Now().Add(-1*time.Hour))
+}
+
+// IssueCSRFToken generates a new CSRF token and stores it in a cookie readable by scripts
+func (s *Security) IssueCSRFToken(w http.ResponseWriter) (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	token := base64.RawURLEncoding.EncodeToString(buf)
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     CSRFCookieName,
+		Value:    token,
+		HttpOnly: false,
+		Secure:   s.cfg.CookieSecure,
+		SameSite: s.cfg.SameSiteMode(),
+		Path:     "/",
+	})
+	return token, nil
+}
+
+// IsOriginAllowed reports whether a browser origin may talk to the API.
+// When no origins are configured only same-host requests are allowed.
+func (s *Security) IsOriginAllowed(origin string, r *http.Request) bool {
+	origin = strings.TrimRight(origin, "/")
+	allowed := s.cfg.AllowedOrigins
+	if len(allowed) == 0 {
+		u, err := url.Parse(origin)
+		return err == nil && u.Host == r.Host
+	}
+
+	for _, o := range allowed {
+		if strings.EqualFold(o, origin) {
+			return true
+		}
+	}
+	return false
+}
+
+// RequestOrigin returns the origin of a request from the Origin header,
+// falling back to the Referer header. It returns an empty string if neither is present.
+func RequestOrigin(r *http.Request) string {
+	if origin := r.Header.Get("Origin"); origin != "" {
+		return origin
+	}
+	if referer := r.Header.Get("Referer"); referer != "" {
+		u, err := url.Parse(referer)
+		if err != nil || u.Scheme == "" || u.Host == "" {
+			return ""
+		}
+		return u.Scheme + "://" + u.Host
+	}
+	return ""
+}
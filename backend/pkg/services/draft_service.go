@@ -0,0 +1,73 @@
+package services
+
+import (
+	"errors"
+	"log/slog"
+	"time"
+
+	"project-root/pkg/api"
+	"project-root/pkg/clock"
+	"project-root/pkg/repositories"
+)
+
+// DraftPublisher publishes the drafts whose scheduled time has come. Each
+// draft becomes its post in one transaction that also removes it, so a draft
+// is published once even when a run is interrupted or several servers share
+// the database; drafts missed while the server was down are published on the
+// next run, dated at their scheduled time.
+type DraftPublisher struct {
+	store     repositories.DraftStore
+	clock     clock.Clock
+	logger    *slog.Logger
+	published func(api.PostCreateRequest)
+}
+
+// NewDraftPublisher creates a publisher for the given store that calls
+// published with every post it creates
+func NewDraftPublisher(store repositories.DraftStore, clk clock.Clock, logger *slog.Logger, published func(api.PostCreateRequest)) *DraftPublisher {
+	return &DraftPublisher{store: store, clock: clk, logger: logger, published: published}
+}
+
+// PublishDue publishes the drafts that are due once. Drafts whose attachments
+// are gone can never be published and are unscheduled, staying with their
+// author as plain drafts.
+func (p *DraftPublisher) PublishDue() {
+	now := p.clock.Now()
+	drafts, err := p.store.GetDueDrafts(now)
+	if err != nil {
+		p.logger.Error("Error fetching due drafts", "error", err)
+		return
+	}
+	for _, draft := range drafts {
+		post, err := p.store.PublishDraft(draft.UserID, draft.ID, now)
+		switch {
+		case errors.Is(err, repositories.ErrDraftNotFound):
+			// Published or deleted since it was listed
+		case errors.Is(err, repositories.ErrAttachmentNotFound):
+			p.logger.Warn("Unscheduling draft with unknown attachments", "draft_id", draft.ID, "user_id", draft.UserID)
+			if err := p.store.UnscheduleDraft(draft.UserID, draft.ID); err != nil {
+				p.logger.Error("Error unscheduling draft", "draft_id", draft.ID, "error", err)
+			}
+		case err != nil:
+			p.logger.Error("Error publishing draft", "draft_id", draft.ID, "error", err)
+		default:
+			p.logger.Info("Published scheduled draft", "draft_id", draft.ID, "post_id", post.ID, "user_id", draft.UserID)
+			p.published(*post)
+		}
+	}
+}
+
+// Watch publishes the due drafts every interval until stop is closed
+func (p *DraftPublisher) Watch(interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			p.PublishDue()
+		}
+	}
+}
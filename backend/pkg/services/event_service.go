@@ -0,0 +1,333 @@
+package services
+
+import (
+	"encoding/json"
+	"log/slog"
+	"slices"
+	"sync"
+	"time"
+
+	"project-root/pkg/api"
+	"project-root/pkg/clock"
+	"project-root/pkg/metrics"
+	"project-root/pkg/repositories"
+)
+
+const (
+	// eventBatchSize is how many events are claimed from the outbox at once
+	eventBatchSize = 64
+	// eventPruneInterval is how often dispatched events past their retention are removed
+	eventPruneInterval = time.Hour
+	// eventGapWait is how long local subscribers wait for an event whose ID
+	// is missing while later events are there. Its transaction may still be
+	// committing, or it rolled back and the event never comes.
+	eventGapWait = time.Minute
+)
+
+// EventPolicy sets how events are retried and kept
+type EventPolicy struct {
+	// MaxAttempts is how many times an event is handed out before the
+	// subscribers failing on it are given up on
+	MaxAttempts int
+	// RetryDelay is the wait before an event is handed out again
+	RetryDelay time.Duration
+	// Retention is how long dispatched events stay in the outbox
+	Retention time.Duration
+}
+
+// EventHandler handles an event recorded in the outbox
+type EventHandler func(api.OutboxEvent) error
+
+type subscription struct {
+	name   string
+	handle EventHandler
+}
+
+// EventBus hands the events that the stores record in the outbox to the
+// subscribers of each event, oldest first. Changes and their events are
+// committed together, so every committed change reaches the subscribers even
+// when the server stops right after it.
+//
+// Servers sharing the database claim the events they dispatch, so each event
+// reaches its subscribers on one server only. When a subscriber fails, the
+// event is handed out again after the retry delay to the subscribers that
+// have not handled it yet. A subscriber that fails to be recorded as having
+// handled an event gets it again, so subscribers must tolerate repeats.
+//
+// Local subscribers, such as the WebSocket clients of a server, get every
+// event on every server instead. Each server follows the outbox from where
+// it stood when the server started and hands the new events to its local
+// subscribers once, best effort.
+//
+// Writers call Wake after a change to have its event handled right away.
+type EventBus struct {
+	store  repositories.OutboxStore
+	clock  clock.Clock
+	policy EventPolicy
+	logger *slog.Logger
+	wake   chan struct{}
+
+	mu            sync.RWMutex
+	subscriptions map[string][]subscription
+	local         map[string][]subscription
+
+	// cursorMu guards the position of the local subscribers in the outbox
+	cursorMu sync.Mutex
+	started  bool
+	// after is the ID up to which every event was handed to the local
+	// subscribers or given up on; handed holds the later events handed out,
+	// with when they were
+	after  int
+	handed map[int]time.Time
+}
+
+// NewEventBus creates a bus for the events in store
+func NewEventBus(store repositories.OutboxStore, clk clock.Clock, policy EventPolicy, logger *slog.Logger) *EventBus {
+	return &EventBus{
+		store:         store,
+		clock:         clk,
+		policy:        policy,
+		logger:        logger,
+		wake:          make(chan struct{}, 1),
+		subscriptions: make(map[string][]subscription),
+		local:         make(map[string][]subscription),
+		handed:        make(map[int]time.Time),
+	}
+}
+
+// Subscribe has handle called on one of the servers for every event of the
+// given name. The subscriber name identifies it in logs and in the record of
+// who handled an event, so it must be unique among the subscribers of an event.
+func (b *EventBus) Subscribe(event, subscriber string, handle EventHandler) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.subscriptions[event] = append(b.subscriptions[event], subscription{name: subscriber, handle: handle})
+}
+
+// SubscribeLocal has handle called on this server for every event of the
+// given name recorded while it runs, whichever server recorded it. Events
+// are handed out once; errors are logged but not retried.
+func (b *EventBus) SubscribeLocal(event, subscriber string, handle EventHandler) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.local[event] = append(b.local[event], subscription{name: subscriber, handle: handle})
+}
+
+// On subscribes handle to the events of type E, decoded from their payload
+func On[E api.Event](b *EventBus, subscriber string, handle func(E) error) {
+	var event E
+	b.Subscribe(event.EventName(), subscriber, decoded(handle))
+}
+
+// OnLocal subscribes handle locally to the events of type E, decoded from
+// their payload
+func OnLocal[E api.Event](b *EventBus, subscriber string, handle func(E) error) {
+	var event E
+	b.SubscribeLocal(event.EventName(), subscriber, decoded(handle))
+}
+
+// decoded makes an EventHandler of a handler of the events of type E
+func decoded[E api.Event](handle func(E) error) EventHandler {
+	return func(e api.OutboxEvent) error {
+		var data E
+		if err := json.Unmarshal(e.Payload, &data); err != nil {
+			return err
+		}
+		return handle(data)
+	}
+}
+
+// Wake makes Watch dispatch the pending and new events without waiting for
+// the next tick
+func (b *EventBus) Wake() {
+	select {
+	case b.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Watch dispatches the pending events and hands the new ones to the local
+// subscribers whenever it is woken and every interval, for events recorded
+// by other servers and retries, until stop is closed. It removes the
+// dispatched events past their retention hourly.
+func (b *EventBus) Watch(interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var pruned time.Time
+	for {
+		b.DispatchPending()
+		b.DispatchLocal()
+		if now := b.clock.Now(); now.Sub(pruned) >= eventPruneInterval {
+			b.prune(now)
+			pruned = now
+		}
+
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		case <-b.wake:
+		}
+	}
+}
+
+// DispatchPending hands the pending events to their subscribers, a batch at a time
+func (b *EventBus) DispatchPending() {
+	for {
+		now := b.clock.Now()
+		events, err := b.store.ClaimEvents(now, now.Add(b.policy.RetryDelay), eventBatchSize)
+		if err != nil {
+			b.logger.Error("Error claiming events", "error", err)
+			return
+		}
+		for _, event := range events {
+			b.dispatch(event)
+		}
+		if len(events) < eventBatchSize {
+			return
+		}
+	}
+}
+
+// dispatch hands an event to the subscribers that have not handled it yet
+// and marks it dispatched unless one of them failed and it may be retried,
+// in which case the others are recorded as having handled it
+func (b *EventBus) dispatch(event api.OutboxEvent) {
+	b.mu.RLock()
+	subscriptions := b.subscriptions[event.Name]
+	b.mu.RUnlock()
+
+	failed := false
+	var delivered []string
+	for _, s := range subscriptions {
+		if slices.Contains(event.Delivered, s.name) {
+			continue
+		}
+		if err := s.handle(event); err != nil {
+			failed = true
+			metrics.EventsHandled.Inc(event.Name, "error")
+			b.logger.Error("Error handling event", "event", event.Name, "event_id", event.ID, "subscriber", s.name, "attempts", event.Attempts, "error", err)
+			continue
+		}
+		delivered = append(delivered, s.name)
+		metrics.EventsHandled.Inc(event.Name, "ok")
+	}
+	if failed && event.Attempts < b.policy.MaxAttempts {
+		if err := b.store.MarkDelivered(event.ID, delivered, b.clock.Now()); err != nil {
+			b.logger.Error("Error recording event deliveries", "event_id", event.ID, "subscribers", delivered, "error", err)
+		}
+		return
+	}
+	if failed {
+		b.logger.Warn("Giving up on event", "event", event.Name, "event_id", event.ID, "attempts", event.Attempts)
+	}
+	if err := b.store.MarkDispatched(event.ID, b.clock.Now()); err != nil {
+		b.logger.Error("Error marking event dispatched", "event_id", event.ID, "error", err)
+	}
+}
+
+// DispatchLocal hands the events recorded since the last call to the local
+// subscribers, oldest first. The first call only notes where the outbox ends.
+func (b *EventBus) DispatchLocal() {
+	b.cursorMu.Lock()
+	defer b.cursorMu.Unlock()
+
+	if !b.started {
+		last, err := b.store.LastEventID()
+		if err != nil {
+			b.logger.Error("Error reading the last event", "error", err)
+			return
+		}
+		b.after, b.started = last, true
+		return
+	}
+
+	from := b.after
+	for {
+		events, err := b.store.EventsAfter(from, eventBatchSize)
+		if err != nil {
+			b.logger.Error("Error reading new events", "error", err)
+			return
+		}
+		now := b.clock.Now()
+		for _, event := range events {
+			if _, ok := b.handed[event.ID]; ok {
+				continue
+			}
+			b.handed[event.ID] = now
+			b.dispatchLocal(event)
+		}
+		b.advance(now)
+		if len(events) < eventBatchSize {
+			return
+		}
+		from = events[len(events)-1].ID
+	}
+}
+
+// dispatchLocal hands an event to its local subscribers
+func (b *EventBus) dispatchLocal(event api.OutboxEvent) {
+	b.mu.RLock()
+	subscriptions := b.local[event.Name]
+	b.mu.RUnlock()
+
+	for _, s := range subscriptions {
+		if err := s.handle(event); err != nil {
+			metrics.EventsHandled.Inc(event.Name, "error")
+			b.logger.Error("Error handling event", "event", event.Name, "event_id", event.ID, "subscriber", s.name, "error", err)
+			continue
+		}
+		metrics.EventsHandled.Inc(event.Name, "ok")
+	}
+}
+
+// advance moves the local cursor over the events handed out in a row. An ID
+// missing before later events holds it back until eventGapWait after the
+// next event was handed out, as IDs are taken before their transactions
+// commit. Callers must hold b.cursorMu.
+func (b *EventBus) advance(now time.Time) {
+	for len(b.handed) > 0 {
+		if _, ok := b.handed[b.after+1]; ok {
+			delete(b.handed, b.after+1)
+			b.after++
+			continue
+		}
+		next := 0
+		for id := range b.handed {
+			if next == 0 || id < next {
+				next = id
+			}
+		}
+		if now.Sub(b.handed[next]) < eventGapWait {
+			return
+		}
+		b.after = next - 1
+	}
+}
+
+// prune removes the events dispatched longer than the retention ago
+func (b *EventBus) prune(now time.Time) {
+	pruned, err := b.store.PruneEvents(now.Add(-b.policy.Retention))
+	if err != nil {
+		b.logger.Error("Error pruning events", "error", err)
+		return
+	}
+	if pruned > 0 {
+		b.logger.Info("Pruned dispatched events", "count", pruned)
+	}
+}
+
+// SubscribeCounters keeps the post and comment counters of users and posts
+// in counts up to date with the posts and comments created
+func SubscribeCounters(bus *EventBus, counts repositories.CountStore) {
+	On(bus, "counters", func(e api.PostCreatedEvent) error {
+		return counts.RecountUser(e.Author.ID)
+	})
+	On(bus, "counters", func(e api.CommentCreatedEvent) error {
+		if err := counts.RecountPost(e.PostID); err != nil {
+			return err
+		}
+		return counts.RecountUser(e.Author.ID)
+	})
+}
@@ -0,0 +1,191 @@
+package services
+
+import (
+	"errors"
+	"io"
+	"log/slog"
+	"slices"
+	"testing"
+	"time"
+
+	"project-root/pkg/api"
+	"project-root/pkg/clock"
+	"project-root/pkg/repositories"
+	"project-root/pkg/repositories/memory"
+)
+
+var testEventPolicy = EventPolicy{MaxAttempts: 3, RetryDelay: time.Minute, Retention: time.Hour}
+
+func newTestEventBus(store repositories.OutboxStore, clk clock.Clock) *EventBus {
+	return NewEventBus(store, clk, testEventPolicy, slog.New(slog.NewTextHandler(io.Discard, nil)))
+}
+
+// register records a user.registered event
+func register(t *testing.T, stores repositories.Stores, clk clock.Clock, nickname string) {
+	t.Helper()
+	if _, err := stores.Users.CreateUser(&api.RegistrationRequest{Nickname: nickname, Email: nickname + "@example.com", CreatedAt: clk.Now()}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// countingSubscriber counts its calls and fails those listed in failing, by number
+func countingSubscriber(calls *int, failing ...int) EventHandler {
+	return func(api.OutboxEvent) error {
+		*calls++
+		for _, n := range failing {
+			if n == *calls {
+				return errors.New("subscriber failed")
+			}
+		}
+		return nil
+	}
+}
+
+func TestEventBusRetriesFailedSubscribersOnly(t *testing.T) {
+	clk := clock.NewManual(time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC))
+	stores := memory.NewStores(clk)
+	bus := newTestEventBus(stores.Outbox, clk)
+	var counters, webhooks int
+	bus.Subscribe(api.EventUserRegistered, "counters", countingSubscriber(&counters))
+	bus.Subscribe(api.EventUserRegistered, "webhooks", countingSubscriber(&webhooks, 1, 2))
+	register(t, stores, clk, "alice")
+
+	for attempt := 1; attempt <= 3; attempt++ {
+		bus.DispatchPending()
+		if counters != 1 || webhooks != attempt {
+			t.Fatalf("attempt %d: counters called %d times, webhooks %d times; want 1 and %d", attempt, counters, webhooks, attempt)
+		}
+		clk.Advance(testEventPolicy.RetryDelay)
+	}
+
+	// Handled by both, the event is not handed out again
+	bus.DispatchPending()
+	if counters != 1 || webhooks != 3 {
+		t.Errorf("after dispatching: counters called %d times, webhooks %d times", counters, webhooks)
+	}
+}
+
+func TestEventBusGivesUpAfterMaxAttempts(t *testing.T) {
+	clk := clock.NewManual(time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC))
+	stores := memory.NewStores(clk)
+	bus := newTestEventBus(stores.Outbox, clk)
+	var counters, webhooks int
+	bus.Subscribe(api.EventUserRegistered, "counters", countingSubscriber(&counters))
+	bus.Subscribe(api.EventUserRegistered, "webhooks", countingSubscriber(&webhooks, 1, 2, 3, 4))
+	register(t, stores, clk, "alice")
+
+	for i := 0; i < testEventPolicy.MaxAttempts+2; i++ {
+		bus.DispatchPending()
+		clk.Advance(testEventPolicy.RetryDelay)
+	}
+	if counters != 1 || webhooks != testEventPolicy.MaxAttempts {
+		t.Errorf("counters called %d times, webhooks %d times; want 1 and %d", counters, webhooks, testEventPolicy.MaxAttempts)
+	}
+}
+
+func TestEventBusLocalSubscribersOnEveryServer(t *testing.T) {
+	clk := clock.NewManual(time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC))
+	stores := memory.NewStores(clk)
+	register(t, stores, clk, "before")
+
+	// Two servers share the outbox
+	var counters int
+	pushed := make([]int, 2)
+	buses := make([]*EventBus, 2)
+	for i := range buses {
+		buses[i] = newTestEventBus(stores.Outbox, clk)
+		buses[i].Subscribe(api.EventUserRegistered, "counters", countingSubscriber(&counters))
+		buses[i].SubscribeLocal(api.EventUserRegistered, "websockets", countingSubscriber(&pushed[i], 1))
+		buses[i].DispatchLocal()
+	}
+
+	register(t, stores, clk, "alice")
+	register(t, stores, clk, "bob")
+	for _, bus := range buses {
+		bus.DispatchPending()
+		bus.DispatchLocal()
+	}
+	if counters != 3 {
+		t.Errorf("counters called %d times, want once for each of 3 events", counters)
+	}
+	// Events recorded before a server started are not pushed, and a failed
+	// push is not repeated
+	if pushed[0] != 2 || pushed[1] != 2 {
+		t.Errorf("servers pushed %v events, want 2 each", pushed)
+	}
+
+	clk.Advance(testEventPolicy.RetryDelay)
+	for _, bus := range buses {
+		bus.DispatchPending()
+		bus.DispatchLocal()
+	}
+	if counters != 3 || pushed[0] != 2 || pushed[1] != 2 {
+		t.Errorf("after dispatching again: counters called %d times, servers pushed %v", counters, pushed)
+	}
+}
+
+// gapOutbox serves fixed events to local subscribers, with IDs missing as
+// they are while their transactions commit
+type gapOutbox struct {
+	repositories.OutboxStore
+	events []api.OutboxEvent
+}
+
+func (o *gapOutbox) add(ids ...int) {
+	for _, id := range ids {
+		o.events = append(o.events, api.OutboxEvent{ID: id, Name: api.EventUserRegistered})
+	}
+	slices.SortFunc(o.events, func(a, b api.OutboxEvent) int { return a.ID - b.ID })
+}
+
+func (o *gapOutbox) EventsAfter(id, limit int) ([]api.OutboxEvent, error) {
+	var events []api.OutboxEvent
+	for _, e := range o.events {
+		if e.ID > id && len(events) < limit {
+			events = append(events, e)
+		}
+	}
+	return events, nil
+}
+
+func (o *gapOutbox) LastEventID() (int, error) {
+	return 0, nil
+}
+
+func TestEventBusLocalWaitsForMissingEvents(t *testing.T) {
+	clk := clock.NewManual(time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC))
+	store := &gapOutbox{}
+	bus := newTestEventBus(store, clk)
+	var handed []int
+	bus.SubscribeLocal(api.EventUserRegistered, "websockets", func(e api.OutboxEvent) error {
+		handed = append(handed, e.ID)
+		return nil
+	})
+	bus.DispatchLocal()
+
+	store.add(1, 3)
+	bus.DispatchLocal()
+	if bus.after != 1 {
+		t.Errorf("cursor after a missing event = %d, want 1", bus.after)
+	}
+
+	// The missing event commits later and is handed out once, like the others
+	store.add(2, 4)
+	bus.DispatchLocal()
+	bus.DispatchLocal()
+	if want := []int{1, 3, 2, 4}; !slices.Equal(handed, want) {
+		t.Errorf("handed out %v, want %v", handed, want)
+	}
+	if bus.after != 4 {
+		t.Errorf("cursor after the missing event came = %d, want 4", bus.after)
+	}
+
+	// An event that never comes is given up on
+	store.add(6)
+	bus.DispatchLocal()
+	clk.Advance(eventGapWait)
+	bus.DispatchLocal()
+	if bus.after != 6 || len(bus.handed) != 0 {
+		t.Errorf("cursor past a rolled back event = %d with %v waiting, want 6", bus.after, bus.handed)
+	}
+}
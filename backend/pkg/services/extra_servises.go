@@ -28,3 +28,18 @@ func TrimAndNormalizeSpaces(input string) string {
 
 	return result
 }
+
+// TrimMarkdown trims Markdown source without touching the whitespace inside
+// it, which carries line breaks, code indentation and list nesting. Line
+// endings are normalized, leading blank lines and trailing whitespace removed.
+func TrimMarkdown(input string) string {
+	input = strings.NewReplacer("\r\n", "\n", "\r", "\n").Replace(input)
+	for {
+		line, rest, found := strings.Cut(input, "\n")
+		if !found || strings.TrimSpace(line) != "" {
+			break
+		}
+		input = rest
+	}
+	return strings.TrimRightFunc(input, unicode.IsSpace)
+}
@@ -4,6 +4,8 @@ import (
 	"net/http"
 	"project-root/pkg/api"
 	"project-root/pkg/repositories"
+	"strings"
+
 	"github.com/gorilla/mux"
 )
 func GetRouteParams(r *http.Request) map[string]string {
@@ -13,15 +15,64 @@ func GetRouteParams(r *http.Request) map[string]string {
 
 // GetSessionID retrieves the session ID from the request cookie
 func getSessionID(r *http.Request) (string, error) {
-	cookie, err := r.Cookie("session_token")
+	cookie, err := r.Cookie(SessionCookieName)
 	if err != nil {
 		return "", err
 	}
 	return cookie.Value, nil
 }
 
-// AuthenticateUser retrieves user information based on session ID.
-func AuthenticateUser(r *http.Request) (*api.UserResponse, bool) {
+// getBearerToken retrieves the token from the Authorization header
+func getBearerToken(r *http.Request) (string, bool) {
+	header := r.Header.Get("Authorization")
+	if len(header) < 7 || !strings.EqualFold(header[:7], "Bearer ") {
+		return "", false
+	}
+	token := strings.TrimSpace(header[7:])
+	return token, token != ""
+}
+
+// Authenticator resolves the user behind a request from its session cookie or bearer token
+type Authenticator struct {
+	sessions repositories.SessionStore
+	tokens   repositories.TokenStore
+}
+
+// NewAuthenticator creates an Authenticator backed by the given stores
+func NewAuthenticator(sessions repositories.SessionStore, tokens repositories.TokenStore) *Authenticator {
+	return &Authenticator{sessions: sessions, tokens: tokens}
+}
+
+// AuthorizeOptional authenticates a request to an endpoint that anonymous
+// visitors may use too. A bearer token must be valid and granted the scope:
+// requests with one that is not are refused rather than served anonymously.
+func (a *Authenticator) AuthorizeOptional(r *http.Request, scope string) (user *api.UserResponse, authenticated, refused bool) {
+	user, authenticated = a.AuthorizeUser(r, scope)
+	if _, ok := getBearerToken(r); ok && !authenticated {
+		return user, false, true
+	}
+	return user, authenticated, false
+}
+
+// AuthorizeUser authenticates the request and, for bearer tokens, checks that the
+// token was granted the required scope. Cookie sessions have every scope.
+func (a *Authenticator) AuthorizeUser(r *http.Request, scope string) (*api.UserResponse, bool) {
+	if token, ok := getBearerToken(r); ok {
+		u, scopes, err := a.tokens.GetUserByTokenHash(HashToken(token))
+		if err != nil || u == nil {
+			return &api.UserResponse{ID: 0, Nickname: ""}, false
+		}
+		if scope != "" && !hasScope(scopes, scope) {
+			return &api.UserResponse{ID: 0, Nickname: ""}, false
+		}
+		return &api.UserResponse{ID: u.ID, Nickname: u.Nickname}, true
+	}
+
+	return a.AuthenticateSession(r)
+}
+
+// AuthenticateSession retrieves user information based on the session cookie only.
+func (a *Authenticator) AuthenticateSession(r *http.Request) (*api.UserResponse, bool) {
 	authenticated := false
 	var user *api.UserResponse
 
@@ -30,7 +81,7 @@ func AuthenticateUser(r *http.Request) (*api.UserResponse, bool) {
 		return &api.UserResponse{ID: 0, Nickname: ""}, false
 	}
 
-	u, err := repositories.GetUserBySessionID(sessionID)
+	u, err := a.sessions.GetUserBySessionID(sessionID)
 	if err != nil || u == nil {
 		return &api.UserResponse{ID: 0, Nickname: ""}, false
 	}
@@ -42,4 +93,4 @@ func AuthenticateUser(r *http.Request) (*api.UserResponse, bool) {
 	authenticated = true
 
 	return user, authenticated
-}
\ No newline at end of file
+}
@@ -0,0 +1,130 @@
+package services
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"project-root/pkg/api"
+	"project-root/pkg/clock"
+	"project-root/pkg/repositories"
+	"project-root/pkg/repositories/memory"
+)
+
+// authFixture holds the stores behind an Authenticator with one user, a
+// session of that user and tokens created through newToken
+type authFixture struct {
+	stores repositories.Stores
+	clock  *clock.Manual
+	auth   *Authenticator
+	userID int
+}
+
+func newAuthFixture(t *testing.T) *authFixture {
+	t.Helper()
+	clk := clock.NewManual(time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC))
+	stores := memory.NewStores(clk)
+	user, err := stores.Users.CreateUser(&api.RegistrationRequest{Nickname: "bot-owner", Email: "owner@example.com", CreatedAt: clk.Now()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := stores.Sessions.CreateSession(&api.Session{UserID: user.ID, SessionID: "session-1"}); err != nil {
+		t.Fatal(err)
+	}
+	return &authFixture{stores: stores, clock: clk, auth: NewAuthenticator(stores.Sessions, stores.Tokens), userID: user.ID}
+}
+
+// newToken stores a token with the given scopes and returns its ID and secret
+func (f *authFixture) newToken(t *testing.T, expiresAt *time.Time, scopes ...string) (int, string) {
+	t.Helper()
+	secret, err := GenerateToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := f.stores.Tokens.Create(f.userID, "test", HashToken(secret), scopes, expiresAt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token.ID, secret
+}
+
+func bearerRequest(secret string) *http.Request {
+	r := httptest.NewRequest(http.MethodGet, "/api/posts", nil)
+	if secret != "" {
+		r.Header.Set("Authorization", "Bearer "+secret)
+	}
+	return r
+}
+
+func TestAuthorizeScopes(t *testing.T) {
+	f := newAuthFixture(t)
+	_, reader := f.newToken(t, nil, ScopePostsRead)
+	_, writer := f.newToken(t, nil, ScopePostsWrite)
+	expiry := f.clock.Now().Add(time.Hour)
+	_, expired := f.newToken(t, &expiry, ScopePostsRead, ScopePostsWrite)
+	f.clock.Advance(2 * time.Hour)
+
+	session := httptest.NewRequest(http.MethodGet, "/api/posts", nil)
+	session.AddCookie(&http.Cookie{Name: SessionCookieName, Value: "session-1"})
+
+	tests := []struct {
+		name          string
+		request       *http.Request
+		scope         string
+		authenticated bool
+		refused       bool
+	}{
+		{"anonymous read", bearerRequest(""), ScopePostsRead, false, false},
+		{"read token reads", bearerRequest(reader), ScopePostsRead, true, false},
+		{"write token cannot read", bearerRequest(writer), ScopePostsRead, false, true},
+		{"read token cannot write", bearerRequest(reader), ScopePostsWrite, false, true},
+		{"write token writes", bearerRequest(writer), ScopePostsWrite, true, false},
+		{"expired token", bearerRequest(expired), ScopePostsRead, false, true},
+		{"unknown token", bearerRequest(TokenPrefix + "unknown"), ScopePostsRead, false, true},
+		{"session has every scope", session, ScopePostsWrite, true, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			user, authenticated, refused := f.auth.AuthorizeOptional(tt.request, tt.scope)
+			if authenticated != tt.authenticated || refused != tt.refused {
+				t.Fatalf("AuthorizeOptional = authenticated %v, refused %v; want %v, %v", authenticated, refused, tt.authenticated, tt.refused)
+			}
+			if authenticated && user.ID != f.userID {
+				t.Errorf("user ID = %d, want %d", user.ID, f.userID)
+			}
+			if _, authorized := f.auth.AuthorizeUser(tt.request, tt.scope); authorized != tt.authenticated {
+				t.Errorf("AuthorizeUser = %v, want %v", authorized, tt.authenticated)
+			}
+		})
+	}
+}
+
+func TestRevokedTokenIsRefused(t *testing.T) {
+	f := newAuthFixture(t)
+	id, secret := f.newToken(t, nil, ScopePostsRead, ScopePostsWrite)
+
+	if _, authenticated, _ := f.auth.AuthorizeOptional(bearerRequest(secret), ScopePostsRead); !authenticated {
+		t.Fatal("token is refused before it is revoked")
+	}
+	tokens, err := f.stores.Tokens.GetTokensForUser(f.userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tokens) != 1 || tokens[0].LastUsedAt == nil {
+		t.Fatalf("tokens = %+v, want one with last_used_at set", tokens)
+	}
+
+	if err := f.stores.Tokens.Delete(f.userID+1, id); err != repositories.ErrTokenNotFound {
+		t.Fatalf("deleting another user's token: err = %v, want ErrTokenNotFound", err)
+	}
+	if err := f.stores.Tokens.Delete(f.userID, id); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, scope := range []string{ScopePostsRead, ScopePostsWrite} {
+		if _, authenticated, refused := f.auth.AuthorizeOptional(bearerRequest(secret), scope); authenticated || !refused {
+			t.Errorf("revoked token with %s: authenticated %v, refused %v", scope, authenticated, refused)
+		}
+	}
+}
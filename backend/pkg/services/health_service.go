@@ -0,0 +1,82 @@
+package services
+
+import (
+	"context"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	"project-root/pkg/api"
+)
+
+// Version is the build version. It can be set at build time with
+// -ldflags "-X project-root/pkg/services.Version=v1.2.0".
+var Version = ""
+
+// HealthCheck is a named readiness probe
+type HealthCheck struct {
+	Name  string
+	Check func(ctx context.Context) error
+}
+
+// RunHealthChecks runs all checks concurrently and reports whether every check passed
+func RunHealthChecks(ctx context.Context, checks []HealthCheck) ([]api.HealthCheck, bool) {
+	results := make([]api.HealthCheck, len(checks))
+	var wg sync.WaitGroup
+	for i, check := range checks {
+		wg.Add(1)
+		go func(i int, check HealthCheck) {
+			defer wg.Done()
+			start := time.Now()
+			err := check.Check(ctx)
+			results[i] = api.HealthCheck{
+				Name:       check.Name,
+				Status:     "ok",
+				DurationMs: time.Since(start).Milliseconds(),
+			}
+			if err != nil {
+				results[i].Status = "fail"
+				results[i].Error = err.Error()
+			}
+		}(i, check)
+	}
+	wg.Wait()
+
+	for _, result := range results {
+		if result.Status != "ok" {
+			return results, false
+		}
+	}
+	return results, true
+}
+
+// BuildVersion returns Version if set, otherwise the VCS revision recorded by the Go toolchain
+func BuildVersion() string {
+	if Version != "" {
+		return Version
+	}
+
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return "unknown"
+	}
+	revision, modified := "", false
+	for _, setting := range info.Settings {
+		switch setting.Key {
+		case "vcs.revision":
+			revision = setting.Value
+		case "vcs.modified":
+			modified = setting.Value == "true"
+		}
+	}
+	if revision == "" {
+		return "dev"
+	}
+	if len(revision) > 12 {
+		revision = revision[:12]
+	}
+	if modified {
+		revision += "-dirty"
+	}
+	return revision
+}
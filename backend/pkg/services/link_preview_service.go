@@ -0,0 +1,230 @@
+package services
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"project-root/pkg/api"
+	"project-root/pkg/clock"
+	"project-root/pkg/metrics"
+	"project-root/pkg/repositories"
+	"project-root/pkg/unfurl"
+)
+
+const (
+	// linkPreviewQueueSize is how many links may wait for a worker; links
+	// beyond it are not previewed
+	linkPreviewQueueSize = 256
+	// emptyPreviewTTL is how long pages without metadata or that could not be
+	// fetched are left alone, shorter than the cache TTL as the cause may pass
+	emptyPreviewTTL = time.Hour
+)
+
+// PageFetcher reads the metadata of a linked page
+type PageFetcher interface {
+	Fetch(ctx context.Context, rawURL string) (unfurl.Metadata, error)
+}
+
+// LinkPreviewer fetches the previews of the links in new posts and chat
+// messages in the background and caches them by URL. A link that is already
+// waiting is not queued again; its callbacks are called once it is fetched.
+type LinkPreviewer struct {
+	store   repositories.LinkPreviewStore
+	fetcher PageFetcher
+	clock   clock.Clock
+	ttl     time.Duration
+	logger  *slog.Logger
+
+	queue   chan string
+	mu      sync.Mutex
+	pending map[string][]func(api.LinkPreview)
+}
+
+// NewLinkPreviewer creates a previewer that caches the previews fetched by
+// fetcher in store for ttl. A nil fetcher disables previews.
+func NewLinkPreviewer(store repositories.LinkPreviewStore, fetcher PageFetcher, clk clock.Clock, ttl time.Duration, logger *slog.Logger) *LinkPreviewer {
+	return &LinkPreviewer{
+		store:   store,
+		fetcher: fetcher,
+		clock:   clk,
+		ttl:     ttl,
+		logger:  logger,
+		queue:   make(chan string, linkPreviewQueueSize),
+		pending: make(map[string][]func(api.LinkPreview)),
+	}
+}
+
+// Subscribe has the links in new posts on bus previewed. Links in chat
+// messages are previewed by the WebSocket manager, which shows the previews
+// in the room as they arrive.
+func (p *LinkPreviewer) Subscribe(bus *EventBus) {
+	On(bus, "link_previews", func(e api.PostCreatedEvent) error {
+		p.Unfurl(unfurl.FindURLs(e.Content), nil)
+		return nil
+	})
+}
+
+// Unfurl queues the links for previewing and returns at once. done, which
+// may be nil, is called from a worker with every preview that has something
+// to show, whether it was fetched or still cached.
+func (p *LinkPreviewer) Unfurl(urls []string, done func(api.LinkPreview)) {
+	if p.fetcher == nil {
+		return
+	}
+	for _, u := range urls {
+		p.mu.Lock()
+		callbacks, waiting := p.pending[u]
+		if done != nil {
+			callbacks = append(callbacks, done)
+		}
+		p.pending[u] = callbacks
+		p.mu.Unlock()
+		if waiting {
+			continue
+		}
+
+		select {
+		case p.queue <- u:
+		default:
+			p.mu.Lock()
+			delete(p.pending, u)
+			p.mu.Unlock()
+			p.logger.Warn("Link preview queue full, skipping link", "url", u)
+		}
+	}
+}
+
+// Run previews the queued links with the given number of workers until stop
+// is closed. Fetches in progress are cancelled on stop.
+func (p *LinkPreviewer) Run(workers int, stop <-chan struct{}) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case u := <-p.queue:
+					p.preview(ctx, u)
+				}
+			}
+		}()
+	}
+	<-stop
+	cancel()
+	wg.Wait()
+}
+
+// preview brings the cached preview of a link up to date and hands it to the
+// callbacks waiting for it
+func (p *LinkPreviewer) preview(ctx context.Context, u string) {
+	preview, err := p.cached(u)
+	if err != nil {
+		p.logger.Error("Error reading cached link preview", "url", u, "error", err)
+	}
+	if preview == nil {
+		preview = p.fetch(ctx, u)
+	}
+
+	p.mu.Lock()
+	callbacks := p.pending[u]
+	delete(p.pending, u)
+	p.mu.Unlock()
+
+	if preview == nil || preview.Empty() {
+		return
+	}
+	for _, done := range callbacks {
+		done(*preview)
+	}
+}
+
+// cached returns the cached preview of a link or nil when it is missing or expired
+func (p *LinkPreviewer) cached(u string) (*api.LinkPreview, error) {
+	previews, err := p.store.GetLinkPreviews([]string{u})
+	if err != nil {
+		return nil, err
+	}
+	preview, ok := previews[u]
+	if !ok {
+		return nil, nil
+	}
+	ttl := p.ttl
+	if preview.Empty() {
+		ttl = min(ttl, emptyPreviewTTL)
+	}
+	if p.clock.Now().Sub(preview.FetchedAt) >= ttl {
+		return nil, nil
+	}
+	return &preview, nil
+}
+
+// fetch reads the linked page and caches what it offers. Pages that cannot
+// be fetched are cached as empty previews so that they are not tried again
+// for every message. It returns nil when stopped during the fetch.
+func (p *LinkPreviewer) fetch(ctx context.Context, u string) *api.LinkPreview {
+	meta, err := p.fetcher.Fetch(ctx, u)
+	if ctx.Err() != nil {
+		return nil
+	}
+	switch {
+	case err != nil:
+		metrics.LinkPreviewsFetched.Inc("error")
+		p.logger.Debug("Error fetching link preview", "url", u, "error", err)
+	case meta.Empty():
+		metrics.LinkPreviewsFetched.Inc("empty")
+	default:
+		metrics.LinkPreviewsFetched.Inc("ok")
+	}
+
+	preview := &api.LinkPreview{
+		URL:         u,
+		Title:       meta.Title,
+		Description: meta.Description,
+		ImageURL:    meta.ImageURL,
+		SiteName:    meta.SiteName,
+		FetchedAt:   p.clock.Now(),
+	}
+	if err := p.store.SaveLinkPreview(*preview); err != nil {
+		p.logger.Error("Error caching link preview", "url", u, "error", err)
+	}
+	return preview
+}
+
+// AttachLinkPreviews looks up the cached previews of the links in texts and
+// calls set with those of the i-th text that have something to show, in the
+// order of the links. Links still being fetched are left out.
+func AttachLinkPreviews(store repositories.LinkPreviewStore, texts []string, set func(i int, previews []api.LinkPreview)) error {
+	links := make([][]string, len(texts))
+	var all []string
+	for i, text := range texts {
+		links[i] = unfurl.FindURLs(text)
+		all = append(all, links[i]...)
+	}
+	if len(all) == 0 {
+		return nil
+	}
+	cached, err := store.GetLinkPreviews(all)
+	if err != nil {
+		return err
+	}
+	for i := range texts {
+		var previews []api.LinkPreview
+		for _, u := range links[i] {
+			if preview, ok := cached[u]; ok && !preview.Empty() {
+				previews = append(previews, preview)
+			}
+		}
+		if previews != nil {
+			set(i, previews)
+		}
+	}
+	return nil
+}
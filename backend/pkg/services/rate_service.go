@@ -1,2 +1,91 @@
 package services
 
+import (
+	"log/slog"
+	"time"
+
+	"project-root/pkg/clock"
+	"project-root/pkg/metrics"
+	"project-root/pkg/repositories"
+)
+
+// VoteReconciler keeps the vote totals of posts and comments in line with the
+// individual votes. Votes update the totals in the same transaction, so it
+// only repairs drift left by manual edits or older versions.
+type VoteReconciler struct {
+	store  repositories.RateStore
+	logger *slog.Logger
+}
+
+// NewVoteReconciler creates a reconciler for the given store
+func NewVoteReconciler(store repositories.RateStore, logger *slog.Logger) *VoteReconciler {
+	return &VoteReconciler{store: store, logger: logger}
+}
+
+// Reconcile recomputes all vote totals once and logs how many were corrected
+func (v *VoteReconciler) Reconcile() {
+	fixed, err := v.store.Reconcile()
+	if err != nil {
+		v.logger.Error("Error reconciling vote totals", "error", err)
+		return
+	}
+	if fixed > 0 {
+		metrics.VoteTotalsCorrected.Add(float64(fixed))
+		v.logger.Warn("Corrected vote totals", "count", fixed)
+	}
+}
+
+// Watch reconciles the vote totals every interval until stop is closed
+func (v *VoteReconciler) Watch(interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			v.Reconcile()
+		}
+	}
+}
+
+// RankingRefresher recomputes the ranking scores of posts and comments. Votes
+// keep the scores current, but the top windows and the rising score also
+// change as time passes.
+type RankingRefresher struct {
+	store  repositories.RateStore
+	clock  clock.Clock
+	logger *slog.Logger
+}
+
+// NewRankingRefresher creates a refresher for the given store
+func NewRankingRefresher(store repositories.RateStore, clk clock.Clock, logger *slog.Logger) *RankingRefresher {
+	return &RankingRefresher{store: store, clock: clk, logger: logger}
+}
+
+// Refresh recomputes all ranking scores once
+func (rr *RankingRefresher) Refresh() {
+	start := rr.clock.Now()
+	refreshed, err := rr.store.RefreshRankings(start)
+	if err != nil {
+		rr.logger.Error("Error refreshing rankings", "error", err)
+		return
+	}
+	rr.logger.Debug("Refreshed rankings", "changed", refreshed, "duration", rr.clock.Now().Sub(start))
+}
+
+// Watch refreshes the ranking scores every interval until stop is closed
+func (rr *RankingRefresher) Watch(interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			rr.Refresh()
+		}
+	}
+}
@@ -0,0 +1,15 @@
+package services
+
+import (
+	"project-root/config"
+)
+
+// Security applies the configured cookie, origin and admin policy
+type Security struct {
+	cfg config.SecurityConfig
+}
+
+// NewSecurity creates a Security that applies cfg
+func NewSecurity(cfg config.SecurityConfig) *Security {
+	return &Security{cfg: cfg}
+}
@@ -2,9 +2,28 @@ package services
 
 import (
 	"net/http"
+	"project-root/config"
+	"project-root/pkg/ranking"
 	"strconv"
+	"strings"
 )
 
+// rankedSorts order by the ranking scores, which only posts and comments have
+var rankedSorts = map[string]bool{
+	"hot":           true,
+	"top":           true,
+	"controversial": true,
+	"rising":        true,
+}
+
+// topPeriod returns the period of a "top_<period>" sort
+func topPeriod(sorting string) (ranking.Period, bool) {
+	if !strings.HasPrefix(sorting, "top_") {
+		return ranking.Period{}, false
+	}
+	return ranking.PeriodByName(strings.TrimPrefix(sorting, "top_"))
+}
+
 func GetSortingCriteria(sorting, param string) (sortBy, sqlSortExp string) {
 	switch sorting {
 	case "old":
@@ -16,14 +35,34 @@ func GetSortingCriteria(sorting, param string) (sortBy, sqlSortExp string) {
 	case "name_ABC":
 		sortBy = "name_ABC"
 		sqlSortExp = "LOWER(" + param + ".nickname) ASC"
+	case "hot":
+		sortBy = "hot"
+		sqlSortExp = param + ".hot DESC"
+	case "top":
+		// The top of all time is the rate
+		sortBy = "top"
+		sqlSortExp = param + ".rate DESC"
+	case "controversial":
+		sortBy = "controversial"
+		sqlSortExp = param + ".controversy DESC"
+	case "rising":
+		sortBy = "rising"
+		sqlSortExp = param + ".rising DESC"
 	default:
-		sortBy = "new" 
+		if period, ok := topPeriod(sorting); ok {
+			sortBy = sorting
+			sqlSortExp = param + "." + period.Column() + " DESC"
+			break
+		}
+		sortBy = "new"
 		sqlSortExp = param + ".created_at DESC"
 	}
 	return sortBy, sqlSortExp
 }
 
-func ExtractPaginationParams(r *http.Request, baseSortType, sortWhat string) (sortBy, sqlSortExp string, page, pageSize int) {
+// ExtractPaginationParams reads the sorting and paging parameters of a list
+// request, keeping the page size within limits
+func ExtractPaginationParams(r *http.Request, limits config.PaginationConfig, baseSortType, sortWhat string) (sortBy, sqlSortExp string, page, pageSize int) {
 	sortBy = r.URL.Query().Get("sort")
 	pageParam := r.URL.Query().Get("page")
 	page, err := strconv.Atoi(pageParam)
@@ -34,12 +73,23 @@ func ExtractPaginationParams(r *http.Request, baseSortType, sortWhat string) (so
 	pageSizeParam := r.URL.Query().Get("pageSize")
 	pageSize, err = strconv.Atoi(pageSizeParam)
 	if err != nil || pageSize <= 0 {
-		pageSize = 20
+		pageSize = limits.DefaultPageSize
+	}
+	if pageSize > limits.MaxPageSize {
+		pageSize = limits.MaxPageSize
+	}
+
+	// "top" takes its window from the period parameter: day, week, month, year or all
+	if period := r.URL.Query().Get("period"); sortBy == "top" && period != "" && period != "all" {
+		sortBy = "top_" + period
 	}
+	_, isTopPeriod := topPeriod(sortBy)
+	ranked := rankedSorts[sortBy] || isTopPeriod
 
-	// Validate sortBy to ensure it is one of "new", "old", or "popular"
-	switch sortBy {
-	case "new", "old", "popular", "name_ABC":
+	// Validate sortBy to ensure it is a known sorting; rankings apply to posts and comments only
+	switch {
+	case sortBy == "new", sortBy == "old", sortBy == "popular", sortBy == "name_ABC",
+		ranked && (sortWhat == "posts" || sortWhat == "comments"):
 		// Retrieve the SQL sorting expression based on sortBy
 		sortBy, sqlSortExp = GetSortingCriteria(sortBy, sortWhat)
 	default:
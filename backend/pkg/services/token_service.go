@@ -0,0 +1,75 @@
+package services
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+)
+
+// Scopes that can be granted to a personal access token.
+// Cookie sessions are not restricted by scopes.
+const (
+	ScopePostsRead        = "posts:read"
+	ScopePostsWrite       = "posts:write"
+	ScopeCommentsWrite    = "comments:write"
+	ScopeRatesWrite       = "rates:write"
+	ScopeUsersRead        = "users:read"
+	ScopeFollowsRead      = "follows:read"
+	ScopeFollowsWrite     = "follows:write"
+	ScopeBookmarksRead    = "bookmarks:read"
+	ScopeBookmarksWrite   = "bookmarks:write"
+	ScopeChatsRead        = "chats:read"
+	ScopeChatsWrite       = "chats:write"
+	ScopeAttachmentsRead  = "attachments:read"
+	ScopeAttachmentsWrite = "attachments:write"
+	ScopeReactionsWrite   = "reactions:write"
+	ScopePollsWrite       = "polls:write"
+)
+
+// TokenPrefix marks personal access tokens so they are easy to recognise in logs and secret scanners.
+const TokenPrefix = "rtf_"
+
+// ValidScopes lists every scope a token may be created with
+var ValidScopes = map[string]bool{
+	ScopePostsRead:        true,
+	ScopePostsWrite:       true,
+	ScopeCommentsWrite:    true,
+	ScopeRatesWrite:       true,
+	ScopeUsersRead:        true,
+	ScopeFollowsRead:      true,
+	ScopeFollowsWrite:     true,
+	ScopeBookmarksRead:    true,
+	ScopeBookmarksWrite:   true,
+	ScopeChatsRead:        true,
+	ScopeChatsWrite:       true,
+	ScopeAttachmentsRead:  true,
+	ScopeAttachmentsWrite: true,
+	ScopeReactionsWrite:   true,
+	ScopePollsWrite:       true,
+}
+
+// GenerateToken creates a new random token secret
+func GenerateToken() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return TokenPrefix + base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+// HashToken returns the hex encoded SHA-256 hash under which a token is stored
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// hasScope reports whether scope is present in the granted list
+func hasScope(granted []string, scope string) bool {
+	for _, s := range granted {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
@@ -1,24 +1,49 @@
 package services
 
 import (
+	"fmt"
+	"net/url"
+	"project-root/config"
 	"project-root/pkg/api"
 	"regexp"
 	"strings"
 	"time"
+	"unicode"
+	"unicode/utf8"
 )
 
 type ValidatorFunc func(interface{}) []api.ValidationError
 
-// Validators is a map of operation types to their respective validation functions
-var Validators = map[string]ValidatorFunc{
-	"registration": validateRegistration,
-	"post":         validatePost,
-	"comment":      validateComment,
+// Validator checks user input against the configured limits
+type Validator struct {
+	limits config.ValidationConfig
+	// validators maps operation types to their validation functions
+	validators map[string]ValidatorFunc
+}
+
+// NewValidator creates a Validator that enforces limits
+func NewValidator(limits config.ValidationConfig) *Validator {
+	v := &Validator{limits: limits}
+	v.validators = map[string]ValidatorFunc{
+		"registration": v.validateRegistration,
+		"post":         v.validatePost,
+		"comment":      v.validateComment,
+		"token":        v.validateToken,
+		"rate":         validateRate,
+		"collection":   v.validateCollection,
+		"bookmark":     validateBookmark,
+		"message":      v.validateMessage,
+		"reaction":     validateReaction,
+		"poll_vote":    v.validatePollVote,
+		"draft":        v.validateDraft,
+		"webhook":      validateWebhook,
+	}
+	return v
 }
 
 // ValidateOperation validates the operation based on operationType and data.
-func ValidateOperation(operationType string, data interface{}) []api.ValidationError {
-	validator, ok := Validators[operationType]
+func (v *Validator) ValidateOperation(operationType string, data interface{}) []api.ValidationError {
+	validator, ok := v.validators[operationType]
 	if !ok {
 		return []api.ValidationError{{Field: "", Message: "Unsupported operation type"}}
 	}
@@ -31,7 +56,7 @@ func containsWhitespace(s string) bool {
 	return strings.Contains(s, " ")
 }
 
-func validateRegistration(data interface{}) []api.ValidationError {
+func (v *Validator) validateRegistration(data interface{}) []api.ValidationError {
 	registrForm, ok := data.(api.RegistrationRequest)
 	if !ok {
 		return []api.ValidationError{{Field: "", Message: "Invalid data type for registration"}}
@@ -39,10 +64,10 @@ func validateRegistration(data interface{}) []api.ValidationError {
 
 	var validationErrors []api.ValidationError
 
-	if len(registrForm.Nickname) < 3 {
+	if len(registrForm.Nickname) < v.limits.NicknameMinLength {
 		validationErrors = append(validationErrors, api.ValidationError{
 			Field:   "nickname",
-			Message: "Nickname must be at least 3 characters long",
+			Message: fmt.Sprintf("Nickname must be at least %d characters long", v.limits.NicknameMinLength),
 		})
 	}
 	if containsWhitespace(registrForm.Nickname) {
@@ -57,10 +82,10 @@ func validateRegistration(data interface{}) []api.ValidationError {
 			Message: "Invalid email format",
 		})
 	}
-	if !isValidPassword(registrForm.Password) {
+	if !v.isValidPassword(registrForm.Password) {
 		validationErrors = append(validationErrors, api.ValidationError{
 			Field:   "password",
-			Message: "Password must be at least 6 characters long and contain at least one uppercase letter, one lowercase letter, one digit, and one special character",
+			Message: fmt.Sprintf("Password must be at least %d characters long and contain at least one uppercase letter, one lowercase letter, one digit, and one special character", v.limits.PasswordMinLength),
 		})
 	}
 	if registrForm.Age == "" {
@@ -115,8 +140,8 @@ func validateRegistration(data interface{}) []api.ValidationError {
 }
 
 // isValidPassword checks if the provided password meets the required criteria.
-func isValidPassword(password string) bool {
-	if len(password) < 6 {
+func (v *Validator) isValidPassword(password string) bool {
+	if len(password) < v.limits.PasswordMinLength {
 		return false
 	}
 	hasUpper := false
@@ -156,7 +181,7 @@ func isValidDate(dateStr string) bool {
 
 // validatePost validates the fields of PostCreateRequest.
 // Returns a slice of ValidationError if any field is invalid.
-func validatePost(data interface{}) []api.ValidationError {
+func (v *Validator) validatePost(data interface{}) []api.ValidationError {
 	postData, ok := data.(api.PostCreateRequest)
 	if !ok {
 		return []api.ValidationError{{Field: "", Message: "Invalid data type for post"}}
@@ -164,22 +189,22 @@ func validatePost(data interface{}) []api.ValidationError {
 
 	var validationErrors []api.ValidationError
 
-	// Validate title length (6 to 48 characters)
-	if len(postData.Title) < 6 || len(postData.Title) > 48 {
+	// Validate title length
+	if len(postData.Title) < v.limits.TitleMinLength || len(postData.Title) > v.limits.TitleMaxLength {
 		validationErrors = append(validationErrors, api.ValidationError{
 			Field:   "title",
-			Message: "Title length must be between 6 and 48 characters",
+			Message: fmt.Sprintf("Title length must be between %d and %d characters", v.limits.TitleMinLength, v.limits.TitleMaxLength),
 		})
 	}
 
 	// Trim leading and trailing whitespace from content
 	postData.Content = strings.TrimSpace(postData.Content)
 
-	// Validate content length (0 to 256 characters)
-	if len(postData.Content) > 256 {
+	// Validate content length
+	if len(postData.Content) > v.limits.PostMaxLength {
 		validationErrors = append(validationErrors, api.ValidationError{
 			Field:   "content",
-			Message: "Content length cannot exceed 256 characters",
+			Message: fmt.Sprintf("Content length cannot exceed %d characters", v.limits.PostMaxLength),
 		})
 	}
 
@@ -191,17 +216,17 @@ func validatePost(data interface{}) []api.ValidationError {
 		})
 	} else {
 		categories := ParseCategories(postData.Categories)
-		if len(categories) < 1 || len(categories) > 5 {
+		if len(categories) < 1 || len(categories) > v.limits.MaxCategories {
 			validationErrors = append(validationErrors, api.ValidationError{
 				Field:   "categories",
-				Message: "There must be between 1 and 5 categories",
+				Message: fmt.Sprintf("There must be between 1 and %d categories", v.limits.MaxCategories),
 			})
 		}
 		for _, category := range categories {
-			if len(category) < 1 || len(category) > 15 {
+			if len(category) < 1 || len(category) > v.limits.CategoryMaxLength {
 				validationErrors = append(validationErrors, api.ValidationError{
 					Field:   "categories",
-					Message: "Each category must be between 1 and 10 characters long",
+					Message: fmt.Sprintf("Each category must be between 1 and %d characters long", v.limits.CategoryMaxLength),
 				})
 			}
 			if containsWhitespace(category) {
@@ -213,12 +238,119 @@ func validatePost(data interface{}) []api.ValidationError {
 		}
 	}
 
+	validationErrors = append(validationErrors, v.validateAttachmentIDs(postData.AttachmentIDs)...)
+	if postData.Poll != nil {
+		validationErrors = append(validationErrors, v.validatePoll(*postData.Poll)...)
+	}
+
+	return validationErrors
+}
+
+// validatePoll checks the poll of a new post
+func (v *Validator) validatePoll(poll api.PollCreateRequest) []api.ValidationError {
+	var validationErrors []api.ValidationError
+
+	question := strings.TrimSpace(poll.Question)
+	if len(question) < 1 || len(question) > v.limits.PollQuestionMaxLength {
+		validationErrors = append(validationErrors, api.ValidationError{
+			Field:   "poll.question",
+			Message: fmt.Sprintf("Poll question must be between 1 and %d characters long", v.limits.PollQuestionMaxLength),
+		})
+	}
+
+	if len(poll.Options) < 2 || len(poll.Options) > v.limits.MaxPollOptions {
+		validationErrors = append(validationErrors, api.ValidationError{
+			Field:   "poll.options",
+			Message: fmt.Sprintf("A poll must have between 2 and %d options", v.limits.MaxPollOptions),
+		})
+	}
+	seen := make(map[string]bool)
+	for _, option := range poll.Options {
+		option = strings.TrimSpace(option)
+		if len(option) < 1 || len(option) > v.limits.PollOptionMaxLength {
+			validationErrors = append(validationErrors, api.ValidationError{
+				Field:   "poll.options",
+				Message: fmt.Sprintf("Each poll option must be between 1 and %d characters long", v.limits.PollOptionMaxLength),
+			})
+			break
+		}
+		if seen[option] {
+			validationErrors = append(validationErrors, api.ValidationError{
+				Field:   "poll.options",
+				Message: "Poll options must be distinct",
+			})
+			break
+		}
+		seen[option] = true
+	}
+
+	if poll.ClosesAt != nil && !poll.ClosesAt.After(time.Now()) {
+		validationErrors = append(validationErrors, api.ValidationError{
+			Field:   "poll.closes_at",
+			Message: "Poll closing time must be in the future",
+		})
+	}
+
+	return validationErrors
+}
+
+// validateDraft checks a draft. Unscheduled drafts may be incomplete and only
+// have to fit; scheduled ones must make a valid post, at a time in the future.
+func (v *Validator) validateDraft(data interface{}) []api.ValidationError {
+	draftData, ok := data.(api.DraftRequest)
+	if !ok {
+		return []api.ValidationError{{Field: "", Message: "Invalid data type for draft"}}
+	}
+
+	if draftData.PublishAt != nil {
+		validationErrors := v.validatePost(api.Draft{
+			Title:         draftData.Title,
+			Content:       draftData.Content,
+			Categories:    draftData.Categories,
+			AttachmentIDs: draftData.AttachmentIDs,
+			Poll:          draftData.Poll,
+		}.PostCreateRequest())
+		if !draftData.PublishAt.After(time.Now()) {
+			validationErrors = append(validationErrors, api.ValidationError{
+				Field:   "publish_at",
+				Message: "Publishing time must be in the future",
+			})
+		}
+		return validationErrors
+	}
+
+	var validationErrors []api.ValidationError
+	if len(draftData.Title) > v.limits.TitleMaxLength {
+		validationErrors = append(validationErrors, api.ValidationError{
+			Field:   "title",
+			Message: fmt.Sprintf("Title length cannot exceed %d characters", v.limits.TitleMaxLength),
+		})
+	}
+	if len(strings.TrimSpace(draftData.Content)) > v.limits.PostMaxLength {
+		validationErrors = append(validationErrors, api.ValidationError{
+			Field:   "content",
+			Message: fmt.Sprintf("Content length cannot exceed %d characters", v.limits.PostMaxLength),
+		})
+	}
+	if len(ParseCategories(draftData.Categories)) > v.limits.MaxCategories {
+		validationErrors = append(validationErrors, api.ValidationError{
+			Field:   "categories",
+			Message: fmt.Sprintf("There can be at most %d categories", v.limits.MaxCategories),
+		})
+	}
+	validationErrors = append(validationErrors, v.validateAttachmentIDs(draftData.AttachmentIDs)...)
+	if draftData.Poll != nil && len(draftData.Poll.Options) > v.limits.MaxPollOptions {
+		validationErrors = append(validationErrors, api.ValidationError{
+			Field:   "poll.options",
+			Message: fmt.Sprintf("A poll can have at most %d options", v.limits.MaxPollOptions),
+		})
+	}
 	return validationErrors
 }
 
 // validateComment validates the fields of CommentCreateRequest.
 // Returns a slice of ValidationError if any field is invalid.
-func validateComment(data interface{}) []api.ValidationError {
+func (v *Validator) validateComment(data interface{}) []api.ValidationError {
 	commentData, ok := data.(api.CommentCreateRequest)
 	if !ok {
 		return []api.ValidationError{{Field: "", Message: "Invalid data type for comment"}}
@@ -229,13 +361,310 @@ func validateComment(data interface{}) []api.ValidationError {
 	// Trim leading and trailing whitespace from content
 	commentData.Content = strings.TrimSpace(commentData.Content)
 
-	// Validate content length (1 to 256 characters)
-	if len(commentData.Content) < 1 || len(commentData.Content) > 256 {
+	// Validate content length
+	if len(commentData.Content) < 1 || len(commentData.Content) > v.limits.CommentMaxLength {
 		validationErrors = append(validationErrors, api.ValidationError{
 			Field:   "content",
-			Message: "Content must be between 1 and 256 characters long",
+			Message: fmt.Sprintf("Content must be between 1 and %d characters long", v.limits.CommentMaxLength),
+		})
+	}
+
+	validationErrors = append(validationErrors, v.validateAttachmentIDs(commentData.AttachmentIDs)...)
+
+	return validationErrors
+}
+
+// validateMessage validates the fields of a chat message sent over the WebSocket.
+// Returns a slice of ValidationError if any field is invalid.
+func (v *Validator) validateMessage(data interface{}) []api.ValidationError {
+	messageData, ok := data.(api.MessageMessage)
+	if !ok {
+		return []api.ValidationError{{Field: "", Message: "Invalid data type for message"}}
+	}
+
+	return v.validateAttachmentIDs(messageData.AttachmentIDs)
+}
+
+// validateAttachmentIDs checks the number of attachments of new content
+func (v *Validator) validateAttachmentIDs(ids []int) []api.ValidationError {
+	if len(ids) > v.limits.MaxAttachments {
+		return []api.ValidationError{{
+			Field:   "attachment_ids",
+			Message: fmt.Sprintf("There can be at most %d attachments", v.limits.MaxAttachments),
+		}}
+	}
+	return nil
+}
+
+// validateToken validates the fields of TokenCreateRequest.
+// Returns a slice of ValidationError if any field is invalid.
+func (v *Validator) validateToken(data interface{}) []api.ValidationError {
+	tokenData, ok := data.(api.TokenCreateRequest)
+	if !ok {
+		return []api.ValidationError{{Field: "", Message: "Invalid data type for token"}}
+	}
+
+	var validationErrors []api.ValidationError
+
+	// Validate name length
+	if len(tokenData.Name) < 1 || len(tokenData.Name) > v.limits.TokenNameMaxLength {
+		validationErrors = append(validationErrors, api.ValidationError{
+			Field:   "name",
+			Message: fmt.Sprintf("Name must be between 1 and %d characters long", v.limits.TokenNameMaxLength),
+		})
+	}
+
+	// Validate scopes
+	if len(tokenData.Scopes) == 0 {
+		validationErrors = append(validationErrors, api.ValidationError{
+			Field:   "scopes",
+			Message: "At least one scope is required",
+		})
+	}
+	for _, scope := range tokenData.Scopes {
+		if !ValidScopes[scope] {
+			validationErrors = append(validationErrors, api.ValidationError{
+				Field:   "scopes",
+				Message: "Unknown scope: " + scope,
+			})
+		}
+	}
+
+	// Validate expiration (0 means the token never expires)
+	if tokenData.ExpiresInDays < 0 || tokenData.ExpiresInDays > v.limits.TokenMaxLifetimeDays {
+		validationErrors = append(validationErrors, api.ValidationError{
+			Field:   "expires_in_days",
+			Message: fmt.Sprintf("Expiration must be between 0 and %d days", v.limits.TokenMaxLifetimeDays),
+		})
+	}
+
+	return validationErrors
+}
+
+// validateWebhook checks that a webhook posts to an absolute HTTP(S) URL and
+// subscribes to known events
+func validateWebhook(data interface{}) []api.ValidationError {
+	webhookData, ok := data.(api.WebhookRequest)
+	if !ok {
+		return []api.ValidationError{{Field: "", Message: "Invalid data type for webhook"}}
+	}
+
+	var validationErrors []api.ValidationError
+
+	endpoint, err := url.Parse(webhookData.URL)
+	if err != nil || (endpoint.Scheme != "http" && endpoint.Scheme != "https") || endpoint.Host == "" {
+		validationErrors = append(validationErrors, api.ValidationError{
+			Field:   "url",
+			Message: "URL must be an absolute http or https URL",
+		})
+	}
+
+	if len(webhookData.Events) == 0 {
+		validationErrors = append(validationErrors, api.ValidationError{
+			Field:   "events",
+			Message: "At least one event is required",
+		})
+	}
+	for _, event := range webhookData.Events {
+		if !ValidWebhookEvents[event] {
+			validationErrors = append(validationErrors, api.ValidationError{
+				Field:   "events",
+				Message: "Unknown event: " + event,
+			})
+		}
+	}
+
+	return validationErrors
+}
+
+func validateRate(data interface{}) []api.ValidationError {
+	rateData, ok := data.(api.RateRequest)
+	if !ok {
+		return []api.ValidationError{{Field: "", Message: "Invalid data type for rate"}}
+	}
+
+	var validationErrors []api.ValidationError
+
+	if rateData.Status != "up" && rateData.Status != "down" {
+		validationErrors = append(validationErrors, api.ValidationError{
+			Field:   "status",
+			Message: "Status must be either up or down",
+		})
+	}
+	if rateData.PostID <= 0 {
+		validationErrors = append(validationErrors, api.ValidationError{
+			Field:   "post_id",
+			Message: "Post ID must be a positive number",
+		})
+	}
+	if rateData.CommentID < 0 {
+		validationErrors = append(validationErrors, api.ValidationError{
+			Field:   "comment_id",
+			Message: "Comment ID must not be negative",
+		})
+	}
+
+	return validationErrors
+}
+
+// validateCollection validates the fields of BookmarkCollectionRequest.
+func (v *Validator) validateCollection(data interface{}) []api.ValidationError {
+	collectionData, ok := data.(api.BookmarkCollectionRequest)
+	if !ok {
+		return []api.ValidationError{{Field: "", Message: "Invalid data type for collection"}}
+	}
+
+	var validationErrors []api.ValidationError
+
+	if len(collectionData.Name) < 1 || len(collectionData.Name) > v.limits.CollectionNameMaxLength {
+		validationErrors = append(validationErrors, api.ValidationError{
+			Field:   "name",
+			Message: fmt.Sprintf("Name must be between 1 and %d characters long", v.limits.CollectionNameMaxLength),
+		})
+	}
+
+	return validationErrors
+}
+
+func validateBookmark(data interface{}) []api.ValidationError {
+	bookmarkData, ok := data.(api.BookmarkRequest)
+	if !ok {
+		return []api.ValidationError{{Field: "", Message: "Invalid data type for bookmark"}}
+	}
+
+	var validationErrors []api.ValidationError
+
+	if bookmarkData.PostID <= 0 {
+		validationErrors = append(validationErrors, api.ValidationError{
+			Field:   "post_id",
+			Message: "Post ID must be a positive number",
+		})
+	}
+	if bookmarkData.CommentID < 0 {
+		validationErrors = append(validationErrors, api.ValidationError{
+			Field:   "comment_id",
+			Message: "Comment ID must not be negative",
 		})
 	}
 
 	return validationErrors
 }
+
+func validateReaction(data interface{}) []api.ValidationError {
+	reactionData, ok := data.(api.ReactionRequest)
+	if !ok {
+		return []api.ValidationError{{Field: "", Message: "Invalid data type for reaction"}}
+	}
+
+	var validationErrors []api.ValidationError
+
+	if reactionData.ChatHash != "" {
+		if reactionData.MessageID <= 0 {
+			validationErrors = append(validationErrors, api.ValidationError{
+				Field:   "message_id",
+				Message: "Message ID must be a positive number",
+			})
+		}
+		if reactionData.PostID != 0 || reactionData.CommentID != 0 {
+			validationErrors = append(validationErrors, api.ValidationError{
+				Field:   "chat_hash",
+				Message: "React either to a chat message or to a post or comment",
+			})
+		}
+	} else {
+		if reactionData.PostID <= 0 {
+			validationErrors = append(validationErrors, api.ValidationError{
+				Field:   "post_id",
+				Message: "Post ID must be a positive number",
+			})
+		}
+		if reactionData.CommentID < 0 {
+			validationErrors = append(validationErrors, api.ValidationError{
+				Field:   "comment_id",
+				Message: "Comment ID must not be negative",
+			})
+		}
+	}
+	if !validEmoji(reactionData.Emoji) {
+		validationErrors = append(validationErrors, api.ValidationError{
+			Field:   "emoji",
+			Message: "Emoji must be a single emoji",
+		})
+	}
+
+	return validationErrors
+}
+
+// emojiMaxLength bounds the bytes of a reaction; family and flag sequences
+// stay well below it
+const emojiMaxLength = 64
+
+// validEmoji reports whether s is a single emoji: a symbol, a flag of two
+// regional indicators or a keycap, possibly with variation selectors, skin
+// tone modifiers and tags, or several such joined by zero width joiners
+func validEmoji(s string) bool {
+	if s == "" || len(s) > emojiMaxLength || !utf8.ValidString(s) {
+		return false
+	}
+	keycap := strings.ContainsRune(s, '\u20E3')
+
+	bases := 0
+	joined := false
+	var prev rune
+	for _, r := range s {
+		switch {
+		case r == '\u200D': // zero width joiner
+			if bases == 0 || joined {
+				return false
+			}
+			joined = true
+		case r == '\uFE0E' || r == '\uFE0F' || r == '\u20E3' ||
+			(r >= 0x1F3FB && r <= 0x1F3FF) || (r >= 0xE0020 && r <= 0xE007F):
+			// variation selectors, keycap, skin tones and tags modify the base
+			if bases == 0 {
+				return false
+			}
+		case unicode.Is(unicode.So, r) || (keycap && strings.ContainsRune("0123456789#*", r)):
+			flag := isRegionalIndicator(r) && isRegionalIndicator(prev) && bases%2 == 1
+			if bases > 0 && !joined && !flag {
+				return false
+			}
+			bases++
+			joined = false
+			prev = r
+		default:
+			return false
+		}
+	}
+	return bases > 0 && !joined
+}
+
+func isRegionalIndicator(r rune) bool {
+	return r >= 0x1F1E6 && r <= 0x1F1FF
+}
+
+// validatePollVote checks that a ballot names distinct options
+func (v *Validator) validatePollVote(data interface{}) []api.ValidationError {
+	voteData, ok := data.(api.PollVoteRequest)
+	if !ok {
+		return []api.ValidationError{{Field: "", Message: "Invalid data type for poll vote"}}
+	}
+
+	if len(voteData.OptionIDs) == 0 || len(voteData.OptionIDs) > v.limits.MaxPollOptions {
+		return []api.ValidationError{{
+			Field:   "option_ids",
+			Message: fmt.Sprintf("Vote for between 1 and %d options", v.limits.MaxPollOptions),
+		}}
+	}
+	seen := make(map[int]bool)
+	for _, id := range voteData.OptionIDs {
+		if id <= 0 || seen[id] {
+			return []api.ValidationError{{
+				Field:   "option_ids",
+				Message: "Option IDs must be distinct positive numbers",
+			}}
+		}
+		seen[id] = true
+	}
+	return nil
+}
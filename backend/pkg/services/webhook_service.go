@@ -0,0 +1,276 @@
+package services
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"project-root/pkg/api"
+	"project-root/pkg/clock"
+	"project-root/pkg/metrics"
+	"project-root/pkg/repositories"
+)
+
+// ValidWebhookEvents lists every event a webhook may subscribe to. Chat
+// messages are private and never published.
+var ValidWebhookEvents = map[string]bool{
+	api.EventPostCreated:    true,
+	api.EventCommentCreated: true,
+	api.EventRateChanged:    true,
+	api.EventUserRegistered: true,
+	api.EventChatCreated:    true,
+}
+
+const (
+	// webhookBatchSize is how many due deliveries are sent at the same time
+	webhookBatchSize = 32
+	// webhookClaimMargin is added to the timeout when claiming deliveries, so
+	// a claim only runs out when its dispatcher stopped while sending
+	webhookClaimMargin = time.Minute
+)
+
+// WebhookPolicy sets how deliveries are sent and retried
+type WebhookPolicy struct {
+	// Timeout bounds each request to an endpoint
+	Timeout time.Duration
+	// MaxAttempts is how many times a delivery is sent before it is failed
+	MaxAttempts int
+	// BackoffBase is the wait after the first failed attempt, doubled after
+	// every further one up to BackoffMax
+	BackoffBase time.Duration
+	BackoffMax  time.Duration
+}
+
+// WebhookDispatcher queues events for the webhooks subscribed to them and
+// sends the deliveries. The queue lives in the store, so deliveries survive
+// restarts and are retried with exponential backoff until an endpoint
+// answers with a 2xx status or the attempts run out.
+//
+// Every delivery is a POST of the JSON WebhookPayload with these headers:
+//
+//	X-Webhook-Event      the event, e.g. post.created
+//	X-Webhook-Delivery   the ID of the delivery in the delivery log
+//	X-Webhook-Timestamp  the Unix time of the attempt
+//	X-Webhook-Signature  sha256=<hex HMAC-SHA256 of "<timestamp>.<body>" keyed with the webhook secret>
+//
+// A delivery may arrive more than once; the payload ID tells repeats apart.
+type WebhookDispatcher struct {
+	store  repositories.WebhookStore
+	client *http.Client
+	clock  clock.Clock
+	policy WebhookPolicy
+	logger *slog.Logger
+	wake   chan struct{}
+}
+
+// NewWebhookDispatcher creates a dispatcher for the webhooks in store
+func NewWebhookDispatcher(store repositories.WebhookStore, clk clock.Clock, policy WebhookPolicy, logger *slog.Logger) *WebhookDispatcher {
+	return &WebhookDispatcher{
+		store: store,
+		client: &http.Client{
+			Timeout: policy.Timeout,
+			// A redirect is an answer of its own, which is not a 2xx
+			CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+		},
+		clock:  clk,
+		policy: policy,
+		logger: logger,
+		wake:   make(chan struct{}, 1),
+	}
+}
+
+// Subscribe has the events on bus that webhooks may subscribe to queued for
+// the active webhooks subscribed to them
+func (d *WebhookDispatcher) Subscribe(bus *EventBus) {
+	for event := range ValidWebhookEvents {
+		bus.Subscribe(event, "webhooks", d.enqueue)
+	}
+}
+
+// enqueue queues an event for every active webhook subscribed to it. The
+// payload ID is the ID of the event in the outbox, so that it stays the same
+// when the bus hands the event out again.
+func (d *WebhookDispatcher) enqueue(event api.OutboxEvent) error {
+	payload, err := json.Marshal(api.WebhookPayload{
+		ID:        strconv.Itoa(event.ID),
+		Event:     event.Name,
+		CreatedAt: event.CreatedAt.UTC(),
+		Data:      event.Payload,
+	})
+	if err != nil {
+		return err
+	}
+	queued, err := d.store.EnqueueDeliveries(event.Name, payload, d.clock.Now())
+	if err != nil {
+		return err
+	}
+	if queued > 0 {
+		d.Wake()
+	}
+	return nil
+}
+
+// Wake makes Watch send the due deliveries without waiting for the next tick
+func (d *WebhookDispatcher) Wake() {
+	select {
+	case d.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Watch sends the due deliveries whenever events are published and every
+// interval, for retries, until stop is closed
+func (d *WebhookDispatcher) Watch(interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		case <-d.wake:
+		}
+		d.DeliverDue()
+	}
+}
+
+// DeliverDue sends the deliveries that are due, a batch at a time
+func (d *WebhookDispatcher) DeliverDue() {
+	for {
+		now := d.clock.Now()
+		deliveries, err := d.store.ClaimDueDeliveries(now, now.Add(d.policy.Timeout+webhookClaimMargin), webhookBatchSize)
+		if err != nil {
+			d.logger.Error("Error claiming webhook deliveries", "error", err)
+			return
+		}
+
+		var wg sync.WaitGroup
+		for _, delivery := range deliveries {
+			wg.Add(1)
+			go func(delivery api.WebhookDelivery) {
+				defer wg.Done()
+				d.deliver(delivery)
+			}(delivery)
+		}
+		wg.Wait()
+
+		if len(deliveries) < webhookBatchSize {
+			return
+		}
+	}
+}
+
+// deliver makes one attempt to send a delivery and stores its outcome
+func (d *WebhookDispatcher) deliver(delivery api.WebhookDelivery) {
+	webhook, err := d.store.GetWebhook(delivery.WebhookID)
+	if errors.Is(err, repositories.ErrWebhookNotFound) {
+		// Deleted with its deliveries since they were claimed
+		return
+	}
+	if err != nil {
+		d.logger.Error("Error fetching webhook", "webhook_id", delivery.WebhookID, "error", err)
+		return
+	}
+
+	var statusCode int
+	if webhook.Active {
+		statusCode, err = d.send(*webhook, delivery)
+	} else {
+		err = errors.New("webhook is inactive")
+	}
+
+	now := d.clock.Now()
+	delivery.Attempts++
+	delivery.LastStatusCode = statusCode
+	delivery.LastError = ""
+	delivery.NextAttemptAt = nil
+	switch {
+	case err == nil:
+		metrics.WebhookDeliveries.Inc("delivered")
+		delivery.Status = api.DeliveryDelivered
+		delivery.DeliveredAt = &now
+	case !webhook.Active || delivery.Attempts >= d.policy.MaxAttempts:
+		metrics.WebhookDeliveries.Inc("failed")
+		d.logger.Warn("Webhook delivery failed", "webhook_id", webhook.ID, "delivery_id", delivery.ID, "attempts", delivery.Attempts, "error", err)
+		delivery.Status = api.DeliveryFailed
+		delivery.LastError = err.Error()
+	default:
+		metrics.WebhookDeliveries.Inc("retry")
+		next := now.Add(d.backoff(delivery.Attempts))
+		delivery.Status = api.DeliveryPending
+		delivery.LastError = err.Error()
+		delivery.NextAttemptAt = &next
+	}
+	if err := d.store.SaveDeliveryResult(delivery); err != nil {
+		d.logger.Error("Error saving webhook delivery", "delivery_id", delivery.ID, "error", err)
+	}
+}
+
+// send posts the payload of a delivery to the webhook and returns the status
+// of the answer. Answers other than 2xx are errors.
+func (d *WebhookDispatcher) send(webhook api.Webhook, delivery api.WebhookDelivery) (int, error) {
+	req, err := http.NewRequest(http.MethodPost, webhook.URL, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return 0, err
+	}
+	timestamp := strconv.FormatInt(d.clock.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "kood-rt-forum-webhooks")
+	req.Header.Set("X-Webhook-Event", delivery.Event)
+	req.Header.Set("X-Webhook-Delivery", strconv.Itoa(delivery.ID))
+	req.Header.Set("X-Webhook-Timestamp", timestamp)
+	req.Header.Set("X-Webhook-Signature", SignWebhookPayload(webhook.Secret, timestamp, delivery.Payload))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	// Drain a little of the body so the connection can be reused
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("endpoint answered %s", resp.Status)
+	}
+	return resp.StatusCode, nil
+}
+
+// backoff returns the wait after the given number of failed attempts
+func (d *WebhookDispatcher) backoff(attempts int) time.Duration {
+	wait := d.policy.BackoffBase
+	for i := 1; i < attempts && wait < d.policy.BackoffMax; i++ {
+		wait *= 2
+	}
+	return min(wait, d.policy.BackoffMax)
+}
+
+// GenerateWebhookSecret creates a new random secret for signing deliveries
+func GenerateWebhookSecret() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// SignWebhookPayload returns the X-Webhook-Signature of a body sent at the
+// given Unix timestamp. Signing the timestamp lets receivers reject replays.
+func SignWebhookPayload(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,290 @@
+package services
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"project-root/pkg/api"
+	"project-root/pkg/clock"
+	"project-root/pkg/repositories"
+	"project-root/pkg/repositories/memory"
+)
+
+// receivedRequest is a delivery as the receiver saw it
+type receivedRequest struct {
+	header http.Header
+	body   []byte
+}
+
+// webhookReceiver is an endpoint that records the deliveries it gets and
+// answers them with the status codes queued in answers, then with 200
+type webhookReceiver struct {
+	*httptest.Server
+	mu       sync.Mutex
+	received []receivedRequest
+	answers  []int
+}
+
+func newWebhookReceiver(t *testing.T, answers ...int) *webhookReceiver {
+	t.Helper()
+	r := &webhookReceiver{answers: answers}
+	r.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		body, _ := io.ReadAll(req.Body)
+		r.mu.Lock()
+		r.received = append(r.received, receivedRequest{header: req.Header.Clone(), body: body})
+		status := http.StatusOK
+		if len(r.answers) > 0 {
+			status, r.answers = r.answers[0], r.answers[1:]
+		}
+		r.mu.Unlock()
+		// Redirect answers point elsewhere, where a client following them would go
+		w.Header().Set("Location", "/elsewhere")
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(r.Close)
+	return r
+}
+
+// requests returns how many deliveries the receiver got
+func (r *webhookReceiver) requests() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.received)
+}
+
+// webhookFixture runs a dispatcher on the in-memory stores with a manual clock
+type webhookFixture struct {
+	store      repositories.WebhookStore
+	clock      *clock.Manual
+	dispatcher *WebhookDispatcher
+	webhook    api.Webhook
+}
+
+var testWebhookPolicy = WebhookPolicy{
+	Timeout:     time.Second,
+	MaxAttempts: 5,
+	BackoffBase: 30 * time.Second,
+	BackoffMax:  2 * time.Minute,
+}
+
+func newWebhookFixture(t *testing.T, url string) *webhookFixture {
+	t.Helper()
+	clk := clock.NewManual(time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC))
+	stores := memory.NewStores(clk)
+	webhook := api.Webhook{URL: url, Events: []string{api.EventPostCreated}, Active: true, Secret: "receiver-secret", CreatedAt: clk.Now()}
+	if err := stores.Webhooks.CreateWebhook(&webhook); err != nil {
+		t.Fatal(err)
+	}
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	return &webhookFixture{
+		store:      stores.Webhooks,
+		clock:      clk,
+		dispatcher: NewWebhookDispatcher(stores.Webhooks, clk, testWebhookPolicy, logger),
+		webhook:    webhook,
+	}
+}
+
+// publish queues a post.created event with the given outbox ID
+func (f *webhookFixture) publish(t *testing.T, eventID int) {
+	t.Helper()
+	err := f.dispatcher.enqueue(api.OutboxEvent{
+		ID:        eventID,
+		Name:      api.EventPostCreated,
+		Payload:   json.RawMessage(`{"post_id":42,"title":"Hello"}`),
+		CreatedAt: f.clock.Now(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// delivery returns the only delivery of the webhook
+func (f *webhookFixture) delivery(t *testing.T) api.WebhookDelivery {
+	t.Helper()
+	deliveries, total, _, err := f.store.GetDeliveries(f.webhook.ID, 1, 10)
+	if err != nil || total != 1 {
+		t.Fatalf("GetDeliveries = %d deliveries, %v; want one", total, err)
+	}
+	return deliveries[0]
+}
+
+func TestWebhookDeliverySignature(t *testing.T) {
+	receiver := newWebhookReceiver(t)
+	f := newWebhookFixture(t, receiver.URL)
+	f.publish(t, 7)
+	f.dispatcher.DeliverDue()
+
+	if n := receiver.requests(); n != 1 {
+		t.Fatalf("receiver got %d requests, want 1", n)
+	}
+	got := receiver.received[0]
+	timestamp := got.header.Get("X-Webhook-Timestamp")
+	if want := strconv.FormatInt(f.clock.Now().Unix(), 10); timestamp != want {
+		t.Errorf("X-Webhook-Timestamp = %q, want %q", timestamp, want)
+	}
+
+	// The receiver checks the signature the way the documentation tells it to
+	mac := hmac.New(sha256.New, []byte("receiver-secret"))
+	mac.Write([]byte(timestamp + "." + string(got.body)))
+	if want := "sha256=" + hex.EncodeToString(mac.Sum(nil)); !hmac.Equal([]byte(got.header.Get("X-Webhook-Signature")), []byte(want)) {
+		t.Errorf("X-Webhook-Signature = %q, want %q", got.header.Get("X-Webhook-Signature"), want)
+	}
+
+	delivery := f.delivery(t)
+	for header, want := range map[string]string{
+		"Content-Type":       "application/json",
+		"X-Webhook-Event":    api.EventPostCreated,
+		"X-Webhook-Delivery": strconv.Itoa(delivery.ID),
+	} {
+		if value := got.header.Get(header); value != want {
+			t.Errorf("%s = %q, want %q", header, value, want)
+		}
+	}
+
+	var payload struct {
+		ID        string          `json:"id"`
+		Event     string          `json:"event"`
+		CreatedAt time.Time       `json:"created_at"`
+		Data      json.RawMessage `json:"data"`
+	}
+	if err := json.Unmarshal(got.body, &payload); err != nil {
+		t.Fatal(err)
+	}
+	if payload.ID != "7" || payload.Event != api.EventPostCreated || !payload.CreatedAt.Equal(f.clock.Now()) || string(payload.Data) != `{"post_id":42,"title":"Hello"}` {
+		t.Errorf("payload = %+v", payload)
+	}
+	if delivery.Status != api.DeliveryDelivered || delivery.Attempts != 1 || delivery.LastStatusCode != http.StatusOK || delivery.DeliveredAt == nil {
+		t.Errorf("delivery = %+v, want delivered on the first attempt", delivery)
+	}
+}
+
+func TestWebhookRetriesOnBackoffSchedule(t *testing.T) {
+	receiver := newWebhookReceiver(t, http.StatusInternalServerError, http.StatusFound, http.StatusServiceUnavailable)
+	f := newWebhookFixture(t, receiver.URL)
+	f.publish(t, 1)
+
+	// 30s, doubled after every failure. The 302 of the second answer counts
+	// as a failure and is not followed, which the request count would show.
+	for attempt, wait := range []time.Duration{30 * time.Second, time.Minute} {
+		f.dispatcher.DeliverDue()
+		if n := receiver.requests(); n != attempt+1 {
+			t.Fatalf("attempt %d: receiver got %d requests", attempt+1, n)
+		}
+		delivery := f.delivery(t)
+		if want := f.clock.Now().Add(wait); delivery.Status != api.DeliveryPending || delivery.NextAttemptAt == nil || !delivery.NextAttemptAt.Equal(want) {
+			t.Fatalf("attempt %d: delivery = %+v, want pending until %v", attempt+1, delivery, want)
+		}
+
+		f.clock.Advance(wait - time.Second)
+		f.dispatcher.DeliverDue()
+		if n := receiver.requests(); n != attempt+1 {
+			t.Fatalf("attempt %d was retried %v early", attempt+1, time.Second)
+		}
+		f.clock.Advance(time.Second)
+	}
+
+	f.dispatcher.DeliverDue() // answered 503
+	delivery := f.delivery(t)
+	if delivery.Attempts != 3 || delivery.LastStatusCode != http.StatusServiceUnavailable || delivery.LastError == "" {
+		t.Errorf("after the third attempt: delivery = %+v", delivery)
+	}
+	f.clock.Advance(2 * time.Minute)
+	f.dispatcher.DeliverDue() // answered 200
+	delivery = f.delivery(t)
+	if delivery.Status != api.DeliveryDelivered || delivery.Attempts != 4 || delivery.LastError != "" || delivery.NextAttemptAt != nil {
+		t.Errorf("after recovering: delivery = %+v, want delivered on the fourth attempt", delivery)
+	}
+
+	// Every attempt carried the same payload ID for the receiver to tell repeats apart
+	ids := map[string]bool{}
+	for _, r := range receiver.received {
+		var payload api.WebhookPayload
+		if err := json.Unmarshal(r.body, &payload); err != nil {
+			t.Fatal(err)
+		}
+		ids[payload.ID] = true
+	}
+	if len(ids) != 1 || !ids["1"] {
+		t.Errorf("payload IDs across attempts = %v, want only 1", ids)
+	}
+}
+
+func TestWebhookDeadLettersAfterMaxAttempts(t *testing.T) {
+	receiver := newWebhookReceiver(t, http.StatusInternalServerError, http.StatusInternalServerError,
+		http.StatusInternalServerError, http.StatusInternalServerError, http.StatusInternalServerError)
+	f := newWebhookFixture(t, receiver.URL)
+	f.publish(t, 1)
+
+	// The backoff stops growing at BackoffMax
+	schedule := []time.Duration{30 * time.Second, time.Minute, 2 * time.Minute, 2 * time.Minute}
+	for _, wait := range schedule {
+		f.dispatcher.DeliverDue()
+		if delivery := f.delivery(t); delivery.NextAttemptAt == nil || !delivery.NextAttemptAt.Equal(f.clock.Now().Add(wait)) {
+			t.Fatalf("delivery = %+v, want the next attempt in %v", delivery, wait)
+		}
+		f.clock.Advance(wait)
+	}
+	f.dispatcher.DeliverDue()
+
+	delivery := f.delivery(t)
+	if delivery.Status != api.DeliveryFailed || delivery.Attempts != testWebhookPolicy.MaxAttempts || delivery.NextAttemptAt != nil ||
+		delivery.LastStatusCode != http.StatusInternalServerError || delivery.LastError == "" {
+		t.Fatalf("after %d attempts: delivery = %+v, want failed", testWebhookPolicy.MaxAttempts, delivery)
+	}
+
+	// A failed delivery stays put however long the dispatcher keeps running
+	f.clock.Advance(24 * time.Hour)
+	f.dispatcher.DeliverDue()
+	if n := receiver.requests(); n != testWebhookPolicy.MaxAttempts {
+		t.Errorf("receiver got %d requests, want %d", n, testWebhookPolicy.MaxAttempts)
+	}
+
+	// Redelivering starts a fresh series of attempts
+	if _, err := f.store.RedeliverDelivery(f.webhook.ID, delivery.ID, f.clock.Now()); err != nil {
+		t.Fatal(err)
+	}
+	f.dispatcher.DeliverDue()
+	if delivery := f.delivery(t); delivery.Status != api.DeliveryDelivered || delivery.Attempts != 1 {
+		t.Errorf("after redelivering: delivery = %+v, want delivered on the first attempt", delivery)
+	}
+}
+
+func TestWebhookTimeoutAndInactiveWebhooks(t *testing.T) {
+	release := make(chan struct{})
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer slow.Close()
+	defer close(release)
+
+	f := newWebhookFixture(t, slow.URL)
+	f.publish(t, 1)
+	f.dispatcher.DeliverDue()
+	if delivery := f.delivery(t); delivery.Status != api.DeliveryPending || delivery.Attempts != 1 || delivery.LastStatusCode != 0 || delivery.LastError == "" {
+		t.Errorf("after a timeout: delivery = %+v, want a retry without a status", delivery)
+	}
+
+	// Deliveries of a paused webhook fail without being sent
+	f.webhook.Active = false
+	if err := f.store.UpdateWebhook(f.webhook); err != nil {
+		t.Fatal(err)
+	}
+	f.clock.Advance(testWebhookPolicy.BackoffBase)
+	f.dispatcher.DeliverDue()
+	if delivery := f.delivery(t); delivery.Status != api.DeliveryFailed || delivery.Attempts != 2 {
+		t.Errorf("after pausing: delivery = %+v, want failed", delivery)
+	}
+}
@@ -0,0 +1,188 @@
+// Package syndication renders lists of posts as Atom 1.0 and RSS 2.0 feeds
+// for feed readers. Documents are written with encoding/xml, which escapes
+// all text and attributes and replaces characters XML cannot carry, so user
+// content cannot break out of its element.
+package syndication
+
+import (
+	"bytes"
+	"encoding/xml"
+	"time"
+)
+
+// Feed is a list of posts, newest first
+type Feed struct {
+	Title       string
+	Description string
+	// Link is the page the feed mirrors, Self the URL of the feed itself
+	Link    string
+	Self    string
+	Updated time.Time
+	Entries []Entry
+}
+
+// Entry is a post in a feed. Link is the permanent URL of the post and also
+// serves as its ID. Content is the rendered and sanitized HTML of the post,
+// which feeds carry escaped.
+type Entry struct {
+	Title      string
+	Link       string
+	Author     string
+	Published  time.Time
+	Content    string
+	Categories []string
+}
+
+// Content types of the documents
+const (
+	AtomContentType = "application/atom+xml; charset=utf-8"
+	RSSContentType  = "application/rss+xml; charset=utf-8"
+)
+
+type atomFeed struct {
+	XMLName  xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	Title    string      `xml:"title"`
+	Subtitle string      `xml:"subtitle,omitempty"`
+	ID       string      `xml:"id"`
+	Links    []atomLink  `xml:"link"`
+	Updated  string      `xml:"updated"`
+	Entries  []atomEntry `xml:"entry"`
+}
+
+type atomLink struct {
+	Rel  string `xml:"rel,attr"`
+	Type string `xml:"type,attr,omitempty"`
+	Href string `xml:"href,attr"`
+}
+
+type atomEntry struct {
+	ID         string         `xml:"id"`
+	Title      string         `xml:"title"`
+	Link       atomLink       `xml:"link"`
+	Author     string         `xml:"author>name"`
+	Published  string         `xml:"published"`
+	Updated    string         `xml:"updated"`
+	Categories []atomCategory `xml:"category"`
+	Content    atomContent    `xml:"content"`
+}
+
+type atomCategory struct {
+	Term string `xml:"term,attr"`
+}
+
+type atomContent struct {
+	Type string `xml:"type,attr"`
+	Body string `xml:",chardata"`
+}
+
+// Atom renders the feed as an Atom 1.0 document
+func Atom(f Feed) ([]byte, error) {
+	doc := atomFeed{
+		Title:    f.Title,
+		Subtitle: f.Description,
+		ID:       f.Self,
+		Links: []atomLink{
+			{Rel: "self", Type: "application/atom+xml", Href: f.Self},
+			{Rel: "alternate", Type: "text/html", Href: f.Link},
+		},
+		Updated: f.Updated.UTC().Format(time.RFC3339),
+	}
+	for _, e := range f.Entries {
+		published := e.Published.UTC().Format(time.RFC3339)
+		entry := atomEntry{
+			ID:        e.Link,
+			Title:     e.Title,
+			Link:      atomLink{Rel: "alternate", Type: "text/html", Href: e.Link},
+			Author:    e.Author,
+			Published: published,
+			Updated:   published,
+			Content:   atomContent{Type: "html", Body: e.Content},
+		}
+		for _, c := range e.Categories {
+			entry.Categories = append(entry.Categories, atomCategory{Term: c})
+		}
+		doc.Entries = append(doc.Entries, entry)
+	}
+	return marshal(doc)
+}
+
+type rssDocument struct {
+	XMLName xml.Name   `xml:"rss"`
+	Version string     `xml:"version,attr"`
+	AtomNS  string     `xml:"xmlns:atom,attr"`
+	DCNS    string     `xml:"xmlns:dc,attr"`
+	Channel rssChannel `xml:"channel"`
+}
+
+type rssChannel struct {
+	Title         string    `xml:"title"`
+	Link          string    `xml:"link"`
+	Description   string    `xml:"description"`
+	Self          rssSelf   `xml:"atom:link"`
+	LastBuildDate string    `xml:"lastBuildDate"`
+	Items         []rssItem `xml:"item"`
+}
+
+// rssSelf is the atom:link recommended for RSS feeds to name their own URL
+type rssSelf struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr"`
+	Type string `xml:"type,attr"`
+}
+
+type rssItem struct {
+	Title       string   `xml:"title"`
+	Link        string   `xml:"link"`
+	GUID        rssGUID  `xml:"guid"`
+	Creator     string   `xml:"dc:creator"`
+	PubDate     string   `xml:"pubDate"`
+	Categories  []string `xml:"category"`
+	Description string   `xml:"description"`
+}
+
+type rssGUID struct {
+	IsPermaLink bool   `xml:"isPermaLink,attr"`
+	Value       string `xml:",chardata"`
+}
+
+// RSS renders the feed as an RSS 2.0 document. RSS authors must be email
+// addresses, so the author is given as dc:creator.
+func RSS(f Feed) ([]byte, error) {
+	doc := rssDocument{
+		Version: "2.0",
+		AtomNS:  "http://www.w3.org/2005/Atom",
+		DCNS:    "http://purl.org/dc/elements/1.1/",
+		Channel: rssChannel{
+			Title:         f.Title,
+			Link:          f.Link,
+			Description:   f.Description,
+			Self:          rssSelf{Href: f.Self, Rel: "self", Type: "application/rss+xml"},
+			LastBuildDate: f.Updated.UTC().Format(time.RFC1123Z),
+		},
+	}
+	for _, e := range f.Entries {
+		doc.Channel.Items = append(doc.Channel.Items, rssItem{
+			Title:       e.Title,
+			Link:        e.Link,
+			GUID:        rssGUID{IsPermaLink: true, Value: e.Link},
+			Creator:     e.Author,
+			PubDate:     e.Published.UTC().Format(time.RFC1123Z),
+			Categories:  e.Categories,
+			Description: e.Content,
+		})
+	}
+	return marshal(doc)
+}
+
+// marshal writes doc as an indented XML document with its declaration
+func marshal(doc interface{}) ([]byte, error) {
+	var b bytes.Buffer
+	b.WriteString(xml.Header)
+	enc := xml.NewEncoder(&b)
+	enc.Indent("", "  ")
+	if err := enc.Encode(doc); err != nil {
+		return nil, err
+	}
+	b.WriteByte('\n')
+	return b.Bytes(), nil
+}
@@ -0,0 +1,157 @@
+package unfurl
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/netip"
+	"syscall"
+	"time"
+)
+
+var (
+	// ErrBlockedAddress is returned for pages on loopback, private and other
+	// addresses that are not on the public internet
+	ErrBlockedAddress = errors.New("address not allowed")
+	// ErrNotHTML is returned for responses that are not HTML pages
+	ErrNotHTML = errors.New("not an HTML page")
+)
+
+// maxRedirects is the most redirects followed per page
+const maxRedirects = 5
+
+// Options control how pages are fetched
+type Options struct {
+	// Timeout bounds the whole fetch, redirects and reading the body included
+	Timeout time.Duration
+	// MaxSize is the most bytes read from a page; the metadata is in the head
+	MaxSize int
+	// AllowPrivate lets pages on loopback and private addresses be fetched,
+	// which is only meant for testing against local servers
+	AllowPrivate bool
+	// UserAgent is sent with every request
+	UserAgent string
+}
+
+// Fetcher fetches pages and extracts their metadata. Every connection is
+// checked after the host name was resolved, so neither a redirect nor a DNS
+// answer can point it at an internal address.
+type Fetcher struct {
+	client    *http.Client
+	maxSize   int
+	userAgent string
+}
+
+// NewFetcher creates a Fetcher with the given options
+func NewFetcher(opts Options) *Fetcher {
+	dialer := &net.Dialer{Timeout: opts.Timeout}
+	if !opts.AllowPrivate {
+		dialer.Control = checkAddress
+	}
+	transport := &http.Transport{
+		// A proxy would be dialed instead of the page and defeat the check
+		Proxy:                 nil,
+		DialContext:           dialer.DialContext,
+		TLSHandshakeTimeout:   opts.Timeout,
+		ResponseHeaderTimeout: opts.Timeout,
+		MaxIdleConns:          16,
+		IdleConnTimeout:       time.Minute,
+	}
+	return &Fetcher{
+		client: &http.Client{
+			Transport: transport,
+			Timeout:   opts.Timeout,
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				if len(via) >= maxRedirects {
+					return errors.New("too many redirects")
+				}
+				if req.URL.Scheme != "http" && req.URL.Scheme != "https" {
+					return fmt.Errorf("redirect to unsupported scheme %q", req.URL.Scheme)
+				}
+				return nil
+			},
+		},
+		maxSize:   opts.MaxSize,
+		userAgent: opts.UserAgent,
+	}
+}
+
+// Fetch reads the page at rawURL and returns its metadata. Only the first
+// MaxSize bytes of the page are parsed.
+func (f *Fetcher) Fetch(ctx context.Context, rawURL string) (Metadata, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return Metadata{}, err
+	}
+	req.Header.Set("Accept", "text/html,application/xhtml+xml")
+	if f.userAgent != "" {
+		req.Header.Set("User-Agent", f.userAgent)
+	}
+
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return Metadata{}, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return Metadata{}, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	mediaType, _, err := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if err != nil || (mediaType != "text/html" && mediaType != "application/xhtml+xml") {
+		return Metadata{}, ErrNotHTML
+	}
+	return Parse(io.LimitReader(resp.Body, int64(f.maxSize)), resp.Request.URL)
+}
+
+// checkAddress is the net.Dialer.Control hook that refuses connections to
+// addresses that are not publicly routable
+func checkAddress(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip, err := netip.ParseAddr(host)
+	if err != nil {
+		return err
+	}
+	if blocked(ip) {
+		return fmt.Errorf("%w: %s", ErrBlockedAddress, ip)
+	}
+	return nil
+}
+
+// blockedPrefixes are ranges that the netip.Addr predicates do not cover
+var blockedPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),       // "this" network
+	netip.MustParsePrefix("100.64.0.0/10"),   // carrier-grade NAT
+	netip.MustParsePrefix("192.0.0.0/24"),    // IETF protocol assignments
+	netip.MustParsePrefix("192.0.2.0/24"),    // documentation
+	netip.MustParsePrefix("198.18.0.0/15"),   // benchmarking
+	netip.MustParsePrefix("198.51.100.0/24"), // documentation
+	netip.MustParsePrefix("203.0.113.0/24"),  // documentation
+	netip.MustParsePrefix("240.0.0.0/4"),     // reserved and broadcast
+	netip.MustParsePrefix("64:ff9b::/96"),    // NAT64, may reach private IPv4
+	netip.MustParsePrefix("64:ff9b:1::/48"),  // local-use NAT64
+	netip.MustParsePrefix("2001:db8::/32"),   // documentation
+}
+
+// blocked reports whether ip is not on the public internet
+func blocked(ip netip.Addr) bool {
+	ip = ip.Unmap()
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() {
+		return true
+	}
+	for _, prefix := range blockedPrefixes {
+		if prefix.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
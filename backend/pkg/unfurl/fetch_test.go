@@ -0,0 +1,304 @@
+package unfurl
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// page serves body as an HTML page
+func page(body string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		fmt.Fprint(w, body)
+	}
+}
+
+// newTestServer serves the pages under their paths and returns a fetcher
+// that may reach the loopback server
+func newTestServer(t *testing.T, pages map[string]http.Handler, opts Options) (*httptest.Server, *Fetcher) {
+	t.Helper()
+	mux := http.NewServeMux()
+	for path, handler := range pages {
+		mux.Handle(path, handler)
+	}
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	if opts.Timeout == 0 {
+		opts.Timeout = 5 * time.Second
+	}
+	if opts.MaxSize == 0 {
+		opts.MaxSize = 1 << 20
+	}
+	opts.AllowPrivate = true
+	return server, NewFetcher(opts)
+}
+
+func TestFetchMetadata(t *testing.T) {
+	longTitle := strings.Repeat("x", maxTitleLength+50)
+	tests := []struct {
+		name string
+		body string
+		want Metadata
+	}{
+		{
+			name: "opengraph",
+			body: `<html><head>
+				<title>Element title</title>
+				<meta property="og:title" content="  OpenGraph
+					title ">
+				<meta property="og:description" content="OpenGraph description">
+				<meta property="og:image" content="/images/cover.png">
+				<meta property="og:site_name" content="Example">
+				<meta name="twitter:title" content="Twitter title">
+				</head><body></body></html>`,
+			want: Metadata{Title: "OpenGraph title", Description: "OpenGraph description", ImageURL: "{server}/images/cover.png", SiteName: "Example"},
+		},
+		{
+			name: "twitter card",
+			body: `<head><title>Element title</title>
+				<meta name="twitter:title" content="Twitter title">
+				<meta name="twitter:description" content="Twitter description">
+				<meta name="description" content="Plain description">
+				<meta name="twitter:image" content="https://cdn.example.com/card.jpg#crop"></head>`,
+			want: Metadata{Title: "Twitter title", Description: "Twitter description", ImageURL: "https://cdn.example.com/card.jpg"},
+		},
+		{
+			name: "title element and description",
+			body: `<head><TITLE>Element &amp; title</TITLE><META NAME="Description" CONTENT="Plain description"></head>`,
+			want: Metadata{Title: "Element & title", Description: "Plain description"},
+		},
+		{
+			name: "first value wins",
+			body: `<head><meta property="og:title" content="First"><meta property="og:title" content="Second"></head>`,
+			want: Metadata{Title: "First"},
+		},
+		{
+			name: "image with another scheme",
+			body: `<head><meta property="og:title" content="Title"><meta property="og:image" content="javascript:alert(1)"></head>`,
+			want: Metadata{Title: "Title"},
+		},
+		{
+			name: "long title",
+			body: `<head><meta property="og:title" content="` + longTitle + `"></head>`,
+			want: Metadata{Title: strings.Repeat("x", maxTitleLength-1) + "…"},
+		},
+		{
+			name: "tags in the body",
+			body: `<head><title>Head title</title></head><body><meta property="og:title" content="Body title"></body>`,
+			want: Metadata{Title: "Head title"},
+		},
+		{
+			name: "nothing to preview",
+			body: `<html><body><p>Hello</p></body></html>`,
+			want: Metadata{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, f := newTestServer(t, map[string]http.Handler{"/page": page(tt.body)}, Options{})
+			got, err := f.Fetch(context.Background(), server.URL+"/page")
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := tt.want
+			want.ImageURL = strings.Replace(want.ImageURL, "{server}", server.URL, 1)
+			if got != want {
+				t.Errorf("Fetch = %+v, want %+v", got, want)
+			}
+		})
+	}
+}
+
+func TestFetchRefusesOtherResponses(t *testing.T) {
+	server, f := newTestServer(t, map[string]http.Handler{
+		"/missing": http.NotFoundHandler(),
+		"/image": http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "image/png")
+			w.Write([]byte("\x89PNG"))
+		}),
+		"/untyped": http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header()["Content-Type"] = nil
+			w.Write([]byte("<title>Untyped</title>"))
+		}),
+	}, Options{})
+
+	if _, err := f.Fetch(context.Background(), server.URL+"/missing"); err == nil {
+		t.Error("a missing page was fetched")
+	}
+	for _, path := range []string{"/image", "/untyped"} {
+		if _, err := f.Fetch(context.Background(), server.URL+path); !errors.Is(err, ErrNotHTML) {
+			t.Errorf("Fetch(%s): err = %v, want ErrNotHTML", path, err)
+		}
+	}
+}
+
+func TestFetchReadsAtMostMaxSize(t *testing.T) {
+	const maxSize = 4096
+	padding := "<!-- " + strings.Repeat("padding ", maxSize/8) + " -->"
+	server, f := newTestServer(t, map[string]http.Handler{
+		"/early": page(`<head><meta property="og:title" content="Early">` + padding + `</head>`),
+		"/late":  page(`<head>` + padding + `<meta property="og:title" content="Late"></head>`),
+	}, Options{MaxSize: maxSize})
+
+	if got, err := f.Fetch(context.Background(), server.URL+"/early"); err != nil || got.Title != "Early" {
+		t.Errorf("tags before the limit: Fetch = %+v, %v", got, err)
+	}
+	if got, err := f.Fetch(context.Background(), server.URL+"/late"); err != nil || !got.Empty() {
+		t.Errorf("tags past the limit: Fetch = %+v, %v; want nothing read", got, err)
+	}
+}
+
+func TestFetchTimesOut(t *testing.T) {
+	const timeout = 200 * time.Millisecond
+	stall := func(flush bool) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			if flush {
+				w.Header().Set("Content-Type", "text/html")
+				fmt.Fprint(w, "<head><title>Slow")
+				w.(http.Flusher).Flush()
+			}
+			select {
+			case <-r.Context().Done():
+			case <-time.After(10 * timeout):
+			}
+		}
+	}
+	server, f := newTestServer(t, map[string]http.Handler{
+		"/slow-headers": stall(false),
+		"/slow-body":    stall(true),
+	}, Options{Timeout: timeout})
+
+	for _, path := range []string{"/slow-headers", "/slow-body"} {
+		start := time.Now()
+		_, err := f.Fetch(context.Background(), server.URL+path)
+		if err == nil {
+			t.Errorf("Fetch(%s) did not time out", path)
+		}
+		if elapsed := time.Since(start); elapsed > 5*timeout {
+			t.Errorf("Fetch(%s) took %v with a timeout of %v", path, elapsed, timeout)
+		}
+	}
+}
+
+func TestFetchFollowsRedirects(t *testing.T) {
+	hops := func(path string, n int) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			var left int
+			fmt.Sscan(r.URL.Query().Get("left"), &left)
+			if left == 0 {
+				left = n
+			}
+			if left == 1 {
+				http.Redirect(w, r, "/articles/final", http.StatusFound)
+				return
+			}
+			http.Redirect(w, r, fmt.Sprintf("%s?left=%d", path, left-1), http.StatusMovedPermanently)
+		}
+	}
+	server, f := newTestServer(t, map[string]http.Handler{
+		"/short":          hops("/short", 2),
+		"/long":           hops("/long", maxRedirects+1),
+		"/ftp":            http.RedirectHandler("ftp://example.com/file", http.StatusFound),
+		"/articles/final": page(`<head><meta property="og:title" content="Final"><meta property="og:image" content="cover.png"></head>`),
+	}, Options{})
+
+	got, err := f.Fetch(context.Background(), server.URL+"/short")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Relative images resolve against the page that was finally served
+	if want := (Metadata{Title: "Final", ImageURL: server.URL + "/articles/cover.png"}); got != want {
+		t.Errorf("Fetch after redirects = %+v, want %+v", got, want)
+	}
+	for _, path := range []string{"/long", "/ftp"} {
+		if _, err := f.Fetch(context.Background(), server.URL+path); err == nil {
+			t.Errorf("Fetch(%s) followed the redirects", path)
+		}
+	}
+}
+
+func TestFetchBlocksPrivateAddresses(t *testing.T) {
+	var requests atomic.Int32
+	internal := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		page(`<head><title>Internal</title></head>`)(w, r)
+	}))
+	defer internal.Close()
+
+	f := NewFetcher(Options{Timeout: 5 * time.Second, MaxSize: 1 << 20})
+	for _, target := range []string{
+		internal.URL,
+		strings.Replace(internal.URL, "127.0.0.1", "localhost", 1),
+		strings.Replace(internal.URL, "127.0.0.1", "[::ffff:127.0.0.1]", 1),
+	} {
+		if _, err := f.Fetch(context.Background(), target); !errors.Is(err, ErrBlockedAddress) {
+			t.Errorf("Fetch(%s): err = %v, want ErrBlockedAddress", target, err)
+		}
+	}
+
+	// A redirect is checked when its target is dialed. The redirecting
+	// server stands in for a public one, so only the internal one is checked.
+	public := httptest.NewServer(http.RedirectHandler(internal.URL, http.StatusFound))
+	defer public.Close()
+	internalAddr := internal.Listener.Addr().String()
+	f = NewFetcher(Options{Timeout: 5 * time.Second, MaxSize: 1 << 20, AllowPrivate: true})
+	dialer := &net.Dialer{Control: func(network, address string, c syscall.RawConn) error {
+		if address == internalAddr {
+			return checkAddress(network, address, c)
+		}
+		return nil
+	}}
+	f.client.Transport.(*http.Transport).DialContext = dialer.DialContext
+	if _, err := f.Fetch(context.Background(), public.URL); !errors.Is(err, ErrBlockedAddress) {
+		t.Errorf("Fetch through a redirect: err = %v, want ErrBlockedAddress", err)
+	}
+
+	if n := requests.Load(); n != 0 {
+		t.Errorf("the internal server got %d requests, want none", n)
+	}
+}
+
+func TestBlocked(t *testing.T) {
+	tests := []struct {
+		addr string
+		want bool
+	}{
+		{"127.0.0.1", true},
+		{"10.1.2.3", true},
+		{"172.16.0.1", true},
+		{"192.168.1.1", true},
+		{"169.254.169.254", true},
+		{"0.0.0.0", true},
+		{"100.64.0.1", true},
+		{"198.18.0.1", true},
+		{"224.0.0.1", true},
+		{"255.255.255.255", true},
+		{"::1", true},
+		{"::", true},
+		{"::ffff:127.0.0.1", true},
+		{"::ffff:10.0.0.1", true},
+		{"fc00::1", true},
+		{"fe80::1", true},
+		{"64:ff9b::a00:1", true},
+		{"2001:db8::1", true},
+		{"93.184.216.34", false},
+		{"8.8.8.8", false},
+		{"2606:4700:4700::1111", false},
+	}
+	for _, tt := range tests {
+		if got := blocked(netip.MustParseAddr(tt.addr)); got != tt.want {
+			t.Errorf("blocked(%s) = %v, want %v", tt.addr, got, tt.want)
+		}
+	}
+}
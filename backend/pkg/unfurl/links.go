@@ -0,0 +1,60 @@
+// Package unfurl finds links in posts and chat messages and fetches the
+// OpenGraph and Twitter card metadata of the pages they point to. Caching the
+// previews and telling clients about them is left to the services.
+package unfurl
+
+import (
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// MaxPerText caps the links previewed per text, so that a single message
+// cannot make the server fetch a whole list of pages
+const MaxPerText = 3
+
+// maxURLLength is the longest link that is previewed
+const maxURLLength = 2048
+
+// linkPattern matches http and https links up to white space, quotes, angle
+// brackets and the brackets Markdown puts around link targets
+var linkPattern = regexp.MustCompile(`(?i)\bhttps?://[^\s<>"'()\[\]{}]+`)
+
+// FindURLs returns the distinct http and https links in text in order, at
+// most MaxPerText of them. Punctuation that ends a sentence is not taken as
+// part of a link, and fragments are dropped as they name the same page.
+func FindURLs(text string) []string {
+	var urls []string
+	seen := make(map[string]bool)
+	for _, match := range linkPattern.FindAllString(text, -1) {
+		link, ok := Normalize(strings.TrimRight(match, ".,;:!?"))
+		if !ok || seen[link] {
+			continue
+		}
+		seen[link] = true
+		urls = append(urls, link)
+		if len(urls) == MaxPerText {
+			break
+		}
+	}
+	return urls
+}
+
+// Normalize checks that rawURL is an absolute http or https URL with a host
+// and returns it without its fragment
+func Normalize(rawURL string) (string, bool) {
+	if len(rawURL) > maxURLLength {
+		return "", false
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Host == "" || u.User != nil {
+		return "", false
+	}
+	u.Scheme = strings.ToLower(u.Scheme)
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return "", false
+	}
+	u.Fragment = ""
+	u.RawFragment = ""
+	return u.String(), true
+}
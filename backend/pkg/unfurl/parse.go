@@ -0,0 +1,142 @@
+package unfurl
+
+import (
+	"io"
+	"net/url"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// Lengths of the metadata kept, in runes
+const (
+	maxTitleLength       = 300
+	maxDescriptionLength = 1000
+	maxSiteNameLength    = 100
+)
+
+// Metadata is what a page says about itself
+type Metadata struct {
+	Title       string
+	Description string
+	// ImageURL is absolute and uses http or https
+	ImageURL string
+	SiteName string
+}
+
+// Empty reports whether the page offered nothing to preview
+func (m Metadata) Empty() bool {
+	return m.Title == "" && m.Description == "" && m.ImageURL == ""
+}
+
+// Parse reads the head of an HTML page served from base. OpenGraph tags are
+// preferred over Twitter cards, which are preferred over the title element
+// and the description meta tag. Relative image URLs are resolved against base.
+func Parse(r io.Reader, base *url.URL) (Metadata, error) {
+	meta := make(map[string]string)
+	var title strings.Builder
+	inTitle := false
+
+	z := html.NewTokenizer(r)
+	for {
+		tt := z.Next()
+		switch tt {
+		case html.ErrorToken:
+			if z.Err() != io.EOF {
+				return Metadata{}, z.Err()
+			}
+			return buildMetadata(meta, title.String(), base), nil
+		case html.TextToken:
+			if inTitle {
+				title.Write(z.Text())
+			}
+		case html.EndTagToken:
+			name, _ := z.TagName()
+			switch atom.Lookup(name) {
+			case atom.Title:
+				inTitle = false
+			case atom.Head:
+				return buildMetadata(meta, title.String(), base), nil
+			}
+		case html.StartTagToken, html.SelfClosingTagToken:
+			name, hasAttr := z.TagName()
+			switch atom.Lookup(name) {
+			case atom.Title:
+				inTitle = tt == html.StartTagToken && title.Len() == 0
+			case atom.Body:
+				return buildMetadata(meta, title.String(), base), nil
+			case atom.Meta:
+				if hasAttr {
+					readMeta(z, meta)
+				}
+			}
+		}
+	}
+}
+
+// readMeta records the content of a meta tag under its property or name,
+// keeping the first value of every key
+func readMeta(z *html.Tokenizer, meta map[string]string) {
+	var key, content string
+	for {
+		name, value, more := z.TagAttr()
+		switch string(name) {
+		case "property", "name":
+			if key == "" {
+				key = strings.ToLower(strings.TrimSpace(string(value)))
+			}
+		case "content":
+			content = string(value)
+		}
+		if !more {
+			break
+		}
+	}
+	if _, ok := meta[key]; key != "" && !ok {
+		meta[key] = content
+	}
+}
+
+// buildMetadata picks the metadata from the collected tags
+func buildMetadata(meta map[string]string, title string, base *url.URL) Metadata {
+	pick := func(keys ...string) string {
+		for _, key := range keys {
+			if v := clean(meta[key]); v != "" {
+				return v
+			}
+		}
+		return ""
+	}
+	m := Metadata{
+		Title:       truncate(pick("og:title", "twitter:title"), maxTitleLength),
+		Description: truncate(pick("og:description", "twitter:description", "description"), maxDescriptionLength),
+		SiteName:    truncate(pick("og:site_name"), maxSiteNameLength),
+	}
+	if m.Title == "" {
+		m.Title = truncate(clean(title), maxTitleLength)
+	}
+	if image := pick("og:image:secure_url", "og:image", "og:image:url", "twitter:image", "twitter:image:src"); image != "" {
+		if u, err := base.Parse(image); err == nil {
+			if link, ok := Normalize(u.String()); ok {
+				m.ImageURL = link
+			}
+		}
+	}
+	return m
+}
+
+// clean collapses white space and drops invalid UTF-8
+func clean(s string) string {
+	return strings.Join(strings.Fields(strings.ToValidUTF8(s, "")), " ")
+}
+
+// truncate shortens s to at most n runes, marking the cut with an ellipsis
+func truncate(s string, n int) string {
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	runes := []rune(s)
+	return strings.TrimSpace(string(runes[:n-1])) + "…"
+}
@@ -2,10 +2,12 @@ package websockets
 
 import (
 	"encoding/json"
-	"log"
+	"log/slog"
+	"sync"
 	"time"
 
 	"project-root/pkg/api"
+	"project-root/pkg/metrics"
 
 	"github.com/gorilla/websocket"
 )
@@ -15,6 +17,15 @@ type Client struct {
 	manager *WebSocketManager
 	user    *api.UserResponse
 	stopper chan struct{}
+
+	// logger carries the connection-scoped attributes (conn_id, user_id, request_id)
+	logger *slog.Logger
+
+	// writeMu serialises writes, the connection supports only one concurrent writer
+	writeMu sync.Mutex
+
+	// viewing is the post whose poll results the client receives, guarded by manager.mu
+	viewing int
 }
 
 func (c *Client) readMessages() {
@@ -26,13 +37,16 @@ func (c *Client) readMessages() {
 	for {
 		_, message, err := c.conn.ReadMessage()
 		if err != nil {
-			log.Println("Error reading message:", err)
+			c.logger.Info("Connection closed", "error", err)
+			if !websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway, websocket.CloseServiceRestart) {
+				metrics.WSDroppedClients.Inc()
+			}
 			break
 		}
 
 		var msg api.MessageResponse
 		if err := json.Unmarshal(message, &msg); err != nil {
-			log.Println("Error unmarshalling JSON:", err)
+			c.logger.Warn("Error unmarshalling JSON", "error", err)
 			c.sendError("Invalid message format")
 			continue
 		}
@@ -43,7 +57,7 @@ func (c *Client) readMessages() {
 		case "join_room":
 			var joinMsg api.JoinRoomMessage
 			if err := json.Unmarshal(payload, &joinMsg); err != nil {
-				log.Println("Error unmarshalling join room message:", err)
+				c.logger.Warn("Error unmarshalling join room message", "error", err)
 				c.sendError("Invalid join room message")
 				continue
 			}
@@ -51,7 +65,7 @@ func (c *Client) readMessages() {
 		case "message":
 			var msgMsg api.MessageMessage
 			if err := json.Unmarshal(payload, &msgMsg); err != nil {
-				log.Println("Error unmarshalling message message:", err)
+				c.logger.Warn("Error unmarshalling message message", "error", err)
 				c.sendError("Invalid message message")
 				continue
 			}
@@ -59,19 +73,28 @@ func (c *Client) readMessages() {
 		case "typing":
 			var typingMsg api.TypingMessage
 			if err := json.Unmarshal(payload, &typingMsg); err != nil {
-				log.Println("Error unmarshalling typing message:", err)
+				c.logger.Warn("Error unmarshalling typing message", "error", err)
 				c.sendError("Invalid typing message")
 				continue
 			}
 			c.handleTyping(&typingMsg)
+		case "view_post":
+			var viewMsg api.ViewPostMessage
+			if err := json.Unmarshal(payload, &viewMsg); err != nil {
+				c.logger.Warn("Error unmarshalling view post message", "error", err)
+				c.sendError("Invalid view post message")
+				continue
+			}
+			c.manager.viewPost(c, viewMsg.PostID)
 		default:
+			c.logger.Debug("Unknown message type", "type", msg.Type)
 			c.sendError("Unknown message type")
 		}
 	}
 }
 
 func (c *Client) writeMessages() {
-	ticker := time.NewTicker(pingInterval)
+	ticker := time.NewTicker(c.manager.config.PingInterval)
 	defer func() {
 		ticker.Stop()
 		c.conn.Close()
@@ -82,8 +105,8 @@ func (c *Client) writeMessages() {
 		case <-c.stopper:
 			return
 		case <-ticker.C:
-			if err := c.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
-				log.Println("Error sending ping:", err)
+			if err := c.write(websocket.PingMessage, nil); err != nil {
+				c.logger.Warn("Error sending ping", "error", err)
 				return
 			}
 		}
@@ -91,8 +114,9 @@ func (c *Client) writeMessages() {
 }
 
 func (client *Client) sendMessage(message []byte) error {
-	if err := client.conn.WriteMessage(websocket.TextMessage, message); err != nil {
-		log.Println("Error sending message:", err)
+	if err := client.write(websocket.TextMessage, message); err != nil {
+		client.logger.Warn("Error sending message", "error", err)
+		metrics.WSSendFailures.Inc()
 		return err
 	}
 	return nil
@@ -105,13 +129,30 @@ func (c *Client) sendError(errorMessage string) {
 	}
 	data, err := json.Marshal(msg)
 	if err != nil {
-		log.Println("Error marshalling error message:", err)
+		c.logger.Error("Error marshalling error message", "error", err)
 		return
 	}
 
-	if err := c.conn.WriteMessage(websocket.TextMessage, data); err != nil {
-		log.Println("Error sending error message:", err)
+	if err := c.write(websocket.TextMessage, data); err != nil {
+		c.logger.Warn("Error sending error message", "error", err)
+		metrics.WSSendFailures.Inc()
+	}
+}
+
+// write sends a single frame, failing once the write timeout has passed, so
+// that a client that stopped reading cannot hold the write lock for long
+func (c *Client) write(messageType int, data []byte) error {
+	return c.writeBefore(messageType, data, time.Now().Add(c.manager.config.WriteTimeout))
+}
+
+// writeBefore sends a single frame while holding the write lock, failing at deadline
+func (c *Client) writeBefore(messageType int, data []byte, deadline time.Time) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	if err := c.conn.SetWriteDeadline(deadline); err != nil {
+		return err
 	}
+	return c.conn.WriteMessage(messageType, data)
 }
 
 func (c *Client) handleJoinRoom(msg *api.JoinRoomMessage) {
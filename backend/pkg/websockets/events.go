@@ -0,0 +1,84 @@
+package websockets
+
+import (
+	"encoding/json"
+
+	"project-root/pkg/api"
+	"project-root/pkg/metrics"
+	"project-root/pkg/services"
+	"project-root/pkg/unfurl"
+)
+
+// subscribe pushes new chat messages to their rooms and new comments to the
+// viewers of their posts, and tells mentioned users about new content. The
+// subscribers are local, as every server pushes to its own clients whichever
+// server recorded the event. Pushes are best effort.
+func (manager *WebSocketManager) subscribe(bus *services.EventBus) {
+	services.OnLocal(bus, "websockets", func(e api.MessageSentEvent) error {
+		manager.broadcastChatMessage(e.Message)
+		return nil
+	})
+	services.OnLocal(bus, "websockets", func(e api.CommentCreatedEvent) error {
+		manager.broadcastComment(e)
+		manager.NotifyMentions(api.MentionNotification{Author: &e.Author, PostID: e.PostID, CommentID: e.CommentID}, e.Mentions)
+		return nil
+	})
+	services.OnLocal(bus, "websockets", func(e api.PostCreatedEvent) error {
+		manager.NotifyMentions(api.MentionNotification{Author: &e.Author, PostID: e.PostID}, e.Mentions)
+		return nil
+	})
+}
+
+// broadcastChatMessage sends a stored message to the clients in its room,
+// tells the users it mentions and has its links previewed for the room
+func (manager *WebSocketManager) broadcastChatMessage(msg api.MessageMessage) {
+	data, err := json.Marshal(api.MessageResponse{Type: "message", Payload: msg})
+	if err != nil {
+		manager.logger.Error("Error marshalling message", "room", msg.RoomHash, "error", err)
+		return
+	}
+	clients := manager.getRoomClients(msg.RoomHash)
+	if len(clients) == 0 {
+		manager.logger.Debug("No clients in room to broadcast message", "room", msg.RoomHash)
+	}
+	for _, client := range clients {
+		if err := client.sendMessage(data); err != nil {
+			client.logger.Warn("Error sending message to client", "room", msg.RoomHash, "error", err)
+			continue
+		}
+		metrics.WSMessagesBroadcast.Inc("message")
+	}
+
+	manager.NotifyMentions(api.MentionNotification{Author: msg.Sender, RoomHash: msg.RoomHash}, msg.Mentions)
+	manager.previews.Unfurl(unfurl.FindURLs(msg.Message), func(preview api.LinkPreview) {
+		manager.broadcastLinkPreview(msg.RoomHash, preview)
+	})
+}
+
+// broadcastComment sends a comment_created message with a new comment to
+// the clients viewing its post
+func (manager *WebSocketManager) broadcastComment(e api.CommentCreatedEvent) {
+	data, err := json.Marshal(api.MessageResponse{
+		Type: "comment_created",
+		Payload: api.Comment{
+			ID:          e.CommentID,
+			PostID:      e.PostID,
+			UserID:      e.Author.ID,
+			Nickname:    e.Author.Nickname,
+			Content:     e.Content,
+			ContentHTML: e.ContentHTML,
+			CreatedAt:   e.CreatedAt,
+			Mentions:    e.Mentions,
+			Attachments: e.Attachments,
+		},
+	})
+	if err != nil {
+		manager.logger.Error("Error marshalling comment", "post_id", e.PostID, "error", err)
+		return
+	}
+	for _, client := range manager.postViewers(e.PostID) {
+		if client.sendMessage(data) == nil {
+			metrics.WSMessagesBroadcast.Inc("comment_created")
+		}
+	}
+}
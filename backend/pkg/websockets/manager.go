@@ -1,56 +1,103 @@
 package websockets
 
 import (
+	"context"
 	"encoding/json"
-	"log"
+	"errors"
+	"log/slog"
 	"net/http"
 	"sync"
 	"time"
 
+	"project-root/config"
 	"project-root/pkg/api"
+	"project-root/pkg/clock"
+	"project-root/pkg/logging"
+	"project-root/pkg/metrics"
 	"project-root/pkg/repositories"
 	"project-root/pkg/services"
 
+	"github.com/google/uuid"
 	"github.com/gorilla/websocket"
 )
 
-const (
-	pingInterval        = 30 * time.Second
-	activeUsersInterval = 5 * time.Second
-)
+// errClosing is returned for connections made while the manager shuts down
+var errClosing = errors.New("websocket manager is shutting down")
+
+// restartCloseFrame tells a client to reconnect once the server is back
+var restartCloseFrame = websocket.FormatCloseMessage(websocket.CloseServiceRestart, "server restarting")
 
 type WebSocketManager struct {
 	clients map[*Client]bool
 	rooms   map[string]map[int]*Client
+	// viewers are the clients showing a post, keyed by post ID
+	viewers map[int]map[*Client]bool
 	mu      sync.RWMutex
+
+	// done is closed when the manager shuts down and stops background work
+	done    chan struct{}
+	closing bool
+
+	config   config.WebSocketConfig
+	chats    repositories.ChatStore
+	auth     *services.Authenticator
+	security *services.Security
+	validate *services.Validator
+	previews *services.LinkPreviewer
+	events   *services.EventBus
+	clock    clock.Clock
+	logger   *slog.Logger
 }
 
-func NewWebSocketManager() *WebSocketManager {
+// NewWebSocketManager creates a manager that stores messages in chats,
+// authenticates connections with auth, accepts the origins allowed by
+// security, checks new messages with validate, has their links previewed by
+// previews and pushes the events on events to the clients
+func NewWebSocketManager(logger *slog.Logger, cfg config.WebSocketConfig, chats repositories.ChatStore, auth *services.Authenticator, security *services.Security, validate *services.Validator, previews *services.LinkPreviewer, events *services.EventBus, clk clock.Clock) *WebSocketManager {
 	manager := &WebSocketManager{
-		clients: make(map[*Client]bool),
-		rooms:   make(map[string]map[int]*Client),
+		config:   cfg,
+		chats:    chats,
+		auth:     auth,
+		security: security,
+		validate: validate,
+		previews: previews,
+		events:   events,
+		clock:    clk,
+		clients:  make(map[*Client]bool),
+		rooms:    make(map[string]map[int]*Client),
+		viewers:  make(map[int]map[*Client]bool),
+		done:     make(chan struct{}),
+		logger:   logger.With("component", "websocket"),
 	}
 
+	manager.subscribe(events)
 	go manager.periodicActiveUsersBroadcast()
 
 	return manager
 }
 
 func (manager *WebSocketManager) WebSocketHandler(w http.ResponseWriter, r *http.Request) {
+	if manager.isClosing() {
+		http.Error(w, "Server is shutting down", http.StatusServiceUnavailable)
+		return
+	}
+
 	upgrader := websocket.Upgrader{
 		CheckOrigin: func(r *http.Request) bool {
-			return true
+			// Non-browser clients do not send an Origin header and cannot be used for CSRF
+			origin := r.Header.Get("Origin")
+			return origin == "" || manager.security.IsOriginAllowed(origin, r)
 		},
 	}
 
 	conn, err := upgrader.Upgrade(w, r, nil)
 	if err != nil {
-		log.Println("Error upgrading to websocket:", err)
+		logging.FromContext(r.Context()).Warn("Error upgrading to websocket", "error", err)
 		return
 	}
 	defer conn.Close()
 
-	user, status := services.AuthenticateUser(r)
+	user, status := manager.auth.AuthorizeUser(r, services.ScopeChatsWrite)
 	if !status {
 		return
 	}
@@ -59,10 +106,19 @@ func (manager *WebSocketManager) WebSocketHandler(w http.ResponseWriter, r *http
 		manager: manager,
 		user:    user,
 		stopper: make(chan struct{}),
+		logger: manager.logger.With(
+			"conn_id", uuid.New().String(),
+			"user_id", user.ID,
+			"request_id", logging.RequestID(r.Context()),
+		),
+	}
+	if err := manager.addClient(client); err != nil {
+		// Shutdown began after the upgrade and will not close this connection
+		conn.WriteControl(websocket.CloseMessage, restartCloseFrame, time.Now().Add(manager.config.WriteTimeout))
+		return
 	}
-
-	manager.addClient(client)
 	defer manager.removeClient(client)
+	client.logger.Info("Client connected")
 
 	go client.writeMessages()
 
@@ -70,17 +126,94 @@ func (manager *WebSocketManager) WebSocketHandler(w http.ResponseWriter, r *http
 }
 
 func (manager *WebSocketManager) periodicActiveUsersBroadcast() {
-	ticker := time.NewTicker(activeUsersInterval)
+	ticker := time.NewTicker(manager.config.ActiveUsersInterval)
 	defer ticker.Stop()
 
 	for {
 		select {
+		case <-manager.done:
+			return
 		case <-ticker.C:
 			manager.broadcastActiveUsers()
 		}
 	}
 }
 
+// Shutdown stops background work, tells every client that the server is
+// restarting and closes their connections with a service restart close code.
+// It waits until all clients are removed or ctx expires.
+func (manager *WebSocketManager) Shutdown(ctx context.Context) error {
+	manager.mu.Lock()
+	if manager.closing {
+		manager.mu.Unlock()
+		return nil
+	}
+	manager.closing = true
+	close(manager.done)
+
+	clients := make([]*Client, 0, len(manager.clients))
+	for client := range manager.clients {
+		clients = append(clients, client)
+	}
+	manager.mu.Unlock()
+
+	data, err := json.Marshal(api.MessageResponse{Type: "server_restarting"})
+	if err != nil {
+		return err
+	}
+	deadline := time.Now().Add(time.Second)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+
+	// Clients that stopped reading make the writes fail at the deadline
+	for _, client := range clients {
+		if err := client.writeBefore(websocket.TextMessage, data, deadline); err != nil {
+			client.logger.Warn("Error sending restart notice", "error", err)
+		}
+		if err := client.conn.WriteControl(websocket.CloseMessage, restartCloseFrame, deadline); err != nil {
+			client.logger.Warn("Error sending close frame", "error", err)
+		}
+		client.conn.Close()
+	}
+
+	// Wait for the read loops to notice the closed connections and unregister
+	ticker := time.NewTicker(50 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		manager.mu.RLock()
+		remaining := len(manager.clients)
+		manager.mu.RUnlock()
+		if remaining == 0 {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+func (manager *WebSocketManager) isClosing() bool {
+	manager.mu.RLock()
+	defer manager.mu.RUnlock()
+	return manager.closing
+}
+
+// Accepting reports whether the manager still accepts new connections
+func (manager *WebSocketManager) Accepting() bool {
+	return !manager.isClosing()
+}
+
+// Stats returns the number of connected clients and open rooms
+func (manager *WebSocketManager) Stats() (clients, rooms int) {
+	manager.mu.RLock()
+	defer manager.mu.RUnlock()
+	return len(manager.clients), len(manager.rooms)
+}
+
 func (manager *WebSocketManager) broadcastActiveUsers() {
 	manager.mu.RLock()
 	defer manager.mu.RUnlock()
@@ -99,62 +232,91 @@ func (manager *WebSocketManager) broadcastActiveUsers() {
 
 	data, err := json.Marshal(msg)
 	if err != nil {
-		log.Println("Error marshalling active users:", err)
+		manager.logger.Error("Error marshalling active users", "error", err)
 		return
 	}
 
 	for client := range manager.clients {
-		client.sendMessage(data)
+		if client.sendMessage(data) == nil {
+			metrics.WSMessagesBroadcast.Inc("active_users")
+		}
 	}
 }
 
 func (manager *WebSocketManager) broadcastMessage(msg *api.MessageMessage, roomHash string, sender *Client) {
 
-	msg.SendAt = time.Now()
+	msg.SendAt = manager.clock.Now()
 	msg.Sender = sender.user
 	msg.RoomHash = roomHash // Ensure the room hash is set in the message
 
-	err := manager.saveMessageToDB(sender.user.ID, msg)
+	if validationErrors := manager.validate.ValidateOperation("message", *msg); len(validationErrors) > 0 {
+		sender.sendError(validationErrors[0].Message)
+		return
+	}
+
+	err := manager.saveMessageToDB(sender, msg)
+	if errors.Is(err, repositories.ErrAttachmentNotFound) {
+		sender.sendError("Unknown attachment")
+		return
+	}
 	if err != nil {
 		sender.sendError("Failed to save message")
-		// return
+		return
 	}
 
-	// Get clients in the room
-	clients := manager.getRoomClients(roomHash)
-	if len(clients) == 0 {
-		log.Printf("No clients in room %s to broadcast message", roomHash)
-	}
+	// The message reaches the room through the MessageSentEvent recorded with it
+	manager.events.Wake()
+}
 
-	for _, client := range clients {
-		response := api.MessageResponse{
-			Type:    "message",
-			Payload: msg,
-		}
-		data, err := json.Marshal(response)
-		if err != nil {
-			log.Println("Error marshalling message:", err)
-			continue
+// broadcastLinkPreview sends the preview of a link in a message to the
+// clients in the room of the message
+func (manager *WebSocketManager) broadcastLinkPreview(roomHash string, preview api.LinkPreview) {
+	data, err := json.Marshal(api.MessageResponse{
+		Type:    "link_preview",
+		Payload: api.LinkPreviewMessage{RoomHash: roomHash, Preview: preview},
+	})
+	if err != nil {
+		manager.logger.Error("Error marshalling link preview", "room", roomHash, "error", err)
+		return
+	}
+	for _, client := range manager.getRoomClients(roomHash) {
+		if client.sendMessage(data) == nil {
+			metrics.WSMessagesBroadcast.Inc("link_preview")
 		}
-		if err := client.sendMessage(data); err != nil {
-			log.Println("Error sending message to client:", err)
+	}
+}
+
+// NotifyReaction sends a reaction_added or reaction_removed message to the
+// clients in the room of the chat whose message was reacted to
+func (manager *WebSocketManager) NotifyReaction(eventType string, e api.ReactionEvent) {
+	data, err := json.Marshal(api.MessageResponse{Type: eventType, Payload: e})
+	if err != nil {
+		manager.logger.Error("Error marshalling reaction", "room", e.RoomHash, "error", err)
+		return
+	}
+	for _, client := range manager.getRoomClients(e.RoomHash) {
+		if client.sendMessage(data) == nil {
+			metrics.WSMessagesBroadcast.Inc(eventType)
 		}
 	}
+}
+
+// NotifyPollResults sends a poll_results message to the clients viewing the post
+func (manager *WebSocketManager) NotifyPollResults(postID int, poll api.Poll) {
+	data, err := json.Marshal(api.MessageResponse{
+		Type:    "poll_results",
+		Payload: api.PollResultsMessage{PostID: postID, Poll: poll},
+	})
+	if err != nil {
+		manager.logger.Error("Error marshalling poll results", "post_id", postID, "error", err)
+		return
+	}
 
-	// if sender != nil {
-	//     response := api.MessageResponse{
-	//         Type:    "message_sent",
-	//         Payload: msg,
-	//     }
-	//     data, err := json.Marshal(response)
-	//     if err != nil {
-	//         log.Println("Error marshalling confirmation message:", err)
-	//         return
-	//     }
-	//     if err := sender.sendMessage(data); err != nil {
-	//         log.Println("Error sending confirmation message to sender:", err)
-	//     }
-	// }
+	for _, client := range manager.postViewers(postID) {
+		if client.sendMessage(data) == nil {
+			metrics.WSMessagesBroadcast.Inc("poll_results")
+		}
+	}
 }
 
 func (manager *WebSocketManager) broadcastTypingStatus(msg *api.TypingMessage, sender *Client) {
@@ -167,19 +329,28 @@ func (manager *WebSocketManager) broadcastTypingStatus(msg *api.TypingMessage, s
 
 	data, err := json.Marshal(response)
 	if err != nil {
-		log.Println("Error marshalling typing status:", err)
+		sender.logger.Error("Error marshalling typing status", "room", msg.RoomHash, "error", err)
 		return
 	}
 
 	for _, client := range clients {
-		client.sendMessage(data)
+		if client.sendMessage(data) == nil {
+			metrics.WSMessagesBroadcast.Inc("typing")
+		}
 	}
 }
 
-func (manager *WebSocketManager) addClient(client *Client) {
+// addClient registers a connected client, unless the manager is shutting
+// down and has already told the registered clients to go
+func (manager *WebSocketManager) addClient(client *Client) error {
 	manager.mu.Lock()
 	defer manager.mu.Unlock()
+	if manager.closing {
+		return errClosing
+	}
 	manager.clients[client] = true
+	manager.updateGauges()
+	return nil
 }
 
 func (manager *WebSocketManager) removeClient(client *Client) {
@@ -199,21 +370,73 @@ func (manager *WebSocketManager) removeClient(client *Client) {
 			delete(manager.rooms, roomHash)
 		}
 	}
+	manager.stopViewing(client)
+	manager.updateGauges()
+}
+
+// viewPost makes the client receive the poll results and new comments of a
+// post instead of those of the post it viewed before; post ID 0 stops them. Posts are public,
+// so any client may view any post.
+func (manager *WebSocketManager) viewPost(client *Client, postID int) {
+	manager.mu.Lock()
+	defer manager.mu.Unlock()
+
+	manager.stopViewing(client)
+	if postID <= 0 {
+		return
+	}
+	if _, ok := manager.viewers[postID]; !ok {
+		manager.viewers[postID] = make(map[*Client]bool)
+	}
+	manager.viewers[postID][client] = true
+	client.viewing = postID
+}
+
+// stopViewing forgets the post the client views. Callers must hold manager.mu.
+func (manager *WebSocketManager) stopViewing(client *Client) {
+	if viewers, ok := manager.viewers[client.viewing]; ok {
+		delete(viewers, client)
+		if len(viewers) == 0 {
+			delete(manager.viewers, client.viewing)
+		}
+	}
+	client.viewing = 0
 }
 
 func (manager *WebSocketManager) addClientToRoom(roomHash string, client *Client) {
 	manager.mu.Lock()
 	defer manager.mu.Unlock()
 
-	if !manager.hasAccessToRoom(client.user, roomHash) {
+	if !manager.hasAccessToRoom(client, roomHash) {
+		client.logger.Warn("Access denied to room", "room", roomHash)
 		client.sendError("Access denied to room " + roomHash)
 		return
 	}
+	client.logger.Debug("Client joined room", "room", roomHash)
 
 	if _, ok := manager.rooms[roomHash]; !ok {
 		manager.rooms[roomHash] = make(map[int]*Client)
 	}
 	manager.rooms[roomHash][client.user.ID] = client
+	manager.updateGauges()
+}
+
+// updateGauges publishes connection and room counts. Callers must hold manager.mu.
+func (manager *WebSocketManager) updateGauges() {
+	metrics.WSConnections.Set(float64(len(manager.clients)))
+	metrics.WSRooms.Set(float64(len(manager.rooms)))
+}
+
+// postViewers returns the clients viewing a post
+func (manager *WebSocketManager) postViewers(postID int) []*Client {
+	manager.mu.RLock()
+	defer manager.mu.RUnlock()
+
+	clients := make([]*Client, 0, len(manager.viewers[postID]))
+	for client := range manager.viewers[postID] {
+		clients = append(clients, client)
+	}
+	return clients
 }
 
 func (manager *WebSocketManager) getRoomClients(roomHash string) []*Client {
@@ -230,21 +453,67 @@ func (manager *WebSocketManager) getRoomClients(roomHash string) []*Client {
 }
 
 // Mock function to check if the user has access to the room
-func (manager *WebSocketManager) hasAccessToRoom(user *api.UserResponse, roomHash string) bool {
-	chatRepo := repositories.NewChatRepository()
-	hasAccess, err := chatRepo.CheckChatAccess(user.ID, roomHash)
+func (manager *WebSocketManager) hasAccessToRoom(client *Client, roomHash string) bool {
+	hasAccess, err := manager.chats.CheckChatAccess(client.user.ID, roomHash)
 	if err != nil {
-		log.Println("Error checking chat access:", err)
+		client.logger.Warn("Error checking chat access", "room", roomHash, "error", err)
 		return false
 	}
 	return hasAccess
 }
 
-func (manager *WebSocketManager) saveMessageToDB(userID int, message *api.MessageMessage) error {
-	messageRepo := repositories.NewChatRepository()
-	if err := messageRepo.SaveMessage(message.RoomHash, userID, message.Message); err != nil {
-		log.Println("Error saving message to DB:", err)
-		return err
+// saveMessageToDB stores a message and sets the users it mentions and its attachments
+func (manager *WebSocketManager) saveMessageToDB(sender *Client, message *api.MessageMessage) error {
+	err := manager.chats.SaveMessage(message)
+	if err != nil && !errors.Is(err, repositories.ErrAttachmentNotFound) {
+		sender.logger.Error("Error saving message to DB", "room", message.RoomHash, "error", err)
 	}
-	return nil
+	return err
+}
+
+// NotifyMentions sends a mention message to the connected clients of the
+// users mentioned in new content. Authors are not told about mentioning
+// themselves, and users mentioned in a chat they do not take part in are not
+// told at all.
+func (manager *WebSocketManager) NotifyMentions(n api.MentionNotification, mentions []api.Mention) {
+	if len(mentions) == 0 {
+		return
+	}
+	data, err := json.Marshal(api.MessageResponse{Type: "mention", Payload: n})
+	if err != nil {
+		manager.logger.Error("Error marshalling mention", "error", err)
+		return
+	}
+
+	notified := map[int]bool{n.Author.ID: true}
+	for _, m := range mentions {
+		if notified[m.UserID] {
+			continue
+		}
+		notified[m.UserID] = true
+		if n.RoomHash != "" {
+			if hasAccess, _ := manager.chats.CheckChatAccess(m.UserID, n.RoomHash); !hasAccess {
+				continue
+			}
+		}
+		for _, client := range manager.userClients(m.UserID) {
+			if client.sendMessage(data) == nil {
+				metrics.WSMessagesBroadcast.Inc("mention")
+			}
+		}
+	}
+}
+
+// userClients returns the connected clients of a user
+func (manager *WebSocketManager) userClients(userID int) []*Client {
+	manager.mu.RLock()
+	defer manager.mu.RUnlock()
+
+	var clients []*Client
+	for client := range manager.clients {
+		if client.user.ID == userID {
+			clients = append(clients, client)
+		}
+	}
+	return clients
 }
@@ -0,0 +1,126 @@
+package websockets
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"project-root/config"
+	"project-root/pkg/api"
+	"project-root/pkg/clock"
+	"project-root/pkg/repositories/memory"
+	"project-root/pkg/services"
+
+	"github.com/gorilla/websocket"
+)
+
+// newTestManager serves a manager on the in-memory stores and returns it
+// with the session cookie of a signed in user
+func newTestManager(t *testing.T, writeTimeout time.Duration) (*WebSocketManager, *httptest.Server, *http.Cookie) {
+	t.Helper()
+	cfg := config.Default()
+	cfg.WebSocket.WriteTimeout = writeTimeout
+	stores := memory.NewStores(clock.System)
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	user, err := stores.Users.CreateUser(&api.RegistrationRequest{Nickname: "alice", Email: "alice@example.com", CreatedAt: time.Now()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	session := &api.Session{UserID: user.ID, SessionID: "session-alice", CreatedAt: time.Now(), ExpiresAt: time.Now().Add(time.Hour)}
+	if err := stores.Sessions.CreateSession(session); err != nil {
+		t.Fatal(err)
+	}
+
+	events := services.NewEventBus(stores.Outbox, clock.System, services.EventPolicy{MaxAttempts: 1, RetryDelay: time.Minute, Retention: time.Hour}, logger)
+	previews := services.NewLinkPreviewer(stores.Previews, nil, clock.System, time.Hour, logger)
+	manager := NewWebSocketManager(logger, cfg.WebSocket, stores.Chats, services.NewAuthenticator(stores.Sessions, stores.Tokens),
+		services.NewSecurity(cfg.Security), services.NewValidator(cfg.Validation), previews, events, clock.System)
+	server := httptest.NewServer(http.HandlerFunc(manager.WebSocketHandler))
+	t.Cleanup(server.Close)
+	return manager, server, &http.Cookie{Name: services.SessionCookieName, Value: session.SessionID}
+}
+
+// dial connects to the manager and waits until it has registered the client
+func dial(t *testing.T, manager *WebSocketManager, server *httptest.Server, cookie *http.Cookie) (*websocket.Conn, *Client) {
+	t.Helper()
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), http.Header{"Cookie": {cookie.String()}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	for start := time.Now(); time.Since(start) < 5*time.Second; time.Sleep(10 * time.Millisecond) {
+		manager.mu.RLock()
+		for client := range manager.clients {
+			manager.mu.RUnlock()
+			return conn, client
+		}
+		manager.mu.RUnlock()
+	}
+	t.Fatal("the client was not registered")
+	return nil, nil
+}
+
+func TestShutdownWithStalledClient(t *testing.T) {
+	const writeTimeout = 100 * time.Millisecond
+	manager, server, cookie := newTestManager(t, writeTimeout)
+	_, client := dial(t, manager, server, cookie)
+
+	// The client reads nothing, so the socket buffers fill until a write times out
+	big := []byte(`"` + strings.Repeat("x", 1<<20) + `"`)
+	start := time.Now()
+	for client.sendMessage(big) == nil {
+		if time.Since(start) > 10*time.Second {
+			t.Fatal("writes to a client that reads nothing kept succeeding")
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	start = time.Now()
+	if err := manager.Shutdown(ctx); err != nil {
+		t.Fatalf("Shutdown = %v, want the stalled client closed", err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("Shutdown took %v", elapsed)
+	}
+}
+
+func TestShutdownClosesClients(t *testing.T) {
+	manager, server, cookie := newTestManager(t, time.Second)
+	conn, _ := dial(t, manager, server, cookie)
+
+	if err := manager.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	var restarting bool
+	for {
+		_, message, err := conn.ReadMessage()
+		if err != nil {
+			if !websocket.IsCloseError(err, websocket.CloseServiceRestart) {
+				t.Errorf("connection ended with %v, want a service restart close", err)
+			}
+			break
+		}
+		restarting = restarting || strings.Contains(string(message), `"server_restarting"`)
+	}
+	if !restarting {
+		t.Error("the client was not told that the server is restarting")
+	}
+
+	// A connection upgraded while shutting down is not registered
+	if err := manager.addClient(&Client{manager: manager, user: &api.UserResponse{ID: 1}}); !errors.Is(err, errClosing) {
+		t.Errorf("addClient during shutdown: err = %v, want errClosing", err)
+	}
+	if clients, _ := manager.Stats(); clients != 0 {
+		t.Errorf("%d clients registered after shutdown", clients)
+	}
+}
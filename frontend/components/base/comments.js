@@ -23,7 +23,7 @@ export async function renderComments(postID) {
                         </button>
                     </div>
                     <div class="questContainer">
-                        <div class="questtextbox" id="contentComm-${comment.id}" >${comment.content}</div>
+                        <div class="questtextbox" id="contentComm-${comment.id}" >${comment.content_html}</div>
                         <div class="addinfoframe-row">
                             <div class="postedby">
                                 <div class="tag">Posted by</div>
@@ -67,7 +67,7 @@ export async function renderAllPosts(sortBy = "Newest") {
             </div>
             <div class="questContainer">
               <div class="title click"><a href="/post/${post.id}">${post.title}</a></div>
-              <div class="questtextbox">${post.content}</div>
+              <div class="questtextbox">${post.content_html}</div>
               
               <div class="addinfoframe-row">
                 <div class="tags">
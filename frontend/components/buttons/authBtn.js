@@ -1,3 +1,4 @@
+import { getCSRFToken } from '../../utils/api.js';
 import { API_PREFIX } from '../../config.js';
 
 export async function authButton(event) {
@@ -25,7 +26,8 @@ export async function authButton(event) {
         const response = await fetch(`/${API_PREFIX}/auth/register`, {
             method: 'POST',
             headers: {
-                'Content-Type': 'application/json'
+                'Content-Type': 'application/json',
+                'X-CSRF-Token': getCSRFToken(),
             },
             body: JSON.stringify({ nickname, email, first_name, last_name, age, gender, password })
         });
@@ -1,3 +1,4 @@
+import { getCSRFToken } from '../../utils/api.js';
 import { API_PREFIX } from '../../config.js';
 
 let clickTimeouts = {}; // Store timeouts for each comment to prevent rapid clicking
@@ -8,6 +9,7 @@ export async function ratePost(postID, status) {
             method: 'PUT',
             headers: {
                 'Content-Type': 'application/json',
+                'X-CSRF-Token': getCSRFToken(),
             },
             body: JSON.stringify({ post_id: Number(postID), status })
         });
@@ -45,6 +47,7 @@ export async function rateComment(commentID, postID, status) {
             method: 'PUT',
             headers: {
                 'Content-Type': 'application/json',
+                'X-CSRF-Token': getCSRFToken(),
             },
             body: JSON.stringify({ comment_id: Number(commentID), post_id: Number(postID), status })
         });
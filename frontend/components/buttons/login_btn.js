@@ -1,3 +1,4 @@
+import { getCSRFToken } from '../../utils/api.js';
 import { API_PREFIX } from '../../config.js';
 
 export async function loginButton(event) {
@@ -15,7 +16,8 @@ export async function loginButton(event) {
         const response = await fetch(`/${API_PREFIX}/auth/login`, {  // Corrected the URL
             method: 'POST',
             headers: {
-                'Content-Type': 'application/json'
+                'Content-Type': 'application/json',
+                'X-CSRF-Token': getCSRFToken(),
             },
             body: JSON.stringify({ email, password })  // Keep credentials in the body
         });
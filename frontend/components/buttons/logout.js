@@ -1,3 +1,4 @@
+import { getCSRFToken } from '../../utils/api.js';
 import { API_PREFIX } from '../../config.js';
 
 export default async function handleLogout(event) {
@@ -9,7 +10,8 @@ export default async function handleLogout(event) {
         const response = await fetch(`/${API_PREFIX}/auth/logout`, {
             method: 'DELETE',
             headers: {
-                'Content-Type': 'application/json'
+                'Content-Type': 'application/json',
+                'X-CSRF-Token': getCSRFToken(),
             },
         });
 
@@ -1,5 +1,6 @@
 // postbtn.js
 
+import { getCSRFToken } from "../../utils/api.js";
 import { API_PREFIX } from "../../config.js";
 
 export async function postAnswer(event) {
@@ -22,6 +23,7 @@ export async function postAnswer(event) {
       method: "POST",
       headers: {
         "Content-Type": "application/json",
+        "X-CSRF-Token": getCSRFToken(),
       },
       body: JSON.stringify({ content }),
     });
@@ -1,3 +1,4 @@
+import { getCSRFToken } from "../../utils/api.js";
 import { API_PREFIX } from "../../config.js";
 
 export async function createPostButton(event) {
@@ -15,6 +16,7 @@ export async function createPostButton(event) {
       method: "POST",
       headers: {
         "Content-Type": "application/json",
+        "X-CSRF-Token": getCSRFToken(),
       },
       body: JSON.stringify({ title, content, categories }),
     });
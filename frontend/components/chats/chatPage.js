@@ -1,4 +1,4 @@
-import { fetchAllUsers, fetchChats, fetchChatsHash } from "../../utils/api.js";
+import { fetchAllUsers, fetchChats, fetchChatsHash, getCSRFToken } from "../../utils/api.js";
 import { timeAgo } from "../additional/time_count.js";
 import { renderHeader } from "../base/header.js";
 import { renderSidebar } from "../base/sidebar.js";
@@ -148,7 +148,8 @@ function getCurrentUserId() {
 }
 
 function setupWebSocket(ChatUserId) {
-  conn = new WebSocket(`ws://localhost:8080/api/ws`);
+  const wsProtocol = window.location.protocol === "https:" ? "wss" : "ws";
+  conn = new WebSocket(`${wsProtocol}://${window.location.host}/api/ws`);
 
   conn.onopen = function () {
     console.log("WebSocket connection established.");
@@ -184,6 +185,7 @@ async function createChatRoom(user1_id, user2_id) {
       method: "POST",
       headers: {
         "Content-Type": "application/json",
+        "X-CSRF-Token": getCSRFToken(),
       },
       body: JSON.stringify({ user1_id, user2_id }),  // These will now be integers
     });
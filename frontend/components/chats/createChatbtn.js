@@ -1,5 +1,6 @@
 // postbtn.js
 
+import { getCSRFToken } from "../../utils/api.js";
 import { API_PREFIX } from "../../config.js";
 
 export async function creatingChatsBtn(event) {
@@ -18,6 +19,7 @@ export async function creatingChatsBtn(event) {
       method: "POST",
       headers: {
         "Content-Type": "application/json",
+        "X-CSRF-Token": getCSRFToken(),
       },
       body: JSON.stringify({ user1_id , user1_id }),
     });
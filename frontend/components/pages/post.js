@@ -59,7 +59,7 @@ export async function renderPost(postID) {
                     </button>
                   </div>
                   <div class="questContainer">
-                    <div class="questtextbox">${post.content}</div>
+                    <div class="questtextbox">${post.content_html}</div>
                     <div class="addinfoframe-row">
                       <div class="tags">
                         ${post.categories.map(category => `<div class="tag tagview click">${category.name}</div>`).join("")}
@@ -58,7 +58,7 @@ export async function renderProfile(nickname) {
                     </div>
                     <div class="questContainer">
                         <div class="title click"><a href="/post/${post.id}">${post.title}</a></div>
-                        <div class="questtextbox">${post.content}</div>
+                        <div class="questtextbox">${post.content_html}</div>
                         
                         <div class="addinfoframe-row">
                             <div class="tags">
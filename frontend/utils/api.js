@@ -98,4 +98,10 @@ export async function fetchUserData(nickname, type) {
       console.error('Error fetching chats:', error);
       return [];
     }
-  }
\ No newline at end of file
+  }
+
+// getCSRFToken returns the double-submit token issued by the server in the csrf_token cookie
+export function getCSRFToken() {
+    const match = document.cookie.match(/(?:^|;\s*)csrf_token=([^;]*)/);
+    return match ? decodeURIComponent(match[1]) : '';
+}